@@ -124,6 +124,18 @@ func PromptAccount(adviceAddress common.Address, keystorePath, passwordfile stri
 	} else {
 		addr = adviceAddress
 	}
+	err = unlockWithPassword(addr.String(), passwordfile, func(password string) (err error) {
+		keybin, err = am.GetPrivateKey(addr, password)
+		return
+	})
+	return
+}
+
+/*
+unlockWithPassword 用password文件中的密码调用`unlock`,没有指定文件时提示用户输入,最多重试三次.
+`passwordfile`不是一个文件时,把它本身当作密码
+*/
+func unlockWithPassword(name, passwordfile string, unlock func(password string) error) (err error) {
 	if len(passwordfile) > 0 {
 		var data []byte
 		//#nosec
@@ -133,31 +145,25 @@ func PromptAccount(adviceAddress common.Address, keystorePath, passwordfile stri
 		}
 		password := string(data)
 		log.Trace(fmt.Sprintf("password is %s", password))
-		keybin, err = am.GetPrivateKey(addr, password)
+		err = unlock(password)
+		if err != nil {
+			err = fmt.Errorf("Incorrect password for %s in file. Aborting ... %s", name, err)
+		}
+		return
+	}
+	for i := 0; i < 3; i++ {
+		var pb []byte
+		//retries three times
+		pb, err = gopass.GetPasswdPrompt("Enter the password to unlock:", false, os.Stdin, os.Stdout)
 		if err != nil {
-			err = fmt.Errorf("Incorrect password for %s in file. Aborting ... %s", addr.String(), err)
 			return
 		}
-	} else {
-		for i := 0; i < 3; i++ {
-			var pb []byte
-			//retries three times
-			pb, err = gopass.GetPasswdPrompt("Enter the password to unlock:", false, os.Stdin, os.Stdout)
-			if err != nil {
-				return
-			}
-			password := string(pb) // getpass.Prompt("Enter the password to unlock:")
-			keybin, err = am.GetPrivateKey(addr, password)
-			if err != nil && i == 3 {
-				log.Error(fmt.Sprintf("Exhausted passphrase unlock attempts for %s. Aborting ...", addr))
-				return
-			}
-			if err != nil {
-				log.Error(fmt.Sprintf("password incorrect\n Please try again or kill the process to quit.\nUsually Ctrl-c."))
-				continue
-			}
-			break
+		err = unlock(string(pb))
+		if err == nil {
+			return
 		}
+		log.Error(fmt.Sprintf("password incorrect\n Please try again or kill the process to quit.\nUsually Ctrl-c."))
 	}
+	log.Error(fmt.Sprintf("Exhausted passphrase unlock attempts for %s. Aborting ...", name))
 	return
 }
@@ -0,0 +1,126 @@
+package accounts
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+//DefaultHDBasePath 和主流钱包一致,第i个账户为m/44'/60'/0'/0/i
+const DefaultHDBasePath = "m/44'/60'/0'/0"
+
+var errInvalidChildKey = errors.New("invalid child key, try next index")
+
+/*
+SeedFromMnemonic BIP39助记词生成种子,不检查助记词是否在词表中以及校验和是否正确
+*/
+func SeedFromMnemonic(mnemonic, passphrase string) []byte {
+	mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+	return pbkdf2.Key([]byte(mnemonic), []byte("mnemonic"+passphrase), 2048, 64, sha512.New)
+}
+
+//extendedKey BIP32中的私钥和chain code
+type extendedKey struct {
+	key       []byte
+	chainCode []byte
+}
+
+func newMasterKey(seed []byte) (*extendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, fmt.Errorf("seed length must be between 16 and 64 bytes, got %d", len(seed))
+	}
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	i := mac.Sum(nil)
+	k := new(big.Int).SetBytes(i[:32])
+	if k.Sign() == 0 || k.Cmp(crypto.S256().Params().N) >= 0 {
+		return nil, errors.New("invalid seed")
+	}
+	return &extendedKey{key: i[:32], chainCode: i[32:]}, nil
+}
+
+//child 派生第`index`个子私钥,index不小于0x80000000时为hardened派生
+func (k *extendedKey) child(index uint32) (*extendedKey, error) {
+	var data []byte
+	if index >= 0x80000000 {
+		data = append([]byte{0}, k.key...)
+	} else {
+		priv, err := crypto.ToECDSA(k.key)
+		if err != nil {
+			return nil, err
+		}
+		data = crypto.CompressPubkey(&priv.PublicKey)
+	}
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], index)
+	data = append(data, buf[:]...)
+	mac := hmac.New(sha512.New, k.chainCode)
+	mac.Write(data)
+	i := mac.Sum(nil)
+	n := crypto.S256().Params().N
+	il := new(big.Int).SetBytes(i[:32])
+	if il.Cmp(n) >= 0 {
+		return nil, errInvalidChildKey
+	}
+	childKey := il.Add(il, new(big.Int).SetBytes(k.key))
+	childKey.Mod(childKey, n)
+	if childKey.Sign() == 0 {
+		return nil, errInvalidChildKey
+	}
+	return &extendedKey{key: common.LeftPadBytes(childKey.Bytes(), 32), chainCode: i[32:]}, nil
+}
+
+//DeriveKey 按照BIP32从种子派生`path`对应的私钥
+func DeriveKey(seed []byte, path accounts.DerivationPath) (*ecdsa.PrivateKey, error) {
+	k, err := newMasterKey(seed)
+	if err != nil {
+		return nil, err
+	}
+	for _, index := range path {
+		k, err = k.child(index)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return crypto.ToECDSA(k.key)
+}
+
+//HDAccount 派生出来的一个账户
+type HDAccount struct {
+	Index   int            `json:"index"`
+	Path    string         `json:"path"`
+	Address common.Address `json:"address"`
+}
+
+/*
+DeriveAccounts 列出basePath下前`count`个账户,第i个账户的路径是basePath/i
+*/
+func DeriveAccounts(seed []byte, basePath accounts.DerivationPath, count int) ([]*HDAccount, error) {
+	var accs []*HDAccount
+	for i := 0; i < count; i++ {
+		path := append(append(accounts.DerivationPath{}, basePath...), uint32(i))
+		key, err := DeriveKey(seed, path)
+		if err == errInvalidChildKey {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		accs = append(accs, &HDAccount{
+			Index:   i,
+			Path:    path.String(),
+			Address: crypto.PubkeyToAddress(key.PublicKey),
+		})
+	}
+	return accs, nil
+}
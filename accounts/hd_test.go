@@ -0,0 +1,53 @@
+package accounts
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeriveKey(t *testing.T) {
+	//BIP32 test vector 1
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	cases := map[string]string{
+		"m/0'":      "edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea",
+		"m/0'/1":    "3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368",
+		"m/0'/1/2'": "cbce0d719ecf7431d88e6a89fa1483e02e35092af60c042b1df2ff59fa424dca",
+	}
+	for p, expect := range cases {
+		path, err := accounts.ParseDerivationPath(p)
+		assert.Nil(t, err)
+		key, err := DeriveKey(seed, path)
+		assert.Nil(t, err)
+		assert.EqualValues(t, expect, hex.EncodeToString(crypto.FromECDSA(key)), p)
+	}
+}
+
+func TestDeriveAccounts(t *testing.T) {
+	seed := SeedFromMnemonic("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "")
+	base, err := accounts.ParseDerivationPath(DefaultHDBasePath)
+	assert.Nil(t, err)
+	accs, err := DeriveAccounts(seed, base, 2)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, len(accs))
+	assert.EqualValues(t, common.HexToAddress("0x9858EfFD232B4033E47d90003D41EC34EcaEda94"), accs[0].Address)
+	assert.EqualValues(t, "m/44'/60'/0'/0/0", accs[0].Path)
+	assert.EqualValues(t, 1, accs[1].Index)
+	assert.NotEqual(t, accs[0].Address, accs[1].Address)
+}
+
+func TestEncryptSeed(t *testing.T) {
+	seed := SeedFromMnemonic("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "")
+	data, err := EncryptSeed(seed, "123", keystore.LightScryptN, keystore.LightScryptP)
+	assert.Nil(t, err)
+	seed2, err := DecryptSeed(data, "123")
+	assert.Nil(t, err)
+	assert.EqualValues(t, seed, seed2)
+	_, err = DecryptSeed(data, "456")
+	assert.EqualValues(t, errHDDecrypt, err)
+}
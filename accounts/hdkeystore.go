@@ -0,0 +1,188 @@
+package accounts
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/scrypt"
+)
+
+const hdKeyStoreVersion = 1
+
+var errHDDecrypt = errors.New("could not decrypt hd keystore with given password")
+
+/*
+hdKeyStoreJSON 加密保存的HD钱包种子,加密方式和V3 keystore相同:scrypt派生密钥,aes-128-ctr加密,keccak256校验
+*/
+type hdKeyStoreJSON struct {
+	Version    int    `json:"version"`
+	Ciphertext string `json:"ciphertext"`
+	IV         string `json:"iv"`
+	Salt       string `json:"salt"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	MAC        string `json:"mac"`
+}
+
+func aesCTR(key, iv, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(data))
+	cipher.NewCTR(block, iv).XORKeyStream(out, data)
+	return out, nil
+}
+
+//EncryptSeed 用`password`加密HD钱包种子,scryptN和scryptP的含义和keystore.EncryptKey相同
+func EncryptSeed(seed []byte, password string, scryptN, scryptP int) ([]byte, error) {
+	salt := utils.NewRandomHash()
+	derivedKey, err := scrypt.Key([]byte(password), salt[:], scryptN, 8, scryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	iv := utils.NewRandomHash()
+	ciphertext, err := aesCTR(derivedKey[:16], iv[:aes.BlockSize], seed)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(&hdKeyStoreJSON{
+		Version:    hdKeyStoreVersion,
+		Ciphertext: hex.EncodeToString(ciphertext),
+		IV:         hex.EncodeToString(iv[:aes.BlockSize]),
+		Salt:       hex.EncodeToString(salt[:]),
+		N:          scryptN,
+		R:          8,
+		P:          scryptP,
+		MAC:        hex.EncodeToString(crypto.Keccak256(derivedKey[16:32], ciphertext)),
+	}, "", "\t")
+}
+
+//DecryptSeed 解密EncryptSeed的结果
+func DecryptSeed(data []byte, password string) (seed []byte, err error) {
+	var ks hdKeyStoreJSON
+	err = json.Unmarshal(data, &ks)
+	if err != nil {
+		return
+	}
+	if ks.Version != hdKeyStoreVersion {
+		return nil, fmt.Errorf("unsupported hd keystore version %d", ks.Version)
+	}
+	ciphertext, err := hex.DecodeString(ks.Ciphertext)
+	if err != nil {
+		return
+	}
+	iv, err := hex.DecodeString(ks.IV)
+	if err != nil {
+		return
+	}
+	salt, err := hex.DecodeString(ks.Salt)
+	if err != nil {
+		return
+	}
+	mac, err := hex.DecodeString(ks.MAC)
+	if err != nil {
+		return
+	}
+	derivedKey, err := scrypt.Key([]byte(password), salt, ks.N, ks.R, ks.P, 32)
+	if err != nil {
+		return
+	}
+	if !bytes.Equal(crypto.Keccak256(derivedKey[16:32], ciphertext), mac) {
+		return nil, errHDDecrypt
+	}
+	return aesCTR(derivedKey[:16], iv, ciphertext)
+}
+
+//StoreSeed 加密保存HD钱包种子到文件`path`,文件已经存在时报错
+func StoreSeed(path string, seed []byte, password string) error {
+	if utils.Exists(path) {
+		return fmt.Errorf("%s already exists", path)
+	}
+	data, err := EncryptSeed(seed, password, keystore.StandardScryptN, keystore.StandardScryptP)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+/*
+PromptHDAccount 从HD钱包中选择一个账户,和PromptAccount一样,`adviceAddress`为空时列出前`count`个账户让用户选择.
+`basePath`为空时使用DefaultHDBasePath
+*/
+func PromptHDAccount(adviceAddress common.Address, hdKeystorePath, basePath string, count int, passwordfile string) (addr common.Address, keybin []byte, err error) {
+	if basePath == "" {
+		basePath = DefaultHDBasePath
+	}
+	base, err := accounts.ParseDerivationPath(basePath)
+	if err != nil {
+		return
+	}
+	data, err := ioutil.ReadFile(hdKeystorePath)
+	if err != nil {
+		return
+	}
+	var seed []byte
+	err = unlockWithPassword(hdKeystorePath, passwordfile, func(password string) (err error) {
+		seed, err = DecryptSeed(data, password)
+		return
+	})
+	if err != nil {
+		return
+	}
+	accs, err := DeriveAccounts(seed, base, count)
+	if err != nil {
+		return
+	}
+	var selected *HDAccount
+	for _, acc := range accs {
+		if acc.Address == adviceAddress {
+			selected = acc
+		}
+	}
+	if selected == nil {
+		if adviceAddress != utils.EmptyAddress {
+			err = fmt.Errorf("account %s is not one of the first %d accounts of %s. aborting", adviceAddress.String(), count, basePath)
+			return
+		}
+		fmt.Println("The following accounts were derived from your hd keystore:")
+		for i, acc := range accs {
+			fmt.Printf("%3d -  %s %s\n", i, acc.Address.String(), acc.Path)
+		}
+		fmt.Println("")
+		for selected == nil {
+			fmt.Printf("Select one of them by index to continue:\n")
+			idx := -1
+			_, err = fmt.Scanf("%d", &idx)
+			if err != nil {
+				return
+			}
+			if idx >= 0 && idx < len(accs) {
+				selected = accs[idx]
+			} else {
+				fmt.Printf("Error: Provided index %d is out of bounds", idx)
+			}
+		}
+	}
+	path, err := accounts.ParseDerivationPath(selected.Path)
+	if err != nil {
+		return
+	}
+	key, err := DeriveKey(seed, path)
+	if err != nil {
+		return
+	}
+	return selected.Address, crypto.FromECDSA(key), nil
+}
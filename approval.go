@@ -0,0 +1,154 @@
+package photon
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/SmartMeshFoundation/Photon/channel"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/transfer"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//IncomingTransfer 一笔发给自己的交易,以及接收方应用确认的状态
+type IncomingTransfer struct {
+	LockSecretHash common.Hash    `json:"lock_secret_hash"`
+	TokenAddress   common.Address `json:"token_address"`
+	Initiator      common.Address `json:"initiator_address"`
+	Partner        common.Address `json:"partner_address"` //交易的上一跳
+	Amount         *big.Int       `json:"amount"`
+	Expiration     int64          `json:"expiration"`           //锁过期的块
+	Status         string         `json:"status"`               //waiting_approval,secret_request或者rejected
+	PaymentID      string         `json:"payment_id,omitempty"` //发送方指定的支付ID,可以据此核对订单
+	Invoice        []byte         `json:"invoice,omitempty"`
+}
+
+/*
+TransferApprover 接收方应用注册的确认回调,在主线程中同步调用,必须尽快返回.
+返回nil表示接收这笔交易,返回错误表示拒绝,错误信息会通过AnnounceDisposed告诉上家
+*/
+type TransferApprover func(t *IncomingTransfer) error
+
+func newIncomingTransfer(state *mediatedtransfer.TargetState) *IncomingTransfer {
+	status := state.State
+	if status == "" {
+		status = mediatedtransfer.StateSecretRequest
+	}
+	return &IncomingTransfer{
+		LockSecretHash: state.FromTransfer.LockSecretHash,
+		TokenAddress:   state.FromTransfer.Token,
+		Initiator:      state.FromTransfer.Initiator,
+		Partner:        state.FromRoute.HopNode(),
+		Amount:         new(big.Int).Set(state.FromTransfer.Amount),
+		Expiration:     state.FromTransfer.Expiration,
+		Status:         status,
+		PaymentID:      state.FromTransfer.PaymentID,
+		Invoice:        state.FromTransfer.Invoice,
+	}
+}
+
+func (rs *Service) getTransferApprover() TransferApprover {
+	rs.transferApproverLock.Lock()
+	defer rs.transferApproverLock.Unlock()
+	return rs.transferApprover
+}
+
+func (rs *Service) setTransferApprover(approver TransferApprover) {
+	rs.transferApproverLock.Lock()
+	defer rs.transferApproverLock.Unlock()
+	rs.transferApprover = approver
+}
+
+//needTransferApproval 注册了确认回调或者启用了--target-approval时,收到的交易要确认以后才能发送SecretRequest
+func (rs *Service) needTransferApproval() bool {
+	return rs.getTransferApprover() != nil || rs.Config.TargetApproval
+}
+
+/*
+waitTransferApproval 接收方状态机已经在等待确认,注册了回调时立即由回调决定,否则等待应用通过API确认.
+确认之前不会发送任何消息,所以先保存通道状态和ack,避免上家一直重发MediatedTransfer
+*/
+func (rs *Service) waitTransferApproval(stateManager *transfer.StateManager, ch *channel.Channel) {
+	state, ok := stateManager.CurrentState.(*mediatedtransfer.TargetState)
+	if !ok || state.State != mediatedtransfer.StateWaitingApproval {
+		//已经来不及安全地接收这笔交易,和不需要确认的时候一样等锁过期
+		return
+	}
+	if stateManager.LastReceivedMessage == nil {
+		err := rs.UpdateChannelNoTx(channel.NewChannelSerialization(ch))
+		if err != nil {
+			log.Error(fmt.Sprintf("UpdateChannelNoTx err %s", err))
+		}
+	} else {
+		rs.UpdateChannelAndSaveAck(ch, stateManager.LastReceivedMessage.Tag())
+		stateManager.LastReceivedMessage = nil
+	}
+	approver := rs.getTransferApprover()
+	if approver == nil {
+		log.Info(fmt.Sprintf("transfer %s from %s is waiting for approval", utils.HPex(state.FromTransfer.LockSecretHash), utils.APex2(state.FromTransfer.Initiator)))
+		return
+	}
+	st := &mediatedtransfer.ActionApproveTransferStateChange{
+		LockSecretHash: state.FromTransfer.LockSecretHash,
+		Approved:       true,
+	}
+	err := approver(newIncomingTransfer(state))
+	if err != nil {
+		st.Approved = false
+		st.Reason = err.Error()
+		if len(st.Reason) > params.TransferApprovalReasonMaxLength {
+			st.Reason = st.Reason[:params.TransferApprovalReasonMaxLength]
+		}
+		log.Info(fmt.Sprintf("transfer %s is rejected by approver: %s", utils.HPex(st.LockSecretHash), st.Reason))
+	}
+	rs.StateMachineEventHandler.dispatch(stateManager, st)
+}
+
+//getPendingApprovals 返回所有等待确认的交易,按照锁过期的先后排序
+func (rs *Service) getPendingApprovals() (result *utils.AsyncResult) {
+	var transfers []*IncomingTransfer
+	for _, manager := range rs.Transfer2StateManager {
+		state, ok := manager.CurrentState.(*mediatedtransfer.TargetState)
+		if !ok || state.State != mediatedtransfer.StateWaitingApproval {
+			continue
+		}
+		transfers = append(transfers, newIncomingTransfer(state))
+	}
+	sort.Slice(transfers, func(i, j int) bool {
+		return transfers[i].Expiration < transfers[j].Expiration
+	})
+	result = utils.NewAsyncResult()
+	result.Tag = transfers
+	result.Result <- nil
+	return
+}
+
+/*
+approveTransfer 接收或者拒绝一笔等待确认的交易,返回处理以后的状态.
+确认得太晚时状态机同样会拒绝,状态为rejected
+*/
+func (rs *Service) approveTransfer(r *approveTransferReq) (result *utils.AsyncResult) {
+	key := utils.Sha3(r.lockSecretHash[:], r.tokenAddress[:])
+	manager := rs.Transfer2StateManager[key]
+	var state *mediatedtransfer.TargetState
+	if manager != nil {
+		state, _ = manager.CurrentState.(*mediatedtransfer.TargetState)
+	}
+	if state == nil || state.State != mediatedtransfer.StateWaitingApproval {
+		return utils.NewAsyncResultWithError(rerr.ErrTransferNotFound.Printf("no transfer waiting for approval with lock_secret_hash %s", r.lockSecretHash.String()))
+	}
+	rs.StateMachineEventHandler.dispatch(manager, &mediatedtransfer.ActionApproveTransferStateChange{
+		LockSecretHash: r.lockSecretHash,
+		Approved:       r.approved,
+		Reason:         r.reason,
+	})
+	result = utils.NewAsyncResult()
+	result.Tag = newIncomingTransfer(state)
+	result.Result <- nil
+	return
+}
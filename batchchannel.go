@@ -0,0 +1,92 @@
+package photon
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//BatchChannelItem 批量操作中的一个通道,和Partner的通道中存入Amount
+type BatchChannelItem struct {
+	Partner common.Address `json:"partner_address"`
+	Amount  *big.Int       `json:"balance"`
+}
+
+//BatchChannelResult 每个通道各自的结果,Error为空表示交易已经发出
+type BatchChannelResult struct {
+	Partner           common.Address `json:"partner_address"`
+	Amount            *big.Int       `json:"balance"`
+	ChannelIdentifier common.Hash    `json:"channel_identifier"`
+	Error             string         `json:"error,omitempty"`
+}
+
+//validateBatchChannelItems 有一项不合法时整批都不执行
+func validateBatchChannelItems(items []*BatchChannelItem) error {
+	if len(items) == 0 {
+		return rerr.ErrArgumentError.Append("no channel in batch")
+	}
+	if len(items) > params.MaxBatchChannelOperations {
+		return rerr.ErrArgumentError.Printf("at most %d channels in one batch", params.MaxBatchChannelOperations)
+	}
+	partners := make(map[common.Address]bool)
+	for _, item := range items {
+		if item.Amount == nil || item.Amount.Sign() <= 0 {
+			return rerr.ErrInvalidAmount.Printf("invalid balance for %s", item.Partner.String())
+		}
+		if partners[item.Partner] {
+			return rerr.ErrArgumentError.Printf("duplicate partner %s", item.Partner.String())
+		}
+		partners[item.Partner] = true
+	}
+	return nil
+}
+
+/*
+batchDepositAndOpenChannel 依次给每个通道发出交易,交易的nonce由BlockChainService统一分配,
+一个通道失败不影响其他通道,和DepositAndOpenChannel一样不等待交易打包
+*/
+func (r *API) batchDepositAndOpenChannel(tokenAddress common.Address, settleTimeout int, items []*BatchChannelItem, newChannel bool) (results []*BatchChannelResult, err error) {
+	if err = validateBatchChannelItems(items); err != nil {
+		return
+	}
+	if err = r.checkSmcStatus(); err != nil {
+		return
+	}
+	var failed int
+	for _, item := range items {
+		result := &BatchChannelResult{
+			Partner: item.Partner,
+			Amount:  item.Amount,
+		}
+		ch, err2 := r.DepositAndOpenChannel(tokenAddress, item.Partner, settleTimeout, r.Photon.Config.RevealTimeout, item.Amount, newChannel)
+		if err2 != nil {
+			result.Error = err2.Error()
+			failed++
+		}
+		if ch != nil {
+			result.ChannelIdentifier = ch.ChannelIdentifier.ChannelIdentifier
+		}
+		results = append(results, result)
+	}
+	log.Info(fmt.Sprintf("batch channel operation on token %s, newChannel=%v, %d of %d failed", tokenAddress.String(), newChannel, failed, len(items)))
+	return
+}
+
+/*
+BatchOpen 一次创建多个通道并存款,`settleTimeout`为0时使用默认值.
+返回每个通道各自的结果,只有参数错误时才返回err,这时没有发出任何交易
+*/
+func (r *API) BatchOpen(tokenAddress common.Address, settleTimeout int, items []*BatchChannelItem) ([]*BatchChannelResult, error) {
+	return r.batchDepositAndOpenChannel(tokenAddress, settleTimeout, items, true)
+}
+
+/*
+BatchDeposit 一次向多个已经打开的通道存款,返回每个通道各自的结果
+*/
+func (r *API) BatchDeposit(tokenAddress common.Address, items []*BatchChannelItem) ([]*BatchChannelResult, error) {
+	return r.batchDepositAndOpenChannel(tokenAddress, 0, items, false)
+}
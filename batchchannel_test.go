@@ -0,0 +1,32 @@
+package photon
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateBatchChannelItems(t *testing.T) {
+	assert.NotNil(t, validateBatchChannelItems(nil))
+	p1, p2 := utils.NewRandomAddress(), utils.NewRandomAddress()
+	items := []*BatchChannelItem{
+		{Partner: p1, Amount: big.NewInt(10)},
+		{Partner: p2, Amount: big.NewInt(20)},
+	}
+	assert.Nil(t, validateBatchChannelItems(items))
+	items[1].Amount = big.NewInt(0)
+	assert.NotNil(t, validateBatchChannelItems(items))
+	items[1].Amount = nil
+	assert.NotNil(t, validateBatchChannelItems(items))
+	items[1] = &BatchChannelItem{Partner: p1, Amount: big.NewInt(20)}
+	assert.NotNil(t, validateBatchChannelItems(items))
+	items = nil
+	for i := 0; i <= params.MaxBatchChannelOperations; i++ {
+		items = append(items, &BatchChannelItem{Partner: utils.NewRandomAddress(), Amount: big.NewInt(1)})
+	}
+	assert.NotNil(t, validateBatchChannelItems(items))
+	assert.Nil(t, validateBatchChannelItems(items[1:]))
+}
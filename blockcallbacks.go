@@ -0,0 +1,191 @@
+package photon
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/params"
+)
+
+//新块回调的优先级,同步回调按照优先级从高到低依次执行
+const (
+	BlockCallbackPriorityHigh   = 100
+	BlockCallbackPriorityNormal = 0
+	BlockCallbackPriorityLow    = -100
+)
+
+//BlockCallback 每个新块调用一次,同步回调在photon service主线程中执行,不能阻塞
+type BlockCallback func(blockNumber int64)
+
+//BlockCallbackStats 新块回调的执行统计,时间单位为微秒
+type BlockCallbackStats struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	Priority     int    `json:"priority"`
+	Async        bool   `json:"async"`
+	Calls        int64  `json:"calls"`
+	Dropped      int64  `json:"dropped"` //异步回调处理不过来而丢弃的块
+	LastLatency  int64  `json:"last_latency"`
+	MaxLatency   int64  `json:"max_latency"`
+	TotalLatency int64  `json:"total_latency"`
+}
+
+type blockCallback struct {
+	f     BlockCallback
+	queue chan int64 //只有异步回调才有,由自己的goroutine处理
+	quit  chan struct{}
+	lock  sync.Mutex
+	stats BlockCallbackStats
+}
+
+func (c *blockCallback) call(blockNumber int64) {
+	start := time.Now()
+	c.f(blockNumber)
+	latency := int64(time.Since(start) / time.Microsecond)
+	c.lock.Lock()
+	c.stats.Calls++
+	c.stats.LastLatency = latency
+	c.stats.TotalLatency += latency
+	if latency > c.stats.MaxLatency {
+		c.stats.MaxLatency = latency
+	}
+	c.lock.Unlock()
+}
+
+func (c *blockCallback) loop() {
+	for {
+		select {
+		case blockNumber := <-c.queue:
+			c.call(blockNumber)
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+//enqueue 队列满时丢弃最旧的块,保证回调总能看到最新的块
+func (c *blockCallback) enqueue(blockNumber int64) {
+	for {
+		select {
+		case c.queue <- blockNumber:
+			return
+		default:
+		}
+		select {
+		case <-c.queue:
+			c.lock.Lock()
+			c.stats.Dropped++
+			c.lock.Unlock()
+		default:
+		}
+	}
+}
+
+/*
+blockCallbacks 管理所有的新块回调,
+同步回调按照优先级在主线程中执行,异步回调各自在独立的goroutine中执行,慢的回调不会拖慢新块的处理
+*/
+type blockCallbacks struct {
+	lock      sync.Mutex
+	nextID    int
+	callbacks []*blockCallback //按照优先级从高到低排序
+}
+
+func newBlockCallbacks() *blockCallbacks {
+	return &blockCallbacks{}
+}
+
+func (bc *blockCallbacks) register(name string, priority int, async bool, f BlockCallback) int {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+	bc.nextID++
+	c := &blockCallback{
+		f: f,
+		stats: BlockCallbackStats{
+			ID:       bc.nextID,
+			Name:     name,
+			Priority: priority,
+			Async:    async,
+		},
+	}
+	if async {
+		c.queue = make(chan int64, params.BlockCallbackQueueSize)
+		c.quit = make(chan struct{})
+		go c.loop()
+	}
+	bc.callbacks = append(bc.callbacks, c)
+	sort.SliceStable(bc.callbacks, func(i, j int) bool {
+		return bc.callbacks[i].stats.Priority > bc.callbacks[j].stats.Priority
+	})
+	return c.stats.ID
+}
+
+func (bc *blockCallbacks) remove(id int) {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+	for i, c := range bc.callbacks {
+		if c.stats.ID == id {
+			if c.quit != nil {
+				close(c.quit)
+			}
+			bc.callbacks = append(bc.callbacks[:i], bc.callbacks[i+1:]...)
+			return
+		}
+	}
+}
+
+//dispatch 在锁外执行回调,回调中可以注册或者移除回调
+func (bc *blockCallbacks) dispatch(blockNumber int64) {
+	bc.lock.Lock()
+	callbacks := append([]*blockCallback{}, bc.callbacks...)
+	bc.lock.Unlock()
+	for _, c := range callbacks {
+		if c.queue != nil {
+			c.enqueue(blockNumber)
+			continue
+		}
+		c.call(blockNumber)
+	}
+}
+
+//stop 停止所有异步回调的goroutine
+func (bc *blockCallbacks) stop() {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+	for _, c := range bc.callbacks {
+		if c.quit != nil {
+			close(c.quit)
+		}
+	}
+	bc.callbacks = nil
+}
+
+func (bc *blockCallbacks) snapshot() (stats []*BlockCallbackStats) {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+	for _, c := range bc.callbacks {
+		c.lock.Lock()
+		s := c.stats
+		c.lock.Unlock()
+		stats = append(stats, &s)
+	}
+	return
+}
+
+/*
+RegisterBlockCallback 注册一个新块回调,返回的ID用于RemoveBlockCallback.
+`async`为false时回调在photon service主线程中按照`priority`从高到低依次执行,可以访问通道状态,但是不能阻塞;
+为true时在独立的goroutine中执行,不能访问photon service的内部状态.
+*/
+func (rs *Service) RegisterBlockCallback(name string, priority int, async bool, f BlockCallback) int {
+	log.Info(fmt.Sprintf("register block callback %s,priority=%d,async=%v", name, priority, async))
+	return rs.blockCallbacks.register(name, priority, async, f)
+}
+
+//RemoveBlockCallback 移除RegisterBlockCallback注册的回调
+func (rs *Service) RemoveBlockCallback(id int) {
+	rs.blockCallbacks.remove(id)
+}
@@ -0,0 +1,51 @@
+package photon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockCallbacks(t *testing.T) {
+	bc := newBlockCallbacks()
+	defer bc.stop()
+	var order []string
+	bc.register("low", BlockCallbackPriorityLow, false, func(blockNumber int64) {
+		order = append(order, "low")
+	})
+	high := bc.register("high", BlockCallbackPriorityHigh, false, func(blockNumber int64) {
+		order = append(order, "high")
+	})
+	block := make(chan struct{})
+	received := make(chan int64, 10)
+	bc.register("slow", BlockCallbackPriorityHigh, true, func(blockNumber int64) {
+		<-block
+		received <- blockNumber
+	})
+	//慢的异步回调不影响同步回调的执行
+	for n := int64(1); n <= 20; n++ {
+		bc.dispatch(n)
+	}
+	assert.EqualValues(t, "high", order[0])
+	assert.EqualValues(t, "low", order[1])
+	assert.EqualValues(t, 40, len(order))
+	close(block)
+	var last int64
+	for last != 20 {
+		select {
+		case last = <-received:
+		case <-time.After(time.Second):
+			t.Fatal("async callback should receive the latest block")
+		}
+	}
+	bc.remove(high)
+	order = nil
+	bc.dispatch(21)
+	assert.EqualValues(t, []string{"low"}, order)
+	stats := bc.snapshot()
+	assert.EqualValues(t, 2, len(stats))
+	assert.EqualValues(t, "slow", stats[0].Name)
+	assert.EqualValues(t, true, stats[0].Dropped > 0)
+	assert.EqualValues(t, 21, stats[1].Calls)
+}
@@ -0,0 +1,58 @@
+package blockchain
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/SmartMeshFoundation/Photon/network/helper"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+/*
+BlockNumberSource 提供当前可以处理的最新块,AlarmTask只处理不超过该块的事件.
+默认直接使用公链的最新块,对于出块时间不规律或者需要自定义确认逻辑的公链,可以替换为其他实现.
+*/
+type BlockNumberSource interface {
+	// LatestConfirmedBlock 返回当前可以处理的最新块,返回的块号不要求连续,但是不能小于0
+	LatestConfirmedBlock(ctx context.Context) (*types.Header, error)
+}
+
+//headerBlockNumberSource 以公链的最新块作为已确认块
+type headerBlockNumberSource struct {
+	client *helper.SafeEthClient
+}
+
+//NewHeaderBlockNumberSource 默认的BlockNumberSource,公链最新块即为已确认块
+func NewHeaderBlockNumberSource(client *helper.SafeEthClient) BlockNumberSource {
+	return &headerBlockNumberSource{client}
+}
+
+func (s *headerBlockNumberSource) LatestConfirmedBlock(ctx context.Context) (*types.Header, error) {
+	return s.client.HeaderByNumber(ctx, nil)
+}
+
+//confirmedBlockNumberSource 落后公链最新块confirmations个块
+type confirmedBlockNumberSource struct {
+	client        *helper.SafeEthClient
+	confirmations int64
+}
+
+/*
+NewConfirmedBlockNumberSource 只有经过`confirmations`个块确认以后才认为该块已确认,
+适用于出块快但是容易发生短分叉的公链
+*/
+func NewConfirmedBlockNumberSource(client *helper.SafeEthClient, confirmations int64) BlockNumberSource {
+	return &confirmedBlockNumberSource{client, confirmations}
+}
+
+func (s *confirmedBlockNumberSource) LatestConfirmedBlock(ctx context.Context) (*types.Header, error) {
+	h, err := s.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	number := h.Number.Int64() - s.confirmations
+	if number <= 0 || s.confirmations <= 0 {
+		return h, nil
+	}
+	return s.client.HeaderByNumber(ctx, big.NewInt(number))
+}
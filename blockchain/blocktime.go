@@ -0,0 +1,71 @@
+package blockchain
+
+import (
+	"sync"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/params"
+)
+
+type blockSample struct {
+	number int64
+	time   time.Time
+}
+
+/*
+BlockTimeEstimator 根据最近params.BlockTimeEstimateWindow个新块被AlarmTask发现的时间,估计出块间隔,
+中间漏掉的块也计算在内,所以补齐的块不会让估计值变小
+*/
+type BlockTimeEstimator struct {
+	lock             sync.Mutex
+	samples          []blockSample
+	defaultBlockTime time.Duration
+}
+
+//NewBlockTimeEstimator create BlockTimeEstimator, `defaultBlockTime` is used before enough blocks are observed
+func NewBlockTimeEstimator(defaultBlockTime time.Duration) *BlockTimeEstimator {
+	return &BlockTimeEstimator{defaultBlockTime: defaultBlockTime}
+}
+
+//AddBlock 在`t`时刻发现了新块`number`
+func (e *BlockTimeEstimator) AddBlock(number int64, t time.Time) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if len(e.samples) > 0 && number <= e.samples[len(e.samples)-1].number {
+		//分叉或者切换公链节点以后块号回退,之前的样本不再有意义
+		e.samples = e.samples[:0]
+	}
+	e.samples = append(e.samples, blockSample{number, t})
+	if len(e.samples) > params.BlockTimeEstimateWindow {
+		e.samples = e.samples[len(e.samples)-params.BlockTimeEstimateWindow:]
+	}
+}
+
+//BlockTime returns the moving average of block interval
+func (e *BlockTimeEstimator) BlockTime() time.Duration {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.blockTime()
+}
+
+func (e *BlockTimeEstimator) blockTime() time.Duration {
+	if len(e.samples) < 2 {
+		return e.defaultBlockTime
+	}
+	first, last := e.samples[0], e.samples[len(e.samples)-1]
+	return last.time.Sub(first.time) / time.Duration(last.number-first.number)
+}
+
+//EstimateTime 估计块`number`出现的时间,已经出现的块返回最近一次发现新块的时间
+func (e *BlockTimeEstimator) EstimateTime(number int64) time.Time {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if len(e.samples) == 0 {
+		return time.Now().Add(e.defaultBlockTime)
+	}
+	last := e.samples[len(e.samples)-1]
+	if number <= last.number {
+		return last.time
+	}
+	return last.time.Add(time.Duration(number-last.number) * e.blockTime())
+}
@@ -0,0 +1,55 @@
+package blockchain
+
+import (
+	"sync"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/params"
+)
+
+/*
+ClockSkewDetector 比较新块的时间戳和本机发现它的时间,估计本机时钟的偏差.
+新块总是在时间戳之后才会被发现,所以取最近params.BlockTimeEstimateWindow个块中相差最小的作为偏差,
+使用已确认的块时其中还包括等待确认的时间
+*/
+type ClockSkewDetector struct {
+	lock    sync.Mutex
+	samples []time.Duration
+}
+
+//NewClockSkewDetector create ClockSkewDetector
+func NewClockSkewDetector() *ClockSkewDetector {
+	return &ClockSkewDetector{}
+}
+
+//AddBlock 本机时间`localTime`发现了时间戳为`blockTime`的新块
+func (d *ClockSkewDetector) AddBlock(blockTime, localTime time.Time) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.samples = append(d.samples, localTime.Sub(blockTime))
+	if len(d.samples) > params.BlockTimeEstimateWindow {
+		d.samples = d.samples[len(d.samples)-params.BlockTimeEstimateWindow:]
+	}
+}
+
+//Skew 本机时钟比公链快多少,负数表示慢,还没有样本时返回0
+func (d *ClockSkewDetector) Skew() time.Duration {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if len(d.samples) == 0 {
+		return 0
+	}
+	skew := d.samples[0]
+	for _, s := range d.samples[1:] {
+		if s < skew {
+			skew = s
+		}
+	}
+	return skew
+}
+
+//Diverged 偏差是否超过了params.ClockSkewThreshold
+func (d *ClockSkewDetector) Diverged() bool {
+	skew := d.Skew()
+	return skew > params.ClockSkewThreshold || skew < -params.ClockSkewThreshold
+}
@@ -1,7 +1,6 @@
 package blockchain
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 
@@ -10,16 +9,18 @@ import (
 	"math/big"
 
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/SmartMeshFoundation/Photon/log"
 	"github.com/SmartMeshFoundation/Photon/models"
 	"github.com/SmartMeshFoundation/Photon/network/helper"
-	"github.com/SmartMeshFoundation/Photon/network/rpc"
 	"github.com/SmartMeshFoundation/Photon/network/rpc/contracts"
 	"github.com/SmartMeshFoundation/Photon/params"
 	"github.com/SmartMeshFoundation/Photon/transfer"
 	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer"
 	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -54,26 +55,27 @@ func init() {
 
 }
 
-type eventID [25]byte //txHash+logIndex
-//假定一个tx中事件不可能超过256
-func makeEventID(l *types.Log) eventID {
-	var e eventID
-	copy(e[:], l.TxHash[:])
-	e[24] = byte(l.Index)
-	return e
-}
-
 /*
 Events handles all contract events from blockchain
 */
 type Events struct {
 	StateChangeChannel  chan transfer.StateChange
 	lastBlockNumber     int64
-	rpcModuleDependency RPCModuleDependency
+	logs                *LogPoller
 	client              *helper.SafeEthClient
 	pollPeriod          time.Duration              // 轮询周期,必须与公链出块间隔一致
-	stopChan            chan int                   // has stopped?
-	txDone              map[eventID]uint64         // 该map记录最近30块内处理的events流水,用于事件去重
+	lock                sync.Mutex                 // 保护Start和Stop
+	ctx                 context.Context            // AlarmTask的生命周期,Stop时取消
+	cancel              context.CancelFunc         // 取消ctx,nil表示AlarmTask没有运行
+	stopped             chan struct{}              // AlarmTask退出时关闭
+	blockTime           *BlockTimeEstimator        // 估计出块间隔
+	clockSkew           *ClockSkewDetector         // 估计本机时钟的偏差
+	newBlockLock        sync.Mutex                 // 保护notifiedBlockNumber和newBlock
+	notifiedBlockNumber int64                      // 已经通知给photon service的最新块
+	newBlock            chan struct{}              // 通知新块以后关闭,唤醒WaitForBlock
+	blockHashes         map[int64]common.Hash      // 最近处理过的块的hash,用于检测分叉
+	blockNumberSource   BlockNumberSource          // 当前已确认块的来源
+	oldestUnconfirmed   int64                      // 还没有确认的最早的事件所在的块,0表示没有,原子访问
 	firstStart          bool                       //保证ContractHistoryEventCompleteStateChange 只会发送一次
 	chainEventRecordDao models.ChainEventRecordDao // 事件处理记录保存
 }
@@ -82,24 +84,64 @@ type Events struct {
 func NewBlockChainEvents(client *helper.SafeEthClient, rpcModuleDependency RPCModuleDependency, chainEventRecordDao models.ChainEventRecordDao) *Events {
 	be := &Events{
 		StateChangeChannel:  make(chan transfer.StateChange, 10),
-		rpcModuleDependency: rpcModuleDependency,
+		ctx:                 context.Background(),
+		blockTime:           NewBlockTimeEstimator(params.DefaultEthRPCPollPeriod),
+		clockSkew:           NewClockSkewDetector(),
+		notifiedBlockNumber: -1,
+		newBlock:            make(chan struct{}),
+		logs:                NewLogPoller(client, rpcModuleDependency),
 		client:              client,
-		txDone:              make(map[eventID]uint64),
+		blockHashes:         make(map[int64]common.Hash),
+		blockNumberSource:   NewHeaderBlockNumberSource(client),
 		firstStart:          true,
 		chainEventRecordDao: chainEventRecordDao,
 	}
 	return be
 }
 
-//Stop event listenging
-func (be *Events) Stop() {
-	be.pollPeriod = 0
-	if be.stopChan != nil {
-		close(be.stopChan)
+//SetBlockNumberSource replace the default source of latest confirmed block, must be called before Start
+func (be *Events) SetBlockNumberSource(s BlockNumberSource) {
+	be.blockNumberSource = s
+}
+
+//SetForkConfirmBlocks EnableForkConfirm时事件需要的确认块数,不能超过重启以后重新扫描的范围,必须在Start之前调用
+func (be *Events) SetForkConfirmBlocks(n int64) {
+	be.logs.SetConfirmBlocks(n)
+}
+
+/*
+CheckpointBlockNumber photon service处理完块`blockNumber`以后可以保存的块号.
+还在等待确认的事件没有记录在任何地方,保存的块号不能超过其中最早的一个,否则重启以后查询不到
+*/
+func (be *Events) CheckpointBlockNumber(blockNumber int64) int64 {
+	oldest := atomic.LoadInt64(&be.oldestUnconfirmed)
+	if oldest > 0 && oldest < blockNumber {
+		return oldest
 	}
+	return blockNumber
+}
+
+/*
+Stop event listenging,
+返回时AlarmTask已经退出并且取消了新块订阅,之后可以再次调用Start
+*/
+func (be *Events) Stop() {
+	be.lock.Lock()
+	defer be.lock.Unlock()
+	be.stopAlarmTask()
 	log.Info("Events stop ok...")
 }
 
+func (be *Events) stopAlarmTask() {
+	if be.cancel == nil {
+		return
+	}
+	be.cancel()
+	<-be.stopped
+	be.cancel = nil
+	be.stopped = nil
+}
+
 /*
 Start listening events send to  channel can duplicate but cannot lose.
 1. first resend events may lost (duplicat is ok)
@@ -122,19 +164,28 @@ Start listening events send to  channel can duplicate but cannot lose.
  */
 func (be *Events) Start(LastBlockNumber int64) {
 	log.Info(fmt.Sprintf("get state change since %d", LastBlockNumber))
+	be.lock.Lock()
+	defer be.lock.Unlock()
+	//重连时AlarmTask可能因为出错已经退出,也可能还在运行,无论哪种情况都要先等它退出,保证同时只有一个AlarmTask
+	be.stopAlarmTask()
 	be.lastBlockNumber = LastBlockNumber
+	be.ctx, be.cancel = context.WithCancel(context.Background())
+	be.stopped = make(chan struct{})
 	/*
 		1. start alarm task
 	*/
-	go be.startAlarmTask()
+	go func(stopped chan struct{}) {
+		defer close(stopped)
+		be.startAlarmTask()
+	}(be.stopped)
 }
 func (be *Events) notifyPhotonStartupCompleteIfNeeded(currentBlock int64) {
 	if be.firstStart {
 		be.firstStart = false
 		//通知photon,历史消息处理完毕,可以进行后续启动了.
-		be.StateChangeChannel <- &mediatedtransfer.ContractHistoryEventCompleteStateChange{
+		be.sendStateChange(&mediatedtransfer.ContractHistoryEventCompleteStateChange{
 			BlockNumber: currentBlock,
-		}
+		})
 	}
 }
 func (be *Events) startAlarmTask() {
@@ -143,8 +194,15 @@ func (be *Events) startAlarmTask() {
 	currentBlock := be.lastBlockNumber
 	logPeriod := int64(1)
 	retryTime := 0
-	be.stopChan = make(chan int)
-	be.StateChangeChannel <- &transfer.BlockStateChange{BlockNumber: currentBlock}
+	be.sendStateChange(&transfer.BlockStateChange{BlockNumber: currentBlock})
+	be.notifyNewBlock(currentBlock)
+	// 公链节点支持订阅时,收到新块通知立即处理,否则只能按照pollPeriod轮询
+	heads, sub := be.subscribeNewHead()
+	defer func() {
+		if sub != nil {
+			sub.Unsubscribe()
+		}
+	}()
 	/*
 		正常处理流程:
 		1. 抓取历史事件,排序,发送给photon
@@ -153,29 +211,29 @@ func (be *Events) startAlarmTask() {
 		通知photon启动完毕
 		也就是说无论发生了什么错误,尽快通知photon启动完毕,不要卡主.
 	*/
+	if params.ChainID.Int64() == params.TestPrivateChainID {
+		be.pollPeriod = params.DefaultEthRPCPollPeriodForTest
+		logPeriod = 10
+	} else if params.ChainID.Int64() == params.TestPrivateChainID2 {
+		be.pollPeriod = params.DefaultEthRPCPollPeriodForTest / 10
+		logPeriod = 1000
+	} else {
+		be.pollPeriod = params.DefaultEthRPCPollPeriod
+	}
 	for {
-		//get the lastest number imediatelly
-		if be.pollPeriod == 0 {
-			// first time
-			if params.ChainID.Int64() == params.TestPrivateChainID {
-				be.pollPeriod = params.DefaultEthRPCPollPeriodForTest
-				logPeriod = 10
-			} else if params.ChainID.Int64() == params.TestPrivateChainID2 {
-				be.pollPeriod = params.DefaultEthRPCPollPeriodForTest / 10
-				logPeriod = 1000
-			} else {
-				be.pollPeriod = params.DefaultEthRPCPollPeriod
-			}
+		if be.ctx.Err() != nil {
+			log.Info(fmt.Sprintf("AlarmTask quit complete"))
+			return
 		}
-		ctx, cancelFunc := context.WithTimeout(context.Background(), params.EthRPCTimeout)
-		h, err := be.client.HeaderByNumber(ctx, nil)
+		//get the lastest number imediatelly
+		ctx, cancelFunc := context.WithTimeout(be.ctx, params.EthRPCTimeout)
+		h, err := be.blockNumberSource.LatestConfirmedBlock(ctx)
 		if err != nil {
 			//无论公链发生什么错误,都应该让photon启动起来,而不是卡主
 			be.notifyPhotonStartupCompleteIfNeeded(currentBlock)
 			log.Error(fmt.Sprintf("HeaderByNumber err=%s", err))
 			cancelFunc()
-			if be.stopChan != nil {
-				be.pollPeriod = 0
+			if be.ctx.Err() == nil {
 				go be.client.RecoverDisconnect()
 			}
 			return
@@ -190,22 +248,30 @@ func (be *Events) startAlarmTask() {
 				}
 				// 当启动时获取不到新块,也需要通知photonService,否则会导致api无法启动
 				log.Warn(fmt.Sprintf("photon start with blockNumber %d,but lastedBlockNumber on chain also %d", startUpBlockNumber, lastedBlock))
-				be.StateChangeChannel <- &transfer.BlockStateChange{BlockNumber: currentBlock}
+				be.sendStateChange(&transfer.BlockStateChange{BlockNumber: currentBlock})
 				startUpBlockNumber = 0
 			}
 			//在启动的时候连接到了一条无效的公链(不出块)的情况下,photon也应该可以继续启动.
 			// 连接到另外一个节点,该节点落后很多,也应该让photon尽快启动
 			be.notifyPhotonStartupCompleteIfNeeded(currentBlock)
-			time.Sleep(be.pollPeriod / 2)
+			if !be.sleep(be.pollPeriod / 2) {
+				continue
+			}
 			retryTime++
 			if retryTime > 10 {
 				log.Warn(fmt.Sprintf("get same block number %d from chain %d times,maybe something wrong with smc ...", lastedBlock, retryTime))
 			}
+			//当前公链节点长时间不出块,如果有备用节点,切换过去
+			if retryTime > params.EthRPCStallRetryTimes && be.client.HasBackup() {
+				log.Error(fmt.Sprintf("eth rpc server %s stalled at block %d, fail over to next server", be.client.URL(), lastedBlock))
+				go be.client.FailOver()
+				return
+			}
 			continue
 		}
 		retryTime = 0
 		if currentBlock != -1 && lastedBlock != currentBlock+1 {
-			log.Warn(fmt.Sprintf("AlarmTask missed %d blocks,currentBlock=%d", lastedBlock-currentBlock-1, currentBlock))
+			log.Warn(fmt.Sprintf("AlarmTask missed %d blocks,currentBlock=%d,they will be backfilled", lastedBlock-currentBlock-1, currentBlock))
 		}
 		if lastedBlock%logPeriod == 0 {
 			log.Trace(fmt.Sprintf("new block :%d", lastedBlock))
@@ -215,24 +281,39 @@ func (be *Events) startAlarmTask() {
 		if fromBlockNumber < 0 {
 			fromBlockNumber = 0
 		}
+		// 发生分叉时,从分叉点开始重新查询事件,被替换的块中的事件需要重新发送
+		if reorg := be.detectReorg(h, currentBlock); reorg != nil {
+			log.Warn(fmt.Sprintf("chain reorg detected, blocks from %d are replaced, old hash=%s,new hash=%s",
+				reorg.ForkBlockNumber, reorg.OldHash.String(), reorg.NewHash.String()))
+			be.sendStateChange(reorg)
+			if reorg.ForkBlockNumber < fromBlockNumber {
+				fromBlockNumber = reorg.ForkBlockNumber
+			}
+			be.logs.Forget(reorg.ForkBlockNumber)
+		}
 		// get all state change between currentBlock and lastedBlock
-		stateChanges, err := be.queryAllStateChange(fromBlockNumber, lastedBlock)
+		stateChanges, err := be.logs.Poll(fromBlockNumber, lastedBlock, be.lastBlockNumber)
 		if err != nil {
-			log.Error(fmt.Sprintf("queryAllStateChange err=%s", err))
+			log.Error(fmt.Sprintf("poll contract logs err=%s", err))
 			//无论公链发生什么错误,都应该让photon启动起来,而不是卡主
 			be.notifyPhotonStartupCompleteIfNeeded(currentBlock)
 			// 如果这里出现err,不能继续处理该blocknumber,否则会丢事件,直接从该块重新处理即可
-			time.Sleep(be.pollPeriod / 2)
+			be.sleep(be.pollPeriod / 2)
 			continue
 		}
 		if len(stateChanges) > 0 {
 			log.Trace(fmt.Sprintf("receive %d events between block %d - %d", len(stateChanges), fromBlockNumber, lastedBlock))
 		}
 
+		atomic.StoreInt64(&be.oldestUnconfirmed, be.logs.OldestUnconfirmed())
 		// refresh block number and notify PhotonService
+		previousBlock := currentBlock
 		currentBlock = lastedBlock
 		be.lastBlockNumber = currentBlock
-		var lastSendBlockNumber int64
+		//启动时的历史块不需要逐块通知,启动完成以后漏掉的块需要补齐,保证photon service收到的块号连续递增.
+		//无论哪种情况都不能通知比已经通知过的块更早的块
+		backfill := !be.firstStart && previousBlock > 0
+		lastSendBlockNumber := previousBlock
 		// notify Photon service
 		//我们需要photon service在处理相关事件的时候知道了对应的块已经发生了,否则可能因为错误的当前块数而出现逻辑错误.
 		//同时也需要以下问题得到有效解决
@@ -241,347 +322,219 @@ func (be *Events) startAlarmTask() {
 		//但是很有可能B已经在链上注册了密码,这个时候A如果发送RemoveExpiredHashLock,将会导致该通道无法使用.
 		//因为B会拒绝RemoveExpiredHashLock.为了避免这种情况,一定要在处理最新块之前,处理SerecretRevealOnChain
 		for _, sc := range stateChanges {
-			if sc.GetBlockNumber() != lastSendBlockNumber {
-				be.StateChangeChannel <- &transfer.BlockStateChange{BlockNumber: sc.GetBlockNumber()}
+			//已经通知过的块中的事件(比如等待确认的事件,重启以后重新扫描到的事件)直接发送
+			if sc.GetBlockNumber() > lastSendBlockNumber {
+				if backfill {
+					be.sendBlockStateChanges(lastSendBlockNumber, sc.GetBlockNumber())
+				} else {
+					be.sendStateChange(&transfer.BlockStateChange{BlockNumber: sc.GetBlockNumber()})
+				}
 				lastSendBlockNumber = sc.GetBlockNumber()
 			}
-			be.StateChangeChannel <- sc
+			be.sendStateChange(sc)
 		}
 		//正常启动流程是,所有历史事件处理完毕,然后再通知photon继续启动
 		be.notifyPhotonStartupCompleteIfNeeded(currentBlock)
-		if lastSendBlockNumber != currentBlock {
-			be.StateChangeChannel <- &transfer.BlockStateChange{BlockNumber: currentBlock}
+		if backfill {
+			be.sendBlockStateChanges(lastSendBlockNumber, currentBlock)
+		} else if lastSendBlockNumber < currentBlock {
+			be.sendStateChange(&transfer.BlockStateChange{BlockNumber: currentBlock})
 		}
+		be.blockTime.AddBlock(currentBlock, time.Now())
+		be.checkClockSkew(h)
+		be.notifyNewBlock(currentBlock)
 		//// 每5倍确认块清除一次过期流水
 		//if fromBlockNumber%(5*params.ForkConfirmNumber) == 0 {
 		//	be.chainEventRecordDao.ClearOldChainEventRecord(uint64(fromBlockNumber))
 		//}
 		// 清除过期流水
-		for key, blockNumber := range be.txDone {
-			if blockNumber <= uint64(fromBlockNumber) {
-				delete(be.txDone, key)
-			}
-		}
+		be.logs.Prune(fromBlockNumber)
 		// wait to next time
 		//time.Sleep(be.pollPeriod)
+		var subErr <-chan error
+		if sub != nil {
+			subErr = sub.Err()
+		}
 		select {
 		case <-time.After(be.pollPeriod):
-		case <-be.stopChan:
-			be.stopChan = nil
-			log.Info(fmt.Sprintf("AlarmTask quit complete"))
-			return
+		case <-heads:
+		case err = <-subErr:
+			log.Warn(fmt.Sprintf("new head subscription err %v, fall back to polling every %s", err, be.pollPeriod))
+			sub.Unsubscribe()
+			heads, sub = nil, nil
+		case <-be.ctx.Done():
 		}
 	}
 }
 
-func (be *Events) queryAllStateChange(fromBlock int64, toBlock int64) (stateChanges []mediatedtransfer.ContractStateChange, err error) {
-	/*
-		get all event of contract TokenNetworkRegistry, SecretRegistry , TokenNetwork
-	*/
-	logs, err := be.getLogsFromChain(fromBlock, toBlock)
-	if err != nil {
-		return
+//sleep 等待`d`,Stop时立即返回false
+func (be *Events) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-be.ctx.Done():
+		return false
 	}
-	stateChanges, err = be.parseLogsToEvents(logs)
-	if err != nil {
-		return
+}
+
+//sendStateChange 发送给photon service,Stop以后photon service不再读取,直接丢弃
+func (be *Events) sendStateChange(sc transfer.StateChange) {
+	select {
+	case be.StateChangeChannel <- sc:
+	case <-be.ctx.Done():
 	}
-	// 排序
-	sortContractStateChange(stateChanges)
-	return
 }
 
-func (be *Events) getLogsFromChain(fromBlock int64, toBlock int64) (logs []types.Log, err error) {
-	/*
-		get all event of contract TokenNetworkRegistry, SecretRegistry , TokenNetwork
-	*/
-	contractAddresses := []common.Address{
-		be.rpcModuleDependency.GetRegistryAddress(),
-		be.rpcModuleDependency.GetSecretRegistryAddress(),
+/*
+subscribeNewHead 订阅新块通知,http rpc等不支持订阅的公链节点返回nil,AlarmTask自动退回到轮询模式
+*/
+func (be *Events) subscribeNewHead() (heads chan *types.Header, sub ethereum.Subscription) {
+	if !params.EthRPCSubscribeNewHead {
+		return nil, nil
 	}
-	logs, err = rpc.EventsGetInternal(
-		rpc.GetQueryConext(), contractAddresses, fromBlock, toBlock, be.client)
+	heads = make(chan *types.Header, 10)
+	ctx, cancel := context.WithTimeout(be.ctx, params.EthRPCTimeout)
+	defer cancel()
+	sub, err := be.client.SubscribeNewHead(ctx, heads)
 	if err != nil {
-		return
+		log.Info(fmt.Sprintf("eth rpc server %s does not support SubscribeNewHead, poll new block instead : %s", be.client.URL(), err))
+		return nil, nil
 	}
-	return
+	log.Info(fmt.Sprintf("subscribe new head from %s", be.client.URL()))
+	return heads, sub
 }
 
-func (be *Events) parseLogsToEvents(logs []types.Log) (stateChanges []mediatedtransfer.ContractStateChange, err error) {
-	for _, l := range logs {
-		eventName := topicToEventName[l.Topics[0]]
-		// 根据已处理流水去重
-		if doneBlockNumber, ok := be.txDone[makeEventID(&l)]; ok {
-			if doneBlockNumber == l.BlockNumber {
-				//log.Trace(fmt.Sprintf("get event txhash=%s repeated,ignore...", l.TxHash.String()))
-				continue
-			}
-			log.Warn(fmt.Sprintf("event tx=%s happened at %d, but now happend at %d ", l.TxHash.String(), doneBlockNumber, l.BlockNumber))
-		}
-		//chainEventRecordID := be.chainEventRecordDao.MakeChainEventID(&l)
-		//// 根据已处理流水去重
-		//if doneBlockNumber, delivered := be.chainEventRecordDao.CheckChainEventDelivered(chainEventRecordID); delivered {
-		//	if doneBlockNumber == l.BlockNumber {
-		//		//log.Trace(fmt.Sprintf("get event txhash=%s repeated,ignore...", l.TxHash.String()))
-		//		continue
-		//	}
-		//	log.Warn(fmt.Sprintf("event tx=%s happened at %d, but now happend at %d ", l.TxHash.String(), doneBlockNumber, l.BlockNumber))
-		//}
+//notifyNewBlock 唤醒所有等待的WaitForBlock
+func (be *Events) notifyNewBlock(blockNumber int64) {
+	be.newBlockLock.Lock()
+	defer be.newBlockLock.Unlock()
+	be.notifiedBlockNumber = blockNumber
+	close(be.newBlock)
+	be.newBlock = make(chan struct{})
+}
 
-		// open,deposit,withdraw事件延迟确认,开关默认关闭,方便测试
-		if params.EnableForkConfirm && needConfirm(eventName) {
-			if be.lastBlockNumber-int64(l.BlockNumber) < params.ForkConfirmNumber {
-				continue
-			}
-			log.Info(fmt.Sprintf("event %s tx=%s happened at %d, confirmed at %d", eventName, l.TxHash.String(), l.BlockNumber, be.lastBlockNumber))
-		}
-		// registry secret事件延迟确认,否则在出现恶意分叉的情况下,中间节点有损失资金的风险
-		if eventName == params.NameSecretRevealed && params.EnableForkConfirm {
-			if be.lastBlockNumber-int64(l.BlockNumber) < params.ForkConfirmNumber {
-				continue
-			}
-			log.Info(fmt.Sprintf("event %s tx=%s happened at %d, confirmed at %d", eventName, l.TxHash.String(), l.BlockNumber, be.lastBlockNumber))
+/*
+WaitForBlock 等待photon service收到块`blockNumber`,不需要轮询GetBlockNumber,
+ctx取消时返回ctx.Err()
+*/
+func (be *Events) WaitForBlock(ctx context.Context, blockNumber int64) error {
+	for {
+		be.newBlockLock.Lock()
+		current, newBlock := be.notifiedBlockNumber, be.newBlock
+		be.newBlockLock.Unlock()
+		if current >= blockNumber {
+			return nil
 		}
-
-		switch eventName {
-		case params.NameTokenNetworkCreated:
-			e, err2 := newEventTokenNetworkCreated(&l)
-			if err = err2; err != nil {
-				return
-			}
-			stateChanges = append(stateChanges, eventTokenNetworkCreated2StateChange(e))
-		case params.NameSecretRevealed:
-			e, err2 := newEventSecretRevealed(&l)
-			if err = err2; err != nil {
-				return
-			}
-			stateChanges = append(stateChanges, eventSecretRevealed2StateChange(e))
-		case params.NameChannelOpenedAndDeposit:
-			e, err2 := newEventChannelOpenAndDeposit(&l)
-			if err = err2; err != nil {
-				return
-			}
-			oev, dev := eventChannelOpenAndDeposit2StateChange(e)
-			stateChanges = append(stateChanges, oev)
-			stateChanges = append(stateChanges, dev)
-		case params.NameChannelNewDeposit:
-			e, err2 := newEventChannelNewDeposit(&l)
-			if err = err2; err != nil {
-				return
-			}
-			stateChanges = append(stateChanges, eventChannelNewDeposit2StateChange(e))
-		case params.NameChannelClosed:
-			e, err2 := newEventChannelClosed(&l)
-			if err = err2; err != nil {
-				return
-			}
-			stateChanges = append(stateChanges, eventChannelClosed2StateChange(e))
-		case params.NameChannelUnlocked:
-			e, err2 := newEventChannelUnlocked(&l)
-			if err = err2; err != nil {
-				return
-			}
-			stateChanges = append(stateChanges, eventChannelUnlocked2StateChange(e))
-		case params.NameBalanceProofUpdated:
-			e, err2 := newEventBalanceProofUpdated(&l)
-			if err = err2; err != nil {
-				return
-			}
-			stateChanges = append(stateChanges, eventBalanceProofUpdated2StateChange(e))
-		case params.NameChannelPunished:
-			e, err2 := newEventChannelPunished(&l)
-			if err = err2; err != nil {
-				return
-			}
-			stateChanges = append(stateChanges, eventChannelPunished2StateChange(e))
-		case params.NameChannelSettled:
-			e, err2 := newEventChannelSettled(&l)
-			if err = err2; err != nil {
-				return
-			}
-			stateChanges = append(stateChanges, eventChannelSettled2StateChange(e))
-		case params.NameChannelCooperativeSettled:
-			e, err2 := newEventChannelCooperativeSettled(&l)
-			if err = err2; err != nil {
-				return
-			}
-			stateChanges = append(stateChanges, eventChannelCooperativeSettled2StateChange(e))
-		case params.NameChannelWithdraw:
-			e, err2 := newEventChannelWithdraw(&l)
-			if err = err2; err != nil {
-				return
-			}
-			stateChanges = append(stateChanges, eventChannelWithdraw2StateChange(e))
-		default:
-			log.Warn(fmt.Sprintf("receive unkonwn type event from chain : \n%s\n", utils.StringInterface(l, 3)))
+		select {
+		case <-newBlock:
+		case <-ctx.Done():
+			return ctx.Err()
 		}
-		// 记录处理流水
-		//be.chainEventRecordDao.NewDeliveredChainEvent(chainEventRecordID, l.BlockNumber)
-		be.txDone[makeEventID(&l)] = l.BlockNumber
-	}
-	return
-}
-
-func needConfirm(eventName string) bool {
-
-	if eventName == params.NameChannelOpenedAndDeposit ||
-		eventName == params.NameChannelNewDeposit ||
-		eventName == params.NameChannelWithdraw {
-		return true
 	}
-	return false
 }
 
-//eventChannelSettled2StateChange to stateChange
-func eventChannelSettled2StateChange(ev *contracts.TokensNetworkChannelSettled) *mediatedtransfer.ContractSettledStateChange {
-	return &mediatedtransfer.ContractSettledStateChange{
-		ChannelIdentifier: common.Hash(ev.ChannelIdentifier),
-		SettledBlock:      int64(ev.Raw.BlockNumber),
-	}
+//EstimatedBlockTime 最近出块间隔的移动平均
+func (be *Events) EstimatedBlockTime() time.Duration {
+	return be.blockTime.BlockTime()
 }
 
-//eventChannelCooperativeSettled2StateChange to stateChange
-func eventChannelCooperativeSettled2StateChange(ev *contracts.TokensNetworkChannelCooperativeSettled) *mediatedtransfer.ContractCooperativeSettledStateChange {
-	return &mediatedtransfer.ContractCooperativeSettledStateChange{
-		ChannelIdentifier: common.Hash(ev.ChannelIdentifier),
-		SettledBlock:      int64(ev.Raw.BlockNumber),
-	}
+//EstimateTimeOfBlock 估计块`blockNumber`出现的时间,比如通道什么时候可以settle,锁什么时候过期
+func (be *Events) EstimateTimeOfBlock(blockNumber int64) time.Time {
+	return be.blockTime.EstimateTime(blockNumber)
 }
 
-//eventChannelPunished2StateChange to stateChange
-func eventChannelPunished2StateChange(ev *contracts.TokensNetworkChannelPunished) *mediatedtransfer.ContractPunishedStateChange {
-	return &mediatedtransfer.ContractPunishedStateChange{
-		ChannelIdentifier: common.Hash(ev.ChannelIdentifier),
-		Beneficiary:       ev.Beneficiary,
-		BlockNumber:       int64(ev.Raw.BlockNumber),
-	}
+/*
+ClockSkew 本机时钟比公链快多少,负数表示慢,diverged表示相差超过了params.ClockSkewThreshold
+*/
+func (be *Events) ClockSkew() (skew time.Duration, diverged bool) {
+	return be.clockSkew.Skew(), be.clockSkew.Diverged()
 }
 
-//eventChannelWithdraw2StateChange to stateChange
-func eventChannelWithdraw2StateChange(ev *contracts.TokensNetworkChannelWithdraw) *mediatedtransfer.ContractChannelWithdrawStateChange {
-	c := &mediatedtransfer.ContractChannelWithdrawStateChange{
-		ChannelIdentifier: &contracts.ChannelUniqueID{
-
-			ChannelIdentifier: common.Hash(ev.ChannelIdentifier),
-			OpenBlockNumber:   int64(ev.Raw.BlockNumber),
-		},
-		Participant1:        ev.Participant1,
-		Participant2:        ev.Participant2,
-		Participant1Balance: ev.Participant1Balance,
-		Participant2Balance: ev.Participant2Balance,
-		BlockNumber:         int64(ev.Raw.BlockNumber),
+//checkClockSkew 偏差超过阈值时,和其他节点给出的时间戳比较都使用修正以后的时间
+func (be *Events) checkClockSkew(h *types.Header) {
+	if h.Time == nil {
+		return
 	}
-	if c.Participant1Balance == nil {
-		c.Participant1Balance = new(big.Int)
+	be.clockSkew.AddBlock(time.Unix(h.Time.Int64(), 0), time.Now())
+	skew, diverged := be.ClockSkew()
+	if diverged && utils.ClockSkew() == 0 {
+		log.Warn(fmt.Sprintf("local clock differs from block timestamps by %s (positive means ahead), please check the system time", skew))
+	} else if !diverged && utils.ClockSkew() != 0 {
+		log.Info(fmt.Sprintf("local clock is in sync with block timestamps again, skew=%s", skew))
 	}
-	if c.Participant2Balance == nil {
-		c.Participant2Balance = new(big.Int)
+	if !diverged {
+		skew = 0
 	}
-	return c
+	utils.SetClockSkew(skew)
 }
 
-//eventTokenNetworkCreated2StateChange to statechange
-func eventTokenNetworkCreated2StateChange(ev *contracts.TokensNetworkTokenNetworkCreated) *mediatedtransfer.ContractTokenAddedStateChange {
-	return &mediatedtransfer.ContractTokenAddedStateChange{
-		TokenAddress: ev.TokenAddress,
-		BlockNumber:  int64(ev.Raw.BlockNumber),
+//sendBlockStateChanges 依次通知(from,to]之间的每一个块
+func (be *Events) sendBlockStateChanges(from, to int64) {
+	for n := from + 1; n <= to; n++ {
+		be.sendStateChange(&transfer.BlockStateChange{BlockNumber: n})
 	}
 }
 
-//注意与合约上计算方式保持完全一致.
-func calcChannelID(token, tokensNetwork, p1, p2 common.Address) common.Hash {
-	var channelID common.Hash
-	//log.Trace(fmt.Sprintf("p1=%s,p2=%s,tokennetwork=%s", p1.String(), p2.String(), tokenNetwork.String()))
-	if bytes.Compare(p1[:], p2[:]) < 0 {
-		channelID = utils.Sha3(p1[:], p2[:], token[:], tokensNetwork[:])
+/*
+detectReorg 检查新块`h`是否与之前处理过的块在同一条链上.
+如果h的父块是已知的,直接比较ParentHash,否则比较上次处理的块`currentBlock`在链上的hash.
+发现分叉以后,向前查找最近的共同祖先,返回nil表示没有分叉.
+*/
+func (be *Events) detectReorg(h *types.Header, currentBlock int64) (reorg *transfer.ChainReorgStateChange) {
+	number := h.Number.Int64()
+	defer func() {
+		be.blockHashes[number] = h.Hash()
+		for n := range be.blockHashes {
+			if n < number-2*params.ForkConfirmNumber {
+				delete(be.blockHashes, n)
+			}
+		}
+	}()
+	if parentHash, ok := be.blockHashes[number-1]; ok {
+		if parentHash == h.ParentHash {
+			return nil
+		}
+	} else if oldHash, ok := be.blockHashes[currentBlock]; ok {
+		newHash, err := be.getBlockHash(currentBlock)
+		if err != nil || newHash == oldHash {
+			return nil
+		}
 	} else {
-		channelID = utils.Sha3(p2[:], p1[:], token[:], tokensNetwork[:])
+		return nil
 	}
-	return channelID
-}
-
-//eventChannelOpenAndDeposit2StateChange to statechange
-func eventChannelOpenAndDeposit2StateChange(ev *contracts.TokensNetworkChannelOpenedAndDeposit) (ch1 *mediatedtransfer.ContractNewChannelStateChange, ch2 *mediatedtransfer.ContractBalanceStateChange) {
-	ch1 = &mediatedtransfer.ContractNewChannelStateChange{
-		ChannelIdentifier: &contracts.ChannelUniqueID{
-			ChannelIdentifier: calcChannelID(ev.Token, ev.Raw.Address, ev.Participant, ev.Partner),
-			OpenBlockNumber:   int64(ev.Raw.BlockNumber),
-		},
-		Participant1:  ev.Participant,
-		Participant2:  ev.Partner,
-		SettleTimeout: int(ev.SettleTimeout),
-		BlockNumber:   int64(ev.Raw.BlockNumber),
-		TokenAddress:  ev.Token,
-	}
-	ch2 = &mediatedtransfer.ContractBalanceStateChange{
-		ChannelIdentifier:  ch1.ChannelIdentifier.ChannelIdentifier,
-		ParticipantAddress: ev.Participant,
-		BlockNumber:        int64(ev.Raw.BlockNumber),
-		Balance:            ev.Participant1Deposit,
-	}
-	return
-}
-
-//eventChannelNewDeposit2StateChange to statechange
-func eventChannelNewDeposit2StateChange(ev *contracts.TokensNetworkChannelNewDeposit) *mediatedtransfer.ContractBalanceStateChange {
-	return &mediatedtransfer.ContractBalanceStateChange{
-		ChannelIdentifier:  ev.ChannelIdentifier,
-		ParticipantAddress: ev.Participant,
-		BlockNumber:        int64(ev.Raw.BlockNumber),
-		Balance:            ev.TotalDeposit,
-	}
-}
-
-//eventChannelClosed2StateChange to statechange
-func eventChannelClosed2StateChange(ev *contracts.TokensNetworkChannelClosed) *mediatedtransfer.ContractClosedStateChange {
-	c := &mediatedtransfer.ContractClosedStateChange{
-		ChannelIdentifier: ev.ChannelIdentifier,
-		ClosingAddress:    ev.ClosingParticipant,
-		LocksRoot:         ev.Locksroot,
-		ClosedBlock:       int64(ev.Raw.BlockNumber),
-		TransferredAmount: ev.TransferredAmount,
-	}
-	if ev.TransferredAmount == nil {
-		c.TransferredAmount = new(big.Int)
-	}
-	return c
-}
-
-//eventBalanceProofUpdated2StateChange to statechange
-func eventBalanceProofUpdated2StateChange(ev *contracts.TokensNetworkBalanceProofUpdated) *mediatedtransfer.ContractBalanceProofUpdatedStateChange {
-	c := &mediatedtransfer.ContractBalanceProofUpdatedStateChange{
-		ChannelIdentifier: ev.ChannelIdentifier,
-		LocksRoot:         ev.Locksroot,
-		TransferAmount:    ev.TransferredAmount,
-		Participant:       ev.Participant,
-		BlockNumber:       int64(ev.Raw.BlockNumber),
-	}
-	if c.TransferAmount == nil {
-		c.TransferAmount = new(big.Int)
-	}
-	return c
-}
-
-//eventChannelUnlocked2StateChange to statechange
-func eventChannelUnlocked2StateChange(ev *contracts.TokensNetworkChannelUnlocked) *mediatedtransfer.ContractUnlockStateChange {
-	c := &mediatedtransfer.ContractUnlockStateChange{
-		ChannelIdentifier: ev.ChannelIdentifier,
-		BlockNumber:       int64(ev.Raw.BlockNumber),
-		TransferAmount:    ev.TransferredAmount,
-		Participant:       ev.PayerParticipant,
-		LockHash:          ev.Lockhash,
-	}
-	if c.TransferAmount == nil {
-		c.TransferAmount = new(big.Int)
+	// 向前查找共同祖先,只能找到记录过的块,更早的块认为没有被替换
+	forkBlockNumber := number
+	for n := number - 1; n >= 0; n-- {
+		oldHash, ok := be.blockHashes[n]
+		if !ok {
+			break
+		}
+		newHash, err := be.getBlockHash(n)
+		if err != nil {
+			log.Error(fmt.Sprintf("get hash of block %d err %s", n, err))
+			break
+		}
+		if newHash == oldHash {
+			break
+		}
+		forkBlockNumber = n
+		delete(be.blockHashes, n)
+		reorg = &transfer.ChainReorgStateChange{
+			BlockNumber:     number,
+			ForkBlockNumber: forkBlockNumber,
+			OldHash:         oldHash,
+			NewHash:         newHash,
+		}
 	}
-	return c
+	return reorg
 }
 
-//eventSecretRevealed2StateChange to statechange
-func eventSecretRevealed2StateChange(ev *contracts.SecretRegistrySecretRevealed) *mediatedtransfer.ContractSecretRevealOnChainStateChange {
-	return &mediatedtransfer.ContractSecretRevealOnChainStateChange{
-		Secret:         ev.Secret,
-		BlockNumber:    int64(ev.Raw.BlockNumber),
-		LockSecretHash: utils.ShaSecret(ev.Secret[:]),
+func (be *Events) getBlockHash(number int64) (hash common.Hash, err error) {
+	ctx, cancelFunc := context.WithTimeout(context.Background(), params.EthRPCTimeout)
+	defer cancelFunc()
+	h, err := be.client.HeaderByNumber(ctx, big.NewInt(number))
+	if err != nil {
+		return
 	}
+	return h.Hash(), nil
 }
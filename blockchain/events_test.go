@@ -1,6 +1,7 @@
 package blockchain
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -16,7 +17,9 @@ import (
 
 	"github.com/SmartMeshFoundation/Photon/codefortest"
 	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/network/helper"
 	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/transfer"
 	"github.com/SmartMeshFoundation/Photon/utils"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -134,10 +137,203 @@ func TestEvents_Start2(t *testing.T) {
 		t.Error("NewBlockChainEvents failed")
 	}
 	params.ChainID = big.NewInt(8888)
-	chs, err := be.queryAllStateChange(13362234, 13362238)
+	chs, err := be.logs.Poll(13362234, 13362238, 13362238)
 	if err != nil {
 		t.Error(err)
 		return
 	}
 	t.Logf("chs=%s", utils.StringInterface(chs, 5))
 }
+
+func TestEvents_DetectReorgWithoutFork(t *testing.T) {
+	be := NewBlockChainEvents(nil, &fakeRPCModule{}, &fakeChainEventRecordDao{})
+	h1 := &types.Header{Number: big.NewInt(10)}
+	if be.detectReorg(h1, 9) != nil {
+		t.Error("should not detect reorg without history")
+	}
+	h2 := &types.Header{Number: big.NewInt(11), ParentHash: h1.Hash()}
+	if be.detectReorg(h2, 10) != nil {
+		t.Error("should not detect reorg when parent hash matches")
+	}
+	if be.blockHashes[11] != h2.Hash() || be.blockHashes[10] != h1.Hash() {
+		t.Error("block hashes should be recorded")
+	}
+	h3 := &types.Header{Number: big.NewInt(11 + 3*params.ForkConfirmNumber), ParentHash: h2.Hash()}
+	be.detectReorg(h3, h3.Number.Int64()-1)
+	if _, ok := be.blockHashes[10]; ok {
+		t.Error("old block hashes should be removed")
+	}
+}
+
+func TestLogPoller_Dedup(t *testing.T) {
+	p := NewLogPoller(nil, &fakeRPCModule{})
+	logs := []types.Log{
+		{TxHash: utils.NewRandomHash(), BlockNumber: 10, Topics: []common.Hash{utils.NewRandomHash()}},
+		{TxHash: utils.NewRandomHash(), BlockNumber: 12, Topics: []common.Hash{utils.NewRandomHash()}},
+	}
+	_, err := p.parseLogsToEvents(logs, 12)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(p.txDone) != 2 {
+		t.Error("processed logs should be recorded")
+	}
+	//分叉以后,分叉点之后的事件需要重新处理
+	p.Forget(11)
+	if len(p.txDone) != 1 {
+		t.Error("logs after fork should be forgotten")
+	}
+	p.Prune(10)
+	if len(p.txDone) != 0 {
+		t.Error("old logs should be pruned")
+	}
+}
+
+func TestLogPoller_ForkConfirm(t *testing.T) {
+	p := NewLogPoller(nil, &fakeRPCModule{})
+	p.SetConfirmBlocks(3 * params.ForkConfirmNumber)
+	if p.confirmBlocks != MaxConfirmBlocks() {
+		t.Error("confirm blocks should not exceed the rescan window")
+	}
+	p.SetConfirmBlocks(3)
+	var depositTopic common.Hash
+	for topic, name := range topicToEventName {
+		if name == params.NameChannelNewDeposit {
+			depositTopic = topic
+		}
+	}
+	params.EnableForkConfirm = true
+	defer func() { params.EnableForkConfirm = false }()
+	logs := []types.Log{
+		{TxHash: utils.NewRandomHash(), BlockNumber: 11, Topics: []common.Hash{depositTopic}},
+		{TxHash: utils.NewRandomHash(), BlockNumber: 10, Topics: []common.Hash{depositTopic}},
+	}
+	chs, err := p.parseLogsToEvents(logs, 12)
+	if err != nil || len(chs) != 0 {
+		t.Error("unconfirmed events should be skipped")
+	}
+	if len(p.txDone) != 0 {
+		t.Error("unconfirmed events should be queried again")
+	}
+	if p.OldestUnconfirmed() != 10 {
+		t.Errorf("oldest unconfirmed should be 10,got %d", p.OldestUnconfirmed())
+	}
+	be := NewBlockChainEvents(nil, &fakeRPCModule{}, &fakeChainEventRecordDao{})
+	be.oldestUnconfirmed = p.OldestUnconfirmed()
+	if be.CheckpointBlockNumber(12) != 10 || be.CheckpointBlockNumber(9) != 9 {
+		t.Error("checkpoint should not pass the oldest unconfirmed event")
+	}
+}
+
+func TestEvents_SendBlockStateChanges(t *testing.T) {
+	be := NewBlockChainEvents(nil, &fakeRPCModule{}, &fakeChainEventRecordDao{})
+	go be.sendBlockStateChanges(10, 14)
+	for n := int64(11); n <= 14; n++ {
+		st := (<-be.StateChangeChannel).(*transfer.BlockStateChange)
+		if st.BlockNumber != n {
+			t.Errorf("expect block %d,got %d", n, st.BlockNumber)
+		}
+	}
+}
+
+type fixedBlockNumberSource struct {
+	number int64
+}
+
+func (s *fixedBlockNumberSource) LatestConfirmedBlock(ctx context.Context) (*types.Header, error) {
+	return &types.Header{Number: big.NewInt(s.number)}, nil
+}
+
+func TestEvents_StopAndRestart(t *testing.T) {
+	subscribe := params.EthRPCSubscribeNewHead
+	params.EthRPCSubscribeNewHead = false
+	defer func() {
+		params.EthRPCSubscribeNewHead = subscribe
+	}()
+	be := NewBlockChainEvents(&helper.SafeEthClient{}, &fakeRPCModule{}, &fakeChainEventRecordDao{})
+	be.SetBlockNumberSource(&fixedBlockNumberSource{number: 10})
+	for i := 0; i < 2; i++ {
+		be.Start(10)
+		st, ok := (<-be.StateChangeChannel).(*transfer.BlockStateChange)
+		if !ok || st.BlockNumber != 10 {
+			t.Errorf("expect BlockStateChange 10,got %s", utils.StringInterface(st, 2))
+		}
+		//AlarmTask正在等待新块或者阻塞在发送上,Stop都必须立即返回
+		stopped := make(chan struct{})
+		go func() {
+			be.Stop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(time.Second):
+			t.Fatal("Stop should terminate AlarmTask")
+		}
+	}
+	be.Stop()
+}
+
+func TestEvents_WaitForBlock(t *testing.T) {
+	be := NewBlockChainEvents(nil, &fakeRPCModule{}, &fakeChainEventRecordDao{})
+	go func() {
+		for n := int64(1); n <= 5; n++ {
+			time.Sleep(10 * time.Millisecond)
+			be.notifyNewBlock(n)
+		}
+	}()
+	err := be.WaitForBlock(context.Background(), 3)
+	if err != nil {
+		t.Error(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = be.WaitForBlock(ctx, 10)
+	if err != context.DeadlineExceeded {
+		t.Errorf("expect timeout,got %v", err)
+	}
+}
+
+func TestBlockTimeEstimator(t *testing.T) {
+	e := NewBlockTimeEstimator(15 * time.Second)
+	if e.BlockTime() != 15*time.Second {
+		t.Error("should use default block time without samples")
+	}
+	now := time.Now()
+	e.AddBlock(10, now)
+	//漏掉的块也计算在内
+	e.AddBlock(12, now.Add(10*time.Second))
+	e.AddBlock(13, now.Add(15*time.Second))
+	if e.BlockTime() != 5*time.Second {
+		t.Errorf("expect 5s,got %s", e.BlockTime())
+	}
+	if !e.EstimateTime(15).Equal(now.Add(25 * time.Second)) {
+		t.Errorf("wrong estimate time %s", e.EstimateTime(15))
+	}
+	if !e.EstimateTime(11).Equal(now.Add(15 * time.Second)) {
+		t.Error("past block should return time of latest block")
+	}
+	e.AddBlock(5, now.Add(20*time.Second))
+	if e.BlockTime() != 15*time.Second {
+		t.Error("samples should be reset after block number goes back")
+	}
+}
+
+func TestClockSkewDetector(t *testing.T) {
+	d := NewClockSkewDetector()
+	if d.Skew() != 0 || d.Diverged() {
+		t.Error("should have no skew without samples")
+	}
+	now := time.Now()
+	//块被发现的时间晚于时间戳,取相差最小的
+	d.AddBlock(now, now.Add(8*time.Second))
+	d.AddBlock(now.Add(15*time.Second), now.Add(17*time.Second))
+	if d.Skew() != 2*time.Second || d.Diverged() {
+		t.Errorf("expect 2s,got %s", d.Skew())
+	}
+	//本机时钟慢了一个小时
+	d = NewClockSkewDetector()
+	d.AddBlock(now, now.Add(-time.Hour))
+	if d.Skew() != -time.Hour || !d.Diverged() {
+		t.Errorf("expect -1h,got %s", d.Skew())
+	}
+}
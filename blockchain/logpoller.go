@@ -0,0 +1,405 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/network/helper"
+	"github.com/SmartMeshFoundation/Photon/network/rpc"
+	"github.com/SmartMeshFoundation/Photon/network/rpc/contracts"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+type eventID [25]byte //txHash+logIndex
+//假定一个tx中事件不可能超过256
+func makeEventID(l *types.Log) eventID {
+	var e eventID
+	copy(e[:], l.TxHash[:])
+	e[24] = byte(l.Index)
+	return e
+}
+
+/*
+LogPoller 按块区间查询TokensNetwork和SecretRegistry合约的日志,转换成mediatedtransfer中的ContractXxxStateChange.
+只依赖FilterLogs轮询,不依赖日志订阅,所以重启或者切换公链节点以后不会丢事件:
+Events.Start的参数是photon service保存的最新块(checkpoint),只有该块以及之前的事件都处理完以后才会保存,
+重启以后从checkpoint之前2*ForkConfirmNumber块开始重新扫描,已经处理过的事件根据txHash+logIndex去重.
+EnableForkConfirm时还没有足够确认块的事件不记录流水,下次轮询时重新查询,所以确认块数不能超过重新扫描的范围.
+*/
+type LogPoller struct {
+	client              *helper.SafeEthClient
+	rpcModuleDependency RPCModuleDependency
+	txDone              map[eventID]uint64 // 该map记录最近30块内处理的events流水,用于事件去重
+	confirmBlocks       int64              // EnableForkConfirm时事件需要的确认块数
+	oldestUnconfirmed   int64              // 最近一次轮询中还没有确认的最早的事件所在的块,0表示没有
+}
+
+//NewLogPoller create LogPoller
+func NewLogPoller(client *helper.SafeEthClient, rpcModuleDependency RPCModuleDependency) *LogPoller {
+	return &LogPoller{
+		client:              client,
+		rpcModuleDependency: rpcModuleDependency,
+		txDone:              make(map[eventID]uint64),
+		confirmBlocks:       params.ForkConfirmNumber,
+	}
+}
+
+//MaxConfirmBlocks 确认块数的上限,也就是每次轮询和重启以后重新扫描的范围,超过这个范围的未确认事件再也查询不到
+func MaxConfirmBlocks() int64 {
+	return 2 * params.ForkConfirmNumber
+}
+
+//SetConfirmBlocks EnableForkConfirm时事件经过`n`个块确认以后才处理,超过MaxConfirmBlocks时使用MaxConfirmBlocks
+func (p *LogPoller) SetConfirmBlocks(n int64) {
+	if n > MaxConfirmBlocks() {
+		log.Warn(fmt.Sprintf("fork confirm blocks %d is larger than %d, use %d", n, MaxConfirmBlocks(), MaxConfirmBlocks()))
+		n = MaxConfirmBlocks()
+	}
+	if n < 0 {
+		n = 0
+	}
+	p.confirmBlocks = n
+}
+
+//OldestUnconfirmed 最近一次轮询中还没有确认的最早的事件所在的块,0表示没有
+func (p *LogPoller) OldestUnconfirmed() int64 {
+	return p.oldestUnconfirmed
+}
+
+/*
+Poll 查询[fromBlock,toBlock]之间的合约事件,按照块号和事件顺序排序.
+confirmedBlock用于EnableForkConfirm时判断事件是否已经有足够的确认块
+*/
+func (p *LogPoller) Poll(fromBlock, toBlock, confirmedBlock int64) (stateChanges []mediatedtransfer.ContractStateChange, err error) {
+	/*
+		get all event of contract TokenNetworkRegistry, SecretRegistry , TokenNetwork
+	*/
+	logs, err := p.getLogsFromChain(fromBlock, toBlock)
+	if err != nil {
+		return
+	}
+	stateChanges, err = p.parseLogsToEvents(logs, confirmedBlock)
+	if err != nil {
+		return
+	}
+	// 排序
+	sortContractStateChange(stateChanges)
+	return
+}
+
+//Forget 发生分叉时,fromBlock及之后的块中的事件需要重新处理
+func (p *LogPoller) Forget(fromBlock int64) {
+	for key, blockNumber := range p.txDone {
+		if int64(blockNumber) >= fromBlock {
+			delete(p.txDone, key)
+		}
+	}
+}
+
+//Prune 清除过期流水,beforeBlock及之前的块不会再被查询
+func (p *LogPoller) Prune(beforeBlock int64) {
+	for key, blockNumber := range p.txDone {
+		if blockNumber <= uint64(beforeBlock) {
+			delete(p.txDone, key)
+		}
+	}
+}
+
+func (p *LogPoller) getLogsFromChain(fromBlock int64, toBlock int64) (logs []types.Log, err error) {
+	/*
+		get all event of contract TokenNetworkRegistry, SecretRegistry , TokenNetwork
+	*/
+	contractAddresses := []common.Address{
+		p.rpcModuleDependency.GetRegistryAddress(),
+		p.rpcModuleDependency.GetSecretRegistryAddress(),
+	}
+	logs, err = rpc.EventsGetInternal(
+		rpc.GetQueryConext(), contractAddresses, fromBlock, toBlock, p.client)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (p *LogPoller) parseLogsToEvents(logs []types.Log, confirmedBlock int64) (stateChanges []mediatedtransfer.ContractStateChange, err error) {
+	p.oldestUnconfirmed = 0
+	for _, l := range logs {
+		eventName := topicToEventName[l.Topics[0]]
+		// 根据已处理流水去重
+		if doneBlockNumber, ok := p.txDone[makeEventID(&l)]; ok {
+			if doneBlockNumber == l.BlockNumber {
+				//log.Trace(fmt.Sprintf("get event txhash=%s repeated,ignore...", l.TxHash.String()))
+				continue
+			}
+			log.Warn(fmt.Sprintf("event tx=%s happened at %d, but now happend at %d ", l.TxHash.String(), doneBlockNumber, l.BlockNumber))
+		}
+		//chainEventRecordID := be.chainEventRecordDao.MakeChainEventID(&l)
+		//// 根据已处理流水去重
+		//if doneBlockNumber, delivered := be.chainEventRecordDao.CheckChainEventDelivered(chainEventRecordID); delivered {
+		//	if doneBlockNumber == l.BlockNumber {
+		//		//log.Trace(fmt.Sprintf("get event txhash=%s repeated,ignore...", l.TxHash.String()))
+		//		continue
+		//	}
+		//	log.Warn(fmt.Sprintf("event tx=%s happened at %d, but now happend at %d ", l.TxHash.String(), doneBlockNumber, l.BlockNumber))
+		//}
+
+		// open,deposit,withdraw事件延迟确认,开关默认关闭,方便测试
+		// registry secret事件延迟确认,否则在出现恶意分叉的情况下,中间节点有损失资金的风险
+		if params.EnableForkConfirm && (needConfirm(eventName) || eventName == params.NameSecretRevealed) {
+			if confirmedBlock-int64(l.BlockNumber) < p.confirmBlocks {
+				if p.oldestUnconfirmed == 0 || int64(l.BlockNumber) < p.oldestUnconfirmed {
+					p.oldestUnconfirmed = int64(l.BlockNumber)
+				}
+				continue
+			}
+			log.Info(fmt.Sprintf("event %s tx=%s happened at %d, confirmed at %d", eventName, l.TxHash.String(), l.BlockNumber, confirmedBlock))
+		}
+
+		switch eventName {
+		case params.NameTokenNetworkCreated:
+			e, err2 := newEventTokenNetworkCreated(&l)
+			if err = err2; err != nil {
+				return
+			}
+			stateChanges = append(stateChanges, eventTokenNetworkCreated2StateChange(e))
+		case params.NameSecretRevealed:
+			e, err2 := newEventSecretRevealed(&l)
+			if err = err2; err != nil {
+				return
+			}
+			stateChanges = append(stateChanges, eventSecretRevealed2StateChange(e))
+		case params.NameChannelOpenedAndDeposit:
+			e, err2 := newEventChannelOpenAndDeposit(&l)
+			if err = err2; err != nil {
+				return
+			}
+			oev, dev := eventChannelOpenAndDeposit2StateChange(e)
+			stateChanges = append(stateChanges, oev)
+			stateChanges = append(stateChanges, dev)
+		case params.NameChannelNewDeposit:
+			e, err2 := newEventChannelNewDeposit(&l)
+			if err = err2; err != nil {
+				return
+			}
+			stateChanges = append(stateChanges, eventChannelNewDeposit2StateChange(e))
+		case params.NameChannelClosed:
+			e, err2 := newEventChannelClosed(&l)
+			if err = err2; err != nil {
+				return
+			}
+			stateChanges = append(stateChanges, eventChannelClosed2StateChange(e))
+		case params.NameChannelUnlocked:
+			e, err2 := newEventChannelUnlocked(&l)
+			if err = err2; err != nil {
+				return
+			}
+			stateChanges = append(stateChanges, eventChannelUnlocked2StateChange(e))
+		case params.NameBalanceProofUpdated:
+			e, err2 := newEventBalanceProofUpdated(&l)
+			if err = err2; err != nil {
+				return
+			}
+			stateChanges = append(stateChanges, eventBalanceProofUpdated2StateChange(e))
+		case params.NameChannelPunished:
+			e, err2 := newEventChannelPunished(&l)
+			if err = err2; err != nil {
+				return
+			}
+			stateChanges = append(stateChanges, eventChannelPunished2StateChange(e))
+		case params.NameChannelSettled:
+			e, err2 := newEventChannelSettled(&l)
+			if err = err2; err != nil {
+				return
+			}
+			stateChanges = append(stateChanges, eventChannelSettled2StateChange(e))
+		case params.NameChannelCooperativeSettled:
+			e, err2 := newEventChannelCooperativeSettled(&l)
+			if err = err2; err != nil {
+				return
+			}
+			stateChanges = append(stateChanges, eventChannelCooperativeSettled2StateChange(e))
+		case params.NameChannelWithdraw:
+			e, err2 := newEventChannelWithdraw(&l)
+			if err = err2; err != nil {
+				return
+			}
+			stateChanges = append(stateChanges, eventChannelWithdraw2StateChange(e))
+		default:
+			log.Warn(fmt.Sprintf("receive unkonwn type event from chain : \n%s\n", utils.StringInterface(l, 3)))
+		}
+		// 记录处理流水
+		//be.chainEventRecordDao.NewDeliveredChainEvent(chainEventRecordID, l.BlockNumber)
+		p.txDone[makeEventID(&l)] = l.BlockNumber
+	}
+	return
+}
+
+func needConfirm(eventName string) bool {
+
+	if eventName == params.NameChannelOpenedAndDeposit ||
+		eventName == params.NameChannelNewDeposit ||
+		eventName == params.NameChannelWithdraw {
+		return true
+	}
+	return false
+}
+
+//eventChannelSettled2StateChange to stateChange
+func eventChannelSettled2StateChange(ev *contracts.TokensNetworkChannelSettled) *mediatedtransfer.ContractSettledStateChange {
+	return &mediatedtransfer.ContractSettledStateChange{
+		ChannelIdentifier: common.Hash(ev.ChannelIdentifier),
+		SettledBlock:      int64(ev.Raw.BlockNumber),
+	}
+}
+
+//eventChannelCooperativeSettled2StateChange to stateChange
+func eventChannelCooperativeSettled2StateChange(ev *contracts.TokensNetworkChannelCooperativeSettled) *mediatedtransfer.ContractCooperativeSettledStateChange {
+	return &mediatedtransfer.ContractCooperativeSettledStateChange{
+		ChannelIdentifier: common.Hash(ev.ChannelIdentifier),
+		SettledBlock:      int64(ev.Raw.BlockNumber),
+	}
+}
+
+//eventChannelPunished2StateChange to stateChange
+func eventChannelPunished2StateChange(ev *contracts.TokensNetworkChannelPunished) *mediatedtransfer.ContractPunishedStateChange {
+	return &mediatedtransfer.ContractPunishedStateChange{
+		ChannelIdentifier: common.Hash(ev.ChannelIdentifier),
+		Beneficiary:       ev.Beneficiary,
+		BlockNumber:       int64(ev.Raw.BlockNumber),
+	}
+}
+
+//eventChannelWithdraw2StateChange to stateChange
+func eventChannelWithdraw2StateChange(ev *contracts.TokensNetworkChannelWithdraw) *mediatedtransfer.ContractChannelWithdrawStateChange {
+	c := &mediatedtransfer.ContractChannelWithdrawStateChange{
+		ChannelIdentifier: &contracts.ChannelUniqueID{
+
+			ChannelIdentifier: common.Hash(ev.ChannelIdentifier),
+			OpenBlockNumber:   int64(ev.Raw.BlockNumber),
+		},
+		Participant1:        ev.Participant1,
+		Participant2:        ev.Participant2,
+		Participant1Balance: ev.Participant1Balance,
+		Participant2Balance: ev.Participant2Balance,
+		BlockNumber:         int64(ev.Raw.BlockNumber),
+	}
+	if c.Participant1Balance == nil {
+		c.Participant1Balance = new(big.Int)
+	}
+	if c.Participant2Balance == nil {
+		c.Participant2Balance = new(big.Int)
+	}
+	return c
+}
+
+//eventTokenNetworkCreated2StateChange to statechange
+func eventTokenNetworkCreated2StateChange(ev *contracts.TokensNetworkTokenNetworkCreated) *mediatedtransfer.ContractTokenAddedStateChange {
+	return &mediatedtransfer.ContractTokenAddedStateChange{
+		TokenAddress: ev.TokenAddress,
+		BlockNumber:  int64(ev.Raw.BlockNumber),
+	}
+}
+
+//注意与合约上计算方式保持完全一致.
+func calcChannelID(token, tokensNetwork, p1, p2 common.Address) common.Hash {
+	var channelID common.Hash
+	//log.Trace(fmt.Sprintf("p1=%s,p2=%s,tokennetwork=%s", p1.String(), p2.String(), tokenNetwork.String()))
+	if bytes.Compare(p1[:], p2[:]) < 0 {
+		channelID = utils.Sha3(p1[:], p2[:], token[:], tokensNetwork[:])
+	} else {
+		channelID = utils.Sha3(p2[:], p1[:], token[:], tokensNetwork[:])
+	}
+	return channelID
+}
+
+//eventChannelOpenAndDeposit2StateChange to statechange
+func eventChannelOpenAndDeposit2StateChange(ev *contracts.TokensNetworkChannelOpenedAndDeposit) (ch1 *mediatedtransfer.ContractNewChannelStateChange, ch2 *mediatedtransfer.ContractBalanceStateChange) {
+	ch1 = &mediatedtransfer.ContractNewChannelStateChange{
+		ChannelIdentifier: &contracts.ChannelUniqueID{
+			ChannelIdentifier: calcChannelID(ev.Token, ev.Raw.Address, ev.Participant, ev.Partner),
+			OpenBlockNumber:   int64(ev.Raw.BlockNumber),
+		},
+		Participant1:  ev.Participant,
+		Participant2:  ev.Partner,
+		SettleTimeout: int(ev.SettleTimeout),
+		BlockNumber:   int64(ev.Raw.BlockNumber),
+		TokenAddress:  ev.Token,
+	}
+	ch2 = &mediatedtransfer.ContractBalanceStateChange{
+		ChannelIdentifier:  ch1.ChannelIdentifier.ChannelIdentifier,
+		ParticipantAddress: ev.Participant,
+		BlockNumber:        int64(ev.Raw.BlockNumber),
+		Balance:            ev.Participant1Deposit,
+	}
+	return
+}
+
+//eventChannelNewDeposit2StateChange to statechange
+func eventChannelNewDeposit2StateChange(ev *contracts.TokensNetworkChannelNewDeposit) *mediatedtransfer.ContractBalanceStateChange {
+	return &mediatedtransfer.ContractBalanceStateChange{
+		ChannelIdentifier:  ev.ChannelIdentifier,
+		ParticipantAddress: ev.Participant,
+		BlockNumber:        int64(ev.Raw.BlockNumber),
+		Balance:            ev.TotalDeposit,
+	}
+}
+
+//eventChannelClosed2StateChange to statechange
+func eventChannelClosed2StateChange(ev *contracts.TokensNetworkChannelClosed) *mediatedtransfer.ContractClosedStateChange {
+	c := &mediatedtransfer.ContractClosedStateChange{
+		ChannelIdentifier: ev.ChannelIdentifier,
+		ClosingAddress:    ev.ClosingParticipant,
+		LocksRoot:         ev.Locksroot,
+		ClosedBlock:       int64(ev.Raw.BlockNumber),
+		TransferredAmount: ev.TransferredAmount,
+	}
+	if ev.TransferredAmount == nil {
+		c.TransferredAmount = new(big.Int)
+	}
+	return c
+}
+
+//eventBalanceProofUpdated2StateChange to statechange
+func eventBalanceProofUpdated2StateChange(ev *contracts.TokensNetworkBalanceProofUpdated) *mediatedtransfer.ContractBalanceProofUpdatedStateChange {
+	c := &mediatedtransfer.ContractBalanceProofUpdatedStateChange{
+		ChannelIdentifier: ev.ChannelIdentifier,
+		LocksRoot:         ev.Locksroot,
+		TransferAmount:    ev.TransferredAmount,
+		Participant:       ev.Participant,
+		BlockNumber:       int64(ev.Raw.BlockNumber),
+	}
+	if c.TransferAmount == nil {
+		c.TransferAmount = new(big.Int)
+	}
+	return c
+}
+
+//eventChannelUnlocked2StateChange to statechange
+func eventChannelUnlocked2StateChange(ev *contracts.TokensNetworkChannelUnlocked) *mediatedtransfer.ContractUnlockStateChange {
+	c := &mediatedtransfer.ContractUnlockStateChange{
+		ChannelIdentifier: ev.ChannelIdentifier,
+		BlockNumber:       int64(ev.Raw.BlockNumber),
+		TransferAmount:    ev.TransferredAmount,
+		Participant:       ev.PayerParticipant,
+		LockHash:          ev.Lockhash,
+	}
+	if c.TransferAmount == nil {
+		c.TransferAmount = new(big.Int)
+	}
+	return c
+}
+
+//eventSecretRevealed2StateChange to statechange
+func eventSecretRevealed2StateChange(ev *contracts.SecretRegistrySecretRevealed) *mediatedtransfer.ContractSecretRevealOnChainStateChange {
+	return &mediatedtransfer.ContractSecretRevealOnChainStateChange{
+		Secret:         ev.Secret,
+		BlockNumber:    int64(ev.Raw.BlockNumber),
+		LockSecretHash: utils.ShaSecret(ev.Secret[:]),
+	}
+}
@@ -0,0 +1,199 @@
+package blockchain
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/network/helper"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	//PendingTxClose 关闭通道的交易
+	PendingTxClose = "close"
+	//PendingTxSettle settle通道的交易
+	PendingTxSettle = "settle"
+)
+
+/*
+PendingChannelTx 交易池中还没有打包的,涉及自己通道的交易
+*/
+type PendingChannelTx struct {
+	TxHash            common.Hash
+	Method            string //PendingTxClose或者PendingTxSettle
+	TokenAddress      common.Address
+	ChannelIdentifier common.Hash
+	Sender            common.Address //发起交易的账户,对于close就是关闭通道的一方
+	Partner           common.Address //通道中除了自己以外的另一方
+}
+
+/*
+MempoolWatcher 订阅公链节点交易池中的新交易,找出对方关闭或者settle自己通道的交易.
+只是提前预警,通道状态仍然以打包以后的合约事件为准
+*/
+type MempoolWatcher struct {
+	PendingTxChan chan *PendingChannelTx
+	client        *helper.SafeEthClient
+	tokensNetwork common.Address
+	myAddress     common.Address
+	lock          sync.Mutex
+	cancel        context.CancelFunc
+	stopped       chan struct{}
+}
+
+//NewMempoolWatcher create MempoolWatcher
+func NewMempoolWatcher(client *helper.SafeEthClient, tokensNetwork, myAddress common.Address) *MempoolWatcher {
+	return &MempoolWatcher{
+		PendingTxChan: make(chan *PendingChannelTx, 10),
+		client:        client,
+		tokensNetwork: tokensNetwork,
+		myAddress:     myAddress,
+	}
+}
+
+/*
+Start 开始订阅,公链节点不支持时只记录日志,不影响photon的其他功能.
+重连以后需要再次调用Start
+*/
+func (w *MempoolWatcher) Start() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.stopLocked()
+	ctx, cancel := context.WithCancel(context.Background())
+	hashes := make(chan common.Hash, 100)
+	subCtx, subCancel := context.WithTimeout(ctx, params.EthRPCTimeout)
+	sub, err := w.client.SubscribePendingTransactions(subCtx, hashes)
+	subCancel()
+	if err != nil {
+		cancel()
+		log.Warn(fmt.Sprintf("eth rpc server %s does not support pending transaction subscription, mempool watching is disabled : %s", w.client.URL(), err))
+		return
+	}
+	log.Info(fmt.Sprintf("watch mempool of %s", w.client.URL()))
+	w.cancel = cancel
+	w.stopped = make(chan struct{})
+	go func(stopped chan struct{}) {
+		defer close(stopped)
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case h := <-hashes:
+				w.checkTx(ctx, h)
+			case err := <-sub.Err():
+				log.Warn(fmt.Sprintf("pending transaction subscription err %v, mempool watching stopped", err))
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}(w.stopped)
+}
+
+//Stop 停止订阅,返回时goroutine已经退出
+func (w *MempoolWatcher) Stop() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.stopLocked()
+}
+
+func (w *MempoolWatcher) stopLocked() {
+	if w.cancel == nil {
+		return
+	}
+	w.cancel()
+	<-w.stopped
+	w.cancel = nil
+	w.stopped = nil
+}
+
+func (w *MempoolWatcher) checkTx(ctx context.Context, h common.Hash) {
+	ctx2, cancel := context.WithTimeout(ctx, params.EthRPCTimeout)
+	tx, isPending, err := w.client.TransactionByHash(ctx2, h)
+	cancel()
+	if err != nil || !isPending {
+		//交易池中的交易随时可能被打包或者丢弃,查不到是正常的
+		return
+	}
+	ptx, err := parsePendingChannelTx(tx, w.tokensNetwork, w.myAddress)
+	if err != nil {
+		log.Trace(fmt.Sprintf("parse pending tx %s err %s", h.String(), err))
+		return
+	}
+	if ptx == nil {
+		return
+	}
+	log.Info(fmt.Sprintf("pending %s tx %s on channel %s from %s", ptx.Method, ptx.TxHash.String(),
+		utils.HPex(ptx.ChannelIdentifier), utils.APex2(ptx.Sender)))
+	select {
+	case w.PendingTxChan <- ptx:
+	case <-time.After(params.EthRPCTimeout):
+		log.Error(fmt.Sprintf("PendingTxChan is full, drop pending tx %s", ptx.TxHash.String()))
+	case <-ctx.Done():
+	}
+}
+
+func txSender(tx *types.Transaction) (common.Address, error) {
+	if tx.Protected() {
+		return types.Sender(types.NewEIP155Signer(tx.ChainId()), tx)
+	}
+	return types.Sender(types.HomesteadSigner{}, tx)
+}
+
+/*
+parsePendingChannelTx 解析调用TokensNetwork合约的交易,只关心其他账户发起的涉及自己通道的prepareSettle和settle,
+其他交易返回nil
+*/
+func parsePendingChannelTx(tx *types.Transaction, tokensNetwork, myAddress common.Address) (ptx *PendingChannelTx, err error) {
+	if tx.To() == nil || *tx.To() != tokensNetwork || len(tx.Data()) < 4 {
+		return
+	}
+	method, err := tokenNetworkAbi.MethodById(tx.Data()[:4])
+	if err != nil {
+		return
+	}
+	if method.Name != "prepareSettle" && method.Name != "settle" {
+		return
+	}
+	sender, err := txSender(tx)
+	if err != nil {
+		return
+	}
+	if sender == myAddress {
+		return
+	}
+	args, err := method.Inputs.UnpackValues(tx.Data()[4:])
+	if err != nil {
+		return
+	}
+	ptx = &PendingChannelTx{
+		TxHash:       tx.Hash(),
+		Sender:       sender,
+		TokenAddress: args[0].(common.Address),
+	}
+	if method.Name == "prepareSettle" {
+		ptx.Method = PendingTxClose
+		if args[1].(common.Address) != myAddress {
+			return nil, nil
+		}
+		ptx.Partner = sender
+	} else {
+		ptx.Method = PendingTxSettle
+		p1, p2 := args[1].(common.Address), args[4].(common.Address)
+		switch myAddress {
+		case p1:
+			ptx.Partner = p2
+		case p2:
+			ptx.Partner = p1
+		default:
+			return nil, nil
+		}
+	}
+	ptx.ChannelIdentifier = utils.CalcChannelID(ptx.TokenAddress, tokensNetwork, myAddress, ptx.Partner)
+	return
+}
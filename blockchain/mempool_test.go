@@ -0,0 +1,51 @@
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePendingChannelTx(t *testing.T) {
+	partnerKey, _ := crypto.GenerateKey()
+	partner := crypto.PubkeyToAddress(partnerKey.PublicKey)
+	me, token, tokensNetwork := utils.NewRandomAddress(), utils.NewRandomAddress(), utils.NewRandomAddress()
+	newTx := func(to common.Address, method string, args ...interface{}) *types.Transaction {
+		data, err := tokenNetworkAbi.Pack(method, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx := types.NewTransaction(0, to, big.NewInt(0), 100000, big.NewInt(1), data)
+		tx, err = types.SignTx(tx, types.HomesteadSigner{}, partnerKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	channelID := utils.CalcChannelID(token, tokensNetwork, me, partner)
+
+	tx := newTx(tokensNetwork, "prepareSettle", token, me, big.NewInt(10), utils.EmptyHash, uint64(3), utils.EmptyHash, []byte{1})
+	ptx, err := parsePendingChannelTx(tx, tokensNetwork, me)
+	assert.Nil(t, err)
+	assert.EqualValues(t, PendingTxClose, ptx.Method)
+	assert.EqualValues(t, partner, ptx.Sender)
+	assert.EqualValues(t, token, ptx.TokenAddress)
+	assert.EqualValues(t, channelID, ptx.ChannelIdentifier)
+
+	//别人的通道和其他合约的交易
+	ptx, err = parsePendingChannelTx(tx, tokensNetwork, utils.NewRandomAddress())
+	assert.Nil(t, ptx)
+	ptx, err = parsePendingChannelTx(tx, utils.NewRandomAddress(), me)
+	assert.Nil(t, ptx)
+
+	tx = newTx(tokensNetwork, "settle", token, partner, big.NewInt(10), utils.EmptyHash, me, big.NewInt(0), utils.EmptyHash)
+	ptx, err = parsePendingChannelTx(tx, tokensNetwork, me)
+	assert.Nil(t, err)
+	assert.EqualValues(t, PendingTxSettle, ptx.Method)
+	assert.EqualValues(t, channelID, ptx.ChannelIdentifier)
+}
@@ -0,0 +1,113 @@
+package photon
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+以--gossip-capacity启动时,每隔params.CapacityGossipInterval块把自己每个打开通道中可以支付的金额签名以后发给所有通道伙伴,
+同时转发上次发送以来收到的其他节点的通道容量,每次最多转发params.CapacityRelayMaxEntries条.
+收到的容量记录在ChannelGraph中,路由时跳过容量不足的边.容量只是近似值,超过params.CapacityMaxAge块没有更新的不再使用
+*/
+
+type capacityKey struct {
+	token   common.Address
+	owner   common.Address
+	partner common.Address
+}
+
+//capacityRelayQueue 每条边只转发最新的容量
+type capacityRelayQueue map[capacityKey]*encoding.CapacityEntry
+
+//gossipCapacity 在主线程中调用
+func (rs *Service) gossipCapacity(blockNumber int64) {
+	if !rs.Config.GossipCapacity {
+		return
+	}
+	var entries []*encoding.CapacityEntry
+	partners := make(map[common.Address]bool)
+	for _, g := range rs.Token2ChannelGraph {
+		g.ExpireEdgeCapacities(blockNumber - params.CapacityMaxAge)
+		for _, ch := range g.ChannelIdentifier2Channel {
+			if ch.State != channeltype.StateOpened {
+				continue
+			}
+			partners[ch.PartnerState.Address] = true
+			e := encoding.NewCapacityEntry(ch.TokenAddress, ch.PartnerState.Address, ch.Distributable(), blockNumber)
+			err := e.Sign(rs.PrivateKey)
+			if err != nil {
+				log.Error(fmt.Sprintf("sign capacity of %s err %s", ch.ChannelIdentifier.String(), err))
+				continue
+			}
+			entries = append(entries, e)
+		}
+	}
+	entries = append(entries, rs.capacityRelays.take(blockNumber-params.CapacityMaxAge, params.CapacityRelayMaxEntries)...)
+	if len(entries) == 0 || len(partners) == 0 {
+		return
+	}
+	for partner := range partners {
+		for i := 0; i < len(entries); i += params.CapacityUpdateMaxEntries {
+			end := i + params.CapacityUpdateMaxEntries
+			if end > len(entries) {
+				end = len(entries)
+			}
+			msg := encoding.NewCapacityUpdate(entries[i:end])
+			err := msg.Sign(rs.PrivateKey, msg)
+			if err == nil {
+				err = rs.sendAsync(partner, msg)
+			}
+			if err != nil {
+				log.Warn(fmt.Sprintf("send capacity update to %s err %s", utils.APex2(partner), err))
+				break
+			}
+		}
+	}
+	log.Trace(fmt.Sprintf("gossip %d channel capacities to %d partners", len(entries), len(partners)))
+}
+
+/*
+onCapacityUpdate 记录伙伴发来的通道容量,只接收自己有的token,路由图中存在的边,以及不太旧也不来自未来的容量.
+比已知的更新的容量放进转发队列
+*/
+func (rs *Service) onCapacityUpdate(msg *encoding.CapacityUpdate) error {
+	if !rs.Config.GossipCapacity {
+		return nil
+	}
+	blockNumber := rs.GetBlockNumber()
+	for _, e := range msg.Entries {
+		//自己的通道自己最清楚
+		if e.Owner == rs.NodeAddress || e.Partner == rs.NodeAddress {
+			continue
+		}
+		if e.BlockNumber > blockNumber+params.CapacityGossipInterval || e.BlockNumber < blockNumber-params.CapacityMaxAge {
+			continue
+		}
+		g := rs.Token2ChannelGraph[e.Token]
+		if g == nil {
+			continue
+		}
+		if g.SetEdgeCapacity(e.Owner, e.Partner, e.Capacity, e.BlockNumber) {
+			rs.capacityRelays[capacityKey{e.Token, e.Owner, e.Partner}] = e
+		}
+	}
+	return nil
+}
+
+//take 取出最多n条不早于minBlockNumber的容量,其余的丢弃,等待下一次更新
+func (q capacityRelayQueue) take(minBlockNumber int64, n int) (entries []*encoding.CapacityEntry) {
+	for key, e := range q {
+		if len(entries) < n && e.BlockNumber >= minBlockNumber {
+			entries = append(entries, e)
+		}
+		delete(q, key)
+	}
+	return
+}
@@ -0,0 +1,55 @@
+package photon
+
+import (
+	"math/big"
+	"sync/atomic"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/network/graph"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnCapacityUpdate(t *testing.T) {
+	key, addr := utils.MakePrivateKeyAddress()
+	ownerKey, owner := utils.MakePrivateKeyAddress()
+	partner, token := utils.NewRandomAddress(), utils.NewRandomAddress()
+	rs := &Service{
+		PrivateKey:         key,
+		NodeAddress:        addr,
+		Config:             &params.Config{GossipCapacity: true},
+		Token2ChannelGraph: map[common.Address]*graph.ChannelGraph{token: graph.NewChannelGraph(addr, token, []common.Address{addr, owner, owner, partner})},
+		capacityRelays:     make(capacityRelayQueue),
+	}
+	rs.BlockNumber = new(atomic.Value)
+	rs.BlockNumber.Store(int64(1000))
+	newEntry := func(token, partner common.Address, blockNumber int64) *encoding.CapacityEntry {
+		e := encoding.NewCapacityEntry(token, partner, big.NewInt(10), blockNumber)
+		assert.Nil(t, e.Sign(ownerKey))
+		return e
+	}
+	msg := encoding.NewCapacityUpdate([]*encoding.CapacityEntry{
+		newEntry(token, partner, 990),
+		//不认识的token,和我的通道,太旧的容量都不接收
+		newEntry(utils.NewRandomAddress(), partner, 990),
+		newEntry(token, addr, 990),
+		newEntry(token, partner, 1000-params.CapacityMaxAge-1),
+	})
+	assert.Nil(t, rs.onCapacityUpdate(msg))
+	relays := rs.capacityRelays.take(0, params.CapacityRelayMaxEntries)
+	if assert.Len(t, relays, 1) {
+		assert.Equal(t, partner, relays[0].Partner)
+	}
+	assert.Len(t, rs.capacityRelays, 0)
+	//重复收到的不再转发
+	assert.Nil(t, rs.onCapacityUpdate(encoding.NewCapacityUpdate([]*encoding.CapacityEntry{newEntry(token, partner, 990)})))
+	assert.Len(t, rs.capacityRelays, 0)
+	assert.Nil(t, rs.onCapacityUpdate(encoding.NewCapacityUpdate([]*encoding.CapacityEntry{newEntry(token, partner, 995)})))
+	assert.Len(t, rs.capacityRelays, 1)
+	//转发有数量限制
+	assert.Len(t, rs.capacityRelays.take(0, 0), 0)
+	assert.Len(t, rs.capacityRelays, 0)
+}
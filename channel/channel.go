@@ -221,7 +221,7 @@ func (c *Channel) HandleChannelPunished(beneficiaries common.Address) {
 HandleClosed handles this channel was closed on blockchain
 1. 更新NonClosing 一方的 ContractTransferAmount 和 LocksRoot,
 2. 对方可能用旧的BalanceProof, 所以未必与我保存的 TransferAmount 和 LocksRoot一致
-3. 如果我不是关闭方,那么需要更新对方的 BalanceProof
+3. 如果我不是关闭方,那么需要更新对方的 BalanceProof,由调用者负责,因为提交失败需要通知上层
 4. 我持有的知道密码的锁,需要解锁.
 */
 /*
@@ -229,16 +229,14 @@ HandleClosed handles this channel was closed on blockchain
  *
  *		1. Update ContractTransferAmount & LocksRoot of the non-closing participant.
  *		2. That participant may submit used BalanceProof, in which TransferAmount & LocksRoot are not consistent with mine.
- *		3. If I am not the non-closing participant, then update the BalanceProof of my channel partner.
+ *		3. If I am not the non-closing participant, then update the BalanceProof of my channel partner, which is left to the caller.
  *		4. All locks I am holding that have known secrets must be unlocked.
  */
 func (c *Channel) HandleClosed(closingAddress common.Address, transferredAmount *big.Int, locksRoot common.Hash) {
 	endStateUpdatedOnContract := c.PartnerState
-	balanceProof := c.PartnerState.BalanceProofState
 	//依据合约上保存的 ContractTransferAmount 以及 LocksRoot 来更新我本地的
 	//the channel was closed, update our half of the state if we need to
 	if closingAddress != c.OurState.Address {
-		c.ExternState.UpdateTransfer(balanceProof)
 		endStateUpdatedOnContract = c.OurState
 	}
 	endStateUpdatedOnContract.SetContractTransferAmount(transferredAmount)
@@ -233,6 +233,37 @@ func (s *Serialization) MinExpiration(blockNumber int64) int64 {
 	return min
 }
 
+/*
+SettleCountdown 通道关闭以后的结算倒计时
+1. 在DisputeEndBlock(含)之前,双方都可以提交BalanceProof以及unlock
+2. 从SettleBlock开始才可以settle通道,中间的PunishBlockNumber个块用于punish
+*/
+type SettleCountdown struct {
+	BlockNumber                 int64 `json:"block_number"`
+	DisputeEndBlock             int64 `json:"dispute_end_block"`
+	DisputeBlocksLeft           int64 `json:"dispute_blocks_left"`
+	SettleBlock                 int64 `json:"settle_block"`
+	BlocksUntilSettle           int64 `json:"blocks_until_settle"`
+	UpdateBalanceProofSubmitted bool  `json:"update_balance_proof_submitted"` //我方是否已经提交了UpdateBalanceProof的tx
+	UnlockSubmitted             bool  `json:"unlock_submitted"`               //我方是否已经提交了unlock的tx
+}
+
+//NewSettleCountdown 根据通道关闭的块和当前块计算结算倒计时
+func NewSettleCountdown(closedBlock int64, settleTimeout int, punishBlockNumber int64, blockNumber int64) *SettleCountdown {
+	sc := &SettleCountdown{
+		BlockNumber:     blockNumber,
+		DisputeEndBlock: closedBlock + int64(settleTimeout),
+		SettleBlock:     closedBlock + int64(settleTimeout) + punishBlockNumber + 1,
+	}
+	if sc.DisputeEndBlock > blockNumber {
+		sc.DisputeBlocksLeft = sc.DisputeEndBlock - blockNumber
+	}
+	if sc.SettleBlock > blockNumber {
+		sc.BlocksUntilSettle = sc.SettleBlock - blockNumber
+	}
+	return sc
+}
+
 //ChannelDataDetail for user api
 type ChannelDataDetail struct {
 	ChannelIdentifier   string   `json:"channel_identifier"`
@@ -262,6 +293,7 @@ type ChannelDataDetail struct {
 	OurBalanceProof           *transfer.BalanceProofState        `json:"our_balance_proof,omitempty"`
 	PartnerBalanceProof       *transfer.BalanceProofState        `json:"partner_balance_proof,omitempty"`
 	Signature                 []byte                             `json:"signature,omitempty"` //my signature of PartnerBalanceProof
+	SettleCountdown           *SettleCountdown                   `json:"settle_countdown,omitempty"` //只有关闭的通道才有
 }
 
 //ChannelSerialization2ChannelDataDetail 辅助函数
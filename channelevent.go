@@ -0,0 +1,71 @@
+package photon
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/channel"
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+)
+
+/*
+通道审计记录:每一次改变BalanceProof的消息(无论是自己发出的还是收到的)和通道相关的链上事件都追加到历史数据库中,
+出现争议时可以按照块号核对双方交换过的BalanceProof和链上提交的状态.
+记录失败只打印日志,不影响通道本身的处理
+*/
+
+func (rs *Service) saveChannelEvent(e *models.ChannelEvent) {
+	err := rs.dao.NewChannelEvent(e)
+	if err != nil {
+		log.Error(fmt.Sprintf("save channel event %s on %s err %s", e.Type, utils.HPex(e.ChannelIdentifier), err))
+	}
+}
+
+/*
+recordChannelMessage 记录已经成功登记到通道中的`tr`,MessageHash和合约验证BalanceProof签名时使用的一致
+*/
+func (rs *Service) recordChannelMessage(ch *channel.Channel, tr encoding.EnvelopMessager) {
+	env := tr.GetEnvelopMessage()
+	e := &models.ChannelEvent{
+		ChannelIdentifier: ch.ChannelIdentifier.ChannelIdentifier,
+		OpenBlockNumber:   ch.ChannelIdentifier.OpenBlockNumber,
+		BlockNumber:       rs.GetBlockNumber(),
+		Participant:       tr.GetSender(),
+		MessageHash:       encoding.HashMessageWithoutSignature(tr),
+		Nonce:             env.Nonce,
+		TransferAmount:    env.TransferAmount,
+		Locksroot:         env.Locksroot,
+	}
+	switch msg := tr.(type) {
+	case *encoding.DirectTransfer:
+		e.Type = models.ChannelEventBalanceProof
+	case *encoding.MediatedTransfer:
+		e.Type = models.ChannelEventLockAdded
+		e.LockSecretHash = msg.LockSecretHash
+		e.Amount = msg.PaymentAmount
+	case *encoding.UnLock:
+		e.Type = models.ChannelEventLockUnlocked
+		e.LockSecretHash = msg.LockSecretHash()
+	case *encoding.RemoveExpiredHashlockTransfer:
+		e.Type = models.ChannelEventLockExpired
+		e.LockSecretHash = msg.LockSecretHash
+	case *encoding.AnnounceDisposedResponse:
+		e.Type = models.ChannelEventLockDisposed
+		e.LockSecretHash = msg.LockSecretHash
+	default:
+		log.Warn(fmt.Sprintf("unknown balance proof message %s", tr))
+		return
+	}
+	rs.saveChannelEvent(e)
+}
+
+/*
+recordChannelChainEvent 记录通道相关的链上事件`e`,重启以后重复处理的事件只记录一次
+*/
+func (rs *Service) recordChannelChainEvent(ch *channel.Channel, e *models.ChannelEvent) {
+	e.ChannelIdentifier = ch.ChannelIdentifier.ChannelIdentifier
+	e.OpenBlockNumber = ch.ChannelIdentifier.OpenBlockNumber
+	rs.saveChannelEvent(e)
+}
@@ -0,0 +1,62 @@
+package photon
+
+import (
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+onChannelProbe 通道打开,发送方是通道伙伴,并且双方的BalanceProof nonce都和我们记录的一致时才接受,
+返回错误时protocol不回复Ack,对方的探测会超时.
+探测失败不是协议违规,所以不使用peerStats统计的错误码
+*/
+func (rs *Service) onChannelProbe(msg *encoding.ChannelProbe) error {
+	ch, err := rs.findChannelByIdentifier(msg.ChannelIdentifier)
+	if err != nil {
+		return rerr.ErrChannelNotFound.AppendError(err)
+	}
+	if ch.PartnerState.Address != msg.Sender {
+		return rerr.ErrChannelState.Printf("probe of channel %s from %s who is not our partner", msg.ChannelIdentifier.String(), msg.Sender.String())
+	}
+	if ch.ChannelIdentifier.OpenBlockNumber != msg.OpenBlockNumber {
+		return rerr.ErrChannelState.Printf("probe open block number %d, ours %d", msg.OpenBlockNumber, ch.ChannelIdentifier.OpenBlockNumber)
+	}
+	if ch.State != channeltype.StateOpened {
+		return rerr.ErrChannelState.Printf("channel is %s", ch.State)
+	}
+	if msg.Nonce != ch.PartnerState.BalanceProofState.Nonce || msg.PartnerNonce != ch.OurState.BalanceProofState.Nonce {
+		return rerr.ErrChannelState.Printf("probe nonce %d/%d, ours %d/%d", msg.Nonce, msg.PartnerNonce,
+			ch.PartnerState.BalanceProofState.Nonce, ch.OurState.BalanceProofState.Nonce)
+	}
+	return nil
+}
+
+/*
+probeChannel 向通道伙伴发送零金额的ChannelProbe,只发送一次.
+对方回复Delivered但是没有回复Ack,说明对方不认可这个通道的状态
+*/
+func (r *API) probeChannel(partner common.Address, c *channeltype.Serialization, timeout time.Duration) *LayerDiagnostics {
+	d := &LayerDiagnostics{}
+	msg := encoding.NewChannelProbe(c.ChannelIdentifier.ChannelIdentifier, c.ChannelIdentifier.OpenBlockNumber, c.OurBalanceProof.Nonce, c.PartnerBalanceProof.Nonce)
+	err := msg.Sign(r.Photon.PrivateKey, msg)
+	if err != nil {
+		d.Detail = err.Error()
+		return d
+	}
+	var rtt time.Duration
+	var delivered bool
+	rtt, delivered, err = r.Photon.Protocol.ProbeAndWait(partner, msg, timeout)
+	if err == nil {
+		d.OK = true
+		d.Latency = int64(rtt / time.Millisecond)
+	} else if delivered {
+		d.Detail = "partner received the probe but rejected it, the channel state of both sides may differ"
+	} else {
+		d.Detail = err.Error()
+	}
+	return d
+}
@@ -0,0 +1,55 @@
+package photon
+
+import (
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/channel"
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/network/graph"
+	"github.com/SmartMeshFoundation/Photon/network/rpc/contracts"
+	"github.com/SmartMeshFoundation/Photon/transfer"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnChannelProbe(t *testing.T) {
+	partnerKey, _ := crypto.GenerateKey()
+	token := utils.NewRandomAddress()
+	id := contracts.ChannelUniqueID{ChannelIdentifier: utils.NewRandomHash(), OpenBlockNumber: 7}
+	ch := &channel.Channel{
+		ChannelIdentifier: id,
+		OurState:          &channel.EndState{Address: utils.NewRandomAddress(), BalanceProofState: transfer.NewEmptyBalanceProofState()},
+		PartnerState:      &channel.EndState{Address: crypto.PubkeyToAddress(partnerKey.PublicKey), BalanceProofState: transfer.NewEmptyBalanceProofState()},
+		TokenAddress:      token,
+		State:             channeltype.StateOpened,
+	}
+	ch.OurState.BalanceProofState.Nonce = 3
+	ch.PartnerState.BalanceProofState.Nonce = 5
+	rs := &Service{
+		Token2ChannelGraph: map[common.Address]*graph.ChannelGraph{
+			token: {ChannelIdentifier2Channel: map[common.Hash]*channel.Channel{id.ChannelIdentifier: ch}},
+		},
+	}
+	probe := func(channelIdentifier common.Hash, openBlockNumber int64, nonce, partnerNonce uint64) error {
+		m := encoding.NewChannelProbe(channelIdentifier, openBlockNumber, nonce, partnerNonce)
+		assert.Nil(t, m.Sign(partnerKey, m))
+		return rs.onChannelProbe(m)
+	}
+	//对方的nonce是从它自己的角度
+	assert.Nil(t, probe(id.ChannelIdentifier, 7, 5, 3))
+	assert.NotNil(t, probe(id.ChannelIdentifier, 7, 6, 3))
+	assert.NotNil(t, probe(id.ChannelIdentifier, 7, 5, 2))
+	assert.NotNil(t, probe(id.ChannelIdentifier, 8, 5, 3))
+	assert.NotNil(t, probe(utils.NewRandomHash(), 7, 5, 3))
+	ch.State = channeltype.StateClosed
+	assert.NotNil(t, probe(id.ChannelIdentifier, 7, 5, 3))
+	ch.State = channeltype.StateOpened
+	//不是通道伙伴发来的
+	otherKey, _ := crypto.GenerateKey()
+	m := encoding.NewChannelProbe(id.ChannelIdentifier, 7, 5, 3)
+	assert.Nil(t, m.Sign(otherKey, m))
+	assert.NotNil(t, rs.onChannelProbe(m))
+}
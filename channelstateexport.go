@@ -0,0 +1,233 @@
+package photon
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/gob"
+	"fmt"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/channel"
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/network/graph"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
+)
+
+/*
+把节点迁移到新的机器:旧节点导出所有未settle的通道(包括balance proof,锁和已知的密码)以及进行中交易的快照,
+用节点自己的公钥加密,新节点使用同一个账户导入.
+已经存在的通道不会被覆盖,进行中的交易在新节点重启以后从快照恢复.
+*/
+
+const exportChannelStateReqName = "exportChannelState"
+const importChannelStateReqName = "importChannelState"
+
+type importChannelStateReq struct {
+	data []byte
+}
+
+func (rs *Service) exportChannelStateClient() *utils.AsyncResult {
+	req := &apiReq{
+		ReqID: utils.RandomString(10),
+		Name:  exportChannelStateReqName,
+	}
+	return rs.sendReqClient(req)
+}
+
+func (rs *Service) importChannelStateClient(data []byte) *utils.AsyncResult {
+	req := &apiReq{
+		ReqID: utils.RandomString(10),
+		Name:  importChannelStateReqName,
+		Req: &importChannelStateReq{
+			data: data,
+		},
+	}
+	return rs.sendReqClient(req)
+}
+
+//channelStateExportMagic 导出文件的前缀,后面是加密的ChannelStateExport
+var channelStateExportMagic = []byte("PHCSX001")
+
+//ChannelStateExport 导出的全部通道状态
+type ChannelStateExport struct {
+	Owner         common.Address
+	Registry      common.Address
+	BlockNumber   int64
+	Time          int64
+	Channels      []*channeltype.Serialization
+	StateManagers []*models.StateManagerSnapshot
+}
+
+//ChannelStateImportResult 导入的结果
+type ChannelStateImportResult struct {
+	Imported      []common.Hash          `json:"imported"`
+	Skipped       map[common.Hash]string `json:"skipped"` //没有导入的通道以及原因
+	StateManagers int                    `json:"state_managers"`
+	RestartNeeded bool                   `json:"restart_needed"` //导入了进行中的交易,重启以后才能继续
+}
+
+//EncryptChannelStateExport 用`key`的公钥加密,只有同一个账户才能导入
+func EncryptChannelStateExport(key *ecdsa.PrivateKey, e *ChannelStateExport) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	err := gob.NewEncoder(buf).Encode(e)
+	if err != nil {
+		return nil, rerr.ErrUnknown.AppendError(err)
+	}
+	data, err := ecies.Encrypt(rand.Reader, ecies.ImportECDSAPublic(&key.PublicKey), buf.Bytes(), nil, nil)
+	if err != nil {
+		return nil, rerr.ErrUnknown.AppendError(err)
+	}
+	return append(append([]byte{}, channelStateExportMagic...), data...), nil
+}
+
+//DecryptChannelStateExport 用导出节点的私钥解密
+func DecryptChannelStateExport(key *ecdsa.PrivateKey, data []byte) (e *ChannelStateExport, err error) {
+	if !bytes.HasPrefix(data, channelStateExportMagic) {
+		return nil, rerr.ErrArgumentError.Append("not a channel state export")
+	}
+	plain, err := ecies.ImportECDSA(key).Decrypt(rand.Reader, data[len(channelStateExportMagic):], nil, nil)
+	if err != nil {
+		return nil, rerr.ErrArgumentError.Printf("decrypt channel state export err %s", err)
+	}
+	e = new(ChannelStateExport)
+	err = gob.NewDecoder(bytes.NewReader(plain)).Decode(e)
+	if err != nil {
+		return nil, rerr.ErrArgumentError.Printf("decode channel state export err %s", err)
+	}
+	return
+}
+
+/*
+exportChannelState 在主线程中收集内存中最新的通道状态,保证和进行中交易的快照一致.
+导出成功以后本节点不再发起和接收新交易,直到重启,否则新节点导入的balance proof已经过时,
+两个节点会用同一个nonce签名不同的balance proof
+*/
+func (rs *Service) exportChannelState() (result *utils.AsyncResult) {
+	e := &ChannelStateExport{
+		Owner:       rs.NodeAddress,
+		Registry:    rs.Chain.GetRegistryAddress(),
+		BlockNumber: rs.GetBlockNumber(),
+		Time:        time.Now().Unix(),
+	}
+	for _, g := range rs.Token2ChannelGraph {
+		for _, c := range g.ChannelIdentifier2Channel {
+			if c.State == channeltype.StateSettled {
+				continue
+			}
+			e.Channels = append(e.Channels, channel.NewChannelSerialization(c))
+		}
+	}
+	var err error
+	e.StateManagers, err = rs.dao.GetAllStateManagerSnapshots()
+	if err != nil {
+		return utils.NewAsyncResultWithError(err)
+	}
+	data, err := EncryptChannelStateExport(rs.PrivateKey, e)
+	result = utils.NewAsyncResultWithError(err)
+	result.Tag = data
+	if err != nil {
+		return
+	}
+	rs.StopCreateNewTransfers = true
+	log.Info(fmt.Sprintf("export %d channels and %d state managers", len(e.Channels), len(e.StateManagers)))
+	log.Warn("channel state exported, new transfers are refused until restart, stop this node before importing on the new one")
+	return
+}
+
+//importChannel 把`cs`加入数据库和通道图,token还没有注册时先确认它在链上注册过再注册
+func (rs *Service) importChannel(cs *channeltype.Serialization) error {
+	token := cs.TokenAddress()
+	tokenNetwork, err := rs.Chain.TokenNetwork(token)
+	if err != nil {
+		return err
+	}
+	g := rs.getToken2ChannelGraph(token)
+	if g == nil {
+		registered, err := tokenNetwork.TokenNetworkByToken(token)
+		if err != nil {
+			return err
+		}
+		if !registered {
+			return rerr.ErrTokenNotFound.Printf("token %s is not registered on registry %s", token.String(), tokenNetwork.Address.String())
+		}
+		err = rs.dao.AddToken(token, tokenNetwork.Address)
+		if err != nil {
+			return err
+		}
+		g = graph.NewChannelGraph(rs.NodeAddress, token, nil)
+		rs.Token2TokenNetwork[token] = tokenNetwork.Address
+		rs.Token2ChannelGraph[token] = g
+	}
+	ch, err := rs.channelSerilization2Channel(cs, tokenNetwork)
+	if err != nil {
+		return err
+	}
+	err = g.AddChannel(ch)
+	if err != nil {
+		return err
+	}
+	return rs.dao.NewChannel(cs)
+}
+
+/*
+importChannelState 导入其他机器上同一个账户导出的通道状态,已经存在或者已经settle的通道跳过
+*/
+func (rs *Service) importChannelState(req *importChannelStateReq) (result *utils.AsyncResult) {
+	e, err := DecryptChannelStateExport(rs.PrivateKey, req.data)
+	if err != nil {
+		return utils.NewAsyncResultWithError(err)
+	}
+	if e.Owner != rs.NodeAddress || e.Registry != rs.Chain.GetRegistryAddress() {
+		return utils.NewAsyncResultWithError(rerr.ErrArgumentError.Printf("export of node %s on registry %s cannot be imported here", e.Owner.String(), e.Registry.String()))
+	}
+	r := &ChannelStateImportResult{
+		Skipped: make(map[common.Hash]string),
+	}
+	for _, cs := range e.Channels {
+		id := cs.ChannelIdentifier.ChannelIdentifier
+		if cs.OurAddress != rs.NodeAddress {
+			r.Skipped[id] = "not my channel"
+			continue
+		}
+		if _, err = rs.dao.GetChannelByAddress(id); err == nil {
+			r.Skipped[id] = "channel already exists"
+			continue
+		}
+		err = rs.importChannel(cs)
+		if err != nil {
+			r.Skipped[id] = err.Error()
+			continue
+		}
+		r.Imported = append(r.Imported, id)
+	}
+	known := make(map[common.Hash]bool)
+	ss, err := rs.dao.GetAllStateManagerSnapshots()
+	if err != nil {
+		return utils.NewAsyncResultWithError(err)
+	}
+	for _, s := range ss {
+		known[s.Key] = true
+	}
+	for _, s := range e.StateManagers {
+		if known[s.Key] {
+			continue
+		}
+		err = rs.dao.SaveStateManagerSnapshot(s)
+		if err != nil {
+			return utils.NewAsyncResultWithError(err)
+		}
+		r.StateManagers++
+	}
+	r.RestartNeeded = r.StateManagers > 0
+	log.Info(fmt.Sprintf("import %d channels and %d state managers exported at block %d, skip %d channels", len(r.Imported), r.StateManagers, e.BlockNumber, len(r.Skipped)))
+	result = utils.NewAsyncResult()
+	result.Tag = r
+	result.Result <- nil
+	return
+}
@@ -0,0 +1,60 @@
+package photon
+
+import (
+	"math/big"
+	"sync/atomic"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/network/rpc/contracts"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannelStateExport(t *testing.T) {
+	key, addr := utils.MakePrivateKeyAddress()
+	smKey := utils.NewRandomHash()
+	e := &ChannelStateExport{
+		Owner:       addr,
+		Registry:    utils.NewRandomAddress(),
+		BlockNumber: 100,
+		Channels: []*channeltype.Serialization{{
+			ChannelIdentifier: &contracts.ChannelUniqueID{ChannelIdentifier: utils.NewRandomHash()},
+			OurAddress:        addr,
+			OurKnownSecrets:   []*channeltype.KnownSecret{{Secret: utils.NewRandomHash(), IsRegisteredOnChain: true}},
+		}},
+		StateManagers: []*models.StateManagerSnapshot{{Key: smKey, Seq: 3, Data: []byte{1, 2, 3}}},
+	}
+	data, err := EncryptChannelStateExport(key, e)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	e2, err := DecryptChannelStateExport(key, data)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.EqualValues(t, e.Registry, e2.Registry)
+	assert.EqualValues(t, e.Channels[0].ChannelIdentifier, e2.Channels[0].ChannelIdentifier)
+	assert.EqualValues(t, e.Channels[0].OurKnownSecrets[0].Secret, e2.Channels[0].OurKnownSecrets[0].Secret)
+	assert.EqualValues(t, e.StateManagers, e2.StateManagers)
+	//其他账户无法解密
+	otherKey, _ := utils.MakePrivateKeyAddress()
+	_, err = DecryptChannelStateExport(otherKey, data)
+	assert.NotNil(t, err)
+	_, err = DecryptChannelStateExport(key, data[len(channelStateExportMagic):])
+	assert.NotNil(t, err)
+}
+
+func TestTransferRefusedAfterExport(t *testing.T) {
+	rs := &Service{BlockNumber: new(atomic.Value)}
+	rs.BlockNumber.Store(int64(100))
+	//导出以后exportChannelState设置StopCreateNewTransfers,jsonrpc和mobile也走TransferInternal
+	rs.StopCreateNewTransfers = true
+	r := &API{Photon: rs}
+	_, err := r.TransferInternal(utils.NewRandomAddress(), big.NewInt(1), utils.NewRandomAddress(), utils.EmptyHash, false, "", nil, nil)
+	assert.EqualValues(t, rerr.ErrStopCreateNewTransfer, err)
+}
@@ -0,0 +1,187 @@
+package photon
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/notify"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//AnomalyKind 会触发熔断的异常类型
+type AnomalyKind string
+
+const (
+	//AnomalyAnnounceDisposed 收到对方放弃锁的AnnounceDisposed
+	AnomalyAnnounceDisposed AnomalyKind = "announce_disposed"
+	//AnomalyInvalidSignature 收到签名者不是通道参与方的消息
+	AnomalyInvalidSignature AnomalyKind = "invalid_signature"
+	//AnomalyUnexpectedClose 通道被对方在链上关闭
+	AnomalyUnexpectedClose AnomalyKind = "unexpected_close"
+)
+
+//anomalyThreshold 在params.CircuitBreakerWindow内某类异常达到这个次数就熔断
+func anomalyThreshold(kind AnomalyKind) int {
+	switch kind {
+	case AnomalyAnnounceDisposed:
+		return params.CircuitBreakerAnnounceDisposedThreshold
+	case AnomalyInvalidSignature:
+		return params.CircuitBreakerInvalidSignatureThreshold
+	case AnomalyUnexpectedClose:
+		return params.CircuitBreakerUnexpectedCloseThreshold
+	}
+	return 0
+}
+
+//CircuitBreakerStatus 某个token的熔断状态以及时间窗口内各类异常的次数
+type CircuitBreakerStatus struct {
+	TokenAddress common.Address      `json:"token_address"`
+	Tripped      bool                `json:"tripped"`
+	TrippedTime  int64               `json:"tripped_time,omitempty"`
+	Reason       string              `json:"reason,omitempty"`
+	Anomalies    map[AnomalyKind]int `json:"anomalies"`
+}
+
+type tokenBreaker struct {
+	anomalies   map[AnomalyKind][]time.Time //时间窗口内每次异常的时间,按时间排序
+	tripped     bool
+	trippedTime time.Time
+	reason      string
+}
+
+//prune 丢弃时间窗口之外的异常
+func (tb *tokenBreaker) prune(now time.Time) {
+	for kind, times := range tb.anomalies {
+		i := 0
+		for i < len(times) && now.Sub(times[i]) > params.CircuitBreakerWindow {
+			i++
+		}
+		tb.anomalies[kind] = times[i:]
+	}
+}
+
+/*
+circuitBreakers 每个token一个熔断器,同一个token网络在短时间内出现大量异常时暂停发起新交易,
+直到运营方通过API手工恢复.只保存在内存中,重启后恢复正常
+*/
+type circuitBreakers struct {
+	lock   sync.Mutex
+	tokens map[common.Address]*tokenBreaker
+}
+
+func newCircuitBreakers() *circuitBreakers {
+	return &circuitBreakers{
+		tokens: make(map[common.Address]*tokenBreaker),
+	}
+}
+
+/*
+record 记录`token`上的一次异常,返回值表示这次异常是否导致熔断,已经熔断的不会重复返回true
+*/
+func (cb *circuitBreakers) record(token common.Address, kind AnomalyKind, now time.Time) (tripped bool, reason string) {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+	tb, ok := cb.tokens[token]
+	if !ok {
+		tb = &tokenBreaker{anomalies: make(map[AnomalyKind][]time.Time)}
+		cb.tokens[token] = tb
+	}
+	tb.prune(now)
+	tb.anomalies[kind] = append(tb.anomalies[kind], now)
+	threshold := anomalyThreshold(kind)
+	if tb.tripped || threshold <= 0 || len(tb.anomalies[kind]) < threshold {
+		return false, ""
+	}
+	tb.tripped = true
+	tb.trippedTime = now
+	tb.reason = fmt.Sprintf("%d %s in %s", len(tb.anomalies[kind]), kind, params.CircuitBreakerWindow)
+	return true, tb.reason
+}
+
+//isTripped `token`是否已经熔断
+func (cb *circuitBreakers) isTripped(token common.Address) bool {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+	tb, ok := cb.tokens[token]
+	return ok && tb.tripped
+}
+
+//reset 恢复`token`的交易,同时清空异常记录,否则下一次异常就会再次熔断
+func (cb *circuitBreakers) reset(token common.Address) error {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+	tb, ok := cb.tokens[token]
+	if !ok || !tb.tripped {
+		return rerr.ErrArgumentError.Append(fmt.Sprintf("circuit breaker of token %s is not tripped", token.String()))
+	}
+	delete(cb.tokens, token)
+	return nil
+}
+
+//snapshot 返回所有记录过异常的token的状态
+func (cb *circuitBreakers) snapshot(now time.Time) (status []*CircuitBreakerStatus) {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+	for token, tb := range cb.tokens {
+		tb.prune(now)
+		s := &CircuitBreakerStatus{
+			TokenAddress: token,
+			Tripped:      tb.tripped,
+			Reason:       tb.reason,
+			Anomalies:    make(map[AnomalyKind]int),
+		}
+		if tb.tripped {
+			s.TrippedTime = tb.trippedTime.Unix()
+		}
+		for kind, times := range tb.anomalies {
+			s.Anomalies[kind] = len(times)
+		}
+		status = append(status, s)
+	}
+	return
+}
+
+//recordAnomaly 记录一次异常,熔断时通知运营方
+func (rs *Service) recordAnomaly(token common.Address, kind AnomalyKind) {
+	tripped, reason := rs.circuitBreakers.record(token, kind, time.Now())
+	if !tripped {
+		return
+	}
+	log.Error(fmt.Sprintf("circuit breaker of token %s tripped: %s, new transfers are paused", utils.APex2(token), reason))
+	rs.NotifyHandler.NotifyEvent(notify.LevelError, &notify.Event{
+		Code:         notify.EventCircuitBreakerTripped,
+		TokenAddress: token,
+		Params:       map[string]string{notify.ParamReason: reason},
+	})
+}
+
+//checkCircuitBreaker 熔断的token不能发起新交易
+func (rs *Service) checkCircuitBreaker(token common.Address) error {
+	if rs.circuitBreakers.isTripped(token) {
+		return rerr.ErrTokenCircuitBreakerTripped.Append(fmt.Sprintf("token %s", token.String()))
+	}
+	return nil
+}
+
+//recordMessageAnomaly 消息的签名者不是通道参与方时,记为消息所属通道的token上的异常
+func (rs *Service) recordMessageAnomaly(msg encoding.SignedMessager, err error) {
+	se, ok := err.(rerr.StandardError)
+	if !ok || (se.ErrorCode != rerr.ErrChannelNotParticipant.ErrorCode && se.ErrorCode != rerr.ErrChannelInvalidSender.ErrorCode) {
+		return
+	}
+	em, ok := msg.(encoding.EnvelopMessager)
+	if !ok {
+		return
+	}
+	ch, err := rs.findChannelByIdentifier(em.GetEnvelopMessage().ChannelIdentifier)
+	if err != nil {
+		return
+	}
+	rs.recordAnomaly(ch.TokenAddress, AnomalyInvalidSignature)
+}
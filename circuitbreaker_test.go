@@ -0,0 +1,48 @@
+package photon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreakers(t *testing.T) {
+	cb := newCircuitBreakers()
+	token, other := utils.NewRandomAddress(), utils.NewRandomAddress()
+	now := time.Now()
+	threshold := params.CircuitBreakerUnexpectedCloseThreshold
+	for i := 0; i < threshold-1; i++ {
+		tripped, _ := cb.record(token, AnomalyUnexpectedClose, now)
+		assert.False(t, tripped)
+	}
+	//时间窗口之外的异常不计入
+	tripped, _ := cb.record(token, AnomalyUnexpectedClose, now.Add(params.CircuitBreakerWindow+time.Second))
+	assert.False(t, tripped)
+	assert.False(t, cb.isTripped(token))
+	assert.NotNil(t, cb.reset(token))
+
+	now = now.Add(params.CircuitBreakerWindow + time.Second)
+	for i := 0; i < threshold-2; i++ {
+		tripped, _ = cb.record(token, AnomalyUnexpectedClose, now)
+	}
+	tripped, reason := cb.record(token, AnomalyUnexpectedClose, now)
+	assert.True(t, tripped)
+	assert.NotEmpty(t, reason)
+	assert.True(t, cb.isTripped(token))
+	assert.False(t, cb.isTripped(other))
+	//已经熔断的不再重复通知
+	tripped, _ = cb.record(token, AnomalyUnexpectedClose, now)
+	assert.False(t, tripped)
+
+	status := cb.snapshot(now)
+	assert.Len(t, status, 1)
+	assert.True(t, status[0].Tripped)
+	assert.EqualValues(t, threshold+1, status[0].Anomalies[AnomalyUnexpectedClose])
+
+	assert.Nil(t, cb.reset(token))
+	assert.False(t, cb.isTripped(token))
+	assert.Len(t, cb.snapshot(now), 0)
+}
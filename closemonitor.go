@@ -0,0 +1,63 @@
+package photon
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/channel"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/notify"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer"
+	"github.com/SmartMeshFoundation/Photon/utils"
+)
+
+/*
+对方关闭通道时提交的是我签名的BalanceProof,合约不允许我再修改.
+如果不是我最新的BalanceProof,对方有可能想利用旧BalanceProof中已经移除的锁,需要通知上层注意.
+对方签名的BalanceProof需要我在settle之前提交,否则对方给我的钱就拿不到了,提交失败也要通知上层
+*/
+
+//isOutdatedBalanceProof 对方关闭通道时提交的我的BalanceProof是不是最新的
+func isOutdatedBalanceProof(ch *channel.Channel, st *mediatedtransfer.ContractClosedStateChange) bool {
+	bp := ch.OurState.BalanceProofState
+	if bp == nil {
+		return false
+	}
+	return bp.TransferAmount.Cmp(st.TransferredAmount) != 0 || bp.LocksRoot != st.LocksRoot
+}
+
+//onClosedByPartner 通道已经处理完关闭事件以后调用
+func (rs *Service) onClosedByPartner(ch *channel.Channel, st *mediatedtransfer.ContractClosedStateChange) {
+	partner := ch.PartnerState.Address
+	if isOutdatedBalanceProof(ch, st) {
+		log.Warn(fmt.Sprintf("partner %s closed channel %s with outdated balance proof, transferAmount=%s,locksroot=%s",
+			utils.APex2(partner), ch.ChannelIdentifier.String(), st.TransferredAmount, utils.HPex(st.LocksRoot)))
+		rs.NotifyHandler.NotifyEvent(notify.LevelWarn, &notify.Event{
+			Code:              notify.EventOutdatedBalanceProof,
+			TokenAddress:      ch.TokenAddress,
+			ChannelIdentifier: st.ChannelIdentifier,
+			Amount:            st.TransferredAmount,
+			BlockNumber:       st.ClosedBlock,
+			Params:            map[string]string{notify.ParamPartner: partner.String()},
+		})
+	}
+	bp := ch.PartnerState.BalanceProofState
+	if bp == nil || bp.Nonce == 0 {
+		//对方从来没有给我转过账,不需要提交
+		return
+	}
+	token := ch.TokenAddress
+	result := ch.ExternState.UpdateTransfer(bp)
+	go func() {
+		err := <-result.Result
+		if err == nil {
+			return
+		}
+		log.Error(fmt.Sprintf("update balance proof of %s on channel %s err %s", utils.APex2(partner), utils.HPex(st.ChannelIdentifier), err))
+		rs.NotifyHandler.NotifyEvent(notify.LevelError, &notify.Event{
+			Code:              notify.EventUpdateBalanceProofFailed,
+			TokenAddress:      token,
+			ChannelIdentifier: st.ChannelIdentifier,
+			Params:            map[string]string{notify.ParamError: err.Error()},
+		})
+	}()
+}
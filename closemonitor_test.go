@@ -0,0 +1,60 @@
+package photon
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/channel"
+	"github.com/SmartMeshFoundation/Photon/network/rpc/contracts"
+	"github.com/SmartMeshFoundation/Photon/notify"
+	"github.com/SmartMeshFoundation/Photon/transfer"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnClosedByPartnerOutdatedBalanceProof(t *testing.T) {
+	rs := &Service{NotifyHandler: notify.NewNotifyHandler()}
+	defer rs.NotifyHandler.Stop()
+	ch := &channel.Channel{
+		ChannelIdentifier: contracts.ChannelUniqueID{ChannelIdentifier: utils.NewRandomHash()},
+		OurState:          &channel.EndState{Address: utils.NewRandomAddress(), BalanceProofState: transfer.NewEmptyBalanceProofState()},
+		PartnerState:      &channel.EndState{Address: utils.NewRandomAddress(), BalanceProofState: transfer.NewEmptyBalanceProofState()},
+		TokenAddress:      utils.NewRandomAddress(),
+	}
+	ch.OurState.BalanceProofState.TransferAmount = big.NewInt(20)
+	ch.OurState.BalanceProofState.LocksRoot = utils.NewRandomHash()
+	st := &mediatedtransfer.ContractClosedStateChange{
+		ChannelIdentifier: ch.ChannelIdentifier.ChannelIdentifier,
+		ClosingAddress:    ch.PartnerState.Address,
+		ClosedBlock:       30,
+		TransferredAmount: big.NewInt(20),
+		LocksRoot:         ch.OurState.BalanceProofState.LocksRoot,
+	}
+	assert.False(t, isOutdatedBalanceProof(ch, st))
+	st.LocksRoot = utils.NewRandomHash()
+	assert.True(t, isOutdatedBalanceProof(ch, st))
+	st.LocksRoot = ch.OurState.BalanceProofState.LocksRoot
+	st.TransferredAmount = big.NewInt(10)
+	assert.True(t, isOutdatedBalanceProof(ch, st))
+
+	//对方没有给我转过账,不需要updateBalanceProof,只通知使用了旧的BalanceProof
+	rs.onClosedByPartner(ch, st)
+	var n *notify.Notice
+	select {
+	case n = <-rs.NotifyHandler.GetNoticeChan():
+	case <-time.After(time.Second):
+		t.Fatal("notice lost")
+	}
+	assert.EqualValues(t, notify.LevelWarn, n.Level)
+	var info struct {
+		Message notify.Event `json:"message"`
+	}
+	assert.Nil(t, json.Unmarshal([]byte(n.Info), &info))
+	assert.Equal(t, notify.EventOutdatedBalanceProof, info.Message.Code)
+	assert.Equal(t, ch.ChannelIdentifier.ChannelIdentifier, info.Message.ChannelIdentifier)
+	assert.EqualValues(t, big.NewInt(10), info.Message.Amount)
+	assert.Equal(t, ch.PartnerState.Address.String(), info.Message.Params[notify.ParamPartner])
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/big"
 	"os"
@@ -21,6 +22,7 @@ import (
 	"time"
 
 	"net"
+	"net/url"
 	"strconv"
 
 	"strings"
@@ -33,6 +35,7 @@ import (
 	"github.com/SmartMeshFoundation/Photon/accounts"
 	"github.com/SmartMeshFoundation/Photon/internal/debug"
 	"github.com/SmartMeshFoundation/Photon/internal/rpanic"
+	"github.com/SmartMeshFoundation/Photon/jsonrpc"
 	"github.com/SmartMeshFoundation/Photon/log"
 	"github.com/SmartMeshFoundation/Photon/models"
 	"github.com/SmartMeshFoundation/Photon/models/stormdb"
@@ -48,6 +51,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p/nat"
 	"gopkg.in/urfave/cli.v1"
 )
 
@@ -89,12 +93,30 @@ func StartMain() (*photon.API, error) {
 			Usage: "If you have a non-standard path for the ethereum keystore directory provide it using this argument. ",
 			Value: ethutils.DirectoryString{Value: params.DefaultKeyStoreDir()},
 		},
+		cli.StringFlag{
+			Name:  "hd-keystore",
+			Usage: "hd keystore file, derive the node account from its seed instead of using keystore-path",
+		},
+		cli.StringFlag{
+			Name:  "hd-path",
+			Usage: "base derivation path of hd-keystore, the i-th account is hd-path/i",
+			Value: accounts.DefaultHDBasePath,
+		},
+		cli.IntFlag{
+			Name:  "hd-account-count",
+			Usage: "how many accounts of hd-keystore are listed or searched for address",
+			Value: 10,
+		},
 		cli.StringFlag{
 			Name: "eth-rpc-endpoint",
 			Usage: `"host:port" address of ethereum JSON-RPC server.\n'
 	           'Also accepts a protocol prefix (ws:// or ipc channel) with optional port',`,
 			Value: node.DefaultIPCEndpoint("geth"),
 		},
+		cli.StringFlag{
+			Name:  "eth-rpc-backup-endpoints",
+			Usage: "comma separated ethereum JSON-RPC servers, photon will fail over to them when eth-rpc-endpoint is unavailable and switch back when it recovers",
+		},
 		cli.StringFlag{
 			Name:  "registry-contract-address",
 			Usage: `hex encoded address of the registry contract.it's the token network contract address '`,
@@ -161,6 +183,10 @@ func StartMain() (*photon.API, error) {
 			Name:  "matrix",
 			Usage: "use matrix as transport,default is xmpp",
 		},
+		cli.StringFlag{
+			Name:  "transports",
+			Usage: "comma separated transports by priority, such as udp,matrix,xmpp. messages go through the first transport on which the receiver is online, and fall back to the others. overrides --matrix",
+		},
 		cli.IntFlag{
 			Name:  "reveal-timeout",
 			Usage: "channels' reveal timeout",
@@ -170,10 +196,219 @@ func StartMain() (*photon.API, error) {
 			Name:  "pfs",
 			Usage: "pathfinder service host,example http://transport01.smartmesh.cn:7000,default ",
 		},
+		cli.BoolFlag{
+			Name:  "pfs-routing",
+			Usage: "query routes from pathfinder service when transfer has no route info, fallback to local routing when it fails",
+		},
+		cli.StringFlag{
+			Name:  "pfs-address",
+			Usage: "account of pathfinder service which receives the query fee",
+		},
+		cli.StringFlag{
+			Name:  "pfs-query-fee",
+			Usage: "fee paid to pathfinder service with an iou for each route query, 0 means not paying",
+			Value: "0",
+		},
 		cli.BoolFlag{
 			Name:  "enable-fork-confirm",
 			Usage: "enable fork confirm when receive events from chain,default is false,default is disabled",
 		},
+		cli.Int64Flag{
+			Name:  "fork-confirm-blocks",
+			Usage: fmt.Sprintf("how many blocks fork confirm waits before handling open, deposit, withdraw and secret registered events, only work with enable-fork-confirm, at most %d", 2*params.ForkConfirmNumber),
+			Value: params.ForkConfirmNumber,
+		},
+		cli.IntFlag{
+			Name:  "route-retries",
+			Usage: "how many other routes a transfer tries after the first one fails, 0 means no limit",
+			Value: params.DefaultMaxRouteRetries,
+		},
+		cli.Int64Flag{
+			Name:  "route-retry-deadline",
+			Usage: "no other route is tried after this number of blocks since a transfer starts, 0 means no deadline",
+		},
+		cli.BoolFlag{
+			Name:  "target-approval",
+			Usage: "transfers to this node wait for approval through the api before the secret is requested",
+		},
+		cli.IntFlag{
+			Name:  "mediator-channel-locks",
+			Usage: "max pending locks of the partner in one channel when mediating, excess mediated transfers are disposed, 0 means reveal timeout of the channel",
+		},
+		cli.IntFlag{
+			Name:  "mediator-initiator-transfers",
+			Usage: "max mediated transfers in flight from one initiator, excess mediated transfers are disposed, 0 means no limit",
+		},
+		cli.StringFlag{
+			Name:  "backup-peer",
+			Usage: "address of another node of the same operator, encrypted channel state backups are exchanged with it periodically",
+		},
+		cli.StringFlag{
+			Name:  "selftest-echo-node",
+			Usage: "address of the echo node used by self test when no echo node is given",
+		},
+		cli.BoolFlag{
+			Name:  "echo",
+			Usage: "work as an echo node, return every self test payment to its sender",
+		},
+		cli.BoolFlag{
+			Name:  "share-network-stats",
+			Usage: "exchange anonymized token network statistics with partners that also share them",
+		},
+		cli.BoolFlag{
+			Name:  "gossip-capacity",
+			Usage: "exchange and relay approximate channel capacities with partners, so routes avoid channels without enough balance",
+		},
+		cli.IntFlag{
+			Name:  "notify-buffer-size",
+			Usage: "number of notifications buffered for each notify channel when app is not reading",
+			Value: params.NotifyBufferSize,
+		},
+		cli.StringFlag{
+			Name:  "notify-overflow-policy",
+			Usage: "what to do when notify buffer is full: drop-oldest, drop-newest or block-with-timeout",
+			Value: params.NotifyOverflowPolicy,
+		},
+		cli.StringFlag{
+			Name:  "notify-locale",
+			Usage: "language of event notification messages, zh or en, or a locale added by notify-catalog",
+			Value: params.NotifyLocale,
+		},
+		cli.StringFlag{
+			Name:  "notify-catalog",
+			Usage: "json file of notification message templates, {\"locale\":{\"event code\":\"template\"}}",
+		},
+		cli.IntFlag{
+			Name:  "notify-history-size",
+			Usage: "number of latest notifications kept in database for offline apps to catch up, 0 keeps all",
+			Value: params.NotifyHistorySize,
+		},
+		cli.StringFlag{
+			Name:  "db-sync-critical",
+			Usage: "fsync policy of channel state, balance proof and secret writes: always or periodic",
+			Value: params.DBSyncCritical,
+		},
+		cli.StringFlag{
+			Name:  "db-sync-reconstructible",
+			Usage: "fsync policy of transfer history, fee charge record and statistics writes: always, periodic or never",
+			Value: params.DBSyncReconstructible,
+		},
+		cli.BoolFlag{
+			Name:  "infinite-approve",
+			Usage: "when allowance is not enough for a deposit, approve the max amount so later deposits of this token need no approve",
+		},
+		cli.StringFlag{
+			Name:  "nat",
+			Usage: "map the udp port on the router and punch holes to partners behind NAT through the relay server. none, any, upnp, pmp, pmp:<gateway ip> or extip:<external ip>",
+			Value: "none",
+		},
+		cli.IntFlag{
+			Name:  "peer-message-rate",
+			Usage: "max messages per second received from one node, the excess is dropped. 0 means no limit",
+			Value: params.PeerMessageRate,
+		},
+		cli.IntFlag{
+			Name:  "peer-message-burst",
+			Usage: "max messages received from one node in a burst",
+			Value: params.PeerMessageBurst,
+		},
+		cli.IntFlag{
+			Name:  "peer-bytes-rate",
+			Usage: "max bytes per second received from one node",
+			Value: params.PeerBytesRate,
+		},
+		cli.IntFlag{
+			Name:  "peer-ban-threshold",
+			Usage: "ban a node after dropping this many of its messages within one minute",
+			Value: params.PeerBanThreshold,
+		},
+		cli.IntFlag{
+			Name:  "peer-ban-seconds",
+			Usage: "drop all messages of a banned node for this many seconds",
+			Value: int(params.PeerBanDuration / time.Second),
+		},
+		cli.IntFlag{
+			Name:  "sealed-frame-rate",
+			Usage: "max encrypted messages per second received from all nodes before decryption, the excess is dropped. 0 means no limit",
+			Value: params.SealedFrameRate,
+		},
+		cli.IntFlag{
+			Name:  "send-concurrency",
+			Usage: "max messages handed to the transport at the same time, the others wait by priority",
+			Value: params.SendConcurrency,
+		},
+		cli.IntFlag{
+			Name:  "send-priority-aging-ms",
+			Usage: "a waiting message moves up one priority after this many milliseconds, 0 means never",
+			Value: int(params.SendPriorityAging / time.Millisecond),
+		},
+		cli.StringFlag{
+			Name:  "mailbox",
+			Usage: "url of a mailbox service. messages to offline nodes are also encrypted and deposited there, and messages to this node are fetched from there periodically",
+		},
+		cli.IntFlag{
+			Name:  "mailbox-poll-seconds",
+			Usage: "how often to fetch messages from the mailbox",
+			Value: int(params.MailboxPollInterval / time.Second),
+		},
+		cli.BoolFlag{
+			Name:  "transport-encryption",
+			Usage: "encrypt messages to other nodes with their public keys, so relay servers on the path cannot read amounts, secrets or balance proofs. the partners must be able to decrypt them",
+		},
+		cli.BoolFlag{
+			Name:  "watch-mempool",
+			Usage: "watch pending transactions of eth rpc server, warn and stop new transfers as soon as partner's close channel tx is broadcast. needs a websocket or ipc eth-rpc-endpoint",
+		},
+		cli.StringFlag{
+			Name:  "webhook-url",
+			Usage: "comma separated urls, POST json notifications of sent transfers, received transfers and channel status to them",
+		},
+		cli.StringFlag{
+			Name:  "webhook-secret",
+			Usage: "sign webhook requests with HMAC-SHA256 using this secret, the signature is in header X-Photon-Signature",
+		},
+		cli.StringFlag{
+			Name:  "capture-file",
+			Usage: "append raw messages sent to and received from capture-peer to this file, for debugging interop problems",
+		},
+		cli.StringFlag{
+			Name:  "capture-peer",
+			Usage: "comma separated addresses of nodes whose messages are captured, default is all nodes",
+		},
+		cli.StringFlag{
+			Name:  "replay-capture",
+			Usage: "do not connect to any node, replay messages received in this capture file instead. messages sent are saved to the file with suffix .replayed",
+		},
+		cli.StringFlag{
+			Name:  "extension-plugin",
+			Usage: "go plugin file implementing custom transfer acceptance, fee, route filtering and notification policies",
+		},
+		cli.StringFlag{
+			Name:  "extension-sidecar",
+			Usage: "url of a sidecar process implementing custom transfer acceptance, fee, route filtering and notification policies over http",
+		},
+		cli.StringFlag{
+			Name:  "mediation-fee",
+			Usage: "comma separated default mediation fee of tokens, token:constant:percent, fee is constant + amount/percent",
+		},
+		cli.StringFlag{
+			Name:  "monitoring-service-url",
+			Usage: "url of the monitoring service, latest balance proofs can be delegated to it before going offline",
+		},
+		cli.StringFlag{
+			Name:  "monitoring-service-address",
+			Usage: "the account that monitoring service uses to send update transfer and unlock tx",
+		},
+		cli.StringFlag{
+			Name:  "monitoring-reward",
+			Usage: "reward paid to monitoring service for each delegation, constant:percent, reward is constant + (transfer amount + locked amount)/percent",
+			Value: "0:0",
+		},
+		cli.StringFlag{
+			Name:  "api-profile",
+			Usage: "which http api are exposed, full or mediator. mediator only exposes monitoring and fee configuration api, no transfer or channel close",
+			Value: params.APIProfileFull,
+		},
 		cli.StringFlag{
 			Name:  "http-username",
 			Usage: "the username needed when call http api,only work with http-password",
@@ -182,6 +417,18 @@ func StartMain() (*photon.API, error) {
 			Name:  "http-password",
 			Usage: "the password needed when call http api,only work with http-username",
 		},
+		cli.StringFlag{
+			Name:  "http-api-key",
+			Usage: "the api key needed when call http api, sent in header X-API-Key or Authorization: Bearer",
+		},
+		cli.StringFlag{
+			Name:  "ipc-path",
+			Usage: "serve json-rpc api on this unix socket(named pipe on windows)",
+		},
+		cli.BoolFlag{
+			Name:  "stdio-rpc",
+			Usage: "serve json-rpc api on stdin/stdout instead of http api, photon quits when stdin is closed",
+		},
 		cli.StringFlag{
 			Name:  "db",
 			Usage: "use --db=gkv when need photon run with gkvdb,default db is boltdb,photon doesn't support change db type once db is created.",
@@ -205,6 +452,10 @@ func StartMain() (*photon.API, error) {
 			Name:  "debug-udp-only",
 			Usage: "for test only",
 		},
+		cli.Int64Flag{
+			Name:  "debug-random-seed",
+			Usage: "for test only, generate secrets and random ids from this seed so that a run can be reproduced",
+		},
 	}
 	app.Flags = append(app.Flags, debug.Flags...)
 	app.Action = mainCtx
@@ -236,7 +487,7 @@ func mainCtx(ctx *cli.Context) (err error) {
 		return
 	}
 	// connect to blockchain
-	client, err := helper.NewSafeClient(cfg.EthRPCEndPoint)
+	client, err := helper.NewSafeClient(cfg.EthRPCEndPoint, cfg.EthRPCBackupEndPoints...)
 	if err != nil {
 		err = fmt.Errorf("cannot connect to geth :%s err=%s", cfg.EthRPCEndPoint, err)
 		err = nil
@@ -349,6 +600,23 @@ func mainCtx(ctx *cli.Context) (err error) {
 	}
 	api = photon.NewPhotonAPI(service)
 	regQuitHandler(api)
+	if cfg.IPCPath != "" {
+		_, err = jsonrpc.StartIPC(api, cfg.IPCPath)
+		if err != nil {
+			log.Error(fmt.Sprintf("start json-rpc on %s error %s", cfg.IPCPath, err))
+			api.Stop()
+			return
+		}
+	}
+	if cfg.StdioRPC {
+		err = jsonrpc.ServeStdio(api)
+		if err != nil {
+			log.Error(fmt.Sprintf("json-rpc on stdio error %s", err))
+		}
+		api.Stop()
+		utils.SystemExit(0)
+		return
+	}
 	if params.MobileMode {
 		if cfg.APIHost == "0.0.0.0" {
 			log.Info("start http server for test only...")
@@ -362,6 +630,9 @@ func mainCtx(ctx *cli.Context) (err error) {
 	return nil
 }
 func buildTransport(cfg *params.Config, bcs *rpc.BlockChainService) (transport network.Transporter, err error) {
+	if params.ReplayCaptureFile != "" {
+		return buildReplayTransport(params.ReplayCaptureFile)
+	}
 	/*
 		use ice and doesn't work as route node,means this node runs  on a mobile phone.
 	*/
@@ -371,6 +642,7 @@ func buildTransport(cfg *params.Config, bcs *rpc.BlockChainService) (transport n
 	switch cfg.NetworkMode {
 	case params.NoNetwork:
 		params.EnableMDNS = false
+		params.NAT = "none"
 		policy := network.NewTokenBucket(10, 1, time.Now)
 		transport, err = network.NewUDPTransport(bcs.NodeAddress.String(), "127.0.0.1", cfg.Port, nil, policy)
 		return
@@ -394,9 +666,33 @@ func buildTransport(cfg *params.Config, bcs *rpc.BlockChainService) (transport n
 			deviceType = network.DeviceTypeMobile
 		}
 		transport, err = network.NewMatrixMixTransporter(bcs.NodeAddress.String(), cfg.Host, cfg.Port, bcs.PrivKey, nil, policy, deviceType)
+	case params.CustomTransports:
+		log.Trace(fmt.Sprintf("use transports %s", params.Transports))
+		transport, err = network.NewTransport(params.Transports, bcs.NodeAddress.String(), bcs.PrivKey, cfg)
 	}
 	return
 }
+/*
+buildReplayTransport 重放capture文件中收到的消息,发出的消息保存到同名加.replayed后缀的文件中
+*/
+func buildReplayTransport(path string) (transport network.Transporter, err error) {
+	params.EnableMDNS = false
+	frames, err := network.ReadCaptureFile(path)
+	if err == io.ErrUnexpectedEOF {
+		log.Warn(fmt.Sprintf("capture file %s is truncated, replay the first %d messages", path, len(frames)))
+		err = nil
+	}
+	if err != nil {
+		return
+	}
+	output, err := network.NewCaptureWriter(path+".replayed", nil)
+	if err != nil {
+		return
+	}
+	log.Info(fmt.Sprintf("replay %d messages in capture file %s", len(frames), path))
+	return network.NewReplayTransport(frames, output), nil
+}
+
 func regQuitHandler(api *photon.API) {
 	go func() {
 		defer rpanic.PanicRecover("regQuitHandler")
@@ -411,6 +707,14 @@ func regQuitHandler(api *photon.API) {
 func config(ctx *cli.Context) (config *params.Config, err error) {
 	config = &params.DefaultConfig
 	config.EthRPCEndPoint = ctx.String("eth-rpc-endpoint")
+	if ctx.IsSet("eth-rpc-backup-endpoints") {
+		for _, endpoint := range strings.Split(ctx.String("eth-rpc-backup-endpoints"), ",") {
+			endpoint = strings.TrimSpace(endpoint)
+			if endpoint != "" {
+				config.EthRPCBackupEndPoints = append(config.EthRPCBackupEndPoints, endpoint)
+			}
+		}
+	}
 
 	listenhost, listenport, err := net.SplitHostPort(ctx.String("listen-address"))
 	if err != nil {
@@ -481,6 +785,12 @@ func config(ctx *cli.Context) (config *params.Config, err error) {
 	config.IgnoreMediatedNodeRequest = ctx.Bool("ignore-mediatednode-request")
 	if ctx.Bool("debug-nonetwork") {
 		config.NetworkMode = params.NoNetwork
+	} else if ctx.IsSet("transports") {
+		config.NetworkMode = params.CustomTransports
+		params.Transports = nil
+		for _, t := range strings.Split(ctx.String("transports"), ",") {
+			params.Transports = append(params.Transports, strings.TrimSpace(t))
+		}
 	} else if ctx.Bool("debug-udp-only") {
 		config.NetworkMode = params.UDPOnly
 	} else if ctx.Bool("matrix") {
@@ -508,15 +818,215 @@ func config(ctx *cli.Context) (config *params.Config, err error) {
 		}
 	}
 	config.PfsHost = ctx.String("pfs")
+	config.PfsRouting = ctx.Bool("pfs-routing")
+	if ctx.IsSet("pfs-address") {
+		params.PfsAddress, err = utils.HexToAddress(ctx.String("pfs-address"))
+		if err != nil {
+			err = fmt.Errorf("invalid pfs-address %s: %s", ctx.String("pfs-address"), err)
+			return
+		}
+	}
+	fee, ok := new(big.Int).SetString(ctx.String("pfs-query-fee"), 10)
+	if !ok || fee.Sign() < 0 {
+		err = fmt.Errorf("invalid pfs-query-fee %s", ctx.String("pfs-query-fee"))
+		return
+	}
+	params.PfsQueryFee = fee
+	if fee.Sign() > 0 && params.PfsAddress == utils.EmptyAddress {
+		err = fmt.Errorf("arg pfs-query-fee needs pfs-address")
+		return
+	}
 
 	if ctx.Bool("enable-fork-confirm") {
 		log.Info("fork-confirm enable...")
 		params.EnableForkConfirm = true
 	}
+	config.ForkConfirmBlocks = ctx.Int64("fork-confirm-blocks")
+	//未确认的事件只在重新扫描的范围内才能再次查询到
+	if config.ForkConfirmBlocks <= 0 || config.ForkConfirmBlocks > 2*params.ForkConfirmNumber {
+		err = fmt.Errorf("arg fork-confirm-blocks must > 0 and <= %d", 2*params.ForkConfirmNumber)
+		return
+	}
+	config.MaxRouteRetries = ctx.Int("route-retries")
+	config.RouteRetryDeadline = ctx.Int64("route-retry-deadline")
+	if config.MaxRouteRetries < 0 || config.RouteRetryDeadline < 0 {
+		err = fmt.Errorf("arg route-retries and route-retry-deadline must >= 0")
+		return
+	}
+	config.TargetApproval = ctx.Bool("target-approval")
+	config.MaxMediatedChannelLocks = ctx.Int("mediator-channel-locks")
+	config.MaxMediatedPerInitiator = ctx.Int("mediator-initiator-transfers")
+	if config.MaxMediatedChannelLocks < 0 || config.MaxMediatedPerInitiator < 0 {
+		err = fmt.Errorf("arg mediator-channel-locks and mediator-initiator-transfers must >= 0")
+		return
+	}
+	if ctx.IsSet("backup-peer") {
+		config.StateBackupPeer, err = utils.HexToAddress(ctx.String("backup-peer"))
+		if err != nil {
+			err = fmt.Errorf("arg backup-peer err %s", err)
+			return
+		}
+	}
+	if ctx.IsSet("selftest-echo-node") {
+		config.SelfTestEchoNode, err = utils.HexToAddress(ctx.String("selftest-echo-node"))
+		if err != nil {
+			err = fmt.Errorf("arg selftest-echo-node err %s", err)
+			return
+		}
+	}
+	config.EchoNode = ctx.Bool("echo")
+	config.ShareNetworkStats = ctx.Bool("share-network-stats")
+	config.GossipCapacity = ctx.Bool("gossip-capacity")
+	params.NotifyBufferSize = ctx.Int("notify-buffer-size")
+	if params.NotifyBufferSize <= 0 {
+		err = fmt.Errorf("arg notify-buffer-size must > 0")
+		return
+	}
+	_, err = notify.ParseOverflowPolicy(ctx.String("notify-overflow-policy"))
+	if err != nil {
+		return
+	}
+	params.NotifyOverflowPolicy = ctx.String("notify-overflow-policy")
+	if ctx.IsSet("notify-catalog") {
+		err = notify.LoadCatalogFile(ctx.String("notify-catalog"))
+		if err != nil {
+			return
+		}
+	}
+	if !notify.HasLocale(ctx.String("notify-locale")) {
+		err = fmt.Errorf("no notification messages for locale %s", ctx.String("notify-locale"))
+		return
+	}
+	params.NotifyLocale = ctx.String("notify-locale")
+	params.NotifyHistorySize = ctx.Int("notify-history-size")
+	if params.NotifyHistorySize < 0 {
+		err = fmt.Errorf("arg notify-history-size must >= 0")
+		return
+	}
+	_, err = models.ParseSyncPolicy(models.WriteClassCritical, ctx.String("db-sync-critical"))
+	if err != nil {
+		return
+	}
+	params.DBSyncCritical = ctx.String("db-sync-critical")
+	_, err = models.ParseSyncPolicy(models.WriteClassReconstructible, ctx.String("db-sync-reconstructible"))
+	if err != nil {
+		return
+	}
+	params.DBSyncReconstructible = ctx.String("db-sync-reconstructible")
+	params.WatchMempool = ctx.Bool("watch-mempool")
+	params.InfiniteApprove = ctx.Bool("infinite-approve")
+	params.TransportEncryption = ctx.Bool("transport-encryption")
+	params.PeerMessageRate = ctx.Int("peer-message-rate")
+	params.PeerMessageBurst = ctx.Int("peer-message-burst")
+	params.PeerBytesRate = ctx.Int("peer-bytes-rate")
+	params.PeerBanThreshold = ctx.Int("peer-ban-threshold")
+	if params.PeerMessageRate < 0 || params.PeerMessageBurst <= 0 || params.PeerBytesRate <= 0 || params.PeerBanThreshold <= 0 || ctx.Int("peer-ban-seconds") < 0 {
+		err = fmt.Errorf("arg peer-message-rate must >= 0, peer-message-burst, peer-bytes-rate and peer-ban-threshold must > 0, peer-ban-seconds must >= 0")
+		return
+	}
+	params.PeerBanDuration = time.Duration(ctx.Int("peer-ban-seconds")) * time.Second
+	params.SealedFrameRate = ctx.Int("sealed-frame-rate")
+	if params.SealedFrameRate < 0 {
+		err = fmt.Errorf("arg sealed-frame-rate must >= 0")
+		return
+	}
+	if ctx.Int("send-concurrency") <= 0 || ctx.Int("send-priority-aging-ms") < 0 {
+		err = fmt.Errorf("arg send-concurrency must > 0 and send-priority-aging-ms must >= 0")
+		return
+	}
+	params.SendConcurrency = ctx.Int("send-concurrency")
+	params.SendPriorityAging = time.Duration(ctx.Int("send-priority-aging-ms")) * time.Millisecond
+	if ctx.IsSet("mailbox") {
+		_, err = url.ParseRequestURI(ctx.String("mailbox"))
+		if err != nil {
+			err = fmt.Errorf("invalid mailbox %s: %s", ctx.String("mailbox"), err)
+			return
+		}
+		params.MailboxURL = ctx.String("mailbox")
+	}
+	if ctx.Int("mailbox-poll-seconds") <= 0 {
+		err = fmt.Errorf("arg mailbox-poll-seconds must > 0")
+		return
+	}
+	params.MailboxPollInterval = time.Duration(ctx.Int("mailbox-poll-seconds")) * time.Second
+	_, err = nat.Parse(ctx.String("nat"))
+	if err != nil {
+		err = fmt.Errorf("arg nat err %s", err)
+		return
+	}
+	params.NAT = ctx.String("nat")
+	if ctx.IsSet("webhook-url") {
+		for _, u := range strings.Split(ctx.String("webhook-url"), ",") {
+			_, err = url.ParseRequestURI(u)
+			if err != nil {
+				err = fmt.Errorf("invalid webhook-url %s: %s", u, err)
+				return
+			}
+			params.WebhookURLs = append(params.WebhookURLs, u)
+		}
+	}
+	params.WebhookSecret = ctx.String("webhook-secret")
+	params.CaptureFile = ctx.String("capture-file")
+	if ctx.IsSet("capture-peer") {
+		for _, a := range strings.Split(ctx.String("capture-peer"), ",") {
+			var addr common.Address
+			addr, err = utils.HexToAddress(strings.TrimSpace(a))
+			if err != nil {
+				err = fmt.Errorf("invalid capture-peer %s: %s", a, err)
+				return
+			}
+			params.CapturePeers = append(params.CapturePeers, addr)
+		}
+	}
+	params.ReplayCaptureFile = ctx.String("replay-capture")
+	if ctx.IsSet("mediation-fee") {
+		params.MediationFeeSchedule, err = photon.ParseMediationFeeSchedule(ctx.String("mediation-fee"))
+		if err != nil {
+			return
+		}
+	}
+	if ctx.IsSet("monitoring-service-url") {
+		params.MonitoringServiceURL = ctx.String("monitoring-service-url")
+		_, err = url.ParseRequestURI(params.MonitoringServiceURL)
+		if err != nil {
+			err = fmt.Errorf("invalid monitoring-service-url %s: %s", params.MonitoringServiceURL, err)
+			return
+		}
+		params.MonitoringServiceAddress, err = utils.HexToAddress(ctx.String("monitoring-service-address"))
+		if err != nil {
+			err = fmt.Errorf("invalid monitoring-service-address %s: %s", ctx.String("monitoring-service-address"), err)
+			return
+		}
+	}
+	params.MonitoringReward, err = photon.ParseMonitoringReward(ctx.String("monitoring-reward"))
+	if err != nil {
+		return
+	}
+	params.ExtensionPlugin = ctx.String("extension-plugin")
+	params.ExtensionSidecar = ctx.String("extension-sidecar")
+	if params.ExtensionPlugin != "" && params.ExtensionSidecar != "" {
+		err = fmt.Errorf("arg extension-plugin and extension-sidecar cannot be used together")
+		return
+	}
+	if params.ExtensionSidecar != "" {
+		_, err = url.ParseRequestURI(params.ExtensionSidecar)
+		if err != nil {
+			err = fmt.Errorf("invalid extension-sidecar %s: %s", params.ExtensionSidecar, err)
+			return
+		}
+	}
+	config.APIProfile = ctx.String("api-profile")
+	if config.APIProfile != params.APIProfileFull && config.APIProfile != params.APIProfileMediator {
+		err = fmt.Errorf("arg api-profile must be %s or %s", params.APIProfileFull, params.APIProfileMediator)
+		return
+	}
 	if ctx.IsSet("http-username") && ctx.IsSet("http-password") {
 		config.HTTPUsername = ctx.String("http-username")
 		config.HTTPPassword = ctx.String("http-password")
 	}
+	config.HTTPAPIKey = ctx.String("http-api-key")
+	config.IPCPath = ctx.String("ipc-path")
+	config.StdioRPC = ctx.Bool("stdio-rpc")
 	mi := ctx.String("debug-mdns-interval")
 	dur, err := time.ParseDuration(mi)
 	if err != nil {
@@ -533,6 +1043,11 @@ func config(ctx *cli.Context) (config *params.Config, err error) {
 	}
 	params.DefaultMDNSKeepalive = dur
 	mdns.ServiceTag = ctx.String("debug-mdns-servicetag")
+	if ctx.IsSet("debug-random-seed") {
+		seed := ctx.Int64("debug-random-seed")
+		log.Warn(fmt.Sprintf("deterministic mode, random seed=%d, secrets are predictable, never use it in production", seed))
+		utils.SetRandomSeed(seed)
+	}
 	return
 }
 
@@ -562,7 +1077,11 @@ func getPrivateKey(ctx *cli.Context) (privateKey *ecdsa.PrivateKey, err error) {
 	}
 	var keyBin []byte
 	address := common.HexToAddress(ctx.String("address"))
-	address, keyBin, err = accounts.PromptAccount(address, ctx.String("keystore-path"), ctx.String("password-file"))
+	if ctx.IsSet("hd-keystore") {
+		address, keyBin, err = accounts.PromptHDAccount(address, ctx.String("hd-keystore"), ctx.String("hd-path"), ctx.Int("hd-account-count"), ctx.String("password-file"))
+	} else {
+		address, keyBin, err = accounts.PromptAccount(address, ctx.String("keystore-path"), ctx.String("password-file"))
+	}
 	if err != nil {
 		return
 	}
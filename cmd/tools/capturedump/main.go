@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/SmartMeshFoundation/Photon/network"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"gopkg.in/urfave/cli.v1"
+)
+
+/*
+capturedump 查看photon --capture-file记录的消息,以及比较--replay-capture重放时发出的消息和现场是否一致
+*/
+func main() {
+	app := cli.NewApp()
+	app.Name = "capturedump"
+	app.Usage = "decode messages in photon capture files"
+	app.Version = "0.1"
+	app.Commands = []cli.Command{
+		{
+			Name:      "dump",
+			Usage:     "decode and print every message in a capture file",
+			ArgsUsage: "<capture file>",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "peer", Usage: "only print messages of this node"},
+				cli.BoolFlag{Name: "raw", Usage: "also print raw bytes of every message"},
+			},
+			Action: dump,
+		},
+		{
+			Name:      "compare",
+			Usage:     "compare messages sent in a capture file with messages sent when replaying it",
+			ArgsUsage: "<capture file> <replayed file>",
+			Action:    compare,
+		},
+	}
+	err := app.Run(os.Args)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+//readFrames 文件最后一帧不完整时只给出警告
+func readFrames(path string) ([]*network.CapturedFrame, error) {
+	frames, err := network.ReadCaptureFile(path)
+	if err == io.ErrUnexpectedEOF {
+		fmt.Printf("warning: %s is truncated\n", path)
+		err = nil
+	}
+	return frames, err
+}
+
+func dump(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("need a capture file")
+	}
+	frames, err := readFrames(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	var peer common.Address
+	if ctx.IsSet("peer") {
+		peer, err = utils.HexToAddress(ctx.String("peer"))
+		if err != nil {
+			return err
+		}
+	}
+	for i, f := range frames {
+		if peer != utils.EmptyAddress && f.Peer != peer {
+			continue
+		}
+		fmt.Printf("%d %s %-3s %s %s\n", i, f.Time.Format("2006-01-02 15:04:05.000"), f.Direction, f.Peer.String(), describe(f.Data))
+		if ctx.Bool("raw") {
+			fmt.Print(hex.Dump(f.Data))
+		}
+	}
+	return nil
+}
+
+func describe(data []byte) string {
+	msg, err := network.DecodeMessage(data)
+	if err != nil {
+		return fmt.Sprintf("invalid message: %s", err)
+	}
+	return msg.String()
+}
+
+func frameKey(f *network.CapturedFrame) string {
+	return f.Peer.String() + string(f.Data)
+}
+
+//outboundSet 所有发出的消息,重发的消息内容相同,只算一条
+func outboundSet(frames []*network.CapturedFrame) map[string]bool {
+	m := make(map[string]bool)
+	for _, f := range frames {
+		if f.Direction == network.CaptureOutbound {
+			m[frameKey(f)] = true
+		}
+	}
+	return m
+}
+
+/*
+compare 只比较发出的消息是否出现过,不比较次数和顺序,因为重发的次数取决于对方回复ack的时间
+*/
+func compare(ctx *cli.Context) error {
+	if ctx.NArg() != 2 {
+		return fmt.Errorf("need a capture file and a replayed file")
+	}
+	captured, err := readFrames(ctx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	replayed, err := readFrames(ctx.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	capturedSet, replayedSet := outboundSet(captured), outboundSet(replayed)
+	diff := 0
+	printMissing := func(title string, frames []*network.CapturedFrame, other map[string]bool) {
+		printed := make(map[string]bool)
+		for _, f := range frames {
+			key := frameKey(f)
+			if f.Direction != network.CaptureOutbound || other[key] || printed[key] {
+				continue
+			}
+			printed[key] = true
+			diff++
+			fmt.Printf("%s to %s: %s\n", title, f.Peer.String(), describe(f.Data))
+		}
+	}
+	printMissing("only captured", captured, replayedSet)
+	printMissing("only replayed", replayed, capturedSet)
+	fmt.Printf("%d different messages\n", diff)
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/SmartMeshFoundation/Photon/accounts"
+	ethaccounts "github.com/ethereum/go-ethereum/accounts"
+	"github.com/howeyc/gopass"
+	"gopkg.in/urfave/cli.v1"
+)
+
+/*
+hdkeystore 创建photon使用的HD keystore,以及列出从中派生的账户
+*/
+func main() {
+	app := cli.NewApp()
+	app.Name = "hdkeystore"
+	app.Usage = "create hd keystore for photon --hd-keystore and list derived accounts"
+	app.Version = "0.1"
+	app.Commands = []cli.Command{
+		{
+			Name:  "new",
+			Usage: "encrypt the seed of a BIP39 mnemonic or a hex seed into an hd keystore file",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "hd-keystore", Usage: "hd keystore file to create"},
+				cli.StringFlag{Name: "mnemonic-file", Usage: "file contains the BIP39 mnemonic"},
+				cli.StringFlag{Name: "mnemonic-passphrase", Usage: "optional BIP39 passphrase"},
+				cli.StringFlag{Name: "seed", Usage: "hex encoded seed, used when mnemonic-file is not given"},
+				cli.StringFlag{Name: "password-file", Usage: "file contains the password to encrypt the seed"},
+			},
+			Action: newHDKeystore,
+		},
+		{
+			Name:  "list",
+			Usage: "list accounts derived from an hd keystore",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "hd-keystore", Usage: "hd keystore file"},
+				cli.StringFlag{Name: "hd-path", Usage: "base derivation path", Value: accounts.DefaultHDBasePath},
+				cli.IntFlag{Name: "hd-account-count", Usage: "how many accounts to list", Value: 10},
+				cli.StringFlag{Name: "password-file", Usage: "file contains the password of hd keystore"},
+			},
+			Action: listHDAccounts,
+		},
+	}
+	err := app.Run(os.Args)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func readPassword(ctx *cli.Context) (string, error) {
+	if ctx.IsSet("password-file") {
+		data, err := ioutil.ReadFile(ctx.String("password-file"))
+		return string(data), err
+	}
+	pb, err := gopass.GetPasswdPrompt("Enter the password:", false, os.Stdin, os.Stdout)
+	return string(pb), err
+}
+
+func newHDKeystore(ctx *cli.Context) error {
+	var seed []byte
+	var err error
+	if ctx.IsSet("mnemonic-file") {
+		var data []byte
+		data, err = ioutil.ReadFile(ctx.String("mnemonic-file"))
+		if err != nil {
+			return err
+		}
+		seed = accounts.SeedFromMnemonic(string(data), ctx.String("mnemonic-passphrase"))
+	} else {
+		seed, err = hex.DecodeString(strings.TrimPrefix(ctx.String("seed"), "0x"))
+		if err != nil {
+			return err
+		}
+	}
+	password, err := readPassword(ctx)
+	if err != nil {
+		return err
+	}
+	err = accounts.StoreSeed(ctx.String("hd-keystore"), seed, password)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("hd keystore %s created\n", ctx.String("hd-keystore"))
+	return nil
+}
+
+func listHDAccounts(ctx *cli.Context) error {
+	data, err := ioutil.ReadFile(ctx.String("hd-keystore"))
+	if err != nil {
+		return err
+	}
+	password, err := readPassword(ctx)
+	if err != nil {
+		return err
+	}
+	seed, err := accounts.DecryptSeed(data, password)
+	if err != nil {
+		return err
+	}
+	base, err := ethaccounts.ParseDerivationPath(ctx.String("hd-path"))
+	if err != nil {
+		return err
+	}
+	accs, err := accounts.DeriveAccounts(seed, base, ctx.Int("hd-account-count"))
+	if err != nil {
+		return err
+	}
+	for _, acc := range accs {
+		fmt.Printf("%3d -  %s %s\n", acc.Index, acc.Address.String(), acc.Path)
+	}
+	return nil
+}
@@ -124,6 +124,7 @@ func NewTestDB(dbPath string) (dao models.Dao) {
 		dbPath = path.Join(os.TempDir(), "testxxxx.db")
 		err := os.RemoveAll(dbPath)
 		err = os.RemoveAll(dbPath + ".lock")
+		err = os.RemoveAll(dbPath + ".history")
 		if err != nil {
 			fmt.Println(err)
 		}
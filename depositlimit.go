@@ -0,0 +1,66 @@
+package photon
+
+import (
+	"math/big"
+
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+)
+
+/*
+存款前在本地检查合约的限制,避免发出注定会被合约拒绝的交易.
+这个版本的TokensNetwork合约没有可以查询的存款上限,它实际的限制是:
+1. settle timeout必须在params.ChannelSettleTimeoutMin和params.ChannelSettleTimeoutMax之间
+2. 取现和结算时把双方的存款相加,超过uint256就会溢出,所以双方的存款之和不能超过uint256的最大值
+*/
+
+//maxUint256 合约中金额的最大值
+var maxUint256 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+//DepositLimit 是ErrChannelDepositLimit附带的数据
+type DepositLimit struct {
+	MaxDeposit *big.Int `json:"max_deposit"` //这个通道还能存入的最大金额
+}
+
+/*
+channelDepositLimit 通道还能存入的最大金额,`ch`为nil表示新建通道
+*/
+func channelDepositLimit(ch *channeltype.Serialization) *big.Int {
+	limit := new(big.Int).Set(maxUint256)
+	if ch == nil {
+		return limit
+	}
+	if ch.OurContractBalance != nil {
+		limit.Sub(limit, ch.OurContractBalance)
+	}
+	if ch.PartnerContractBalance != nil {
+		limit.Sub(limit, ch.PartnerContractBalance)
+	}
+	if limit.Sign() < 0 {
+		limit.SetInt64(0)
+	}
+	return limit
+}
+
+/*
+checkDepositLimit 超过通道还能存入的最大金额时返回ErrChannelDepositLimit,附带允许的最大金额
+*/
+func checkDepositLimit(ch *channeltype.Serialization, deposit *big.Int) error {
+	limit := channelDepositLimit(ch)
+	if deposit.Cmp(limit) > 0 {
+		return rerr.ErrChannelDepositLimit.Printf("deposit %s exceeds allowed maximum %s", deposit, limit).WithData(&DepositLimit{MaxDeposit: limit})
+	}
+	return nil
+}
+
+//checkSettleTimeout 新建通道时settle timeout必须大于reveal timeout,并且在合约允许的范围内
+func checkSettleTimeout(settleTimeout, revealTimeout int) error {
+	if settleTimeout <= revealTimeout {
+		return rerr.ErrChannelInvalidSttleTimeout
+	}
+	if settleTimeout < params.ChannelSettleTimeoutMin || settleTimeout > params.ChannelSettleTimeoutMax {
+		return rerr.ErrChannelInvalidSttleTimeout.Printf("settle timeout must be between %d and %d", params.ChannelSettleTimeoutMin, params.ChannelSettleTimeoutMax)
+	}
+	return nil
+}
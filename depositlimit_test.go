@@ -0,0 +1,38 @@
+package photon
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckDepositLimit(t *testing.T) {
+	assert.Nil(t, checkDepositLimit(nil, maxUint256))
+	assert.NotNil(t, checkDepositLimit(nil, new(big.Int).Add(maxUint256, big.NewInt(1))))
+	ch := channeltype.NewEmptySerialization()
+	ch.OurContractBalance = big.NewInt(100)
+	ch.PartnerContractBalance = big.NewInt(50)
+	limit := new(big.Int).Sub(maxUint256, big.NewInt(150))
+	assert.Equal(t, limit, channelDepositLimit(ch))
+	assert.Nil(t, checkDepositLimit(ch, limit))
+	err := checkDepositLimit(ch, new(big.Int).Add(limit, big.NewInt(1)))
+	if assert.IsType(t, rerr.StandardDataError{}, err) {
+		e := err.(rerr.StandardDataError)
+		assert.Equal(t, rerr.ErrChannelDepositLimit.ErrorCode, e.ErrorCode)
+		assert.Contains(t, string(e.Data), limit.String())
+	}
+	ch.OurContractBalance = maxUint256
+	assert.EqualValues(t, 0, channelDepositLimit(ch).Int64())
+}
+
+func TestCheckSettleTimeout(t *testing.T) {
+	assert.Nil(t, checkSettleTimeout(100, 30))
+	assert.NotNil(t, checkSettleTimeout(30, 30))
+	assert.NotNil(t, checkSettleTimeout(params.ChannelSettleTimeoutMin-1, 0))
+	assert.Nil(t, checkSettleTimeout(params.ChannelSettleTimeoutMax, 30))
+	assert.NotNil(t, checkSettleTimeout(params.ChannelSettleTimeoutMax+1, 30))
+}
@@ -5,8 +5,10 @@ import (
 	"encoding/binary"
 
 	"crypto/ecdsa"
+	"crypto/rand"
 
 	"math/big"
+	"net"
 
 	"errors"
 	"fmt"
@@ -24,6 +26,7 @@ import (
 	"github.com/SmartMeshFoundation/Photon/utils"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
 )
 
 // MessageVersionControlMap 保存每个消息支持的最低版本号
@@ -31,6 +34,9 @@ var MessageVersionControlMap = map[int16]int16{
 	MediatedTransferCmdID: int16(1), // 2019-03 MediatedTransfer消息升级,带上了Path,不兼容verison<1的版本
 }
 
+// MediatedTransferPaymentVersion 带上PaymentID和Invoice的MediatedTransfer版本号,两者都为空时仍按version 1发送,保证和老节点兼容
+const MediatedTransferPaymentVersion = int16(2)
+
 //MessageType is the type of message for receive and send
 type MessageType int
 
@@ -79,8 +85,76 @@ const (
 	*/
 	// Respond Refund
 	AnnounceDisposedTransferResponseCmdID
+	/*
+		查询对方节点公开信息
+	*/
+	// Query node advertisement
+	NodeAdvertisementRequestCmdID
+	/*
+		节点公开信息响应
+	*/
+	// Respond node advertisement
+	NodeAdvertisementResponseCmdID
+	/*
+		同一运营者的节点之间交换加密的通道状态备份
+	*/
+	// Encrypted state backup between nodes of the same operator
+	StateBackupCmdID
+	/*
+		请求通道伙伴存款,增加自己可以接收的金额
+	*/
+	// Ask partner to deposit for more inbound capacity
+	InboundCapacityRequestCmdID
+	/*
+		对InboundCapacityRequest的答复
+	*/
+	// Respond inbound capacity request
+	InboundCapacityResponseCmdID
+	/*
+		同意共享统计的节点之间交换匿名的token网络统计
+	*/
+	// Anonymized token network statistics gossip
+	NetworkStatsCmdID
+	/*
+		交换通道容量,帮助路由避开余额不足的通道
+	*/
+	// Channel capacity gossip between peers
+	CapacityUpdateCmdID
+	/*
+		maker向taker提出代币交换
+	*/
+	// Token swap offer from maker to taker
+	SwapOfferCmdID
+	/*
+		taker对SwapOffer的答复
+	*/
+	// Respond token swap offer
+	SwapResponseCmdID
+	/*
+		消息已经收到,还在处理中
+	*/
+	// Message reached the peer, not processed yet
+	DeliveredCmdID
+	/*
+		用接收方公钥加密的消息,解密以后是一个普通的消息
+	*/
+	// Message encrypted to the receiver's key, wraps another message
+	SealedCmdID
+	/*
+		通过中继告诉对方自己在公网上的udp地址,用来打洞
+	*/
+	// Public UDP endpoint for hole punching, sent through the relay
+	UDPEndpointCmdID
+	/*
+		不转移任何金额,检查对方是否认可通道和双方的BalanceProof
+	*/
+	// Zero value probe of a channel, checks partner agrees on the channel state
+	ChannelProbeCmdID
 )
 
+//ProcessedCmdID 对方已经处理完消息,和Ack是同一种消息,老节点也能识别
+const ProcessedCmdID = AckCmdID
+
 const signatureLength = 65
 
 var errPacketLength = errors.New("packet length error")
@@ -214,6 +288,32 @@ func (t MessageType) String() string {
 		return "WithdrawRequest"
 	case WithdrawResponseCmdID:
 		return "WithdrawResponse"
+	case NodeAdvertisementRequestCmdID:
+		return "NodeAdvertisementRequest"
+	case NodeAdvertisementResponseCmdID:
+		return "NodeAdvertisementResponse"
+	case StateBackupCmdID:
+		return "StateBackup"
+	case InboundCapacityRequestCmdID:
+		return "InboundCapacityRequest"
+	case InboundCapacityResponseCmdID:
+		return "InboundCapacityResponse"
+	case NetworkStatsCmdID:
+		return "NetworkStats"
+	case CapacityUpdateCmdID:
+		return "CapacityUpdate"
+	case SwapOfferCmdID:
+		return "SwapOffer"
+	case SwapResponseCmdID:
+		return "SwapResponse"
+	case DeliveredCmdID:
+		return "Delivered"
+	case SealedCmdID:
+		return "Sealed"
+	case UDPEndpointCmdID:
+		return "UDPEndpoint"
+	case ChannelProbeCmdID:
+		return "ChannelProbe"
 	default:
 		return "<unknown>"
 	}
@@ -277,6 +377,164 @@ func (ack *Ack) String() string {
 	return fmt.Sprintf("Message{type=Ack sender=%s,echo=%s}", utils.APex2(ack.Sender), utils.HPex(ack.Echo))
 }
 
+/*
+Processed 对方已经处理完消息,成功改变了状态,发送方可以不再重发.
+它就是原来的Ack,为了和老节点兼容使用同样的编码
+*/
+type Processed = Ack
+
+//NewProcessed create a Processed message
+func NewProcessed(sender common.Address, echo common.Hash) *Processed {
+	return NewAck(sender, echo)
+}
+
+/*
+Delivered 收到消息以后,在处理之前立即发出,告诉发送方消息已经送达.
+发送方收到以后降低重发的频率,直到收到Processed.和Ack一样不签名
+*/
+type Delivered struct {
+	CmdStruct
+	Sender common.Address
+	Echo   common.Hash
+}
+
+//NewDelivered create a Delivered message
+func NewDelivered(sender common.Address, echo common.Hash) *Delivered {
+	return &Delivered{
+		CmdStruct: CmdStruct{CmdID: DeliveredCmdID},
+		Sender:    sender,
+		Echo:      echo,
+	}
+}
+
+//Pack implements of MessagePacker
+func (d *Delivered) Pack() []byte {
+	var err error
+	buf := new(bytes.Buffer)
+	err = d.WriteCmdStructToBuf(buf)
+	_, err = buf.Write(d.Sender[:])
+	_, err = buf.Write(d.Echo[:])
+	if err != nil {
+		log.Crit(fmt.Sprintf("Delivered Pack err %s", err))
+	}
+	return buf.Bytes()
+}
+
+//UnPack is implements of MessageUnpacker
+func (d *Delivered) UnPack(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	err := d.ReadCmdStructFromBuf(buf)
+	if err != nil {
+		return err
+	}
+	if d.CmdID != DeliveredCmdID {
+		return fmt.Errorf("Delivered Unpack cmdid should be %d,but get %d", DeliveredCmdID, d.CmdID)
+	}
+	_, err = buf.Read(d.Sender[:])
+	if err != nil {
+		return err
+	}
+	n, err := buf.Read(d.Echo[:])
+	if err != nil {
+		return err
+	}
+	if n != len(d.Echo) {
+		return errPacketLength
+	}
+	return nil
+}
+
+func (d *Delivered) String() string {
+	return fmt.Sprintf("Message{type=Delivered sender=%s,echo=%s}", utils.APex2(d.Sender), utils.HPex(d.Echo))
+}
+
+/*
+Sealed 用接收方的公钥(ECIES)加密的消息,只有接收方能解密,路径上的第三方看不到金额,密码和BalanceProof.
+Sealed本身不签名,里面的消息仍然要签名,接收方解密以后按照普通消息处理
+*/
+type Sealed struct {
+	CmdStruct
+	Data []byte //加密以后的消息
+}
+
+//SealOverhead 加密增加的长度,包括消息头,临时公钥,IV和MAC
+const SealOverhead = 4 + 65 + 16 + 32
+
+//NewSealed encrypt `data` to `receiver`
+func NewSealed(receiver *ecdsa.PublicKey, data []byte) (*Sealed, error) {
+	cipher, err := ecies.Encrypt(rand.Reader, ecies.ImportECDSAPublic(receiver), data, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Sealed{
+		CmdStruct: CmdStruct{CmdID: SealedCmdID},
+		Data:      cipher,
+	}, nil
+}
+
+//Open decrypt the wrapped message with receiver's private key
+func (s *Sealed) Open(privKey *ecdsa.PrivateKey) ([]byte, error) {
+	return ecies.ImportECDSA(privKey).Decrypt(rand.Reader, s.Data, nil, nil)
+}
+
+//Pack implements of MessagePacker
+func (s *Sealed) Pack() []byte {
+	buf := new(bytes.Buffer)
+	err := s.WriteCmdStructToBuf(buf)
+	if err != nil {
+		log.Crit(fmt.Sprintf("Sealed Pack err %s", err))
+		return nil
+	}
+	_, err = buf.Write(s.Data)
+	if err != nil {
+		log.Crit(fmt.Sprintf("Sealed Pack err %s", err))
+		return nil
+	}
+	return buf.Bytes()
+}
+
+//UnPack is implements of MessageUnpacker
+func (s *Sealed) UnPack(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	err := s.ReadCmdStructFromBuf(buf)
+	if err != nil {
+		return err
+	}
+	if s.CmdID != SealedCmdID {
+		return fmt.Errorf("Sealed Unpack cmdid should be %d,but get %d", SealedCmdID, s.CmdID)
+	}
+	if buf.Len() == 0 {
+		return errPacketLength
+	}
+	s.Data = buf.Bytes()
+	return nil
+}
+
+func (s *Sealed) String() string {
+	return fmt.Sprintf("Message{type=Sealed len=%d}", len(s.Data))
+}
+
+//RecoverPublicKey returns the public key of sender if data is a valid SignedMessage
+func RecoverPublicKey(data []byte) (*ecdsa.PublicKey, error) {
+	if len(data) <= signatureLength {
+		return nil, errPacketLength
+	}
+	messageData := data[:len(data)-signatureLength]
+	signature := make([]byte, signatureLength)
+	copy(signature, data[len(data)-signatureLength:])
+	hash := utils.Sha3(messageData)
+	signature[len(signature)-1] -= 27
+	pubkey, err := crypto.Ecrecover(hash[:], signature)
+	if err != nil {
+		return nil, err
+	}
+	key := crypto.ToECDSAPub(pubkey)
+	if key == nil || key.X == nil {
+		return nil, errors.New("invalid public key")
+	}
+	return key, nil
+}
+
 //SignedMessage is corresponding of SignedMessager
 type SignedMessage struct {
 	CmdStruct
@@ -954,13 +1212,15 @@ type MediatedTransfer struct {
 	Initiator      common.Address
 	Fee            *big.Int
 	Path           []common.Address // 2019-03 消息升级后,带全路径信息
+	PaymentID      string           // version 2,用户指定的支付ID,和LockSecretHash无关,长度不超过params.PaymentIDMaxLength
+	Invoice        []byte           // version 2,可选的发票信息,长度不超过params.InvoiceMaxLength
 }
 
 //String is fmt.Stringer
 func (m *MediatedTransfer) String() string {
-	return fmt.Sprintf("Message{type=MediatedTransfer expiration=%d,target=%s,initiator=%s,hashlock=%s,amount=%s,fee=%s,path=%s,%s}",
+	return fmt.Sprintf("Message{type=MediatedTransfer expiration=%d,target=%s,initiator=%s,hashlock=%s,amount=%s,fee=%s,path=%s,payment_id=%s,%s}",
 		m.Expiration, utils.APex2(m.Target), utils.APex2(m.Initiator),
-		utils.HPex(m.LockSecretHash), m.PaymentAmount, m.Fee, m.GetPathStr(), m.EnvelopMessage.String())
+		utils.HPex(m.LockSecretHash), m.PaymentAmount, m.Fee, m.GetPathStr(), m.PaymentID, m.EnvelopMessage.String())
 }
 
 //NewMediatedTransfer create MediatedTransfer
@@ -994,6 +1254,12 @@ func (m *MediatedTransfer) GetLock() *mtree.Lock {
 func (m *MediatedTransfer) Pack() []byte {
 	var err error
 	buf := new(bytes.Buffer)
+	// 没有支付ID和发票时按version 1打包,老节点也能处理
+	if m.hasPaymentInfo() {
+		m.Version = MediatedTransferPaymentVersion
+	} else {
+		m.Version = MessageVersionControlMap[MediatedTransferCmdID]
+	}
 	err = m.WriteCmdStructToBuf(buf)
 	//err = binary.Write(buf, binary.LittleEndian, m.CmdID) //one byte
 	//HTLC
@@ -1010,6 +1276,13 @@ func (m *MediatedTransfer) Pack() []byte {
 	for _, addr := range m.Path {
 		_, err = buf.Write(addr[:])
 	}
+	// version 2,带支付ID和发票
+	if m.Version >= MediatedTransferPaymentVersion {
+		err = utils.WriteVarInt(buf, uint64(len(m.PaymentID)))
+		_, err = buf.WriteString(m.PaymentID)
+		err = utils.WriteVarInt(buf, uint64(len(m.Invoice)))
+		_, err = buf.Write(m.Invoice)
+	}
 	m.EnvelopMessage.pack(buf)
 	if err != nil {
 		log.Crit(fmt.Sprintf("MediatedTransfer Pack err %s", err))
@@ -1046,6 +1319,13 @@ func (m *MediatedTransfer) UnPack(data []byte) error {
 		_, err = buf.Read(addr[:])
 		m.Path = append(m.Path, addr)
 	}
+	// version 2,带支付ID和发票;version 1的消息没有这两个字段,视为空
+	if m.Version >= MediatedTransferPaymentVersion {
+		err = m.unpackPaymentInfo(buf)
+		if err != nil {
+			return err
+		}
+	}
 	err = m.EnvelopMessage.unpack(buf)
 	if err != nil {
 		return err
@@ -1053,6 +1333,45 @@ func (m *MediatedTransfer) UnPack(data []byte) error {
 	return m.verifySignature(data)
 }
 
+//hasPaymentInfo 是否需要按version 2携带支付ID和发票
+func (m *MediatedTransfer) hasPaymentInfo() bool {
+	return len(m.PaymentID) > 0 || len(m.Invoice) > 0
+}
+
+//unpackPaymentInfo 读取version 2追加的支付ID和发票
+func (m *MediatedTransfer) unpackPaymentInfo(buf *bytes.Buffer) error {
+	paymentIDLen, err := utils.ReadVarInt(buf)
+	if err != nil {
+		return err
+	}
+	if paymentIDLen > uint64(params.PaymentIDMaxLength) {
+		return fmt.Errorf("MediatedTransfer unpack payment id error, too long payment id %d", paymentIDLen)
+	}
+	if paymentIDLen > 0 {
+		paymentID := make([]byte, paymentIDLen)
+		err = binary.Read(buf, binary.LittleEndian, &paymentID)
+		if err != nil {
+			return errors.New("MediatedTransfer unpack payment id error")
+		}
+		m.PaymentID = string(paymentID)
+	}
+	invoiceLen, err := utils.ReadVarInt(buf)
+	if err != nil {
+		return err
+	}
+	if invoiceLen > uint64(params.InvoiceMaxLength) {
+		return fmt.Errorf("MediatedTransfer unpack invoice error, too large invoice %d", invoiceLen)
+	}
+	if invoiceLen > 0 {
+		m.Invoice = make([]byte, invoiceLen)
+		err = binary.Read(buf, binary.LittleEndian, &m.Invoice)
+		if err != nil {
+			return errors.New("MediatedTransfer unpack invoice error")
+		}
+	}
+	return nil
+}
+
 // GetPathStr get string of path to print
 func (m *MediatedTransfer) GetPathStr() string {
 	if m.Path == nil {
@@ -1958,6 +2277,934 @@ func (m *SettleResponse) Sign(key *ecdsa.PrivateKey, msg MessagePacker) (err err
 	return
 }
 
+/*
+UDPEndpoint 节点在公网上的udp地址,来自路由器的端口映射(UPnP/NAT-PMP)或者配置的外网ip.
+通过中继发给对方,双方同时向对方的地址发包,在NAT上打开通路以后直接用udp通信
+*/
+type UDPEndpoint struct {
+	SignedMessage
+	IP   net.IP
+	Port uint16
+}
+
+//NewUDPEndpoint create UDPEndpoint
+func NewUDPEndpoint(ip net.IP, port int) *UDPEndpoint {
+	m := &UDPEndpoint{
+		IP:   ip.To16(),
+		Port: uint16(port),
+	}
+	m.CmdID = UDPEndpointCmdID
+	return m
+}
+
+//Pack is MessagePacker
+func (m *UDPEndpoint) Pack() []byte {
+	var err error
+	buf := new(bytes.Buffer)
+	err = m.WriteCmdStructToBuf(buf)
+	_, err = buf.Write(m.IP.To16())
+	err = binary.Write(buf, binary.BigEndian, m.Port)
+	_, err = buf.Write(m.Signature)
+	if err != nil {
+		log.Crit(fmt.Sprintf("UDPEndpoint Pack err %s", err))
+	}
+	return buf.Bytes()
+}
+
+//UnPack is MessageUnpacker
+func (m *UDPEndpoint) UnPack(data []byte) error {
+	var err error
+	buf := bytes.NewBuffer(data)
+	err = m.ReadCmdStructFromBuf(buf)
+	if err != nil {
+		return err
+	}
+	if m.CmdID != UDPEndpointCmdID {
+		return fmt.Errorf("UDPEndpoint unpack cmdid should be %d, but get %d", UDPEndpointCmdID, m.CmdID)
+	}
+	m.IP = make(net.IP, net.IPv6len)
+	n, err := buf.Read(m.IP)
+	if err != nil || n != net.IPv6len {
+		return errPacketLength
+	}
+	err = binary.Read(buf, binary.BigEndian, &m.Port)
+	if err != nil {
+		return err
+	}
+	m.Signature = make([]byte, signatureLength)
+	n, err = buf.Read(m.Signature)
+	if err != nil || n != signatureLength {
+		return errPacketLength
+	}
+	return m.SignedMessage.verifySignature(data)
+}
+
+//String is fmt.Stringer
+func (m *UDPEndpoint) String() string {
+	return fmt.Sprintf("Message{type=UDPEndpoint ip=%s,port=%d,sender=%s}", m.IP, m.Port, utils.APex2(m.Sender))
+}
+
+/*
+ChannelProbe 零金额的通道探测,不改变通道状态.接收方只有在通道打开,并且双方的BalanceProof nonce都一致时才回复Ack,
+所以收到Ack说明下一笔交易可以在这个通道上被对方接受.ID是随机数,避免对方用保存的Ack回复
+*/
+type ChannelProbe struct {
+	SignedMessage
+	ID                int64
+	ChannelIdentifier common.Hash
+	OpenBlockNumber   int64
+	Nonce             uint64 //发送方自己的BalanceProof nonce
+	PartnerNonce      uint64 //发送方收到的接收方的BalanceProof nonce
+}
+
+//NewChannelProbe create ChannelProbe
+func NewChannelProbe(channelIdentifier common.Hash, openBlockNumber int64, nonce, partnerNonce uint64) *ChannelProbe {
+	m := &ChannelProbe{
+		ID:                utils.NewRandomInt64(),
+		ChannelIdentifier: channelIdentifier,
+		OpenBlockNumber:   openBlockNumber,
+		Nonce:             nonce,
+		PartnerNonce:      partnerNonce,
+	}
+	m.CmdID = ChannelProbeCmdID
+	return m
+}
+
+//Pack is MessagePacker
+func (m *ChannelProbe) Pack() []byte {
+	var err error
+	buf := new(bytes.Buffer)
+	err = m.WriteCmdStructToBuf(buf)
+	err = binary.Write(buf, binary.BigEndian, m.ID)
+	_, err = buf.Write(m.ChannelIdentifier[:])
+	err = binary.Write(buf, binary.BigEndian, m.OpenBlockNumber)
+	err = binary.Write(buf, binary.BigEndian, m.Nonce)
+	err = binary.Write(buf, binary.BigEndian, m.PartnerNonce)
+	_, err = buf.Write(m.Signature)
+	if err != nil {
+		log.Crit(fmt.Sprintf("ChannelProbe Pack err %s", err))
+	}
+	return buf.Bytes()
+}
+
+//UnPack is MessageUnpacker
+func (m *ChannelProbe) UnPack(data []byte) error {
+	var err error
+	buf := bytes.NewBuffer(data)
+	err = m.ReadCmdStructFromBuf(buf)
+	if err != nil {
+		return err
+	}
+	if m.CmdID != ChannelProbeCmdID {
+		return fmt.Errorf("ChannelProbe unpack cmdid should be %d, but get %d", ChannelProbeCmdID, m.CmdID)
+	}
+	err = binary.Read(buf, binary.BigEndian, &m.ID)
+	if err != nil {
+		return err
+	}
+	n, err := buf.Read(m.ChannelIdentifier[:])
+	if err != nil || n != len(m.ChannelIdentifier) {
+		return errPacketLength
+	}
+	err = binary.Read(buf, binary.BigEndian, &m.OpenBlockNumber)
+	if err != nil {
+		return err
+	}
+	err = binary.Read(buf, binary.BigEndian, &m.Nonce)
+	if err != nil {
+		return err
+	}
+	err = binary.Read(buf, binary.BigEndian, &m.PartnerNonce)
+	if err != nil {
+		return err
+	}
+	m.Signature = make([]byte, signatureLength)
+	n, err = buf.Read(m.Signature)
+	if err != nil || n != signatureLength {
+		return errPacketLength
+	}
+	return m.SignedMessage.verifySignature(data)
+}
+
+//String is fmt.Stringer
+func (m *ChannelProbe) String() string {
+	return fmt.Sprintf("Message{type=ChannelProbe channel=%s,openblock=%d,nonce=%d,partnernonce=%d,sender=%s}",
+		utils.HPex(m.ChannelIdentifier), m.OpenBlockNumber, m.Nonce, m.PartnerNonce, utils.APex2(m.Sender))
+}
+
+//NodeAdvertisementRequest 查询对方节点自己签名的公开信息
+type NodeAdvertisementRequest struct {
+	SignedMessage
+	Nonce int64
+}
+
+//NewNodeAdvertisementRequest create NodeAdvertisementRequest
+func NewNodeAdvertisementRequest(nonce int64) *NodeAdvertisementRequest {
+	m := &NodeAdvertisementRequest{
+		Nonce: nonce,
+	}
+	m.CmdID = NodeAdvertisementRequestCmdID
+	return m
+}
+
+//Pack is MessagePacker
+func (m *NodeAdvertisementRequest) Pack() []byte {
+	var err error
+	buf := new(bytes.Buffer)
+	err = m.WriteCmdStructToBuf(buf)
+	err = binary.Write(buf, binary.BigEndian, m.Nonce)
+	_, err = buf.Write(m.Signature)
+	if err != nil {
+		log.Crit(fmt.Sprintf("NodeAdvertisementRequest Pack err %s", err))
+	}
+	return buf.Bytes()
+}
+
+//UnPack is MessageUnpacker
+func (m *NodeAdvertisementRequest) UnPack(data []byte) error {
+	var err error
+	buf := bytes.NewBuffer(data)
+	err = m.ReadCmdStructFromBuf(buf)
+	if err != nil {
+		return err
+	}
+	if m.CmdID != NodeAdvertisementRequestCmdID {
+		return fmt.Errorf("NodeAdvertisementRequest unpack cmdid should be %d, but get %d", NodeAdvertisementRequestCmdID, m.CmdID)
+	}
+	err = binary.Read(buf, binary.BigEndian, &m.Nonce)
+	if err != nil {
+		return err
+	}
+	m.Signature = make([]byte, signatureLength)
+	n, err := buf.Read(m.Signature)
+	if err != nil || n != signatureLength {
+		return errPacketLength
+	}
+	return m.SignedMessage.verifySignature(data)
+}
+
+//String is fmt.Stringer
+func (m *NodeAdvertisementRequest) String() string {
+	return fmt.Sprintf("Message{type=NodeAdvertisementRequest nonce=%d,sender=%s}", m.Nonce, utils.APex2(m.Sender))
+}
+
+//NodeAdvertisementResponse 节点公开信息响应,Data是json格式的models.NodeAdvertisement,为空表示对方没有发布
+type NodeAdvertisementResponse struct {
+	SignedMessage
+	Nonce int64 //对应请求的nonce
+	Data  []byte
+}
+
+//NewNodeAdvertisementResponse create NodeAdvertisementResponse
+func NewNodeAdvertisementResponse(nonce int64, data []byte) *NodeAdvertisementResponse {
+	m := &NodeAdvertisementResponse{
+		Nonce: nonce,
+		Data:  data,
+	}
+	m.CmdID = NodeAdvertisementResponseCmdID
+	return m
+}
+
+//Pack is MessagePacker
+func (m *NodeAdvertisementResponse) Pack() []byte {
+	var err error
+	buf := new(bytes.Buffer)
+	err = m.WriteCmdStructToBuf(buf)
+	err = binary.Write(buf, binary.BigEndian, m.Nonce)
+	err = binary.Write(buf, binary.BigEndian, uint32(len(m.Data)))
+	_, err = buf.Write(m.Data)
+	_, err = buf.Write(m.Signature)
+	if err != nil {
+		log.Crit(fmt.Sprintf("NodeAdvertisementResponse Pack err %s", err))
+	}
+	return buf.Bytes()
+}
+
+//UnPack is MessageUnpacker
+func (m *NodeAdvertisementResponse) UnPack(data []byte) error {
+	var err error
+	var dataLen uint32
+	buf := bytes.NewBuffer(data)
+	err = m.ReadCmdStructFromBuf(buf)
+	if err != nil {
+		return err
+	}
+	if m.CmdID != NodeAdvertisementResponseCmdID {
+		return fmt.Errorf("NodeAdvertisementResponse unpack cmdid should be %d, but get %d", NodeAdvertisementResponseCmdID, m.CmdID)
+	}
+	err = binary.Read(buf, binary.BigEndian, &m.Nonce)
+	if err != nil {
+		return err
+	}
+	err = binary.Read(buf, binary.BigEndian, &dataLen)
+	if err != nil {
+		return err
+	}
+	if int(dataLen)+signatureLength != buf.Len() {
+		return errPacketLength
+	}
+	if dataLen > 0 {
+		m.Data = make([]byte, dataLen)
+		_, err = buf.Read(m.Data)
+		if err != nil {
+			return err
+		}
+	}
+	m.Signature = make([]byte, signatureLength)
+	_, err = buf.Read(m.Signature)
+	if err != nil {
+		return err
+	}
+	return m.SignedMessage.verifySignature(data)
+}
+
+//String is fmt.Stringer
+func (m *NodeAdvertisementResponse) String() string {
+	return fmt.Sprintf("Message{type=NodeAdvertisementResponse nonce=%d,datalen=%d,sender=%s}", m.Nonce, len(m.Data), utils.APex2(m.Sender))
+}
+
+/*
+StateBackup 发给同一运营者另一个节点的加密状态备份分片,
+一次备份的数据超过消息大小限制时,会被拆分成Total个分片,Index从0开始
+*/
+type StateBackup struct {
+	SignedMessage
+	Sequence int64
+	Full     bool
+	Index    uint16
+	Total    uint16
+	Data     []byte
+}
+
+//NewStateBackup create StateBackup
+func NewStateBackup(sequence int64, full bool, index, total uint16, data []byte) *StateBackup {
+	m := &StateBackup{
+		Sequence: sequence,
+		Full:     full,
+		Index:    index,
+		Total:    total,
+		Data:     data,
+	}
+	m.CmdID = StateBackupCmdID
+	return m
+}
+
+//Pack is MessagePacker
+func (m *StateBackup) Pack() []byte {
+	var err error
+	buf := new(bytes.Buffer)
+	err = m.WriteCmdStructToBuf(buf)
+	err = binary.Write(buf, binary.BigEndian, m.Sequence)
+	err = binary.Write(buf, binary.BigEndian, m.Full)
+	err = binary.Write(buf, binary.BigEndian, m.Index)
+	err = binary.Write(buf, binary.BigEndian, m.Total)
+	err = binary.Write(buf, binary.BigEndian, uint32(len(m.Data)))
+	_, err = buf.Write(m.Data)
+	_, err = buf.Write(m.Signature)
+	if err != nil {
+		log.Crit(fmt.Sprintf("StateBackup Pack err %s", err))
+	}
+	return buf.Bytes()
+}
+
+//UnPack is MessageUnpacker
+func (m *StateBackup) UnPack(data []byte) error {
+	var err error
+	var dataLen uint32
+	buf := bytes.NewBuffer(data)
+	err = m.ReadCmdStructFromBuf(buf)
+	if err != nil {
+		return err
+	}
+	if m.CmdID != StateBackupCmdID {
+		return fmt.Errorf("StateBackup unpack cmdid should be %d, but get %d", StateBackupCmdID, m.CmdID)
+	}
+	err = binary.Read(buf, binary.BigEndian, &m.Sequence)
+	if err != nil {
+		return err
+	}
+	err = binary.Read(buf, binary.BigEndian, &m.Full)
+	if err != nil {
+		return err
+	}
+	err = binary.Read(buf, binary.BigEndian, &m.Index)
+	if err != nil {
+		return err
+	}
+	err = binary.Read(buf, binary.BigEndian, &m.Total)
+	if err != nil {
+		return err
+	}
+	err = binary.Read(buf, binary.BigEndian, &dataLen)
+	if err != nil {
+		return err
+	}
+	if int(dataLen)+signatureLength != buf.Len() {
+		return errPacketLength
+	}
+	if dataLen > 0 {
+		m.Data = make([]byte, dataLen)
+		_, err = buf.Read(m.Data)
+		if err != nil {
+			return err
+		}
+	}
+	m.Signature = make([]byte, signatureLength)
+	_, err = buf.Read(m.Signature)
+	if err != nil {
+		return err
+	}
+	return m.SignedMessage.verifySignature(data)
+}
+
+//String is fmt.Stringer
+func (m *StateBackup) String() string {
+	return fmt.Sprintf("Message{type=StateBackup sequence=%d,full=%v,fragment=%d/%d,datalen=%d,sender=%s}",
+		m.Sequence, m.Full, m.Index, m.Total, len(m.Data), utils.APex2(m.Sender))
+}
+
+func writeShortString(buf *bytes.Buffer, s string) (err error) {
+	err = binary.Write(buf, binary.BigEndian, uint16(len(s)))
+	if err != nil {
+		return
+	}
+	_, err = buf.WriteString(s)
+	return
+}
+
+func readShortString(buf *bytes.Buffer) (s string, err error) {
+	var l uint16
+	err = binary.Read(buf, binary.BigEndian, &l)
+	if err != nil {
+		return
+	}
+	if int(l) > buf.Len() {
+		return "", errPacketLength
+	}
+	s = string(buf.Next(int(l)))
+	return
+}
+
+/*
+InboundCapacityRequest 请求通道伙伴向通道存入Amount,增加自己可以接收的金额.
+FeeOffer是愿意为此支付的费用,只是一个承诺,如何支付由双方自行约定
+*/
+type InboundCapacityRequest struct {
+	SignedMessage
+	RequestID common.Hash
+	Token     common.Address
+	Amount    *big.Int
+	FeeOffer  *big.Int
+	Reason    string
+}
+
+//NewInboundCapacityRequest create InboundCapacityRequest
+func NewInboundCapacityRequest(requestID common.Hash, token common.Address, amount, feeOffer *big.Int, reason string) *InboundCapacityRequest {
+	if feeOffer == nil {
+		feeOffer = new(big.Int)
+	}
+	m := &InboundCapacityRequest{
+		RequestID: requestID,
+		Token:     token,
+		Amount:    amount,
+		FeeOffer:  feeOffer,
+		Reason:    reason,
+	}
+	m.CmdID = InboundCapacityRequestCmdID
+	return m
+}
+
+//Pack is MessagePacker
+func (m *InboundCapacityRequest) Pack() []byte {
+	var err error
+	buf := new(bytes.Buffer)
+	err = m.WriteCmdStructToBuf(buf)
+	_, err = buf.Write(m.RequestID[:])
+	_, err = buf.Write(m.Token[:])
+	_, err = buf.Write(utils.BigIntTo32Bytes(m.Amount))
+	_, err = buf.Write(utils.BigIntTo32Bytes(m.FeeOffer))
+	err = writeShortString(buf, m.Reason)
+	_, err = buf.Write(m.Signature)
+	if err != nil {
+		log.Crit(fmt.Sprintf("InboundCapacityRequest Pack err %s", err))
+	}
+	return buf.Bytes()
+}
+
+//UnPack is MessageUnpacker
+func (m *InboundCapacityRequest) UnPack(data []byte) error {
+	var err error
+	buf := bytes.NewBuffer(data)
+	err = m.ReadCmdStructFromBuf(buf)
+	if err != nil {
+		return err
+	}
+	if m.CmdID != InboundCapacityRequestCmdID {
+		return fmt.Errorf("InboundCapacityRequest unpack cmdid should be %d, but get %d", InboundCapacityRequestCmdID, m.CmdID)
+	}
+	if buf.Len() < len(m.RequestID)+len(m.Token)+64 {
+		return errPacketLength
+	}
+	_, err = buf.Read(m.RequestID[:])
+	_, err = buf.Read(m.Token[:])
+	m.Amount = utils.ReadBigInt(buf)
+	m.FeeOffer = utils.ReadBigInt(buf)
+	m.Reason, err = readShortString(buf)
+	if err != nil {
+		return err
+	}
+	if buf.Len() != signatureLength {
+		return errPacketLength
+	}
+	m.Signature = make([]byte, signatureLength)
+	_, err = buf.Read(m.Signature)
+	if err != nil {
+		return err
+	}
+	return m.SignedMessage.verifySignature(data)
+}
+
+//String is fmt.Stringer
+func (m *InboundCapacityRequest) String() string {
+	return fmt.Sprintf("Message{type=InboundCapacityRequest id=%s,token=%s,amount=%s,feeoffer=%s,reason=%s,sender=%s}",
+		utils.HPex(m.RequestID), utils.APex2(m.Token), m.Amount, m.FeeOffer, m.Reason, utils.APex2(m.Sender))
+}
+
+/*
+InboundCapacityResponse 答复是否同意存款,同意时存款交易已经发出
+*/
+type InboundCapacityResponse struct {
+	SignedMessage
+	RequestID common.Hash
+	Accepted  bool
+	Reason    string
+}
+
+//NewInboundCapacityResponse create InboundCapacityResponse
+func NewInboundCapacityResponse(requestID common.Hash, accepted bool, reason string) *InboundCapacityResponse {
+	m := &InboundCapacityResponse{
+		RequestID: requestID,
+		Accepted:  accepted,
+		Reason:    reason,
+	}
+	m.CmdID = InboundCapacityResponseCmdID
+	return m
+}
+
+//Pack is MessagePacker
+func (m *InboundCapacityResponse) Pack() []byte {
+	var err error
+	buf := new(bytes.Buffer)
+	err = m.WriteCmdStructToBuf(buf)
+	_, err = buf.Write(m.RequestID[:])
+	err = binary.Write(buf, binary.BigEndian, m.Accepted)
+	err = writeShortString(buf, m.Reason)
+	_, err = buf.Write(m.Signature)
+	if err != nil {
+		log.Crit(fmt.Sprintf("InboundCapacityResponse Pack err %s", err))
+	}
+	return buf.Bytes()
+}
+
+//UnPack is MessageUnpacker
+func (m *InboundCapacityResponse) UnPack(data []byte) error {
+	var err error
+	buf := bytes.NewBuffer(data)
+	err = m.ReadCmdStructFromBuf(buf)
+	if err != nil {
+		return err
+	}
+	if m.CmdID != InboundCapacityResponseCmdID {
+		return fmt.Errorf("InboundCapacityResponse unpack cmdid should be %d, but get %d", InboundCapacityResponseCmdID, m.CmdID)
+	}
+	if buf.Len() < len(m.RequestID) {
+		return errPacketLength
+	}
+	_, err = buf.Read(m.RequestID[:])
+	err = binary.Read(buf, binary.BigEndian, &m.Accepted)
+	if err != nil {
+		return err
+	}
+	m.Reason, err = readShortString(buf)
+	if err != nil {
+		return err
+	}
+	if buf.Len() != signatureLength {
+		return errPacketLength
+	}
+	m.Signature = make([]byte, signatureLength)
+	_, err = buf.Read(m.Signature)
+	if err != nil {
+		return err
+	}
+	return m.SignedMessage.verifySignature(data)
+}
+
+//String is fmt.Stringer
+func (m *InboundCapacityResponse) String() string {
+	return fmt.Sprintf("Message{type=InboundCapacityResponse id=%s,accepted=%v,reason=%s,sender=%s}",
+		utils.HPex(m.RequestID), m.Accepted, m.Reason, utils.APex2(m.Sender))
+}
+
+//NetworkStats 匿名的token网络统计,Data是json格式的[]models.NetworkStatsReport,包括发送方自己的和它知道的其他节点的
+type NetworkStats struct {
+	SignedMessage
+	Data []byte
+}
+
+//NewNetworkStats create NetworkStats
+func NewNetworkStats(data []byte) *NetworkStats {
+	m := &NetworkStats{
+		Data: data,
+	}
+	m.CmdID = NetworkStatsCmdID
+	return m
+}
+
+//Pack is MessagePacker
+func (m *NetworkStats) Pack() []byte {
+	var err error
+	buf := new(bytes.Buffer)
+	err = m.WriteCmdStructToBuf(buf)
+	err = binary.Write(buf, binary.BigEndian, uint32(len(m.Data)))
+	_, err = buf.Write(m.Data)
+	_, err = buf.Write(m.Signature)
+	if err != nil {
+		log.Crit(fmt.Sprintf("NetworkStats Pack err %s", err))
+	}
+	return buf.Bytes()
+}
+
+//UnPack is MessageUnpacker
+func (m *NetworkStats) UnPack(data []byte) error {
+	var err error
+	var dataLen uint32
+	buf := bytes.NewBuffer(data)
+	err = m.ReadCmdStructFromBuf(buf)
+	if err != nil {
+		return err
+	}
+	if m.CmdID != NetworkStatsCmdID {
+		return fmt.Errorf("NetworkStats unpack cmdid should be %d, but get %d", NetworkStatsCmdID, m.CmdID)
+	}
+	err = binary.Read(buf, binary.BigEndian, &dataLen)
+	if err != nil {
+		return err
+	}
+	if int(dataLen)+signatureLength != buf.Len() {
+		return errPacketLength
+	}
+	if dataLen > 0 {
+		m.Data = make([]byte, dataLen)
+		_, err = buf.Read(m.Data)
+		if err != nil {
+			return err
+		}
+	}
+	m.Signature = make([]byte, signatureLength)
+	_, err = buf.Read(m.Signature)
+	if err != nil {
+		return err
+	}
+	return m.SignedMessage.verifySignature(data)
+}
+
+//String is fmt.Stringer
+func (m *NetworkStats) String() string {
+	return fmt.Sprintf("Message{type=NetworkStats datalen=%d,sender=%s}", len(m.Data), utils.APex2(m.Sender))
+}
+
+//CapacityEntry 节点Owner在和Partner的通道中可以支付的金额,由Owner签名,其他节点可以原样转发
+type CapacityEntry struct {
+	Token       common.Address
+	Partner     common.Address
+	Capacity    *big.Int
+	BlockNumber int64
+	Signature   []byte
+	Owner       common.Address //从签名中恢复,不参与编码
+}
+
+const capacityEntryLength = 20 + 20 + 32 + 8 + signatureLength
+
+//NewCapacityEntry create CapacityEntry, capacity must not be negative
+func NewCapacityEntry(token, partner common.Address, capacity *big.Int, blockNumber int64) *CapacityEntry {
+	return &CapacityEntry{
+		Token:       token,
+		Partner:     partner,
+		Capacity:    new(big.Int).Set(capacity),
+		BlockNumber: blockNumber,
+	}
+}
+
+func (e *CapacityEntry) dataToSign() []byte {
+	buf := new(bytes.Buffer)
+	_, err := buf.Write(e.Token[:])
+	_, err = buf.Write(e.Partner[:])
+	_, err = buf.Write(utils.BigIntTo32Bytes(e.Capacity))
+	err = binary.Write(buf, binary.BigEndian, e.BlockNumber)
+	if err != nil {
+		log.Crit(fmt.Sprintf("CapacityEntry pack err %s", err))
+	}
+	return buf.Bytes()
+}
+
+//Sign 由通道参与方签名
+func (e *CapacityEntry) Sign(privKey *ecdsa.PrivateKey) (err error) {
+	e.Signature, err = utils.SignData(privKey, e.dataToSign())
+	if err == nil {
+		e.Owner = crypto.PubkeyToAddress(privKey.PublicKey)
+	}
+	return
+}
+
+//String is fmt.Stringer
+func (e *CapacityEntry) String() string {
+	return fmt.Sprintf("{token=%s,%s-%s,capacity=%s,block=%d}",
+		utils.APex2(e.Token), utils.APex2(e.Owner), utils.APex2(e.Partner), e.Capacity, e.BlockNumber)
+}
+
+/*
+CapacityUpdate 发送方签名的一组通道容量,每一条都有通道参与方自己的签名,
+所以既可以是发送方自己的通道,也可以是转发的其他节点的通道
+*/
+type CapacityUpdate struct {
+	SignedMessage
+	Entries []*CapacityEntry
+}
+
+//NewCapacityUpdate create CapacityUpdate, no more than params.CapacityUpdateMaxEntries entries
+func NewCapacityUpdate(entries []*CapacityEntry) *CapacityUpdate {
+	m := &CapacityUpdate{
+		Entries: entries,
+	}
+	m.CmdID = CapacityUpdateCmdID
+	return m
+}
+
+//Pack is MessagePacker
+func (m *CapacityUpdate) Pack() []byte {
+	var err error
+	buf := new(bytes.Buffer)
+	err = m.WriteCmdStructToBuf(buf)
+	err = binary.Write(buf, binary.BigEndian, uint16(len(m.Entries)))
+	for _, e := range m.Entries {
+		_, err = buf.Write(e.dataToSign())
+		_, err = buf.Write(e.Signature)
+	}
+	_, err = buf.Write(m.Signature)
+	if err != nil {
+		log.Crit(fmt.Sprintf("CapacityUpdate Pack err %s", err))
+	}
+	return buf.Bytes()
+}
+
+//UnPack is MessageUnpacker
+func (m *CapacityUpdate) UnPack(data []byte) error {
+	var err error
+	var n uint16
+	buf := bytes.NewBuffer(data)
+	err = m.ReadCmdStructFromBuf(buf)
+	if err != nil {
+		return err
+	}
+	if m.CmdID != CapacityUpdateCmdID {
+		return fmt.Errorf("CapacityUpdate unpack cmdid should be %d, but get %d", CapacityUpdateCmdID, m.CmdID)
+	}
+	err = binary.Read(buf, binary.BigEndian, &n)
+	if err != nil {
+		return err
+	}
+	if int(n)*capacityEntryLength+signatureLength != buf.Len() {
+		return errPacketLength
+	}
+	m.Entries = nil
+	for i := 0; i < int(n); i++ {
+		e := new(CapacityEntry)
+		_, err = buf.Read(e.Token[:])
+		_, err = buf.Read(e.Partner[:])
+		e.Capacity = utils.ReadBigInt(buf)
+		err = binary.Read(buf, binary.BigEndian, &e.BlockNumber)
+		if err != nil {
+			return err
+		}
+		e.Signature = make([]byte, signatureLength)
+		_, err = buf.Read(e.Signature)
+		if err != nil {
+			return err
+		}
+		e.Owner, err = utils.Ecrecover(utils.Sha3(e.dataToSign()), e.Signature)
+		if err != nil {
+			return err
+		}
+		m.Entries = append(m.Entries, e)
+	}
+	m.Signature = make([]byte, signatureLength)
+	_, err = buf.Read(m.Signature)
+	if err != nil {
+		return err
+	}
+	return m.SignedMessage.verifySignature(data)
+}
+
+//String is fmt.Stringer
+func (m *CapacityUpdate) String() string {
+	return fmt.Sprintf("Message{type=CapacityUpdate entries=%d,sender=%s}", len(m.Entries), utils.APex2(m.Sender))
+}
+
+/*
+SwapOffer maker提出用MakerAmount的MakerToken交换taker的TakerAmount的TakerToken,
+LockSecretHash是两笔交易共同使用的锁,密码只有maker知道
+*/
+type SwapOffer struct {
+	SignedMessage
+	LockSecretHash common.Hash
+	MakerToken     common.Address
+	MakerAmount    *big.Int
+	TakerToken     common.Address
+	TakerAmount    *big.Int
+}
+
+//NewSwapOffer create SwapOffer
+func NewSwapOffer(lockSecretHash common.Hash, makerToken common.Address, makerAmount *big.Int, takerToken common.Address, takerAmount *big.Int) *SwapOffer {
+	m := &SwapOffer{
+		LockSecretHash: lockSecretHash,
+		MakerToken:     makerToken,
+		MakerAmount:    makerAmount,
+		TakerToken:     takerToken,
+		TakerAmount:    takerAmount,
+	}
+	m.CmdID = SwapOfferCmdID
+	return m
+}
+
+const swapOfferLength = 32 + 20 + 32 + 20 + 32
+
+//Pack is MessagePacker
+func (m *SwapOffer) Pack() []byte {
+	var err error
+	buf := new(bytes.Buffer)
+	err = m.WriteCmdStructToBuf(buf)
+	_, err = buf.Write(m.LockSecretHash[:])
+	_, err = buf.Write(m.MakerToken[:])
+	_, err = buf.Write(utils.BigIntTo32Bytes(m.MakerAmount))
+	_, err = buf.Write(m.TakerToken[:])
+	_, err = buf.Write(utils.BigIntTo32Bytes(m.TakerAmount))
+	_, err = buf.Write(m.Signature)
+	if err != nil {
+		log.Crit(fmt.Sprintf("SwapOffer Pack err %s", err))
+	}
+	return buf.Bytes()
+}
+
+//UnPack is MessageUnpacker
+func (m *SwapOffer) UnPack(data []byte) error {
+	var err error
+	buf := bytes.NewBuffer(data)
+	err = m.ReadCmdStructFromBuf(buf)
+	if err != nil {
+		return err
+	}
+	if m.CmdID != SwapOfferCmdID {
+		return fmt.Errorf("SwapOffer unpack cmdid should be %d, but get %d", SwapOfferCmdID, m.CmdID)
+	}
+	if buf.Len() != swapOfferLength+signatureLength {
+		return errPacketLength
+	}
+	_, err = buf.Read(m.LockSecretHash[:])
+	_, err = buf.Read(m.MakerToken[:])
+	m.MakerAmount = utils.ReadBigInt(buf)
+	_, err = buf.Read(m.TakerToken[:])
+	m.TakerAmount = utils.ReadBigInt(buf)
+	m.Signature = make([]byte, signatureLength)
+	_, err = buf.Read(m.Signature)
+	if err != nil {
+		return err
+	}
+	return m.SignedMessage.verifySignature(data)
+}
+
+//String is fmt.Stringer
+func (m *SwapOffer) String() string {
+	return fmt.Sprintf("Message{type=SwapOffer lockSecretHash=%s,maker=%s %s,taker=%s %s,sender=%s}",
+		utils.HPex(m.LockSecretHash), m.MakerAmount, utils.APex2(m.MakerToken), m.TakerAmount, utils.APex2(m.TakerToken), utils.APex2(m.Sender))
+}
+
+/*
+SwapResponse taker答复是否接受SwapOffer,接受时taker已经准备好在收到maker的交易以后发出自己的交易
+*/
+type SwapResponse struct {
+	SignedMessage
+	LockSecretHash common.Hash
+	Accepted       bool
+	Reason         string
+}
+
+//NewSwapResponse create SwapResponse
+func NewSwapResponse(lockSecretHash common.Hash, accepted bool, reason string) *SwapResponse {
+	m := &SwapResponse{
+		LockSecretHash: lockSecretHash,
+		Accepted:       accepted,
+		Reason:         reason,
+	}
+	m.CmdID = SwapResponseCmdID
+	return m
+}
+
+//Pack is MessagePacker
+func (m *SwapResponse) Pack() []byte {
+	var err error
+	buf := new(bytes.Buffer)
+	err = m.WriteCmdStructToBuf(buf)
+	_, err = buf.Write(m.LockSecretHash[:])
+	err = binary.Write(buf, binary.BigEndian, m.Accepted)
+	err = writeShortString(buf, m.Reason)
+	_, err = buf.Write(m.Signature)
+	if err != nil {
+		log.Crit(fmt.Sprintf("SwapResponse Pack err %s", err))
+	}
+	return buf.Bytes()
+}
+
+//UnPack is MessageUnpacker
+func (m *SwapResponse) UnPack(data []byte) error {
+	var err error
+	buf := bytes.NewBuffer(data)
+	err = m.ReadCmdStructFromBuf(buf)
+	if err != nil {
+		return err
+	}
+	if m.CmdID != SwapResponseCmdID {
+		return fmt.Errorf("SwapResponse unpack cmdid should be %d, but get %d", SwapResponseCmdID, m.CmdID)
+	}
+	if buf.Len() < len(m.LockSecretHash) {
+		return errPacketLength
+	}
+	_, err = buf.Read(m.LockSecretHash[:])
+	err = binary.Read(buf, binary.BigEndian, &m.Accepted)
+	if err != nil {
+		return err
+	}
+	m.Reason, err = readShortString(buf)
+	if err != nil {
+		return err
+	}
+	if buf.Len() != signatureLength {
+		return errPacketLength
+	}
+	m.Signature = make([]byte, signatureLength)
+	_, err = buf.Read(m.Signature)
+	if err != nil {
+		return err
+	}
+	return m.SignedMessage.verifySignature(data)
+}
+
+//String is fmt.Stringer
+func (m *SwapResponse) String() string {
+	return fmt.Sprintf("Message{type=SwapResponse lockSecretHash=%s,accepted=%v,reason=%s,sender=%s}",
+		utils.HPex(m.LockSecretHash), m.Accepted, m.Reason, utils.APex2(m.Sender))
+}
+
 //MessageMap contains all message can send and receive.
 //DirectTransfer has been deprecated
 var MessageMap = map[int]Messager{
@@ -1975,6 +3222,19 @@ var MessageMap = map[int]Messager{
 	WithdrawResponseCmdID:                 new(WithdrawResponse),
 	SettleRequestCmdID:                    new(SettleRequest),
 	SettleResponseCmdID:                   new(SettleResponse),
+	NodeAdvertisementRequestCmdID:         new(NodeAdvertisementRequest),
+	NodeAdvertisementResponseCmdID:        new(NodeAdvertisementResponse),
+	StateBackupCmdID:                      new(StateBackup),
+	InboundCapacityRequestCmdID:           new(InboundCapacityRequest),
+	InboundCapacityResponseCmdID:          new(InboundCapacityResponse),
+	NetworkStatsCmdID:                     new(NetworkStats),
+	CapacityUpdateCmdID:                   new(CapacityUpdate),
+	SwapOfferCmdID:                        new(SwapOffer),
+	SwapResponseCmdID:                     new(SwapResponse),
+	DeliveredCmdID:                        new(Delivered),
+	SealedCmdID:                           new(Sealed),
+	UDPEndpointCmdID:                      new(UDPEndpoint),
+	ChannelProbeCmdID:                     new(ChannelProbe),
 }
 
 func init() {
@@ -1993,4 +3253,16 @@ func init() {
 	gob.Register(&WithdrawResponse{})
 	gob.Register(&SettleRequest{})
 	gob.Register(&SettleResponse{})
+	gob.Register(&NodeAdvertisementRequest{})
+	gob.Register(&NodeAdvertisementResponse{})
+	gob.Register(&StateBackup{})
+	gob.Register(&InboundCapacityRequest{})
+	gob.Register(&InboundCapacityResponse{})
+	gob.Register(&NetworkStats{})
+	gob.Register(&CapacityUpdate{})
+	gob.Register(&SwapOffer{})
+	gob.Register(&SwapResponse{})
+	gob.Register(&Delivered{})
+	gob.Register(&UDPEndpoint{})
+	gob.Register(&ChannelProbe{})
 }
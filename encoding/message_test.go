@@ -12,11 +12,15 @@ import (
 	"reflect"
 
 	"math/big"
+	"net"
 
 	"encoding/json"
 
 	"fmt"
 
+	"strings"
+
+	"github.com/SmartMeshFoundation/Photon/params"
 	"github.com/SmartMeshFoundation/Photon/transfer/mtree"
 	"github.com/SmartMeshFoundation/Photon/utils"
 	"github.com/davecgh/go-spew/spew"
@@ -189,6 +193,100 @@ func TestMediatedTransfer(t *testing.T) {
 	}
 }
 
+func TestMediatedTransferWithPaymentID(t *testing.T) {
+	bp := &BalanceProof{
+		Nonce:             11,
+		ChannelIdentifier: utils.Sha3([]byte("123")),
+		TransferAmount:    big.NewInt(12),
+		OpenBlockNumber:   3,
+		Locksroot:         utils.EmptyHash,
+	}
+	lock := &mtree.Lock{
+		Amount:         big.NewInt(34),
+		Expiration:     4589895,
+		LockSecretHash: utils.ShaSecret([]byte("hashlock")),
+	}
+	m1 := NewMediatedTransfer(bp, lock, utils.NewRandomAddress(), utils.NewRandomAddress(), big.NewInt(33), []common.Address{utils.NewRandomAddress()})
+	m1.PaymentID = "order-1"
+	m1.Invoice = []byte("invoice")
+	err := m1.Sign(GetTestPrivKey(), m1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data := m1.Pack()
+	m2 := new(MediatedTransfer)
+	err = m2.UnPack(data)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.EqualValues(t, m1, m2)
+	//支付ID只在每一跳发送方的签名范围内,签名后修改会导致签名校验失败;中间节点重新签名时仍然可以改写,并不是端到端保护
+	m1.PaymentID = "order-2"
+	data = m1.Pack()
+	m3 := new(MediatedTransfer)
+	err = m3.UnPack(data)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.NotEqual(t, m1.Sender, m3.Sender)
+	//超长的支付ID
+	m1.PaymentID = strings.Repeat("a", params.PaymentIDMaxLength+1)
+	err = m1.Sign(GetTestPrivKey(), m1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data = m1.Pack()
+	m4 := new(MediatedTransfer)
+	err = m4.UnPack(data)
+	assert.NotEmpty(t, err)
+}
+
+//没有支付ID和发票时仍然按version 1发送,老版本的消息也能正常解析
+func TestMediatedTransferVersion1(t *testing.T) {
+	bp := &BalanceProof{
+		Nonce:             11,
+		ChannelIdentifier: utils.Sha3([]byte("123")),
+		TransferAmount:    big.NewInt(12),
+		OpenBlockNumber:   3,
+		Locksroot:         utils.EmptyHash,
+	}
+	lock := &mtree.Lock{
+		Amount:         big.NewInt(34),
+		Expiration:     4589895,
+		LockSecretHash: utils.ShaSecret([]byte("hashlock")),
+	}
+	m1 := NewMediatedTransfer(bp, lock, utils.NewRandomAddress(), utils.NewRandomAddress(), big.NewInt(33), []common.Address{utils.NewRandomAddress()})
+	err := m1.Sign(GetTestPrivKey(), m1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.EqualValues(t, MessageVersionControlMap[MediatedTransferCmdID], m1.Version)
+	data := m1.Pack()
+	m2 := new(MediatedTransfer)
+	err = m2.UnPack(data)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.EqualValues(t, m1, m2)
+	assert.Empty(t, m2.PaymentID)
+	assert.Empty(t, m2.Invoice)
+	//带上支付ID后升级为version 2
+	m1.PaymentID = "order-1"
+	err = m1.Sign(GetTestPrivKey(), m1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.EqualValues(t, MediatedTransferPaymentVersion, m1.Version)
+	assert.True(t, len(m1.Pack()) > len(data))
+}
+
 func TestNewAnnounceDisposedTransfer(t *testing.T) {
 	bp := &AnnounceDisposedProof{
 		ChannelIDInMessage: ChannelIDInMessage{
@@ -445,6 +543,267 @@ func TestSettleResponse(t *testing.T) {
 	}
 	assert.EqualValues(t, m, m2)
 }
+func TestNodeAdvertisementRequest(t *testing.T) {
+	key, _ := utils.MakePrivateKeyAddress()
+	m := NewNodeAdvertisementRequest(33)
+	err := m.Sign(key, m)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data := m.Pack()
+	m2 := new(NodeAdvertisementRequest)
+	err = m2.UnPack(data)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.EqualValues(t, m, m2)
+}
+func TestNodeAdvertisementResponse(t *testing.T) {
+	key, _ := utils.MakePrivateKeyAddress()
+	for _, d := range [][]byte{nil, []byte(`{"geo_hint":"Singapore"}`)} {
+		m := NewNodeAdvertisementResponse(33, d)
+		err := m.Sign(key, m)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		data := m.Pack()
+		m2 := new(NodeAdvertisementResponse)
+		err = m2.UnPack(data)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		assert.EqualValues(t, m, m2)
+	}
+}
+func TestStateBackup(t *testing.T) {
+	key, _ := utils.MakePrivateKeyAddress()
+	m := NewStateBackup(100, true, 1, 3, utils.Random(params.StateBackupFragmentSize))
+	err := m.Sign(key, m)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data := m.Pack()
+	if len(data) > params.UDPMaxMessageSize {
+		t.Errorf("StateBackup is too large %d", len(data))
+		return
+	}
+	m2 := new(StateBackup)
+	err = m2.UnPack(data)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.EqualValues(t, m, m2)
+}
+func TestNetworkStats(t *testing.T) {
+	key, _ := utils.MakePrivateKeyAddress()
+	m := NewNetworkStats(utils.Random(params.NetworkStatsMaxSize))
+	err := m.Sign(key, m)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data := m.Pack()
+	if len(data) > params.UDPMaxMessageSize {
+		t.Errorf("NetworkStats is too large %d", len(data))
+		return
+	}
+	m2 := new(NetworkStats)
+	err = m2.UnPack(data)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.EqualValues(t, m, m2)
+}
+func TestCapacityUpdate(t *testing.T) {
+	key, _ := utils.MakePrivateKeyAddress()
+	owner, ownerAddr := utils.MakePrivateKeyAddress()
+	var entries []*CapacityEntry
+	for i := 0; i < params.CapacityUpdateMaxEntries; i++ {
+		e := NewCapacityEntry(utils.NewRandomAddress(), utils.NewRandomAddress(), big.NewInt(int64((i+1)*100)), int64(i+1000))
+		err := e.Sign(owner)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		entries = append(entries, e)
+	}
+	m := NewCapacityUpdate(entries)
+	err := m.Sign(key, m)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data := m.Pack()
+	if len(data) > params.UDPMaxMessageSize {
+		t.Errorf("CapacityUpdate is too large %d", len(data))
+		return
+	}
+	m2 := new(CapacityUpdate)
+	err = m2.UnPack(data)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.EqualValues(t, m, m2)
+	assert.EqualValues(t, ownerAddr, m2.Entries[0].Owner)
+	//篡改容量以后恢复出来的不再是原来的签名者
+	data[len(data)-signatureLength-capacityEntryLength+40+31]++
+	m3 := new(CapacityUpdate)
+	err = m3.UnPack(data)
+	if err == nil && m3.Entries[len(m3.Entries)-1].Owner == ownerAddr {
+		t.Error("tampered capacity should not be signed by owner")
+	}
+}
+func TestInboundCapacity(t *testing.T) {
+	key, _ := utils.MakePrivateKeyAddress()
+	m := NewInboundCapacityRequest(utils.NewRandomHash(), utils.NewRandomAddress(), big.NewInt(300), big.NewInt(10), "receive salary")
+	err := m.Sign(key, m)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	m2 := new(InboundCapacityRequest)
+	err = m2.UnPack(m.Pack())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.EqualValues(t, m, m2)
+	r := NewInboundCapacityResponse(m.RequestID, false, "")
+	err = r.Sign(key, r)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	r2 := new(InboundCapacityResponse)
+	err = r2.UnPack(r.Pack())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.EqualValues(t, r, r2)
+	data := r.Pack()
+	err = r2.UnPack(data[:len(data)-1])
+	assert.NotNil(t, err)
+}
+
+func TestSwapOffer(t *testing.T) {
+	key, _ := utils.MakePrivateKeyAddress()
+	m := NewSwapOffer(utils.NewRandomHash(), utils.NewRandomAddress(), big.NewInt(10), utils.NewRandomAddress(), big.NewInt(30))
+	err := m.Sign(key, m)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	m2 := new(SwapOffer)
+	err = m2.UnPack(m.Pack())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.EqualValues(t, m, m2)
+	r := NewSwapResponse(m.LockSecretHash, true, "")
+	err = r.Sign(key, r)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	r2 := new(SwapResponse)
+	err = r2.UnPack(r.Pack())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.EqualValues(t, r, r2)
+	data := m.Pack()
+	err = m2.UnPack(data[:len(data)-1])
+	assert.NotNil(t, err)
+}
+
+func TestDelivered(t *testing.T) {
+	m := NewDelivered(utils.NewRandomAddress(), utils.NewRandomHash())
+	m2 := new(Delivered)
+	err := m2.UnPack(m.Pack())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.EqualValues(t, m, m2)
+	data := m.Pack()
+	err = m2.UnPack(data[:len(data)-1])
+	assert.NotNil(t, err)
+	//Processed和Ack的编码相同
+	p := NewProcessed(m.Sender, m.Echo)
+	assert.EqualValues(t, NewAck(m.Sender, m.Echo).Pack(), p.Pack())
+	assert.Nil(t, new(Ack).UnPack(p.Pack()))
+}
+
+func TestSealed(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	ping := NewPing(32)
+	err := ping.Sign(key, ping)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data := ping.Pack()
+	pub, err := RecoverPublicKey(data)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.EqualValues(t, crypto.PubkeyToAddress(key.PublicKey), crypto.PubkeyToAddress(*pub))
+	receiver, _ := crypto.GenerateKey()
+	s, err := NewSealed(&receiver.PublicKey, data)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, len(data)+SealOverhead, len(s.Pack()))
+	s2 := new(Sealed)
+	err = s2.UnPack(s.Pack())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	plain, err := s2.Open(receiver)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.EqualValues(t, data, plain)
+	//其他人无法解密
+	_, err = s2.Open(key)
+	assert.NotNil(t, err)
+}
+
+func TestUDPEndpoint(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	m := NewUDPEndpoint(net.ParseIP("77.12.33.4"), 40001)
+	err := m.Sign(key, m)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	m2 := new(UDPEndpoint)
+	err = m2.UnPack(m.Pack())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.EqualValues(t, m, m2)
+	assert.EqualValues(t, crypto.PubkeyToAddress(key.PublicKey), m2.Sender)
+	data := m.Pack()
+	err = m2.UnPack(data[:len(data)-1])
+	assert.NotNil(t, err)
+}
 
 type testStruct struct {
 	T  int
@@ -466,3 +825,23 @@ func TestBigInt(t *testing.T) {
 		t.Error("not equal")
 	}
 }
+
+func TestChannelProbe(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	m := NewChannelProbe(utils.NewRandomHash(), 30, 5, 3)
+	err := m.Sign(key, m)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	m2 := new(ChannelProbe)
+	err = m2.UnPack(m.Pack())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.EqualValues(t, m, m2)
+	assert.EqualValues(t, crypto.PubkeyToAddress(key.PublicKey), m2.Sender)
+	//另一次探测的ID不同
+	assert.NotEqual(t, m.ID, NewChannelProbe(m.ChannelIdentifier, 30, 5, 3).ID)
+}
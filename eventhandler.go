@@ -13,6 +13,7 @@ import (
 	"github.com/SmartMeshFoundation/Photon/log"
 	"github.com/SmartMeshFoundation/Photon/models"
 	"github.com/SmartMeshFoundation/Photon/network/graph"
+	"github.com/SmartMeshFoundation/Photon/notify"
 	"github.com/SmartMeshFoundation/Photon/transfer"
 	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer"
 	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer/initiator"
@@ -69,6 +70,8 @@ func (eh *stateMachineEventHandler) dispatch(stateManager *transfer.StateManager
 			log.Error(fmt.Sprintf("stateMachineEventHandler dispatch:%v\n", err))
 		}
 	}
+	//事件处理完以后再保存快照,恢复以后不会再处理这些事件
+	eh.photon.snapshotStateManager(stateManager, stateChange, events)
 	return
 }
 
@@ -113,7 +116,7 @@ func (eh *stateMachineEventHandler) eventSendRevealSecret(event *mediatedtransfe
 		std := eh.photon.dao.UpdateSentTransferDetailStatus(event.Token, revealMessage.LockSecretHash(), models.TransferStatusCanNotCancel, fmt.Sprintf("RevealSecret sending target=%s", utils.APex2(event.Receiver)), nil)
 		//eh.photon.dao.UpdateTransferStatus(event.Token, revealMessage.LockSecretHash(), models.TransferStatusCanNotCancel, fmt.Sprintf("RevealSecret 正在发送 target=%s", utils.APex2(event.Receiver)))
 		//eh.photon.NotifyTransferStatusChange(event.Token, revealMessage.LockSecretHash(), models.TransferStatusCanNotCancel, fmt.Sprintf("RevealSecret 正在发送 target=%s", utils.APex2(event.Receiver)))
-		eh.photon.NotifyHandler.NotifySentTransferDetail(std)
+		eh.photon.notifySentTransferDetail(std)
 	}
 	return err
 }
@@ -152,13 +155,19 @@ func (eh *stateMachineEventHandler) eventSendMediatedTransfer(event *mediatedtra
 	if err != nil {
 		return
 	}
+	mtr.PaymentID = event.PaymentID
+	mtr.Invoice = event.Invoice
 	//log.Trace(fmt.Sprintf("mtr=%s", utils.StringInterface(mtr, 5)))
 	err = mtr.Sign(eh.photon.PrivateKey, mtr)
 	err = ch.RegisterTransfer(eh.photon.GetBlockNumber(), mtr)
 	if err != nil {
 		return
 	}
+	eh.photon.recordChannelMessage(ch, mtr)
 	eh.photon.conditionQuit("EventSendMediatedTransferBefore")
+	if stateManager.Name == initiator.NameInitiatorTransition {
+		eh.photon.routeStats.recordSent(event.LockSecretHash, receiver)
+	}
 	if stateManager.LastReceivedMessage == nil {
 		if stateManager.Name != initiator.NameInitiatorTransition {
 			log.Warn(fmt.Sprintf("EventSendMediatedTransfer %s,but has no lastReceviedMessage", utils.StringInterface(event, 3)))
@@ -198,7 +207,7 @@ func (eh *stateMachineEventHandler) eventSendMediatedTransfer(event *mediatedtra
 	if err == nil {
 		std := eh.photon.dao.UpdateSentTransferDetailStatus(ch.TokenAddress, mtr.LockSecretHash, models.TransferStatusCanCancel, fmt.Sprintf("MediatedTransfer sending target=%s", utils.APex2(receiver)), nil)
 		//eh.photon.NotifyTransferStatusChange(ch.TokenAddress, mtr.LockSecretHash, models.TransferStatusCanCancel, fmt.Sprintf("MediatedTransfer 正在发送 target=%s", utils.APex2(receiver)))
-		eh.photon.NotifyHandler.NotifySentTransferDetail(std)
+		eh.photon.notifySentTransferDetail(std)
 	}
 	return
 }
@@ -222,6 +231,7 @@ func (eh *stateMachineEventHandler) eventSendUnlock(event *mediatedtransfer.Even
 	if err != nil {
 		return
 	}
+	eh.photon.recordChannelMessage(ch, tr)
 	eh.photon.conditionQuit("EventSendUnlockBefore")
 	err = eh.photon.UpdateChannelNoTx(channel.NewChannelSerialization(ch))
 	err = eh.photon.sendAsync(receiver, tr)
@@ -288,6 +298,7 @@ func (eh *stateMachineEventHandler) eventSendAnnouncedDisposedResponse(event *me
 	if err != nil {
 		return
 	}
+	eh.photon.recordChannelMessage(ch, mtr)
 	eh.photon.conditionQuit("EventSendAnnouncedDisposedResponseBefore")
 	if stateManager.LastReceivedMessage == nil {
 		log.Warn(fmt.Sprintf("EventSendAnnounceDisposedResponse %s,but has no lastReceviedMessage", utils.StringInterface(event, 3)))
@@ -372,6 +383,7 @@ func (eh *stateMachineEventHandler) eventUnlockFailed(e2 *mediatedtransfer.Event
 		return
 	}
 	log.Info(fmt.Sprintf("remove expired hashlock channel=%s,hashlock=%s ", utils.HPex(e2.ChannelIdentifier), utils.HPex(e2.LockSecretHash)))
+	eh.photon.routeStats.recordFailure(ch.TokenAddress, ch.PartnerState.Address, e2.LockSecretHash, e2.Reason, true)
 	/*
 		unlock 失败,谨慎起见, 只有在对方不知道密码的情况下,才可能成功移除锁.
 	*/
@@ -386,12 +398,14 @@ func (eh *stateMachineEventHandler) eventUnlockFailed(e2 *mediatedtransfer.Event
 		log.Error(fmt.Sprintf("register mine RegisterRemoveExpiredHashlockTransfer err %s", err))
 		return
 	}
+	eh.photon.recordChannelMessage(ch, tr)
 	eh.photon.conditionQuit("EventRemoveExpiredHashlockTransferBefore")
 	err = eh.photon.UpdateChannelNoTx(channel.NewChannelSerialization(ch))
 	err = eh.photon.sendAsync(ch.PartnerState.Address, tr)
 	std := eh.photon.dao.UpdateSentTransferDetailStatus(ch.TokenAddress, e2.LockSecretHash, models.TransferStatusFailed, fmt.Sprintf("transfer timeout err=%s", e2.Reason), nil)
+	eh.photon.recordTransferStage(e2.LockSecretHash, models.TransferStageExpired, e2.Reason)
 	//eh.photon.NotifyTransferStatusChange(ch.TokenAddress, e2.LockSecretHash, models.TransferStatusFailed, fmt.Sprintf("交易超时失败 err=%s", e2.Reason))
-	eh.photon.NotifyHandler.NotifySentTransferDetail(std)
+	eh.photon.notifySentTransferDetail(std)
 	// 清空Token2LockSecretHash2Channels
 	eh.photon.removeToken2LockSecretHash2channel(e2.LockSecretHash, ch)
 	return
@@ -448,11 +462,16 @@ func (eh *stateMachineEventHandler) OnEvent(event transfer.Event, stateManager *
 		}
 		//st := eh.photon.dao.NewSentTransfer(eh.photon.GetBlockNumber(), e2.ChannelIdentifier, ch.ChannelIdentifier.OpenBlockNumber, ch.TokenAddress, e2.Target, ch.GetNextNonce(), e2.Amount, e2.LockSecretHash, e2.Data)
 		//eh.photon.NotifyHandler.NotifySentTransfer(st)
+		eh.photon.routeAffinity.recordSuccess(e2.Token, e2.Target, e2.ChannelIdentifier)
+		eh.photon.routeStats.recordSuccess(e2.Token, ch.PartnerState.Address, e2.LockSecretHash)
+		eh.photon.recordTransferRoute(e2.LockSecretHash, e2.Fee, e2.Path)
 		eh.finishOneTransfer(event)
 	case *transfer.EventTransferSentFailed:
 		std := eh.photon.dao.UpdateSentTransferDetailStatus(e2.Token, e2.LockSecretHash, models.TransferStatusFailed, fmt.Sprintf("transfer fail err=%s", e2.Reason), nil)
+		eh.photon.recordTransferStage(e2.LockSecretHash, models.TransferStageFailed, e2.Reason)
 		//eh.photon.NotifyTransferStatusChange(e2.Token, e2.LockSecretHash, models.TransferStatusFailed, fmt.Sprintf("交易失败 err=%s", e2.Reason))
-		eh.photon.NotifyHandler.NotifySentTransferDetail(std)
+		eh.photon.notifySentTransferDetail(std)
+		eh.photon.routeAffinity.recordFailure(e2.Token, e2.Target)
 		eh.finishOneTransfer(event)
 	case *transfer.EventTransferReceivedSuccess:
 		ch, err = eh.photon.findChannelByIdentifier(e2.ChannelIdentifier)
@@ -464,8 +483,20 @@ func (eh *stateMachineEventHandler) OnEvent(event transfer.Event, stateManager *
 		if err != nil {
 			log.Error(fmt.Sprintf("UpdateChannelNoTx err %s", err))
 		}
-		rt := eh.photon.dao.NewReceivedTransfer(eh.photon.GetBlockNumber(), e2.ChannelIdentifier, ch.ChannelIdentifier.OpenBlockNumber, ch.TokenAddress, e2.Initiator, ch.PartnerState.BalanceProofState.Nonce, e2.Amount, e2.LockSecretHash, e2.Data)
+		rt := eh.photon.dao.NewReceivedTransfer(eh.photon.GetBlockNumber(), e2.ChannelIdentifier, ch.ChannelIdentifier.OpenBlockNumber, ch.TokenAddress, e2.Initiator, ch.PartnerState.BalanceProofState.Nonce, e2.Amount, e2.LockSecretHash, e2.Data, e2.PaymentID, e2.Invoice)
 		eh.photon.NotifyHandler.NotifyReceiveTransfer(rt)
+		eh.photon.NotifyHandler.NotifyEvent(notify.LevelInfo, &notify.Event{
+			Code:              notify.EventTransferReceived,
+			TokenAddress:      ch.TokenAddress,
+			ChannelIdentifier: e2.ChannelIdentifier,
+			Amount:            e2.Amount,
+			LockSecretHash:    e2.LockSecretHash,
+			Params:            map[string]string{notify.ParamInitiator: e2.Initiator.String()},
+		})
+		if eh.photon.Config.EchoNode && e2.Data == params.SelfTestTransferData {
+			//不能在主线程中等待交易结果
+			go eh.photon.echoTransfer(ch.TokenAddress, e2.Initiator, e2.Amount)
+		}
 	case *mediatedtransfer.EventUnlockSuccess:
 	case *mediatedtransfer.EventWithdrawFailed:
 		log.Error(fmt.Sprintf("EventWithdrawFailed hashlock=%s,reason=%s", utils.HPex(e2.LockSecretHash), e2.Reason))
@@ -603,6 +634,12 @@ func (eh *stateMachineEventHandler) handleBalance(st *mediatedtransfer.ContractB
 	if err != nil {
 		log.Error(fmt.Sprintf("handleBalance ChannelStateTransition err=%s", err))
 	}
+	eh.photon.recordChannelChainEvent(ch, &models.ChannelEvent{
+		BlockNumber: st.BlockNumber,
+		Type:        models.ChannelEventDeposit,
+		Participant: st.ParticipantAddress,
+		Amount:      st.Balance,
+	})
 	err = eh.photon.UpdateChannelContractBalance(channel.NewChannelSerialization(ch))
 	return err
 }
@@ -640,6 +677,28 @@ func (eh *stateMachineEventHandler) handleClosed(st *mediatedtransfer.ContractCl
 	if err != nil {
 		log.Error(fmt.Sprintf("handleBalance ChannelStateTransition err=%s", err))
 	}
+	eh.photon.recordChannelChainEvent(ch, &models.ChannelEvent{
+		BlockNumber:    st.ClosedBlock,
+		Type:           models.ChannelEventClosed,
+		Participant:    st.ClosingAddress,
+		TransferAmount: st.TransferredAmount,
+		Locksroot:      st.LocksRoot,
+	})
+	if st.ClosingAddress != eh.photon.NodeAddress {
+		eh.photon.onClosedByPartner(ch, st)
+		eh.photon.savePendingUnlocks(ch)
+		//启动时处理的历史事件不算异常
+		if !eh.photon.isStarting {
+			eh.photon.recordAnomaly(ch.TokenAddress, AnomalyUnexpectedClose)
+		}
+		eh.photon.NotifyHandler.NotifyEvent(notify.LevelWarn, &notify.Event{
+			Code:              notify.EventChannelClosedByPartner,
+			TokenAddress:      ch.TokenAddress,
+			ChannelIdentifier: channelIdentifier,
+			BlockNumber:       st.ClosedBlock,
+			Params:            map[string]string{notify.ParamPartner: st.ClosingAddress.String()},
+		})
+	}
 	err = eh.photon.UpdateChannelState(channel.NewChannelSerialization(ch))
 	return err
 }
@@ -695,6 +754,10 @@ func (eh *stateMachineEventHandler) handleSettled(st *mediatedtransfer.ContractS
 		log.Error(fmt.Sprintf("handleBalance ChannelStateTransition err=%s", err))
 		return err
 	}
+	eh.photon.recordChannelChainEvent(ch, &models.ChannelEvent{
+		BlockNumber: st.SettledBlock,
+		Type:        models.ChannelEventSettled,
+	})
 	return eh.removeSettledChannel(ch)
 }
 
@@ -734,6 +797,10 @@ func (eh *stateMachineEventHandler) handleCooperativeSettled(st *mediatedtransfe
 		log.Error(fmt.Sprintf("handleBalance ChannelStateTransition err=%s", err))
 		return err
 	}
+	eh.photon.recordChannelChainEvent(ch, &models.ChannelEvent{
+		BlockNumber: st.SettledBlock,
+		Type:        models.ChannelEventSettled,
+	})
 	err = eh.removeSettledChannel(ch)
 	//if true {
 	//	g := eh.photon.getChannelGraph(ch.ChannelIdentifier.ChannelIdentifier)
@@ -757,6 +824,19 @@ func (eh *stateMachineEventHandler) handleWithdraw(st *mediatedtransfer.Contract
 		log.Error("got repeat ContractChannelWithdrawStateChange , ignore ")
 		return nil
 	}
+	//取现以后OpenBlockNumber会改变,记录在取现之前的通道上
+	eh.photon.recordChannelChainEvent(ch, &models.ChannelEvent{
+		BlockNumber: st.BlockNumber,
+		Type:        models.ChannelEventWithdraw,
+		Participant: st.Participant1,
+		Amount:      st.Participant1Balance,
+	})
+	eh.photon.recordChannelChainEvent(ch, &models.ChannelEvent{
+		BlockNumber: st.BlockNumber,
+		Type:        models.ChannelEventWithdraw,
+		Participant: st.Participant2,
+		Amount:      st.Participant2Balance,
+	})
 	err = eh.ChannelStateTransition(ch, st)
 	if err != nil {
 		log.Error(fmt.Sprintf("handleBalance ChannelStateTransition err=%s", err))
@@ -858,12 +938,15 @@ func (eh *stateMachineEventHandler) handleBalanceProofOnChain(st *mediatedtransf
 // 这时候A崩溃,等A立即重启以后,会再次处理ContractSecretRevealOnChainStateChange,从而导致unlock消息发送两次.
 // 但是两次unlock消息nonce不同,从而导致通道不可用.
 func (eh *stateMachineEventHandler) handleSecretRegisteredOnChain(st *mediatedtransfer.ContractSecretRevealOnChainStateChange) error {
+	//没有StateManager负责的锁也要处理,先找出来,同时也会把相关通道注册到这个LockSecretHash上
+	orphans := eh.photon.orphanLocksForSecret(st.LockSecretHash)
 	// 这里需要注册密码,否则unlock消息无法正常发送
 	// we need register secret here, otherwise we can not send unlock.
 	eh.photon.registerRevealedLockSecretHash(st.LockSecretHash, st.Secret, st.BlockNumber)
 	//需要 disatch 给相关的 statemanager, 让他们处理未完成的交易.
 	// we need dispatch it to relevant statemanager, and let them handle incomplete transfers.
 	eh.dispatchBySecretHash(st.LockSecretHash, st)
+	eh.watchRegisteredSecret(orphans, st)
 	return nil
 }
 
@@ -0,0 +1,118 @@
+package photon
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/extension"
+	"github.com/SmartMeshFoundation/Photon/internal/rpanic"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/notify"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/transfer/route"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+extensionAcceptTransfer 由运营方的extension决定是否接收这笔交易,调用失败时同样拒绝
+*/
+func (rs *Service) extensionAcceptTransfer(msg *encoding.MediatedTransfer, token common.Address) error {
+	if rs.extension == nil {
+		return nil
+	}
+	err := rs.extension.AcceptTransfer(&extension.Transfer{
+		Token:          token,
+		Partner:        msg.Sender,
+		Initiator:      msg.Initiator,
+		Target:         msg.Target,
+		Amount:         msg.PaymentAmount,
+		Fee:            msg.Fee,
+		LockSecretHash: msg.LockSecretHash,
+		Expiration:     msg.Expiration,
+	})
+	if err != nil {
+		log.Info(fmt.Sprintf("extension refused transfer %s from %s: %s", utils.HPex(msg.LockSecretHash), utils.APex2(msg.Sender), err))
+		return rerr.ErrTransferUnwanted.AppendError(err)
+	}
+	return nil
+}
+
+/*
+extensionChargeFee extension没有给出手续费时返回nil,使用photon自己的费率
+*/
+func (rs *Service) extensionChargeFee(partner, token common.Address, amount *big.Int) *big.Int {
+	if rs.extension == nil {
+		return nil
+	}
+	fee, err := rs.extension.ChargeFee(partner, token, amount)
+	if err != nil {
+		log.Error(fmt.Sprintf("extension ChargeFee err %s, use default fee policy", err))
+		return nil
+	}
+	return fee
+}
+
+/*
+extensionFilterRoutes 按照extension返回的顺序保留允许使用的路由,调用失败时不使用任何路由
+*/
+func (rs *Service) extensionFilterRoutes(token, target common.Address, amount *big.Int, routes []*route.State) []*route.State {
+	if rs.extension == nil || len(routes) == 0 {
+		return routes
+	}
+	var candidates []*extension.Route
+	id2Route := make(map[common.Hash]*route.State)
+	for _, r := range routes {
+		fee := r.TotalFee
+		if fee == nil {
+			fee = r.Fee
+		}
+		candidates = append(candidates, &extension.Route{
+			ChannelIdentifier: r.ChannelIdentifier,
+			HopNode:           r.HopNode(),
+			Path:              r.Path,
+			Fee:               fee,
+		})
+		id2Route[r.ChannelIdentifier] = r
+	}
+	allowed, err := rs.extension.FilterRoutes(token, target, amount, candidates)
+	if err != nil {
+		log.Error(fmt.Sprintf("extension FilterRoutes err %s, no route is used", err))
+		return nil
+	}
+	var result []*route.State
+	for _, a := range allowed {
+		r, ok := id2Route[a.ChannelIdentifier]
+		if !ok {
+			continue
+		}
+		//同一条路由只能使用一次
+		delete(id2Route, a.ChannelIdentifier)
+		result = append(result, r)
+	}
+	return result
+}
+
+/*
+startExtensionNotifier 把所有通知交给extension,和photon的处理异步进行,extension处理不过来时按照通知缓冲区的溢出策略丢弃
+*/
+func (rs *Service) startExtensionNotifier() {
+	sub, _ := rs.NotifyHandler.SubscribeFrom(notify.Filter{}, rs.NotifyHandler.LastSeq())
+	rs.extensionSub = sub
+	go func() {
+		defer rpanic.PanicRecover("extension notifier")
+		for r := range sub.Records() {
+			data, err := json.Marshal(r)
+			if err != nil {
+				log.Error(fmt.Sprintf("marshal notification %d err %s", r.Seq, err))
+				continue
+			}
+			err = rs.extension.Notify(data)
+			if err != nil {
+				log.Warn(fmt.Sprintf("extension Notify %d err %s", r.Seq, err))
+			}
+		}
+	}()
+}
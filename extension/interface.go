@@ -0,0 +1,90 @@
+package extension
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+Extension :
+运营方自定义的节点策略,可以是Go plugin,也可以是独立进程的sidecar.
+photon在主线程中同步调用AcceptTransfer,ChargeFee和FilterRoutes,实现必须尽快返回
+*/
+type Extension interface {
+	/*
+		收到MediatedTransfer时调用,返回错误表示拒绝这笔交易,不管自己是中转节点还是接收方
+	*/
+	AcceptTransfer(t *Transfer) error
+
+	/*
+		计算把amount转给partner时收取的手续费,返回nil表示使用photon自己的费率
+	*/
+	ChargeFee(partner, token common.Address, amount *big.Int) (fee *big.Int, err error)
+
+	/*
+		从可用的路由中选择允许使用的路由,按照返回的顺序尝试,返回空表示没有可用的路由
+	*/
+	FilterRoutes(token, target common.Address, amount *big.Int, routes []*Route) (allowed []*Route, err error)
+
+	/*
+		收到一条通知,和/api/1/notifications推送的内容相同
+	*/
+	Notify(notification []byte) error
+
+	/*
+		photon退出时调用
+	*/
+	Close() error
+}
+
+// Transfer 收到的MediatedTransfer
+type Transfer struct {
+	Token          common.Address `json:"token_address"`
+	Partner        common.Address `json:"partner_address"` //交易的上一跳
+	Initiator      common.Address `json:"initiator_address"`
+	Target         common.Address `json:"target_address"`
+	Amount         *big.Int       `json:"amount"` //包含手续费
+	Fee            *big.Int       `json:"fee"`
+	LockSecretHash common.Hash    `json:"lock_secret_hash"`
+	Expiration     int64          `json:"expiration"`
+}
+
+// Route 一条可用的路由,ChannelIdentifier是和下一跳之间的通道,在同一次调用中是唯一的
+type Route struct {
+	ChannelIdentifier common.Hash      `json:"channel_identifier"`
+	HopNode           common.Address   `json:"hop_node"`
+	Path              []common.Address `json:"path"` //为空表示只知道下一跳
+	Fee               *big.Int         `json:"fee"`
+}
+
+/*
+Base :
+所有方法都不做任何事情,实现只需要嵌入Base,再覆盖关心的方法
+*/
+type Base struct{}
+
+// AcceptTransfer :
+func (Base) AcceptTransfer(t *Transfer) error {
+	return nil
+}
+
+// ChargeFee :
+func (Base) ChargeFee(partner, token common.Address, amount *big.Int) (*big.Int, error) {
+	return nil, nil
+}
+
+// FilterRoutes :
+func (Base) FilterRoutes(token, target common.Address, amount *big.Int, routes []*Route) ([]*Route, error) {
+	return routes, nil
+}
+
+// Notify :
+func (Base) Notify(notification []byte) error {
+	return nil
+}
+
+// Close :
+func (Base) Close() error {
+	return nil
+}
@@ -0,0 +1,45 @@
+package extension
+
+import (
+	"fmt"
+	"plugin"
+)
+
+/*
+PluginSymbol Go plugin中必须导出的函数,类型为func() (extension.Extension, error).
+plugin必须使用和photon相同版本的Go以及相同版本的本package编译
+*/
+const PluginSymbol = "NewPhotonExtension"
+
+// LoadPlugin 加载Go plugin
+func LoadPlugin(path string) (Extension, error) {
+	plug, err := plugin.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("plugin open %s err %s", path, err)
+	}
+	sym, err := plug.Lookup(PluginSymbol)
+	if err != nil {
+		return nil, fmt.Errorf("plugin lookup symbol %s err %s", PluginSymbol, err)
+	}
+	newExtension, ok := sym.(func() (Extension, error))
+	if !ok {
+		return nil, fmt.Errorf("plugin symbol %s must be func() (extension.Extension, error), got %T", PluginSymbol, sym)
+	}
+	return newExtension()
+}
+
+/*
+Open 根据配置加载Go plugin或者连接sidecar,都没有配置时返回nil
+*/
+func Open(pluginPath, sidecarURL string) (Extension, error) {
+	if pluginPath != "" && sidecarURL != "" {
+		return nil, fmt.Errorf("only one of extension plugin and sidecar can be used")
+	}
+	if pluginPath != "" {
+		return LoadPlugin(pluginPath)
+	}
+	if sidecarURL != "" {
+		return NewSidecar(sidecarURL), nil
+	}
+	return nil, nil
+}
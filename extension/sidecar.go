@@ -0,0 +1,139 @@
+package extension
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+Sidecar :
+通过http调用独立进程实现的Extension,每个方法对应一个接口,请求和返回都是json,任何非2xx的返回都认为调用失败:
+	POST /accept_transfer 请求为Transfer,返回{"accept":true}或者{"accept":false,"reason":"..."}
+	POST /charge_fee 请求为{"partner_address","token_address","amount"},返回{"fee":10},fee为null表示使用photon的费率
+	POST /filter_routes 请求为{"token_address","target_address","amount","routes"},返回{"routes":[...]}
+	POST /notify 请求为通知的内容
+sidecar可以用任何语言实现,不需要和photon一起编译
+*/
+type Sidecar struct {
+	url    string
+	client *http.Client
+}
+
+// NewSidecar url是sidecar的根地址,比如http://127.0.0.1:5100
+func NewSidecar(url string) *Sidecar {
+	return &Sidecar{
+		url:    strings.TrimSuffix(url, "/"),
+		client: &http.Client{Timeout: params.ExtensionTimeout},
+	}
+}
+
+func (s *Sidecar) post(path string, payload interface{}, result interface{}) error {
+	var body []byte
+	var err error
+	if raw, ok := payload.([]byte); ok {
+		body = raw
+	} else {
+		body, err = json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+	}
+	resp, err := s.client.Post(s.url+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("extension sidecar %s unexpected status %s: %s", path, resp.Status, string(data))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
+
+type acceptTransferResponse struct {
+	Accept bool   `json:"accept"`
+	Reason string `json:"reason"`
+}
+
+// AcceptTransfer :
+func (s *Sidecar) AcceptTransfer(t *Transfer) error {
+	var resp acceptTransferResponse
+	err := s.post("/accept_transfer", t, &resp)
+	if err != nil {
+		return err
+	}
+	if !resp.Accept {
+		if resp.Reason == "" {
+			resp.Reason = "refused by extension sidecar"
+		}
+		return errors.New(resp.Reason)
+	}
+	return nil
+}
+
+type chargeFeeRequest struct {
+	Partner common.Address `json:"partner_address"`
+	Token   common.Address `json:"token_address"`
+	Amount  *big.Int       `json:"amount"`
+}
+
+type chargeFeeResponse struct {
+	Fee *big.Int `json:"fee"`
+}
+
+// ChargeFee :
+func (s *Sidecar) ChargeFee(partner, token common.Address, amount *big.Int) (*big.Int, error) {
+	var resp chargeFeeResponse
+	err := s.post("/charge_fee", &chargeFeeRequest{partner, token, amount}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Fee, nil
+}
+
+type filterRoutesRequest struct {
+	Token  common.Address `json:"token_address"`
+	Target common.Address `json:"target_address"`
+	Amount *big.Int       `json:"amount"`
+	Routes []*Route       `json:"routes"`
+}
+
+type filterRoutesResponse struct {
+	Routes []*Route `json:"routes"`
+}
+
+// FilterRoutes :
+func (s *Sidecar) FilterRoutes(token, target common.Address, amount *big.Int, routes []*Route) ([]*Route, error) {
+	var resp filterRoutesResponse
+	err := s.post("/filter_routes", &filterRoutesRequest{token, target, amount, routes}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Routes, nil
+}
+
+// Notify :
+func (s *Sidecar) Notify(notification []byte) error {
+	return s.post("/notify", notification, nil)
+}
+
+// Close :
+func (s *Sidecar) Close() error {
+	return nil
+}
@@ -0,0 +1,79 @@
+package extension
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSidecar(t *testing.T) {
+	blocked := utils.NewRandomAddress()
+	var notified []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/accept_transfer":
+			var tr Transfer
+			json.Unmarshal(body, &tr)
+			if tr.Initiator == blocked {
+				w.Write([]byte(`{"accept":false,"reason":"blocked initiator"}`))
+				return
+			}
+			w.Write([]byte(`{"accept":true}`))
+		case "/charge_fee":
+			w.Write([]byte(`{"fee":7}`))
+		case "/filter_routes":
+			var req filterRoutesRequest
+			json.Unmarshal(body, &req)
+			resp, _ := json.Marshal(&filterRoutesResponse{Routes: req.Routes[1:]})
+			w.Write(resp)
+		case "/notify":
+			notified = body
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	var e Extension = NewSidecar(server.URL + "/")
+	err := e.AcceptTransfer(&Transfer{Initiator: blocked, Amount: big.NewInt(1)})
+	if assert.NotNil(t, err) {
+		assert.EqualValues(t, "blocked initiator", err.Error())
+	}
+	assert.Nil(t, e.AcceptTransfer(&Transfer{Initiator: utils.NewRandomAddress(), Amount: big.NewInt(1)}))
+	fee, err := e.ChargeFee(utils.NewRandomAddress(), utils.NewRandomAddress(), big.NewInt(100))
+	assert.Nil(t, err)
+	assert.EqualValues(t, big.NewInt(7), fee)
+	routes := []*Route{
+		{ChannelIdentifier: utils.NewRandomHash(), HopNode: utils.NewRandomAddress()},
+		{ChannelIdentifier: utils.NewRandomHash(), HopNode: utils.NewRandomAddress(), Fee: big.NewInt(3)},
+	}
+	allowed, err := e.FilterRoutes(utils.NewRandomAddress(), utils.NewRandomAddress(), big.NewInt(1), routes)
+	assert.Nil(t, err)
+	if assert.EqualValues(t, 1, len(allowed)) {
+		assert.EqualValues(t, routes[1].ChannelIdentifier, allowed[0].ChannelIdentifier)
+	}
+	assert.Nil(t, e.Notify([]byte(`{"seq":1}`)))
+	assert.EqualValues(t, `{"seq":1}`, string(notified))
+
+	//sidecar不可用时返回错误
+	server.Close()
+	assert.NotNil(t, e.AcceptTransfer(&Transfer{}))
+}
+
+func TestOpen(t *testing.T) {
+	e, err := Open("", "")
+	assert.Nil(t, err)
+	assert.Nil(t, e)
+	_, err = Open("a.so", "http://127.0.0.1:5100")
+	assert.NotNil(t, err)
+	e, err = Open("", "http://127.0.0.1:5100")
+	assert.Nil(t, err)
+	assert.NotNil(t, e)
+}
@@ -8,9 +8,12 @@ import (
 	"errors"
 
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/SmartMeshFoundation/Photon/log"
 	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/params"
 	"github.com/SmartMeshFoundation/Photon/pfsproxy"
 	"github.com/SmartMeshFoundation/Photon/utils"
 	"github.com/ethereum/go-ethereum/common"
@@ -112,6 +115,10 @@ func (fm *FeeModule) GetNodeChargeFee(nodeAddress, tokenAddress common.Address,
 	if ok {
 		return calculateFee(feeSetting, amount)
 	}
+	// 然后启动参数中的token默认手续费
+	if mf, ok := params.MediationFeeSchedule[tokenAddress]; ok {
+		return calculateMediationFee(mf, amount)
+	}
 	// 最后account
 	return calculateFee(fm.feePolicy.AccountFee, amount)
 }
@@ -126,3 +133,60 @@ func calculateFee(feeSetting *models.FeeSetting, amount *big.Int) *big.Int {
 	}
 	return fee
 }
+
+func calculateMediationFee(mf *params.MediationFee, amount *big.Int) *big.Int {
+	return calculateFee(&models.FeeSetting{
+		FeeConstant: mf.Constant,
+		FeePercent:  mf.Percent,
+	}, amount)
+}
+
+/*
+estimatePathFee 按照params.MediationFeeSchedule估算经过`path`到达target的总手续费.
+每个中转节点都按照targetAmount计算手续费,path中的自己和target不收费,没有配置这个token时为0
+*/
+func estimatePathFee(token, ourAddress, target common.Address, targetAmount *big.Int, path []common.Address) *big.Int {
+	total := big.NewInt(0)
+	mf, ok := params.MediationFeeSchedule[token]
+	if !ok {
+		return total
+	}
+	for _, addr := range path {
+		if addr == ourAddress || addr == target {
+			continue
+		}
+		total.Add(total, calculateMediationFee(mf, targetAmount))
+	}
+	return total
+}
+
+/*
+ParseMediationFeeSchedule 解析启动参数,格式为逗号分隔的 token:constant:percent,
+比如 0x...:10:10000 表示固定收取10,另外收取金额的万分之一
+*/
+func ParseMediationFeeSchedule(s string) (schedule map[common.Address]*params.MediationFee, err error) {
+	schedule = make(map[common.Address]*params.MediationFee)
+	for _, item := range strings.Split(s, ",") {
+		fields := strings.Split(strings.TrimSpace(item), ":")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid mediation fee %s, should be token:constant:percent", item)
+		}
+		token, err := utils.HexToAddress(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid mediation fee %s: %s", item, err)
+		}
+		constant, ok := new(big.Int).SetString(fields[1], 10)
+		if !ok || constant.Sign() < 0 {
+			return nil, fmt.Errorf("invalid mediation fee %s: constant must be a non-negative integer", item)
+		}
+		percent, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil || percent < 0 {
+			return nil, fmt.Errorf("invalid mediation fee %s: percent must be a non-negative integer", item)
+		}
+		schedule[token] = &params.MediationFee{
+			Constant: constant,
+			Percent:  percent,
+		}
+	}
+	return
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/SmartMeshFoundation/Photon/codefortest"
 	"github.com/SmartMeshFoundation/Photon/models"
 	"github.com/SmartMeshFoundation/Photon/models/stormdb"
+	"github.com/SmartMeshFoundation/Photon/params"
 	"github.com/SmartMeshFoundation/Photon/pfsproxy"
 	"github.com/SmartMeshFoundation/Photon/utils"
 	"github.com/ethereum/go-ethereum/common"
@@ -120,6 +121,7 @@ func newTestStormDb() (dao models.Dao, err error) {
 	dbPath := path.Join(os.TempDir(), "testxxxx.dao")
 	err = os.Remove(dbPath)
 	err = os.Remove(dbPath + ".lock")
+	err = os.Remove(dbPath + ".history")
 	return stormdb.OpenDb(dbPath)
 }
 
@@ -135,3 +137,39 @@ func TestSlice(t *testing.T) {
 	s = append(s[:0], s[1:]...)
 	fmt.Println(s)
 }
+
+func TestMediationFeeSchedule(t *testing.T) {
+	token, other := utils.NewRandomAddress(), utils.NewRandomAddress()
+	schedule, err := ParseMediationFeeSchedule(fmt.Sprintf("%s:10:100, %s:0:0", token.String(), other.String()))
+	assert.Nil(t, err)
+	assert.EqualValues(t, big.NewInt(10), schedule[token].Constant)
+	assert.EqualValues(t, 100, schedule[token].Percent)
+	_, err = ParseMediationFeeSchedule(fmt.Sprintf("%s:10", token.String()))
+	assert.NotNil(t, err)
+	_, err = ParseMediationFeeSchedule(fmt.Sprintf("%s:-1:100", token.String()))
+	assert.NotNil(t, err)
+
+	old := params.MediationFeeSchedule
+	defer func() {
+		params.MediationFeeSchedule = old
+	}()
+	params.MediationFeeSchedule = schedule
+	db, err := newTestStormDb()
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	fm, err := NewFeeModule(db, nil)
+	assert.Nil(t, err)
+	//没有单独设置token手续费时使用启动参数
+	assert.EqualValues(t, big.NewInt(110), fm.GetNodeChargeFee(utils.NewRandomAddress(), token, big.NewInt(10000)))
+	//其他token使用account手续费
+	assert.EqualValues(t, big.NewInt(1), fm.GetNodeChargeFee(utils.NewRandomAddress(), utils.NewRandomAddress(), big.NewInt(10000)))
+
+	//两个中转节点,自己和target不收费
+	me, hop1, hop2, target := utils.NewRandomAddress(), utils.NewRandomAddress(), utils.NewRandomAddress(), utils.NewRandomAddress()
+	fee := estimatePathFee(token, me, target, big.NewInt(10000), []common.Address{me, hop1, hop2, target})
+	assert.EqualValues(t, big.NewInt(220), fee)
+	fee = estimatePathFee(utils.NewRandomAddress(), me, target, big.NewInt(10000), []common.Address{hop1, target})
+	assert.EqualValues(t, big.NewInt(0), fee)
+}
@@ -0,0 +1,76 @@
+package photon
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+)
+
+//DuplicateTransfer 幂等键已经用过时返回的原来那笔交易,以及它目前的进展
+type DuplicateTransfer struct {
+	*models.TransferIdempotency
+	Lifecycle *models.TransferLifecycle `json:"lifecycle,omitempty"` //交易记录可能已经被清理
+}
+
+func validateIdempotencyKey(key string) error {
+	if len(key) > params.IdempotencyKeyMaxLength {
+		return rerr.ErrArgumentError.Append(fmt.Sprintf("idempotency_key too long, length must <= %d", params.IdempotencyKeyMaxLength))
+	}
+	return nil
+}
+
+/*
+submitIdempotentTransfer 带幂等键的交易先记录键和LockSecretHash的对应关系再放入发送队列,
+即使随后崩溃,重启以后用同一个键重试也不会再发起一笔交易.
+键已经用过时不发起交易,返回ErrDuplicateIdempotencyKey,data中是原来那笔交易的状态.
+必须在主线程中调用,保证同一个键的并发请求也只有一个能发起交易
+*/
+func (rs *Service) submitIdempotentTransfer(r *transferReq) *utils.AsyncResult {
+	if r.IdempotencyKey == "" {
+		return rs.submitTransfer(r)
+	}
+	old, err := rs.dao.GetTransferIdempotency(r.IdempotencyKey)
+	if err == nil {
+		return utils.NewAsyncResultWithError(rs.duplicateTransferError(old, r))
+	}
+	if err != rerr.ErrNotFound {
+		return utils.NewAsyncResultWithError(err)
+	}
+	ti := &models.TransferIdempotency{
+		Key:            r.IdempotencyKey,
+		LockSecretHash: r.prepareLockSecretHash(),
+		TokenAddress:   r.TokenAddress,
+		TargetAddress:  r.Target,
+		Amount:         r.Amount,
+		IsDirect:       r.IsDirectTransfer,
+		CreateTime:     time.Now().Unix(),
+	}
+	err = rs.dao.NewTransferIdempotency(ti)
+	if err != nil {
+		//记录不下来就不能保证不重复发送
+		return utils.NewAsyncResultWithError(err)
+	}
+	return rs.submitTransfer(r)
+}
+
+/*
+duplicateTransferError 同一个键用在了不同的交易上说明调用者有问题,返回参数错误,
+否则返回原来那笔交易的状态
+*/
+func (rs *Service) duplicateTransferError(old *models.TransferIdempotency, r *transferReq) error {
+	if old.TokenAddress != r.TokenAddress || old.TargetAddress != r.Target || old.Amount.Cmp(r.Amount) != 0 || old.IsDirect != r.IsDirectTransfer {
+		return rerr.ErrArgumentError.Append(fmt.Sprintf("idempotency_key %s is already used by another transfer %s", r.IdempotencyKey, old.LockSecretHash.String()))
+	}
+	log.Info(fmt.Sprintf("duplicate transfer with idempotency_key %s, original transfer is %s", r.IdempotencyKey, utils.HPex(old.LockSecretHash)))
+	d := &DuplicateTransfer{TransferIdempotency: old}
+	l, err := rs.dao.GetTransferLifecycle(old.LockSecretHash)
+	if err == nil {
+		d.Lifecycle = l
+	}
+	return rerr.ErrDuplicateIdempotencyKey.WithData(d)
+}
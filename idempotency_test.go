@@ -0,0 +1,77 @@
+package photon
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrepareLockSecretHash(t *testing.T) {
+	r := &transferReq{}
+	lockSecretHash := r.prepareLockSecretHash()
+	assert.True(t, r.secretGenerated)
+	assert.EqualValues(t, utils.ShaSecret(r.Secret[:]), lockSecretHash)
+	//重复调用不会换密码
+	assert.EqualValues(t, lockSecretHash, r.prepareLockSecretHash())
+
+	r = &transferReq{IsDirectTransfer: true}
+	lockSecretHash = r.prepareLockSecretHash()
+	assert.NotEqual(t, utils.EmptyHash, lockSecretHash)
+	assert.EqualValues(t, r.fakeLockSecretHash, lockSecretHash)
+	assert.EqualValues(t, lockSecretHash, r.prepareLockSecretHash())
+}
+
+func TestSubmitIdempotentTransferDuplicate(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	rs := &Service{dao: dao}
+	token, target := utils.NewRandomAddress(), utils.NewRandomAddress()
+	old := &models.TransferIdempotency{
+		Key:            "order-1",
+		LockSecretHash: utils.NewRandomHash(),
+		TokenAddress:   token,
+		TargetAddress:  target,
+		Amount:         big.NewInt(10),
+	}
+	err := dao.NewTransferIdempotency(old)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	l := &models.TransferLifecycle{LockSecretHash: old.LockSecretHash}
+	l.AddTransition(models.TransferStageLockSent, "")
+	err = dao.NewTransferLifecycle(l)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	//同一笔交易重试,返回原来那笔交易的状态
+	r := &transferReq{TokenAddress: token, Target: target, Amount: big.NewInt(10), TransferOptions: TransferOptions{IdempotencyKey: "order-1"}}
+	err = <-rs.submitIdempotentTransfer(r).Result
+	se, ok := err.(rerr.StandardDataError)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.EqualValues(t, rerr.ErrDuplicateIdempotencyKey.ErrorCode, se.ErrorCode)
+	var d DuplicateTransfer
+	err = json.Unmarshal(se.Data, &d)
+	assert.Nil(t, err)
+	assert.EqualValues(t, old.LockSecretHash, d.LockSecretHash)
+	assert.EqualValues(t, models.TransferStageLockSent, d.Lifecycle.Stage)
+	//没有发起新的交易
+	assert.EqualValues(t, utils.EmptyHash, r.Secret)
+
+	//同一个键用在了另一笔交易上
+	r = &transferReq{TokenAddress: token, Target: target, Amount: big.NewInt(11), TransferOptions: TransferOptions{IdempotencyKey: "order-1"}}
+	err = <-rs.submitIdempotentTransfer(r).Result
+	se2, ok := err.(rerr.StandardError)
+	if assert.True(t, ok) {
+		assert.EqualValues(t, rerr.ErrArgumentError.ErrorCode, se2.ErrorCode)
+	}
+}
@@ -0,0 +1,250 @@
+package photon
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//InboundCapacityRequest的状态
+const (
+	InboundCapacityStatusPending  = "pending"
+	InboundCapacityStatusAccepted = "accepted" //对方同意并且已经发出了存款交易
+	InboundCapacityStatusRejected = "rejected"
+)
+
+/*
+InboundCapacityRequest 请求通道伙伴存款,增加请求方在通道中可以接收的金额.
+发出和收到的请求都会记录,只保存在内存中,重启后清零
+*/
+type InboundCapacityRequest struct {
+	ID           common.Hash    `json:"id"`
+	Token        common.Address `json:"token_address"`
+	Requester    common.Address `json:"requester"`
+	Partner      common.Address `json:"partner_address"` //被请求存款的一方
+	Amount       *big.Int       `json:"amount"`
+	FeeOffer     *big.Int       `json:"fee_offer"` //请求方愿意支付的费用,如何支付由双方自行约定
+	Reason       string         `json:"reason"`
+	Status       string         `json:"status"`
+	Response     string         `json:"response,omitempty"`
+	RequestTime  int64          `json:"request_time"`
+	ResponseTime int64          `json:"response_time,omitempty"`
+}
+
+/*
+InboundCapacityPolicy 决定如何处理收到的InboundCapacityRequest,
+handled为false表示交给用户通过/api/1/inbound_capacity处理
+*/
+type InboundCapacityPolicy interface {
+	DecideInboundCapacity(req *InboundCapacityRequest) (handled, accept bool, reason string)
+}
+
+//ManualInboundCapacityPolicy 默认策略,所有请求都由用户决定
+type ManualInboundCapacityPolicy struct{}
+
+//DecideInboundCapacity is InboundCapacityPolicy
+func (p *ManualInboundCapacityPolicy) DecideInboundCapacity(req *InboundCapacityRequest) (handled, accept bool, reason string) {
+	return false, false, ""
+}
+
+type inboundCapacityRequests struct {
+	lock     sync.Mutex
+	requests map[common.Hash]*InboundCapacityRequest
+}
+
+func newInboundCapacityRequests() *inboundCapacityRequests {
+	return &inboundCapacityRequests{
+		requests: make(map[common.Hash]*InboundCapacityRequest),
+	}
+}
+
+func (icr *inboundCapacityRequests) add(req *InboundCapacityRequest) {
+	icr.lock.Lock()
+	defer icr.lock.Unlock()
+	//同一个节点在同一个token上只保留最新的一个待处理请求
+	for id, r := range icr.requests {
+		if r.Status == InboundCapacityStatusPending && r.Requester == req.Requester && r.Partner == req.Partner && r.Token == req.Token {
+			delete(icr.requests, id)
+		}
+	}
+	icr.requests[req.ID] = req
+}
+
+func (icr *inboundCapacityRequests) get(id common.Hash) (req InboundCapacityRequest, ok bool) {
+	icr.lock.Lock()
+	defer icr.lock.Unlock()
+	r, ok := icr.requests[id]
+	if ok {
+		req = *r
+	}
+	return
+}
+
+func (icr *inboundCapacityRequests) setResult(id common.Hash, accepted bool, response string) {
+	icr.lock.Lock()
+	defer icr.lock.Unlock()
+	r, ok := icr.requests[id]
+	if !ok {
+		return
+	}
+	r.Status = InboundCapacityStatusRejected
+	if accepted {
+		r.Status = InboundCapacityStatusAccepted
+	}
+	r.Response = response
+	r.ResponseTime = time.Now().Unix()
+}
+
+//list returns copy of all requests, newest first
+func (icr *inboundCapacityRequests) list() (reqs []*InboundCapacityRequest) {
+	icr.lock.Lock()
+	defer icr.lock.Unlock()
+	for _, r := range icr.requests {
+		r2 := *r
+		reqs = append(reqs, &r2)
+	}
+	sort.Slice(reqs, func(i, j int) bool {
+		return reqs[i].RequestTime > reqs[j].RequestTime
+	})
+	return
+}
+
+func (rs *Service) checkInboundCapacityChannel(token, partner common.Address) error {
+	ch := rs.getChannel(token, partner)
+	if ch == nil {
+		return rerr.ErrChannelNotFound.Printf("no channel with %s on token %s", partner.String(), token.String())
+	}
+	if ch.State != channeltype.StateOpened {
+		return rerr.ErrChannelState.Printf("channel with %s is %s", partner.String(), ch.State)
+	}
+	return nil
+}
+
+/*
+requestInboundCapacity 请求`partner`向我们之间的通道存入`amount`
+*/
+func (rs *Service) requestInboundCapacity(r *inboundCapacityReq) (result *utils.AsyncResult) {
+	result = utils.NewAsyncResult()
+	err := rs.checkInboundCapacityChannel(r.token, r.partner)
+	if err != nil {
+		result.Result <- err
+		return
+	}
+	req := &InboundCapacityRequest{
+		ID:          utils.NewRandomHash(),
+		Token:       r.token,
+		Requester:   rs.NodeAddress,
+		Partner:     r.partner,
+		Amount:      r.amount,
+		FeeOffer:    r.feeOffer,
+		Reason:      r.reason,
+		Status:      InboundCapacityStatusPending,
+		RequestTime: time.Now().Unix(),
+	}
+	msg := encoding.NewInboundCapacityRequest(req.ID, req.Token, req.Amount, req.FeeOffer, req.Reason)
+	err = msg.Sign(rs.PrivateKey, msg)
+	if err == nil {
+		err = rs.sendAsync(req.Partner, msg)
+	}
+	if err != nil {
+		result.Result <- err
+		return
+	}
+	rs.inboundCapacityRequests.add(req)
+	result.Tag = req
+	result.Result <- nil
+	return
+}
+
+/*
+respondInboundCapacity 答复收到的请求,同意时先发出存款交易,交易发送失败则请求依然等待处理
+*/
+func (rs *Service) respondInboundCapacity(r *respondInboundCapacityReq) (result *utils.AsyncResult) {
+	req, ok := rs.inboundCapacityRequests.get(r.id)
+	if !ok || req.Partner != rs.NodeAddress {
+		return utils.NewAsyncResultWithError(rerr.ErrNotFound.Printf("inbound capacity request %s", r.id.String()))
+	}
+	if req.Status != InboundCapacityStatusPending {
+		return utils.NewAsyncResultWithError(rerr.InvalidState(fmt.Sprintf("inbound capacity request already %s", req.Status)))
+	}
+	if r.accept {
+		err := rs.checkInboundCapacityChannel(req.Token, req.Requester)
+		if err == nil {
+			err = <-rs.newChannelAndDeposit(req.Token, req.Requester, 0, req.Amount, false).Result
+		}
+		if err != nil {
+			return utils.NewAsyncResultWithError(err)
+		}
+	}
+	rs.inboundCapacityRequests.setResult(req.ID, r.accept, r.reason)
+	msg := encoding.NewInboundCapacityResponse(req.ID, r.accept, r.reason)
+	err := msg.Sign(rs.PrivateKey, msg)
+	if err == nil {
+		err = rs.sendAsync(req.Requester, msg)
+	}
+	return utils.NewAsyncResultWithError(err)
+}
+
+/*
+onInboundCapacityRequest 只处理有打开的通道的节点发来的请求,由InboundCapacityPolicy决定是否自动处理
+*/
+func (rs *Service) onInboundCapacityRequest(msg *encoding.InboundCapacityRequest) error {
+	if msg.Amount.Cmp(utils.BigInt0) <= 0 || len(msg.Reason) > params.InboundCapacityReasonMaxLength {
+		return rerr.ErrArgumentError.Printf("invalid InboundCapacityRequest %s", msg)
+	}
+	err := rs.checkInboundCapacityChannel(msg.Token, msg.Sender)
+	if err != nil {
+		return err
+	}
+	if !rs.dao.GetPartnerFilter().IsAllowed(msg.Sender) {
+		return rerr.ErrPartnerNotAllowed.Printf("partner %s is blacklisted or not whitelisted", msg.Sender.String())
+	}
+	req := &InboundCapacityRequest{
+		ID:          msg.RequestID,
+		Token:       msg.Token,
+		Requester:   msg.Sender,
+		Partner:     rs.NodeAddress,
+		Amount:      msg.Amount,
+		FeeOffer:    msg.FeeOffer,
+		Reason:      msg.Reason,
+		Status:      InboundCapacityStatusPending,
+		RequestTime: time.Now().Unix(),
+	}
+	if old, ok := rs.inboundCapacityRequests.get(req.ID); ok && old.Requester == req.Requester {
+		//重复的消息
+		return nil
+	}
+	rs.inboundCapacityRequests.add(req)
+	log.Info(fmt.Sprintf("receive inbound capacity request %s", msg))
+	handled, accept, reason := rs.InboundCapacityPolicy.DecideInboundCapacity(req)
+	if !handled {
+		return nil
+	}
+	err = <-rs.respondInboundCapacity(&respondInboundCapacityReq{id: req.ID, accept: accept, reason: reason}).Result
+	if err != nil {
+		log.Error(fmt.Sprintf("auto respond inbound capacity request %s err %s", req.ID.String(), err))
+	}
+	return nil
+}
+
+//onInboundCapacityResponse 记录对方的答复
+func (rs *Service) onInboundCapacityResponse(msg *encoding.InboundCapacityResponse) error {
+	req, ok := rs.inboundCapacityRequests.get(msg.RequestID)
+	if !ok || req.Requester != rs.NodeAddress || req.Partner != msg.Sender || req.Status != InboundCapacityStatusPending {
+		log.Warn(fmt.Sprintf("receive unexpected InboundCapacityResponse %s", msg))
+		return nil
+	}
+	rs.inboundCapacityRequests.setResult(req.ID, msg.Accepted, msg.Reason)
+	log.Info(fmt.Sprintf("receive inbound capacity response %s", msg))
+	return nil
+}
@@ -0,0 +1,45 @@
+package photon
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInboundCapacityRequests(t *testing.T) {
+	icr := newInboundCapacityRequests()
+	token := utils.NewRandomAddress()
+	requester := utils.NewRandomAddress()
+	partner := utils.NewRandomAddress()
+	newReq := func(requestTime int64) *InboundCapacityRequest {
+		return &InboundCapacityRequest{
+			ID:          utils.NewRandomHash(),
+			Token:       token,
+			Requester:   requester,
+			Partner:     partner,
+			Amount:      big.NewInt(10),
+			Status:      InboundCapacityStatusPending,
+			RequestTime: requestTime,
+		}
+	}
+	r1 := newReq(1)
+	icr.add(r1)
+	icr.setResult(r1.ID, true, "ok")
+	r, ok := icr.get(r1.ID)
+	assert.EqualValues(t, true, ok)
+	assert.EqualValues(t, InboundCapacityStatusAccepted, r.Status)
+	assert.EqualValues(t, "ok", r.Response)
+	r2 := newReq(2)
+	icr.add(r2)
+	//新的请求替换同一个节点还没有处理的请求,已经处理的请求保留
+	r3 := newReq(3)
+	icr.add(r3)
+	_, ok = icr.get(r2.ID)
+	assert.EqualValues(t, false, ok)
+	reqs := icr.list()
+	assert.EqualValues(t, 2, len(reqs))
+	assert.EqualValues(t, r3.ID, reqs[0].ID)
+	assert.EqualValues(t, r1.ID, reqs[1].ID)
+}
@@ -0,0 +1,79 @@
+package jsonrpc
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	photon "github.com/SmartMeshFoundation/Photon"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+/*
+JSON-RPC接口,供把photon作为子进程启动的桌面钱包使用,不需要打开任何网络端口.
+方法都在photon命名空间下,比如photon_address,photon_transfer,参数按位置传递,
+错误信息和REST接口一样包含errorCode
+*/
+
+//namespace 所有方法名的前缀
+const namespace = "photon"
+
+func newServer(api *photon.API) (*rpc.Server, error) {
+	srv := rpc.NewServer()
+	err := srv.RegisterName(namespace, &Service{api: api})
+	if err != nil {
+		return nil, err
+	}
+	return srv, nil
+}
+
+/*
+StartIPC 在`endpoint`指定的unix socket(windows上是named pipe)上提供服务,
+返回的listener关闭以后停止接受新连接
+*/
+func StartIPC(api *photon.API, endpoint string) (net.Listener, error) {
+	srv, err := newServer(api)
+	if err != nil {
+		return nil, err
+	}
+	l, err := rpc.CreateIPCListener(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	log.Info(fmt.Sprintf("json-rpc listening on %s", endpoint))
+	go srv.ServeListener(l)
+	return l, nil
+}
+
+//stdio 把标准输入输出当作一个连接,日志都写到stderr,不会和应答混在一起
+type stdio struct{}
+
+func (stdio) Read(p []byte) (int, error) {
+	return os.Stdin.Read(p)
+}
+
+func (stdio) Write(p []byte) (int, error) {
+	return os.Stdout.Write(p)
+}
+
+func (stdio) Close() error {
+	return nil
+}
+
+var _ io.ReadWriteCloser = stdio{}
+
+/*
+ServeStdio 从标准输入读取请求,应答写到标准输出,直到标准输入关闭才返回.
+父进程退出时标准输入会被关闭,调用者应该随之退出
+*/
+func ServeStdio(api *photon.API) error {
+	srv, err := newServer(api)
+	if err != nil {
+		return err
+	}
+	log.Info("json-rpc serving on stdin/stdout")
+	srv.ServeCodec(rpc.NewJSONCodec(stdio{}), rpc.OptionMethodInvocation)
+	return nil
+}
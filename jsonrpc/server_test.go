@@ -0,0 +1,35 @@
+package jsonrpc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func TestServer(t *testing.T) {
+	srv, err := newServer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(srv)
+	defer client.Close()
+	var modules map[string]string
+	err = client.Call(&modules, "rpc_modules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := modules[namespace]; !ok {
+		t.Errorf("namespace %s not registered, modules=%v", namespace, modules)
+	}
+	var result TransferResult
+	err = client.Call(&result, "photon_transfer", common.Address{1}, common.Address{2}, 0)
+	if err == nil || !strings.Contains(err.Error(), "invalid amount") {
+		t.Errorf("transfer with zero amount should fail, err=%v", err)
+	}
+	err = client.Call(&result, "photon_noSuchMethod")
+	if err == nil {
+		t.Error("unknown method should fail")
+	}
+}
@@ -0,0 +1,164 @@
+package jsonrpc
+
+import (
+	"math/big"
+
+	photon "github.com/SmartMeshFoundation/Photon"
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/notify"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+Service 通过JSON-RPC暴露的接口,和REST API对应,
+可选的参数放在最后并且使用指针,调用时可以省略
+*/
+type Service struct {
+	api *photon.API
+}
+
+// TransferArgs photon_transfer的可选参数
+type TransferArgs struct {
+	Secret      common.Hash                 `json:"secret"`
+	IsDirect    bool                        `json:"is_direct"`
+	Data        string                      `json:"data"`
+	PaymentID   string                      `json:"payment_id"`
+	Sync        bool                        `json:"sync"` //等待交易结束才返回
+	Constraints *photon.TransferConstraints `json:"constraints,omitempty"`
+}
+
+// TransferResult 用来查询交易状态的LockSecretHash以及可以撤销交易的操作ID
+type TransferResult struct {
+	LockSecretHash common.Hash `json:"lock_secret_hash"`
+	OperationID    string      `json:"operation_id"`
+}
+
+func orEmpty(addr *common.Address) common.Address {
+	if addr == nil {
+		return utils.EmptyAddress
+	}
+	return *addr
+}
+
+func channelDetail(c *channeltype.Serialization, err error) (*channeltype.ChannelDataDetail, error) {
+	if err != nil {
+		return nil, err
+	}
+	return channeltype.ChannelSerialization2ChannelDataDetail(c), nil
+}
+
+// Address returns this node's address
+func (s *Service) Address() common.Address {
+	return s.api.Address()
+}
+
+// Tokens returns all registered tokens
+func (s *Service) Tokens() []common.Address {
+	return s.api.Tokens()
+}
+
+// Channels 省略token或者partner时返回所有的通道
+func (s *Service) Channels(token, partner *common.Address) ([]*channeltype.ChannelDataDetail, error) {
+	cs, err := s.api.GetChannelList(orEmpty(token), orEmpty(partner))
+	if err != nil {
+		return nil, err
+	}
+	var ds []*channeltype.ChannelDataDetail
+	for _, c := range cs {
+		ds = append(ds, channeltype.ChannelSerialization2ChannelDataDetail(c))
+	}
+	return ds, nil
+}
+
+// Channel returns the channel with this identifier
+func (s *Service) Channel(channelIdentifier common.Hash) (*channeltype.ChannelDataDetail, error) {
+	return channelDetail(s.api.GetChannel(channelIdentifier))
+}
+
+// Deposit 向通道存款,`newChannel`为true时创建通道,`settleTimeout`只在创建通道时使用
+func (s *Service) Deposit(token, partner common.Address, amount *big.Int, newChannel bool, settleTimeout *int) (*channeltype.ChannelDataDetail, error) {
+	timeout := 0
+	if settleTimeout != nil {
+		timeout = *settleTimeout
+	}
+	return channelDetail(s.api.DepositAndOpenChannel(token, partner, timeout, s.api.Photon.Config.RevealTimeout, amount, newChannel))
+}
+
+// Withdraw 从通道中取现,不关闭通道
+func (s *Service) Withdraw(token, partner common.Address, amount *big.Int) (*channeltype.ChannelDataDetail, error) {
+	return channelDetail(s.api.Withdraw(token, partner, amount))
+}
+
+// Close closes the channel with `partner`
+func (s *Service) Close(token, partner common.Address) (*channeltype.ChannelDataDetail, error) {
+	return channelDetail(s.api.Close(token, partner))
+}
+
+// Settle settles the closed channel with `partner`
+func (s *Service) Settle(token, partner common.Address) (*channeltype.ChannelDataDetail, error) {
+	return channelDetail(s.api.Settle(token, partner))
+}
+
+/*
+Transfer 发起交易,默认立即返回,用photon_transferStatus查询结果,
+args.Sync为true时等待交易结束
+*/
+func (s *Service) Transfer(token, target common.Address, amount *big.Int, args *TransferArgs) (*TransferResult, error) {
+	if amount == nil || amount.Cmp(utils.BigInt0) <= 0 {
+		return nil, rerr.ErrInvalidAmount.Append("invalid amount")
+	}
+	if args == nil {
+		args = &TransferArgs{}
+	}
+	if len(args.Data) > params.MaxTransferDataLen {
+		return nil, rerr.ErrArgumentError.Printf("data is longer than %d", params.MaxTransferDataLen)
+	}
+	var payment *photon.PaymentMeta
+	if args.PaymentID != "" {
+		payment = &photon.PaymentMeta{PaymentID: args.PaymentID}
+	}
+	opts := &photon.TransferOptions{
+		Payment:     payment,
+		Constraints: args.Constraints,
+	}
+	var result *utils.AsyncResult
+	var err error
+	if args.Sync {
+		result, err = s.api.Transfer(token, amount, target, args.Secret, params.MaxRequestTimeout, args.IsDirect, args.Data, nil, opts)
+	} else {
+		result, err = s.api.TransferOperation(token, amount, target, args.Secret, args.IsDirect, args.Data, nil, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &TransferResult{
+		LockSecretHash: result.LockSecretHash,
+		OperationID:    result.ID,
+	}, nil
+}
+
+// TransferStatus 查询自己发起的交易的状态
+func (s *Service) TransferStatus(token common.Address, lockSecretHash common.Hash) (*models.SentTransferDetail, error) {
+	return s.api.Photon.GetDao().GetSentTransferDetail(token, lockSecretHash)
+}
+
+// CancelTransfer 撤销还没有泄露密码的交易
+func (s *Service) CancelTransfer(token common.Address, lockSecretHash common.Hash) error {
+	return s.api.CancelTransfer(lockSecretHash, token)
+}
+
+// Notifications 返回`sinceSeq`之后的通知,最多`limit`条,省略时最多100条
+func (s *Service) Notifications(sinceSeq uint64, limit *int) ([]*notify.Record, error) {
+	n := 100
+	if limit != nil {
+		n = *limit
+	}
+	if n <= 0 {
+		return nil, rerr.ErrArgumentError.Append("limit must be a positive integer")
+	}
+	return s.api.GetNotifications(sinceSeq, notify.Filter{}, n)
+}
@@ -0,0 +1,35 @@
+package photon
+
+import (
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer/mediator"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//countMediatedTransfers 本节点作为中间节点,正在中转的initiator发起的交易数量
+func (rs *Service) countMediatedTransfers(initiator common.Address) (n int) {
+	for _, sm := range rs.Transfer2StateManager {
+		if sm.Name != mediator.NameMediatorTransition {
+			continue
+		}
+		state, ok := sm.CurrentState.(*mediatedtransfer.MediatorState)
+		if !ok || len(state.TransfersPair) == 0 {
+			continue
+		}
+		if state.TransfersPair[0].PayerTransfer.Initiator == initiator {
+			n++
+		}
+	}
+	return
+}
+
+/*
+isMediatedInitiatorOverLimit 同一个发起方同时通过本节点中转的交易不能超过Config.MaxMediatedPerInitiator,
+避免一个节点通过大量交易占满本节点所有通道的锁定额度
+*/
+func (rs *Service) isMediatedInitiatorOverLimit(initiator common.Address) bool {
+	if rs.Config.MaxMediatedPerInitiator <= 0 {
+		return false
+	}
+	return rs.countMediatedTransfers(initiator) >= rs.Config.MaxMediatedPerInitiator
+}
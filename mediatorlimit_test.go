@@ -0,0 +1,43 @@
+package photon
+
+import (
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/transfer"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer/mediator"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer/target"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsMediatedInitiatorOverLimit(t *testing.T) {
+	rs := &Service{
+		Config:                &params.Config{},
+		Transfer2StateManager: make(map[common.Hash]*transfer.StateManager),
+	}
+	initiator := utils.NewRandomAddress()
+	addMediated := func(from common.Address) {
+		state := &mediatedtransfer.MediatorState{
+			TransfersPair: []*mediatedtransfer.MediationPairState{
+				{PayerTransfer: &mediatedtransfer.LockedTransferState{Initiator: from}},
+			},
+		}
+		rs.Transfer2StateManager[utils.NewRandomHash()] = transfer.NewStateManager(mediator.StateTransition, state, mediator.NameMediatorTransition, utils.NewRandomHash(), utils.NewRandomAddress())
+	}
+	addMediated(initiator)
+	addMediated(initiator)
+	addMediated(utils.NewRandomAddress())
+	//作为接收方的交易不计算在内
+	rs.Transfer2StateManager[utils.NewRandomHash()] = transfer.NewStateManager(target.StateTransiton, &mediatedtransfer.TargetState{}, target.NameTargetTransition, utils.NewRandomHash(), utils.NewRandomAddress())
+	assert.Equal(t, 2, rs.countMediatedTransfers(initiator))
+
+	assert.False(t, rs.isMediatedInitiatorOverLimit(initiator))
+	rs.Config.MaxMediatedPerInitiator = 3
+	assert.False(t, rs.isMediatedInitiatorOverLimit(initiator))
+	rs.Config.MaxMediatedPerInitiator = 2
+	assert.True(t, rs.isMediatedInitiatorOverLimit(initiator))
+	assert.False(t, rs.isMediatedInitiatorOverLimit(utils.NewRandomAddress()))
+}
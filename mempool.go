@@ -0,0 +1,88 @@
+package photon
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/blockchain"
+	"github.com/SmartMeshFoundation/Photon/channel"
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/notify"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//pendingClose 在交易池中看到的对方关闭通道的交易
+type pendingClose struct {
+	txHash      common.Hash
+	blockNumber int64 //看到交易时的块
+}
+
+/*
+handlePendingChannelTx 交易池中发现对方关闭或者settle自己的通道.
+关闭通道时立即通知用户,并且把通道置为StateClosing,不再通过这个通道发起新的交易,
+等关闭的交易打包以后,ContractClosedStateChange会立即提交updateBalanceProof
+*/
+func (rs *Service) handlePendingChannelTx(ptx *blockchain.PendingChannelTx) {
+	ch, err := rs.findChannelByIdentifier(ptx.ChannelIdentifier)
+	if err != nil {
+		return
+	}
+	if ptx.Method == blockchain.PendingTxSettle {
+		rs.NotifyHandler.NotifyEvent(notify.LevelWarn, &notify.Event{
+			Code:              notify.EventChannelSettlePending,
+			TokenAddress:      ptx.TokenAddress,
+			ChannelIdentifier: ptx.ChannelIdentifier,
+			Params:            map[string]string{notify.ParamPartner: ptx.Sender.String(), notify.ParamTxHash: ptx.TxHash.String()},
+		})
+		return
+	}
+	if _, ok := rs.pendingCloses[ptx.ChannelIdentifier]; ok || ch.State == channeltype.StateClosed {
+		return
+	}
+	log.Warn(fmt.Sprintf("partner %s is closing channel %s, tx=%s", utils.APex2(ptx.Sender), utils.HPex(ptx.ChannelIdentifier), ptx.TxHash.String()))
+	rs.NotifyHandler.NotifyEvent(notify.LevelError, &notify.Event{
+		Code:              notify.EventChannelClosePending,
+		TokenAddress:      ptx.TokenAddress,
+		ChannelIdentifier: ptx.ChannelIdentifier,
+		BlockNumber:       rs.GetBlockNumber(),
+		Params:            map[string]string{notify.ParamPartner: ptx.Sender.String(), notify.ParamTxHash: ptx.TxHash.String()},
+	})
+	if ch.State != channeltype.StateOpened {
+		return
+	}
+	rs.pendingCloses[ptx.ChannelIdentifier] = &pendingClose{
+		txHash:      ptx.TxHash,
+		blockNumber: rs.GetBlockNumber(),
+	}
+	ch.State = channeltype.StateClosing
+	err = rs.UpdateChannelNoTx(channel.NewChannelSerialization(ch))
+	if err != nil {
+		log.Error(fmt.Sprintf("UpdateChannelNoTx err %s", err))
+	}
+}
+
+/*
+expirePendingCloses 关闭通道的交易已经打包的不再跟踪,
+超过PendingCloseExpireBlocks还没有打包的认为已经被丢弃,恢复通道状态
+*/
+func (rs *Service) expirePendingCloses(blockNumber int64) {
+	for id, pc := range rs.pendingCloses {
+		ch, err := rs.findChannelByIdentifier(id)
+		if err != nil || ch.State != channeltype.StateClosing || ch.ExternState.ClosedBlock != 0 {
+			delete(rs.pendingCloses, id)
+			continue
+		}
+		if blockNumber-pc.blockNumber < params.PendingCloseExpireBlocks {
+			continue
+		}
+		log.Warn(fmt.Sprintf("close tx %s of channel %s is not mined after %d blocks, reopen it", pc.txHash.String(), utils.HPex(id), blockNumber-pc.blockNumber))
+		delete(rs.pendingCloses, id)
+		ch.State = channeltype.StateOpened
+		err = rs.UpdateChannelNoTx(channel.NewChannelSerialization(ch))
+		if err != nil {
+			log.Error(fmt.Sprintf("UpdateChannelNoTx err %s", err))
+		}
+	}
+}
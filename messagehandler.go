@@ -127,6 +127,26 @@ func (mh *photonMessageHandler) onMessage(msg encoding.SignedMessager, hash comm
 		}
 	case *encoding.WithdrawResponse:
 		err = mh.messageWithdrawResponse(m2)
+	case *encoding.NodeAdvertisementRequest:
+		err = mh.messageNodeAdvertisementRequest(m2)
+	case *encoding.NodeAdvertisementResponse:
+		err = mh.messageNodeAdvertisementResponse(m2)
+	case *encoding.StateBackup:
+		err = mh.photon.savePeerStateBackup(m2)
+	case *encoding.NetworkStats:
+		err = mh.photon.saveNetworkStats(m2)
+	case *encoding.CapacityUpdate:
+		err = mh.photon.onCapacityUpdate(m2)
+	case *encoding.InboundCapacityRequest:
+		err = mh.photon.onInboundCapacityRequest(m2)
+	case *encoding.InboundCapacityResponse:
+		err = mh.photon.onInboundCapacityResponse(m2)
+	case *encoding.SwapOffer:
+		err = mh.photon.onSwapOffer(m2)
+	case *encoding.SwapResponse:
+		err = mh.photon.onSwapResponse(m2)
+	case *encoding.ChannelProbe:
+		err = mh.photon.onChannelProbe(m2)
 	default:
 		log.Error(fmt.Sprintf("photonMessageHandler unknown msg:%s", utils.StringInterface1(msg)))
 		return fmt.Errorf("unhandled message cmdid:%d", msg.Cmd())
@@ -250,6 +270,7 @@ func (mh *photonMessageHandler) messageUnlock(msg *encoding.UnLock) error {
 		log.Error(fmt.Sprintf("messageUnlock RegisterTransfer err=%s", err))
 		return err
 	}
+	mh.photon.recordChannelMessage(ch, msg)
 	/*
 		验证过消息是有效的,然后通知相应的 stateMana 该结束的结束,
 	*/
@@ -294,6 +315,7 @@ func (mh *photonMessageHandler) messageRemoveExpiredHashlockTransfer(msg *encodi
 		*/
 		return err
 	}
+	mh.photon.recordChannelMessage(ch, msg)
 	mh.photon.UpdateChannelAndSaveAck(ch, msg.Tag())
 	// submit balance proof to pathfinder
 	go mh.photon.submitBalanceProofToPfs(ch)
@@ -357,6 +379,8 @@ func (mh *photonMessageHandler) messageAnnounceDisposed(msg *encoding.AnnounceDi
 		//种情况忽略即可
 		return nil
 	}
+	mh.photon.recordAnomaly(ch.TokenAddress, AnomalyAnnounceDisposed)
+	mh.photon.routeStats.recordFailure(ch.TokenAddress, msg.Sender, msg.Lock.LockSecretHash, rerr.StandardError{ErrorCode: msg.ErrorCode, ErrorMsg: msg.ErrorMsg}.Error(), false)
 	punish := models.NewReceivedAnnounceDisposed(msg.Lock.Hash(), msg.ChannelIdentifier, msg.GetAdditionalHash(), msg.OpenBlockNumber, msg.Signature)
 	err = mh.photon.dao.MarkLockHashCanPunish(punish)
 	if err != nil {
@@ -426,6 +450,7 @@ func (mh *photonMessageHandler) messageAnnounceDisposedResponse(msg *encoding.An
 	if err != nil {
 		return
 	}
+	mh.photon.recordChannelMessage(ch, msg)
 	//保存通道状态即可.
 	// Just store channel state.
 	mh.photon.UpdateChannelAndSaveAck(ch, msg.Tag())
@@ -475,6 +500,7 @@ func (mh *photonMessageHandler) messageDirectTransfer(msg *encoding.DirectTransf
 		log.Error(fmt.Sprintf("RegisterTransfer error %s\n", msg))
 		return err
 	}
+	mh.photon.recordChannelMessage(ch, msg)
 	receiveSuccess := &transfer.EventTransferReceivedSuccess{
 		Amount:            amount,
 		Initiator:         msg.Sender,
@@ -554,10 +580,15 @@ func (mh *photonMessageHandler) messageMediatedTransfer(msg *encoding.MediatedTr
 	if !ch.CanTransfer() {
 		return rerr.TransferWhenClosed(fmt.Sprintf("Mediated transfer received but the channel is  can not accept any transfer %s", ch.ChannelIdentifier.String()))
 	}
-	err := ch.RegisterTransfer(mh.photon.GetBlockNumber(), msg)
+	err := mh.photon.extensionAcceptTransfer(msg, token)
+	if err != nil {
+		return err
+	}
+	err = ch.RegisterTransfer(mh.photon.GetBlockNumber(), msg)
 	if err != nil {
 		return err
 	}
+	mh.photon.recordChannelMessage(ch, msg)
 	// only for test
 	dataForDebug := &struct {
 		SearchKey           string
@@ -699,9 +730,14 @@ func (mh *photonMessageHandler) messageSettleResponse(msg *encoding.SettleRespon
 	// 错误的response处理放在通道状态校验之后,过滤掉不是自己发起的SettleRequest的response
 	if msg.ErrorCode != rerr.ErrSuccess.ErrorCode {
 		// 失败的SettleResponse
-		notifyString := fmt.Sprintf("Cooperate settle request on channel %s has been rejected by partner,errorCode=%d errorMsg=%s", msg.ChannelIdentifier.String(), msg.ErrorCode, msg.ErrorMsg)
-		mh.photon.NotifyHandler.NotifyString(notify.InfoTypeString, notifyString)
-		log.Trace(notifyString)
+		mh.photon.NotifyHandler.NotifyEvent(notify.LevelWarn, &notify.Event{
+			Code:              notify.EventCooperateSettleRefused,
+			TokenAddress:      ch.TokenAddress,
+			ChannelIdentifier: msg.ChannelIdentifier,
+			ErrorCode:         msg.ErrorCode,
+			Params:            map[string]string{notify.ParamError: msg.ErrorMsg},
+		})
+		log.Trace(fmt.Sprintf("Cooperate settle request on channel %s has been rejected by partner,errorCode=%d errorMsg=%s", msg.ChannelIdentifier.String(), msg.ErrorCode, msg.ErrorMsg))
 		return nil
 	}
 	err := ch.RegisterCooperativeSettleResponse(msg)
@@ -715,7 +751,11 @@ func (mh *photonMessageHandler) messageSettleResponse(msg *encoding.SettleRespon
 		err = <-result.Result
 		if err != nil {
 			log.Error(fmt.Sprintf("CooperativeSettleChannel %s failed, so we can only close/settle this channel, err = %s", utils.HPex(msg.ChannelIdentifier), err.Error()))
-			mh.photon.NotifyHandler.NotifyString(notify.LevelWarn, fmt.Sprintf("CooperateSettle通道失败,建议强制close/settle通道,ChannelIdentifier=%s", msg.ChannelIdentifier.String()))
+			mh.photon.NotifyHandler.NotifyEvent(notify.LevelWarn, &notify.Event{
+				Code:              notify.EventCooperateSettleFailed,
+				TokenAddress:      ch.TokenAddress,
+				ChannelIdentifier: msg.ChannelIdentifier,
+			})
 		}
 	}()
 	return nil
@@ -790,9 +830,14 @@ func (mh *photonMessageHandler) messageWithdrawResponse(msg *encoding.WithdrawRe
 	// 错误的response处理放在通道状态校验之后,过滤掉不是自己发起的WithdrawRequest的response
 	if msg.ErrorCode != rerr.ErrSuccess.ErrorCode {
 		// 失败的WithdrawResponse
-		notifyString := fmt.Sprintf("Withdraw request on channel %s has been rejected by partner,errorCode=%d errorMsg=%s", msg.ChannelIdentifier.String(), msg.ErrorCode, msg.ErrorMsg)
-		mh.photon.NotifyHandler.NotifyString(notify.InfoTypeString, notifyString)
-		log.Trace(notifyString)
+		mh.photon.NotifyHandler.NotifyEvent(notify.LevelWarn, &notify.Event{
+			Code:              notify.EventWithdrawRefused,
+			TokenAddress:      ch.TokenAddress,
+			ChannelIdentifier: msg.ChannelIdentifier,
+			ErrorCode:         msg.ErrorCode,
+			Params:            map[string]string{notify.ParamError: msg.ErrorMsg},
+		})
+		log.Trace(fmt.Sprintf("Withdraw request on channel %s has been rejected by partner,errorCode=%d errorMsg=%s", msg.ChannelIdentifier.String(), msg.ErrorCode, msg.ErrorMsg))
 		return nil
 	}
 	/*
@@ -816,3 +861,54 @@ func (mh *photonMessageHandler) messageWithdrawResponse(msg *encoding.WithdrawRe
 	}()
 	return nil
 }
+
+/*
+messageNodeAdvertisementRequest 返回自己签名的公开信息,没有发布的话Data为空
+*/
+func (mh *photonMessageHandler) messageNodeAdvertisementRequest(msg *encoding.NodeAdvertisementRequest) error {
+	var data []byte
+	na, err := mh.photon.dao.GetNodeAdvertisement()
+	if err == nil {
+		data, err = json.Marshal(na)
+		if err != nil {
+			return err
+		}
+	}
+	resp := encoding.NewNodeAdvertisementResponse(msg.Nonce, data)
+	err = resp.Sign(mh.photon.PrivateKey, resp)
+	if err != nil {
+		return err
+	}
+	return mh.photon.sendAsync(msg.Sender, resp)
+}
+
+/*
+messageNodeAdvertisementResponse 校验对方的签名,并通知等待的查询
+*/
+func (mh *photonMessageHandler) messageNodeAdvertisementResponse(msg *encoding.NodeAdvertisementResponse) error {
+	q, ok := mh.photon.NodeAdvertisementQueryMap[msg.Nonce]
+	if !ok || q.target != msg.Sender {
+		log.Warn(fmt.Sprintf("receive unexpected NodeAdvertisementResponse %s", msg))
+		return nil
+	}
+	delete(mh.photon.NodeAdvertisementQueryMap, msg.Nonce)
+	if len(msg.Data) == 0 {
+		q.result.Result <- rerr.ErrNotFound.Printf("node %s has no advertisement", msg.Sender.String())
+		return nil
+	}
+	na := &models.NodeAdvertisement{}
+	err := json.Unmarshal(msg.Data, na)
+	if err == nil && na.NodeAddress != msg.Sender {
+		err = fmt.Errorf("advertisement of %s sent by %s", na.NodeAddress.String(), msg.Sender.String())
+	}
+	if err == nil {
+		err = na.VerifySignature()
+	}
+	if err != nil {
+		q.result.Result <- rerr.ErrArgumentError.Printf("invalid node advertisement %s", err)
+		return nil
+	}
+	q.result.Tag = na
+	q.result.Result <- nil
+	return nil
+}
@@ -82,6 +82,7 @@ func (a *API) GetChannelList() (result string) {
 			TokenAddress:        c.TokenAddress().String(),
 			SettleTimeout:       c.SettleTimeout,
 			RevealTimeout:       c.RevealTimeout,
+			SettleCountdown:     a.api.GetSettleCountdown(c),
 		}
 		datas = append(datas, d)
 	}
@@ -156,7 +157,9 @@ func (a *API) GetOneChannel(channelIdentifier string) (result string) {
 		result = dto.NewErrorMobileResponse(err)
 		return
 	}
-	result = dto.NewSuccessMobileResponse(channeltype.ChannelSerialization2ChannelDataDetail(c))
+	d := channeltype.ChannelSerialization2ChannelDataDetail(c)
+	d.SettleCountdown = a.api.GetSettleCountdown(c)
+	result = dto.NewSuccessMobileResponse(d)
 	return
 }
 
@@ -225,6 +228,31 @@ func (a *API) deposit(partnerAddress, tokenAddress string, settleTimeout int, ba
 	return
 }
 
+/*
+DepositDryRun 使用和Deposit相同的参数模拟存款,不发送任何交易,返回存款是否能够成功以及存入通道的金额
+*/
+func (a *API) DepositDryRun(partnerAddress, tokenAddress string, settleTimeout int, balanceStr string, newChannel bool) (result string) {
+	defer func() {
+		log.Trace(fmt.Sprintf("ApiCall DepositDryRun partnerAddress=%s,tokenAddress=%s,settleTimeout=%d,balanceStr=%s,newChannel=%v,result=%s",
+			partnerAddress, tokenAddress, settleTimeout, balanceStr, newChannel, result,
+		))
+	}()
+	partnerAddr, err := utils.HexToAddressWithoutValidation(partnerAddress)
+	if err != nil {
+		return dto.NewErrorMobileResponse(rerr.ErrArgumentError.AppendError(err))
+	}
+	tokenAddr, err := utils.HexToAddressWithoutValidation(tokenAddress)
+	if err != nil {
+		return dto.NewErrorMobileResponse(rerr.ErrArgumentError.AppendError(err))
+	}
+	balance, ok := new(big.Int).SetString(balanceStr, 0)
+	if !ok {
+		return dto.NewErrorMobileResponse(rerr.ErrArgumentError.Append("invalid balance"))
+	}
+	r, err := a.api.DepositDryRun(tokenAddr, partnerAddr, settleTimeout, balance, newChannel)
+	return dto.NewMobileResponse(err, r)
+}
+
 /*
 CloseChannel close the  channel
 如果force 为false,则表示希望双方协商关闭通道,
@@ -518,7 +546,7 @@ func (a *API) Transfers(tokenAddress, targetAddress string, amountstr string, se
 			return dto.NewErrorMobileResponse(err)
 		}
 	}
-	tr, err := a.api.TransferAsync(tokenAddr, amount, targetAddr, secret, isDirect, data, routeInfo)
+	tr, err := a.api.TransferAsync(tokenAddr, amount, targetAddr, secret, isDirect, data, routeInfo, nil)
 	if err != nil {
 		log.Error(err.Error())
 		return dto.NewErrorMobileResponse(err)
@@ -806,6 +834,12 @@ func (a *API) Subscribe(handler NotifyHandler) (sub *Subscription, err error) {
 			log.Error(fmt.Sprintf("mix transport get notify err %s", err))
 			return
 		}
+	case *network.PriorityTransport:
+		xn, err = t.GetNotify()
+		if err != nil {
+			log.Error(fmt.Sprintf("priority transport get notify err %s", err))
+			return
+		}
 	default:
 		xn = make(chan netshare.Status)
 	}
@@ -1035,3 +1069,94 @@ func (a *API) ContractCallTXQuery(channelIdentifierStr string, openBlockNumber i
 func (a *API) Version() string {
 	return dto.NewSuccessMobileResponse(a.api.GetBuildInfo())
 }
+
+/*
+Ping 诊断与节点`nodeAddressStr`之间的连通性,分别给出在线状态,transport,protocol以及通道各层的检查结果
+*/
+func (a *API) Ping(nodeAddressStr string) (result string) {
+	defer func() {
+		log.Trace(fmt.Sprintf("ApiCall Ping result=%s", result))
+	}()
+	nodeAddress, err := utils.HexToAddress(nodeAddressStr)
+	if err != nil {
+		return dto.NewErrorMobileResponse(rerr.ErrArgumentError.AppendError(err))
+	}
+	resp, err := a.api.Ping(nodeAddress, params.DefaultPingTimeout)
+	return dto.NewMobileResponse(err, resp)
+}
+
+/*
+GetNodeAdvertisement 查询节点`nodeAddressStr`的公开信息,为空时返回自己发布的信息
+*/
+func (a *API) GetNodeAdvertisement(nodeAddressStr string) (result string) {
+	defer func() {
+		log.Trace(fmt.Sprintf("ApiCall GetNodeAdvertisement result=%s", result))
+	}()
+	nodeAddress := a.api.Address()
+	if nodeAddressStr != "" {
+		var err error
+		nodeAddress, err = utils.HexToAddress(nodeAddressStr)
+		if err != nil {
+			return dto.NewErrorMobileResponse(rerr.ErrArgumentError.AppendError(err))
+		}
+	}
+	na, err := a.api.GetNodeAdvertisement(nodeAddress, params.DefaultQueryNodeAdvertisementTimeout)
+	return dto.NewMobileResponse(err, na)
+}
+
+/*
+SetNodeAdvertisement 发布自己的公开信息,`advertisementStr`为json格式的models.NodeAdvertisement
+*/
+func (a *API) SetNodeAdvertisement(advertisementStr string) (result string) {
+	defer func() {
+		log.Trace(fmt.Sprintf("ApiCall SetNodeAdvertisement advertisement=%s,result=%s", advertisementStr, result))
+	}()
+	na := &models.NodeAdvertisement{}
+	err := json.Unmarshal([]byte(advertisementStr), na)
+	if err != nil {
+		return dto.NewErrorMobileResponse(rerr.ErrArgumentError.AppendError(err))
+	}
+	na, err = a.api.SetNodeAdvertisement(na)
+	return dto.NewMobileResponse(err, na)
+}
+
+/*
+GetPeerStatistics 获取各个节点发来的违反协议的消息统计,达到阈值的节点会被列入灰名单,路由时不再经过
+*/
+func (a *API) GetPeerStatistics() (result string) {
+	defer func() {
+		log.Trace(fmt.Sprintf("ApiCall GetPeerStatistics result=%s", result))
+	}()
+	return dto.NewSuccessMobileResponse(a.api.GetPeerStatistics())
+}
+
+/*
+DelegateMonitoring 离线之前把通道`channelIdentifierStr`中对方给我的最新BalanceProof委托给第三方监控服务,
+为空时委托所有打开的并且对方给我转过账的通道
+*/
+func (a *API) DelegateMonitoring(channelIdentifierStr string) (result string) {
+	defer func() {
+		log.Trace(fmt.Sprintf("ApiCall DelegateMonitoring channelIdentifier=%s,result=%s", channelIdentifierStr, result))
+	}()
+	if channelIdentifierStr == "" {
+		ds, err := a.api.DelegateAllMonitoring()
+		return dto.NewMobileResponse(err, ds)
+	}
+	channelIdentifier := common.HexToHash(channelIdentifierStr)
+	if channelIdentifier == utils.EmptyHash {
+		return dto.NewErrorMobileResponse(rerr.ErrArgumentError.Append("invalid channel identifier"))
+	}
+	d, err := a.api.DelegateMonitoring(channelIdentifier)
+	return dto.NewMobileResponse(err, d)
+}
+
+/*
+GetMonitoringDelegations 列出还有效的监控委托,outdated为true的委托以后又收到了新的BalanceProof,需要重新委托
+*/
+func (a *API) GetMonitoringDelegations() (result string) {
+	defer func() {
+		log.Trace(fmt.Sprintf("ApiCall GetMonitoringDelegations result=%s", result))
+	}()
+	ds, err := a.api.GetMonitoringDelegations()
+	return dto.NewMobileResponse(err, ds)
+}
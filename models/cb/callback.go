@@ -12,3 +12,6 @@ type NewTokenCb func(token common.Address) (remove bool)
 //ChannelCb notify when channel status changed
 //return true to remove this callback, all the callback should never block.
 type ChannelCb func(c *channeltype.Serialization) (remove bool)
+
+//ID 注册回调时返回,用于撤销这个回调
+type ID uint64
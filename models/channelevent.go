@@ -0,0 +1,75 @@
+package models
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//ChannelEventType 通道审计记录的类型
+type ChannelEventType string
+
+const (
+	//ChannelEventBalanceProof DirectTransfer更新了BalanceProof
+	ChannelEventBalanceProof ChannelEventType = "balance_proof"
+	//ChannelEventLockAdded MediatedTransfer增加了一个锁
+	ChannelEventLockAdded ChannelEventType = "lock_added"
+	//ChannelEventLockUnlocked Unlock移除了一个锁,锁的金额转给了对方
+	ChannelEventLockUnlocked ChannelEventType = "lock_unlocked"
+	//ChannelEventLockExpired RemoveExpiredHashlockTransfer移除了一个过期的锁
+	ChannelEventLockExpired ChannelEventType = "lock_expired"
+	//ChannelEventLockDisposed AnnounceDisposedResponse移除了一个放弃的锁
+	ChannelEventLockDisposed ChannelEventType = "lock_disposed"
+	//ChannelEventDeposit 链上存款,Amount是存款以后的余额
+	ChannelEventDeposit ChannelEventType = "deposit"
+	//ChannelEventWithdraw 链上取现,Amount是取现以后Participant的余额
+	ChannelEventWithdraw ChannelEventType = "withdraw"
+	//ChannelEventClosed 链上关闭通道,Participant是关闭方
+	ChannelEventClosed ChannelEventType = "closed"
+	//ChannelEventSettled 链上结算通道,包括合作结算
+	ChannelEventSettled ChannelEventType = "settled"
+)
+
+/*
+ChannelEvent 通道上发生的一次BalanceProof交换或者链上事件,只追加不修改,用于出现争议时核对双方的状态.
+消息的MessageHash和合约验证签名时使用的一致,链上事件没有MessageHash.
+通道关闭以后再次打开ChannelIdentifier不变,用OpenBlockNumber区分
+*/
+type ChannelEvent struct {
+	Key               string           `storm:"id" json:"-"`
+	ChannelIdentifier common.Hash      `storm:"index" json:"channel_identifier"`
+	OpenBlockNumber   int64            `json:"open_block_number"`
+	BlockNumber       int64            `json:"block_number"`
+	Type              ChannelEventType `json:"type"`
+	Participant       common.Address   `json:"participant"` //消息的签名者,或者链上事件的参与方
+	MessageHash       common.Hash      `json:"message_hash,omitempty"`
+	Nonce             uint64           `json:"nonce,omitempty"`
+	TransferAmount    *big.Int         `json:"transfer_amount,omitempty"`
+	Locksroot         common.Hash      `json:"locksroot,omitempty"`
+	LockSecretHash    common.Hash      `json:"lock_secret_hash,omitempty"`
+	Amount            *big.Int         `json:"amount,omitempty"` //锁的金额,或者链上事件以后的余额
+	Time              int64            `json:"time"`             //记录时间,纳秒
+}
+
+/*
+MakeKey 消息用MessageHash,链上事件用类型,块号和参与方,这样重复收到的消息和重启后重复处理的链上事件只记录一次
+*/
+func (e *ChannelEvent) MakeKey() string {
+	if e.MessageHash != utils.EmptyHash {
+		return e.MessageHash.String()
+	}
+	return fmt.Sprintf("%s-%s-%d-%d-%s", e.ChannelIdentifier.String(), e.Type, e.OpenBlockNumber, e.BlockNumber, e.Participant.String())
+}
+
+//SortChannelEvents 按照块号排序,同一块中按照记录的先后
+func SortChannelEvents(events []*ChannelEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].BlockNumber != events[j].BlockNumber {
+			return events[i].BlockNumber < events[j].BlockNumber
+		}
+		return events[i].Time < events[j].Time
+	})
+}
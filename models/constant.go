@@ -2,8 +2,8 @@ package models
 
 import "github.com/ethereum/go-ethereum/common"
 
-// DbVersion :
-const DbVersion = 1
+// DbVersion : 数据库格式变化时增加,同时在stormdb的dbMigrations中增加升级方法
+const DbVersion = 2
 
 // ChannelParticipantMap : used by BucketChannel
 type ChannelParticipantMap map[common.Hash][]byte
@@ -52,6 +52,24 @@ const (
 	BucketTXInfo                   = "TXInfo"
 	BucketSentTransferDetail       = "SentTransferDetail"
 	BucketChainEventRecord         = "ChainEventRecord"
+	BucketPartnerFilter            = "PartnerFilter"
+	BucketNodeAdvertisement        = "NodeAdvertisement"
+	BucketPeerStateBackup          = "PeerStateBackup"
+	BucketOperation                = "Operation"
+	BucketOfflineTxBundle          = "OfflineTxBundle"
+	BucketNetworkStatsReport       = "NetworkStatsReport"
+	BucketWebhookDeadLetter        = "WebhookDeadLetter"
+	BucketNotification             = "Notification"
+	BucketTransferLifecycle        = "TransferLifecycle"
+	BucketTransferIdempotency      = "TransferIdempotency"
+	BucketStateManagerSnapshot     = "StateManagerSnapshot"
+	BucketStateChangeLog           = "StateChangeLog"
+	BucketStateChangeWAL           = "StateChangeWAL"
+	BucketPendingUnlock            = "PendingUnlock"
+	BucketMonitoringDelegation     = "MonitoringDelegation"
+	BucketPfsIOU                   = "PfsIOU"
+	BucketSwapOrder                = "SwapOrder"
+	BucketChannelEvent             = "ChannelEvent"
 )
 
 /*
@@ -63,6 +81,8 @@ const (
 	KeyCloseFlag      = "close"
 	KeyRegistry       = "registry"
 	KeySecretRegistry = "secretregistry"
+	// keys of BucketMeta in history db
+	KeyHistoryMigrated = "historymigrated"
 
 	// keys of BucketBlockNumber
 	KeyBlockNumber     = "blocknumber"
@@ -73,6 +93,10 @@ const (
 
 	// keys of BucketFeePolicy
 	KeyFeePolicy string = "feePolicy"
+	// keys of BucketPartnerFilter
+	KeyPartnerFilter string = "partnerFilter"
+	// keys of BucketNodeAdvertisement
+	KeyNodeAdvertisement string = "nodeAdvertisement"
 	// keys of BucketToken
 	KeyToken = "tokens"
 )
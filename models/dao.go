@@ -114,6 +114,67 @@ type FeePolicyDao interface {
 	GetFeePolicy() (fp *FeePolicy)
 }
 
+// PartnerFilterDao :
+type PartnerFilterDao interface {
+	SavePartnerFilter(pf *PartnerFilter) (err error)
+	GetPartnerFilter() (pf *PartnerFilter)
+}
+
+// NodeAdvertisementDao :
+type NodeAdvertisementDao interface {
+	SaveNodeAdvertisement(na *NodeAdvertisement) (err error)
+	GetNodeAdvertisement() (na *NodeAdvertisement, err error)
+}
+
+// StateBackupDao :
+type StateBackupDao interface {
+	SavePeerStateBackup(b *PeerStateBackup) (err error)
+	GetPeerStateBackup(owner common.Address) (b *PeerStateBackup, err error)
+	GetAllPeerStateBackup() (bs []*PeerStateBackup, err error)
+}
+
+// OfflineTxBundleDao :
+type OfflineTxBundleDao interface {
+	SaveOfflineTxBundle(b *OfflineTxBundle) (err error)
+	GetOfflineTxBundle(channelIdentifier common.Hash) (b *OfflineTxBundle, err error)
+	GetAllOfflineTxBundles() (bs []*OfflineTxBundle, err error)
+	RemoveOfflineTxBundle(channelIdentifier common.Hash) (err error)
+}
+
+// OperationDao :
+type OperationDao interface {
+	SaveOperation(op *Operation) (err error)
+	GetOperation(id string) (op *Operation, err error)
+	GetAllOperations() (ops []*Operation, err error)
+	RemoveOperation(id string) (err error)
+}
+
+// WebhookDeadLetterDao :
+type WebhookDeadLetterDao interface {
+	SaveWebhookDeadLetter(dl *WebhookDeadLetter) (err error)
+	GetWebhookDeadLetter(id string) (dl *WebhookDeadLetter, err error)
+	GetAllWebhookDeadLetters() (dls []*WebhookDeadLetter, err error)
+	RemoveWebhookDeadLetter(id string) (err error)
+}
+
+// NotificationDao :
+type NotificationDao interface {
+	SaveNotification(n *Notification) (err error)
+	//GetNotifications 按照ID从小到大返回ID大于sinceID的最多limit条通知
+	GetNotifications(sinceID uint64, limit int) (ns []*Notification, err error)
+	//GetLastNotificationID 没有通知时返回0
+	GetLastNotificationID() (id uint64, err error)
+	//RemoveNotificationsBefore 删除ID小于id的通知
+	RemoveNotificationsBefore(id uint64) (err error)
+}
+
+// NetworkStatsDao :
+type NetworkStatsDao interface {
+	SaveNetworkStatsReport(r *NetworkStatsReport) (err error)
+	GetAllNetworkStatsReports() (rs []*NetworkStatsReport, err error)
+	RemoveNetworkStatsReport(reporterID common.Hash) (err error)
+}
+
 // NonParticipantChannelDao :
 type NonParticipantChannelDao interface {
 	NewNonParticipantChannel(token common.Address, channelIdentifier common.Hash, participant1, participant2 common.Address) error
@@ -153,18 +214,93 @@ type TokenDao interface {
 
 // ReceivedTransferDao :
 type ReceivedTransferDao interface {
-	NewReceivedTransfer(blockNumber int64, channelIdentifier common.Hash, openBlockNumber int64, tokenAddr, fromAddr common.Address, nonce uint64, amount *big.Int, lockSecretHash common.Hash, data string) *ReceivedTransfer
+	NewReceivedTransfer(blockNumber int64, channelIdentifier common.Hash, openBlockNumber int64, tokenAddr, fromAddr common.Address, nonce uint64, amount *big.Int, lockSecretHash common.Hash, data string, paymentID string, invoice []byte) *ReceivedTransfer
 	GetReceivedTransfer(key string) (*ReceivedTransfer, error)
 	GetReceivedTransferList(tokenAddress common.Address, fromBlock, toBlock, fromTime, toTime int64) (transfers []*ReceivedTransfer, err error)
+	GetReceivedTransfersByPaymentID(paymentID string) (transfers []*ReceivedTransfer, err error)
+}
+
+// TransferLifecycleDao :
+type TransferLifecycleDao interface {
+	NewTransferLifecycle(l *TransferLifecycle) error
+	//AddTransferTransition 没有这笔交易时返回rerr.ErrNotFound,比如作为中间节点
+	AddTransferTransition(lockSecretHash common.Hash, stage TransferStage, reason string) (*TransferLifecycle, error)
+	//SetTransferRoute 记录交易成功时付出的手续费和使用的路由,没有这笔交易时返回rerr.ErrNotFound
+	SetTransferRoute(lockSecretHash common.Hash, fee *big.Int, path []common.Address) error
+	GetTransferLifecycle(lockSecretHash common.Hash) (*TransferLifecycle, error)
+}
+
+// TransferIdempotencyDao :
+type TransferIdempotencyDao interface {
+	NewTransferIdempotency(t *TransferIdempotency) error
+	//GetTransferIdempotency 没有用过这个键时返回rerr.ErrNotFound
+	GetTransferIdempotency(key string) (*TransferIdempotency, error)
+}
+
+// StateManagerSnapshotDao :
+type StateManagerSnapshotDao interface {
+	//SaveStateManagerSnapshot 保存快照,同时删除快照已经包含的StateChangeLog
+	SaveStateManagerSnapshot(s *StateManagerSnapshot) error
+	GetAllStateManagerSnapshots() ([]*StateManagerSnapshot, error)
+	//RemoveStateManagerSnapshot 交易结束以后删除快照以及所有的StateChangeLog
+	RemoveStateManagerSnapshot(key common.Hash) error
+	NewStateChangeLog(l *StateChangeLog) error
+	//GetStateChangeLogs 按照Seq排序
+	GetStateChangeLogs(key common.Hash) ([]*StateChangeLog, error)
+}
+
+// StateChangeWALDao :
+type StateChangeWALDao interface {
+	//AppendStateChangeWAL 不管数据库的fsync策略是什么,都要fsync以后才返回
+	AppendStateChangeWAL(data []byte) (id uint64, err error)
+	RemoveStateChangeWAL(id uint64) error
+	//GetAllStateChangeWAL 按照写入顺序排序
+	GetAllStateChangeWAL() ([]*StateChangeWALEntry, error)
+}
+
+// PendingUnlockDao :
+type PendingUnlockDao interface {
+	SavePendingUnlock(p *PendingUnlock) error
+	GetAllPendingUnlocks() ([]*PendingUnlock, error)
+	RemovePendingUnlock(key common.Hash) error
+}
+
+// MonitoringDelegationDao :
+type MonitoringDelegationDao interface {
+	SaveMonitoringDelegation(d *MonitoringDelegation) error
+	GetAllMonitoringDelegations() ([]*MonitoringDelegation, error)
+	RemoveMonitoringDelegation(channelIdentifier common.Hash) error
+}
+
+// PfsIOUDao :
+type PfsIOUDao interface {
+	SavePfsIOU(iou *PfsIOU) error
+	GetPfsIOU(receiver common.Address) (*PfsIOU, error)
+}
+
+// SwapOrderDao :
+type SwapOrderDao interface {
+	SaveSwapOrder(o *SwapOrder) error
+	GetSwapOrder(lockSecretHash common.Hash) (*SwapOrder, error)
+	GetAllSwapOrders() ([]*SwapOrder, error)
+}
+
+// ChannelEventDao :
+type ChannelEventDao interface {
+	//NewChannelEvent 同样的记录已经存在时忽略
+	NewChannelEvent(e *ChannelEvent) error
+	//GetChannelEvents 返回通道[fromBlock,toBlock)之间的记录,按照块号排序,toBlock小于等于0时不限制
+	GetChannelEvents(channelIdentifier common.Hash, fromBlock, toBlock int64) ([]*ChannelEvent, error)
 }
 
 // SentTransferDetailDao :
 type SentTransferDetailDao interface {
-	NewSentTransferDetail(tokenAddress, target common.Address, amount *big.Int, data string, isDirect bool, lockSecretHash common.Hash)
+	NewSentTransferDetail(tokenAddress, target common.Address, amount *big.Int, data string, isDirect bool, lockSecretHash common.Hash, paymentID string, invoice []byte)
 	UpdateSentTransferDetailStatus(tokenAddress common.Address, lockSecretHash common.Hash, status TransferStatusCode, statusMessage string, otherParams interface{}) (transfer *SentTransferDetail)
 	UpdateSentTransferDetailStatusMessage(tokenAddress common.Address, lockSecretHash common.Hash, statusMessage string) (transfer *SentTransferDetail)
 	GetSentTransferDetail(tokenAddress common.Address, lockSecretHash common.Hash) (*SentTransferDetail, error)
 	GetSentTransferDetailList(tokenAddress common.Address, fromTime, toTime int64, fromBlock, toBlock int64) (transfers []*SentTransferDetail, err error)
+	GetSentTransferDetailsByPaymentID(paymentID string) (transfers []*SentTransferDetail, err error)
 }
 
 // XMPPSubDao :
@@ -203,6 +339,14 @@ type Dao interface {
 	SentEnvelopMessagerDao
 	FeeChargeRecordDao
 	FeePolicyDao
+	PartnerFilterDao
+	NodeAdvertisementDao
+	StateBackupDao
+	NetworkStatsDao
+	OperationDao
+	WebhookDeadLetterDao
+	NotificationDao
+	OfflineTxBundleDao
 	NonParticipantChannelDao
 	SentAnnounceDisposedDao
 	ReceivedAnnounceDisposedDao
@@ -212,16 +356,26 @@ type Dao interface {
 	XMPPSubDao
 	TXInfoDao
 	SentTransferDetailDao
+	TransferLifecycleDao
+	TransferIdempotencyDao
+	StateManagerSnapshotDao
+	StateChangeWALDao
+	PendingUnlockDao
+	MonitoringDelegationDao
+	PfsIOUDao
+	SwapOrderDao
+	ChannelEventDao
 	ChainEventRecordDao
 
 	StartTx() (tx TX)
 	CloseDB()
 
-	RegisterNewTokenCallback(f cb.NewTokenCb)
-	RegisterNewChannelCallback(f cb.ChannelCb)
-	RegisterChannelDepositCallback(f cb.ChannelCb)
-	RegisterChannelStateCallback(f cb.ChannelCb)
-	RegisterChannelSettleCallback(f cb.ChannelCb)
+	RegisterNewTokenCallback(f cb.NewTokenCb) (id cb.ID)
+	RegisterNewChannelCallback(f cb.ChannelCb) (id cb.ID)
+	RegisterChannelDepositCallback(f cb.ChannelCb) (id cb.ID)
+	RegisterChannelStateCallback(f cb.ChannelCb) (id cb.ID)
+	RegisterChannelSettleCallback(f cb.ChannelCb) (id cb.ID)
+	RemoveCallback(id cb.ID)
 }
 
 //GeneratDBError helper function
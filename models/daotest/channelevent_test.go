@@ -0,0 +1,77 @@
+package daotest
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_ChannelEvent(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	channelIdentifier := utils.NewRandomHash()
+	events, err := dao.GetChannelEvents(channelIdentifier, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(events))
+	participant := utils.NewRandomAddress()
+	deposit := &models.ChannelEvent{
+		ChannelIdentifier: channelIdentifier,
+		OpenBlockNumber:   3,
+		BlockNumber:       5,
+		Type:              models.ChannelEventDeposit,
+		Participant:       participant,
+		Amount:            big.NewInt(100),
+	}
+	lock := &models.ChannelEvent{
+		ChannelIdentifier: channelIdentifier,
+		OpenBlockNumber:   3,
+		BlockNumber:       9,
+		Type:              models.ChannelEventLockAdded,
+		Participant:       participant,
+		MessageHash:       utils.NewRandomHash(),
+		Nonce:             1,
+		TransferAmount:    big.NewInt(0),
+		LockSecretHash:    utils.NewRandomHash(),
+		Amount:            big.NewInt(10),
+	}
+	//先记录块号大的,查询结果按照块号排序
+	assert.Nil(t, dao.NewChannelEvent(lock))
+	assert.Nil(t, dao.NewChannelEvent(deposit))
+	//重复的记录被忽略
+	assert.Nil(t, dao.NewChannelEvent(&models.ChannelEvent{
+		ChannelIdentifier: channelIdentifier,
+		OpenBlockNumber:   3,
+		BlockNumber:       5,
+		Type:              models.ChannelEventDeposit,
+		Participant:       participant,
+		Amount:            big.NewInt(200),
+	}))
+	assert.Nil(t, dao.NewChannelEvent(&models.ChannelEvent{
+		ChannelIdentifier: utils.NewRandomHash(),
+		BlockNumber:       9,
+		Type:              models.ChannelEventClosed,
+	}))
+	events, err = dao.GetChannelEvents(channelIdentifier, 0, 0)
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(events)) {
+		assert.Equal(t, models.ChannelEventDeposit, events[0].Type)
+		assert.EqualValues(t, 100, events[0].Amount.Int64())
+		assert.Equal(t, lock.MessageHash, events[1].MessageHash)
+		assert.Equal(t, lock.LockSecretHash, events[1].LockSecretHash)
+	}
+	events, err = dao.GetChannelEvents(channelIdentifier, 6, 0)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(events)) {
+		assert.Equal(t, models.ChannelEventLockAdded, events[0].Type)
+	}
+	events, err = dao.GetChannelEvents(channelIdentifier, 0, 9)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(events)) {
+		assert.Equal(t, models.ChannelEventDeposit, events[0].Type)
+	}
+	assert.Equal(t, models.WriteClassCritical, models.WriteClassOf(models.BucketChannelEvent))
+}
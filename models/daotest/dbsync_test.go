@@ -0,0 +1,54 @@
+package daotest
+
+import (
+	"math/big"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSyncPolicy(t *testing.T) {
+	p, err := models.ParseSyncPolicy(models.WriteClassCritical, "periodic")
+	assert.Nil(t, err)
+	assert.EqualValues(t, models.SyncPeriodic, p)
+	_, err = models.ParseSyncPolicy(models.WriteClassCritical, "never")
+	assert.NotNil(t, err)
+	p, err = models.ParseSyncPolicy(models.WriteClassReconstructible, "never")
+	assert.Nil(t, err)
+	assert.EqualValues(t, models.SyncNever, p)
+	_, err = models.ParseSyncPolicy(models.WriteClassReconstructible, "sometimes")
+	assert.NotNil(t, err)
+	assert.EqualValues(t, models.WriteClassReconstructible, models.WriteClassOf(models.BucketSentTransferDetail))
+	assert.EqualValues(t, models.WriteClassCritical, models.WriteClassOf(models.BucketChannelSerialization))
+}
+
+func TestModelDB_SyncPolicy(t *testing.T) {
+	oldCritical, oldReconstructible := params.DBSyncCritical, params.DBSyncReconstructible
+	defer func() {
+		params.DBSyncCritical, params.DBSyncReconstructible = oldCritical, oldReconstructible
+	}()
+	params.DBSyncCritical = string(models.SyncPeriodic)
+	params.DBSyncReconstructible = string(models.SyncNever)
+	dbPath := path.Join(os.TempDir(), "testsync.db")
+	os.RemoveAll(dbPath)
+	os.RemoveAll(dbPath + ".history")
+	dao := codefortest.NewTestDB(dbPath)
+	token, lockSecretHash := utils.NewRandomAddress(), utils.NewRandomHash()
+	dao.NewSentTransferDetail(token, utils.NewRandomAddress(), big.NewInt(10), "", false, lockSecretHash, "", nil)
+	dao.SaveLatestBlockNumber(30)
+	dao.CloseDB()
+
+	//关闭时会fsync,重新打开以后两类数据都在
+	dao = codefortest.NewTestDB(dbPath)
+	defer dao.CloseDB()
+	std, err := dao.GetSentTransferDetail(token, lockSecretHash)
+	assert.Nil(t, err)
+	assert.EqualValues(t, big.NewInt(10), std.Amount)
+	assert.EqualValues(t, 30, dao.GetLatestBlockNumber())
+}
@@ -0,0 +1,84 @@
+package daotest
+
+import (
+	"math/big"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/asdine/storm"
+	gobcodec "github.com/asdine/storm/codec/gob"
+	"github.com/stretchr/testify/assert"
+)
+
+//版本1的数据库,交易历史保存在主数据库中
+func createV1Db(t *testing.T, dbPath string, std *models.SentTransferDetail) {
+	db, err := storm.Open(dbPath, storm.Codec(gobcodec.Codec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, db.Set(models.BucketMeta, models.KeyVersion, 1))
+	assert.Nil(t, db.Set(models.BucketMeta, models.KeyCloseFlag, true))
+	assert.Nil(t, db.Set(models.BucketToken, models.KeyToken, make(models.AddressMap)))
+	assert.Nil(t, db.Set(models.BucketBlockNumber, models.KeyBlockNumber, int64(20)))
+	assert.Nil(t, db.Save(std))
+	assert.Nil(t, db.Close())
+}
+
+func TestModelDB_Upgrade(t *testing.T) {
+	dbPath := path.Join(os.TempDir(), "testupgrade.db")
+	for _, p := range []string{dbPath, dbPath + ".history", dbPath + ".v1.bak", dbPath + ".history.v1.bak"} {
+		os.RemoveAll(p)
+	}
+	token, lockSecretHash := utils.NewRandomAddress(), utils.NewRandomHash()
+	createV1Db(t, dbPath, &models.SentTransferDetail{
+		Key:          utils.Sha3(token[:], lockSecretHash[:]).String(),
+		TokenAddress: token,
+		Amount:       big.NewInt(10),
+	})
+
+	dao := codefortest.NewTestDB(dbPath)
+	assert.EqualValues(t, 20, dao.GetLatestBlockNumber())
+	std, err := dao.GetSentTransferDetail(token, lockSecretHash)
+	assert.Nil(t, err)
+	assert.EqualValues(t, big.NewInt(10), std.Amount)
+	dao.CloseDB()
+	assert.True(t, utils.Exists(dbPath+".v1.bak"))
+
+	//升级以后再次打开不需要升级
+	os.RemoveAll(dbPath + ".v1.bak")
+	dao = codefortest.NewTestDB(dbPath)
+	defer dao.CloseDB()
+	_, err = dao.GetSentTransferDetail(token, lockSecretHash)
+	assert.Nil(t, err)
+	assert.False(t, utils.Exists(dbPath+".v1.bak"))
+}
+
+//上次升级时崩溃,history数据库文件已经存在但是没有迁移的数据,再次打开时要重新迁移
+func TestModelDB_UpgradeAfterCrash(t *testing.T) {
+	dbPath := path.Join(os.TempDir(), "testupgradecrash.db")
+	for _, p := range []string{dbPath, dbPath + ".history", dbPath + ".v1.bak", dbPath + ".history.v1.bak"} {
+		os.RemoveAll(p)
+	}
+	token, lockSecretHash := utils.NewRandomAddress(), utils.NewRandomHash()
+	createV1Db(t, dbPath, &models.SentTransferDetail{
+		Key:          utils.Sha3(token[:], lockSecretHash[:]).String(),
+		TokenAddress: token,
+		Amount:       big.NewInt(10),
+	})
+	history, err := storm.Open(dbPath+".history", storm.Codec(gobcodec.Codec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, history.Init(&models.SentTransferDetail{}))
+	assert.Nil(t, history.Close())
+
+	dao := codefortest.NewTestDB(dbPath)
+	defer dao.CloseDB()
+	std, err := dao.GetSentTransferDetail(token, lockSecretHash)
+	assert.Nil(t, err)
+	assert.EqualValues(t, big.NewInt(10), std.Amount)
+}
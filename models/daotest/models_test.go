@@ -64,6 +64,39 @@ func TestToken(t *testing.T) {
 
 }
 
+func TestRemoveCallback(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	var called1, called2, nested int
+	id1 := dao.RegisterNewTokenCallback(func(token common.Address) bool {
+		called1++
+		return false
+	})
+	dao.RegisterNewTokenCallback(func(token common.Address) bool {
+		called2++
+		//回调中注册新的回调不会死锁
+		dao.RegisterNewTokenCallback(func(token common.Address) bool {
+			nested++
+			return true
+		})
+		return true
+	})
+	err := dao.AddToken(utils.NewRandomAddress(), utils.NewRandomAddress())
+	if err != nil {
+		t.Error(err)
+	}
+	assert.EqualValues(t, 1, called1)
+	assert.EqualValues(t, 1, called2)
+	dao.RemoveCallback(id1)
+	err = dao.AddToken(utils.NewRandomAddress(), utils.NewRandomAddress())
+	if err != nil {
+		t.Error(err)
+	}
+	assert.EqualValues(t, 1, called1)
+	assert.EqualValues(t, 1, called2)
+	assert.EqualValues(t, 1, nested)
+}
+
 func TestGob(t *testing.T) {
 	s1 := common.HexToAddress(os.Getenv("TOKEN_NETWORK"))
 	var buf bytes.Buffer
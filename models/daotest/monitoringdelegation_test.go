@@ -0,0 +1,50 @@
+package daotest
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_MonitoringDelegation(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	ds, err := dao.GetAllMonitoringDelegations()
+	assert.Nil(t, err)
+	assert.Len(t, ds, 0)
+	d := &models.MonitoringDelegation{
+		ChannelIdentifier: utils.NewRandomHash(),
+		OpenBlockNumber:   3,
+		TokenAddress:      utils.NewRandomAddress(),
+		PartnerAddress:    utils.NewRandomAddress(),
+		Nonce:             1,
+		TransferAmount:    big.NewInt(10),
+		LockedAmount:      big.NewInt(0),
+		Reward:            big.NewInt(1),
+		ServiceURL:        "http://127.0.0.1:8000",
+		DelegateTime:      time.Now().Unix(),
+	}
+	err = dao.SaveMonitoringDelegation(d)
+	assert.Nil(t, err)
+	//同一个通道只保留最新的委托
+	d.Nonce = 2
+	err = dao.SaveMonitoringDelegation(d)
+	assert.Nil(t, err)
+	ds, err = dao.GetAllMonitoringDelegations()
+	assert.Nil(t, err)
+	if assert.Len(t, ds, 1) {
+		assert.EqualValues(t, d, ds[0])
+	}
+	err = dao.RemoveMonitoringDelegation(d.ChannelIdentifier)
+	assert.Nil(t, err)
+	ds, err = dao.GetAllMonitoringDelegations()
+	assert.Nil(t, err)
+	assert.Len(t, ds, 0)
+	err = dao.RemoveMonitoringDelegation(d.ChannelIdentifier)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,47 @@
+package daotest
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_NetworkStatsReport(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	token := utils.NewRandomAddress()
+	r1 := &models.NetworkStatsReport{
+		ReporterID:  utils.NewRandomHash(),
+		BlockNumber: 100,
+		Tokens:      []*models.TokenNetworkStats{{Token: token, Channels: 2, Capacity: big.NewInt(30)}},
+	}
+	r2 := &models.NetworkStatsReport{
+		ReporterID:  utils.NewRandomHash(),
+		BlockNumber: 90,
+		Tokens:      []*models.TokenNetworkStats{{Token: token, Channels: 1, Capacity: big.NewInt(20)}},
+	}
+	assert.Nil(t, dao.SaveNetworkStatsReport(r1))
+	assert.Nil(t, dao.SaveNetworkStatsReport(r2))
+	//同一个节点的新统计覆盖旧的
+	r1.BlockNumber = 110
+	assert.Nil(t, dao.SaveNetworkStatsReport(r1))
+	rs, err := dao.GetAllNetworkStatsReports()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, len(rs))
+
+	s := models.AggregateNetworkStats(rs)
+	assert.EqualValues(t, 2, s.Reporters)
+	assert.EqualValues(t, 90, s.OldestBlock)
+	assert.EqualValues(t, 1, len(s.Tokens))
+	assert.EqualValues(t, 3, s.Tokens[0].Channels)
+	assert.EqualValues(t, 50, s.Tokens[0].Capacity.Int64())
+
+	assert.Nil(t, dao.RemoveNetworkStatsReport(r2.ReporterID))
+	rs, err = dao.GetAllNetworkStatsReports()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(rs))
+}
@@ -0,0 +1,52 @@
+package daotest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_NodeAdvertisement(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	_, err := dao.GetNodeAdvertisement()
+	assert.EqualValues(t, rerr.ErrNotFound, err)
+	key, _ := crypto.GenerateKey()
+	na := &models.NodeAdvertisement{
+		NodeAddress:     crypto.PubkeyToAddress(key.PublicKey),
+		OperatorContact: "ops@example.com",
+		SupportedTokens: []common.Address{utils.NewRandomAddress()},
+		GeoHint:         "Singapore",
+		Timestamp:       time.Now().Unix(),
+	}
+	err = na.Sign(key)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = dao.SaveNodeAdvertisement(na)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	na2, err := dao.GetNodeAdvertisement()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.EqualValues(t, na.SupportedTokens, na2.SupportedTokens)
+	assert.EqualValues(t, na.GeoHint, na2.GeoHint)
+	if err = na2.VerifySignature(); err != nil {
+		t.Error(err)
+		return
+	}
+	na2.GeoHint = "Beijing"
+	assert.NotNil(t, na2.VerifySignature())
+}
@@ -0,0 +1,50 @@
+package daotest
+
+import (
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_Notification(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	id, err := dao.GetLastNotificationID()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, id)
+	ns, err := dao.GetNotifications(0, 0)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, len(ns))
+	//ID超过255时按照数字而不是字节顺序排列
+	for i := uint64(250); i <= 260; i++ {
+		n := &models.Notification{
+			ID:   i,
+			Info: "notice",
+		}
+		if i%2 == 0 {
+			n.ReceivedTransfer = &models.ReceivedTransfer{Key: utils.NewRandomHash().String()}
+		}
+		err = dao.SaveNotification(n)
+		assert.Nil(t, err)
+	}
+	id, err = dao.GetLastNotificationID()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 260, id)
+	ns, err = dao.GetNotifications(255, 3)
+	assert.Nil(t, err)
+	if assert.EqualValues(t, 3, len(ns)) {
+		assert.EqualValues(t, 256, ns[0].ID)
+		assert.EqualValues(t, 258, ns[2].ID)
+		assert.NotNil(t, ns[0].ReceivedTransfer)
+	}
+	err = dao.RemoveNotificationsBefore(258)
+	assert.Nil(t, err)
+	ns, err = dao.GetNotifications(0, 0)
+	assert.Nil(t, err)
+	if assert.EqualValues(t, 3, len(ns)) {
+		assert.EqualValues(t, 258, ns[0].ID)
+	}
+}
@@ -0,0 +1,53 @@
+package daotest
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_OfflineTxBundle(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	channelIdentifier := utils.NewRandomHash()
+	_, err := dao.GetOfflineTxBundle(channelIdentifier)
+	assert.EqualValues(t, rerr.ErrNotFound, err)
+	b := &models.OfflineTxBundle{
+		ChannelIdentifier: channelIdentifier,
+		Signer:            utils.NewRandomAddress(),
+		CreateBlock:       10,
+		Txs: []*models.OfflineTx{
+			{Kind: models.OfflineTxKindUpdateBalanceProof, Nonce: 1, GasPrice: big.NewInt(1), NotBefore: 10, Deadline: 20, Status: models.OfflineTxStatusSigned},
+			{Kind: models.OfflineTxKindSettle, Nonce: 2, GasPrice: big.NewInt(1), NotBefore: 21, Status: models.OfflineTxStatusSigned},
+		},
+	}
+	err = dao.SaveOfflineTxBundle(b)
+	assert.Nil(t, err)
+	b2, err := dao.GetOfflineTxBundle(channelIdentifier)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, len(b2.Txs))
+	assert.EqualValues(t, models.OfflineTxKindSettle, b2.Txs[1].Kind)
+	bs, err := dao.GetAllOfflineTxBundles()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(bs))
+
+	//settle还没到时间,只能提交第一笔
+	txs, changed := b2.NextToSubmit(15)
+	assert.False(t, changed)
+	assert.EqualValues(t, 1, len(txs))
+	//update错过了截止时间,后面的交易nonce不连续也就不可能被打包
+	txs, changed = b2.NextToSubmit(21)
+	assert.True(t, changed)
+	assert.EqualValues(t, 0, len(txs))
+	assert.True(t, b2.IsFinished())
+
+	err = dao.RemoveOfflineTxBundle(channelIdentifier)
+	assert.Nil(t, err)
+	_, err = dao.GetOfflineTxBundle(channelIdentifier)
+	assert.EqualValues(t, rerr.ErrNotFound, err)
+}
@@ -0,0 +1,51 @@
+package daotest
+
+import (
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestModelDB_PartnerFilter(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	addr1 := utils.NewRandomAddress()
+	addr2 := utils.NewRandomAddress()
+	pf := dao.GetPartnerFilter()
+	if !pf.IsAllowed(addr1) || !pf.IsAllowed(addr2) {
+		t.Error("default partner filter should allow any partner")
+		return
+	}
+	pf.Blacklist = []common.Address{addr1}
+	err := dao.SavePartnerFilter(pf)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	pf = dao.GetPartnerFilter()
+	if pf.IsAllowed(addr1) {
+		t.Error("blacklisted partner should not be allowed")
+		return
+	}
+	if !pf.IsAllowed(addr2) {
+		t.Error("partner should be allowed when whitelist is empty")
+		return
+	}
+	pf.Blacklist = nil
+	pf.Whitelist = []common.Address{addr1}
+	err = dao.SavePartnerFilter(pf)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	pf = dao.GetPartnerFilter()
+	if !pf.IsAllowed(addr1) {
+		t.Error("whitelisted partner should be allowed")
+		return
+	}
+	if pf.IsAllowed(addr2) {
+		t.Error("partner not in whitelist should not be allowed")
+	}
+}
@@ -0,0 +1,36 @@
+package daotest
+
+import (
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_PendingUnlock(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	ps, err := dao.GetAllPendingUnlocks()
+	assert.Nil(t, err)
+	assert.Len(t, ps, 0)
+	p := models.NewPendingUnlock(utils.NewRandomHash(), utils.NewRandomHash(), utils.NewRandomHash(), 100, 200)
+	err = dao.SavePendingUnlock(p)
+	assert.Nil(t, err)
+	p.UnlockWaitBlock = 150
+	err = dao.SavePendingUnlock(p)
+	assert.Nil(t, err)
+	ps, err = dao.GetAllPendingUnlocks()
+	assert.Nil(t, err)
+	if assert.Len(t, ps, 1) {
+		assert.EqualValues(t, p, ps[0])
+	}
+	err = dao.RemovePendingUnlock(p.Key)
+	assert.Nil(t, err)
+	ps, err = dao.GetAllPendingUnlocks()
+	assert.Nil(t, err)
+	assert.Len(t, ps, 0)
+	err = dao.RemovePendingUnlock(p.Key)
+	assert.Nil(t, err)
+}
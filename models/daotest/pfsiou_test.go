@@ -0,0 +1,33 @@
+package daotest
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_PfsIOU(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	receiver := utils.NewRandomAddress()
+	_, err := dao.GetPfsIOU(receiver)
+	assert.Equal(t, rerr.ErrNotFound, err)
+	iou := &models.PfsIOU{
+		Receiver:        receiver,
+		Amount:          big.NewInt(10),
+		ExpirationBlock: 100,
+	}
+	err = dao.SavePfsIOU(iou)
+	assert.Nil(t, err)
+	iou.Amount = big.NewInt(20)
+	err = dao.SavePfsIOU(iou)
+	assert.Nil(t, err)
+	iou2, err := dao.GetPfsIOU(receiver)
+	assert.Nil(t, err)
+	assert.EqualValues(t, iou, iou2)
+}
@@ -22,7 +22,7 @@ func TestModelDB_SentTransferDetail(t *testing.T) {
 	amount := big.NewInt(1)
 	data := "123"
 	lockSecretHash := utils.NewRandomHash()
-	dao.NewSentTransferDetail(tokenAddress, target, amount, data, false, lockSecretHash)
+	dao.NewSentTransferDetail(tokenAddress, target, amount, data, false, lockSecretHash, "order-1", []byte("invoice"))
 
 	std, err := dao.GetSentTransferDetail(tokenAddress, lockSecretHash)
 	assert.Empty(t, err)
@@ -38,10 +38,20 @@ func TestModelDB_SentTransferDetail(t *testing.T) {
 	assert.EqualValues(t, list[0].Status, models.TransferStatusSuccess)
 
 	lockSecretHash2 := utils.NewRandomHash()
-	dao.NewSentTransferDetail(tokenAddress, target, amount, data, false, lockSecretHash2)
+	dao.NewSentTransferDetail(tokenAddress, target, amount, data, false, lockSecretHash2, "", nil)
 
 	list, err = dao.GetSentTransferDetailList(tokenAddress, -1, -1, -1, -1)
 	fmt.Println(utils.StringInterface(list, 0))
 	assert.Empty(t, err)
 	assert.EqualValues(t, 2, len(list))
+
+	list, err = dao.GetSentTransferDetailsByPaymentID("order-1")
+	assert.Empty(t, err)
+	if assert.EqualValues(t, 1, len(list)) {
+		assert.EqualValues(t, lockSecretHash, list[0].LockSecretHash)
+		assert.EqualValues(t, []byte("invoice"), list[0].Invoice)
+	}
+	list, err = dao.GetSentTransferDetailsByPaymentID("order-2")
+	assert.Empty(t, err)
+	assert.EqualValues(t, 0, len(list))
 }
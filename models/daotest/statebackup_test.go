@@ -0,0 +1,47 @@
+package daotest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_PeerStateBackup(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	owner := utils.NewRandomAddress()
+	_, err := dao.GetPeerStateBackup(owner)
+	assert.EqualValues(t, rerr.ErrNotFound, err)
+	b := models.NewPeerStateBackup(owner)
+	complete, err := b.AddFragment(10, true, 1, 2, []byte("world"), time.Now().Unix())
+	assert.Nil(t, err)
+	assert.False(t, complete)
+	err = dao.SavePeerStateBackup(b)
+	assert.Nil(t, err)
+	b, err = dao.GetPeerStateBackup(owner)
+	assert.Nil(t, err)
+	complete, err = b.AddFragment(10, true, 0, 2, []byte("hello "), time.Now().Unix())
+	assert.Nil(t, err)
+	assert.True(t, complete)
+	assert.EqualValues(t, "hello world", string(b.Chunks[0].Data()))
+	_, err = b.AddFragment(10, false, 0, 1, []byte("stale"), time.Now().Unix())
+	assert.NotNil(t, err)
+	_, err = b.AddFragment(20, false, 0, 1, []byte("incremental"), time.Now().Unix())
+	assert.Nil(t, err)
+	err = dao.SavePeerStateBackup(b)
+	assert.Nil(t, err)
+	bs, err := dao.GetAllPeerStateBackup()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(bs))
+	assert.EqualValues(t, 2, len(bs[0].Chunks))
+	assert.Nil(t, bs[0].Pending)
+	//新的全量备份会替换之前所有的备份
+	_, err = b.AddFragment(30, true, 0, 1, []byte("full"), time.Now().Unix())
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(b.Chunks))
+}
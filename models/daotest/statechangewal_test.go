@@ -0,0 +1,32 @@
+package daotest
+
+import (
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_StateChangeWAL(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	es, err := dao.GetAllStateChangeWAL()
+	assert.Nil(t, err)
+	assert.Len(t, es, 0)
+	var ids []uint64
+	for i := 0; i < 3; i++ {
+		id, err := dao.AppendStateChangeWAL([]byte{byte(i)})
+		assert.Nil(t, err)
+		ids = append(ids, id)
+	}
+	err = dao.RemoveStateChangeWAL(ids[1])
+	assert.Nil(t, err)
+	es, err = dao.GetAllStateChangeWAL()
+	assert.Nil(t, err)
+	if assert.Len(t, es, 2) {
+		assert.Equal(t, ids[0], es[0].ID)
+		assert.Equal(t, []byte{0}, es[0].StateChange)
+		assert.Equal(t, ids[2], es[1].ID)
+		assert.Equal(t, []byte{2}, es[1].StateChange)
+	}
+}
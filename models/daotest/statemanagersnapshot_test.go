@@ -0,0 +1,53 @@
+package daotest
+
+import (
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_StateManagerSnapshot(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	key := utils.NewRandomHash()
+	other := utils.NewRandomHash()
+	for seq := int64(1); seq <= 4; seq++ {
+		err := dao.NewStateChangeLog(models.NewStateChangeLog(key, seq, []byte{byte(seq)}))
+		assert.Nil(t, err)
+	}
+	err := dao.NewStateChangeLog(models.NewStateChangeLog(other, 1, []byte{1}))
+	assert.Nil(t, err)
+	logs, err := dao.GetStateChangeLogs(key)
+	assert.Nil(t, err)
+	assert.Len(t, logs, 4)
+	for i, l := range logs {
+		assert.EqualValues(t, i+1, l.Seq)
+	}
+	//快照包含的日志要删掉
+	err = dao.SaveStateManagerSnapshot(&models.StateManagerSnapshot{Key: key, Seq: 2, Data: []byte{2}})
+	assert.Nil(t, err)
+	logs, err = dao.GetStateChangeLogs(key)
+	assert.Nil(t, err)
+	assert.Len(t, logs, 2)
+	assert.EqualValues(t, 3, logs[0].Seq)
+	ss, err := dao.GetAllStateManagerSnapshots()
+	assert.Nil(t, err)
+	assert.Len(t, ss, 1)
+	assert.Equal(t, key, ss[0].Key)
+	assert.EqualValues(t, 2, ss[0].Seq)
+
+	err = dao.RemoveStateManagerSnapshot(key)
+	assert.Nil(t, err)
+	ss, err = dao.GetAllStateManagerSnapshots()
+	assert.Nil(t, err)
+	assert.Len(t, ss, 0)
+	logs, err = dao.GetStateChangeLogs(key)
+	assert.Nil(t, err)
+	assert.Len(t, logs, 0)
+	logs, err = dao.GetStateChangeLogs(other)
+	assert.Nil(t, err)
+	assert.Len(t, logs, 1)
+}
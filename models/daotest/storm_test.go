@@ -44,6 +44,7 @@ func testUniqueArray(t *testing.T, dbPath string) {
 func TestTwice(t *testing.T) {
 	dbpath := path.Join(os.TempDir(), "testxxxx.db")
 	os.RemoveAll(dbpath)
+	os.RemoveAll(dbpath + ".history")
 	testUniqueArray(t, dbpath)
 	//testUniqueArray(t, dbpath)
 	//testUniqueArray(t, dbpath)
@@ -0,0 +1,42 @@
+package daotest
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_SwapOrder(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	o := &models.SwapOrder{
+		LockSecretHash: utils.NewRandomHash(),
+		Secret:         utils.NewRandomHash(),
+		Maker:          utils.NewRandomAddress(),
+		Taker:          utils.NewRandomAddress(),
+		MakerToken:     utils.NewRandomAddress(),
+		MakerAmount:    big.NewInt(10),
+		TakerToken:     utils.NewRandomAddress(),
+		TakerAmount:    big.NewInt(30),
+		IsMaker:        true,
+		Status:         models.SwapStatusOffered,
+	}
+	_, err := dao.GetSwapOrder(o.LockSecretHash)
+	assert.Equal(t, rerr.ErrNotFound, err)
+	err = dao.SaveSwapOrder(o)
+	assert.Nil(t, err)
+	o.Status = models.SwapStatusAccepted
+	err = dao.SaveSwapOrder(o)
+	assert.Nil(t, err)
+	o2, err := dao.GetSwapOrder(o.LockSecretHash)
+	assert.Nil(t, err)
+	assert.EqualValues(t, o, o2)
+	orders, err := dao.GetAllSwapOrders()
+	assert.Nil(t, err)
+	assert.Len(t, orders, 1)
+}
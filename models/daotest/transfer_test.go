@@ -19,7 +19,7 @@ func TestModelDB_NewReceivedTransfer(t *testing.T) {
 	caddr := utils.NewRandomHash()
 	var openBlockNumber int64 = 3
 	lockSecertHash := utils.NewRandomHash()
-	dao.NewReceivedTransfer(2, caddr, openBlockNumber, taddr, taddr, 3, big.NewInt(10), lockSecertHash, "123")
+	dao.NewReceivedTransfer(2, caddr, openBlockNumber, taddr, taddr, 3, big.NewInt(10), lockSecertHash, "123", "", nil)
 	key := fmt.Sprintf("%s-%d-%d", caddr.String(), openBlockNumber, 3)
 	r, err := dao.GetReceivedTransfer(key)
 	if err != nil {
@@ -30,8 +30,8 @@ func TestModelDB_NewReceivedTransfer(t *testing.T) {
 	assert.Equal(t, r.ChannelIdentifier, caddr)
 	assert.EqualValues(t, r.Nonce, 3)
 	assert.EqualValues(t, r.Amount, big.NewInt(10))
-	dao.NewReceivedTransfer(3, caddr, openBlockNumber, taddr, taddr, 4, big.NewInt(10), lockSecertHash, "123")
-	dao.NewReceivedTransfer(5, caddr, openBlockNumber, taddr, taddr, 6, big.NewInt(10), lockSecertHash, "123")
+	dao.NewReceivedTransfer(3, caddr, openBlockNumber, taddr, taddr, 4, big.NewInt(10), lockSecertHash, "123", "", nil)
+	dao.NewReceivedTransfer(5, caddr, openBlockNumber, taddr, taddr, 6, big.NewInt(10), lockSecertHash, "123", "order-1", []byte("invoice"))
 
 	trs, err := dao.GetReceivedTransferList(utils.EmptyAddress, 0, 3, -1, -1)
 	if err != nil {
@@ -52,6 +52,16 @@ func TestModelDB_NewReceivedTransfer(t *testing.T) {
 		return
 	}
 	assert.EqualValues(t, len(trs), 0)
+
+	trs, err = dao.GetReceivedTransfersByPaymentID("order-1")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if assert.EqualValues(t, len(trs), 1) {
+		assert.EqualValues(t, trs[0].Nonce, 6)
+		assert.EqualValues(t, trs[0].Invoice, []byte("invoice"))
+	}
 	//from := time.Now().Add(0 - time.Minute)
 	//to := time.Now().Add(time.Minute)
 	//trs, err = dao.GetReceivedTransferList(utils.EmptyAddress, from, to)
@@ -85,8 +95,8 @@ func TestBatchWriteDb(t *testing.T) {
 			//b := time.Now()
 			//dao.SaveLatestBlockNumber(111)
 			//dao.UpdateTransferStatusMessage(taddr, lockSecertHash, strconv.Itoa(int(index)))
-			dao.NewSentTransferDetail(utils.NewRandomAddress(), taddr, big.NewInt(10), "123", true, lockSecertHash)
-			//dao.NewSentTransfer(3, caddr, openBlockNumber, taddr, taddr, index, big.NewInt(10), lockSecertHash, "123")
+			dao.NewSentTransferDetail(utils.NewRandomAddress(), taddr, big.NewInt(10), "123", true, lockSecertHash, "", nil)
+			//dao.NewSentTransfer(3, caddr, openBlockNumber, taddr, taddr, index, big.NewInt(10), lockSecertHash, "123", "", nil)
 			//fmt.Println("use ", time.Since(b).Seconds())
 			wg.Done()
 		}(i)
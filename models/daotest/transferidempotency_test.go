@@ -0,0 +1,31 @@
+package daotest
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_TransferIdempotency(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	_, err := dao.GetTransferIdempotency("order-1")
+	assert.Equal(t, rerr.ErrNotFound, err)
+	ti := &models.TransferIdempotency{
+		Key:            "order-1",
+		LockSecretHash: utils.NewRandomHash(),
+		TokenAddress:   utils.NewRandomAddress(),
+		TargetAddress:  utils.NewRandomAddress(),
+		Amount:         big.NewInt(10),
+	}
+	err = dao.NewTransferIdempotency(ti)
+	assert.Nil(t, err)
+	ti2, err := dao.GetTransferIdempotency("order-1")
+	assert.Nil(t, err)
+	assert.EqualValues(t, ti, ti2)
+}
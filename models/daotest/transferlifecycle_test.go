@@ -0,0 +1,56 @@
+package daotest
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_TransferLifecycle(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	lockSecretHash := utils.NewRandomHash()
+	//中间节点没有记录
+	_, err := dao.AddTransferTransition(lockSecretHash, models.TransferStageLockSent, "")
+	assert.Equal(t, rerr.ErrNotFound, err)
+	_, err = dao.GetTransferLifecycle(lockSecretHash)
+	assert.Equal(t, rerr.ErrNotFound, err)
+	l := &models.TransferLifecycle{
+		LockSecretHash: lockSecretHash,
+		TokenAddress:   utils.NewRandomAddress(),
+		TargetAddress:  utils.NewRandomAddress(),
+		Amount:         big.NewInt(10),
+	}
+	l.AddTransition(models.TransferStageInitiated, "")
+	err = dao.NewTransferLifecycle(l)
+	assert.Nil(t, err)
+	_, err = dao.AddTransferTransition(lockSecretHash, models.TransferStageRouted, "1 routes")
+	assert.Nil(t, err)
+	_, err = dao.AddTransferTransition(lockSecretHash, models.TransferStageFailed, "no route")
+	assert.Nil(t, err)
+	l2, err := dao.GetTransferLifecycle(lockSecretHash)
+	assert.Nil(t, err)
+	assert.Equal(t, models.TransferStageFailed, l2.Stage)
+	assert.True(t, l2.Stage.IsFinal())
+	assert.EqualValues(t, 10, l2.Amount.Int64())
+	if assert.Equal(t, 3, len(l2.Transitions)) {
+		assert.Equal(t, models.TransferStageInitiated, l2.Transitions[0].Stage)
+		assert.Equal(t, "1 routes", l2.Transitions[1].Reason)
+	}
+	path := []common.Address{utils.NewRandomAddress(), l.TargetAddress}
+	err = dao.SetTransferRoute(lockSecretHash, big.NewInt(3), path)
+	assert.Nil(t, err)
+	l2, err = dao.GetTransferLifecycle(lockSecretHash)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 3, l2.Fee.Int64())
+	assert.Equal(t, path, l2.Path)
+	assert.Equal(t, 3, len(l2.Transitions))
+	err = dao.SetTransferRoute(utils.NewRandomHash(), big.NewInt(3), path)
+	assert.Equal(t, rerr.ErrNotFound, err)
+}
@@ -0,0 +1,40 @@
+package daotest
+
+import (
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_WebhookDeadLetter(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	id := utils.NewRandomHash().String()
+	_, err := dao.GetWebhookDeadLetter(id)
+	assert.EqualValues(t, rerr.ErrNotFound, err)
+	dl := &models.WebhookDeadLetter{
+		Key:      id,
+		URL:      "http://127.0.0.1:8080/hook",
+		Seq:      3,
+		Type:     "sent_transfer",
+		Payload:  `{"seq":3}`,
+		Error:    "status 500",
+		Attempts: 6,
+	}
+	err = dao.SaveWebhookDeadLetter(dl)
+	assert.Nil(t, err)
+	dl2, err := dao.GetWebhookDeadLetter(id)
+	assert.Nil(t, err)
+	assert.EqualValues(t, dl, dl2)
+	dls, err := dao.GetAllWebhookDeadLetters()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(dls))
+	err = dao.RemoveWebhookDeadLetter(id)
+	assert.Nil(t, err)
+	_, err = dao.GetWebhookDeadLetter(id)
+	assert.EqualValues(t, rerr.ErrNotFound, err)
+}
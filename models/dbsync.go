@@ -0,0 +1,105 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/params"
+)
+
+//WriteClass 数据库写入的安全分类
+type WriteClass int
+
+const (
+	//WriteClassCritical 通道状态,balance proof,密码,锁等数据,丢失以后可能造成资金损失
+	WriteClassCritical WriteClass = iota
+	//WriteClassReconstructible 交易历史,收费记录,网络统计等数据,丢失以后不影响通道安全
+	WriteClassReconstructible
+)
+
+func (c WriteClass) String() string {
+	if c == WriteClassReconstructible {
+		return "reconstructible"
+	}
+	return "critical"
+}
+
+//SyncPolicy 一类数据写入以后什么时候fsync到磁盘
+type SyncPolicy string
+
+const (
+	//SyncAlways 每次写入都fsync
+	SyncAlways SyncPolicy = "always"
+	//SyncPeriodic 写入时不fsync,每隔params.DBSyncInterval统一fsync一次
+	SyncPeriodic SyncPolicy = "periodic"
+	//SyncNever 不主动fsync,由操作系统决定什么时候写入磁盘,只在关闭数据库时fsync
+	SyncNever SyncPolicy = "never"
+)
+
+//ParseSyncPolicy checks `s` is a valid SyncPolicy for write class `class`
+func ParseSyncPolicy(class WriteClass, s string) (SyncPolicy, error) {
+	switch p := SyncPolicy(s); p {
+	case SyncAlways, SyncPeriodic:
+		return p, nil
+	case SyncNever:
+		//崩溃时丢失最近的balance proof或者密码会造成资金损失,关键数据至少要定期fsync
+		if class == WriteClassCritical {
+			return "", fmt.Errorf("sync policy %s is not allowed for %s writes", s, class)
+		}
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown sync policy %s, should be one of %s,%s,%s", s, SyncAlways, SyncPeriodic, SyncNever)
+}
+
+//SyncConfig 每一类写入的fsync策略
+type SyncConfig struct {
+	Critical        SyncPolicy
+	Reconstructible SyncPolicy
+	Interval        time.Duration //只对SyncPeriodic有效
+}
+
+//DefaultSyncConfig 使用params中的配置
+func DefaultSyncConfig() SyncConfig {
+	critical, err := ParseSyncPolicy(WriteClassCritical, params.DBSyncCritical)
+	if err != nil {
+		critical = SyncAlways
+	}
+	reconstructible, err := ParseSyncPolicy(WriteClassReconstructible, params.DBSyncReconstructible)
+	if err != nil {
+		reconstructible = SyncAlways
+	}
+	return SyncConfig{
+		Critical:        critical,
+		Reconstructible: reconstructible,
+		Interval:        params.DBSyncInterval,
+	}
+}
+
+//Policy returns sync policy of write class `class`
+func (c SyncConfig) Policy(class WriteClass) SyncPolicy {
+	if class == WriteClassReconstructible {
+		return c.Reconstructible
+	}
+	return c.Critical
+}
+
+/*
+reconstructibleBuckets 丢失以后不影响通道安全的数据,其余数据都按照关键数据处理.
+TXInfo记录了还没有打包的交易,ChainEventRecord用来避免重复处理链上事件,ChannelEvent是出现争议时的证据,它们都属于关键数据
+*/
+var reconstructibleBuckets = map[string]bool{
+	BucketReceivedTransfer:   true,
+	BucketSentTransferDetail: true,
+	BucketFeeChargeRecord:    true,
+	BucketNetworkStatsReport: true,
+	BucketNotification:       true,
+	BucketTransferLifecycle:  true,
+}
+
+//WriteClassOf returns write class of data saved in `bucket`
+func WriteClassOf(bucket string) WriteClass {
+	if reconstructibleBuckets[bucket] {
+		return WriteClassReconstructible
+	}
+	return WriteClassCritical
+}
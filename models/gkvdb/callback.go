@@ -3,60 +3,62 @@ package gkvdb
 import "github.com/SmartMeshFoundation/Photon/models/cb"
 
 // RegisterNewTokenCallback register a new token callback
-func (dao *GkvDB) RegisterNewTokenCallback(f cb.NewTokenCb) {
+func (dao *GkvDB) RegisterNewTokenCallback(f cb.NewTokenCb) (id cb.ID) {
 	dao.mlock.Lock()
-	dao.newTokenCallbacks[&f] = true
+	dao.nextCallbackID++
+	id = dao.nextCallbackID
+	dao.newTokenCallbacks[id] = f
 	dao.mlock.Unlock()
+	return
 }
 
 // RegisterNewChannelCallback register a new channel callback
-func (dao *GkvDB) RegisterNewChannelCallback(f cb.ChannelCb) {
+func (dao *GkvDB) RegisterNewChannelCallback(f cb.ChannelCb) (id cb.ID) {
 	dao.mlock.Lock()
-	dao.newChannelCallbacks[&f] = true
+	dao.nextCallbackID++
+	id = dao.nextCallbackID
+	dao.newChannelCallbacks[id] = f
 	dao.mlock.Unlock()
+	return
 }
 
 //RegisterChannelDepositCallback register channel deposit callback
-func (dao *GkvDB) RegisterChannelDepositCallback(f cb.ChannelCb) {
+func (dao *GkvDB) RegisterChannelDepositCallback(f cb.ChannelCb) (id cb.ID) {
 	dao.mlock.Lock()
-	dao.channelDepositCallbacks[&f] = true
+	dao.nextCallbackID++
+	id = dao.nextCallbackID
+	dao.channelDepositCallbacks[id] = f
 	dao.mlock.Unlock()
+	return
 }
 
 //RegisterChannelStateCallback notify when channel closed
-func (dao *GkvDB) RegisterChannelStateCallback(f cb.ChannelCb) {
+func (dao *GkvDB) RegisterChannelStateCallback(f cb.ChannelCb) (id cb.ID) {
 	dao.mlock.Lock()
-	dao.channelStateCallbacks[&f] = true
+	dao.nextCallbackID++
+	id = dao.nextCallbackID
+	dao.channelStateCallbacks[id] = f
 	dao.mlock.Unlock()
+	return
 }
 
 //RegisterChannelSettleCallback notify when channel settled
-func (dao *GkvDB) RegisterChannelSettleCallback(f cb.ChannelCb) {
+func (dao *GkvDB) RegisterChannelSettleCallback(f cb.ChannelCb) (id cb.ID) {
 	dao.mlock.Lock()
-	dao.channelSettledCallbacks[&f] = true
+	dao.nextCallbackID++
+	id = dao.nextCallbackID
+	dao.channelSettledCallbacks[id] = f
 	dao.mlock.Unlock()
+	return
 }
 
-/*
-do we need remove a callback?
-*/
-func (dao *GkvDB) unRegisterNewTokenCallback(f cb.NewTokenCb) {
+//RemoveCallback 撤销`id`对应的回调,回调已经不存在时什么也不做
+func (dao *GkvDB) RemoveCallback(id cb.ID) {
 	dao.mlock.Lock()
-	delete(dao.newTokenCallbacks, &f)
-	dao.mlock.Unlock()
-}
-func (dao *GkvDB) unRegisterNewChannelCallback(f cb.ChannelCb) {
-	dao.mlock.Lock()
-	delete(dao.newChannelCallbacks, &f)
-	dao.mlock.Unlock()
-}
-func (dao *GkvDB) unRegisterChannelDepositCallback(f cb.ChannelCb) {
-	dao.mlock.Lock()
-	delete(dao.channelDepositCallbacks, &f)
-	dao.mlock.Unlock()
-}
-func (dao *GkvDB) unRegisterChannelStateCallback(f cb.ChannelCb) {
-	dao.mlock.Lock()
-	delete(dao.channelStateCallbacks, &f)
+	delete(dao.newTokenCallbacks, id)
+	delete(dao.newChannelCallbacks, id)
+	delete(dao.channelDepositCallbacks, id)
+	delete(dao.channelStateCallbacks, id)
+	delete(dao.channelSettledCallbacks, id)
 	dao.mlock.Unlock()
 }
@@ -0,0 +1,43 @@
+package gkvdb
+
+import (
+	"time"
+
+	"gitee.com/johng/gkvdb/gkvdb"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// NewChannelEvent :
+func (dao *GkvDB) NewChannelEvent(e *models.ChannelEvent) (err error) {
+	e.Key = e.MakeKey()
+	err = dao.getKeyValueToBucket(models.BucketChannelEvent, e.Key, &models.ChannelEvent{})
+	if err == nil {
+		return
+	}
+	if e.Time == 0 {
+		e.Time = time.Now().UnixNano()
+	}
+	err = dao.saveKeyValueToBucket(models.BucketChannelEvent, e.Key, e)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetChannelEvents :
+func (dao *GkvDB) GetChannelEvents(channelIdentifier common.Hash, fromBlock, toBlock int64) (events []*models.ChannelEvent, err error) {
+	var tb *gkvdb.Table
+	tb, err = dao.db.Table(models.BucketChannelEvent)
+	if err != nil {
+		err = models.GeneratDBError(err)
+		return
+	}
+	for _, v := range tb.Values(-1) {
+		var e models.ChannelEvent
+		gobDecode(v, &e)
+		if e.ChannelIdentifier == channelIdentifier && e.BlockNumber >= fromBlock && (toBlock <= 0 || e.BlockNumber < toBlock) {
+			events = append(events, &e)
+		}
+	}
+	models.SortChannelEvents(events)
+	return
+}
@@ -57,6 +57,7 @@ func (dao *GkvDB) NewPendingTXInfo(tx *types.Transaction, txType models.TXInfoTy
 		Status:            models.TXInfoStatusPending,
 		CallTime:          time.Now().Unix(),
 		GasPrice:          tx.GasPrice().Uint64(),
+		Nonce:             tx.Nonce(),
 	}
 	tis := txInfo.ToTXInfoSerialization()
 	err = dao.saveKeyValueToBucket(models.BucketTXInfo, tis.TXHash, tis)
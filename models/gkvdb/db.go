@@ -25,22 +25,25 @@ var ErrorNotFound = rerr.ErrNotFound
 type GkvDB struct {
 	db                      *gkvdb.DB
 	lock                    sync.Mutex
-	newTokenCallbacks       map[*cb.NewTokenCb]bool
-	newChannelCallbacks     map[*cb.ChannelCb]bool
-	channelDepositCallbacks map[*cb.ChannelCb]bool
-	channelStateCallbacks   map[*cb.ChannelCb]bool
-	channelSettledCallbacks map[*cb.ChannelCb]bool
+	newTokenCallbacks       map[cb.ID]cb.NewTokenCb
+	newChannelCallbacks     map[cb.ID]cb.ChannelCb
+	channelDepositCallbacks map[cb.ID]cb.ChannelCb
+	channelStateCallbacks   map[cb.ID]cb.ChannelCb
+	channelSettledCallbacks map[cb.ID]cb.ChannelCb
+	nextCallbackID          cb.ID
 	mlock                   sync.Mutex
 	Name                    string
+	syncConfig              models.SyncConfig
 }
 
 func newGkvDB() (db *GkvDB) {
 	return &GkvDB{
-		newTokenCallbacks:       make(map[*cb.NewTokenCb]bool),
-		newChannelCallbacks:     make(map[*cb.ChannelCb]bool),
-		channelDepositCallbacks: make(map[*cb.ChannelCb]bool),
-		channelStateCallbacks:   make(map[*cb.ChannelCb]bool),
-		channelSettledCallbacks: make(map[*cb.ChannelCb]bool),
+		newTokenCallbacks:       make(map[cb.ID]cb.NewTokenCb),
+		newChannelCallbacks:     make(map[cb.ID]cb.ChannelCb),
+		channelDepositCallbacks: make(map[cb.ID]cb.ChannelCb),
+		channelStateCallbacks:   make(map[cb.ID]cb.ChannelCb),
+		channelSettledCallbacks: make(map[cb.ID]cb.ChannelCb),
+		syncConfig:              models.DefaultSyncConfig(),
 	}
 }
 func gobEncode(d interface{}) []byte {
@@ -61,16 +64,25 @@ func gobDecode(buf []byte, to interface{}) {
 	}
 }
 
+/*
+needSync 按照bucket的安全分类决定这次写入是否fsync.
+gkvdb没有单独fsync的接口,periodic和never都是写入时不fsync,由gkvdb后台把binlog写入数据文件
+*/
+func (dao *GkvDB) needSync(bucket string) bool {
+	return dao.syncConfig.Policy(models.WriteClassOf(bucket)) == models.SyncAlways
+}
+
 func (dao *GkvDB) saveKeyValueToBucket(bucket string, key, value interface{}) error {
-	tb, err := dao.db.Table(bucket)
+	_, err := dao.db.Table(bucket)
 	if err != nil {
 		return err
 	}
-	err = tb.Set(gobEncode(key), gobEncode(value))
+	tx := dao.db.Begin()
+	err = tx.SetTo(gobEncode(key), gobEncode(value), bucket)
 	if err != nil {
 		return err
 	}
-	return nil
+	return tx.Commit(dao.needSync(bucket))
 }
 
 func (dao *GkvDB) getKeyValueToBucket(bucket string, key, to interface{}) error {
@@ -87,11 +99,16 @@ func (dao *GkvDB) getKeyValueToBucket(bucket string, key, to interface{}) error
 }
 
 func (dao *GkvDB) removeKeyValueFromBucket(bucket string, key interface{}) error {
-	tb, err := dao.db.Table(bucket)
+	_, err := dao.db.Table(bucket)
 	if err != nil {
 		return err
 	}
-	return tb.Remove(gobEncode(key))
+	tx := dao.db.Begin()
+	err = tx.RemoveFrom(gobEncode(key), bucket)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(dao.needSync(bucket))
 }
 
 //OpenDb open or create a bolt db at dbPath
@@ -126,10 +143,19 @@ func OpenDb(dbPath string) (dao *GkvDB, err error) {
 			log.Error(fmt.Sprintf("get version error %s", err))
 			return
 		}
-		if ver != models.DbVersion {
-			log.Error("db version not match")
+		//gkvdb在版本2中没有格式变化,只需要更新版本号
+		if ver > models.DbVersion || ver < 1 {
+			err = fmt.Errorf("db version %d not supported", ver)
+			log.Error(err.Error())
 			return
 		}
+		if ver != models.DbVersion {
+			err = dao.saveKeyValueToBucket(models.BucketMeta, models.KeyVersion, models.DbVersion)
+			if err != nil {
+				log.Error(fmt.Sprintf("upgrade db version err %s", err))
+				return
+			}
+		}
 		var closeFlag bool
 		err = dao.getKeyValueToBucket(models.BucketMeta, models.KeyCloseFlag, &closeFlag)
 		if err != nil {
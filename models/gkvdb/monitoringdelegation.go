@@ -0,0 +1,37 @@
+package gkvdb
+
+import (
+	"gitee.com/johng/gkvdb/gkvdb"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SaveMonitoringDelegation :
+func (dao *GkvDB) SaveMonitoringDelegation(d *models.MonitoringDelegation) (err error) {
+	err = dao.saveKeyValueToBucket(models.BucketMonitoringDelegation, d.ChannelIdentifier[:], d)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetAllMonitoringDelegations :
+func (dao *GkvDB) GetAllMonitoringDelegations() (ds []*models.MonitoringDelegation, err error) {
+	var tb *gkvdb.Table
+	tb, err = dao.db.Table(models.BucketMonitoringDelegation)
+	if err != nil {
+		err = models.GeneratDBError(err)
+		return
+	}
+	for _, v := range tb.Values(-1) {
+		var d models.MonitoringDelegation
+		gobDecode(v, &d)
+		ds = append(ds, &d)
+	}
+	return
+}
+
+// RemoveMonitoringDelegation :
+func (dao *GkvDB) RemoveMonitoringDelegation(channelIdentifier common.Hash) (err error) {
+	err = dao.removeKeyValueFromBucket(models.BucketMonitoringDelegation, channelIdentifier[:])
+	err = models.GeneratDBError(err)
+	return
+}
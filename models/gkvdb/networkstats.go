@@ -0,0 +1,38 @@
+package gkvdb
+
+import (
+	"gitee.com/johng/gkvdb/gkvdb"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SaveNetworkStatsReport :
+func (dao *GkvDB) SaveNetworkStatsReport(r *models.NetworkStatsReport) (err error) {
+	r.Key = r.ReporterID[:]
+	err = dao.saveKeyValueToBucket(models.BucketNetworkStatsReport, r.ReporterID, r)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetAllNetworkStatsReports :
+func (dao *GkvDB) GetAllNetworkStatsReports() (rs []*models.NetworkStatsReport, err error) {
+	var tb *gkvdb.Table
+	tb, err = dao.db.Table(models.BucketNetworkStatsReport)
+	if err != nil {
+		err = models.GeneratDBError(err)
+		return
+	}
+	for _, v := range tb.Values(-1) {
+		var r models.NetworkStatsReport
+		gobDecode(v, &r)
+		rs = append(rs, &r)
+	}
+	return
+}
+
+// RemoveNetworkStatsReport :
+func (dao *GkvDB) RemoveNetworkStatsReport(reporterID common.Hash) (err error) {
+	err = dao.removeKeyValueFromBucket(models.BucketNetworkStatsReport, reporterID)
+	err = models.GeneratDBError(err)
+	return
+}
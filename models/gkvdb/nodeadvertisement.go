@@ -0,0 +1,26 @@
+package gkvdb
+
+import (
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+)
+
+// SaveNodeAdvertisement :
+func (dao *GkvDB) SaveNodeAdvertisement(na *models.NodeAdvertisement) (err error) {
+	na.Key = models.KeyNodeAdvertisement
+	err = dao.saveKeyValueToBucket(models.BucketNodeAdvertisement, na.Key, na)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetNodeAdvertisement :
+func (dao *GkvDB) GetNodeAdvertisement() (na *models.NodeAdvertisement, err error) {
+	na = &models.NodeAdvertisement{}
+	err = dao.getKeyValueToBucket(models.BucketNodeAdvertisement, models.KeyNodeAdvertisement, na)
+	if err == ErrorNotFound {
+		err = rerr.ErrNotFound
+		return
+	}
+	err = models.GeneratDBError(err)
+	return
+}
@@ -0,0 +1,80 @@
+package gkvdb
+
+import (
+	"sort"
+
+	"gitee.com/johng/gkvdb/gkvdb"
+	"github.com/SmartMeshFoundation/Photon/models"
+)
+
+// SaveNotification :
+func (dao *GkvDB) SaveNotification(n *models.Notification) (err error) {
+	err = dao.saveKeyValueToBucket(models.BucketNotification, n.ID, n)
+	err = models.GeneratDBError(err)
+	return
+}
+
+//getAllNotifications gkvdb中的数据没有顺序,按照ID排序
+func (dao *GkvDB) getAllNotifications() (ns []*models.Notification, err error) {
+	var tb *gkvdb.Table
+	tb, err = dao.db.Table(models.BucketNotification)
+	if err != nil {
+		err = models.GeneratDBError(err)
+		return
+	}
+	for _, v := range tb.Values(-1) {
+		var n models.Notification
+		gobDecode(v, &n)
+		ns = append(ns, &n)
+	}
+	sort.Slice(ns, func(i, j int) bool {
+		return ns[i].ID < ns[j].ID
+	})
+	return
+}
+
+// GetNotifications :
+func (dao *GkvDB) GetNotifications(sinceID uint64, limit int) (ns []*models.Notification, err error) {
+	all, err := dao.getAllNotifications()
+	if err != nil {
+		return
+	}
+	for _, n := range all {
+		if n.ID <= sinceID {
+			continue
+		}
+		if limit > 0 && len(ns) >= limit {
+			break
+		}
+		ns = append(ns, n)
+	}
+	return
+}
+
+// GetLastNotificationID :
+func (dao *GkvDB) GetLastNotificationID() (id uint64, err error) {
+	all, err := dao.getAllNotifications()
+	if err != nil || len(all) == 0 {
+		return
+	}
+	return all[len(all)-1].ID, nil
+}
+
+// RemoveNotificationsBefore :
+func (dao *GkvDB) RemoveNotificationsBefore(id uint64) (err error) {
+	all, err := dao.getAllNotifications()
+	if err != nil {
+		return
+	}
+	for _, n := range all {
+		if n.ID >= id {
+			break
+		}
+		err = dao.removeKeyValueFromBucket(models.BucketNotification, n.ID)
+		if err != nil {
+			err = models.GeneratDBError(err)
+			return
+		}
+	}
+	return
+}
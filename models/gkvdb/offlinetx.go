@@ -0,0 +1,51 @@
+package gkvdb
+
+import (
+	"gitee.com/johng/gkvdb/gkvdb"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SaveOfflineTxBundle :
+func (dao *GkvDB) SaveOfflineTxBundle(b *models.OfflineTxBundle) (err error) {
+	b.Key = b.ChannelIdentifier[:]
+	err = dao.saveKeyValueToBucket(models.BucketOfflineTxBundle, b.ChannelIdentifier, b)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetOfflineTxBundle :
+func (dao *GkvDB) GetOfflineTxBundle(channelIdentifier common.Hash) (b *models.OfflineTxBundle, err error) {
+	b = &models.OfflineTxBundle{}
+	err = dao.getKeyValueToBucket(models.BucketOfflineTxBundle, channelIdentifier, b)
+	if err == ErrorNotFound {
+		err = rerr.ErrNotFound
+		return
+	}
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetAllOfflineTxBundles :
+func (dao *GkvDB) GetAllOfflineTxBundles() (bs []*models.OfflineTxBundle, err error) {
+	var tb *gkvdb.Table
+	tb, err = dao.db.Table(models.BucketOfflineTxBundle)
+	if err != nil {
+		err = models.GeneratDBError(err)
+		return
+	}
+	for _, v := range tb.Values(-1) {
+		var b models.OfflineTxBundle
+		gobDecode(v, &b)
+		bs = append(bs, &b)
+	}
+	return
+}
+
+// RemoveOfflineTxBundle :
+func (dao *GkvDB) RemoveOfflineTxBundle(channelIdentifier common.Hash) (err error) {
+	err = dao.removeKeyValueFromBucket(models.BucketOfflineTxBundle, channelIdentifier)
+	err = models.GeneratDBError(err)
+	return
+}
@@ -0,0 +1,49 @@
+package gkvdb
+
+import (
+	"gitee.com/johng/gkvdb/gkvdb"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+)
+
+// SaveOperation :
+func (dao *GkvDB) SaveOperation(op *models.Operation) (err error) {
+	err = dao.saveKeyValueToBucket(models.BucketOperation, op.Key, op)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetOperation :
+func (dao *GkvDB) GetOperation(id string) (op *models.Operation, err error) {
+	op = &models.Operation{}
+	err = dao.getKeyValueToBucket(models.BucketOperation, id, op)
+	if err == ErrorNotFound {
+		err = rerr.ErrNotFound
+		return
+	}
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetAllOperations :
+func (dao *GkvDB) GetAllOperations() (ops []*models.Operation, err error) {
+	var tb *gkvdb.Table
+	tb, err = dao.db.Table(models.BucketOperation)
+	if err != nil {
+		err = models.GeneratDBError(err)
+		return
+	}
+	for _, v := range tb.Values(-1) {
+		var op models.Operation
+		gobDecode(v, &op)
+		ops = append(ops, &op)
+	}
+	return
+}
+
+// RemoveOperation :
+func (dao *GkvDB) RemoveOperation(id string) (err error) {
+	err = dao.removeKeyValueFromBucket(models.BucketOperation, id)
+	err = models.GeneratDBError(err)
+	return
+}
@@ -0,0 +1,30 @@
+package gkvdb
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+)
+
+// SavePartnerFilter :
+func (dao *GkvDB) SavePartnerFilter(pf *models.PartnerFilter) (err error) {
+	pf.Key = models.KeyPartnerFilter
+	err = dao.saveKeyValueToBucket(models.BucketPartnerFilter, pf.Key, pf)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetPartnerFilter :
+func (dao *GkvDB) GetPartnerFilter() (pf *models.PartnerFilter) {
+	pf = &models.PartnerFilter{}
+	err := dao.getKeyValueToBucket(models.BucketPartnerFilter, models.KeyPartnerFilter, pf)
+	if err == ErrorNotFound {
+		return models.NewDefaultPartnerFilter()
+	}
+	if err != nil {
+		log.Error(fmt.Sprintf("GetPartnerFilter err %s, use default partner filter", err))
+		return models.NewDefaultPartnerFilter()
+	}
+	return
+}
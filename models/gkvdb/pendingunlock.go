@@ -0,0 +1,37 @@
+package gkvdb
+
+import (
+	"gitee.com/johng/gkvdb/gkvdb"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SavePendingUnlock :
+func (dao *GkvDB) SavePendingUnlock(p *models.PendingUnlock) (err error) {
+	err = dao.saveKeyValueToBucket(models.BucketPendingUnlock, p.Key[:], p)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetAllPendingUnlocks :
+func (dao *GkvDB) GetAllPendingUnlocks() (ps []*models.PendingUnlock, err error) {
+	var tb *gkvdb.Table
+	tb, err = dao.db.Table(models.BucketPendingUnlock)
+	if err != nil {
+		err = models.GeneratDBError(err)
+		return
+	}
+	for _, v := range tb.Values(-1) {
+		var p models.PendingUnlock
+		gobDecode(v, &p)
+		ps = append(ps, &p)
+	}
+	return
+}
+
+// RemovePendingUnlock :
+func (dao *GkvDB) RemovePendingUnlock(key common.Hash) (err error) {
+	err = dao.removeKeyValueFromBucket(models.BucketPendingUnlock, key[:])
+	err = models.GeneratDBError(err)
+	return
+}
@@ -0,0 +1,26 @@
+package gkvdb
+
+import (
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SavePfsIOU :
+func (dao *GkvDB) SavePfsIOU(iou *models.PfsIOU) (err error) {
+	err = dao.saveKeyValueToBucket(models.BucketPfsIOU, iou.Receiver[:], iou)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetPfsIOU :
+func (dao *GkvDB) GetPfsIOU(receiver common.Address) (iou *models.PfsIOU, err error) {
+	iou = &models.PfsIOU{}
+	err = dao.getKeyValueToBucket(models.BucketPfsIOU, receiver[:], iou)
+	if err == ErrorNotFound {
+		err = rerr.ErrNotFound
+		return
+	}
+	err = models.GeneratDBError(err)
+	return
+}
@@ -16,12 +16,13 @@ import (
 )
 
 // NewSentTransferDetail :
-func (dao *GkvDB) NewSentTransferDetail(tokenAddress, target common.Address, amount *big.Int, data string, isDirect bool, lockSecretHash common.Hash) {
+func (dao *GkvDB) NewSentTransferDetail(tokenAddress, target common.Address, amount *big.Int, data string, isDirect bool, lockSecretHash common.Hash, paymentID string, invoice []byte) {
 	std := &models.SentTransferDetail{
 		Key:               utils.Sha3(tokenAddress[:], lockSecretHash[:]).String(),
 		BlockNumber:       dao.GetLatestBlockNumber(),
 		TokenAddress:      tokenAddress,
 		TokenAddressBytes: tokenAddress[:],
+		LockSecretHash:    lockSecretHash,
 		TargetAddress:     target,
 		Amount:            amount,
 		Data:              data,
@@ -30,6 +31,8 @@ func (dao *GkvDB) NewSentTransferDetail(tokenAddress, target common.Address, amo
 		FinishTime:        0,
 		Status:            models.TransferStatusInit,
 		StatusMessage:     "",
+		PaymentID:         paymentID,
+		Invoice:           invoice,
 		ChannelIdentifier: utils.EmptyHash,
 		OpenBlockNumber:   0,
 	}
@@ -149,3 +152,21 @@ func appendSentTransferDetailIfMatch(list *[]*models.SentTransferDetail, st *mod
 		*list = append(*list, st)
 	}
 }
+
+// GetSentTransferDetailsByPaymentID :
+func (dao *GkvDB) GetSentTransferDetailsByPaymentID(paymentID string) (transfers []*models.SentTransferDetail, err error) {
+	var tb *gkvdb.Table
+	tb, err = dao.db.Table(models.BucketSentTransferDetail)
+	if err != nil {
+		err = models.GeneratDBError(err)
+		return
+	}
+	for _, v := range tb.Values(-1) {
+		var st models.SentTransferDetail
+		gobDecode(v, &st)
+		if st.PaymentID == paymentID {
+			transfers = append(transfers, &st)
+		}
+	}
+	return
+}
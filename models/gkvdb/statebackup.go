@@ -0,0 +1,44 @@
+package gkvdb
+
+import (
+	"gitee.com/johng/gkvdb/gkvdb"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SavePeerStateBackup :
+func (dao *GkvDB) SavePeerStateBackup(b *models.PeerStateBackup) (err error) {
+	b.Key = b.Owner[:]
+	err = dao.saveKeyValueToBucket(models.BucketPeerStateBackup, b.Owner, b)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetPeerStateBackup :
+func (dao *GkvDB) GetPeerStateBackup(owner common.Address) (b *models.PeerStateBackup, err error) {
+	b = &models.PeerStateBackup{}
+	err = dao.getKeyValueToBucket(models.BucketPeerStateBackup, owner, b)
+	if err == ErrorNotFound {
+		err = rerr.ErrNotFound
+		return
+	}
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetAllPeerStateBackup :
+func (dao *GkvDB) GetAllPeerStateBackup() (bs []*models.PeerStateBackup, err error) {
+	var tb *gkvdb.Table
+	tb, err = dao.db.Table(models.BucketPeerStateBackup)
+	if err != nil {
+		err = models.GeneratDBError(err)
+		return
+	}
+	for _, v := range tb.Values(-1) {
+		var b models.PeerStateBackup
+		gobDecode(v, &b)
+		bs = append(bs, &b)
+	}
+	return
+}
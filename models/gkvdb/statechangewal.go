@@ -0,0 +1,69 @@
+package gkvdb
+
+import (
+	"sort"
+	"time"
+
+	"gitee.com/johng/gkvdb/gkvdb"
+	"github.com/SmartMeshFoundation/Photon/models"
+)
+
+// AppendStateChangeWAL :
+func (dao *GkvDB) AppendStateChangeWAL(data []byte) (id uint64, err error) {
+	//处理完的会立即删除,WAL中的数据很少,直接找出最大的ID
+	es, err := dao.GetAllStateChangeWAL()
+	if err != nil {
+		return
+	}
+	e := &models.StateChangeWALEntry{
+		ID:          1,
+		StateChange: data,
+		Time:        time.Now().Unix(),
+	}
+	if len(es) > 0 {
+		e.ID = es[len(es)-1].ID + 1
+	}
+	_, err = dao.db.Table(models.BucketStateChangeWAL)
+	if err != nil {
+		err = models.GeneratDBError(err)
+		return
+	}
+	tx := dao.db.Begin()
+	err = tx.SetTo(gobEncode(e.ID), gobEncode(e), models.BucketStateChangeWAL)
+	if err != nil {
+		err = models.GeneratDBError(err)
+		return
+	}
+	err = tx.Commit(true)
+	if err != nil {
+		err = models.GeneratDBError(err)
+		return
+	}
+	return e.ID, nil
+}
+
+// RemoveStateChangeWAL :
+func (dao *GkvDB) RemoveStateChangeWAL(id uint64) (err error) {
+	err = dao.removeKeyValueFromBucket(models.BucketStateChangeWAL, id)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetAllStateChangeWAL :
+func (dao *GkvDB) GetAllStateChangeWAL() (es []*models.StateChangeWALEntry, err error) {
+	var tb *gkvdb.Table
+	tb, err = dao.db.Table(models.BucketStateChangeWAL)
+	if err != nil {
+		err = models.GeneratDBError(err)
+		return
+	}
+	for _, v := range tb.Values(-1) {
+		var e models.StateChangeWALEntry
+		gobDecode(v, &e)
+		es = append(es, &e)
+	}
+	sort.Slice(es, func(i, j int) bool {
+		return es[i].ID < es[j].ID
+	})
+	return
+}
@@ -0,0 +1,90 @@
+package gkvdb
+
+import (
+	"math"
+
+	"gitee.com/johng/gkvdb/gkvdb"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//removeStateChangeLogs 删除key对应的Seq不超过seq的所有日志
+func (dao *GkvDB) removeStateChangeLogs(key common.Hash, seq int64) (err error) {
+	logs, err := dao.GetStateChangeLogs(key)
+	if err != nil {
+		return
+	}
+	for _, l := range logs {
+		if l.Seq > seq {
+			break
+		}
+		err = dao.removeKeyValueFromBucket(models.BucketStateChangeLog, l.ID)
+		if err != nil {
+			err = models.GeneratDBError(err)
+			return
+		}
+	}
+	return
+}
+
+// SaveStateManagerSnapshot :
+func (dao *GkvDB) SaveStateManagerSnapshot(s *models.StateManagerSnapshot) (err error) {
+	err = dao.saveKeyValueToBucket(models.BucketStateManagerSnapshot, s.Key[:], s)
+	if err != nil {
+		err = models.GeneratDBError(err)
+		return
+	}
+	return dao.removeStateChangeLogs(s.Key, s.Seq)
+}
+
+// GetAllStateManagerSnapshots :
+func (dao *GkvDB) GetAllStateManagerSnapshots() (ss []*models.StateManagerSnapshot, err error) {
+	var tb *gkvdb.Table
+	tb, err = dao.db.Table(models.BucketStateManagerSnapshot)
+	if err != nil {
+		err = models.GeneratDBError(err)
+		return
+	}
+	for _, v := range tb.Values(-1) {
+		var s models.StateManagerSnapshot
+		gobDecode(v, &s)
+		ss = append(ss, &s)
+	}
+	return
+}
+
+// RemoveStateManagerSnapshot :
+func (dao *GkvDB) RemoveStateManagerSnapshot(key common.Hash) (err error) {
+	err = dao.removeKeyValueFromBucket(models.BucketStateManagerSnapshot, key[:])
+	if err != nil {
+		err = models.GeneratDBError(err)
+		return
+	}
+	return dao.removeStateChangeLogs(key, math.MaxInt64)
+}
+
+// NewStateChangeLog :
+func (dao *GkvDB) NewStateChangeLog(l *models.StateChangeLog) (err error) {
+	err = dao.saveKeyValueToBucket(models.BucketStateChangeLog, l.ID, l)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetStateChangeLogs :
+func (dao *GkvDB) GetStateChangeLogs(key common.Hash) (logs []*models.StateChangeLog, err error) {
+	var tb *gkvdb.Table
+	tb, err = dao.db.Table(models.BucketStateChangeLog)
+	if err != nil {
+		err = models.GeneratDBError(err)
+		return
+	}
+	for _, v := range tb.Values(-1) {
+		var l models.StateChangeLog
+		gobDecode(v, &l)
+		if l.Key == key {
+			logs = append(logs, &l)
+		}
+	}
+	models.SortStateChangeLogs(logs)
+	return
+}
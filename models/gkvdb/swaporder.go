@@ -0,0 +1,43 @@
+package gkvdb
+
+import (
+	"gitee.com/johng/gkvdb/gkvdb"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SaveSwapOrder :
+func (dao *GkvDB) SaveSwapOrder(o *models.SwapOrder) (err error) {
+	err = dao.saveKeyValueToBucket(models.BucketSwapOrder, o.LockSecretHash[:], o)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetSwapOrder :
+func (dao *GkvDB) GetSwapOrder(lockSecretHash common.Hash) (o *models.SwapOrder, err error) {
+	o = &models.SwapOrder{}
+	err = dao.getKeyValueToBucket(models.BucketSwapOrder, lockSecretHash[:], o)
+	if err == ErrorNotFound {
+		err = rerr.ErrNotFound
+		return
+	}
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetAllSwapOrders :
+func (dao *GkvDB) GetAllSwapOrders() (orders []*models.SwapOrder, err error) {
+	var tb *gkvdb.Table
+	tb, err = dao.db.Table(models.BucketSwapOrder)
+	if err != nil {
+		err = models.GeneratDBError(err)
+		return
+	}
+	for _, v := range tb.Values(-1) {
+		var o models.SwapOrder
+		gobDecode(v, &o)
+		orders = append(orders, &o)
+	}
+	return
+}
@@ -39,17 +39,25 @@ func (dao *GkvDB) AddToken(token common.Address, tokenNetworkAddress common.Addr
 	dao.handleTokenCallback(dao.newTokenCallbacks, token)
 	return models.GeneratDBError(err)
 }
-func (dao *GkvDB) handleTokenCallback(m map[*cb.NewTokenCb]bool, token common.Address) {
-	var cbs []*cb.NewTokenCb
+/*
+handleTokenCallback 在锁外调用回调,回调可以注册或者撤销其他回调而不会死锁
+*/
+func (dao *GkvDB) handleTokenCallback(m map[cb.ID]cb.NewTokenCb, token common.Address) {
 	dao.mlock.Lock()
-	for f := range m {
-		remove := (*f)(token)
-		if remove {
-			cbs = append(cbs, f)
+	cbs := make(map[cb.ID]cb.NewTokenCb, len(m))
+	for id, f := range m {
+		cbs[id] = f
+	}
+	dao.mlock.Unlock()
+	var removed []cb.ID
+	for id, f := range cbs {
+		if f(token) {
+			removed = append(removed, id)
 		}
 	}
-	for _, f := range cbs {
-		delete(m, f)
+	dao.mlock.Lock()
+	for _, id := range removed {
+		delete(m, id)
 	}
 	dao.mlock.Unlock()
 }
@@ -14,7 +14,7 @@ import (
 )
 
 //NewReceivedTransfer save a new received transfer to db
-func (dao *GkvDB) NewReceivedTransfer(blockNumber int64, channelIdentifier common.Hash, openBlockNumber int64, tokenAddr, fromAddr common.Address, nonce uint64, amount *big.Int, lockSecretHash common.Hash, data string) *models.ReceivedTransfer {
+func (dao *GkvDB) NewReceivedTransfer(blockNumber int64, channelIdentifier common.Hash, openBlockNumber int64, tokenAddr, fromAddr common.Address, nonce uint64, amount *big.Int, lockSecretHash common.Hash, data string, paymentID string, invoice []byte) *models.ReceivedTransfer {
 	if lockSecretHash == utils.EmptyHash {
 		// direct transfer, use fakeLockSecretHash
 		lockSecretHash = utils.NewRandomHash()
@@ -32,6 +32,8 @@ func (dao *GkvDB) NewReceivedTransfer(blockNumber int64, channelIdentifier commo
 		Data:              data,
 		OpenBlockNumber:   openBlockNumber,
 		TimeStamp:         time.Now().Unix(),
+		PaymentID:         paymentID,
+		Invoice:           invoice,
 	}
 	var ost models.ReceivedTransfer
 	err := dao.getKeyValueToBucket(models.BucketReceivedTransfer, key, &ost)
@@ -90,3 +92,21 @@ func appendReceivedTransferIfMatch(list *[]*models.ReceivedTransfer, st *models.
 		*list = append(*list, st)
 	}
 }
+
+//GetReceivedTransfersByPaymentID returns all received transfers with `paymentID`
+func (dao *GkvDB) GetReceivedTransfersByPaymentID(paymentID string) (transfers []*models.ReceivedTransfer, err error) {
+	var tb *gkvdb.Table
+	tb, err = dao.db.Table(models.BucketReceivedTransfer)
+	if err != nil {
+		err = models.GeneratDBError(err)
+		return
+	}
+	for _, v := range tb.Values(-1) {
+		var st models.ReceivedTransfer
+		gobDecode(v, &st)
+		if st.PaymentID == paymentID {
+			transfers = append(transfers, &st)
+		}
+	}
+	return
+}
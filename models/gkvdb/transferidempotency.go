@@ -0,0 +1,24 @@
+package gkvdb
+
+import (
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+)
+
+// NewTransferIdempotency :
+func (dao *GkvDB) NewTransferIdempotency(t *models.TransferIdempotency) (err error) {
+	err = dao.saveKeyValueToBucket(models.BucketTransferIdempotency, t.Key, t)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetTransferIdempotency :
+func (dao *GkvDB) GetTransferIdempotency(key string) (t *models.TransferIdempotency, err error) {
+	t = &models.TransferIdempotency{}
+	err = dao.getKeyValueToBucket(models.BucketTransferIdempotency, key, t)
+	if err == ErrorNotFound {
+		err = rerr.ErrNotFound
+	}
+	err = models.GeneratDBError(err)
+	return
+}
@@ -0,0 +1,49 @@
+package gkvdb
+
+import (
+	"math/big"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// NewTransferLifecycle :
+func (dao *GkvDB) NewTransferLifecycle(l *models.TransferLifecycle) (err error) {
+	l.Key = l.LockSecretHash.String()
+	err = dao.saveKeyValueToBucket(models.BucketTransferLifecycle, l.Key, l)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// AddTransferTransition :
+func (dao *GkvDB) AddTransferTransition(lockSecretHash common.Hash, stage models.TransferStage, reason string) (l *models.TransferLifecycle, err error) {
+	l, err = dao.GetTransferLifecycle(lockSecretHash)
+	if err != nil {
+		return
+	}
+	l.AddTransition(stage, reason)
+	err = dao.saveKeyValueToBucket(models.BucketTransferLifecycle, l.Key, l)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// SetTransferRoute :
+func (dao *GkvDB) SetTransferRoute(lockSecretHash common.Hash, fee *big.Int, path []common.Address) (err error) {
+	l, err := dao.GetTransferLifecycle(lockSecretHash)
+	if err != nil {
+		return
+	}
+	l.Fee = fee
+	l.Path = path
+	err = dao.saveKeyValueToBucket(models.BucketTransferLifecycle, l.Key, l)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetTransferLifecycle :
+func (dao *GkvDB) GetTransferLifecycle(lockSecretHash common.Hash) (l *models.TransferLifecycle, err error) {
+	l = &models.TransferLifecycle{}
+	err = dao.getKeyValueToBucket(models.BucketTransferLifecycle, lockSecretHash.String(), l)
+	err = models.GeneratDBError(err)
+	return
+}
@@ -0,0 +1,49 @@
+package gkvdb
+
+import (
+	"gitee.com/johng/gkvdb/gkvdb"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+)
+
+// SaveWebhookDeadLetter :
+func (dao *GkvDB) SaveWebhookDeadLetter(dl *models.WebhookDeadLetter) (err error) {
+	err = dao.saveKeyValueToBucket(models.BucketWebhookDeadLetter, dl.Key, dl)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetWebhookDeadLetter :
+func (dao *GkvDB) GetWebhookDeadLetter(id string) (dl *models.WebhookDeadLetter, err error) {
+	dl = &models.WebhookDeadLetter{}
+	err = dao.getKeyValueToBucket(models.BucketWebhookDeadLetter, id, dl)
+	if err == ErrorNotFound {
+		err = rerr.ErrNotFound
+		return
+	}
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetAllWebhookDeadLetters :
+func (dao *GkvDB) GetAllWebhookDeadLetters() (dls []*models.WebhookDeadLetter, err error) {
+	var tb *gkvdb.Table
+	tb, err = dao.db.Table(models.BucketWebhookDeadLetter)
+	if err != nil {
+		err = models.GeneratDBError(err)
+		return
+	}
+	for _, v := range tb.Values(-1) {
+		var dl models.WebhookDeadLetter
+		gobDecode(v, &dl)
+		dls = append(dls, &dl)
+	}
+	return
+}
+
+// RemoveWebhookDeadLetter :
+func (dao *GkvDB) RemoveWebhookDeadLetter(id string) (err error) {
+	err = dao.removeKeyValueFromBucket(models.BucketWebhookDeadLetter, id)
+	err = models.GeneratDBError(err)
+	return
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+MonitoringDelegation 委托给第三方监控服务的BalanceProof.
+离线期间对方关闭通道时,监控服务用它代替我updateBalanceProof和unlock,每个通道只保留最新的一次委托
+*/
+type MonitoringDelegation struct {
+	ChannelIdentifier common.Hash    `json:"channel_identifier" storm:"id"`
+	OpenBlockNumber   int64          `json:"open_block_number"`
+	TokenAddress      common.Address `json:"token_address"`
+	PartnerAddress    common.Address `json:"partner_address"`
+	Nonce             uint64         `json:"nonce"`
+	TransferAmount    *big.Int       `json:"transfer_amount"`
+	LockedAmount      *big.Int       `json:"locked_amount"` //委托的unlock中锁的总金额
+	Reward            *big.Int       `json:"reward"`
+	ServiceURL        string         `json:"service_url"`
+	DelegateTime      int64          `json:"delegate_time"`
+}
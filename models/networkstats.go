@@ -0,0 +1,68 @@
+package models
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+NetworkStatsReport 一个节点的匿名统计,只有每种token的汇总数据,不包含任何通道和对方的信息.
+ReporterID由节点私钥推导,无法由它得到节点地址,只用于去重
+*/
+type NetworkStatsReport struct {
+	Key         []byte               `storm:"id" json:"-"`
+	ReporterID  common.Hash          `json:"reporter_id"`
+	BlockNumber int64                `json:"block_number"` // 统计时的块号,同一个节点只保留最新的统计
+	Tokens      []*TokenNetworkStats `json:"tokens"`
+}
+
+/*
+TokenNetworkStats 一种token的汇总数据.
+通道只由地址较小的一方统计,容量是各方在打开的通道中余额之和,这样所有节点的统计相加时不会重复计算
+*/
+type TokenNetworkStats struct {
+	Token    common.Address `json:"token_address"`
+	Channels int64          `json:"channels"`
+	Capacity *big.Int       `json:"capacity"`
+}
+
+//NetworkStats 全网统计,是所有已知节点统计的总和
+type NetworkStats struct {
+	Reporters   int                  `json:"reporters"`
+	OldestBlock int64                `json:"oldest_block"` // 参与统计的报告中最早的块号
+	Tokens      []*TokenNetworkStats `json:"tokens"`
+}
+
+//AggregateNetworkStats sums up `reports` per token, tokens are sorted by address
+func AggregateNetworkStats(reports []*NetworkStatsReport) *NetworkStats {
+	s := &NetworkStats{
+		Reporters: len(reports),
+		Tokens:    []*TokenNetworkStats{},
+	}
+	tokens := make(map[common.Address]*TokenNetworkStats)
+	for _, r := range reports {
+		if s.OldestBlock == 0 || r.BlockNumber < s.OldestBlock {
+			s.OldestBlock = r.BlockNumber
+		}
+		for _, t := range r.Tokens {
+			ts, ok := tokens[t.Token]
+			if !ok {
+				ts = &TokenNetworkStats{
+					Token:    t.Token,
+					Capacity: big.NewInt(0),
+				}
+				tokens[t.Token] = ts
+				s.Tokens = append(s.Tokens, ts)
+			}
+			ts.Channels += t.Channels
+			ts.Capacity.Add(ts.Capacity, t.Capacity)
+		}
+	}
+	sort.Slice(s.Tokens, func(i, j int) bool {
+		return bytes.Compare(s.Tokens[i].Token[:], s.Tokens[j].Token[:]) < 0
+	})
+	return s
+}
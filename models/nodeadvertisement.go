@@ -0,0 +1,68 @@
+package models
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+NodeAdvertisement 节点自己发布的公开信息,由节点自己签名,其他节点和PFS可以通过消息查询
+*/
+type NodeAdvertisement struct {
+	Key             string           `storm:"id" json:"-"`
+	NodeAddress     common.Address   `json:"node_address"`
+	OperatorContact string           `json:"operator_contact"` // 运营者联系方式
+	FeePolicyURL    string           `json:"fee_policy_url"`   // 收费政策说明
+	SupportedTokens []common.Address `json:"supported_tokens"`
+	GeoHint         string           `json:"geo_hint"` // 大致地理位置,比如国家或者城市
+	Timestamp       int64            `json:"timestamp"`
+	Signature       []byte           `json:"signature"`
+}
+
+func (na *NodeAdvertisement) signData() []byte {
+	var err error
+	buf := new(bytes.Buffer)
+	_, err = buf.Write(na.NodeAddress[:])
+	_, err = buf.Write([]byte(na.OperatorContact))
+	_, err = buf.Write([]byte(na.FeePolicyURL))
+	for _, t := range na.SupportedTokens {
+		_, err = buf.Write(t[:])
+	}
+	_, err = buf.Write([]byte(na.GeoHint))
+	err = binary.Write(buf, binary.BigEndian, na.Timestamp)
+	if err != nil {
+		log.Error(fmt.Sprintf("NodeAdvertisement signData err %s", err))
+	}
+	return buf.Bytes()
+}
+
+// Sign 用节点私钥签名
+func (na *NodeAdvertisement) Sign(key *ecdsa.PrivateKey) (err error) {
+	na.Signature, err = utils.SignData(key, na.signData())
+	return
+}
+
+// VerifySignature 校验签名是否来自NodeAddress
+func (na *NodeAdvertisement) VerifySignature() error {
+	sig := make([]byte, len(na.Signature))
+	copy(sig, na.Signature)
+	signer, err := utils.Ecrecover(utils.Sha3(na.signData()), sig)
+	if err != nil {
+		return err
+	}
+	if signer != na.NodeAddress {
+		return fmt.Errorf("node advertisement signer %s not match node %s", signer.String(), na.NodeAddress.String())
+	}
+	return nil
+}
+
+func init() {
+	gob.Register(&NodeAdvertisement{})
+}
@@ -0,0 +1,20 @@
+package models
+
+import "github.com/ethereum/go-ethereum/common"
+
+/*
+Notification 持久化的通知,ID就是notify中的Seq,重启以后继续递增.
+Notice和ReceivedTransfer只有一个,ReceivedTransfer为nil时Level和Info有效,
+InfoType,EventCode,TokenAddress和ChannelIdentifier是按照订阅条件过滤时用到的属性
+*/
+type Notification struct {
+	ID                uint64            `storm:"id"`
+	Level             int               //Notice的级别
+	Info              string            //Notice的内容
+	ReceivedTransfer  *ReceivedTransfer //收到的交易
+	InfoType          int
+	EventCode         int
+	TokenAddress      common.Address
+	ChannelIdentifier common.Hash
+	Time              int64 //通知产生的时间
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+//离线签名交易的种类,按照在争议期内提交的先后顺序排列
+const (
+	OfflineTxKindUpdateBalanceProof = "update_balance_proof"
+	OfflineTxKindUnlock             = "unlock"
+	OfflineTxKindSettle             = "settle"
+)
+
+//离线签名交易的状态
+const (
+	OfflineTxStatusUnsigned  = "unsigned"
+	OfflineTxStatusSigned    = "signed"
+	OfflineTxStatusSubmitted = "submitted"
+	OfflineTxStatusFailed    = "failed"
+)
+
+/*
+OfflineTx 一笔等待离线签名的交易,除签名以外的所有字段都已确定,
+签名方只需用同样的nonce,gasPrice,gasLimit,to和data签名即可.
+NotBefore之前不能提交,Deadline之后提交没有意义,Deadline为0表示没有截止时间
+*/
+type OfflineTx struct {
+	Kind      string         `json:"kind"`
+	To        common.Address `json:"to"`
+	Data      hexutil.Bytes  `json:"data"`
+	Nonce     uint64         `json:"nonce"`
+	GasPrice  *big.Int       `json:"gas_price"`
+	GasLimit  uint64         `json:"gas_limit"`
+	ChainID   *big.Int       `json:"chain_id"`
+	NotBefore int64          `json:"not_before"`
+	Deadline  int64          `json:"deadline"`
+	SignedTx  hexutil.Bytes  `json:"signed_tx,omitempty"`
+	TxHash    common.Hash    `json:"tx_hash"`
+	Status    string         `json:"status"`
+	Error     string         `json:"error,omitempty"`
+}
+
+//CanSubmit returns true if tx is signed and blockNumber is in [NotBefore,Deadline]
+func (tx *OfflineTx) CanSubmit(blockNumber int64) bool {
+	return tx.Status == OfflineTxStatusSigned && blockNumber >= tx.NotBefore && !tx.Expired(blockNumber)
+}
+
+//Expired returns true if it's too late to submit this tx
+func (tx *OfflineTx) Expired(blockNumber int64) bool {
+	return tx.Deadline > 0 && blockNumber > tx.Deadline
+}
+
+/*
+OfflineTxBundle 一个已关闭通道在争议期内需要的全部交易,交易nonce连续,必须按顺序提交
+*/
+type OfflineTxBundle struct {
+	Key               []byte         `storm:"id" json:"-"`
+	ChannelIdentifier common.Hash    `json:"channel_identifier"`
+	Token             common.Address `json:"token_address"`
+	Partner           common.Address `json:"partner_address"`
+	Signer            common.Address `json:"signer"`
+	CreateBlock       int64          `json:"create_block"`
+	Txs               []*OfflineTx   `json:"txs"`
+}
+
+//IsSigned returns true if every tx of this bundle has been signed
+func (b *OfflineTxBundle) IsSigned() bool {
+	for _, tx := range b.Txs {
+		if tx.Status == OfflineTxStatusUnsigned {
+			return false
+		}
+	}
+	return true
+}
+
+//IsFinished returns true if no tx of this bundle needs to be submitted any more
+func (b *OfflineTxBundle) IsFinished() bool {
+	for _, tx := range b.Txs {
+		if tx.Status == OfflineTxStatusUnsigned || tx.Status == OfflineTxStatusSigned {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+NextToSubmit 返回当前块可以提交的交易,必须按顺序提交,前面的交易还没到时间后面的也不能提交.
+错过截止时间的交易标记为失败,由于nonce连续,它之后的交易也不可能被打包,一并标记为失败.
+changed为true表示有交易的状态发生了变化,需要保存
+*/
+func (b *OfflineTxBundle) NextToSubmit(blockNumber int64) (txs []*OfflineTx, changed bool) {
+	for i, tx := range b.Txs {
+		if tx.Status == OfflineTxStatusSubmitted {
+			continue
+		}
+		if tx.Status != OfflineTxStatusSigned {
+			return
+		}
+		if tx.Expired(blockNumber) {
+			for _, tx2 := range b.Txs[i:] {
+				tx2.Status = OfflineTxStatusFailed
+				tx2.Error = "previous tx missed its deadline"
+			}
+			tx.Error = "deadline passed before submission"
+			changed = true
+			return
+		}
+		if !tx.CanSubmit(blockNumber) {
+			return
+		}
+		txs = append(txs, tx)
+	}
+	return
+}
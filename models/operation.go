@@ -0,0 +1,30 @@
+package models
+
+//长时间操作的状态
+const (
+	OperationStatusPending     = "pending"
+	OperationStatusSucceeded   = "succeeded"
+	OperationStatusFailed      = "failed"
+	OperationStatusCanceled    = "canceled"
+	OperationStatusTimeout     = "timeout"
+	OperationStatusInterrupted = "interrupted" //photon重启时操作还没有完成,结果未知
+)
+
+/*
+Operation 一个长时间操作的记录,调用者可以通过ID查询进度和结果,重启以后依然可以查询
+*/
+type Operation struct {
+	Key       string   `storm:"id" json:"id"`
+	Name      string   `json:"name"`
+	Status    string   `json:"status"`
+	Progress  []string `json:"progress"`
+	Error     string   `json:"error,omitempty"`
+	StartTime int64    `json:"start_time"`
+	Deadline  int64    `json:"deadline"`
+	EndTime   int64    `json:"end_time,omitempty"`
+}
+
+//IsFinished returns true if this operation will not change any more
+func (op *Operation) IsFinished() bool {
+	return op.Status != OperationStatusPending
+}
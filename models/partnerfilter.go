@@ -0,0 +1,47 @@
+package models
+
+import (
+	"encoding/gob"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+PartnerFilter 通道伙伴的黑白名单
+1. 黑名单中的节点,永远不会和他创建通道或者向通道中存款
+2. 白名单不为空时,只和白名单中的节点创建通道或者向通道中存款
+*/
+type PartnerFilter struct {
+	Key       string           `storm:"id"`
+	Blacklist []common.Address `json:"blacklist"`
+	Whitelist []common.Address `json:"whitelist"`
+}
+
+// NewDefaultPartnerFilter : 默认不限制任何节点
+func NewDefaultPartnerFilter() *PartnerFilter {
+	return &PartnerFilter{
+		Key: KeyPartnerFilter,
+	}
+}
+
+// IsAllowed 是否允许与`partner`创建通道或者向通道中存款
+func (pf *PartnerFilter) IsAllowed(partner common.Address) bool {
+	for _, addr := range pf.Blacklist {
+		if addr == partner {
+			return false
+		}
+	}
+	if len(pf.Whitelist) == 0 {
+		return true
+	}
+	for _, addr := range pf.Whitelist {
+		if addr == partner {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	gob.Register(&PartnerFilter{})
+}
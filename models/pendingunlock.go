@@ -0,0 +1,33 @@
+package models
+
+import (
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+PendingUnlock 通道被对方关闭时,对方发给我的锁中我知道密码的,需要在settle之前链上解锁.
+保存下来是为了重启以后还能继续完成
+*/
+type PendingUnlock struct {
+	Key                 common.Hash `storm:"id"`
+	ChannelIdentifier   common.Hash `storm:"index"`
+	LockSecretHash      common.Hash
+	Secret              common.Hash
+	Expiration          int64 //锁的过期块,密码必须在此之前链上注册
+	SettleBlock         int64 //超过这个块以后通道随时可能被settle,不能再unlock
+	RegisterSubmitBlock int64 //最近一次提交注册密码的块
+	UnlockWaitBlock     int64 //开始等待unlock结果的块,0表示还没有开始
+}
+
+//NewPendingUnlock Key由ChannelIdentifier和LockSecretHash组成
+func NewPendingUnlock(channelIdentifier, lockSecretHash, secret common.Hash, expiration, settleBlock int64) *PendingUnlock {
+	return &PendingUnlock{
+		Key:               utils.Sha3(channelIdentifier[:], lockSecretHash[:]),
+		ChannelIdentifier: channelIdentifier,
+		LockSecretHash:    lockSecretHash,
+		Secret:            secret,
+		Expiration:        expiration,
+		SettleBlock:       settleBlock,
+	}
+}
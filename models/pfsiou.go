@@ -0,0 +1,17 @@
+package models
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+PfsIOU 最近一次付给pfs的欠条.
+欠条的金额是累计的,重启以后也必须在这个金额的基础上继续增加,否则pfs会认为是重复的欠条
+*/
+type PfsIOU struct {
+	Receiver        common.Address `json:"receiver" storm:"id"`
+	Amount          *big.Int       `json:"amount"`
+	ExpirationBlock int64          `json:"expiration_block"`
+}
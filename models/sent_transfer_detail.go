@@ -22,6 +22,8 @@ type SentTransferDetail struct {
 	FinishTime        int64              `json:"finish_time" storm:"index"`
 	Status            TransferStatusCode `json:"status"`
 	StatusMessage     string             `json:"status_message"`
+	PaymentID         string             `json:"payment_id,omitempty" storm:"index"` //用户指定的支付ID
+	Invoice           []byte             `json:"invoice,omitempty"`
 
 	/*
 		通道相关信息,如果为MediatorTransfer, 保存的是我与第一个mediator节点的通道上的信息,这部分信息仅交易成功才会有
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+StateBackupChunk 一次通道状态备份,数据由备份所有者用自己的公钥加密,保存者无法解密.
+Full为true表示全量备份,否则只包含上一次备份以后发生变化的通道.
+*/
+type StateBackupChunk struct {
+	Sequence     int64    `json:"sequence"`
+	Full         bool     `json:"full"`
+	Total        int      `json:"total"`     //分片总数
+	Fragments    [][]byte `json:"fragments"` //加密以后的备份数据分片
+	ReceivedTime int64    `json:"received_time"`
+}
+
+func (c *StateBackupChunk) complete() bool {
+	for _, f := range c.Fragments {
+		if f == nil {
+			return false
+		}
+	}
+	return true
+}
+
+//Data 拼接所有分片,得到加密的备份数据
+func (c *StateBackupChunk) Data() []byte {
+	return bytes.Join(c.Fragments, nil)
+}
+
+/*
+PeerStateBackup 为同一运营者的其他节点保存的加密备份,从最近一次全量备份开始依次应用Chunks即可恢复所有通道状态
+*/
+type PeerStateBackup struct {
+	Key     []byte              `storm:"id" json:"-"`
+	Owner   common.Address      `json:"owner"`
+	Chunks  []*StateBackupChunk `json:"chunks"`
+	Pending *StateBackupChunk   `json:"pending,omitempty"` //正在接收分片的备份
+}
+
+//NewPeerStateBackup create PeerStateBackup for `owner`
+func NewPeerStateBackup(owner common.Address) *PeerStateBackup {
+	return &PeerStateBackup{
+		Key:   owner[:],
+		Owner: owner,
+	}
+}
+
+/*
+AddFragment 收到备份`sequence`的第`index`个分片,返回这次备份是否已经接收完整.
+开始接收新的备份时,没有接收完整的旧备份会被丢弃,备份所有者重启以后会重新发送全量备份.
+*/
+func (b *PeerStateBackup) AddFragment(sequence int64, full bool, index, total int, data []byte, receivedTime int64) (complete bool, err error) {
+	if total <= 0 || index < 0 || index >= total || len(data) == 0 {
+		return false, fmt.Errorf("invalid state backup fragment %d/%d", index, total)
+	}
+	if len(b.Chunks) > 0 && sequence <= b.Chunks[len(b.Chunks)-1].Sequence {
+		return false, fmt.Errorf("state backup %d is older than %d", sequence, b.Chunks[len(b.Chunks)-1].Sequence)
+	}
+	if b.Pending == nil || b.Pending.Sequence != sequence {
+		b.Pending = &StateBackupChunk{
+			Sequence:  sequence,
+			Full:      full,
+			Total:     total,
+			Fragments: make([][]byte, total),
+		}
+	}
+	if b.Pending.Total != total || b.Pending.Full != full {
+		return false, fmt.Errorf("state backup %d fragment mismatch", sequence)
+	}
+	b.Pending.Fragments[index] = data
+	if !b.Pending.complete() {
+		return false, nil
+	}
+	b.Pending.ReceivedTime = receivedTime
+	if b.Pending.Full {
+		b.Chunks = nil
+	}
+	b.Chunks = append(b.Chunks, b.Pending)
+	b.Pending = nil
+	return true, nil
+}
@@ -0,0 +1,11 @@
+package models
+
+/*
+StateChangeWALEntry 还没有处理完的StateChange,
+StateChange是photon收到以后,处理之前gob编码的结果,处理完以后删除
+*/
+type StateChangeWALEntry struct {
+	ID          uint64 `storm:"id,increment"`
+	StateChange []byte
+	Time        int64
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+StateManagerSnapshot 某个时刻发起方/中间节点/接收方StateManager的完整状态.
+Key是Transfer2StateManager中的key,Seq是快照的版本,
+Data是gob编码的StateManager,由photon负责编码和解码,
+每处理完一个StateChange保存一次,重启以后直接从快照恢复
+*/
+type StateManagerSnapshot struct {
+	Key  common.Hash `storm:"id"`
+	Seq  int64
+	Data []byte
+}
+
+/*
+StateChangeLog 旧版本在两次快照之间记录的StateChange,现在不再记录,
+只用来识别旧版本留下的,后面还有日志需要重放的快照
+*/
+type StateChangeLog struct {
+	ID          []byte      `storm:"id"`
+	Key         common.Hash `storm:"index"`
+	Seq         int64
+	StateChange []byte
+}
+
+//NewStateChangeLog 创建一条日志,ID由Key和Seq组成,保证唯一
+func NewStateChangeLog(key common.Hash, seq int64, stateChange []byte) *StateChangeLog {
+	id := make([]byte, len(key)+8)
+	copy(id, key[:])
+	binary.BigEndian.PutUint64(id[len(key):], uint64(seq))
+	return &StateChangeLog{
+		ID:          id,
+		Key:         key,
+		Seq:         seq,
+		StateChange: stateChange,
+	}
+}
+
+//SortStateChangeLogs 按照处理的先后顺序排序
+func SortStateChangeLogs(logs []*StateChangeLog) {
+	sort.Slice(logs, func(i, j int) bool {
+		return logs[i].Seq < logs[j].Seq
+	})
+}
@@ -3,60 +3,62 @@ package stormdb
 import "github.com/SmartMeshFoundation/Photon/models/cb"
 
 // RegisterNewTokenCallback register a new token callback
-func (model *StormDB) RegisterNewTokenCallback(f cb.NewTokenCb) {
+func (model *StormDB) RegisterNewTokenCallback(f cb.NewTokenCb) (id cb.ID) {
 	model.mlock.Lock()
-	model.newTokenCallbacks[&f] = true
+	model.nextCallbackID++
+	id = model.nextCallbackID
+	model.newTokenCallbacks[id] = f
 	model.mlock.Unlock()
+	return
 }
 
 // RegisterNewChannelCallback register a new channel callback
-func (model *StormDB) RegisterNewChannelCallback(f cb.ChannelCb) {
+func (model *StormDB) RegisterNewChannelCallback(f cb.ChannelCb) (id cb.ID) {
 	model.mlock.Lock()
-	model.newChannelCallbacks[&f] = true
+	model.nextCallbackID++
+	id = model.nextCallbackID
+	model.newChannelCallbacks[id] = f
 	model.mlock.Unlock()
+	return
 }
 
 //RegisterChannelDepositCallback register channel deposit callback
-func (model *StormDB) RegisterChannelDepositCallback(f cb.ChannelCb) {
+func (model *StormDB) RegisterChannelDepositCallback(f cb.ChannelCb) (id cb.ID) {
 	model.mlock.Lock()
-	model.channelDepositCallbacks[&f] = true
+	model.nextCallbackID++
+	id = model.nextCallbackID
+	model.channelDepositCallbacks[id] = f
 	model.mlock.Unlock()
+	return
 }
 
 //RegisterChannelStateCallback notify when channel closed
-func (model *StormDB) RegisterChannelStateCallback(f cb.ChannelCb) {
+func (model *StormDB) RegisterChannelStateCallback(f cb.ChannelCb) (id cb.ID) {
 	model.mlock.Lock()
-	model.channelStateCallbacks[&f] = true
+	model.nextCallbackID++
+	id = model.nextCallbackID
+	model.channelStateCallbacks[id] = f
 	model.mlock.Unlock()
+	return
 }
 
 //RegisterChannelSettleCallback notify when channel settled
-func (model *StormDB) RegisterChannelSettleCallback(f cb.ChannelCb) {
+func (model *StormDB) RegisterChannelSettleCallback(f cb.ChannelCb) (id cb.ID) {
 	model.mlock.Lock()
-	model.channelSettledCallbacks[&f] = true
+	model.nextCallbackID++
+	id = model.nextCallbackID
+	model.channelSettledCallbacks[id] = f
 	model.mlock.Unlock()
+	return
 }
 
-/*
-do we need remove a callback?
-*/
-func (model *StormDB) unRegisterNewTokenCallback(f cb.NewTokenCb) {
+//RemoveCallback 撤销`id`对应的回调,回调已经不存在时什么也不做
+func (model *StormDB) RemoveCallback(id cb.ID) {
 	model.mlock.Lock()
-	delete(model.newTokenCallbacks, &f)
-	model.mlock.Unlock()
-}
-func (model *StormDB) unRegisterNewChannelCallback(f cb.ChannelCb) {
-	model.mlock.Lock()
-	delete(model.newChannelCallbacks, &f)
-	model.mlock.Unlock()
-}
-func (model *StormDB) unRegisterChannelDepositCallback(f cb.ChannelCb) {
-	model.mlock.Lock()
-	delete(model.channelDepositCallbacks, &f)
-	model.mlock.Unlock()
-}
-func (model *StormDB) unRegisterChannelStateCallback(f cb.ChannelCb) {
-	model.mlock.Lock()
-	delete(model.channelStateCallbacks, &f)
+	delete(model.newTokenCallbacks, id)
+	delete(model.newChannelCallbacks, id)
+	delete(model.channelDepositCallbacks, id)
+	delete(model.channelStateCallbacks, id)
+	delete(model.channelSettledCallbacks, id)
 	model.mlock.Unlock()
 }
@@ -0,0 +1,48 @@
+package stormdb
+
+import (
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/asdine/storm"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// NewChannelEvent :
+func (model *StormDB) NewChannelEvent(e *models.ChannelEvent) (err error) {
+	e.Key = e.MakeKey()
+	err = model.db.One("Key", e.Key, &models.ChannelEvent{})
+	if err == nil {
+		return
+	}
+	if err != storm.ErrNotFound {
+		err = models.GeneratDBError(err)
+		return
+	}
+	if e.Time == 0 {
+		e.Time = time.Now().UnixNano()
+	}
+	err = model.db.Save(e)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetChannelEvents :
+func (model *StormDB) GetChannelEvents(channelIdentifier common.Hash, fromBlock, toBlock int64) (events []*models.ChannelEvent, err error) {
+	var all []*models.ChannelEvent
+	err = model.db.Find("ChannelIdentifier", channelIdentifier, &all)
+	if err == storm.ErrNotFound {
+		err = nil
+	}
+	if err != nil {
+		err = models.GeneratDBError(err)
+		return
+	}
+	for _, e := range all {
+		if e.BlockNumber >= fromBlock && (toBlock <= 0 || e.BlockNumber < toBlock) {
+			events = append(events, e)
+		}
+	}
+	models.SortChannelEvents(events)
+	return
+}
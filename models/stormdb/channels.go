@@ -56,17 +56,25 @@ func (model *StormDB) UpdateChannelAndSaveAck(c *channeltype.Serialization, echo
 	err = models.GeneratDBError(err)
 	return
 }
-func (model *StormDB) handleChannelCallback(m map[*cb.ChannelCb]bool, c *channeltype.Serialization) {
-	var cbs []*cb.ChannelCb
+/*
+handleChannelCallback 在锁外调用回调,回调可以注册或者撤销其他回调而不会死锁
+*/
+func (model *StormDB) handleChannelCallback(m map[cb.ID]cb.ChannelCb, c *channeltype.Serialization) {
 	model.mlock.Lock()
-	for f := range m {
-		remove := (*f)(c)
-		if remove {
-			cbs = append(cbs, f)
+	cbs := make(map[cb.ID]cb.ChannelCb, len(m))
+	for id, f := range m {
+		cbs[id] = f
+	}
+	model.mlock.Unlock()
+	var removed []cb.ID
+	for id, f := range cbs {
+		if f(c) {
+			removed = append(removed, id)
 		}
 	}
-	for _, f := range cbs {
-		delete(m, f)
+	model.mlock.Lock()
+	for _, id := range removed {
+		delete(m, id)
 	}
 	model.mlock.Unlock()
 }
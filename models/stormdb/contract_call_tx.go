@@ -58,6 +58,7 @@ func (model *StormDB) NewPendingTXInfo(tx *types.Transaction, txType models.TXIn
 		Status:            models.TXInfoStatusPending,
 		CallTime:          time.Now().Unix(),
 		GasPrice:          tx.GasPrice().Uint64(),
+		Nonce:             tx.Nonce(),
 	}
 	err = model.db.Save(txInfo.ToTXInfoSerialization())
 	if err != nil {
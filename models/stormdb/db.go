@@ -5,41 +5,40 @@ import (
 
 	"sync"
 
-	"time"
-
 	"encoding/gob"
 
-	"os"
-
 	"github.com/SmartMeshFoundation/Photon/log"
 	"github.com/SmartMeshFoundation/Photon/models"
 	"github.com/SmartMeshFoundation/Photon/models/cb"
 	"github.com/asdine/storm"
-	gobcodec "github.com/asdine/storm/codec/gob"
-	"github.com/coreos/bbolt"
 	"github.com/ethereum/go-ethereum/common"
 )
 
 //StormDB is thread safe
 type StormDB struct {
 	db                      *storm.DB
+	historyDb               *storm.DB //交易历史,收费记录等可重建的数据
+	syncConfig              models.SyncConfig
+	syncQuit                chan struct{}
 	lock                    sync.Mutex
-	newTokenCallbacks       map[*cb.NewTokenCb]bool
-	newChannelCallbacks     map[*cb.ChannelCb]bool
-	channelDepositCallbacks map[*cb.ChannelCb]bool
-	channelStateCallbacks   map[*cb.ChannelCb]bool
-	channelSettledCallbacks map[*cb.ChannelCb]bool
+	newTokenCallbacks       map[cb.ID]cb.NewTokenCb
+	newChannelCallbacks     map[cb.ID]cb.ChannelCb
+	channelDepositCallbacks map[cb.ID]cb.ChannelCb
+	channelStateCallbacks   map[cb.ID]cb.ChannelCb
+	channelSettledCallbacks map[cb.ID]cb.ChannelCb
+	nextCallbackID          cb.ID
 	mlock                   sync.Mutex
 	Name                    string
 }
 
 func newStormDB() (db *StormDB) {
 	return &StormDB{
-		newTokenCallbacks:       make(map[*cb.NewTokenCb]bool),
-		newChannelCallbacks:     make(map[*cb.ChannelCb]bool),
-		channelDepositCallbacks: make(map[*cb.ChannelCb]bool),
-		channelStateCallbacks:   make(map[*cb.ChannelCb]bool),
-		channelSettledCallbacks: make(map[*cb.ChannelCb]bool),
+		newTokenCallbacks:       make(map[cb.ID]cb.NewTokenCb),
+		newChannelCallbacks:     make(map[cb.ID]cb.ChannelCb),
+		channelDepositCallbacks: make(map[cb.ID]cb.ChannelCb),
+		channelStateCallbacks:   make(map[cb.ID]cb.ChannelCb),
+		channelSettledCallbacks: make(map[cb.ID]cb.ChannelCb),
+		syncConfig:              models.DefaultSyncConfig(),
 	}
 
 }
@@ -50,13 +49,19 @@ func OpenDb(dbPath string) (model *StormDB, err error) {
 	model = newStormDB()
 	needCreateDb := !common.FileExist(dbPath)
 	var ver int
-	model.db, err = storm.Open(dbPath, storm.BoltOptions(os.ModePerm, &bolt.Options{Timeout: 1 * time.Second}), storm.Codec(gobcodec.Codec))
+	model.db, err = openStorm(dbPath, model.syncConfig.Critical)
 	if err != nil {
 		err = fmt.Errorf("cannot create or open db:%s,makesure you have write permission err:%v", dbPath, err)
 		log.Crit(err.Error())
 		return
 	}
 	model.Name = dbPath
+	err = model.openHistoryDb(dbPath)
+	if err != nil {
+		log.Crit(err.Error())
+		return
+	}
+	model.startSyncLoop()
 	if needCreateDb {
 		err = model.db.Set(models.BucketMeta, models.KeyVersion, models.DbVersion)
 		if err != nil {
@@ -76,8 +81,10 @@ func OpenDb(dbPath string) (model *StormDB, err error) {
 			log.Crit(fmt.Sprintf("wrong db file format "))
 			return
 		}
-		if ver != models.DbVersion {
-			log.Crit("db version not match")
+		err = model.upgrade(ver)
+		if err != nil {
+			log.Crit(err.Error())
+			return
 		}
 		var closeFlag bool
 		err = model.db.Get(models.BucketMeta, models.KeyCloseFlag, &closeFlag)
@@ -119,6 +126,7 @@ func (model *StormDB) IsDbCrashedLastTime() bool {
 func (model *StormDB) CloseDB() {
 	model.lock.Lock()
 	err := model.db.Set(models.BucketMeta, models.KeyCloseFlag, true)
+	model.closeHistoryDb()
 	err = model.db.Close()
 	if err != nil {
 		log.Error(fmt.Sprintf("db err %s", err))
@@ -149,7 +157,7 @@ func init() {
 }
 
 func (model *StormDB) initDb() {
-	err := model.db.Init(&models.ReceivedTransfer{})
+	err := model.historyDb.Init(&models.ReceivedTransfer{})
 	err = model.db.Set(models.BucketBlockNumber, models.KeyBlockNumber, 0)
 	if err != nil {
 		log.Error(fmt.Sprintf("db err %s", err))
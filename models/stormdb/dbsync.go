@@ -0,0 +1,184 @@
+package stormdb
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/asdine/storm"
+	gobcodec "github.com/asdine/storm/codec/gob"
+	"github.com/coreos/bbolt"
+)
+
+/*
+bolt的NoSync是整个数据库的设置,无法针对某一次写入,所以可重建的数据单独保存在history数据库中,
+两个数据库分别按照各自的策略fsync
+*/
+func historyDbPath(dbPath string) string {
+	return dbPath + ".history"
+}
+
+func openStorm(dbPath string, policy models.SyncPolicy) (*storm.DB, error) {
+	return storm.Open(dbPath, storm.BoltOptions(os.ModePerm, &bolt.Options{
+		Timeout: 1 * time.Second,
+		NoSync:  policy != models.SyncAlways,
+	}), storm.Codec(gobcodec.Codec))
+}
+
+//openHistoryDb 打开保存可重建数据的数据库
+func (model *StormDB) openHistoryDb(dbPath string) (err error) {
+	path := historyDbPath(dbPath)
+	model.historyDb, err = openStorm(path, model.syncConfig.Reconstructible)
+	if err != nil {
+		return fmt.Errorf("cannot create or open db:%s,makesure you have write permission err:%v", path, err)
+	}
+	return
+}
+
+/*
+migrateHistory 版本1的数据库中可重建数据保存在主数据库中,把它们迁移到history数据库.
+复制的数据和KeyHistoryMigrated在同一个事务中写入history数据库,fsync以后才删除主数据库中的数据.
+中途崩溃时下次启动根据KeyHistoryMigrated决定是否还需要复制,不依赖history数据库文件是否存在
+*/
+func (model *StormDB) migrateHistory() (err error) {
+	var rts []*models.ReceivedTransfer
+	var stds []*models.SentTransferDetail
+	var fcrs []*models.FeeChargerRecordSerialization
+	var nsrs []*models.NetworkStatsReport
+	all := []struct {
+		data interface{}
+		typ  interface{}
+	}{
+		{&rts, &models.ReceivedTransfer{}},
+		{&stds, &models.SentTransferDetail{}},
+		{&fcrs, &models.FeeChargerRecordSerialization{}},
+		{&nsrs, &models.NetworkStatsReport{}},
+	}
+	var migrated bool
+	err = model.historyDb.Get(models.BucketMeta, models.KeyHistoryMigrated, &migrated)
+	if err != nil && err != storm.ErrNotFound {
+		return
+	}
+	if migrated {
+		log.Info("history already copied to history db, only remove it from main db")
+	} else {
+		tx, err := model.historyDb.Begin(true)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		for _, a := range all {
+			err = model.db.All(a.data)
+			if err != nil && err != storm.ErrNotFound {
+				return err
+			}
+			err = tx.Init(a.typ)
+			if err != nil {
+				return err
+			}
+		}
+		for _, r := range rts {
+			if err = tx.Save(r); err != nil {
+				return err
+			}
+		}
+		for _, r := range stds {
+			if err = tx.Save(r); err != nil {
+				return err
+			}
+		}
+		for _, r := range fcrs {
+			if err = tx.Save(r); err != nil {
+				return err
+			}
+		}
+		for _, r := range nsrs {
+			if err = tx.Save(r); err != nil {
+				return err
+			}
+		}
+		err = tx.Set(models.BucketMeta, models.KeyHistoryMigrated, true)
+		if err != nil {
+			return err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+		//history数据库可能是NoSync,删除主数据库中的数据之前必须落盘
+		err = model.historyDb.Bolt.Sync()
+		if err != nil {
+			return err
+		}
+		log.Info(fmt.Sprintf("migrate %d received transfers,%d sent transfers,%d fee charge records,%d network stats to history db",
+			len(rts), len(stds), len(fcrs), len(nsrs)))
+	}
+	for _, a := range all {
+		err = model.db.Drop(a.typ)
+		if err != nil && err != bolt.ErrBucketNotFound {
+			log.Error(fmt.Sprintf("drop %T from main db err %s", a.typ, err))
+		}
+	}
+	return nil
+}
+
+/*
+syncLoop 定期把策略为SyncPeriodic的数据库fsync到磁盘
+*/
+func (model *StormDB) syncLoop() {
+	ticker := time.NewTicker(model.syncConfig.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			model.syncPeriodic()
+		case <-model.syncQuit:
+			return
+		}
+	}
+}
+
+func (model *StormDB) syncPeriodic() {
+	if model.syncConfig.Critical == models.SyncPeriodic {
+		if err := model.db.Bolt.Sync(); err != nil {
+			log.Error(fmt.Sprintf("sync db err %s", err))
+		}
+	}
+	if model.syncConfig.Reconstructible == models.SyncPeriodic {
+		if err := model.historyDb.Bolt.Sync(); err != nil {
+			log.Error(fmt.Sprintf("sync history db err %s", err))
+		}
+	}
+}
+
+func (model *StormDB) startSyncLoop() {
+	if model.syncConfig.Critical != models.SyncPeriodic && model.syncConfig.Reconstructible != models.SyncPeriodic {
+		return
+	}
+	model.syncQuit = make(chan struct{})
+	go model.syncLoop()
+}
+
+//closeHistoryDb 停止定期fsync,关闭之前不管是什么策略都fsync一次
+func (model *StormDB) closeHistoryDb() {
+	if model.syncQuit != nil {
+		close(model.syncQuit)
+		model.syncQuit = nil
+	}
+	if model.syncConfig.Critical != models.SyncAlways {
+		if err := model.db.Bolt.Sync(); err != nil {
+			log.Error(fmt.Sprintf("sync db err %s", err))
+		}
+	}
+	if model.historyDb == nil {
+		return
+	}
+	if err := model.historyDb.Bolt.Sync(); err != nil {
+		log.Error(fmt.Sprintf("sync history db err %s", err))
+	}
+	if err := model.historyDb.Close(); err != nil {
+		log.Error(fmt.Sprintf("close history db err %s", err))
+	}
+}
@@ -23,7 +23,7 @@ func (model *StormDB) SaveFeeChargeRecord(r *models.FeeChargeRecord) (err error)
 	if rs.Timestamp <= 0 {
 		rs.Timestamp = time.Now().Unix()
 	}
-	err = model.db.Save(rs)
+	err = model.historyDb.Save(rs)
 	if err != nil {
 		err = fmt.Errorf("SaveFeeChargeRecord err %s", err)
 		err = models.GeneratDBError(err)
@@ -47,9 +47,9 @@ func (model *StormDB) GetAllFeeChargeRecord(tokenAddress common.Address, fromTim
 	}
 	var rs []*models.FeeChargerRecordSerialization
 	if len(selectList) == 0 {
-		err = model.db.All(&rs)
+		err = model.historyDb.All(&rs)
 	} else {
-		q := model.db.Select(selectList...)
+		q := model.historyDb.Select(selectList...)
 		err = q.Find(&rs)
 	}
 	if err == storm.ErrNotFound {
@@ -64,7 +64,7 @@ func (model *StormDB) GetAllFeeChargeRecord(tokenAddress common.Address, fromTim
 // GetFeeChargeRecordByLockSecretHash :
 func (model *StormDB) GetFeeChargeRecordByLockSecretHash(lockSecretHash common.Hash) (records []*models.FeeChargeRecord, err error) {
 	var rs []*models.FeeChargerRecordSerialization
-	err = model.db.Find("LockSecretHash", lockSecretHash[:], &rs)
+	err = model.historyDb.Find("LockSecretHash", lockSecretHash[:], &rs)
 	if err != nil {
 		err = fmt.Errorf("GetAllFeeChargeRecordByLockSecretHash err %s", err)
 		err = models.GeneratDBError(err)
@@ -0,0 +1,94 @@
+package stormdb
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/coreos/bbolt"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//dbMigration 把数据库从version升级到version+1
+type dbMigration struct {
+	version int
+	desc    string
+	migrate func(model *StormDB) error
+}
+
+/*
+dbMigrations 按版本从低到高排列,每次数据库格式变化时增加models.DbVersion,并在这里增加一项升级方法,
+这样跨越多个版本升级的用户也可以依次升级,不会丢失通道,也不需要从公链重新同步
+*/
+var dbMigrations = []dbMigration{
+	{1, "move transfer history,fee charge records and network stats to history db", (*StormDB).migrateHistory},
+}
+
+func backupPath(dbPath string, ver int) string {
+	return fmt.Sprintf("%s.v%d.bak", dbPath, ver)
+}
+
+/*
+backup 升级之前把主数据库和history数据库备份到同一目录下.
+已经存在的备份是上次升级失败之前做的,保留最早的备份,不会被覆盖
+*/
+func (model *StormDB) backup(ver int) (err error) {
+	path := backupPath(model.Name, ver)
+	if common.FileExist(path) {
+		log.Warn(fmt.Sprintf("db backup %s already exists, keep it", path))
+		return nil
+	}
+	err = model.db.Bolt.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(path, 0600)
+	})
+	if err != nil {
+		return
+	}
+	err = model.historyDb.Bolt.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(backupPath(historyDbPath(model.Name), ver), 0600)
+	})
+	if err != nil {
+		return
+	}
+	log.Info(fmt.Sprintf("db version %d backup to %s", ver, path))
+	return
+}
+
+/*
+upgrade 把版本为ver的数据库依次升级到models.DbVersion,每一步成功以后立即保存版本号,
+中途失败时下次启动从失败的那一步继续
+*/
+func (model *StormDB) upgrade(ver int) (err error) {
+	if ver > models.DbVersion {
+		return fmt.Errorf("db version %d is newer than %d supported by this photon, downgrade is not supported", ver, models.DbVersion)
+	}
+	if ver == models.DbVersion {
+		return nil
+	}
+	if ver < dbMigrations[0].version {
+		return fmt.Errorf("db version %d is too old to upgrade", ver)
+	}
+	err = model.backup(ver)
+	if err != nil {
+		return fmt.Errorf("backup db before upgrade err %s", err)
+	}
+	for _, m := range dbMigrations {
+		if m.version < ver {
+			continue
+		}
+		log.Info(fmt.Sprintf("upgrade db from version %d to %d: %s", m.version, m.version+1, m.desc))
+		err = m.migrate(model)
+		if err != nil {
+			return fmt.Errorf("upgrade db from version %d err %s, backup is at %s", m.version, err, backupPath(model.Name, ver))
+		}
+		ver = m.version + 1
+		err = model.db.Set(models.BucketMeta, models.KeyVersion, ver)
+		if err != nil {
+			return
+		}
+	}
+	if ver != models.DbVersion {
+		return fmt.Errorf("no upgrade from db version %d to %d", ver, models.DbVersion)
+	}
+	return nil
+}
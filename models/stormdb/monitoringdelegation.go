@@ -0,0 +1,34 @@
+package stormdb
+
+import (
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/asdine/storm"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SaveMonitoringDelegation :
+func (model *StormDB) SaveMonitoringDelegation(d *models.MonitoringDelegation) (err error) {
+	err = model.db.Save(d)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetAllMonitoringDelegations :
+func (model *StormDB) GetAllMonitoringDelegations() (ds []*models.MonitoringDelegation, err error) {
+	err = model.db.All(&ds)
+	if err == storm.ErrNotFound {
+		err = nil
+	}
+	err = models.GeneratDBError(err)
+	return
+}
+
+// RemoveMonitoringDelegation :
+func (model *StormDB) RemoveMonitoringDelegation(channelIdentifier common.Hash) (err error) {
+	err = model.db.DeleteStruct(&models.MonitoringDelegation{ChannelIdentifier: channelIdentifier})
+	if err == storm.ErrNotFound {
+		err = nil
+	}
+	err = models.GeneratDBError(err)
+	return
+}
@@ -0,0 +1,28 @@
+package stormdb
+
+import (
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SaveNetworkStatsReport :
+func (model *StormDB) SaveNetworkStatsReport(r *models.NetworkStatsReport) (err error) {
+	r.Key = r.ReporterID[:]
+	err = model.historyDb.Save(r)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetAllNetworkStatsReports :
+func (model *StormDB) GetAllNetworkStatsReports() (rs []*models.NetworkStatsReport, err error) {
+	err = model.historyDb.All(&rs)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// RemoveNetworkStatsReport :
+func (model *StormDB) RemoveNetworkStatsReport(reporterID common.Hash) (err error) {
+	err = model.historyDb.DeleteStruct(&models.NetworkStatsReport{Key: reporterID[:]})
+	err = models.GeneratDBError(err)
+	return
+}
@@ -0,0 +1,27 @@
+package stormdb
+
+import (
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/asdine/storm"
+)
+
+// SaveNodeAdvertisement :
+func (model *StormDB) SaveNodeAdvertisement(na *models.NodeAdvertisement) (err error) {
+	na.Key = models.KeyNodeAdvertisement
+	err = model.db.Save(na)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetNodeAdvertisement :
+func (model *StormDB) GetNodeAdvertisement() (na *models.NodeAdvertisement, err error) {
+	na = &models.NodeAdvertisement{}
+	err = model.db.One("Key", models.KeyNodeAdvertisement, na)
+	if err == storm.ErrNotFound {
+		err = rerr.ErrNotFound
+		return
+	}
+	err = models.GeneratDBError(err)
+	return
+}
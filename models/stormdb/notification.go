@@ -0,0 +1,52 @@
+package stormdb
+
+import (
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+)
+
+// SaveNotification :
+func (model *StormDB) SaveNotification(n *models.Notification) (err error) {
+	err = model.historyDb.Save(n)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetNotifications :
+func (model *StormDB) GetNotifications(sinceID uint64, limit int) (ns []*models.Notification, err error) {
+	query := model.historyDb.Select(q.Gt("ID", sinceID))
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err = query.Find(&ns)
+	if err == storm.ErrNotFound {
+		err = nil
+	}
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetLastNotificationID :
+func (model *StormDB) GetLastNotificationID() (id uint64, err error) {
+	var n models.Notification
+	err = model.historyDb.Select().Reverse().First(&n)
+	if err == storm.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		err = models.GeneratDBError(err)
+		return
+	}
+	return n.ID, nil
+}
+
+// RemoveNotificationsBefore :
+func (model *StormDB) RemoveNotificationsBefore(id uint64) (err error) {
+	err = model.historyDb.Select(q.Lt("ID", id)).Delete(&models.Notification{})
+	if err == storm.ErrNotFound {
+		err = nil
+	}
+	err = models.GeneratDBError(err)
+	return
+}
@@ -0,0 +1,42 @@
+package stormdb
+
+import (
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/asdine/storm"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SaveOfflineTxBundle :
+func (model *StormDB) SaveOfflineTxBundle(b *models.OfflineTxBundle) (err error) {
+	b.Key = b.ChannelIdentifier[:]
+	err = model.db.Save(b)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetOfflineTxBundle :
+func (model *StormDB) GetOfflineTxBundle(channelIdentifier common.Hash) (b *models.OfflineTxBundle, err error) {
+	b = &models.OfflineTxBundle{}
+	err = model.db.One("Key", channelIdentifier[:], b)
+	if err == storm.ErrNotFound {
+		err = rerr.ErrNotFound
+		return
+	}
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetAllOfflineTxBundles :
+func (model *StormDB) GetAllOfflineTxBundles() (bs []*models.OfflineTxBundle, err error) {
+	err = model.db.All(&bs)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// RemoveOfflineTxBundle :
+func (model *StormDB) RemoveOfflineTxBundle(channelIdentifier common.Hash) (err error) {
+	err = model.db.DeleteStruct(&models.OfflineTxBundle{Key: channelIdentifier[:]})
+	err = models.GeneratDBError(err)
+	return
+}
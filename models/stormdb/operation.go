@@ -0,0 +1,40 @@
+package stormdb
+
+import (
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/asdine/storm"
+)
+
+// SaveOperation :
+func (model *StormDB) SaveOperation(op *models.Operation) (err error) {
+	err = model.db.Save(op)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetOperation :
+func (model *StormDB) GetOperation(id string) (op *models.Operation, err error) {
+	op = &models.Operation{}
+	err = model.db.One("Key", id, op)
+	if err == storm.ErrNotFound {
+		err = rerr.ErrNotFound
+		return
+	}
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetAllOperations :
+func (model *StormDB) GetAllOperations() (ops []*models.Operation, err error) {
+	err = model.db.All(&ops)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// RemoveOperation :
+func (model *StormDB) RemoveOperation(id string) (err error) {
+	err = model.db.DeleteStruct(&models.Operation{Key: id})
+	err = models.GeneratDBError(err)
+	return
+}
@@ -0,0 +1,31 @@
+package stormdb
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/asdine/storm"
+)
+
+// SavePartnerFilter :
+func (model *StormDB) SavePartnerFilter(pf *models.PartnerFilter) (err error) {
+	pf.Key = models.KeyPartnerFilter
+	err = model.db.Save(pf)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetPartnerFilter :
+func (model *StormDB) GetPartnerFilter() (pf *models.PartnerFilter) {
+	pf = &models.PartnerFilter{}
+	err := model.db.One("Key", models.KeyPartnerFilter, pf)
+	if err == storm.ErrNotFound {
+		return models.NewDefaultPartnerFilter()
+	}
+	if err != nil {
+		log.Error(fmt.Sprintf("GetPartnerFilter err %s, use default partner filter", err))
+		return models.NewDefaultPartnerFilter()
+	}
+	return
+}
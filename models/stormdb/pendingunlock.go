@@ -0,0 +1,34 @@
+package stormdb
+
+import (
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/asdine/storm"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SavePendingUnlock :
+func (model *StormDB) SavePendingUnlock(p *models.PendingUnlock) (err error) {
+	err = model.db.Save(p)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetAllPendingUnlocks :
+func (model *StormDB) GetAllPendingUnlocks() (ps []*models.PendingUnlock, err error) {
+	err = model.db.All(&ps)
+	if err == storm.ErrNotFound {
+		err = nil
+	}
+	err = models.GeneratDBError(err)
+	return
+}
+
+// RemovePendingUnlock :
+func (model *StormDB) RemovePendingUnlock(key common.Hash) (err error) {
+	err = model.db.DeleteStruct(&models.PendingUnlock{Key: key})
+	if err == storm.ErrNotFound {
+		err = nil
+	}
+	err = models.GeneratDBError(err)
+	return
+}
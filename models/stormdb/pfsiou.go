@@ -0,0 +1,27 @@
+package stormdb
+
+import (
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/asdine/storm"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SavePfsIOU :
+func (model *StormDB) SavePfsIOU(iou *models.PfsIOU) (err error) {
+	err = model.db.Save(iou)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetPfsIOU :
+func (model *StormDB) GetPfsIOU(receiver common.Address) (iou *models.PfsIOU, err error) {
+	iou = &models.PfsIOU{}
+	err = model.db.One("Receiver", receiver, iou)
+	if err == storm.ErrNotFound {
+		err = rerr.ErrNotFound
+		return
+	}
+	err = models.GeneratDBError(err)
+	return
+}
@@ -16,12 +16,13 @@ import (
 )
 
 // NewSentTransferDetail :
-func (model *StormDB) NewSentTransferDetail(tokenAddress, target common.Address, amount *big.Int, data string, isDirect bool, lockSecretHash common.Hash) {
+func (model *StormDB) NewSentTransferDetail(tokenAddress, target common.Address, amount *big.Int, data string, isDirect bool, lockSecretHash common.Hash, paymentID string, invoice []byte) {
 	std := &models.SentTransferDetail{
 		Key:               utils.Sha3(tokenAddress[:], lockSecretHash[:]).String(),
 		BlockNumber:       model.GetLatestBlockNumber(),
 		TokenAddress:      tokenAddress,
 		TokenAddressBytes: tokenAddress[:],
+		LockSecretHash:    lockSecretHash,
 		TargetAddress:     target,
 		Amount:            amount,
 		Data:              data,
@@ -30,10 +31,12 @@ func (model *StormDB) NewSentTransferDetail(tokenAddress, target common.Address,
 		FinishTime:        0,
 		Status:            models.TransferStatusInit,
 		StatusMessage:     "",
+		PaymentID:         paymentID,
+		Invoice:           invoice,
 		ChannelIdentifier: utils.EmptyHash,
 		OpenBlockNumber:   0,
 	}
-	err := model.db.Save(std)
+	err := model.historyDb.Save(std)
 	if err != nil {
 		log.Error(fmt.Sprintf("NewSendTransferDetail key=%s, err %s", std.Key, err))
 		return
@@ -45,7 +48,7 @@ func (model *StormDB) NewSentTransferDetail(tokenAddress, target common.Address,
 func (model *StormDB) UpdateSentTransferDetailStatus(tokenAddress common.Address, lockSecretHash common.Hash, status models.TransferStatusCode, statusMessage string, otherParams interface{}) (transfer *models.SentTransferDetail) {
 	transfer = &models.SentTransferDetail{}
 	key := utils.Sha3(tokenAddress[:], lockSecretHash[:]).String()
-	err := model.db.One("Key", key, transfer)
+	err := model.historyDb.One("Key", key, transfer)
 	if err == storm.ErrNotFound {
 		return
 	}
@@ -68,7 +71,7 @@ func (model *StormDB) UpdateSentTransferDetailStatus(tokenAddress common.Address
 	if status == models.TransferStatusCanceled || status == models.TransferStatusFailed {
 		transfer.FinishTime = time.Now().Unix()
 	}
-	err = model.db.Save(transfer)
+	err = model.historyDb.Save(transfer)
 	if err != nil {
 		log.Error(fmt.Sprintf("UpdateStatus err %s", err))
 		return
@@ -81,7 +84,7 @@ func (model *StormDB) UpdateSentTransferDetailStatus(tokenAddress common.Address
 func (model *StormDB) UpdateSentTransferDetailStatusMessage(tokenAddress common.Address, lockSecretHash common.Hash, statusMessage string) (transfer *models.SentTransferDetail) {
 	transfer = &models.SentTransferDetail{}
 	key := utils.Sha3(tokenAddress[:], lockSecretHash[:]).String()
-	err := model.db.One("Key", key, transfer)
+	err := model.historyDb.One("Key", key, transfer)
 	if err == storm.ErrNotFound {
 		return
 	}
@@ -90,7 +93,7 @@ func (model *StormDB) UpdateSentTransferDetailStatusMessage(tokenAddress common.
 		return
 	}
 	transfer.StatusMessage = fmt.Sprintf("%s%s\n", transfer.StatusMessage, statusMessage)
-	err = model.db.Save(transfer)
+	err = model.historyDb.Save(transfer)
 	if err != nil {
 		log.Error(fmt.Sprintf("UpdateStatusMessage err %s", err))
 		return
@@ -103,7 +106,7 @@ func (model *StormDB) UpdateSentTransferDetailStatusMessage(tokenAddress common.
 func (model *StormDB) GetSentTransferDetail(tokenAddress common.Address, lockSecretHash common.Hash) (*models.SentTransferDetail, error) {
 	var ts models.SentTransferDetail
 	key := utils.Sha3(tokenAddress[:], lockSecretHash[:]).String()
-	err := model.db.One("Key", key, &ts)
+	err := model.historyDb.One("Key", key, &ts)
 	log.Trace(fmt.Sprintf("GetSentTransferDetail key=%s lockSecretHash=%s err=%s", key, lockSecretHash.String(), err))
 	err = models.GeneratDBError(err)
 	return &ts, err
@@ -129,9 +132,9 @@ func (model *StormDB) GetSentTransferDetailList(tokenAddress common.Address, fro
 		selectList = append(selectList, q.Lt("BlockNumber", toBlock))
 	}
 	if len(selectList) == 0 {
-		err = model.db.All(&transfers)
+		err = model.historyDb.All(&transfers)
 	} else {
-		q := model.db.Select(selectList...)
+		q := model.historyDb.Select(selectList...)
 		err = q.Find(&transfers)
 	}
 	if err == storm.ErrNotFound {
@@ -139,3 +142,12 @@ func (model *StormDB) GetSentTransferDetailList(tokenAddress common.Address, fro
 	}
 	return
 }
+
+// GetSentTransferDetailsByPaymentID :
+func (model *StormDB) GetSentTransferDetailsByPaymentID(paymentID string) (transfers []*models.SentTransferDetail, err error) {
+	err = model.historyDb.Find("PaymentID", paymentID, &transfers)
+	if err == storm.ErrNotFound {
+		err = nil
+	}
+	return
+}
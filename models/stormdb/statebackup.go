@@ -0,0 +1,35 @@
+package stormdb
+
+import (
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/asdine/storm"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SavePeerStateBackup :
+func (model *StormDB) SavePeerStateBackup(b *models.PeerStateBackup) (err error) {
+	b.Key = b.Owner[:]
+	err = model.db.Save(b)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetPeerStateBackup :
+func (model *StormDB) GetPeerStateBackup(owner common.Address) (b *models.PeerStateBackup, err error) {
+	b = &models.PeerStateBackup{}
+	err = model.db.One("Key", owner[:], b)
+	if err == storm.ErrNotFound {
+		err = rerr.ErrNotFound
+		return
+	}
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetAllPeerStateBackup :
+func (model *StormDB) GetAllPeerStateBackup() (bs []*models.PeerStateBackup, err error) {
+	err = model.db.All(&bs)
+	err = models.GeneratDBError(err)
+	return
+}
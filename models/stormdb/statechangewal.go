@@ -0,0 +1,47 @@
+package stormdb
+
+import (
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/asdine/storm"
+)
+
+// AppendStateChangeWAL :
+func (model *StormDB) AppendStateChangeWAL(data []byte) (id uint64, err error) {
+	e := &models.StateChangeWALEntry{
+		StateChange: data,
+		Time:        time.Now().Unix(),
+	}
+	err = model.db.Save(e)
+	if err != nil {
+		err = models.GeneratDBError(err)
+		return
+	}
+	//NoSync的时候Save不会fsync
+	if model.syncConfig.Critical != models.SyncAlways {
+		err = model.db.Bolt.Sync()
+		if err != nil {
+			err = models.GeneratDBError(err)
+			return
+		}
+	}
+	return e.ID, nil
+}
+
+// RemoveStateChangeWAL :
+func (model *StormDB) RemoveStateChangeWAL(id uint64) (err error) {
+	err = model.db.DeleteStruct(&models.StateChangeWALEntry{ID: id})
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetAllStateChangeWAL :
+func (model *StormDB) GetAllStateChangeWAL() (es []*models.StateChangeWALEntry, err error) {
+	err = model.db.All(&es)
+	if err == storm.ErrNotFound {
+		err = nil
+	}
+	err = models.GeneratDBError(err)
+	return
+}
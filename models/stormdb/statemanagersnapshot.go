@@ -0,0 +1,66 @@
+package stormdb
+
+import (
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SaveStateManagerSnapshot :
+func (model *StormDB) SaveStateManagerSnapshot(s *models.StateManagerSnapshot) (err error) {
+	err = model.db.Save(s)
+	if err != nil {
+		err = models.GeneratDBError(err)
+		return
+	}
+	err = model.db.Select(q.Eq("Key", s.Key), q.Lte("Seq", s.Seq)).Delete(&models.StateChangeLog{})
+	if err == storm.ErrNotFound {
+		err = nil
+	}
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetAllStateManagerSnapshots :
+func (model *StormDB) GetAllStateManagerSnapshots() (ss []*models.StateManagerSnapshot, err error) {
+	err = model.db.All(&ss)
+	if err == storm.ErrNotFound {
+		err = nil
+	}
+	err = models.GeneratDBError(err)
+	return
+}
+
+// RemoveStateManagerSnapshot :
+func (model *StormDB) RemoveStateManagerSnapshot(key common.Hash) (err error) {
+	err = model.db.DeleteStruct(&models.StateManagerSnapshot{Key: key})
+	if err != nil && err != storm.ErrNotFound {
+		err = models.GeneratDBError(err)
+		return
+	}
+	err = model.db.Select(q.Eq("Key", key)).Delete(&models.StateChangeLog{})
+	if err == storm.ErrNotFound {
+		err = nil
+	}
+	err = models.GeneratDBError(err)
+	return
+}
+
+// NewStateChangeLog :
+func (model *StormDB) NewStateChangeLog(l *models.StateChangeLog) (err error) {
+	err = model.db.Save(l)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetStateChangeLogs :
+func (model *StormDB) GetStateChangeLogs(key common.Hash) (logs []*models.StateChangeLog, err error) {
+	err = model.db.Find("Key", key, &logs)
+	if err == storm.ErrNotFound {
+		err = nil
+	}
+	models.SortStateChangeLogs(logs)
+	err = models.GeneratDBError(err)
+	return
+}
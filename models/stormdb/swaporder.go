@@ -0,0 +1,37 @@
+package stormdb
+
+import (
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/asdine/storm"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SaveSwapOrder :
+func (model *StormDB) SaveSwapOrder(o *models.SwapOrder) (err error) {
+	err = model.db.Save(o)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetSwapOrder :
+func (model *StormDB) GetSwapOrder(lockSecretHash common.Hash) (o *models.SwapOrder, err error) {
+	o = &models.SwapOrder{}
+	err = model.db.One("LockSecretHash", lockSecretHash, o)
+	if err == storm.ErrNotFound {
+		err = rerr.ErrNotFound
+		return
+	}
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetAllSwapOrders :
+func (model *StormDB) GetAllSwapOrders() (orders []*models.SwapOrder, err error) {
+	err = model.db.All(&orders)
+	if err == storm.ErrNotFound {
+		err = nil
+	}
+	err = models.GeneratDBError(err)
+	return
+}
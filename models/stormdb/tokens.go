@@ -43,17 +43,25 @@ func (model *StormDB) AddToken(token common.Address, tokenNetworkAddress common.
 	model.handleTokenCallback(model.newTokenCallbacks, token)
 	return models.GeneratDBError(err)
 }
-func (model *StormDB) handleTokenCallback(m map[*cb.NewTokenCb]bool, token common.Address) {
-	var cbs []*cb.NewTokenCb
+/*
+handleTokenCallback 在锁外调用回调,回调可以注册或者撤销其他回调而不会死锁
+*/
+func (model *StormDB) handleTokenCallback(m map[cb.ID]cb.NewTokenCb, token common.Address) {
 	model.mlock.Lock()
-	for f := range m {
-		remove := (*f)(token)
-		if remove {
-			cbs = append(cbs, f)
+	cbs := make(map[cb.ID]cb.NewTokenCb, len(m))
+	for id, f := range m {
+		cbs[id] = f
+	}
+	model.mlock.Unlock()
+	var removed []cb.ID
+	for id, f := range cbs {
+		if f(token) {
+			removed = append(removed, id)
 		}
 	}
-	for _, f := range cbs {
-		delete(m, f)
+	model.mlock.Lock()
+	for _, id := range removed {
+		delete(m, id)
 	}
 	model.mlock.Unlock()
 }
@@ -15,7 +15,7 @@ import (
 )
 
 //NewReceivedTransfer save a new received transfer to db
-func (model *StormDB) NewReceivedTransfer(blockNumber int64, channelIdentifier common.Hash, openBlockNumber int64, tokenAddr, fromAddr common.Address, nonce uint64, amount *big.Int, lockSecretHash common.Hash, data string) *models.ReceivedTransfer {
+func (model *StormDB) NewReceivedTransfer(blockNumber int64, channelIdentifier common.Hash, openBlockNumber int64, tokenAddr, fromAddr common.Address, nonce uint64, amount *big.Int, lockSecretHash common.Hash, data string, paymentID string, invoice []byte) *models.ReceivedTransfer {
 	if lockSecretHash == utils.EmptyHash {
 		// direct transfer, use fakeLockSecretHash
 		lockSecretHash = utils.NewRandomHash()
@@ -33,13 +33,15 @@ func (model *StormDB) NewReceivedTransfer(blockNumber int64, channelIdentifier c
 		Data:              data,
 		OpenBlockNumber:   openBlockNumber,
 		TimeStamp:         time.Now().Unix(),
+		PaymentID:         paymentID,
+		Invoice:           invoice,
 	}
 	if ost, err := model.GetReceivedTransfer(key); err == nil {
 		log.Error(fmt.Sprintf("NewReceivedTransfer, but already exist, old=\n%s,new=\n%s",
 			utils.StringInterface(ost, 2), utils.StringInterface(st, 2)))
 		return nil
 	}
-	err := model.db.Save(st)
+	err := model.historyDb.Save(st)
 	if err != nil {
 		log.Error(fmt.Sprintf("save ReceivedTransfer err %s", err))
 	}
@@ -49,7 +51,7 @@ func (model *StormDB) NewReceivedTransfer(blockNumber int64, channelIdentifier c
 //GetReceivedTransfer return the received transfer by key
 func (model *StormDB) GetReceivedTransfer(key string) (*models.ReceivedTransfer, error) {
 	var r models.ReceivedTransfer
-	err := model.db.One("Key", key, &r)
+	err := model.historyDb.One("Key", key, &r)
 	err = models.GeneratDBError(err)
 	return &r, err
 }
@@ -73,9 +75,9 @@ func (model *StormDB) GetReceivedTransferList(tokenAddress common.Address, fromB
 		selectList = append(selectList, q.Lt("TimeStamp", toTime))
 	}
 	if len(selectList) == 0 {
-		err = model.db.All(&transfers)
+		err = model.historyDb.All(&transfers)
 	} else {
-		q := model.db.Select(selectList...)
+		q := model.historyDb.Select(selectList...)
 		err = q.Find(&transfers)
 	}
 	if err == storm.ErrNotFound {
@@ -83,3 +85,12 @@ func (model *StormDB) GetReceivedTransferList(tokenAddress common.Address, fromB
 	}
 	return
 }
+
+//GetReceivedTransfersByPaymentID returns all received transfers with `paymentID`
+func (model *StormDB) GetReceivedTransfersByPaymentID(paymentID string) (transfers []*models.ReceivedTransfer, err error) {
+	err = model.historyDb.Find("PaymentID", paymentID, &transfers)
+	if err == storm.ErrNotFound {
+		err = nil
+	}
+	return
+}
@@ -0,0 +1,25 @@
+package stormdb
+
+import (
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/asdine/storm"
+)
+
+// NewTransferIdempotency :
+func (model *StormDB) NewTransferIdempotency(t *models.TransferIdempotency) (err error) {
+	err = model.db.Save(t)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetTransferIdempotency :
+func (model *StormDB) GetTransferIdempotency(key string) (t *models.TransferIdempotency, err error) {
+	t = &models.TransferIdempotency{}
+	err = model.db.One("Key", key, t)
+	if err == storm.ErrNotFound {
+		err = rerr.ErrNotFound
+	}
+	err = models.GeneratDBError(err)
+	return
+}
@@ -0,0 +1,54 @@
+package stormdb
+
+import (
+	"math/big"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/asdine/storm"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// NewTransferLifecycle :
+func (model *StormDB) NewTransferLifecycle(l *models.TransferLifecycle) (err error) {
+	l.Key = l.LockSecretHash.String()
+	err = model.historyDb.Save(l)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// AddTransferTransition :
+func (model *StormDB) AddTransferTransition(lockSecretHash common.Hash, stage models.TransferStage, reason string) (l *models.TransferLifecycle, err error) {
+	l, err = model.GetTransferLifecycle(lockSecretHash)
+	if err != nil {
+		return
+	}
+	l.AddTransition(stage, reason)
+	err = model.historyDb.Save(l)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// SetTransferRoute :
+func (model *StormDB) SetTransferRoute(lockSecretHash common.Hash, fee *big.Int, path []common.Address) (err error) {
+	l, err := model.GetTransferLifecycle(lockSecretHash)
+	if err != nil {
+		return
+	}
+	l.Fee = fee
+	l.Path = path
+	err = model.historyDb.Save(l)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetTransferLifecycle :
+func (model *StormDB) GetTransferLifecycle(lockSecretHash common.Hash) (l *models.TransferLifecycle, err error) {
+	l = &models.TransferLifecycle{}
+	err = model.historyDb.One("Key", lockSecretHash.String(), l)
+	if err == storm.ErrNotFound {
+		err = rerr.ErrNotFound
+	}
+	err = models.GeneratDBError(err)
+	return
+}
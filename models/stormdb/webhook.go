@@ -0,0 +1,40 @@
+package stormdb
+
+import (
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/asdine/storm"
+)
+
+// SaveWebhookDeadLetter :
+func (model *StormDB) SaveWebhookDeadLetter(dl *models.WebhookDeadLetter) (err error) {
+	err = model.db.Save(dl)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetWebhookDeadLetter :
+func (model *StormDB) GetWebhookDeadLetter(id string) (dl *models.WebhookDeadLetter, err error) {
+	dl = &models.WebhookDeadLetter{}
+	err = model.db.One("Key", id, dl)
+	if err == storm.ErrNotFound {
+		err = rerr.ErrNotFound
+		return
+	}
+	err = models.GeneratDBError(err)
+	return
+}
+
+// GetAllWebhookDeadLetters :
+func (model *StormDB) GetAllWebhookDeadLetters() (dls []*models.WebhookDeadLetter, err error) {
+	err = model.db.All(&dls)
+	err = models.GeneratDBError(err)
+	return
+}
+
+// RemoveWebhookDeadLetter :
+func (model *StormDB) RemoveWebhookDeadLetter(id string) (err error) {
+	err = model.db.DeleteStruct(&models.WebhookDeadLetter{Key: id})
+	err = models.GeneratDBError(err)
+	return
+}
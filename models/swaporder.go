@@ -0,0 +1,42 @@
+package models
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//SwapOrder的状态
+const (
+	SwapStatusOffered   = "offered"   //maker发出,等待taker接受
+	SwapStatusAccepted  = "accepted"  //taker已经接受,双方正在交易
+	SwapStatusRejected  = "rejected"  //taker拒绝
+	SwapStatusCompleted = "completed" //自己这一方的交易已经完成
+	SwapStatusFailed    = "failed"
+)
+
+/*
+SwapOrder 两个节点之间的代币交换,maker用MakerAmount的MakerToken换取taker的TakerAmount的TakerToken.
+两笔交易使用同一个密码,maker收到taker的交易以后才会泄露密码,所以要么都成功要么都失败.
+maker和taker各自保存一份,Secret只有maker知道
+*/
+type SwapOrder struct {
+	LockSecretHash common.Hash    `storm:"id" json:"lock_secret_hash"`
+	Secret         common.Hash    `json:"-"`
+	Maker          common.Address `json:"maker_address"`
+	Taker          common.Address `json:"taker_address"`
+	MakerToken     common.Address `json:"maker_token"`
+	MakerAmount    *big.Int       `json:"maker_amount"`
+	TakerToken     common.Address `json:"taker_token"`
+	TakerAmount    *big.Int       `json:"taker_amount"`
+	IsMaker        bool           `json:"is_maker"`
+	Status         string         `json:"status"`
+	Error          string         `json:"error,omitempty"`
+	CreateTime     int64          `json:"create_time"`
+	UpdateTime     int64          `json:"update_time"`
+}
+
+//IsFinished returns true if this swap will not change any more
+func (o *SwapOrder) IsFinished() bool {
+	return o.Status == SwapStatusRejected || o.Status == SwapStatusCompleted || o.Status == SwapStatusFailed
+}
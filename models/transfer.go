@@ -20,6 +20,8 @@ type ReceivedTransfer struct {
 	Amount            *big.Int       `json:"amount"`
 	Data              string         `json:"data"`
 	TimeStamp         int64          `json:"time_stamp" storm:"index"`
+	PaymentID         string         `json:"payment_id,omitempty" storm:"index"` //发送方指定的支付ID
+	Invoice           []byte         `json:"invoice,omitempty"`
 }
 
 func init() {
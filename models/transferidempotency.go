@@ -0,0 +1,22 @@
+package models
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+TransferIdempotency 调用者给交易指定的幂等键和这笔交易的对应关系.
+超时以后用同一个键重试不会再发起一笔交易,而是返回原来那笔交易的状态.
+直接交易没有LockSecretHash,使用发起时生成的随机hash
+*/
+type TransferIdempotency struct {
+	Key            string         `storm:"id" json:"idempotency_key"`
+	LockSecretHash common.Hash    `json:"lock_secret_hash"`
+	TokenAddress   common.Address `json:"token_address"`
+	TargetAddress  common.Address `json:"target_address"`
+	Amount         *big.Int       `json:"amount"`
+	IsDirect       bool           `json:"is_direct"`
+	CreateTime     int64          `json:"create_time"`
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//TransferStage 交易发起方看到的交易进展
+type TransferStage string
+
+const (
+	//TransferStageInitiated 交易已经创建
+	TransferStageInitiated TransferStage = "initiated"
+	//TransferStageRouted 已经找到路由
+	TransferStageRouted TransferStage = "routed"
+	//TransferStageLockSent MediatedTransfer已经被下一跳确认收到,换路由重试时会出现多次
+	TransferStageLockSent TransferStage = "lock_sent"
+	//TransferStageSecretRevealed 已经把密码告诉了接收方
+	TransferStageSecretRevealed TransferStage = "secret_revealed"
+	//TransferStageUnlockReceived 下一跳确认收到了Unlock(直接交易是DirectTransfer),交易成功
+	TransferStageUnlockReceived TransferStage = "unlock_received"
+	//TransferStageFailed 交易失败,Reason是失败原因
+	TransferStageFailed TransferStage = "failed"
+	//TransferStageExpired 锁过期,交易失败
+	TransferStageExpired TransferStage = "expired"
+	//TransferStageCanceled 用户取消了交易
+	TransferStageCanceled TransferStage = "canceled"
+)
+
+//IsFinal 交易已经有了结果
+func (s TransferStage) IsFinal() bool {
+	switch s {
+	case TransferStageUnlockReceived, TransferStageFailed, TransferStageExpired, TransferStageCanceled:
+		return true
+	}
+	return false
+}
+
+//TransferTransition 交易进入某个阶段的记录
+type TransferTransition struct {
+	Stage  TransferStage `json:"stage"`
+	Time   int64         `json:"time"`
+	Reason string        `json:"reason,omitempty"`
+}
+
+/*
+TransferLifecycle 自己发起的交易经历的每一个阶段,按照LockSecretHash查询,
+直接交易没有LockSecretHash,使用发起时生成的随机hash
+*/
+type TransferLifecycle struct {
+	Key            string                `storm:"id" json:"-"`
+	LockSecretHash common.Hash           `json:"lock_secret_hash"`
+	TokenAddress   common.Address        `json:"token_address"`
+	TargetAddress  common.Address        `json:"target_address"`
+	Amount         *big.Int              `json:"amount"`
+	IsDirect       bool                  `json:"is_direct"`
+	Stage          TransferStage         `json:"stage"` //最后一个阶段
+	Transitions    []*TransferTransition `json:"transitions"`
+	Fee            *big.Int              `json:"fee,omitempty"`  //交易成功以后才有,付出的总手续费
+	Path           []common.Address      `json:"path,omitempty"` //交易成功以后才有,使用的路由,从第一跳到接收方
+}
+
+//AddTransition 记录进入新的阶段
+func (l *TransferLifecycle) AddTransition(stage TransferStage, reason string) {
+	l.Stage = stage
+	l.Transitions = append(l.Transitions, &TransferTransition{
+		Stage:  stage,
+		Time:   time.Now().Unix(),
+		Reason: reason,
+	})
+}
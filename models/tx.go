@@ -15,9 +15,10 @@ type TXInfoStatus string
 
 /* #nosec */
 const (
-	TXInfoStatusPending = "pending"
-	TXInfoStatusSuccess = "success"
-	TXInfoStatusFailed  = "failed"
+	TXInfoStatusPending  = "pending"
+	TXInfoStatusSuccess  = "success"
+	TXInfoStatusFailed   = "failed"
+	TXInfoStatusReplaced = "replaced" // 长时间未打包,已经被提高gasPrice的同nonce交易替换
 )
 
 // TXInfoType 类型
@@ -53,6 +54,7 @@ type TXInfo struct {
 	PackTime          int64          `json:"pack_time"`         // tx打包时间戳
 	GasPrice          uint64         `json:"gas_price"`
 	GasUsed           uint64         `json:"gas_used"` // 消耗的gas
+	Nonce             uint64         `json:"nonce"`    // 自己发起的tx的nonce,同一nonce的替换交易通过它串起来
 }
 
 // String :
@@ -81,6 +83,7 @@ func (ti *TXInfo) ToTXInfoSerialization() *TXInfoSerialization {
 		PackTime:          ti.PackTime,
 		GasPrice:          ti.GasPrice,
 		GasUsed:           ti.GasUsed,
+		Nonce:             ti.Nonce,
 	}
 }
 
@@ -100,6 +103,7 @@ type TXInfoSerialization struct {
 	PackTime          int64         `storm:"index"`
 	GasPrice          uint64
 	GasUsed           uint64
+	Nonce             uint64
 }
 
 // ToTXInfo :
@@ -119,6 +123,7 @@ func (tis *TXInfoSerialization) ToTXInfo() *TXInfo {
 		PackTime:          tis.PackTime,
 		GasPrice:          tis.GasPrice,
 		GasUsed:           tis.GasUsed,
+		Nonce:             tis.Nonce,
 	}
 }
 
@@ -0,0 +1,15 @@
+package models
+
+/*
+WebhookDeadLetter 重试多次仍然没有投递成功的webhook通知,保存下来以便运维排查以后重新投递
+*/
+type WebhookDeadLetter struct {
+	Key      string `storm:"id" json:"id"`
+	URL      string `json:"url"`
+	Seq      uint64 `json:"seq"`
+	Type     string `json:"type"`
+	Payload  string `json:"payload"`
+	Error    string `json:"error"`
+	Attempts int    `json:"attempts"`
+	Time     int64  `json:"time"`
+}
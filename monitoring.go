@@ -0,0 +1,139 @@
+package photon
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+手机等节点离线之前,可以把对方给我的最新BalanceProof委托给第三方监控服务,
+离线期间对方关闭通道时,由监控服务代替我updateBalanceProof和unlock.
+委托的内容和ChannelInformationFor3rdParty相同,另外附上承诺的报酬,整个请求用我的私钥签名,放在X-Photon-Signature头中.
+每个通道只记录最新一次委托,之后收到新的BalanceProof需要重新委托
+*/
+
+//monitoringRequest POST给监控服务的内容
+type monitoringRequest struct {
+	Delegator common.Address `json:"delegator"`
+	Reward    *big.Int       `json:"reward"`
+	Channel   *ChannelFor3rd `json:"channel"`
+}
+
+//MonitoringDelegationStatus 委托记录,以及委托以后是否又收到了对方新的BalanceProof
+type MonitoringDelegationStatus struct {
+	*models.MonitoringDelegation
+	Outdated bool `json:"outdated"`
+}
+
+//monitoringReward 报酬是固定部分加上(对方转给我的金额+委托的unlock中锁的金额)/Percent,locked是锁的总金额
+func monitoringReward(c3 *ChannelFor3rd, fee *params.MediationFee) (reward, locked *big.Int) {
+	locked = big.NewInt(0)
+	for _, u := range c3.Unlocks {
+		locked.Add(locked, u.Lock.Amount)
+	}
+	reward = big.NewInt(0)
+	if fee.Constant != nil {
+		reward.Set(fee.Constant)
+	}
+	if fee.Percent > 0 {
+		amount := new(big.Int).Set(locked)
+		if c3.UpdateTransfer.TransferAmount != nil {
+			amount.Add(amount, c3.UpdateTransfer.TransferAmount)
+		}
+		reward.Add(reward, amount.Div(amount, big.NewInt(fee.Percent)))
+	}
+	return
+}
+
+//delegateMonitoring 把c3委托给监控服务,成功以后保存委托记录
+func (rs *Service) delegateMonitoring(c3 *ChannelFor3rd) (d *models.MonitoringDelegation, err error) {
+	reward, locked := monitoringReward(c3, params.MonitoringReward)
+	err = rs.postMonitoringRequest(&monitoringRequest{
+		Delegator: rs.NodeAddress,
+		Reward:    reward,
+		Channel:   c3,
+	})
+	if err != nil {
+		return
+	}
+	d = &models.MonitoringDelegation{
+		ChannelIdentifier: c3.ChannelIdentifier,
+		OpenBlockNumber:   c3.OpenBlockNumber,
+		TokenAddress:      c3.TokenAddrss,
+		PartnerAddress:    c3.PartnerAddress,
+		Nonce:             c3.UpdateTransfer.Nonce,
+		TransferAmount:    c3.UpdateTransfer.TransferAmount,
+		LockedAmount:      locked,
+		Reward:            reward,
+		ServiceURL:        params.MonitoringServiceURL,
+		DelegateTime:      time.Now().Unix(),
+	}
+	err = rs.dao.SaveMonitoringDelegation(d)
+	return
+}
+
+func (rs *Service) postMonitoringRequest(mr *monitoringRequest) error {
+	body, err := json.Marshal(mr)
+	if err != nil {
+		return err
+	}
+	sig, err := utils.SignData(rs.PrivateKey, body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, params.MonitoringServiceURL, bytes.NewReader(body))
+	if err != nil {
+		return rerr.ErrMonitoringDelegation.AppendError(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Photon-Signature", hex.EncodeToString(sig))
+	client := &http.Client{Timeout: params.MonitoringServiceTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return rerr.ErrMonitoringDelegation.AppendError(err)
+	}
+	defer resp.Body.Close()
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode/100 != 2 {
+		return rerr.ErrMonitoringDelegation.Printf("monitoring service returns %s %s", resp.Status, msg)
+	}
+	log.Info(fmt.Sprintf("delegate channel %s nonce=%d to monitoring service, reward=%s",
+		utils.HPex(mr.Channel.ChannelIdentifier), mr.Channel.UpdateTransfer.Nonce, mr.Reward))
+	return nil
+}
+
+//ParseMonitoringReward 解析constant:percent格式的报酬
+func ParseMonitoringReward(s string) (fee *params.MediationFee, err error) {
+	fields := strings.Split(strings.TrimSpace(s), ":")
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("invalid monitoring reward %s, should be constant:percent", s)
+	}
+	constant, ok := new(big.Int).SetString(fields[0], 10)
+	if !ok || constant.Sign() < 0 {
+		return nil, fmt.Errorf("invalid monitoring reward %s: constant must be a non-negative integer", s)
+	}
+	percent, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || percent < 0 {
+		return nil, fmt.Errorf("invalid monitoring reward %s: percent must be a non-negative integer", s)
+	}
+	return &params.MediationFee{
+		Constant: constant,
+		Percent:  percent,
+	}, nil
+}
@@ -0,0 +1,102 @@
+package photon
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/transfer/mtree"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMonitoringReward(t *testing.T) {
+	c3 := &ChannelFor3rd{
+		Unlocks: []*unlock{
+			{Lock: &mtree.Lock{Amount: big.NewInt(30)}},
+			{Lock: &mtree.Lock{Amount: big.NewInt(70)}},
+		},
+	}
+	c3.UpdateTransfer.TransferAmount = big.NewInt(900)
+	reward, locked := monitoringReward(c3, &params.MediationFee{Constant: big.NewInt(5), Percent: 100})
+	assert.EqualValues(t, big.NewInt(100), locked)
+	assert.EqualValues(t, big.NewInt(15), reward)
+	reward, _ = monitoringReward(c3, &params.MediationFee{Constant: big.NewInt(5)})
+	assert.EqualValues(t, big.NewInt(5), reward)
+
+	fee, err := ParseMonitoringReward("5:100")
+	assert.Nil(t, err)
+	assert.EqualValues(t, &params.MediationFee{Constant: big.NewInt(5), Percent: 100}, fee)
+	_, err = ParseMonitoringReward("5")
+	assert.NotNil(t, err)
+	_, err = ParseMonitoringReward("-1:100")
+	assert.NotNil(t, err)
+}
+
+func TestDelegateMonitoring(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	key, addr := utils.MakePrivateKeyAddress()
+	var received *monitoringRequest
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		sig, err := hex.DecodeString(r.Header.Get("X-Photon-Signature"))
+		assert.Nil(t, err)
+		signer, err := utils.Ecrecover(utils.Sha3(body), sig)
+		assert.Nil(t, err)
+		assert.Equal(t, addr, signer)
+		received = &monitoringRequest{}
+		assert.Nil(t, json.Unmarshal(body, received))
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+	oldURL, oldReward := params.MonitoringServiceURL, params.MonitoringReward
+	defer func() {
+		params.MonitoringServiceURL, params.MonitoringReward = oldURL, oldReward
+	}()
+	params.MonitoringServiceURL = ts.URL
+	params.MonitoringReward = &params.MediationFee{Constant: big.NewInt(1), Percent: 10}
+
+	rs := &Service{dao: dao, PrivateKey: key, NodeAddress: addr}
+	c3 := &ChannelFor3rd{
+		ChannelIdentifier: utils.NewRandomHash(),
+		OpenBlockNumber:   3,
+		TokenAddrss:       utils.NewRandomAddress(),
+		PartnerAddress:    utils.NewRandomAddress(),
+	}
+	c3.UpdateTransfer.Nonce = 7
+	c3.UpdateTransfer.TransferAmount = big.NewInt(100)
+	d, err := rs.delegateMonitoring(c3)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, addr, received.Delegator)
+	assert.EqualValues(t, big.NewInt(11), received.Reward)
+	assert.Equal(t, c3.ChannelIdentifier, received.Channel.ChannelIdentifier)
+	assert.EqualValues(t, 7, d.Nonce)
+	ds, err := dao.GetAllMonitoringDelegations()
+	assert.Nil(t, err)
+	if assert.Len(t, ds, 1) {
+		assert.Equal(t, c3.ChannelIdentifier, ds[0].ChannelIdentifier)
+		assert.EqualValues(t, big.NewInt(11), ds[0].Reward)
+	}
+
+	//监控服务拒绝时不保存委托记录
+	status = http.StatusForbidden
+	c3.ChannelIdentifier = utils.NewRandomHash()
+	_, err = rs.delegateMonitoring(c3)
+	if assert.NotNil(t, err) {
+		assert.EqualValues(t, rerr.ErrMonitoringDelegation.ErrorCode, err.(rerr.StandardError).ErrorCode)
+	}
+	ds, err = dao.GetAllMonitoringDelegations()
+	assert.Nil(t, err)
+	assert.Len(t, ds, 1)
+}
@@ -115,6 +115,11 @@ func (t *MatrixMixTransport) NodeStatus(addr common.Address) (deviceType string,
 	return t.matirx.NodeStatus(addr)
 }
 
+//RegisterNodeAddressListener implements NodeAddressNotifier, only udp notifies address changes
+func (t *MatrixMixTransport) RegisterNodeAddressListener(l NodeAddressListener) {
+	t.udp.RegisterNodeAddressListener(l)
+}
+
 //GetNotify notification of connection status change
 func (t *MatrixMixTransport) GetNotify() (notify <-chan netshare.Status, err error) {
 	//if t.matirx != nil {
@@ -0,0 +1,206 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//CaptureDirection 消息的方向
+type CaptureDirection byte
+
+const (
+	//CaptureInbound 收到的消息
+	CaptureInbound CaptureDirection = 1
+	//CaptureOutbound 发出的消息
+	CaptureOutbound CaptureDirection = 2
+)
+
+func (d CaptureDirection) String() string {
+	switch d {
+	case CaptureInbound:
+		return "in"
+	case CaptureOutbound:
+		return "out"
+	}
+	return fmt.Sprintf("unknown(%d)", d)
+}
+
+/*
+capture文件以captureMagic开头,后面是一个个帧,每一帧的格式为:
+	8字节 时间,unix纳秒,大端
+	1字节 方向
+	20字节 对方地址,无法解析的收到的消息为全0
+	4字节 数据长度,大端
+	原始数据
+*/
+var captureMagic = []byte("PHCAP001")
+
+const captureFrameHeaderLen = 8 + 1 + 20 + 4
+
+var errNotCaptureFile = errors.New("not a photon capture file")
+
+//CapturedFrame capture文件中的一帧,Data是transport收发的原始数据
+type CapturedFrame struct {
+	Time      time.Time
+	Direction CaptureDirection
+	Peer      common.Address
+	Data      []byte
+}
+
+/*
+CaptureWriter 把和指定节点之间收发的原始消息追加到capture文件中,用于离线重现和其他实现之间的兼容问题.
+没有指定节点时记录所有消息,无法解析的消息不知道发送方,总是会记录
+*/
+type CaptureWriter struct {
+	lock  sync.Mutex
+	f     *os.File
+	peers map[common.Address]bool
+}
+
+//NewCaptureWriter 打开或者创建capture文件,已有的内容不会被覆盖
+func NewCaptureWriter(path string, peers []common.Address) (c *CaptureWriter, err error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return
+	}
+	if fi.Size() == 0 {
+		_, err = f.Write(captureMagic)
+	} else {
+		magic := make([]byte, len(captureMagic))
+		_, err = f.ReadAt(magic, 0)
+		if err == nil && !bytes.Equal(magic, captureMagic) {
+			err = errNotCaptureFile
+		}
+	}
+	if err != nil {
+		f.Close()
+		return
+	}
+	c = &CaptureWriter{
+		f:     f,
+		peers: make(map[common.Address]bool),
+	}
+	for _, p := range peers {
+		c.peers[p] = true
+	}
+	return
+}
+
+func (c *CaptureWriter) shouldCapture(peer common.Address) bool {
+	return len(c.peers) == 0 || peer == utils.EmptyAddress || c.peers[peer]
+}
+
+//Write 追加一帧,不需要记录的节点直接忽略
+func (c *CaptureWriter) Write(direction CaptureDirection, peer common.Address, data []byte) error {
+	if !c.shouldCapture(peer) {
+		return nil
+	}
+	buf := make([]byte, captureFrameHeaderLen+len(data))
+	binary.BigEndian.PutUint64(buf, uint64(time.Now().UnixNano()))
+	buf[8] = byte(direction)
+	copy(buf[9:], peer[:])
+	binary.BigEndian.PutUint32(buf[29:], uint32(len(data)))
+	copy(buf[captureFrameHeaderLen:], data)
+	//一帧只写一次,崩溃时最多丢失最后一帧
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.f == nil {
+		return os.ErrClosed
+	}
+	_, err := c.f.Write(buf)
+	return err
+}
+
+//Close 关闭以后的Write返回os.ErrClosed
+func (c *CaptureWriter) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.f == nil {
+		return nil
+	}
+	err := c.f.Close()
+	c.f = nil
+	return err
+}
+
+/*
+ReadCaptureFile 读取capture文件中所有的帧,
+最后一帧不完整时(比如photon崩溃)返回已经读到的帧和io.ErrUnexpectedEOF
+*/
+func ReadCaptureFile(path string) (frames []*CapturedFrame, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if !bytes.HasPrefix(data, captureMagic) {
+		return nil, errNotCaptureFile
+	}
+	data = data[len(captureMagic):]
+	for len(data) > 0 {
+		if len(data) < captureFrameHeaderLen {
+			return frames, io.ErrUnexpectedEOF
+		}
+		f := &CapturedFrame{
+			Time:      time.Unix(0, int64(binary.BigEndian.Uint64(data))),
+			Direction: CaptureDirection(data[8]),
+			Peer:      common.BytesToAddress(data[9:29]),
+		}
+		l := int(binary.BigEndian.Uint32(data[29:]))
+		data = data[captureFrameHeaderLen:]
+		if len(data) < l {
+			return frames, io.ErrUnexpectedEOF
+		}
+		f.Data = data[:l]
+		data = data[l:]
+		frames = append(frames, f)
+	}
+	return
+}
+
+/*
+DecodeMessage 和PhotonProtocol收到消息时一样解析原始数据,用于查看capture文件中的消息
+*/
+func DecodeMessage(data []byte) (encoding.Messager, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty message")
+	}
+	messager, ok := encoding.MessageMap[int(data[0])]
+	if !ok {
+		return nil, fmt.Errorf("unknown message cmd %d", data[0])
+	}
+	messager = New(messager).(encoding.Messager)
+	err := messager.UnPack(data)
+	if err != nil {
+		return nil, err
+	}
+	return messager, nil
+}
+
+//messageSender 无法确定发送方时返回空地址
+func messageSender(messager encoding.Messager) common.Address {
+	switch m := messager.(type) {
+	case *encoding.Ack:
+		return m.Sender
+	case *encoding.Delivered:
+		return m.Sender
+	case encoding.SignedMessager:
+		return m.GetSender()
+	}
+	return utils.EmptyAddress
+}
@@ -0,0 +1,120 @@
+package network
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProtocolReceiver struct {
+	received chan []byte
+}
+
+func (r *fakeProtocolReceiver) receive(data []byte) {
+	r.received <- data
+}
+
+func TestCapture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "capture")
+	key, _ := crypto.GenerateKey()
+	ping := encoding.NewPing(3)
+	err = ping.Sign(key, ping)
+	assert.Nil(t, err)
+	peer, other := crypto.PubkeyToAddress(key.PublicKey), utils.NewRandomAddress()
+
+	c, err := NewCaptureWriter(path, []common.Address{peer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, c.Write(CaptureInbound, peer, ping.Pack()))
+	assert.Nil(t, c.Write(CaptureOutbound, other, []byte{1}))
+	assert.Nil(t, c.Write(CaptureInbound, utils.EmptyAddress, []byte{0xff}))
+	assert.Nil(t, c.Close())
+	assert.EqualValues(t, os.ErrClosed, c.Write(CaptureOutbound, peer, []byte{1}))
+	//重新打开时追加
+	c, err = NewCaptureWriter(path, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, c.Write(CaptureOutbound, peer, []byte{2, 3}))
+	assert.Nil(t, c.Close())
+
+	frames, err := ReadCaptureFile(path)
+	assert.Nil(t, err)
+	if !assert.EqualValues(t, 3, len(frames)) {
+		return
+	}
+	assert.EqualValues(t, CaptureInbound, frames[0].Direction)
+	assert.EqualValues(t, peer, frames[0].Peer)
+	msg, err := DecodeMessage(frames[0].Data)
+	assert.Nil(t, err)
+	assert.EqualValues(t, peer, messageSender(msg))
+	_, err = DecodeMessage(frames[1].Data)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, []byte{2, 3}, frames[2].Data)
+
+	//最后一帧不完整
+	data, _ := ioutil.ReadFile(path)
+	assert.Nil(t, ioutil.WriteFile(path, data[:len(data)-1], 0600))
+	frames, err = ReadCaptureFile(path)
+	assert.EqualValues(t, io.ErrUnexpectedEOF, err)
+	assert.EqualValues(t, 2, len(frames))
+	assert.Nil(t, ioutil.WriteFile(path, []byte("not a capture"), 0600))
+	_, err = NewCaptureWriter(path, nil)
+	assert.EqualValues(t, errNotCaptureFile, err)
+}
+
+func TestReplayTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	output, err := NewCaptureWriter(filepath.Join(dir, "replayed"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := utils.NewRandomAddress()
+	now := time.Now()
+	frames := []*CapturedFrame{
+		{Time: now, Direction: CaptureInbound, Peer: peer, Data: []byte{1}},
+		{Time: now.Add(time.Millisecond), Direction: CaptureOutbound, Peer: peer, Data: []byte{2}},
+		{Time: now.Add(time.Hour), Direction: CaptureInbound, Peer: peer, Data: []byte{3}},
+	}
+	old := replayMaxInterval
+	defer func() { replayMaxInterval = old }()
+	replayMaxInterval = 10 * time.Millisecond
+	tr := NewReplayTransport(frames, output)
+	r := &fakeProtocolReceiver{received: make(chan []byte, 10)}
+	tr.RegisterProtocol(r)
+	tr.Start()
+	select {
+	case <-tr.Done():
+	case <-time.After(time.Second):
+		t.Fatal("replay not finished")
+	}
+	//只重放收到的消息
+	assert.EqualValues(t, []byte{1}, <-r.received)
+	assert.EqualValues(t, []byte{3}, <-r.received)
+	assert.Nil(t, tr.Send(peer, []byte{4}))
+	tr.StopAccepting()
+	tr.Stop()
+	replayed, err := ReadCaptureFile(filepath.Join(dir, "replayed"))
+	assert.Nil(t, err)
+	if assert.EqualValues(t, 1, len(replayed)) {
+		assert.EqualValues(t, CaptureOutbound, replayed[0].Direction)
+		assert.EqualValues(t, []byte{4}, replayed[0].Data)
+	}
+}
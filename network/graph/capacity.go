@@ -0,0 +1,79 @@
+package graph
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+通道伙伴之间交换的通道容量,只是近似值,用来在路由时跳过明显余额不足的边.
+没有收到过容量的边仍然按照原来的方式参与路由
+*/
+
+//edgeKey from在和to的通道中的容量
+type edgeKey struct {
+	from common.Address
+	to   common.Address
+}
+
+type edgeCapacity struct {
+	capacity    *big.Int
+	blockNumber int64
+}
+
+func (cg *ChannelGraph) hasEdge(from, to common.Address) bool {
+	fromIndex, ok := cg.address2index[from]
+	if !ok {
+		return false
+	}
+	toIndex, ok := cg.address2index[to]
+	if !ok {
+		return false
+	}
+	v, err := cg.g.GetVertex(fromIndex)
+	if err != nil {
+		return false
+	}
+	_, ok = v.GetArc(toIndex)
+	return ok
+}
+
+/*
+SetEdgeCapacity 记录from在和to的通道中可以支付的金额,
+只有图中存在这条边并且blockNumber比已有的记录新时才更新,返回是否更新了
+*/
+func (cg *ChannelGraph) SetEdgeCapacity(from, to common.Address, capacity *big.Int, blockNumber int64) bool {
+	if !cg.hasEdge(from, to) {
+		return false
+	}
+	key := edgeKey{from, to}
+	if c, ok := cg.edgeCapacities[key]; ok && c.blockNumber >= blockNumber {
+		return false
+	}
+	cg.edgeCapacities[key] = &edgeCapacity{
+		capacity:    new(big.Int).Set(capacity),
+		blockNumber: blockNumber,
+	}
+	return true
+}
+
+//ExpireEdgeCapacities 丢弃minBlockNumber之前的容量
+func (cg *ChannelGraph) ExpireEdgeCapacities(minBlockNumber int64) {
+	for key, c := range cg.edgeCapacities {
+		if c.blockNumber < minBlockNumber {
+			delete(cg.edgeCapacities, key)
+		}
+	}
+}
+
+//edgeCanTransfer 不知道容量的边认为可以转账
+func (cg *ChannelGraph) edgeCanTransfer(from, to common.Address, amount *big.Int) bool {
+	c, ok := cg.edgeCapacities[edgeKey{from, to}]
+	return !ok || c.capacity.Cmp(amount) >= 0
+}
+
+func (cg *ChannelGraph) removeEdgeCapacity(source, target common.Address) {
+	delete(cg.edgeCapacities, edgeKey{source, target})
+	delete(cg.edgeCapacities, edgeKey{target, source})
+}
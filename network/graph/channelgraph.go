@@ -56,6 +56,8 @@ type ChannelGraph struct {
 	ChannelIdentifier2Channel map[common.Hash]*channel.Channel
 	address2index             map[common.Address]int
 	index2address             map[int]common.Address
+	prunedEdges               map[common.Address][]common.Address //被移出路由的节点以及它的边,恢复时使用
+	edgeCapacities            map[edgeKey]*edgeCapacity           //通道伙伴转告的其他通道的容量
 }
 
 /*
@@ -69,6 +71,8 @@ func NewChannelGraph(ourAddress, tokenAddress common.Address, edges []common.Add
 		ChannelIdentifier2Channel: make(map[common.Hash]*channel.Channel),
 		address2index:             make(map[common.Address]int),
 		index2address:             make(map[int]common.Address),
+		prunedEdges:               make(map[common.Address][]common.Address),
+		edgeCapacities:            make(map[edgeKey]*edgeCapacity),
 		g:                         dijkstra.NewGraph(),
 	}
 	cg.makeGraph(edges)
@@ -181,45 +185,6 @@ func (cg *ChannelGraph) HasChannel(source, target common.Address) bool {
 
 var errAddressNotFoundInGraph = errors.New("address not found in channelgraph")
 
-/*
-ShortestPath returns the shortestpath weight from source to target.  make sure only be called in one thread.
-*/
-func (cg *ChannelGraph) ShortestPath(source, target common.Address, amount *big.Int, feeCharger fee.Charger) (totalWeight int64, err error) {
-	sourceIndex, ok := cg.address2index[source]
-	if !ok {
-		err = errAddressNotFoundInGraph
-		return
-	}
-	targetIndex, ok := cg.address2index[target]
-	if !ok {
-		err = errAddressNotFoundInGraph
-		return
-	}
-	if sourceIndex == targetIndex {
-		return 0, nil
-	}
-	var g2 *dijkstra.Graph
-	if false { //make sure only be called in one thread.
-		g2 = cg.g.CloneGraph()
-	} else {
-		g2 = cg.g
-	}
-	for _, v := range g2.Verticies {
-		w := feeCharger.GetNodeChargeFee(cg.index2address[v.ID], cg.TokenAddress, amount).Int64()
-		log.Trace(fmt.Sprintf(fmt.Sprintf("setfee node=%s,fee=%d", cg.index2address[v.ID].String(), w)))
-		if w > 0 { //for no fee policy, all nodes charge 0 ,so use the shortest path first.
-			v.SetWeight(w) // from v's fee is w.
-		}
-	}
-	//log.Trace(fmt.Sprintf("g2=%s", utils.StringInterface(g2, 20)))
-	//log.Trace(fmt.Sprintf("index2address=%s", utils.StringInterface(cg.index2address, 5)))
-	path, err := g2.Shortest(sourceIndex, targetIndex)
-	if err != nil {
-		return
-	}
-	return path.Distance, nil
-}
-
 //RemoveChannel remove a channel from graph,and i'm a participant of this channel
 func (cg *ChannelGraph) RemoveChannel(ch *channel.Channel) {
 	delete(cg.ChannelIdentifier2Channel, ch.ChannelIdentifier.ChannelIdentifier)
@@ -237,6 +202,10 @@ func (cg *ChannelGraph) RemovePath(source, target common.Address) {
 	if !ok {
 		return
 	}
+	//被移出路由的节点,通道关闭以后恢复时不能再加回来
+	cg.removePrunedEdge(source, target)
+	cg.removePrunedEdge(target, source)
+	cg.removeEdgeCapacity(source, target)
 	err := cg.g.DeleteArc(sourceIndex, targetIndex)
 	if err != nil {
 		log.Error(fmt.Sprintf("remove arc %d-%d err %s", sourceIndex, targetIndex, err))
@@ -247,6 +216,75 @@ func (cg *ChannelGraph) RemovePath(source, target common.Address) {
 	}
 }
 
+func (cg *ChannelGraph) removePrunedEdge(node, neighbor common.Address) {
+	edges, ok := cg.prunedEdges[node]
+	if !ok {
+		return
+	}
+	for i, n := range edges {
+		if n == neighbor {
+			cg.prunedEdges[node] = append(edges[:i], edges[i+1:]...)
+			return
+		}
+	}
+}
+
+/*
+PruneNode 将节点`node`的所有边从路由图中移除,但是保留记录,可以通过RestoreNode恢复.
+用于长时间不在线的节点,避免路由时考虑这些节点.
+*/
+func (cg *ChannelGraph) PruneNode(node common.Address) {
+	if node == cg.OurAddress {
+		return
+	}
+	//直接相连的节点,即使不在线也需要保留,通道操作依赖它们
+	if _, ok := cg.PartenerAddress2Channel[node]; ok {
+		return
+	}
+	if _, ok := cg.prunedEdges[node]; ok {
+		return
+	}
+	index, ok := cg.address2index[node]
+	if !ok {
+		return
+	}
+	neighbors, err := cg.g.GetAllNeighbors(index)
+	if err != nil {
+		return
+	}
+	var edges []common.Address
+	for _, i := range neighbors {
+		neighbor := cg.index2address[i]
+		edges = append(edges, neighbor)
+		cg.RemovePath(node, neighbor)
+	}
+	cg.prunedEdges[node] = edges
+	log.Info(fmt.Sprintf("prune node %s from channel graph of token %s,edges=%d", utils.APex2(node), utils.APex2(cg.TokenAddress), len(edges)))
+}
+
+//RestoreNode 恢复被PruneNode移除的节点,如果另一端也被移除了,那么等另一端恢复的时候再加回这条边
+func (cg *ChannelGraph) RestoreNode(node common.Address) {
+	edges, ok := cg.prunedEdges[node]
+	if !ok {
+		return
+	}
+	delete(cg.prunedEdges, node)
+	for _, neighbor := range edges {
+		if _, ok := cg.prunedEdges[neighbor]; ok {
+			cg.prunedEdges[neighbor] = append(cg.prunedEdges[neighbor], node)
+			continue
+		}
+		cg.AddPath(node, neighbor)
+	}
+	log.Info(fmt.Sprintf("restore node %s to channel graph of token %s", utils.APex2(node), utils.APex2(cg.TokenAddress)))
+}
+
+//IsPruned returns true if `node` is pruned from graph
+func (cg *ChannelGraph) IsPruned(node common.Address) bool {
+	_, ok := cg.prunedEdges[node]
+	return ok
+}
+
 /*
 ChannelCanTransfer returns  True if the channel with `partner_address` is open and has spendable funds. """
         TODO: check if the partner's network is alive
@@ -272,109 +310,84 @@ func (cg *ChannelGraph) getNeighbours() []common.Address {
 	return neighbours
 }
 
-type neighborWeight struct {
-	neighbor common.Address
-	weight   int64 //nerghbor to target's hops
-}
-type neighborWeightList []*neighborWeight
-
-func (nw neighborWeightList) Len() int {
-	return len(nw)
-}
-func (nw neighborWeightList) Less(i, j int) bool {
-	return nw[i].weight < nw[j].weight
-}
-func (nw neighborWeightList) Swap(i, j int) {
-	var temp *neighborWeight
-	temp = nw[i]
-	nw[i] = nw[j]
-	nw[j] = temp
-}
-
-/*
-all the neighbors that can reach target
-they are ordered by hops to the target
-*/
-func (cg *ChannelGraph) orderedNeighbours(ourAddress, targetAddress common.Address, amount *big.Int, charger fee.Charger) neighborWeightList {
-
-	neighbors := cg.getNeighbours()
-	var nws neighborWeightList
-	for _, n := range neighbors {
-		w, err := cg.ShortestPath(n, targetAddress, amount, charger)
-		if err != nil {
-			continue
-		}
-		nws = append(nws, &neighborWeight{n, w})
-	}
-	sort.Sort(nws)
-	return nws
-}
-
 /*
-GetBestRoutes returns all neighbor nodes order by weight from it to target.
-我们现在的路由算法应该是有历史记忆的最短路径/最小费用算法.
-跳过所有已经走过的路径.
+GetBestRoutes 返回所有能把amount送到target的邻居,按照整条路径的手续费从低到高排序.
+每个邻居到target的路径由cheapestPath计算,不经过我自己和excludeAddresses中的节点,
+第一跳通道必须能够承担targetAmount加上路径上的手续费,并且不少于amount,路径跳数不能超过通道的settle_timeout和reveal_timeout允许的范围.
 */
 /*
- *	GetBestRoutes :function to return all neighbor nodes order by weight from it to target.
+ *	GetBestRoutes : returns all neighbors that can carry `amount` to target, ordered by total fee of the whole path.
  *
- *	Note that the routing algorithm we currently use should be the shortest-path/minimized-fee algorithm with history record,
- *	which circumvents all routes that have been iterated.
+ *	The path from each neighbor is found by a fee weighted shortest path search, which skips us and `excludeAddresses`,
+ *	the first channel must afford amount plus fees, and the hops must fit in the channel's settle and reveal timeout.
  */
 func (cg *ChannelGraph) GetBestRoutes(nodesStatus NodesStatusGetter, ourAddress common.Address,
 	targetAdress common.Address, amount *big.Int, targetAmount *big.Int, excludeAddresses map[common.Address]bool, feeCharger fee.Charger) (onlineNodes []*route.State) {
-	/*
-
-	   XXX: consider using multiple channels for a single transfer. Useful
-	   for cases were the `amount` is larger than what is available
-	   individually in any of the channels.
-
-	   One possible approach is to _not_ filter these channels based on the
-	   distributable amount, but to sort them based on available balance and
-	   let the task use as many as required to finish the transfer.
-
-	*/
-	nws := cg.orderedNeighbours(ourAddress, targetAdress, amount, feeCharger)
-	if len(nws) == 0 {
-		log.Info(fmt.Sprintf("no routes avaiable from %s to %s", utils.APex(ourAddress), utils.APex(targetAdress)))
-		return
+	exclude := make(map[common.Address]bool)
+	for addr, ok := range excludeAddresses {
+		exclude[addr] = ok
 	}
-	//log.Trace(fmt.Sprintf("nws=%s", utils.StringInterface(nws, 5)))
-	for _, nw := range nws {
-		c := cg.GetPartenerAddress2Channel(nw.neighbor)
-		if c == nil {
-			log.Error(fmt.Sprintf("GetPartenerAddress2Channel returns nil ,but %s should have channel with %s on token %s",
-				utils.APex2(cg.OurAddress), utils.APex2(nw.neighbor), utils.APex2(cg.TokenAddress)))
+	exclude[ourAddress] = true
+	var costs []pathCost
+	for _, neighbor := range cg.getNeighbours() {
+		//don't send the message backwards
+		if excludeAddresses[neighbor] {
 			continue
 		}
-		//don't send the message backwards
-		if excludeAddresses[nw.neighbor] {
+		c := cg.GetPartenerAddress2Channel(neighbor)
+		if c == nil {
+			log.Error(fmt.Sprintf("GetPartenerAddress2Channel returns nil ,but %s should have channel with %s on token %s",
+				utils.APex2(cg.OurAddress), utils.APex2(neighbor), utils.APex2(cg.TokenAddress)))
 			continue
 		}
 		if !c.CanTransfer() {
-			log.Debug(fmt.Sprintf("channel %s-%s cannot transfer ,ignoring ..", utils.APex(ourAddress), utils.APex(nw.neighbor)))
+			log.Debug(fmt.Sprintf("channel %s-%s cannot transfer ,ignoring ..", utils.APex(ourAddress), utils.APex(neighbor)))
 			continue
 		}
-		if amount.Cmp(c.Distributable()) > 0 {
-			log.Debug(fmt.Sprintf("channel %s-%s doesn't have enough funds[%d],ignoring...", utils.APex(ourAddress), utils.APex(nw.neighbor), amount))
+		deviceType, isOnline := nodesStatus.GetNetworkStatus(neighbor)
+		if !isOnline || (deviceType == xmpptransport.TypeMobile && neighbor != targetAdress) {
+			log.Debug(fmt.Sprintf("partener %s network ignored.. isOnline:%v,deviceType:%s", utils.APex(neighbor), isOnline, deviceType))
 			continue
 		}
-		deviceType, isOnline := nodesStatus.GetNetworkStatus(nw.neighbor)
-		if !isOnline || (deviceType == xmpptransport.TypeMobile && nw.neighbor != targetAdress) {
-			log.Debug(fmt.Sprintf("partener %s network ignored.. isOnline:%v,deviceType:%s", utils.APex(nw.neighbor), isOnline, deviceType))
+		path, totalFee, err := cg.cheapestPath(neighbor, targetAdress, targetAmount, cg.maxRouteHops(c)-1, exclude, feeCharger)
+		if err != nil {
+			log.Debug(fmt.Sprintf("no path from %s to %s within %d hops", utils.APex(neighbor), utils.APex(targetAdress), cg.maxRouteHops(c)))
 			continue
 		}
-		routeState := Channel2RouteState(c, nw.neighbor, targetAmount, feeCharger, []common.Address{})
-		if routeState.Fee.Cmp(utils.BigInt0) > 0 {
-			routeState.TotalFee = big.NewInt(int64(nw.weight))
-		} else { //no fee policy,
-			routeState.TotalFee = utils.BigInt0
+		//发起方在targetAmount上加上手续费,中间节点收到的amount已经包含了后面的手续费
+		required := new(big.Int).Add(targetAmount, totalFee)
+		if required.Cmp(amount) < 0 {
+			required = amount
 		}
-
+		if required.Cmp(c.Distributable()) > 0 {
+			log.Debug(fmt.Sprintf("channel %s-%s doesn't have enough funds for %s,ignoring...", utils.APex(ourAddress), utils.APex(neighbor), required))
+			continue
+		}
+		routeState := Channel2RouteState(c, neighbor, targetAmount, feeCharger, []common.Address{})
+		routeState.TotalFee = totalFee
 		onlineNodes = append(onlineNodes, routeState)
+		costs = append(costs, pathCost{fee: totalFee, hops: len(path)})
 	}
+	if len(onlineNodes) == 0 {
+		log.Info(fmt.Sprintf("no routes avaiable from %s to %s", utils.APex(ourAddress), utils.APex(targetAdress)))
+		return
+	}
+	sort.Stable(&routesByCost{onlineNodes, costs})
 	return
 }
+
+//routesByCost 按照路径代价排序路由
+type routesByCost struct {
+	routes []*route.State
+	costs  []pathCost
+}
+
+func (r *routesByCost) Len() int           { return len(r.routes) }
+func (r *routesByCost) Less(i, j int) bool { return r.costs[i].less(r.costs[j]) }
+func (r *routesByCost) Swap(i, j int) {
+	r.routes[i], r.routes[j] = r.routes[j], r.routes[i]
+	r.costs[i], r.costs[j] = r.costs[j], r.costs[i]
+}
 func (cg *ChannelGraph) haveNodes() bool {
 	return len(cg.g.Verticies) > 0
 }
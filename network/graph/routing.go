@@ -0,0 +1,251 @@
+package graph
+
+import (
+	"container/heap"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/SmartMeshFoundation/Photon/channel"
+	"github.com/SmartMeshFoundation/Photon/network/dijkstra"
+	"github.com/SmartMeshFoundation/Photon/network/rpc/fee"
+	"github.com/SmartMeshFoundation/Photon/network/xmpptransport"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+本地路由:从每个邻居出发在ChannelGraph上做Dijkstra,找到到target手续费最少的路径,手续费相同时跳数少的优先.
+只有自己的通道知道余额,第一跳通道的Distributable必须能够承担金额加上手续费,
+其他通道的余额本地不知道,只能依靠通道伙伴交换的近似容量跳过余额不足的边,或者中转失败以后换路由.
+锁的有效期是settle_timeout-reveal_timeout,路径上每一跳都要留出reveal_timeout个块,跳数太多的路径锁来不及解开,也不能用
+*/
+
+//pathCost 路径的代价,先比较手续费,再比较跳数
+type pathCost struct {
+	fee  *big.Int
+	hops int
+}
+
+func (c pathCost) less(o pathCost) bool {
+	if n := c.fee.Cmp(o.fee); n != 0 {
+		return n < 0
+	}
+	return c.hops < o.hops
+}
+
+//pathItem 搜索过程中到达node的一条路径,同一个节点跳数不同是不同的状态,这样才能限制跳数
+type pathItem struct {
+	node int
+	cost pathCost
+	prev *pathItem
+}
+
+type pathQueue []*pathItem
+
+func (q pathQueue) Len() int            { return len(q) }
+func (q pathQueue) Less(i, j int) bool  { return q[i].cost.less(q[j].cost) }
+func (q pathQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *pathQueue) Push(x interface{}) { *q = append(*q, x.(*pathItem)) }
+func (q *pathQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+//maxRouteHops 经过我的通道c的路径最多能有多少跳,包括c本身
+func (cg *ChannelGraph) maxRouteHops(c *channel.Channel) int {
+	if c.RevealTimeout <= 0 {
+		//没有reveal_timeout时只能用节点数量限制,不会有比这更长的无环路径
+		return len(cg.address2index)
+	}
+	n := (c.SettleTimeout - c.RevealTimeout) / c.RevealTimeout
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+/*
+cheapestPath 从source到target手续费最少的路径,最多maxHops跳,不经过exclude中的节点.
+返回的路径从source开始,到target结束,totalFee是路径上除了target以外所有节点收取的手续费
+*/
+func (cg *ChannelGraph) cheapestPath(source, target common.Address, amount *big.Int, maxHops int, exclude map[common.Address]bool, feeCharger fee.Charger) (path []common.Address, totalFee *big.Int, err error) {
+	sourceIndex, ok := cg.address2index[source]
+	if !ok {
+		err = errAddressNotFoundInGraph
+		return
+	}
+	targetIndex, ok := cg.address2index[target]
+	if !ok {
+		err = errAddressNotFoundInGraph
+		return
+	}
+	fees := make(map[int]*big.Int)
+	nodeFee := func(index int) *big.Int {
+		if index == targetIndex {
+			return big.NewInt(0)
+		}
+		f, ok := fees[index]
+		if !ok {
+			f = feeCharger.GetNodeChargeFee(cg.index2address[index], cg.TokenAddress, amount)
+			if f == nil {
+				f = big.NewInt(0)
+			}
+			fees[index] = f
+		}
+		return f
+	}
+	type state struct {
+		node int
+		hops int
+	}
+	done := make(map[state]bool)
+	q := &pathQueue{{node: sourceIndex, cost: pathCost{fee: nodeFee(sourceIndex), hops: 0}}}
+	for q.Len() > 0 {
+		item := heap.Pop(q).(*pathItem)
+		if item.node == targetIndex {
+			for p := item; p != nil; p = p.prev {
+				path = append([]common.Address{cg.index2address[p.node]}, path...)
+			}
+			totalFee = item.cost.fee
+			return
+		}
+		s := state{item.node, item.cost.hops}
+		if done[s] || item.cost.hops >= maxHops {
+			continue
+		}
+		done[s] = true
+		neighbors, err2 := cg.g.GetAllNeighbors(item.node)
+		if err2 != nil {
+			continue
+		}
+		for _, n := range neighbors {
+			if n == sourceIndex || exclude[cg.index2address[n]] || done[state{n, item.cost.hops + 1}] {
+				continue
+			}
+			if !cg.edgeCanTransfer(cg.index2address[item.node], cg.index2address[n], amount) {
+				continue
+			}
+			heap.Push(q, &pathItem{
+				node: n,
+				cost: pathCost{
+					fee:  new(big.Int).Add(item.cost.fee, nodeFee(n)),
+					hops: item.cost.hops + 1,
+				},
+				prev: item,
+			})
+		}
+	}
+	err = dijkstra.ErrNoPath
+	return
+}
+
+/*
+CheckPath 检查path上相邻的节点之间都有打开的通道,并且通道伙伴转告的容量不少于amount.
+没有收到过容量的通道只能检查是否存在,因为长时间不在线被移出路由的节点的通道仍然算存在
+*/
+func (cg *ChannelGraph) CheckPath(path []common.Address, amount *big.Int) error {
+	for i := 0; i+1 < len(path); i++ {
+		from, to := path[i], path[i+1]
+		if !cg.hasEdge(from, to) && !cg.isPrunedEdge(from, to) && !cg.isPrunedEdge(to, from) {
+			return fmt.Errorf("no open channel between %s and %s", utils.APex2(from), utils.APex2(to))
+		}
+		if !cg.edgeCanTransfer(from, to, amount) {
+			return fmt.Errorf("channel %s-%s doesn't have enough capacity for %s", utils.APex2(from), utils.APex2(to), amount)
+		}
+	}
+	return nil
+}
+
+func (cg *ChannelGraph) isPrunedEdge(node, neighbor common.Address) bool {
+	for _, n := range cg.prunedEdges[node] {
+		if n == neighbor {
+			return true
+		}
+	}
+	return false
+}
+
+//RouteEstimate 估算交易时经过一个邻居的候选路由
+type RouteEstimate struct {
+	Partner common.Address `json:"partner"`
+	//Path 从partner开始,到target结束
+	Path []common.Address `json:"path"`
+	Hops int              `json:"hops"`
+	Fee  *big.Int         `json:"fee"`
+	//Capacity 第一跳通道能够转出的金额
+	Capacity   *big.Int `json:"capacity"`
+	Sufficient bool     `json:"sufficient"`
+	Reason     string   `json:"reason,omitempty"`
+}
+
+/*
+EstimateRoutes 和GetBestRoutes一样计算每个邻居到target的路径和手续费,但是不会去掉余额不足,不在线或者不能交易的通道,
+而是在Sufficient和Reason中说明,这样用户在发起交易之前就能知道大概的手续费.能用的路由排在前面,各自按照代价排序
+*/
+func (cg *ChannelGraph) EstimateRoutes(nodesStatus NodesStatusGetter, ourAddress common.Address,
+	targetAdress common.Address, amount *big.Int, excludeAddresses map[common.Address]bool, feeCharger fee.Charger) (routes []*RouteEstimate) {
+	exclude := make(map[common.Address]bool)
+	for addr, ok := range excludeAddresses {
+		exclude[addr] = ok
+	}
+	exclude[ourAddress] = true
+	var costs []pathCost
+	for _, neighbor := range cg.getNeighbours() {
+		if excludeAddresses[neighbor] {
+			continue
+		}
+		c := cg.PartenerAddress2Channel[neighbor]
+		if c == nil {
+			continue
+		}
+		path, totalFee, err := cg.cheapestPath(neighbor, targetAdress, amount, cg.maxRouteHops(c)-1, exclude, feeCharger)
+		if err != nil {
+			continue
+		}
+		r := &RouteEstimate{
+			Partner:    neighbor,
+			Path:       path,
+			Hops:       len(path),
+			Fee:        totalFee,
+			Capacity:   c.Distributable(),
+			Sufficient: true,
+		}
+		deviceType, isOnline := nodesStatus.GetNetworkStatus(neighbor)
+		required := new(big.Int).Add(amount, totalFee)
+		if !c.CanTransfer() {
+			r.Sufficient = false
+			r.Reason = fmt.Sprintf("channel state is %s", c.State)
+		} else if !isOnline || (deviceType == xmpptransport.TypeMobile && neighbor != targetAdress) {
+			r.Sufficient = false
+			r.Reason = "partner is not online"
+		} else if required.Cmp(r.Capacity) > 0 {
+			r.Sufficient = false
+			r.Reason = fmt.Sprintf("channel needs %s but only %s is available", required, r.Capacity)
+		}
+		routes = append(routes, r)
+		costs = append(costs, pathCost{fee: totalFee, hops: len(path)})
+	}
+	sort.Stable(&estimatesByCost{routes, costs})
+	return
+}
+
+//estimatesByCost 能用的路由在前,然后按照路径代价排序
+type estimatesByCost struct {
+	routes []*RouteEstimate
+	costs  []pathCost
+}
+
+func (r *estimatesByCost) Len() int { return len(r.routes) }
+func (r *estimatesByCost) Less(i, j int) bool {
+	if r.routes[i].Sufficient != r.routes[j].Sufficient {
+		return r.routes[i].Sufficient
+	}
+	return r.costs[i].less(r.costs[j])
+}
+func (r *estimatesByCost) Swap(i, j int) {
+	r.routes[i], r.routes[j] = r.routes[j], r.routes[i]
+	r.costs[i], r.costs[j] = r.costs[j], r.costs[i]
+}
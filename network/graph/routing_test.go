@@ -0,0 +1,183 @@
+package graph
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/channel"
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/network/rpc/contracts"
+	"github.com/SmartMeshFoundation/Photon/transfer/mtree"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+type testFeeCharger map[common.Address]int64
+
+func (f testFeeCharger) GetNodeChargeFee(nodeAddress, tokenAddress common.Address, amount *big.Int) *big.Int {
+	return big.NewInt(f[nodeAddress])
+}
+
+type allOnline struct{}
+
+func (allOnline) GetNetworkStatus(addr common.Address) (deviceType string, isOnline bool) {
+	return "", true
+}
+
+func newTestChannel(our, partner, token common.Address, balance int64, revealTimeout, settleTimeout int) *channel.Channel {
+	return &channel.Channel{
+		OurState:          channel.NewChannelEndState(our, big.NewInt(balance), nil, mtree.NewMerkleTree(nil)),
+		PartnerState:      channel.NewChannelEndState(partner, big.NewInt(0), nil, mtree.NewMerkleTree(nil)),
+		TokenAddress:      token,
+		ChannelIdentifier: contracts.ChannelUniqueID{ChannelIdentifier: utils.NewRandomHash()},
+		RevealTimeout:     revealTimeout,
+		SettleTimeout:     settleTimeout,
+		State:             channeltype.StateOpened,
+	}
+}
+
+func TestGetBestRoutes(t *testing.T) {
+	a, b, c, d, target := utils.NewRandomAddress(), utils.NewRandomAddress(), utils.NewRandomAddress(), utils.NewRandomAddress(), utils.NewRandomAddress()
+	token := utils.NewRandomAddress()
+	//a-b-d-target 手续费2,a-c-target 手续费5
+	newGraph := func(balance int64, revealTimeout, settleTimeout int) *ChannelGraph {
+		cg := NewChannelGraph(a, token, []common.Address{b, d, d, target, c, target})
+		err := cg.AddChannel(newTestChannel(a, b, token, balance, revealTimeout, settleTimeout))
+		assert.Nil(t, err)
+		err = cg.AddChannel(newTestChannel(a, c, token, balance, revealTimeout, settleTimeout))
+		assert.Nil(t, err)
+		return cg
+	}
+	fees := testFeeCharger{b: 1, c: 5, d: 1}
+
+	cg := newGraph(100, 5, 100)
+	routes := cg.GetBestRoutes(allOnline{}, a, target, big.NewInt(10), big.NewInt(10), EmptyExlude, fees)
+	if assert.Len(t, routes, 2) {
+		assert.Equal(t, b, routes[0].HopNode())
+		assert.EqualValues(t, big.NewInt(2), routes[0].TotalFee)
+		assert.Equal(t, c, routes[1].HopNode())
+		assert.EqualValues(t, big.NewInt(5), routes[1].TotalFee)
+	}
+	//排除d以后b没有路径
+	routes = cg.GetBestRoutes(allOnline{}, a, target, big.NewInt(10), big.NewInt(10), MakeExclude(d), fees)
+	if assert.Len(t, routes, 1) {
+		assert.Equal(t, c, routes[0].HopNode())
+	}
+
+	//余额不够支付金额加上手续费
+	cg = newGraph(12, 5, 100)
+	routes = cg.GetBestRoutes(allOnline{}, a, target, big.NewInt(9), big.NewInt(9), EmptyExlude, fees)
+	if assert.Len(t, routes, 1) {
+		assert.Equal(t, b, routes[0].HopNode())
+	}
+	//中间节点收到的金额已经包含了手续费
+	routes = cg.GetBestRoutes(allOnline{}, a, target, big.NewInt(12), big.NewInt(7), EmptyExlude, fees)
+	assert.Len(t, routes, 2)
+
+	//settle_timeout和reveal_timeout只允许两跳
+	cg = newGraph(100, 10, 30)
+	routes = cg.GetBestRoutes(allOnline{}, a, target, big.NewInt(10), big.NewInt(10), EmptyExlude, fees)
+	if assert.Len(t, routes, 1) {
+		assert.Equal(t, c, routes[0].HopNode())
+	}
+}
+
+func TestCheapestPath(t *testing.T) {
+	a, b, c, target := utils.NewRandomAddress(), utils.NewRandomAddress(), utils.NewRandomAddress(), utils.NewRandomAddress()
+	//a-b-target,a-c-target,a-target,手续费都是0时直接相连的最短
+	cg := NewChannelGraph(a, utils.NewRandomAddress(), []common.Address{a, b, b, target, a, c, c, target, a, target})
+	path, fee, err := cg.cheapestPath(a, target, big.NewInt(1), 5, EmptyExlude, testFeeCharger{})
+	assert.Nil(t, err)
+	assert.Equal(t, []common.Address{a, target}, path)
+	assert.EqualValues(t, big.NewInt(0), fee)
+	//选择手续费少的中间节点
+	cg = NewChannelGraph(a, utils.NewRandomAddress(), []common.Address{a, b, b, target, a, c, c, target})
+	path, fee, err = cg.cheapestPath(a, target, big.NewInt(1), 5, EmptyExlude, testFeeCharger{b: 3, c: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []common.Address{a, c, target}, path)
+	assert.EqualValues(t, big.NewInt(1), fee)
+	//跳数超过限制
+	_, _, err = cg.cheapestPath(a, target, big.NewInt(1), 1, EmptyExlude, testFeeCharger{})
+	assert.NotNil(t, err)
+	_, _, err = cg.cheapestPath(b, target, big.NewInt(1), 5, MakeExclude(a, target), testFeeCharger{})
+	assert.NotNil(t, err)
+}
+
+func TestEdgeCapacity(t *testing.T) {
+	a, b, c, target := utils.NewRandomAddress(), utils.NewRandomAddress(), utils.NewRandomAddress(), utils.NewRandomAddress()
+	//a-b-target 手续费1,a-c-target 手续费3
+	cg := NewChannelGraph(a, utils.NewRandomAddress(), []common.Address{a, b, b, target, a, c, c, target})
+	fees := testFeeCharger{b: 1, c: 3}
+	//不存在的边不记录
+	assert.False(t, cg.SetEdgeCapacity(b, c, big.NewInt(100), 10))
+	assert.True(t, cg.SetEdgeCapacity(b, target, big.NewInt(5), 10))
+	//旧的容量不能覆盖新的
+	assert.False(t, cg.SetEdgeCapacity(b, target, big.NewInt(100), 9))
+	path, _, err := cg.cheapestPath(a, target, big.NewInt(5), 5, EmptyExlude, fees)
+	assert.Nil(t, err)
+	assert.Equal(t, []common.Address{a, b, target}, path)
+	//b的容量不够时绕过b
+	path, _, err = cg.cheapestPath(a, target, big.NewInt(6), 5, EmptyExlude, fees)
+	assert.Nil(t, err)
+	assert.Equal(t, []common.Address{a, c, target}, path)
+	//只有b-target方向的容量不够,target-b方向不受影响
+	path, _, err = cg.cheapestPath(target, a, big.NewInt(6), 5, EmptyExlude, fees)
+	assert.Nil(t, err)
+	assert.Equal(t, []common.Address{target, b, a}, path)
+	//过期以后恢复使用
+	cg.ExpireEdgeCapacities(11)
+	path, _, err = cg.cheapestPath(a, target, big.NewInt(6), 5, EmptyExlude, fees)
+	assert.Nil(t, err)
+	assert.Equal(t, []common.Address{a, b, target}, path)
+	//边被移除时容量也一起删除
+	assert.True(t, cg.SetEdgeCapacity(b, target, big.NewInt(5), 12))
+	cg.RemovePath(b, target)
+	cg.AddPath(b, target)
+	path, _, err = cg.cheapestPath(a, target, big.NewInt(6), 5, EmptyExlude, fees)
+	assert.Nil(t, err)
+	assert.Equal(t, []common.Address{a, b, target}, path)
+}
+
+func TestCheckPath(t *testing.T) {
+	a, b, c, target := utils.NewRandomAddress(), utils.NewRandomAddress(), utils.NewRandomAddress(), utils.NewRandomAddress()
+	cg := NewChannelGraph(a, utils.NewRandomAddress(), []common.Address{a, b, b, c, c, target})
+	assert.Nil(t, cg.CheckPath([]common.Address{a, b, c, target}, big.NewInt(10)))
+	assert.NotNil(t, cg.CheckPath([]common.Address{a, c, target}, big.NewInt(10)))
+	//被移出路由的节点的通道仍然存在
+	cg.PruneNode(c)
+	assert.Nil(t, cg.CheckPath([]common.Address{a, b, c, target}, big.NewInt(10)))
+	cg.RestoreNode(c)
+	assert.True(t, cg.SetEdgeCapacity(c, target, big.NewInt(5), 1))
+	assert.NotNil(t, cg.CheckPath([]common.Address{a, b, c, target}, big.NewInt(10)))
+	assert.Nil(t, cg.CheckPath([]common.Address{a, b, c, target}, big.NewInt(5)))
+}
+
+func TestEstimateRoutes(t *testing.T) {
+	a, b, c, d, target := utils.NewRandomAddress(), utils.NewRandomAddress(), utils.NewRandomAddress(), utils.NewRandomAddress(), utils.NewRandomAddress()
+	token := utils.NewRandomAddress()
+	//a-b-d-target 手续费2,a-c-target 手续费5,b的通道余额不够
+	cg := NewChannelGraph(a, token, []common.Address{b, d, d, target, c, target})
+	err := cg.AddChannel(newTestChannel(a, b, token, 11, 5, 100))
+	assert.Nil(t, err)
+	err = cg.AddChannel(newTestChannel(a, c, token, 100, 5, 100))
+	assert.Nil(t, err)
+	fees := testFeeCharger{b: 1, c: 5, d: 1}
+	routes := cg.EstimateRoutes(allOnline{}, a, target, big.NewInt(10), EmptyExlude, fees)
+	if assert.Len(t, routes, 2) {
+		assert.Equal(t, c, routes[0].Partner)
+		assert.True(t, routes[0].Sufficient)
+		assert.Equal(t, 2, routes[0].Hops)
+		assert.EqualValues(t, big.NewInt(5), routes[0].Fee)
+		assert.Equal(t, b, routes[1].Partner)
+		assert.False(t, routes[1].Sufficient)
+		assert.Equal(t, []common.Address{b, d, target}, routes[1].Path)
+		assert.EqualValues(t, big.NewInt(2), routes[1].Fee)
+		assert.EqualValues(t, big.NewInt(11), routes[1].Capacity)
+	}
+	routes = cg.EstimateRoutes(allOnline{}, a, target, big.NewInt(9), EmptyExlude, fees)
+	if assert.Len(t, routes, 2) {
+		assert.Equal(t, b, routes[0].Partner)
+		assert.True(t, routes[0].Sufficient)
+	}
+}
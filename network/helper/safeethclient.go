@@ -19,6 +19,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
 )
 
 var errNotConnectd = rerr.ErrSpectrumNotConnected
@@ -26,25 +27,30 @@ var errNotConnectd = rerr.ErrSpectrumNotConnected
 //SafeEthClient how to recover from a restart of geth
 type SafeEthClient struct {
 	*ethclient.Client
+	rpcClient  *gethrpc.Client //Client使用的底层连接,用于ethclient没有封装的订阅
 	lock       sync.Mutex
-	url        string
+	urls       []string //第一个是主节点,其余是备用节点
+	urlIndex   int      //当前使用的节点
+	connectSeq int      //每次重连成功加一,用来结束上一次连接启动的检查主节点的线程
 	ReConnect  map[string]chan struct{}
 	Status     netshare.Status
 	StatusChan chan netshare.Status
 	quitChan   chan struct{}
+	//GasPriceAdjuster 不为nil时,用它调整公链节点建议的gasPrice
+	GasPriceAdjuster func(suggested *big.Int) *big.Int
 }
 
-//NewSafeClient create safeclient
-func NewSafeClient(rawurl string) (*SafeEthClient, error) {
+//NewSafeClient create safeclient, when `rawurl` is unavailable, `backupURLs` will be tried in order
+func NewSafeClient(rawurl string, backupURLs ...string) (*SafeEthClient, error) {
 	c := &SafeEthClient{
 		ReConnect:  make(map[string]chan struct{}),
-		url:        rawurl,
+		urls:       append([]string{rawurl}, backupURLs...),
 		StatusChan: make(chan netshare.Status, 10),
 		quitChan:   make(chan struct{}),
 	}
 	var err error
 	ctx, cancelFunc := context.WithTimeout(context.Background(), params.EthRPCTimeout)
-	c.Client, err = ethclient.DialContext(ctx, rawurl)
+	c.Client, c.rpcClient, err = dial(ctx, rawurl)
 	cancelFunc()
 	if err == nil && checkConnectStatus(c.Client) == nil {
 		c.changeStatus(netshare.Connected)
@@ -63,6 +69,26 @@ func (c *SafeEthClient) Close() {
 	close(c.quitChan)
 }
 
+//URL returns the eth rpc server currently used
+func (c *SafeEthClient) URL() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.urls[c.urlIndex]
+}
+
+//HasBackup returns true when there are more than one eth rpc server to fail over
+func (c *SafeEthClient) HasBackup() bool {
+	return len(c.urls) > 1
+}
+
+//nextURL 切换到下一个公链节点,只有一个节点时总是返回该节点
+func (c *SafeEthClient) nextURL() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.urlIndex = (c.urlIndex + 1) % len(c.urls)
+	return c.urls[c.urlIndex]
+}
+
 //IsConnected return true when connected to eth rpc server
 func (c *SafeEthClient) IsConnected() bool {
 	return c.Status == netshare.Connected
@@ -91,10 +117,35 @@ func (c *SafeEthClient) changeStatus(newStatus netshare.Status) {
 	}
 }
 
-//RecoverDisconnect try to reconnect with geth after a restart of geth
+func dial(ctx context.Context, url string) (*ethclient.Client, *gethrpc.Client, error) {
+	rpcClient, err := gethrpc.DialContext(ctx, url)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ethclient.NewClient(rpcClient), rpcClient, nil
+}
+
+//RecoverDisconnect try to reconnect with geth after a restart of geth.
+//the current server is tried first, if backup servers are configured, the following attempts fail over to the next server.
 func (c *SafeEthClient) RecoverDisconnect() {
+	c.recoverDisconnect(false)
+}
+
+//FailOver 当前公链节点可以连接但是不可用(比如长时间不出块)时,直接从下一个节点开始重连
+func (c *SafeEthClient) FailOver() {
+	c.recoverDisconnect(true)
+}
+
+/*
+recoverDisconnect 依次尝试所有公链节点直到连接成功,`skipCurrent`为false时先重试当前节点.
+连接到备用节点以后,定期检查主节点是否已经恢复
+*/
+func (c *SafeEthClient) recoverDisconnect(skipCurrent bool) {
 	var err error
 	var client *ethclient.Client
+	var rpcClient *gethrpc.Client
+	var tried int
+	interval := params.EthRPCReconnectMinInterval
 	c.changeStatus(netshare.Reconnecting)
 	if c.Client != nil {
 		c.Client.Close()
@@ -107,8 +158,13 @@ func (c *SafeEthClient) RecoverDisconnect() {
 		default:
 			//never block
 		}
+		url := c.URL()
+		if c.HasBackup() && (tried > 0 || skipCurrent) {
+			url = c.nextURL()
+			log.Info(fmt.Sprintf("fail over to eth rpc server %s", url))
+		}
 		ctx, cancelFunc := context.WithTimeout(context.Background(), params.EthRPCTimeout)
-		client, err = ethclient.DialContext(ctx, c.url)
+		client, rpcClient, err = dial(ctx, url)
 		cancelFunc()
 		if err == nil {
 			err = checkConnectStatus(client)
@@ -116,6 +172,7 @@ func (c *SafeEthClient) RecoverDisconnect() {
 		if err == nil {
 			//reconnect ok
 			c.Client = client
+			c.rpcClient = rpcClient
 			c.changeStatus(netshare.Connected)
 			c.lock.Lock()
 			var keys []string
@@ -127,11 +184,75 @@ func (c *SafeEthClient) RecoverDisconnect() {
 			for _, name := range keys {
 				delete(c.ReConnect, name)
 			}
+			c.connectSeq++
+			if c.urlIndex != 0 {
+				go c.retryPrimary(c.connectSeq)
+			}
+			c.lock.Unlock()
+			return
+		}
+		tried++
+		//所有节点都尝试过一遍以后才等待
+		if tried%len(c.urls) != 0 {
+			log.Info(fmt.Sprintf("reconnect to %s error: %s, try next server", url, err))
+			continue
+		}
+		log.Info(fmt.Sprintf("reconnect to geth error: %s, retry after %s", err, interval))
+		select {
+		case <-c.quitChan:
+			return
+		case <-time.After(interval):
+		}
+		//指数退避,避免公链节点长时间宕机时频繁重连
+		interval *= 2
+		if interval > params.EthRPCReconnectMaxInterval {
+			interval = params.EthRPCReconnectMaxInterval
+		}
+	}
+}
+
+/*
+retryPrimary 使用备用节点期间,每隔params.EthRPCPrimaryRetryInterval检查一次主节点,
+主节点可用时切换回主节点,重新连接成功后会和断线重连一样通知上层.
+`seq`对应的连接已经被新的重连替换时退出
+*/
+func (c *SafeEthClient) retryPrimary(seq int) {
+	for {
+		select {
+		case <-c.quitChan:
+			return
+		case <-time.After(params.EthRPCPrimaryRetryInterval):
+		}
+		c.lock.Lock()
+		stale := c.connectSeq != seq || c.urlIndex == 0
+		c.lock.Unlock()
+		if stale {
+			return
+		}
+		if !c.IsConnected() {
+			continue
+		}
+		ctx, cancelFunc := context.WithTimeout(context.Background(), params.EthRPCTimeout)
+		client, _, err := dial(ctx, c.urls[0])
+		cancelFunc()
+		if err == nil {
+			err = checkConnectStatus(client)
+			client.Close()
+		}
+		if err != nil {
+			log.Info(fmt.Sprintf("primary eth rpc server %s is still unavailable: %s", c.urls[0], err))
+			continue
+		}
+		c.lock.Lock()
+		if c.connectSeq != seq {
 			c.lock.Unlock()
 			return
 		}
-		log.Info(fmt.Sprintf("reconnect to geth error: %s", err))
-		time.Sleep(time.Second * 3)
+		c.urlIndex = 0
+		c.lock.Unlock()
+		log.Info(fmt.Sprintf("primary eth rpc server %s is available again, switch back to it", c.urls[0]))
+		c.RecoverDisconnect()
+		return
 	}
 }
 
@@ -244,6 +365,19 @@ func (c *SafeEthClient) SubscribeNewHead(ctx context.Context, ch chan<- *types.H
 	return c.Client.SubscribeNewHead(ctx, ch)
 }
 
+/*
+SubscribePendingTransactions 订阅公链节点交易池中新交易的hash,
+只有websocket和ipc连接并且公链节点开放了交易池订阅时才能成功
+*/
+func (c *SafeEthClient) SubscribePendingTransactions(ctx context.Context, ch chan<- common.Hash) (ethereum.Subscription, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.rpcClient == nil {
+		return nil, errNotConnectd
+	}
+	return c.rpcClient.EthSubscribe(ctx, ch, "newPendingTransactions")
+}
+
 //NetworkID wrapper of NetworkID
 func (c *SafeEthClient) NetworkID(ctx context.Context) (*big.Int, error) {
 	c.lock.Lock()
@@ -393,7 +527,11 @@ func (c *SafeEthClient) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
 	if c.Client == nil {
 		return nil, errNotConnectd
 	}
-	return c.Client.SuggestGasPrice(ctx)
+	gasPrice, err := c.Client.SuggestGasPrice(ctx)
+	if err != nil || c.GasPriceAdjuster == nil {
+		return gasPrice, err
+	}
+	return c.GasPriceAdjuster(gasPrice), nil
 }
 
 //EstimateGas wrapper of EstimateGas
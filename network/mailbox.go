@@ -0,0 +1,186 @@
+package network
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+/*
+对方不在线时,把消息用对方的公钥加密以后存放到params.MailboxURL指定的信箱服务,对方上线以后取回并像普通消息一样处理,
+处理以后通过transport回复Ack,发送方的重发和Ack机制不变,信箱只是多了一条路径.
+信箱服务的接口:
+	POST   /mailbox/<接收方地址>             body是Sealed消息,任何人都可以存放
+	GET    /mailbox/<自己的地址>             返回{"messages":[{"id":1,"data":"base64"}]},按照id递增
+	DELETE /mailbox/<自己的地址>?through=<id> 删除id不超过through的消息
+GET和DELETE需要X-Photon-Time(unix时间)和X-Photon-Signature(对MailboxAuthHash的65字节签名,最后一个字节是0或者1)两个头,证明自己是地址的所有者
+*/
+
+//MailboxMessage 信箱中的一条消息
+type MailboxMessage struct {
+	ID   uint64 `json:"id"`
+	Data []byte `json:"data"`
+}
+
+type mailboxMessages struct {
+	Messages []*MailboxMessage `json:"messages"`
+}
+
+//MailboxAuthHash 取回或者删除`node`的消息时签名的内容,信箱服务应该拒绝时间相差太大的请求
+func MailboxAuthHash(node common.Address, timestamp int64) common.Hash {
+	return utils.Sha3([]byte("photon-mailbox"), node[:], []byte(strconv.FormatInt(timestamp, 10)))
+}
+
+//MailboxClient 信箱服务的客户端
+type MailboxClient struct {
+	url    string
+	key    *ecdsa.PrivateKey
+	node   common.Address
+	client *http.Client
+}
+
+//NewMailboxClient `url`是信箱服务的地址,`key`用来证明自己的身份
+func NewMailboxClient(url string, key *ecdsa.PrivateKey) *MailboxClient {
+	return &MailboxClient{
+		url:    strings.TrimRight(url, "/"),
+		key:    key,
+		node:   crypto.PubkeyToAddress(key.PublicKey),
+		client: &http.Client{Timeout: params.MailboxTimeout},
+	}
+}
+
+func (mc *MailboxClient) do(method, url string, body []byte, auth bool) ([]byte, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if auth {
+		now := time.Now().Unix()
+		hash := MailboxAuthHash(mc.node, now)
+		sig, err := crypto.Sign(hash[:], mc.key)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-Photon-Time", strconv.FormatInt(now, 10))
+		req.Header.Set("X-Photon-Signature", hex.EncodeToString(sig))
+	}
+	resp, err := mc.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("mailbox %s %s status %d", method, url, resp.StatusCode)
+	}
+	return data, nil
+}
+
+//Deposit 把加密以后的消息存放到`recipient`的信箱
+func (mc *MailboxClient) Deposit(recipient common.Address, sealed []byte) error {
+	_, err := mc.do(http.MethodPost, fmt.Sprintf("%s/mailbox/%s", mc.url, recipient.String()), sealed, false)
+	return err
+}
+
+//Fetch 取回自己信箱中的所有消息
+func (mc *MailboxClient) Fetch() ([]*MailboxMessage, error) {
+	data, err := mc.do(http.MethodGet, fmt.Sprintf("%s/mailbox/%s", mc.url, mc.node.String()), nil, true)
+	if err != nil {
+		return nil, err
+	}
+	var msgs mailboxMessages
+	err = json.Unmarshal(data, &msgs)
+	return msgs.Messages, err
+}
+
+//Ack 删除自己信箱中id不超过`through`的消息
+func (mc *MailboxClient) Ack(through uint64) error {
+	_, err := mc.do(http.MethodDelete, fmt.Sprintf("%s/mailbox/%s?through=%d", mc.url, mc.node.String(), through), nil, true)
+	return err
+}
+
+//SetMailbox 对方不在线时通过`mailbox`转发消息,必须在Start之前调用
+func (p *PhotonProtocol) SetMailbox(mailbox *MailboxClient) {
+	p.mailbox = mailbox
+}
+
+/*
+depositToMailbox 把`data`用`receiver`的公钥加密以后存放到它的信箱,
+不知道对方公钥时无法加密,返回errPeerKeyUnknown
+*/
+func (p *PhotonProtocol) depositToMailbox(receiver common.Address, data []byte) error {
+	key := p.peerKey(receiver)
+	if key == nil {
+		return errPeerKeyUnknown
+	}
+	sealed, err := encoding.NewSealed(key, data)
+	if err != nil {
+		return err
+	}
+	return p.mailbox.Deposit(receiver, sealed.Pack())
+}
+
+//peerOffline `receiver`不在线,或者探测以后一直没有答复
+func (p *PhotonProtocol) peerOffline(receiver common.Address) bool {
+	if _, isOnline := p.Transport.NodeStatus(receiver); !isOnline {
+		return true
+	}
+	pp := p.presence.presence(receiver, time.Now())
+	return pp != nil && !pp.Reachable
+}
+
+//fetchMailbox 取回信箱中的消息交给receive处理,只接受加密的消息
+func (p *PhotonProtocol) fetchMailbox() error {
+	msgs, err := p.mailbox.Fetch()
+	if err != nil || len(msgs) == 0 {
+		return err
+	}
+	var through uint64
+	for _, m := range msgs {
+		if m.ID > through {
+			through = m.ID
+		}
+		if len(m.Data) == 0 || m.Data[0] != encoding.SealedCmdID {
+			p.log.Warn(fmt.Sprintf("ignore unsealed mailbox message %d", m.ID))
+			continue
+		}
+		p.receive(m.Data)
+	}
+	p.log.Info(fmt.Sprintf("fetch %d messages from mailbox", len(msgs)))
+	return p.mailbox.Ack(through)
+}
+
+//pollMailbox 启动以后立即取一次,然后每隔params.MailboxPollInterval取一次
+func (p *PhotonProtocol) pollMailbox() {
+	if p.mailbox == nil {
+		return
+	}
+	for {
+		err := p.fetchMailbox()
+		if err != nil {
+			p.log.Warn(fmt.Sprintf("fetch mailbox err %s", err))
+		}
+		select {
+		case <-time.After(params.MailboxPollInterval):
+		case <-p.quitChan:
+			return
+		}
+	}
+}
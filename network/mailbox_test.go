@@ -0,0 +1,96 @@
+package network
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+//testMailbox 信箱服务的最简单实现,只用于测试
+type testMailbox struct {
+	lock   sync.Mutex
+	nextID uint64
+	boxes  map[common.Address][]*MailboxMessage
+}
+
+func (tm *testMailbox) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tm.lock.Lock()
+	defer tm.lock.Unlock()
+	addr := common.HexToAddress(strings.TrimPrefix(r.URL.Path, "/mailbox/"))
+	if r.Method == http.MethodPost {
+		data, _ := ioutil.ReadAll(r.Body)
+		tm.nextID++
+		tm.boxes[addr] = append(tm.boxes[addr], &MailboxMessage{ID: tm.nextID, Data: data})
+		return
+	}
+	ts, _ := strconv.ParseInt(r.Header.Get("X-Photon-Time"), 10, 64)
+	sig, _ := hex.DecodeString(r.Header.Get("X-Photon-Signature"))
+	hash := MailboxAuthHash(addr, ts)
+	pub, err := crypto.SigToPub(hash[:], sig)
+	if err != nil || crypto.PubkeyToAddress(*pub) != addr {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(&mailboxMessages{tm.boxes[addr]})
+	case http.MethodDelete:
+		through, _ := strconv.ParseUint(r.URL.Query().Get("through"), 10, 64)
+		var left []*MailboxMessage
+		for _, m := range tm.boxes[addr] {
+			if m.ID > through {
+				left = append(left, m)
+			}
+		}
+		tm.boxes[addr] = left
+	}
+}
+
+func TestMailbox(t *testing.T) {
+	server := httptest.NewServer(&testMailbox{boxes: make(map[common.Address][]*MailboxMessage)})
+	defer server.Close()
+	key1, _ := crypto.GenerateKey()
+	key2, _ := crypto.GenerateKey()
+	p1 := NewPhotonProtocol(MakeTestUDPTransport("p1", randomPort()), key1, &testChannelStatusGetter{})
+	p2 := NewPhotonProtocol(MakeTestUDPTransport("p2", randomPort()), key2, &testChannelStatusGetter{})
+	p1.SetMailbox(NewMailboxClient(server.URL+"/", key1))
+	p2.SetMailbox(NewMailboxClient(server.URL, key2))
+	ping := encoding.NewPing(3)
+	err := ping.Sign(key1, ping)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	//不知道对方公钥时无法加密
+	assert.Equal(t, errPeerKeyUnknown, p1.depositToMailbox(p2.nodeAddr, ping.Pack()))
+	pong := encoding.NewPing(4)
+	err = pong.Sign(key2, pong)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	p1.learnPeerKey(p2.nodeAddr, pong.Pack())
+	assert.Nil(t, p1.depositToMailbox(p2.nodeAddr, ping.Pack()))
+	//别人无法取回p2的消息
+	_, err = (&MailboxClient{url: server.URL, key: key1, node: p2.nodeAddr, client: http.DefaultClient}).Fetch()
+	assert.NotNil(t, err)
+	assert.Nil(t, p2.fetchMailbox())
+	data := <-p2.receiveChan
+	plain, err := p2.openFrame(data)
+	assert.Nil(t, err)
+	assert.EqualValues(t, ping.Pack(), plain)
+	msgs, err := p2.mailbox.Fetch()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(msgs))
+}
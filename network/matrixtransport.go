@@ -641,8 +641,10 @@ func (m *MatrixTransport) doHandleReceiveMessage(job *matrixJob) {
 		3. message during my disconnection
 		todo fixme use better message filter
 	*/
-	if time.Now().Sub(msgTime) > time.Second*15 { //测试发现最新的消息（确定）的时间戳最高延迟是42分钟
-		m.log.Trace(fmt.Sprintf("ignore message because of it's too early, now=%s,msgtime=%s,event=%s", time.Now(), msgTime, utils.StringInterface(event, 5)))
+	//消息的时间戳来自服务器,本机时钟不准时使用修正以后的时间比较
+	now := utils.TrustedNow()
+	if now.Sub(msgTime) > time.Second*15 { //测试发现最新的消息（确定）的时间戳最高延迟是42分钟
+		m.log.Trace(fmt.Sprintf("ignore message because of it's too early, now=%s,msgtime=%s,event=%s", now, msgTime, utils.StringInterface(event, 5)))
 		return
 	}
 	if m.stopreceiving || event.Type != "m.room.message" {
@@ -1650,7 +1652,7 @@ func (m *MatrixTransport) isUseLessRoom(r *gomatrix.Room) bool {
 	//临时通道还是固定通道
 	if isChannel == networkPartNoChannel {
 		//最近一天没有任何活动
-		if getRoomLastestActiveTime(r).Add(time.Hour * 24).Before(time.Now()) {
+		if getRoomLastestActiveTime(r).Add(time.Hour * 24).Before(utils.TrustedNow()) {
 			return true
 		}
 	}
@@ -1658,7 +1660,7 @@ func (m *MatrixTransport) isUseLessRoom(r *gomatrix.Room) bool {
 	return false
 }
 func getRoomLastestActiveTime(r *gomatrix.Room) time.Time {
-	t := time.Now().Add(time.Hour * (-24)) //最早认为是一天前,再早的活动就忽略
+	t := utils.TrustedNow().Add(time.Hour * (-24)) //最早认为是一天前,再早的活动就忽略
 	for _, events := range r.State {
 		for _, e := range events {
 			msgTime := time.Unix(e.Timestamp/1000, 0)
@@ -49,17 +49,17 @@ func (db *MockDb) XMPPMarkAddrSubed(addr common.Address) {
 func (db *MockDb) GetChannelList(token, partner common.Address) (cs []*channeltype.Serialization, err error) {
 	return db.channels, nil
 }
-func (db *MockDb) RegisterNewChannelCallback(f cb.ChannelCb) {
-
+func (db *MockDb) RegisterNewChannelCallback(f cb.ChannelCb) (id cb.ID) {
+	return
 }
-func (db *MockDb) RegisterChannelStateCallback(f cb.ChannelCb) {
-
+func (db *MockDb) RegisterChannelStateCallback(f cb.ChannelCb) (id cb.ID) {
+	return
 }
 func (db *MockDb) XMPPUnMarkAddr(addr common.Address) {
 
 }
-func (db *MockDb) RegisterChannelSettleCallback(f cb.ChannelCb) {
-
+func (db *MockDb) RegisterChannelSettleCallback(f cb.ChannelCb) (id cb.ID) {
+	return
 }
 func init() {
 	var err error
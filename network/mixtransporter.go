@@ -116,6 +116,11 @@ func (t *MixTransport) NodeStatus(addr common.Address) (deviceType string, isOnl
 	return t.xmpp.NodeStatus(addr)
 }
 
+//RegisterNodeAddressListener implements NodeAddressNotifier, only udp notifies address changes
+func (t *MixTransport) RegisterNodeAddressListener(l NodeAddressListener) {
+	t.udp.RegisterNodeAddressListener(l)
+}
+
 //GetNotify notification of connection status change
 func (t *MixTransport) GetNotify() (notify <-chan netshare.Status, err error) {
 	//if t.xmpp.conn != nil {
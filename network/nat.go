@@ -0,0 +1,184 @@
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/p2p/nat"
+)
+
+/*
+两个在NAT后面的节点直接用udp通信:
+1. 通过UPnP/NAT-PMP在路由器上映射udp端口,或者用extip指定外网ip,得到自己在公网上的地址
+2. 通过中继(xmpp/matrix)把这个地址用UDPEndpoint告诉对方
+3. 双方同时向对方的地址发送打洞包,收到对方的打洞包以后就知道通路已经打开,以后的消息直接走udp
+*/
+
+//punchMagic 打洞包的前缀,后面是发送方的地址,不交给protocol处理
+var punchMagic = []byte("photon-punch")
+
+const (
+	punchTimes    = 5
+	punchInterval = 200 * time.Millisecond
+	//同一个节点一分钟内只告诉一次,避免双方互相答复
+	endpointAnnounceInterval = time.Minute
+)
+
+//startPortMapping 按照params.NAT在路由器上映射监听的端口,并查询外网ip
+func (ut *UDPTransport) startPortMapping() error {
+	m, err := nat.Parse(params.NAT)
+	if err != nil || m == nil {
+		return err
+	}
+	ut.natQuit = make(chan struct{})
+	port := ut.UAddr.Port
+	go nat.Map(m, ut.natQuit, "udp", port, port, "photon udp")
+	go func() {
+		ip, err := m.ExternalIP()
+		if err != nil {
+			ut.log.Warn(fmt.Sprintf("query external ip by %s err %s", m, err))
+			return
+		}
+		ut.lock.Lock()
+		ut.externalAddr = &net.UDPAddr{IP: ip, Port: port}
+		ut.lock.Unlock()
+		ut.log.Info(fmt.Sprintf("udp external address %s", ut.externalAddr))
+	}()
+	return nil
+}
+
+//ExternalAddr 自己在公网上的udp地址,没有端口映射或者还没有查询到时返回nil
+func (ut *UDPTransport) ExternalAddr() *net.UDPAddr {
+	ut.lock.RLock()
+	defer ut.lock.RUnlock()
+	return ut.externalAddr
+}
+
+//Punch 向`addr`的公网地址`ua`发送打洞包,对方同时也在向我们打洞
+func (ut *UDPTransport) Punch(addr common.Address, ua *net.UDPAddr) {
+	ut.lock.Lock()
+	ut.punchCandidates[addr] = ua
+	ut.lock.Unlock()
+	go func() {
+		for i := 0; i < punchTimes; i++ {
+			if ut.stopped {
+				return
+			}
+			if _, isOnline := ut.NodeStatus(addr); isOnline {
+				return
+			}
+			ut.sendPunch(ua)
+			time.Sleep(punchInterval)
+		}
+	}()
+}
+
+func (ut *UDPTransport) sendPunch(ua *net.UDPAddr) {
+	if ut.conn == nil {
+		return
+	}
+	name := common.HexToAddress(ut.name)
+	_, err := ut.conn.WriteToUDP(append(append([]byte{}, punchMagic...), name[:]...), ua)
+	if err != nil {
+		ut.log.Trace(fmt.Sprintf("send punch to %s err %s", ua, err))
+	}
+}
+
+/*
+receivePunch 收到打洞包,说明和对方之间的通路已经打开,以后直接发往来源地址(NAT可能改变了端口).
+只接受我们正在打洞的节点,而且来源ip必须和它告诉我们的一致
+*/
+func (ut *UDPTransport) receivePunch(data []byte, remoteAddr *net.UDPAddr) bool {
+	if len(data) != len(punchMagic)+common.AddressLength || !bytes.HasPrefix(data, punchMagic) {
+		return false
+	}
+	sender := common.BytesToAddress(data[len(punchMagic):])
+	ut.lock.Lock()
+	ua, ok := ut.punchCandidates[sender]
+	if !ok || !ua.IP.Equal(remoteAddr.IP) {
+		ut.lock.Unlock()
+		ut.log.Trace(fmt.Sprintf("ignore unexpected punch from %s", remoteAddr))
+		return true
+	}
+	_, alreadyConnected := ut.intranetNodes[sender]
+	ua = &net.UDPAddr{IP: remoteAddr.IP, Port: remoteAddr.Port}
+	ut.intranetNodes[sender] = ua
+	ut.lock.Unlock()
+	if !alreadyConnected {
+		ut.notifyAddressChanged([]nodeAddressChange{{sender, ua, true}})
+		ut.log.Info(fmt.Sprintf("udp hole punched to %s at %s", utils.APex2(sender), remoteAddr))
+		//对方可能还没有收到我们的打洞包
+		ut.sendPunch(remoteAddr)
+	}
+	return true
+}
+
+//shouldAnnounce 没有直接通路,而且最近没有告诉过`addr`时返回true
+func (ut *UDPTransport) shouldAnnounce(addr common.Address) bool {
+	ut.lock.Lock()
+	defer ut.lock.Unlock()
+	if ut.externalAddr == nil {
+		return false
+	}
+	if _, ok := ut.intranetNodes[addr]; ok {
+		return false
+	}
+	if time.Since(ut.endpointAnnounced[addr]) < endpointAnnounceInterval {
+		return false
+	}
+	ut.endpointAnnounced[addr] = time.Now()
+	return true
+}
+
+//udpTransport 返回正在使用的UDPTransport,没有使用udp时返回nil
+func (p *PhotonProtocol) udpTransport() *UDPTransport {
+	switch t := p.Transport.(type) {
+	case *UDPTransport:
+		return t
+	case *MixTransport:
+		return t.udp
+	case *MatrixMixTransport:
+		return t.udp
+	case *PriorityTransport:
+		ut, _ := t.Transport("udp").(*UDPTransport)
+		return ut
+	}
+	return nil
+}
+
+/*
+announceUDPEndpoint 还没有和`receiver`建立直接的udp通路时,通过中继把自己的公网地址告诉对方.
+没有端口映射时什么也不做
+*/
+func (p *PhotonProtocol) announceUDPEndpoint(receiver common.Address) {
+	ut := p.udpTransport()
+	if ut == nil || !ut.shouldAnnounce(receiver) {
+		return
+	}
+	ext := ut.ExternalAddr()
+	m := encoding.NewUDPEndpoint(ext.IP, ext.Port)
+	err := m.Sign(p.privKey, m)
+	if err == nil {
+		err = p.sendRawWitNoAck(receiver, m.Pack())
+	}
+	if err != nil {
+		p.log.Info(fmt.Sprintf("announce udp endpoint to %s err %s", utils.APex2(receiver), err))
+	}
+}
+
+//onUDPEndpoint 向对方的公网地址打洞,对方可能还不知道我们的地址
+func (p *PhotonProtocol) onUDPEndpoint(m *encoding.UDPEndpoint) {
+	ut := p.udpTransport()
+	if ut == nil || m.Port == 0 || m.IP.IsUnspecified() {
+		return
+	}
+	p.log.Debug(fmt.Sprintf("receive %s", m))
+	ut.Punch(m.Sender, &net.UDPAddr{IP: m.IP, Port: int(m.Port)})
+	p.announceUDPEndpoint(m.Sender)
+}
@@ -0,0 +1,52 @@
+package network
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUDPTransportPunch(t *testing.T) {
+	params.EnableMDNS = false
+	defer func() {
+		params.EnableMDNS = true
+	}()
+	key1, _ := crypto.GenerateKey()
+	key2, _ := crypto.GenerateKey()
+	addr1 := crypto.PubkeyToAddress(key1.PublicKey)
+	addr2 := crypto.PubkeyToAddress(key2.PublicKey)
+	port1, port2 := randomPort(), randomPort()+1000
+	t1, err := NewUDPTransport(addr1.String(), "127.0.0.1", port1, nil, NewTokenBucket(10, 2, time.Now))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	t2, err := NewUDPTransport(addr2.String(), "127.0.0.1", port2, nil, NewTokenBucket(10, 2, time.Now))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	t1.Start()
+	t2.Start()
+	defer t1.Stop()
+	defer t2.Stop()
+	time.Sleep(time.Millisecond * 100)
+	localhost := net.ParseIP("127.0.0.1")
+	//冒充的打洞包不会建立通路
+	t1.Punch(common.HexToAddress("0x1"), &net.UDPAddr{IP: localhost, Port: port2})
+	time.Sleep(time.Millisecond * 300)
+	_, isOnline := t2.NodeStatus(addr1)
+	assert.False(t, isOnline)
+	t2.Punch(addr1, &net.UDPAddr{IP: localhost, Port: port1})
+	t1.Punch(addr2, &net.UDPAddr{IP: localhost, Port: port2})
+	time.Sleep(time.Millisecond * 500)
+	_, isOnline = t1.NodeStatus(addr2)
+	assert.True(t, isOnline)
+	_, isOnline = t2.NodeStatus(addr1)
+	assert.True(t, isOnline)
+}
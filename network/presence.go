@@ -0,0 +1,154 @@
+package network
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+PeerPresence 某个节点的可达性,只保存在内存中,重启后清零.
+每次收到对方的消息(包括Ack)都会更新LastSeen,Ping和需要Ack的消息都算作一次探测,
+探测以后超过params.PeerUnreachableTimeout还没有收到对方的任何消息,就认为无法到达.
+*/
+type PeerPresence struct {
+	Address   common.Address `json:"address"`
+	LastSeen  int64          `json:"last_seen"`        //最后一次收到对方消息的时间
+	LastProbe int64          `json:"last_probe"`       //最后一次ping或者发送消息的时间
+	RTT       int64          `json:"rtt_ms,omitempty"` //最后一次PingAndWait的往返时间
+	Reachable bool           `json:"reachable"`
+	//收到对方消息以后第一次探测的时间,为零表示没有未答复的探测
+	pendingSince time.Time
+	lastProbe    time.Time
+}
+
+/*
+reachable 没有未答复的探测,或者等待还没有超时时认为可以到达.
+最后一次探测超过params.PeerUnreachableExpire以后不再认为无法到达,这样路由会重新尝试这个节点
+*/
+func (pp *PeerPresence) reachable(now time.Time) bool {
+	if pp.pendingSince.IsZero() {
+		return true
+	}
+	return now.Sub(pp.pendingSince) < params.PeerUnreachableTimeout || now.Sub(pp.lastProbe) > params.PeerUnreachableExpire
+}
+
+type presenceTracker struct {
+	lock  sync.Mutex
+	peers map[common.Address]*PeerPresence
+}
+
+func newPresenceTracker() *presenceTracker {
+	return &presenceTracker{
+		peers: make(map[common.Address]*PeerPresence),
+	}
+}
+
+func (pt *presenceTracker) get(addr common.Address) *PeerPresence {
+	pp, ok := pt.peers[addr]
+	if !ok {
+		pp = &PeerPresence{Address: addr}
+		pt.peers[addr] = pp
+	}
+	return pp
+}
+
+//seen 收到了`addr`的消息
+func (pt *presenceTracker) seen(addr common.Address, now time.Time) {
+	pt.lock.Lock()
+	defer pt.lock.Unlock()
+	pp := pt.get(addr)
+	pp.LastSeen = now.Unix()
+	pp.pendingSince = time.Time{}
+}
+
+//reset 对方在某个transport上重新上线,之前未答复的探测不再算数
+func (pt *presenceTracker) reset(addr common.Address) {
+	pt.lock.Lock()
+	defer pt.lock.Unlock()
+	if pp, ok := pt.peers[addr]; ok {
+		pp.pendingSince = time.Time{}
+	}
+}
+
+//probed 向`addr`发送了ping或者需要Ack的消息
+func (pt *presenceTracker) probed(addr common.Address, now time.Time) {
+	pt.lock.Lock()
+	defer pt.lock.Unlock()
+	pp := pt.get(addr)
+	pp.LastProbe = now.Unix()
+	pp.lastProbe = now
+	if pp.pendingSince.IsZero() {
+		pp.pendingSince = now
+	}
+}
+
+func (pt *presenceTracker) setRTT(addr common.Address, rtt time.Duration) {
+	pt.lock.Lock()
+	defer pt.lock.Unlock()
+	pt.get(addr).RTT = int64(rtt / time.Millisecond)
+}
+
+//presence 没有和`addr`通信过时返回nil
+func (pt *presenceTracker) presence(addr common.Address, now time.Time) *PeerPresence {
+	pt.lock.Lock()
+	defer pt.lock.Unlock()
+	pp, ok := pt.peers[addr]
+	if !ok {
+		return nil
+	}
+	pp2 := *pp
+	pp2.Reachable = pp.reachable(now)
+	return &pp2
+}
+
+func (pt *presenceTracker) unreachable(now time.Time) map[common.Address]bool {
+	pt.lock.Lock()
+	defer pt.lock.Unlock()
+	m := make(map[common.Address]bool)
+	for addr, pp := range pt.peers {
+		if !pp.reachable(now) {
+			m[addr] = true
+		}
+	}
+	return m
+}
+
+//snapshot 返回所有节点可达性的拷贝,避免外部修改
+func (pt *presenceTracker) snapshot(now time.Time) (peers []*PeerPresence) {
+	pt.lock.Lock()
+	defer pt.lock.Unlock()
+	for _, pp := range pt.peers {
+		pp2 := *pp
+		pp2.Reachable = pp.reachable(now)
+		peers = append(peers, &pp2)
+	}
+	return
+}
+
+//PeerPresence 返回`addr`的可达性,没有和它通信过时返回nil
+func (p *PhotonProtocol) PeerPresence(addr common.Address) *PeerPresence {
+	return p.presence.presence(addr, time.Now())
+}
+
+//PeersPresence 返回所有通信过的节点的可达性
+func (p *PhotonProtocol) PeersPresence() []*PeerPresence {
+	return p.presence.snapshot(time.Now())
+}
+
+//NodeAddressChanged implements NodeAddressListener, 节点重新上线以后不再避开它
+func (p *PhotonProtocol) NodeAddressChanged(addr common.Address, transport string, endpoint string, isOnline bool) {
+	p.log.Debug(fmt.Sprintf("node %s on %s changed to %s, online=%v", utils.APex2(addr), transport, endpoint, isOnline))
+	if isOnline {
+		p.presence.reset(addr)
+	}
+}
+
+//UnreachablePeers 返回当前认为无法到达的节点,路由时应该避开它们
+func (p *PhotonProtocol) UnreachablePeers() map[common.Address]bool {
+	return p.presence.unreachable(time.Now())
+}
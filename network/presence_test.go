@@ -0,0 +1,40 @@
+package network
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPresenceTracker(t *testing.T) {
+	pt := newPresenceTracker()
+	addr := utils.NewRandomAddress()
+	now := time.Now()
+	assert.Nil(t, pt.presence(addr, now))
+	pt.probed(addr, now)
+	assert.True(t, pt.presence(addr, now).Reachable)
+	//一直没有答复
+	now = now.Add(params.PeerUnreachableTimeout / 2)
+	pt.probed(addr, now)
+	assert.True(t, pt.presence(addr, now).Reachable)
+	now = now.Add(params.PeerUnreachableTimeout)
+	pt.probed(addr, now)
+	assert.False(t, pt.presence(addr, now).Reachable)
+	assert.True(t, pt.unreachable(now)[addr])
+	//收到任何消息以后恢复
+	pt.seen(addr, now)
+	pp := pt.presence(addr, now)
+	assert.True(t, pp.Reachable)
+	assert.EqualValues(t, now.Unix(), pp.LastSeen)
+	assert.Len(t, pt.unreachable(now), 0)
+	//很久没有探测以后不再避开
+	pt.probed(addr, now)
+	now = now.Add(params.PeerUnreachableTimeout)
+	assert.False(t, pt.presence(addr, now).Reachable)
+	now = now.Add(params.PeerUnreachableExpire)
+	assert.True(t, pt.presence(addr, now).Reachable)
+	assert.Len(t, pt.snapshot(now), 1)
+}
@@ -0,0 +1,224 @@
+package network
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/network/netshare"
+	"github.com/SmartMeshFoundation/Photon/network/xmpptransport"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+TransportFactory 创建一种transport,`name`是节点地址.
+新的transport实现通过RegisterTransport注册以后,就可以在--transports中选择
+*/
+type TransportFactory func(name string, key *ecdsa.PrivateKey, cfg *params.Config) (Transporter, error)
+
+var transportFactories = map[string]TransportFactory{
+	"udp": func(name string, key *ecdsa.PrivateKey, cfg *params.Config) (Transporter, error) {
+		return NewUDPTransport(name, cfg.Host, cfg.Port, nil, NewTokenBucket(10, 1, time.Now))
+	},
+	"xmpp": func(name string, key *ecdsa.PrivateKey, cfg *params.Config) (Transporter, error) {
+		return NewXMPPTransport(name, cfg.XMPPServer, key, deviceType()), nil
+	},
+	"matrix": func(name string, key *ecdsa.PrivateKey, cfg *params.Config) (Transporter, error) {
+		return NewMatrixTransport(name, key, deviceType(), params.MatrixServerConfig), nil
+	},
+}
+
+func deviceType() string {
+	if params.MobileMode {
+		return DeviceTypeMobile
+	}
+	return DeviceTypeOther
+}
+
+//RegisterTransport 注册一种transport实现,已经存在的同名实现会被替换
+func RegisterTransport(kind string, factory TransportFactory) {
+	transportFactories[kind] = factory
+}
+
+/*
+NewTransport 按照`kinds`的顺序创建transport,只有一种时直接返回,多种时组合成PriorityTransport,排在前面的优先使用
+*/
+func NewTransport(kinds []string, name string, key *ecdsa.PrivateKey, cfg *params.Config) (Transporter, error) {
+	if len(kinds) == 0 {
+		return nil, errors.New("no transport")
+	}
+	var transports []Transporter
+	for i, kind := range kinds {
+		factory, ok := transportFactories[kind]
+		if !ok {
+			return nil, fmt.Errorf("unknown transport %s", kind)
+		}
+		for _, k := range kinds[:i] {
+			if k == kind {
+				return nil, fmt.Errorf("duplicate transport %s", kind)
+			}
+		}
+		t, err := factory(name, key, cfg)
+		if err != nil {
+			return nil, err
+		}
+		transports = append(transports, t)
+	}
+	if len(transports) == 1 {
+		return transports[0], nil
+	}
+	return NewPriorityTransport(kinds, transports), nil
+}
+
+/*
+PriorityTransport 同时使用多个Transporter,发送时按照优先级选择对方在线的transport,失败以后尝试下一个.
+对方在哪个transport上都不在线时,依次尝试所有transport,中继服务器可能会保存离线消息
+*/
+type PriorityTransport struct {
+	kinds      []string
+	transports []Transporter
+}
+
+//NewPriorityTransport `transports`按照优先级从高到低排列,`kinds`是它们的名字
+func NewPriorityTransport(kinds []string, transports []Transporter) *PriorityTransport {
+	return &PriorityTransport{
+		kinds:      kinds,
+		transports: transports,
+	}
+}
+
+//Send message by the first transport on which the receiver is online
+func (t *PriorityTransport) Send(receiver common.Address, data []byte) (err error) {
+	tried := make([]bool, len(t.transports))
+	for i, tr := range t.transports {
+		if _, isOnline := tr.NodeStatus(receiver); !isOnline {
+			continue
+		}
+		tried[i] = true
+		err = tr.Send(receiver, data)
+		if err == nil {
+			return nil
+		}
+		log.Warn(fmt.Sprintf("%s send to %s err %s, try next transport", t.kinds[i], utils.APex2(receiver), err))
+	}
+	for i, tr := range t.transports {
+		if tried[i] {
+			continue
+		}
+		err = tr.Send(receiver, data)
+		if err == nil {
+			return nil
+		}
+	}
+	return
+}
+
+//Start all the transports
+func (t *PriorityTransport) Start() {
+	for _, tr := range t.transports {
+		tr.Start()
+	}
+}
+
+//Stop all the transports
+func (t *PriorityTransport) Stop() {
+	for _, tr := range t.transports {
+		tr.Stop()
+	}
+}
+
+//StopAccepting stops receiving for all the transports
+func (t *PriorityTransport) StopAccepting() {
+	for _, tr := range t.transports {
+		tr.StopAccepting()
+	}
+}
+
+//RegisterProtocol register receiver for all the transports
+func (t *PriorityTransport) RegisterProtocol(protcol ProtocolReceiver) {
+	for _, tr := range t.transports {
+		tr.RegisterProtocol(protcol)
+	}
+}
+
+//NodeStatus returns the status on the first transport on which the node is online
+func (t *PriorityTransport) NodeStatus(addr common.Address) (deviceType string, isOnline bool) {
+	for _, tr := range t.transports {
+		deviceType, isOnline = tr.NodeStatus(addr)
+		if isOnline {
+			return
+		}
+	}
+	return
+}
+
+//RegisterNodeAddressListener register `l` to all the transports which can notify address changes
+func (t *PriorityTransport) RegisterNodeAddressListener(l NodeAddressListener) {
+	for _, tr := range t.transports {
+		if n, ok := tr.(NodeAddressNotifier); ok {
+			n.RegisterNodeAddressListener(l)
+		}
+	}
+}
+
+//Transport returns the transport named `kind`, nil if not used
+func (t *PriorityTransport) Transport(kind string) Transporter {
+	for i, k := range t.kinds {
+		if k == kind {
+			return t.transports[i]
+		}
+	}
+	return nil
+}
+
+//String returns the names of the transports by priority
+func (t *PriorityTransport) String() string {
+	return strings.Join(t.kinds, "-")
+}
+
+//GetNotify notification of connection status change of the first relay transport
+func (t *PriorityTransport) GetNotify() (notify <-chan netshare.Status, err error) {
+	for _, tr := range t.transports {
+		switch tr2 := tr.(type) {
+		case *XMPPTransport:
+			return tr2.statusChan, nil
+		case *MatrixTransport:
+			return tr2.statusChan, nil
+		}
+	}
+	return nil, errors.New("no relay transport")
+}
+
+//SetMatrixDB must be called before start if matrix is used
+func (t *PriorityTransport) SetMatrixDB(db xmpptransport.XMPPDb) error {
+	if m, ok := t.Transport("matrix").(*MatrixTransport); ok {
+		m.setDB(db)
+	}
+	return nil
+}
+
+// Reconnect xmpp if used
+func (t *PriorityTransport) Reconnect() {
+	x, ok := t.Transport("xmpp").(*XMPPTransport)
+	if !ok || x.conn == nil {
+		return
+	}
+	x.conn.Reconnect()
+}
+
+//SubscribeNeighbor get the status change notification of partner node if xmpp is used
+func (t *PriorityTransport) SubscribeNeighbor(db xmpptransport.XMPPDb) error {
+	x, ok := t.Transport("xmpp").(*XMPPTransport)
+	if !ok {
+		return nil
+	}
+	if x.conn == nil {
+		return fmt.Errorf("try to subscribe neighbor,but xmpp connection is disconnected")
+	}
+	return x.conn.CollectNeighbors(db)
+}
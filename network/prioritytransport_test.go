@@ -0,0 +1,76 @@
+package network
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeTransport struct {
+	online  bool
+	sendErr error
+	sent    int
+}
+
+func (f *fakeTransport) Send(receiver common.Address, data []byte) error {
+	f.sent++
+	return f.sendErr
+}
+func (f *fakeTransport) Start()                            {}
+func (f *fakeTransport) Stop()                             {}
+func (f *fakeTransport) StopAccepting()                    {}
+func (f *fakeTransport) RegisterProtocol(ProtocolReceiver) {}
+func (f *fakeTransport) NodeStatus(addr common.Address) (deviceType string, isOnline bool) {
+	return DeviceTypeOther, f.online
+}
+
+func TestNewTransport(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	cfg := &params.Config{}
+	_, err := NewTransport(nil, "a", key, cfg)
+	assert.NotNil(t, err)
+	_, err = NewTransport([]string{"unknown"}, "a", key, cfg)
+	assert.NotNil(t, err)
+	RegisterTransport("fake1", func(name string, key2 *ecdsa.PrivateKey, cfg *params.Config) (Transporter, error) {
+		return &fakeTransport{}, nil
+	})
+	RegisterTransport("fake2", func(name string, key2 *ecdsa.PrivateKey, cfg *params.Config) (Transporter, error) {
+		return &fakeTransport{}, nil
+	})
+	defer delete(transportFactories, "fake1")
+	defer delete(transportFactories, "fake2")
+	_, err = NewTransport([]string{"fake1", "fake1"}, "a", key, cfg)
+	assert.NotNil(t, err)
+	tr, err := NewTransport([]string{"fake1"}, "a", key, cfg)
+	assert.Nil(t, err)
+	_, ok := tr.(*fakeTransport)
+	assert.True(t, ok)
+	tr, err = NewTransport([]string{"fake2", "fake1"}, "a", key, cfg)
+	assert.Nil(t, err)
+	pt, ok := tr.(*PriorityTransport)
+	assert.True(t, ok)
+	assert.Equal(t, "fake2-fake1", pt.String())
+}
+
+func TestPriorityTransportSend(t *testing.T) {
+	f1, f2 := &fakeTransport{}, &fakeTransport{online: true}
+	pt := NewPriorityTransport([]string{"f1", "f2"}, []Transporter{f1, f2})
+	//优先使用对方在线的transport
+	assert.Nil(t, pt.Send(common.Address{}, nil))
+	assert.Equal(t, 0, f1.sent)
+	assert.Equal(t, 1, f2.sent)
+	//失败以后尝试其他的
+	f2.sendErr = errors.New("fail")
+	assert.Nil(t, pt.Send(common.Address{}, nil))
+	assert.Equal(t, 1, f1.sent)
+	assert.Equal(t, 2, f2.sent)
+	f1.sendErr = errors.New("fail")
+	assert.NotNil(t, pt.Send(common.Address{}, nil))
+	_, isOnline := pt.NodeStatus(common.Address{})
+	assert.True(t, isOnline)
+}
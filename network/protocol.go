@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"sync"
+	"sync/atomic"
 
 	"errors"
 
@@ -38,12 +39,23 @@ type MessageToPhoton struct {
 	EchoHash common.Hash
 }
 
+/*
+DeliveredMessage 对方已经收到,但是还没有处理完的消息
+*/
+type DeliveredMessage struct {
+	Receiver common.Address
+	Msg      encoding.Messager
+}
+
 // SentMessageState is the state of message on sending
 type SentMessageState struct {
 	AsyncResult     *utils.AsyncResult
 	AckChannel      chan error
 	ReceiverAddress common.Address
 	Success         bool
+	//收到Delivered以后关闭DeliveredChannel,不再频繁重发
+	DeliveredChannel chan struct{}
+	Delivered        bool
 
 	Message  encoding.Messager //message to send
 	EchoHash common.Hash       //message echo hash
@@ -133,17 +145,31 @@ type PhotonProtocol struct {
 		this is a synchronized chan,reading  process message result from photon
 	*/
 	ReceivedMessageResultChan chan error
-	sendingChanMap            map[string]chan *SentMessageState //write to this channel to send a message
-	sendingQueueMap           map[string]*queueMessagesAndLock
-	receivedMessageSaver      ReceivedMessageSaver
-	ChannelStatusGetter       ChannelStatusGetter
-	onStop                    bool //flag for stop
+	/*
+		对方已经收到但是还没有处理完的消息,只用于通知,满了就丢弃
+	*/
+	DeliveredMessageChan chan *DeliveredMessage
+	sendingChanMap       map[string]chan *SentMessageState //write to this channel to send a message
+	sendingQueueMap      map[string]*queueMessagesAndLock
+	receivedMessageSaver ReceivedMessageSaver
+	ChannelStatusGetter  ChannelStatusGetter
+	onStop               bool //flag for stop
 	//notify quit
 	quitChan chan struct{}
 	//receive data
 	receiveChan chan []byte
 	log         log.Logger
 	isReceiving bool
+	//无法解析或者签名错误的消息个数,因为无法确定发送方,所以只能统计总数
+	invalidMessageCount int64
+	capture             *CaptureWriter //不为nil时记录收发的原始消息
+	//从签名中恢复的其他节点的公钥,用来加密发给它们的消息
+	peerKeys     map[common.Address]*ecdsa.PublicKey
+	peerKeysLock sync.RWMutex
+	presence     *presenceTracker //其他节点的可达性
+	rateLimiter  *rateLimiter     //按照发送方限制收到的消息
+	mailbox      *MailboxClient   //不为nil时,对方不在线的消息同时存放到它的信箱
+	sendGate     *sendGate        //按照优先级限制同时发送的消息
 }
 
 // NewPhotonProtocol create PhotonProtocol
@@ -156,15 +182,23 @@ func NewPhotonProtocol(transport Transporter, privKey *ecdsa.PrivateKey, channel
 		SentHashesToChannel:       make(map[common.Hash]*SentMessageState),
 		ReceivedMessageChan:       make(chan *MessageToPhoton),
 		ReceivedMessageResultChan: make(chan error),
+		DeliveredMessageChan:      make(chan *DeliveredMessage, 10),
 		sendingChanMap:            make(map[string]chan *SentMessageState),
 		sendingQueueMap:           make(map[string]*queueMessagesAndLock),
 		ChannelStatusGetter:       channelStatusGetter,
 		quitChan:                  make(chan struct{}),
 		receiveChan:               make(chan []byte, 200),
 		mapLock:                   sync.Mutex{},
+		peerKeys:                  make(map[common.Address]*ecdsa.PublicKey),
+		presence:                  newPresenceTracker(),
+		rateLimiter:               newRateLimiter(time.Now),
+		sendGate:                  newSendGate(params.SendConcurrency, time.Now),
 	}
 	rp.nodeAddr = crypto.PubkeyToAddress(privKey.PublicKey)
 	transport.RegisterProtocol(rp)
+	if n, ok := transport.(NodeAddressNotifier); ok {
+		n.RegisterNodeAddressListener(rp)
+	}
 	rp.log = log.New("name", utils.APex2(rp.nodeAddr))
 	return rp
 }
@@ -192,6 +226,14 @@ func (p *PhotonProtocol) sendAck(receiver common.Address, ack *encoding.Ack) {
 		log.Warn(fmt.Sprintf("sesendRawWitNoAck err %s ", err))
 	}
 }
+//sendDelivered 收到消息以后立即告诉对方已经送达,处理完以后再发Processed
+func (p *PhotonProtocol) sendDelivered(receiver common.Address, echohash common.Hash) {
+	err := p.sendRawWitNoAck(receiver, encoding.NewDelivered(p.nodeAddr, echohash).Pack())
+	if err != nil {
+		log.Warn(fmt.Sprintf("send Delivered err %s ", err))
+	}
+}
+
 func (p *PhotonProtocol) sendRawAck(receiver common.Address, data []byte) {
 	p.log.Trace(fmt.Sprintf("send to %s raw ack", utils.APex2(receiver)))
 	err := p.sendRawWitNoAck(receiver, data)
@@ -200,7 +242,47 @@ func (p *PhotonProtocol) sendRawAck(receiver common.Address, data []byte) {
 	}
 }
 func (p *PhotonProtocol) sendRawWitNoAck(receiver common.Address, data []byte) error {
-	return p.Transport.Send(receiver, data)
+	return p.sendRawWithPriority(receiver, data, framePriority(data[0]))
+}
+
+func (p *PhotonProtocol) sendRawWithPriority(receiver common.Address, data []byte, priority int) error {
+	if data[0] != encoding.UDPEndpointCmdID {
+		p.announceUDPEndpoint(receiver)
+	}
+	p.captureFrame(CaptureOutbound, receiver, data)
+	frame, err := p.sealFrame(receiver, data)
+	if err == errPeerKeyUnknown {
+		//先交换公钥,消息等下次重发
+		pingErr := p.SendPing(receiver)
+		if pingErr != nil {
+			return pingErr
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if !p.sendGate.acquire(priority, p.quitChan) {
+		return errTimeout
+	}
+	defer p.sendGate.release()
+	return p.Transport.Send(receiver, frame)
+}
+
+//SetCapture 把和指定节点之间收发的原始消息记录到capture中,必须在Start之前调用,StopAndWait时关闭
+func (p *PhotonProtocol) SetCapture(capture *CaptureWriter) {
+	p.capture = capture
+}
+
+//captureFrame 记录失败不影响消息的收发
+func (p *PhotonProtocol) captureFrame(direction CaptureDirection, peer common.Address, data []byte) {
+	if p.capture == nil {
+		return
+	}
+	err := p.capture.Write(direction, peer, data)
+	if err != nil {
+		p.log.Warn(fmt.Sprintf("capture %s message of %s err %s", direction, utils.APex2(peer), err))
+	}
 }
 
 // SendPing PingSender
@@ -211,9 +293,85 @@ func (p *PhotonProtocol) SendPing(receiver common.Address) error {
 		return err
 	}
 	data := ping.Pack()
+	p.presence.probed(receiver, time.Now())
 	return p.sendRawWitNoAck(receiver, data)
 }
 
+/*
+PingAndWait send a ping to receiver and wait for it's ack until timeout.
+unlike SendAndWait, the ping is sent only once and never retried, so it can be used to diagnose the connection to a node.
+`sent` is false when the ping cannot be handed to transport.
+*/
+func (p *PhotonProtocol) PingAndWait(receiver common.Address, timeout time.Duration) (rtt time.Duration, sent bool, err error) {
+	ping := encoding.NewPing(utils.NewRandomInt64())
+	err = ping.Sign(p.privKey, ping)
+	if err != nil {
+		return
+	}
+	rtt, sent, _, err = p.sendOnceAndWait(receiver, ping, timeout)
+	if err == nil {
+		p.presence.setRTT(receiver, rtt)
+	}
+	return
+}
+
+/*
+ProbeAndWait 和PingAndWait一样只发送一次,不重发,但是msg要交给对方的photon处理,处理成功才会收到Ack.
+`delivered`为true说明对方收到了消息,但是超时前没有处理成功
+*/
+func (p *PhotonProtocol) ProbeAndWait(receiver common.Address, msg encoding.SignedMessager, timeout time.Duration) (rtt time.Duration, delivered bool, err error) {
+	rtt, _, delivered, err = p.sendOnceAndWait(receiver, msg, timeout)
+	return
+}
+
+func (p *PhotonProtocol) sendOnceAndWait(receiver common.Address, msg encoding.SignedMessager, timeout time.Duration) (rtt time.Duration, sent, delivered bool, err error) {
+	data := msg.Pack()
+	echohash := utils.Sha3(data, receiver[:])
+	msgState := &SentMessageState{
+		AsyncResult:      utils.NewAsyncResult(),
+		ReceiverAddress:  receiver,
+		AckChannel:       make(chan error, 1),
+		DeliveredChannel: make(chan struct{}),
+		Message:          msg,
+		Data:             data,
+		EchoHash:         echohash,
+	}
+	p.mapLock.Lock()
+	p.SentHashesToChannel[echohash] = msgState
+	p.mapLock.Unlock()
+	defer func() {
+		p.mapLock.Lock()
+		delete(p.SentHashesToChannel, echohash)
+		p.mapLock.Unlock()
+	}()
+	start := time.Now()
+	p.presence.probed(receiver, start)
+	err = p.sendRawWitNoAck(receiver, data)
+	if err != nil {
+		return
+	}
+	sent = true
+	timeoutCh := time.After(timeout)
+	deliveredCh := msgState.DeliveredChannel
+	for {
+		select {
+		case <-msgState.AckChannel:
+			rtt = time.Since(start)
+			delivered = true
+			return
+		case <-deliveredCh:
+			delivered = true
+			deliveredCh = nil
+		case <-timeoutCh:
+			err = errTimeout
+			return
+		case <-p.quitChan:
+			err = errTimeout
+			return
+		}
+	}
+}
+
 /*
 	message mediatedTransfer  can safely be discarded when channel not exist only more
 	当channel被移除后,可以安全的移除待发送的消息,否则会导致新channel无法使用
@@ -311,6 +469,8 @@ func (p *PhotonProtocol) sendMessage(receiver common.Address, msgState *SentMess
 	p.log.Trace(fmt.Sprintf("send to %s,msg=%s, echohash=%s",
 		utils.APex2(msgState.ReceiverAddress), msgState.Message,
 		utils.HPex(msgState.EchoHash)))
+	delivered, isDelivered := msgState.DeliveredChannel, false
+	deposited := false
 	for {
 		if !p.messageCanBeSent(msgState.Message) {
 			msgState.AsyncResult.Result <- errExpired
@@ -320,41 +480,62 @@ func (p *PhotonProtocol) sendMessage(receiver common.Address, msgState *SentMess
 			return
 		}
 		nextTimeout := timeoutExponentialBackoff(p.retryTimes, p.retryInterval, p.retryInterval*10)
-		err := p.sendRawWitNoAck(receiver, msgState.Data)
+		p.presence.probed(receiver, time.Now())
+		err := p.sendRawWithPriority(receiver, msgState.Data, p.messagePriority(msgState.Message, msgState.Data))
 		if err != nil {
 			p.log.Info(fmt.Sprintf("sendRawWitNoAck msg echoHash=%s error %s", utils.HPex(msgState.EchoHash), err.Error()))
 		}
 		timeout := time.After(nextTimeout())
-		var ok bool
-		select {
-		case _, ok = <-msgState.AckChannel:
-			if ok {
-				p.log.Trace(fmt.Sprintf("msg=%s EchoHash=%s, sent success", encoding.MessageType(msgState.Message.Cmd()), utils.HPex(msgState.EchoHash)))
-				msgState.AsyncResult.Result <- nil
-				p.mapLock.Lock()
-				delete(p.SentHashesToChannel, msgState.EchoHash)
-				p.mapLock.Unlock()
-
-			} else {
-				p.log.Info(fmt.Sprintf("sendMessage EchoHash=%s stop retry, because of chan closed", utils.HPex(msgState.EchoHash)))
-			}
-			return
-		case <-timeout: //retry
-			// 如果是matrix且对方不在线,挂起并等待唤醒
-			_, isOnline := p.Transport.NodeStatus(receiver)
-			transport, ok1 := p.Transport.(*MatrixMixTransport)
-			if ok1 && !isOnline && transport != nil {
-				log.Warn(fmt.Sprintf("receiver %s is not online,sleep until when he back online", receiver.String()))
-				wakeUpChan := make(chan int)
-				// 向transport注册wakeUpChan
-				transport.RegisterWakeUpChan(receiver, wakeUpChan)
-				// 挂起并等待对方上线
-				<-wakeUpChan
-				// 继续发送并注销wakeUpChan
-				transport.UnRegisterWakeUpChan(receiver)
+		if isDelivered {
+			//对方已经收到,正在处理,重发只是为了防止Processed丢失
+			timeout = time.After(p.retryInterval * 10)
+		}
+		var ok, retry bool
+		for !retry {
+			select {
+			case _, ok = <-msgState.AckChannel:
+				if ok {
+					p.log.Trace(fmt.Sprintf("msg=%s EchoHash=%s, sent success", encoding.MessageType(msgState.Message.Cmd()), utils.HPex(msgState.EchoHash)))
+					msgState.AsyncResult.Result <- nil
+					p.mapLock.Lock()
+					delete(p.SentHashesToChannel, msgState.EchoHash)
+					p.mapLock.Unlock()
+
+				} else {
+					p.log.Info(fmt.Sprintf("sendMessage EchoHash=%s stop retry, because of chan closed", utils.HPex(msgState.EchoHash)))
+				}
+				return
+			case <-delivered:
+				p.log.Trace(fmt.Sprintf("msg=%s EchoHash=%s delivered, wait for processed", encoding.MessageType(msgState.Message.Cmd()), utils.HPex(msgState.EchoHash)))
+				delivered, isDelivered = nil, true
+				timeout = time.After(p.retryInterval * 10)
+			case <-timeout: //retry
+				retry = true
+				if p.mailbox != nil && !deposited && !isDelivered && p.peerOffline(receiver) {
+					err = p.depositToMailbox(receiver, msgState.Data)
+					if err != nil {
+						p.log.Info(fmt.Sprintf("deposit msg echoHash=%s to mailbox of %s err %s", utils.HPex(msgState.EchoHash), utils.APex2(receiver), err))
+					} else {
+						deposited = true
+						p.log.Trace(fmt.Sprintf("msg echoHash=%s deposited to mailbox of %s", utils.HPex(msgState.EchoHash), utils.APex2(receiver)))
+					}
+				}
+				// 如果是matrix且对方不在线,挂起并等待唤醒
+				_, isOnline := p.Transport.NodeStatus(receiver)
+				transport, ok1 := p.Transport.(*MatrixMixTransport)
+				if ok1 && !isOnline && transport != nil {
+					log.Warn(fmt.Sprintf("receiver %s is not online,sleep until when he back online", receiver.String()))
+					wakeUpChan := make(chan int)
+					// 向transport注册wakeUpChan
+					transport.RegisterWakeUpChan(receiver, wakeUpChan)
+					// 挂起并等待对方上线
+					<-wakeUpChan
+					// 继续发送并注销wakeUpChan
+					transport.UnRegisterWakeUpChan(receiver)
+				}
+			case <-p.quitChan:
+				return
 			}
-		case <-p.quitChan:
-			return
 		}
 	}
 }
@@ -419,10 +600,11 @@ because they sending same SecretRequest and RevealSecret,msg=%s`, msg))
 	msgState = &SentMessageState{
 		AsyncResult:     utils.NewAsyncResult(),
 		ReceiverAddress: receiver,
-		AckChannel:      make(chan error, 1),
-		Message:         msg,
-		Data:            data,
-		EchoHash:        echohash,
+		AckChannel:       make(chan error, 1),
+		DeliveredChannel: make(chan struct{}),
+		Message:          msg,
+		Data:             data,
+		EchoHash:         echohash,
 	}
 	p.SentHashesToChannel[echohash] = msgState
 	p.mapLock.Unlock()
@@ -472,6 +654,11 @@ func (p *PhotonProtocol) receive(data []byte) {
 	//p.log.Trace(fmt.Sprintf("receive complete l=%d", len(cdata)))
 }
 
+//InvalidMessageCount 返回收到的无法解析或者签名错误的消息个数
+func (p *PhotonProtocol) InvalidMessageCount() int64 {
+	return atomic.LoadInt64(&p.invalidMessageCount)
+}
+
 func (p *PhotonProtocol) loop() {
 	p.isReceiving = true
 	for {
@@ -485,6 +672,20 @@ func (p *PhotonProtocol) loop() {
 }
 
 func (p *PhotonProtocol) receiveInternal(data []byte) {
+	if len(data) > 0 && data[0] == encoding.SealedCmdID {
+		if !p.rateLimiter.allowSealed() {
+			p.log.Trace("drop sealed message, rate limit exceeded")
+			return
+		}
+		plain, err := p.openFrame(data)
+		if err != nil {
+			atomic.AddInt64(&p.invalidMessageCount, 1)
+			p.captureFrame(CaptureInbound, utils.EmptyAddress, data)
+			p.log.Warn(fmt.Sprintf("receive invalid sealed message %s", err))
+			return
+		}
+		data = plain
+	}
 	if len(data) > params.UDPMaxMessageSize {
 		p.log.Error("receive packet larger than maximum size :", len(data))
 		return
@@ -493,19 +694,34 @@ func (p *PhotonProtocol) receiveInternal(data []byte) {
 	if p.onStop {
 		return
 	}
-	cmdid := int(data[0])
-	messager, ok := encoding.MessageMap[cmdid]
-	if !ok {
-		p.log.Warn("receive unknown message:", hex.Dump(data))
+	messager, err := DecodeMessage(data)
+	if err != nil {
+		atomic.AddInt64(&p.invalidMessageCount, 1)
+		p.captureFrame(CaptureInbound, utils.EmptyAddress, data)
+		p.log.Warn(fmt.Sprintf("receive invalid message %s:\n%s", err, hex.Dump(data)))
 		return
 	}
-	messager = New(messager).(encoding.Messager)
-	err := messager.UnPack(data)
-	if err != nil {
-		p.log.Warn(fmt.Sprintf("message unpack error : %s", err))
+	_, signed := messager.(encoding.SignedMessager)
+	if !p.allowMessage(messageSender(messager), signed, len(data)) {
+		p.log.Trace(fmt.Sprintf("drop message %s from %s, rate limit exceeded", messager, utils.APex2(messageSender(messager))))
 		return
 	}
+	p.captureFrame(CaptureInbound, messageSender(messager), data)
+	if sender := messageSender(messager); sender != utils.EmptyAddress {
+		p.presence.seen(sender, time.Now())
+	}
+	if sm, ok := messager.(encoding.SignedMessager); ok {
+		p.learnPeerKey(sm.GetSender(), data)
+	}
 	echohash := utils.Sha3(data, p.nodeAddr[:])
+	if messager.Cmd() == encoding.UDPEndpointCmdID {
+		p.onUDPEndpoint(messager.(*encoding.UDPEndpoint))
+		return
+	}
+	if messager.Cmd() == encoding.DeliveredCmdID {
+		p.onDelivered(messager.(*encoding.Delivered))
+		return
+	}
 	if p.receivedMessageSaver != nil && messager.Cmd() != encoding.AckCmdID {
 		ackdata := p.receivedMessageSaver.GetAck(echohash)
 		if len(ackdata) > 0 {
@@ -541,6 +757,7 @@ func (p *PhotonProtocol) receiveInternal(data []byte) {
 		if messager.Cmd() == encoding.PingCmdID { //send ack
 			p.sendAck(signedMessager.GetSender(), p.CreateAck(echohash))
 		} else {
+			p.sendDelivered(signedMessager.GetSender(), echohash)
 			//send message to photon ,and wait result
 			p.log.Trace(fmt.Sprintf("protocol send message to photon... %s", signedMessager))
 			p.ReceivedMessageChan <- &MessageToPhoton{signedMessager, echohash}
@@ -566,6 +783,26 @@ func (p *PhotonProtocol) receiveInternal(data []byte) {
 
 }
 
+/*
+onDelivered 对方收到了消息,还没有处理完,通知发送的goroutine降低重发频率,重复的Delivered直接忽略
+*/
+func (p *PhotonProtocol) onDelivered(d *encoding.Delivered) {
+	p.log.Debug(fmt.Sprintf("receive delivered ,EchoHash=%s", utils.HPex(d.Echo)))
+	p.mapLock.Lock()
+	defer p.mapLock.Unlock()
+	msgState, ok := p.SentHashesToChannel[d.Echo]
+	if !ok || msgState.Success || msgState.Delivered || msgState.DeliveredChannel == nil {
+		return
+	}
+	msgState.Delivered = true
+	close(msgState.DeliveredChannel)
+	select {
+	case p.DeliveredMessageChan <- &DeliveredMessage{msgState.ReceiverAddress, msgState.Message}:
+	default:
+		//never block
+	}
+}
+
 // StopAndWait stop andf wait for clean.
 func (p *PhotonProtocol) StopAndWait() {
 	p.log.Info("PhotonProtocol stop...")
@@ -574,6 +811,12 @@ func (p *PhotonProtocol) StopAndWait() {
 	p.Transport.StopAccepting()
 	//what about the outgoing packets, maybe lost
 	p.Transport.Stop()
+	if p.capture != nil {
+		err := p.capture.Close()
+		if err != nil {
+			p.log.Warn(fmt.Sprintf("close capture err %s", err))
+		}
+	}
 
 	p.log.Info("photon protocol stop ok...")
 }
@@ -582,6 +825,7 @@ func (p *PhotonProtocol) StopAndWait() {
 func (p *PhotonProtocol) Start(receive bool) {
 	if receive {
 		go p.loop()
+		go p.pollMailbox()
 	}
 	p.Transport.Start()
 }
@@ -592,6 +836,7 @@ func (p *PhotonProtocol) StartReceive() {
 		panic("can not receive twice")
 	}
 	go p.loop()
+	go p.pollMailbox()
 }
 
 // NodeInfo get from user
@@ -621,14 +866,10 @@ func (p *PhotonProtocol) UpdateMeshNetworkNodes(nodes []*NodeInfo) error {
 		}
 		nodesmap[addr] = ua
 	}
-	if transport, ok := p.Transport.(*MixTransport); ok {
-		transport.udp.setHostPort(nodesmap)
-	} else if transport, ok := p.Transport.(*MatrixMixTransport); ok {
-		transport.udp.setHostPort(nodesmap)
-	} else if transport, ok := p.Transport.(*UDPTransport); ok {
-		transport.setHostPort(nodesmap)
-	} else {
+	transport := p.udpTransport()
+	if transport == nil {
 		return errors.New("no need to register nodes while udp doesn't work")
 	}
+	transport.setHostPort(nodesmap)
 	return nil
 }
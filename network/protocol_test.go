@@ -45,6 +45,29 @@ func TestPhotonProtocolSendReceive(t *testing.T) {
 		return
 	}
 }
+func TestPhotonProtocolPingAndWait(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+	p1 := MakeTestPhotonProtocol("p1")
+	p2 := MakeTestPhotonProtocol("p2")
+	p1.Start(true)
+	p2.Start(true)
+	_, _, err := p1.PingAndWait(p2.nodeAddr, time.Minute)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	p2.StopAndWait()
+	_, _, err = p1.PingAndWait(p2.nodeAddr, time.Second*3)
+	if err == nil {
+		t.Error(errors.New("should timeout"))
+		return
+	}
+	if len(p1.SentHashesToChannel) != 0 {
+		t.Error("ping should not be retried after timeout")
+	}
+}
 func TestPhotonProtocolSendReceiveTimeout(t *testing.T) {
 	if testing.Short() {
 		return
@@ -106,6 +129,47 @@ func TestPhotonProtocolSendReceiveNormalMessage(t *testing.T) {
 	}
 }
 
+func TestPhotonProtocolDelivered(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+	p1 := MakeTestPhotonProtocol("p1")
+	p2 := MakeTestPhotonProtocol("p2")
+	p1.Start(true)
+	p2.Start(true)
+	revealSecretMsg := encoding.NewRevealSecret(utils.ShaSecret([]byte{13}))
+	revealSecretMsg.Sign(p1.privKey, revealSecretMsg)
+	processed := make(chan struct{})
+	go func() {
+		<-p2.ReceivedMessageChan
+		//处理完之前对方已经收到Delivered
+		<-processed
+		p2.ReceivedMessageResultChan <- nil
+	}()
+	result := p1.SendAsync(p2.nodeAddr, revealSecretMsg)
+	select {
+	case d := <-p1.DeliveredMessageChan:
+		if d.Receiver != p2.nodeAddr || d.Msg != revealSecretMsg {
+			t.Errorf("delivered message not match")
+		}
+	case <-result.Result:
+		t.Error("should not be processed before delivered")
+		return
+	case <-time.After(time.Minute):
+		t.Error("wait delivered timeout")
+		return
+	}
+	close(processed)
+	select {
+	case err := <-result.Result:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Minute):
+		t.Error("wait processed timeout")
+	}
+}
+
 func TestNew(t *testing.T) {
 	msger := encoding.MessageMap[encoding.UnlockCmdID]
 	msg := New(msger)
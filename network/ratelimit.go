@@ -0,0 +1,174 @@
+package network
+
+import (
+	"sync"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+收到的消息在交给photon之前按照发送方限速,保护中间节点不被大量消息淹没:
+每个节点有两个令牌桶,分别限制消息个数和字节数,超出的消息直接丢弃,不回复Ack和Delivered,正常的发送方会稍后重发.
+一分钟内被丢弃的消息达到params.PeerBanThreshold的节点被屏蔽params.PeerBanDuration.
+Ack和Delivered没有签名,发送方可以伪造,所以它们共用一个不会被屏蔽的令牌桶,统计在地址0x0下面.
+Sealed帧在ECIES解密之前无法知道发送方,所有Sealed帧在解密之前共用一个全局令牌桶,避免伪造的Sealed帧耗尽解密用的CPU
+*/
+
+const (
+	banWindow = time.Minute
+	//超过这么多节点时清理长时间没有发消息而且没有被屏蔽的节点
+	maxRateLimitedPeers = 10000
+	rateLimitIdleTime   = 10 * time.Minute
+)
+
+//PeerRateLimit 某个节点的限速统计,只保存在内存中,重启后清零
+type PeerRateLimit struct {
+	Address      common.Address `json:"address"`
+	Accepted     int64          `json:"accepted"`
+	Dropped      int64          `json:"dropped"`
+	DroppedBytes int64          `json:"dropped_bytes"`
+	Bans         int64          `json:"bans"`                   //被屏蔽的次数
+	BannedUntil  int64          `json:"banned_until,omitempty"` //正在屏蔽时,屏蔽结束的时间
+	messages     *TokenBucket
+	bytes        *TokenBucket
+	windowStart  time.Time
+	violations   int
+	bannedUntil  time.Time
+	lastSeen     time.Time
+}
+
+type rateLimiter struct {
+	lock   sync.Mutex
+	peers  map[common.Address]*PeerRateLimit
+	sealed *TokenBucket //所有Sealed帧共用,第一次收到时创建
+	now    timeFunc
+}
+
+func newRateLimiter(now timeFunc) *rateLimiter {
+	return &rateLimiter{
+		peers: make(map[common.Address]*PeerRateLimit),
+		now:   now,
+	}
+}
+
+func (rl *rateLimiter) get(addr common.Address, now time.Time) *PeerRateLimit {
+	pr, ok := rl.peers[addr]
+	if ok {
+		return pr
+	}
+	if len(rl.peers) >= maxRateLimitedPeers {
+		for a, pr2 := range rl.peers {
+			if now.Sub(pr2.lastSeen) > rateLimitIdleTime && now.After(pr2.bannedUntil) {
+				delete(rl.peers, a)
+			}
+		}
+	}
+	bytesCapacity := params.PeerBytesRate
+	if bytesCapacity < params.UDPMaxMessageSize {
+		bytesCapacity = params.UDPMaxMessageSize
+	}
+	pr = &PeerRateLimit{
+		Address:  addr,
+		messages: NewTokenBucket(float64(params.PeerMessageBurst), float64(params.PeerMessageRate), rl.now),
+		bytes:    NewTokenBucket(float64(bytesCapacity), float64(params.PeerBytesRate), rl.now),
+	}
+	rl.peers[addr] = pr
+	return pr
+}
+
+/*
+allow 收到`addr`的`size`字节的消息时调用,返回false表示应该丢弃.
+`canBan`为false时只限速不屏蔽
+*/
+func (rl *rateLimiter) allow(addr common.Address, size int, canBan bool) bool {
+	if params.PeerMessageRate <= 0 {
+		return true
+	}
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	now := rl.now()
+	pr := rl.get(addr, now)
+	pr.lastSeen = now
+	if now.Before(pr.bannedUntil) {
+		pr.Dropped++
+		pr.DroppedBytes += int64(size)
+		return false
+	}
+	if pr.messages.TryConsume(1) {
+		if pr.bytes.TryConsume(float64(size)) {
+			pr.Accepted++
+			return true
+		}
+		//字节数超出限制时,这条消息不应该占用消息个数
+		pr.messages.Tokens++
+	}
+	pr.Dropped++
+	pr.DroppedBytes += int64(size)
+	if !canBan {
+		return false
+	}
+	if now.Sub(pr.windowStart) > banWindow {
+		pr.windowStart = now
+		pr.violations = 0
+	}
+	pr.violations++
+	if pr.violations >= params.PeerBanThreshold {
+		pr.bannedUntil = now.Add(params.PeerBanDuration)
+		pr.Bans++
+		pr.violations = 0
+	}
+	return false
+}
+
+/*
+allowSealed 收到Sealed帧,解密之前调用,返回false表示应该丢弃.
+无法确定发送方,所以只限速不屏蔽
+*/
+func (rl *rateLimiter) allowSealed() bool {
+	if params.SealedFrameRate <= 0 {
+		return true
+	}
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	if rl.sealed == nil {
+		rl.sealed = NewTokenBucket(float64(params.SealedFrameBurst), float64(params.SealedFrameRate), rl.now)
+	}
+	return rl.sealed.TryConsume(1)
+}
+
+//snapshot 返回所有节点限速统计的拷贝
+func (rl *rateLimiter) snapshot() (peers []*PeerRateLimit) {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	now := rl.now()
+	for _, pr := range rl.peers {
+		pr2 := &PeerRateLimit{
+			Address:      pr.Address,
+			Accepted:     pr.Accepted,
+			Dropped:      pr.Dropped,
+			DroppedBytes: pr.DroppedBytes,
+			Bans:         pr.Bans,
+		}
+		if now.Before(pr.bannedUntil) {
+			pr2.BannedUntil = pr.bannedUntil.Unix()
+		}
+		peers = append(peers, pr2)
+	}
+	return
+}
+
+//RateLimitStats 返回所有发过消息的节点的限速统计,地址0x0是所有未签名消息的统计
+func (p *PhotonProtocol) RateLimitStats() []*PeerRateLimit {
+	return p.rateLimiter.snapshot()
+}
+
+//allowMessage 未签名的消息无法确定发送方,共用一个令牌桶
+func (p *PhotonProtocol) allowMessage(sender common.Address, signed bool, size int) bool {
+	if !signed {
+		sender = utils.EmptyAddress
+	}
+	return p.rateLimiter.allow(sender, size, signed)
+}
@@ -0,0 +1,70 @@
+package network
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	oldRate, oldBurst, oldThreshold := params.PeerMessageRate, params.PeerMessageBurst, params.PeerBanThreshold
+	defer func() {
+		params.PeerMessageRate, params.PeerMessageBurst, params.PeerBanThreshold = oldRate, oldBurst, oldThreshold
+	}()
+	params.PeerMessageRate = 1
+	params.PeerMessageBurst = 2
+	params.PeerBanThreshold = 3
+	now := time.Now()
+	rl := newRateLimiter(func() time.Time { return now })
+	addr := utils.NewRandomAddress()
+	assert.True(t, rl.allow(addr, 100, true))
+	assert.True(t, rl.allow(addr, 100, true))
+	assert.False(t, rl.allow(addr, 100, true))
+	now = now.Add(time.Second)
+	assert.True(t, rl.allow(addr, 100, true))
+	//太大的消息不占用消息个数
+	now = now.Add(time.Second)
+	assert.False(t, rl.allow(addr, params.PeerBytesRate*2, true))
+	assert.True(t, rl.allow(addr, 100, true))
+	//第三次被丢弃以后屏蔽
+	assert.False(t, rl.allow(addr, 100, true))
+	now = now.Add(time.Second * 5)
+	assert.False(t, rl.allow(addr, 100, true))
+	stats := rl.snapshot()
+	assert.Equal(t, 1, len(stats))
+	assert.EqualValues(t, 4, stats[0].Accepted)
+	assert.EqualValues(t, 4, stats[0].Dropped)
+	assert.EqualValues(t, 1, stats[0].Bans)
+	assert.NotZero(t, stats[0].BannedUntil)
+	now = now.Add(params.PeerBanDuration)
+	assert.True(t, rl.allow(addr, 100, true))
+	//未签名的消息不会被屏蔽
+	for i := 0; i < 10; i++ {
+		rl.allow(utils.EmptyAddress, 10, false)
+	}
+	now = now.Add(time.Second * 2)
+	assert.True(t, rl.allow(utils.EmptyAddress, 10, false))
+	params.PeerMessageRate = 0
+	assert.True(t, NewTokenBucket(1, 1).TryConsume(1))
+}
+
+func TestRateLimiterSealed(t *testing.T) {
+	oldRate, oldBurst := params.SealedFrameRate, params.SealedFrameBurst
+	defer func() {
+		params.SealedFrameRate, params.SealedFrameBurst = oldRate, oldBurst
+	}()
+	params.SealedFrameRate = 1
+	params.SealedFrameBurst = 2
+	now := time.Now()
+	rl := newRateLimiter(func() time.Time { return now })
+	assert.True(t, rl.allowSealed())
+	assert.True(t, rl.allowSealed())
+	assert.False(t, rl.allowSealed())
+	now = now.Add(time.Second)
+	assert.True(t, rl.allowSealed())
+	params.SealedFrameRate = 0
+	assert.True(t, rl.allowSealed())
+}
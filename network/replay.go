@@ -0,0 +1,119 @@
+package network
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/internal/rpanic"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//replayMaxInterval 重放时两条消息之间最多等待的时间,避免现场长时间没有消息时重放也要等待同样长的时间
+var replayMaxInterval = 5 * time.Second
+
+/*
+ReplayTransport 离线重现现场问题用的Transport,不连接任何网络.
+Start以后按照原来的顺序和间隔把capture中收到的消息交给PhotonProtocol,经过同样的解析和状态机处理,
+发出的消息记录到output中,可以和capture中原来发出的消息比较.
+需要使用和现场相同的账户以及现场数据库的拷贝,否则签名和状态都对不上
+*/
+type ReplayTransport struct {
+	frames   []*CapturedFrame
+	output   *CaptureWriter
+	protocol ProtocolReceiver
+	quitChan chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+//NewReplayTransport output为nil时不记录发出的消息
+func NewReplayTransport(frames []*CapturedFrame, output *CaptureWriter) *ReplayTransport {
+	return &ReplayTransport{
+		frames:   frames,
+		output:   output,
+		quitChan: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+//Send 只记录,不发送
+func (t *ReplayTransport) Send(receiver common.Address, data []byte) error {
+	if t.output == nil {
+		return nil
+	}
+	return t.output.Write(CaptureOutbound, receiver, data)
+}
+
+//Start 开始重放
+func (t *ReplayTransport) Start() {
+	go t.replay()
+}
+
+func (t *ReplayTransport) replay() {
+	defer rpanic.PanicRecover("ReplayTransport")
+	defer close(t.done)
+	var last time.Time
+	n := 0
+	for _, f := range t.frames {
+		if f.Direction != CaptureInbound {
+			continue
+		}
+		if !last.IsZero() {
+			interval := f.Time.Sub(last)
+			if interval > replayMaxInterval {
+				interval = replayMaxInterval
+			}
+			if interval > 0 {
+				select {
+				case <-time.After(interval):
+				case <-t.quitChan:
+					return
+				}
+			}
+		}
+		last = f.Time
+		select {
+		case <-t.quitChan:
+			return
+		default:
+		}
+		t.protocol.receive(f.Data)
+		n++
+	}
+	log.Info(fmt.Sprintf("replay finished, %d inbound messages replayed", n))
+}
+
+//Done 所有收到的消息都已经交给PhotonProtocol时关闭
+func (t *ReplayTransport) Done() <-chan struct{} {
+	return t.done
+}
+
+//Stop 停止重放,并关闭output
+func (t *ReplayTransport) Stop() {
+	t.stopOnce.Do(func() {
+		close(t.quitChan)
+		if t.output != nil {
+			err := t.output.Close()
+			if err != nil {
+				log.Warn(fmt.Sprintf("close replay output err %s", err))
+			}
+		}
+	})
+}
+
+//StopAccepting 停止重放
+func (t *ReplayTransport) StopAccepting() {
+	t.Stop()
+}
+
+//RegisterProtocol 重放的消息交给protcol
+func (t *ReplayTransport) RegisterProtocol(protcol ProtocolReceiver) {
+	t.protocol = protcol
+}
+
+//NodeStatus 所有节点都认为在线,这样才会发送消息
+func (t *ReplayTransport) NodeStatus(addr common.Address) (deviceType string, isOnline bool) {
+	return DeviceTypeOther, true
+}
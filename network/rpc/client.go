@@ -66,6 +66,10 @@ type BlockChainService struct {
 	//Auth needs by call on blockchain todo remove this
 	Auth  *bind.TransactOpts
 	mlock sync.Mutex
+	// 本账户所有交易的nonce统一分配
+	nonces *nonceManager
+	// 多个通道的Unlock共享gasPrice
+	unlocks unlockScheduler
 	// things needs by contract call
 	NotifyHandler     *notify.Handler
 	TXInfoDao         models.TXInfoDao
@@ -90,6 +94,17 @@ func NewBlockChainService(privateKey *ecdsa.PrivateKey, registryAddress common.A
 	// remove gas limit config and let it calculate automatically
 	//bcs.Auth.GasLimit = uint64(params.GasLimit)
 	bcs.Auth.GasPrice = big.NewInt(params.DefaultGasPrice)
+	bcs.nonces = newNonceManager(func() (uint64, error) {
+		return client.PendingNonceAt(GetQueryConext(), bcs.NodeAddress)
+	}, func(txHash common.Hash) bool {
+		_, _, err := client.TransactionByHash(GetQueryConext(), txHash)
+		return err == ethereum.NotFound
+	})
+	client.GasPriceAdjuster = AdjustGasPrice
+	if params.EnableGasPriceOracle {
+		//GasPrice为nil时,bind会通过SuggestGasPrice获取
+		bcs.Auth.GasPrice = nil
+	}
 
 	_, err = bcs.Registry(registryAddress, client.Status == netshare.Connected)
 	return
@@ -167,7 +182,15 @@ func (bcs *BlockChainService) Registry(address common.Address, hasConnectChain b
 			log.Error(fmt.Sprintf("GetTXInfoList err %s", err))
 			return
 		}
-		for _, tx := range pendingTXs {
+		// 同一个nonce只监控最后发出的一笔,之前的交易在waitMinedOrReplace中一起查询
+		latestTXs, supersededTXs := latestPendingPerNonce(pendingTXs)
+		for _, tx := range supersededTXs {
+			_, err = bcs.TXInfoDao.UpdateTXInfoStatus(tx.TXHash, models.TXInfoStatusReplaced, 0, 0)
+			if err != nil {
+				log.Error(fmt.Sprintf("UpdateTXInfoStatus err %s", err))
+			}
+		}
+		for _, tx := range latestTXs {
 			bcs.RegisterPendingTXInfo(tx)
 		}
 	}
@@ -176,6 +199,11 @@ func (bcs *BlockChainService) Registry(address common.Address, hasConnectChain b
 	return bcs.RegistryProxy, nil
 }
 
+//transact 由nonceManager分配nonce后使用Auth发送交易,避免同时发出的交易nonce冲突
+func (bcs *BlockChainService) transact(f func(opts *bind.TransactOpts) (*types.Transaction, error)) (*types.Transaction, error) {
+	return bcs.nonces.transact(bcs.Auth, f)
+}
+
 // GetRegistryAddress :
 func (bcs *BlockChainService) GetRegistryAddress() common.Address {
 	if bcs.RegistryProxy != nil {
@@ -227,8 +255,8 @@ func (bcs *BlockChainService) checkPendingTXDone(pendingTXInfo *models.TXInfo) {
 		log.Warn("checkPendingTXDone got tx with status=%s, maybe something wrong", pendingTXInfo.Status)
 		return
 	}
-	// 1. 等待tx执行完成
-	receipt, err := waitMined(context.Background(), bcs.Client, pendingTXInfo.TXHash)
+	// 1. 等待tx执行完成,长时间未打包的tx会被替换,之后处理实际打包的那一笔
+	receipt, pendingTXInfo, err := bcs.waitMinedOrReplace(pendingTXInfo)
 	if err != nil {
 		err = rerr.ErrTxWaitMined.AppendError(err)
 		log.Error(err.Error())
@@ -251,6 +279,13 @@ func (bcs *BlockChainService) checkPendingTXDone(pendingTXInfo *models.TXInfo) {
 		// b. 通知上层
 		bcs.NotifyHandler.NotifyContractCallTXInfo(savedTxInfo)
 		log.Warn(fmt.Sprintf("tx receipt failed :\n%s", utils.StringInterface(savedTxInfo, 3)))
+		// c. 存款失败时区分是approve还是deposit被合约拒绝
+		switch pendingTXInfo.Type {
+		case models.TXInfoTypeApproveDeposit:
+			bcs.NotifyHandler.NotifyString(notify.LevelWarn, rerr.ErrInsufficientAllowance.Printf("approve tx %s reverted", pendingTXInfo.TXHash.String()).Error())
+		case models.TXInfoTypeDeposit:
+			bcs.NotifyHandler.NotifyString(notify.LevelWarn, rerr.ErrDeposit.Printf("deposit tx %s reverted", pendingTXInfo.TXHash.String()).Error())
+		}
 		return
 	}
 	// 成功处理
@@ -278,44 +313,10 @@ func (bcs *BlockChainService) checkPendingTXDone(pendingTXInfo *models.TXInfo) {
 			log.Error(err.Error())
 			break
 		}
-		//log.Info(fmt.Sprintf("RegistryProxy proxy=%s", utils.StringInterface(proxy, 5)))
-		tx, err := proxy.GetContract().Deposit(bcs.Auth, depositParams.TokenAddress, depositParams.ParticipantAddress, depositParams.PartnerAddress, depositParams.Amount, depositParams.SettleTimeout)
-		if err != nil {
-			log.Error(err.Error())
-			break
-		}
-		// 保存TXInfo并注册到bcs中监控其执行结果
-		channelID := utils.CalcChannelID(depositParams.TokenAddress, bcs.RegistryProxy.Address, depositParams.ParticipantAddress, depositParams.PartnerAddress)
-		txInfo, err := bcs.TXInfoDao.NewPendingTXInfo(tx, models.TXInfoTypeDeposit, channelID, 0, &depositParams)
+		err = proxy.depositWithAllowance(&depositParams)
 		if err != nil {
 			log.Error(err.Error())
-			break
-		}
-		bcs.RegisterPendingTXInfo(txInfo)
-	}
-}
-
-// 修改bind.WaitMined()而来,只改了参数格式,不影响功能
-func waitMined(ctx context.Context, b bind.DeployBackend, txHash common.Hash) (*types.Receipt, error) {
-	queryTicker := time.NewTicker(time.Second)
-	defer queryTicker.Stop()
-
-	logger := log.New("hash", txHash)
-	for {
-		receipt, err := b.TransactionReceipt(ctx, txHash)
-		if receipt != nil {
-			return receipt, nil
-		}
-		if err != nil {
-			logger.Trace("Receipt retrieval failed", "err", err)
-		} else {
-			logger.Trace("Transaction not yet mined")
-		}
-		// Wait for the next round.
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		case <-queryTicker.C:
+			bcs.NotifyHandler.NotifyString(notify.LevelWarn, rerr.ErrDeposit.Printf("deposit after approve err %s", err).Error())
 		}
 	}
 }
@@ -0,0 +1,153 @@
+package rpc
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/network/rpc/contracts"
+	"github.com/SmartMeshFoundation/Photon/network/rpc/contracts/test/tokens/smttoken"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//存款时依次尝试的方式,和NewChannelAndDepositAsync保持一致
+const (
+	DepositMethodSMTToken       = "smttoken"
+	DepositMethodFallback       = "fallback"
+	DepositMethodApproveAndCall = "approveAndCall"
+	DepositMethodApprove        = "approve"
+)
+
+//DepositDryRunResult 模拟存款的结果,不会发送任何交易
+type DepositDryRunResult struct {
+	WouldSucceed bool     `json:"would_succeed"`
+	Method       string   `json:"method"` //实际存款时会使用的方式
+	Balance      *big.Int `json:"balance"`
+	Allowance    *big.Int `json:"allowance"`
+	GasEstimate  uint64   `json:"gas_estimate"`
+	//CreditedAmount 合约记入通道的存款金额,合约按照参数记账,与代币实际转账金额无关
+	CreditedAmount *big.Int `json:"credited_amount"`
+	Reason         string   `json:"reason,omitempty"`
+}
+
+/*
+DepositDryRun 通过eth_estimateGas模拟NewChannelAndDepositAsync,检查余额,授权以及合约限制,
+按照真实存款的顺序依次尝试各种存款方式,返回第一个能够成功的方式.
+approve方式需要两个交易,在授权不足时只能模拟approve,无法模拟随后的deposit.
+*/
+func (t *TokenNetworkProxy) DepositDryRun(participantAddress, partnerAddress common.Address, settleTimeout int, amount *big.Int) (result *DepositDryRunResult, err error) {
+	result = &DepositDryRunResult{
+		Allowance:      big.NewInt(0),
+		CreditedAmount: big.NewInt(0),
+	}
+	token, err := t.bcs.Token(t.token)
+	if err != nil {
+		return nil, rerr.ContractCallError(err)
+	}
+	result.Balance, err = token.BalanceOf(participantAddress)
+	if err != nil {
+		return nil, err
+	}
+	name, err := token.Token.Name(t.bcs.getQueryOpts())
+	if err != nil {
+		return nil, rerr.ContractCallError(err)
+	}
+	data := makeNewChannelAndDepositData(participantAddress, partnerAddress, settleTimeout)
+	if name == params.SMTTokenName {
+		//主链币代理合约,存款金额来自交易的value,而不是代币余额
+		result.Method = DepositMethodSMTToken
+		result.Balance, err = t.bcs.Client.BalanceAt(GetQueryConext(), participantAddress, nil)
+		if err != nil {
+			return nil, rerr.ContractCallError(err)
+		}
+		input, err2 := packMethod(smttoken.SMTTokenABI, "buyAndTransfer", data)
+		if err2 != nil {
+			return nil, err2
+		}
+		t.estimateDeposit(result, t.token, amount, input, amount)
+		return
+	}
+	if result.Balance.Cmp(amount) < 0 {
+		result.Reason = fmt.Sprintf("insufficient token balance, balance=%s,amount=%s", result.Balance, amount)
+		return
+	}
+	input, err := packMethod(contracts.TokenABI, "transfer", t.Address, amount, data)
+	if err != nil {
+		return nil, err
+	}
+	result.Method = DepositMethodFallback
+	if t.estimateDeposit(result, t.token, nil, input, amount) {
+		return
+	}
+	input, err = packMethod(contracts.TokenABI, "approveAndCall", t.Address, amount, data)
+	if err != nil {
+		return nil, err
+	}
+	result.Method = DepositMethodApproveAndCall
+	if t.estimateDeposit(result, t.token, nil, input, amount) {
+		return
+	}
+	result.Method = DepositMethodApprove
+	allowance, err := token.Allowance(participantAddress, t.Address)
+	if err != nil {
+		return nil, err
+	}
+	result.Allowance = allowance
+	if allowance.Cmp(amount) >= 0 {
+		input, err = packMethod(contracts.TokensNetworkABI, "deposit", t.token, participantAddress, partnerAddress, amount, uint64(settleTimeout))
+		if err != nil {
+			return nil, err
+		}
+		t.estimateDeposit(result, t.Address, nil, input, amount)
+		return
+	}
+	input, err = packMethod(contracts.TokenABI, "approve", t.Address, approveAmount(amount))
+	if err != nil {
+		return nil, err
+	}
+	if t.estimateDeposit(result, t.token, nil, input, amount) {
+		result.Reason = "allowance is not enough, only approve is simulated, deposit will be sent after approve is mined"
+	}
+	return
+}
+
+//estimateDeposit 估算交易的gas,估算失败说明交易会被合约拒绝
+func (t *TokenNetworkProxy) estimateDeposit(result *DepositDryRunResult, to common.Address, value *big.Int, input []byte, amount *big.Int) bool {
+	gas, err := t.bcs.Client.EstimateGas(GetQueryConext(), ethereum.CallMsg{
+		From:  t.bcs.NodeAddress,
+		To:    &to,
+		Value: value,
+		Data:  input,
+	})
+	if err != nil {
+		log.Info(fmt.Sprintf("deposit dry run by %s on %s failed: %s", result.Method, utils.APex2(to), err))
+		result.WouldSucceed = false
+		result.GasEstimate = 0
+		result.CreditedAmount = big.NewInt(0)
+		result.Reason = err.Error()
+		return false
+	}
+	result.WouldSucceed = true
+	result.GasEstimate = gas
+	result.CreditedAmount = new(big.Int).Set(amount)
+	result.Reason = ""
+	return true
+}
+
+func packMethod(abiJSON string, method string, args ...interface{}) ([]byte, error) {
+	parsed, err := abi.JSON(strings.NewReader(abiJSON))
+	if err != nil {
+		return nil, rerr.ErrUnknown.AppendError(err)
+	}
+	input, err := parsed.Pack(method, args...)
+	if err != nil {
+		return nil, rerr.ErrArgumentError.AppendError(err)
+	}
+	return input, nil
+}
@@ -0,0 +1,196 @@
+package rpc
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+/*
+AdjustGasPrice 按照params中的策略调整公链节点建议的gasPrice:
+先乘以params.GasPriceMultiplier%,再限制在[params.MinGasPrice,params.MaxGasPrice]之间
+*/
+func AdjustGasPrice(suggested *big.Int) *big.Int {
+	gasPrice := new(big.Int).Mul(suggested, big.NewInt(params.GasPriceMultiplier))
+	gasPrice.Div(gasPrice, big.NewInt(100))
+	if params.MinGasPrice.Sign() > 0 && gasPrice.Cmp(params.MinGasPrice) < 0 {
+		gasPrice.Set(params.MinGasPrice)
+	}
+	if params.MaxGasPrice.Sign() > 0 && gasPrice.Cmp(params.MaxGasPrice) > 0 {
+		gasPrice.Set(params.MaxGasPrice)
+	}
+	return gasPrice
+}
+
+/*
+bumpGasPrice 计算替换交易的gasPrice,至少比原交易提高params.GasPriceBumpPercent%,同时不低于当前建议的gasPrice.
+超过params.MaxGasPrice时取上限,如果原交易已经达到上限,无法替换,返回nil
+*/
+func bumpGasPrice(old, suggested *big.Int) *big.Int {
+	gasPrice := new(big.Int).Mul(old, big.NewInt(100+params.GasPriceBumpPercent))
+	gasPrice.Div(gasPrice, big.NewInt(100))
+	if gasPrice.Cmp(old) <= 0 {
+		gasPrice.Add(old, big.NewInt(1))
+	}
+	if suggested != nil && suggested.Cmp(gasPrice) > 0 {
+		gasPrice.Set(suggested)
+	}
+	if params.MaxGasPrice.Sign() > 0 && gasPrice.Cmp(params.MaxGasPrice) > 0 {
+		gasPrice.Set(params.MaxGasPrice)
+	}
+	if gasPrice.Cmp(old) <= 0 {
+		return nil
+	}
+	return gasPrice
+}
+
+/*
+waitMinedOrReplace 等待交易打包,超过params.TxStuckTimeout没有打包就用相同nonce和更高的gasPrice发送替换交易.
+替换交易也会卡住,所以每次超时都在最后一笔替换交易的基础上继续提高.
+同一nonce的所有交易组成一条链,pendingTXInfo是链上最后一笔,之前被替换的交易(重启前发出的)也要继续查询,
+所有交易中任何一笔打包都算完成,返回它的receipt和对应的TXInfo,其余的标记为replaced
+*/
+func (bcs *BlockChainService) waitMinedOrReplace(pendingTXInfo *models.TXInfo) (receipt *types.Receipt, minedTXInfo *models.TXInfo, err error) {
+	queryTicker := time.NewTicker(time.Second)
+	defer queryTicker.Stop()
+	txInfos, err := bcs.replacedTXInfos(pendingTXInfo)
+	if err != nil {
+		return
+	}
+	txInfos = append(txInfos, pendingTXInfo)
+	//重启后继续监控的交易从发起时间开始计算
+	lastSend := time.Unix(pendingTXInfo.CallTime, 0)
+	for {
+		for _, txInfo := range txInfos {
+			receipt, err = bcs.Client.TransactionReceipt(GetQueryConext(), txInfo.TXHash)
+			if receipt != nil {
+				minedTXInfo = txInfo
+				break
+			}
+		}
+		if minedTXInfo != nil {
+			break
+		}
+		if params.TxStuckTimeout > 0 && time.Since(lastSend) > params.TxStuckTimeout {
+			lastSend = time.Now()
+			txInfo, err := bcs.replaceStuckTX(txInfos[len(txInfos)-1])
+			if err != nil {
+				log.Warn(fmt.Sprintf("replace stuck tx %s err %s", txInfos[len(txInfos)-1].TXHash.String(), err))
+			} else if txInfo != nil {
+				txInfos = append(txInfos, txInfo)
+			}
+		}
+		<-queryTicker.C
+	}
+	for _, txInfo := range txInfos {
+		if txInfo == minedTXInfo || txInfo.Status == models.TXInfoStatusReplaced {
+			continue
+		}
+		_, err = bcs.TXInfoDao.UpdateTXInfoStatus(txInfo.TXHash, models.TXInfoStatusReplaced, 0, 0)
+		if err != nil {
+			log.Error(err.Error())
+		}
+	}
+	return receipt, minedTXInfo, nil
+}
+
+/*
+replacedTXInfos 返回和txInfo同一nonce,已经被替换的交易,重启后需要和txInfo一起查询是否已经打包
+*/
+func (bcs *BlockChainService) replacedTXInfos(txInfo *models.TXInfo) (txInfos []*models.TXInfo, err error) {
+	list, err := bcs.TXInfoDao.GetTXInfoList(utils.EmptyHash, 0, utils.EmptyAddress, txInfo.Type, models.TXInfoStatusReplaced)
+	if err != nil {
+		return
+	}
+	for _, t := range list {
+		if t.Nonce == txInfo.Nonce && t.TXHash != txInfo.TXHash {
+			txInfos = append(txInfos, t)
+		}
+	}
+	return
+}
+
+/*
+latestPendingPerNonce 把pending状态的tx按nonce分组,每个nonce只返回最后发出的一笔,其余的放在superseded中.
+替换交易发出后还没来得及把原交易标记为replaced就崩溃时,同一个nonce会有多笔pending的tx,
+只能由一个线程监控,否则会有多个线程同时替换同一个nonce
+*/
+func latestPendingPerNonce(pendingTXs []*models.TXInfo) (latest, superseded []*models.TXInfo) {
+	nonceIndex := make(map[uint64]int)
+	for _, txInfo := range pendingTXs {
+		i, ok := nonceIndex[txInfo.Nonce]
+		if !ok {
+			nonceIndex[txInfo.Nonce] = len(latest)
+			latest = append(latest, txInfo)
+			continue
+		}
+		if txInfo.CallTime > latest[i].CallTime || (txInfo.CallTime == latest[i].CallTime && txInfo.GasPrice > latest[i].GasPrice) {
+			superseded = append(superseded, latest[i])
+			latest[i] = txInfo
+		} else {
+			superseded = append(superseded, txInfo)
+		}
+	}
+	return
+}
+
+/*
+replaceStuckTX 用相同的nonce,to,data和gasLimit以及更高的gasPrice重新签名并发送交易,
+返回替换交易对应的TXInfo,同时把原交易标记为replaced,保证同一个nonce只有一笔pending的tx.
+原交易已经不在交易池中(已打包或者被丢弃)时不替换,返回nil
+*/
+func (bcs *BlockChainService) replaceStuckTX(txInfo *models.TXInfo) (newTXInfo *models.TXInfo, err error) {
+	tx, isPending, err := bcs.Client.TransactionByHash(GetQueryConext(), txInfo.TXHash)
+	if err != nil {
+		return
+	}
+	if !isPending || tx.To() == nil {
+		return
+	}
+	suggested, err := bcs.Client.SuggestGasPrice(GetQueryConext())
+	if err != nil {
+		return
+	}
+	gasPrice := bumpGasPrice(tx.GasPrice(), suggested)
+	if gasPrice == nil {
+		log.Warn(fmt.Sprintf("tx %s is stuck, but gas price %s already reaches MaxGasPrice", txInfo.TXHash.String(), tx.GasPrice()))
+		return
+	}
+	chainID, err := bcs.Client.NetworkID(GetQueryConext())
+	if err != nil {
+		return
+	}
+	newTx, err := bcs.Auth.Signer(types.NewEIP155Signer(chainID), bcs.Auth.From,
+		types.NewTransaction(tx.Nonce(), *tx.To(), tx.Value(), tx.Gas(), gasPrice, tx.Data()))
+	if err != nil {
+		return
+	}
+	err = bcs.Client.SendTransaction(GetCallContext(), newTx)
+	if err != nil {
+		err = rerr.ContractCallError(fmt.Errorf("send replacement tx err %s", err))
+		return
+	}
+	log.Info(fmt.Sprintf("tx[txHash=%s,type=%s,nonce=%d] stuck, replaced by %s with gasPrice %s->%s",
+		txInfo.TXHash.String(), txInfo.Type, tx.Nonce(), newTx.Hash().String(), tx.GasPrice(), gasPrice))
+	var txParams models.TXParams
+	if txInfo.TXParams != "" {
+		txParams = txInfo.TXParams
+	}
+	newTXInfo, err = bcs.TXInfoDao.NewPendingTXInfo(newTx, txInfo.Type, txInfo.ChannelIdentifier, txInfo.OpenBlockNumber, txParams)
+	if err != nil {
+		return
+	}
+	_, err = bcs.TXInfoDao.UpdateTXInfoStatus(txInfo.TXHash, models.TXInfoStatusReplaced, 0, 0)
+	if err != nil {
+		return
+	}
+	txInfo.Status = models.TXInfoStatusReplaced
+	return
+}
@@ -0,0 +1,52 @@
+package rpc
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdjustGasPrice(t *testing.T) {
+	defer func(multiplier int64, min, max *big.Int) {
+		params.GasPriceMultiplier, params.MinGasPrice, params.MaxGasPrice = multiplier, min, max
+	}(params.GasPriceMultiplier, params.MinGasPrice, params.MaxGasPrice)
+	params.GasPriceMultiplier = 150
+	params.MinGasPrice = big.NewInt(0)
+	params.MaxGasPrice = big.NewInt(0)
+	assert.EqualValues(t, 300, AdjustGasPrice(big.NewInt(200)).Int64())
+	params.MinGasPrice = big.NewInt(1000)
+	assert.EqualValues(t, 1000, AdjustGasPrice(big.NewInt(200)).Int64())
+	params.MaxGasPrice = big.NewInt(2000)
+	assert.EqualValues(t, 2000, AdjustGasPrice(big.NewInt(5000)).Int64())
+}
+
+func TestBumpGasPrice(t *testing.T) {
+	defer func(bump int64, max *big.Int) {
+		params.GasPriceBumpPercent, params.MaxGasPrice = bump, max
+	}(params.GasPriceBumpPercent, params.MaxGasPrice)
+	params.GasPriceBumpPercent = 20
+	params.MaxGasPrice = big.NewInt(0)
+	assert.EqualValues(t, 120, bumpGasPrice(big.NewInt(100), nil).Int64())
+	//建议的gasPrice已经更高,直接使用建议值
+	assert.EqualValues(t, 200, bumpGasPrice(big.NewInt(100), big.NewInt(200)).Int64())
+	//太小的gasPrice至少提高1
+	assert.EqualValues(t, 2, bumpGasPrice(big.NewInt(1), nil).Int64())
+	params.MaxGasPrice = big.NewInt(110)
+	assert.EqualValues(t, 110, bumpGasPrice(big.NewInt(100), nil).Int64())
+	//已经达到上限,无法替换
+	assert.Nil(t, bumpGasPrice(big.NewInt(110), nil))
+}
+
+func TestLatestPendingPerNonce(t *testing.T) {
+	tx1 := &models.TXInfo{TXHash: utils.NewRandomHash(), Nonce: 1, CallTime: 100}
+	tx1Replaced := &models.TXInfo{TXHash: utils.NewRandomHash(), Nonce: 1, CallTime: 200}
+	tx2 := &models.TXInfo{TXHash: utils.NewRandomHash(), Nonce: 2, CallTime: 150}
+	latest, superseded := latestPendingPerNonce([]*models.TXInfo{tx1Replaced, tx2, tx1})
+	//每个nonce只保留最后发出的一笔
+	assert.EqualValues(t, []*models.TXInfo{tx1Replaced, tx2}, latest)
+	assert.EqualValues(t, []*models.TXInfo{tx1}, superseded)
+}
@@ -0,0 +1,124 @@
+package rpc
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+/*
+nonceManager 为本节点账户的所有交易分配nonce.
+ConnectionManager同时给多个通道开通道和存款时,每笔交易各自从公链获取pending nonce会互相冲突,导致部分交易失败.
+nonceManager让交易依次发送,并记录已经发出但公链节点可能还没有计入pending nonce的交易,
+分配时跳过这些nonce,发送失败没有用掉的nonce会留给下一笔交易.
+公链节点返回nonce too low时,说明这个nonce已经被其他交易用掉,标记以后换一个nonce再试一次.
+超过params.NonceReserveTimeout还没有被覆盖的记录,如果交易已经被交易池丢弃,释放它占用的nonce
+*/
+type nonceManager struct {
+	lock sync.Mutex
+	//pendingNonce 从公链获取下一个可用的nonce
+	pendingNonce func() (uint64, error)
+	//txDropped 公链节点已经找不到这笔交易时返回true,查询出错时返回false
+	txDropped func(txHash common.Hash) bool
+	//pending 已经发出,nonce还没有被公链pending nonce覆盖的交易
+	pending map[uint64]*reservedNonce
+}
+
+//reservedNonce 已经分配出去的nonce
+type reservedNonce struct {
+	txHash   common.Hash //nonce too low时为空
+	sendTime time.Time
+}
+
+func newNonceManager(pendingNonce func() (uint64, error), txDropped func(txHash common.Hash) bool) *nonceManager {
+	return &nonceManager{
+		pendingNonce: pendingNonce,
+		txDropped:    txDropped,
+		pending:      make(map[uint64]*reservedNonce),
+	}
+}
+
+/*
+reserve 记录已经被占用的nonce
+*/
+func (m *nonceManager) reserve(nonce uint64, txHash common.Hash) {
+	m.pending[nonce] = &reservedNonce{
+		txHash:   txHash,
+		sendTime: time.Now(),
+	}
+}
+
+/*
+expired 记录超时后,交易已经被丢弃或者只是nonce too low的标记,都不应该继续占用这个nonce
+*/
+func (m *nonceManager) expired(p *reservedNonce) bool {
+	if time.Since(p.sendTime) < params.NonceReserveTimeout {
+		return false
+	}
+	return p.txHash == utils.EmptyHash || m.txDropped(p.txHash)
+}
+
+/*
+next 取公链pending nonce和本地记录中第一个没有被占用的nonce,调用者必须持有锁
+*/
+func (m *nonceManager) next() (nonce uint64, err error) {
+	nonce, err = m.pendingNonce()
+	if err != nil {
+		return
+	}
+	for n, p := range m.pending {
+		if n < nonce {
+			delete(m.pending, n)
+		} else if m.expired(p) {
+			log.Warn(fmt.Sprintf("tx %s with nonce %d not found on chain after %s, release its nonce", p.txHash.String(), n, params.NonceReserveTimeout))
+			delete(m.pending, n)
+		}
+	}
+	for {
+		if _, ok := m.pending[nonce]; !ok {
+			return
+		}
+		nonce++
+	}
+}
+
+/*
+transact 使用分配好的nonce调用`transact`发送交易,auth中指定的nonce会被忽略
+*/
+func (m *nonceManager) transact(auth *bind.TransactOpts, transact func(opts *bind.TransactOpts) (*types.Transaction, error)) (tx *types.Transaction, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for retry := 0; retry < 2; retry++ {
+		var nonce uint64
+		nonce, err = m.next()
+		if err != nil {
+			return
+		}
+		opts := *auth
+		opts.Nonce = new(big.Int).SetUint64(nonce)
+		tx, err = transact(&opts)
+		if err == nil {
+			m.reserve(nonce, tx.Hash())
+			return
+		}
+		if !isNonceTooLow(err) {
+			return
+		}
+		log.Warn(fmt.Sprintf("nonce %d of %s already used, retry with next nonce", nonce, auth.From.String()))
+		m.reserve(nonce, utils.EmptyHash)
+	}
+	return
+}
+
+func isNonceTooLow(err error) bool {
+	return strings.Contains(err.Error(), "nonce too low")
+}
@@ -0,0 +1,96 @@
+package rpc
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/params"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNonceManager(t *testing.T) {
+	pending := uint64(5)
+	m := newNonceManager(func() (uint64, error) {
+		return pending, nil
+	}, func(common.Hash) bool {
+		return false
+	})
+	auth := &bind.TransactOpts{GasPrice: big.NewInt(1)}
+	var sent []uint64
+	transact := func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		sent = append(sent, opts.Nonce.Uint64())
+		return types.NewTransaction(opts.Nonce.Uint64(), common.Address{}, nil, 0, opts.GasPrice, nil), nil
+	}
+	//公链节点还没有看到刚发送的交易,nonce依然是连续的
+	for i := 0; i < 3; i++ {
+		_, err := m.transact(auth, transact)
+		assert.Nil(t, err)
+	}
+	assert.EqualValues(t, []uint64{5, 6, 7}, sent)
+	//发送失败的nonce没有被占用,留给下一笔交易
+	_, err := m.transact(auth, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return nil, errors.New("insufficient funds for gas * price + value")
+	})
+	assert.NotNil(t, err)
+	_, err = m.transact(auth, transact)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 8, sent[3])
+	//公链已经看到了前面的交易
+	pending = 9
+	_, err = m.transact(auth, transact)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 9, sent[4])
+	assert.Len(t, m.pending, 1)
+	//nonce被其他交易用掉了,换下一个nonce重试
+	tried := 0
+	_, err = m.transact(auth, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		tried++
+		if tried == 1 {
+			sent = append(sent, opts.Nonce.Uint64())
+			return nil, errors.New("nonce too low")
+		}
+		return transact(opts)
+	})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []uint64{10, 11}, sent[5:])
+}
+
+func TestNonceManagerReleaseDroppedTx(t *testing.T) {
+	defer func(timeout time.Duration) {
+		params.NonceReserveTimeout = timeout
+	}(params.NonceReserveTimeout)
+	params.NonceReserveTimeout = time.Hour
+	dropped := make(map[common.Hash]bool)
+	m := newNonceManager(func() (uint64, error) {
+		return 5, nil
+	}, func(txHash common.Hash) bool {
+		return dropped[txHash]
+	})
+	auth := &bind.TransactOpts{GasPrice: big.NewInt(1)}
+	var sent []uint64
+	transact := func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		sent = append(sent, opts.Nonce.Uint64())
+		return types.NewTransaction(opts.Nonce.Uint64(), common.Address{}, nil, 0, opts.GasPrice, []byte{byte(len(sent))}), nil
+	}
+	tx, err := m.transact(auth, transact)
+	assert.Nil(t, err)
+	dropped[tx.Hash()] = true
+	//没有超时之前,即使交易已经被丢弃也不释放nonce
+	_, err = m.transact(auth, transact)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []uint64{5, 6}, sent)
+	//超时后被丢弃的交易释放nonce,还在交易池中的继续占用
+	params.NonceReserveTimeout = 0
+	_, err = m.transact(auth, transact)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []uint64{5, 6, 5}, sent)
+	_, err = m.transact(auth, transact)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []uint64{5, 6, 5, 7}, sent)
+}
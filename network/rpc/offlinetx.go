@@ -0,0 +1,108 @@
+package rpc
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/network/rpc/contracts"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/transfer/mtree"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	tokensNetworkABI     abi.ABI
+	tokensNetworkABIErr  error
+	tokensNetworkABIOnce sync.Once
+)
+
+func packTokensNetwork(method string, args ...interface{}) ([]byte, error) {
+	tokensNetworkABIOnce.Do(func() {
+		tokensNetworkABI, tokensNetworkABIErr = abi.JSON(strings.NewReader(contracts.TokensNetworkABI))
+	})
+	if tokensNetworkABIErr != nil {
+		return nil, tokensNetworkABIErr
+	}
+	return tokensNetworkABI.Pack(method, args...)
+}
+
+//PackUpdateBalanceProof returns call data of updateBalanceProof, the same as UpdateBalanceProof sends
+func (t *TokenNetworkProxy) PackUpdateBalanceProof(partnerAddr common.Address, transferAmount *big.Int, locksRoot common.Hash, nonce uint64, extraHash common.Hash, signature []byte) ([]byte, error) {
+	return packTokensNetwork("updateBalanceProof", t.token, partnerAddr, transferAmount, locksRoot, nonce, extraHash, signature)
+}
+
+//PackUnlock returns call data of unlock, the same as Unlock sends
+func (t *TokenNetworkProxy) PackUnlock(partnerAddr common.Address, transferAmount *big.Int, lock *mtree.Lock, proof []byte) ([]byte, error) {
+	return packTokensNetwork("unlock", t.token, partnerAddr, transferAmount, big.NewInt(lock.Expiration), lock.Amount, lock.LockSecretHash, proof)
+}
+
+//PackSettle returns call data of settle, the same as SettleChannel sends
+func (t *TokenNetworkProxy) PackSettle(p1Addr, p2Addr common.Address, p1Amount, p2Amount *big.Int, p1Locksroot, p2Locksroot common.Hash) ([]byte, error) {
+	return packTokensNetwork("settle", t.token, p1Addr, p1Amount, p1Locksroot, p2Addr, p2Amount, p2Locksroot)
+}
+
+/*
+OfflineTxParams 离线签名需要的nonce和gasPrice,nonce是from下一笔交易可用的nonce
+*/
+func (bcs *BlockChainService) OfflineTxParams(from common.Address) (nonce uint64, gasPrice *big.Int, chainID *big.Int, err error) {
+	nonce, err = bcs.Client.PendingNonceAt(GetQueryConext(), from)
+	if err != nil {
+		return
+	}
+	gasPrice, err = bcs.Client.SuggestGasPrice(GetQueryConext())
+	if err != nil {
+		return
+	}
+	chainID, err = bcs.Client.NetworkID(GetQueryConext())
+	return
+}
+
+/*
+DecodeOfflineTx 解析签名后的交易,并校验它确实是签名者对expected的签名,任何字段不一致都拒绝
+*/
+func DecodeOfflineTx(raw []byte, expected *models.OfflineTx, signer common.Address) (tx *types.Transaction, err error) {
+	tx = new(types.Transaction)
+	err = rlp.DecodeBytes(raw, tx)
+	if err != nil {
+		return nil, rerr.ErrArgumentError.Printf("decode signed tx err %s", err)
+	}
+	var s types.Signer = types.HomesteadSigner{}
+	if tx.Protected() {
+		if expected.ChainID != nil && tx.ChainId().Cmp(expected.ChainID) != 0 {
+			return nil, rerr.ErrArgumentError.Printf("signed tx chain id %s, expect %s", tx.ChainId(), expected.ChainID)
+		}
+		s = types.NewEIP155Signer(tx.ChainId())
+	}
+	from, err := types.Sender(s, tx)
+	if err != nil {
+		return nil, rerr.ErrArgumentError.Printf("recover signer err %s", err)
+	}
+	if from != signer {
+		return nil, rerr.ErrArgumentError.Printf("tx signed by %s, expect %s", from.String(), signer.String())
+	}
+	if tx.To() == nil || *tx.To() != expected.To ||
+		tx.Nonce() != expected.Nonce ||
+		tx.Gas() != expected.GasLimit ||
+		tx.GasPrice().Cmp(expected.GasPrice) != 0 ||
+		tx.Value().Sign() != 0 ||
+		!bytes.Equal(tx.Data(), expected.Data) {
+		return nil, rerr.ErrArgumentError.Printf("signed tx does not match %s payload with nonce %d", expected.Kind, expected.Nonce)
+	}
+	return tx, nil
+}
+
+//SendSignedTransaction submits a tx signed elsewhere
+func (bcs *BlockChainService) SendSignedTransaction(tx *types.Transaction) error {
+	err := bcs.Client.SendTransaction(GetCallContext(), tx)
+	if err != nil {
+		return rerr.ContractCallError(fmt.Errorf("send tx %s err %s", tx.Hash().String(), err))
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package rpc
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeOfflineTx(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+	tn := &TokenNetworkProxy{token: utils.NewRandomAddress()}
+	data, err := tn.PackSettle(signer, utils.NewRandomAddress(), big.NewInt(1), big.NewInt(2), utils.NewRandomHash(), utils.NewRandomHash())
+	assert.Nil(t, err)
+	expected := &models.OfflineTx{
+		Kind:     models.OfflineTxKindSettle,
+		To:       utils.NewRandomAddress(),
+		Data:     data,
+		Nonce:    3,
+		GasPrice: big.NewInt(100),
+		GasLimit: 500000,
+		ChainID:  big.NewInt(8888),
+	}
+	sign := func(data []byte) []byte {
+		tx := types.NewTransaction(expected.Nonce, expected.To, new(big.Int), expected.GasLimit, expected.GasPrice, data)
+		tx, err = types.SignTx(tx, types.NewEIP155Signer(expected.ChainID), key)
+		assert.Nil(t, err)
+		raw, err := rlp.EncodeToBytes(tx)
+		assert.Nil(t, err)
+		return raw
+	}
+	tx, err := DecodeOfflineTx(sign(data), expected, signer)
+	assert.Nil(t, err)
+	assert.EqualValues(t, expected.Nonce, tx.Nonce())
+	//签名的不是准备好的数据
+	_, err = DecodeOfflineTx(sign([]byte("other")), expected, signer)
+	assert.NotNil(t, err)
+	//签名者不对
+	_, err = DecodeOfflineTx(sign(data), expected, utils.NewRandomAddress())
+	assert.NotNil(t, err)
+	_, err = DecodeOfflineTx([]byte("garbage"), expected, signer)
+	assert.NotNil(t, err)
+}
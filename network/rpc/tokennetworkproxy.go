@@ -17,6 +17,7 @@ import (
 	"github.com/SmartMeshFoundation/Photon/utils"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 )
 
 //RegistryProxy 只是为了表达方便,兼容以前代码,todo 完全去掉registry信息
@@ -87,19 +88,25 @@ func (t *TokenNetworkProxy) newChannelAndDepositByFallback(token *TokenProxy, pa
 	return token.TransferWithFallback(t.Address, amount, data, depositTXParams)
 }
 
+//maxApproveAmount 无限授权时approve的额度
+var maxApproveAmount = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+//approveAmount 配置了无限授权时一次授权最大额度,否则只授权这次存款的金额
+func approveAmount(amount *big.Int) *big.Int {
+	if params.InfiniteApprove {
+		return maxApproveAmount
+	}
+	return amount
+}
+
 /*
-todo 目前这个处理流程有问题,必须要将相应的信息存入数据库中
+newChannelAndDepositByApprove 已有的授权足够时直接调用deposit,否则先approve,
+approve打包成功以后由BlockChainService根据保存的TXInfo继续deposit
 */
 func (t *TokenNetworkProxy) newChannelAndDepositByApprove(token *TokenProxy, participantAddress, partnerAddress common.Address, settleTimeout int, amount *big.Int) (err error) {
 	log.Info(fmt.Sprintf("newChannelAndDepositByApprove participant=%s,partner=%s,settletimeout=%d,amount=%s,token=%s",
 		utils.APex2(participantAddress), utils.APex2(partnerAddress), settleTimeout, amount, utils.APex2(t.token),
 	))
-	tx, err := token.Token.Approve(t.bcs.Auth, t.Address, amount)
-	if err != nil {
-		return rerr.ContractCallError(err)
-	}
-	// 保存TXInfo并注册到bcs中监控其执行结果
-	channelID := utils.CalcChannelID(token.Address, t.Address, participantAddress, partnerAddress)
 	txParams := &models.DepositTXParams{
 		TokenAddress:       t.token,
 		ParticipantAddress: participantAddress,
@@ -107,43 +114,49 @@ func (t *TokenNetworkProxy) newChannelAndDepositByApprove(token *TokenProxy, par
 		Amount:             amount,
 		SettleTimeout:      uint64(settleTimeout),
 	}
+	allowance, err := token.Allowance(participantAddress, t.Address)
+	if err != nil {
+		return err
+	}
+	if allowance.Cmp(amount) >= 0 {
+		return t.depositWithAllowance(txParams)
+	}
+	value := approveAmount(amount)
+	tx, err := t.bcs.transact(func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return token.Token.Approve(opts, t.Address, value)
+	})
+	if err != nil {
+		if e := rerr.ContractCallError(err); e.ErrorCode == rerr.ErrInsufficientBalanceForGas.ErrorCode {
+			return e
+		}
+		return rerr.ErrInsufficientAllowance.Printf("allowance=%s,amount=%s,approve err %s", allowance, amount, err)
+	}
+	log.Info(fmt.Sprintf("Approve %s,value=%s,txhash=%s", utils.APex(t.Address), value, tx.Hash().String()))
+	// 保存TXInfo并注册到bcs中监控其执行结果
+	channelID := utils.CalcChannelID(token.Address, t.Address, participantAddress, partnerAddress)
 	txInfo, err := t.bcs.TXInfoDao.NewPendingTXInfo(tx, models.TXInfoTypeApproveDeposit, channelID, 0, txParams)
 	if err != nil {
 		return rerr.ContractCallError(err)
 	}
 	t.bcs.RegisterPendingTXInfo(txInfo)
-	//log.Info(fmt.Sprintf("Approve %s, txhash=%s", utils.APex(t.Address), tx.Hash().String()))
-	//go func() {
-	//	receipt, err := bind.WaitMined(GetCallContext(), t.bcs.Client, tx)
-	//	if err != nil {
-	//		log.Error(fmt.Sprintf("Approve waitmined err,txhash=%s,err=%s", tx.Hash().String(), err))
-	//		return
-	//	}
-	//	if receipt.Status != types.ReceiptStatusSuccessful {
-	//		log.Error(fmt.Sprintf("Approve failed %s,receipt=%s", utils.APex(t.Address), receipt))
-	//		return
-	//	}
-	//	log.Info(fmt.Sprintf("Approve success %s,spender=%s,value=%d", utils.APex(t.Address), utils.APex(t.Address), amount))
-	//
-	//	tx, err = t.GetContract().Deposit(t.bcs.Auth, t.token, participantAddress, partnerAddress, amount, uint64(settleTimeout))
-	//	if err != nil {
-	//		return
-	//	}
-	//	log.Info(fmt.Sprintf("OpenChannelWithDeposit  txhash=%s", tx.Hash().String()))
-	//	receipt, err = bind.WaitMined(GetCallContext(), t.bcs.Client, tx)
-	//	if err != nil {
-	//		log.Error(fmt.Sprintf("OpenChannelWithDeposit waitmined err, txhash=%s,err=%s", tx.Hash().String(), err))
-	//		return
-	//	}
-	//	if receipt.Status != types.ReceiptStatusSuccessful {
-	//		log.Error(fmt.Sprintf("OpenChannelWithDeposit failed %s", receipt))
-	//		return
-	//	}
-	//	log.Info(fmt.Sprintf("OpenChannelWithDeposit success %s txhash=%s", utils.APex(t.Address), tx.Hash().String()))
-	//	return
-	//}()
 	return nil
+}
 
+//depositWithAllowance 授权已经足够,直接调用合约的deposit,不等待打包
+func (t *TokenNetworkProxy) depositWithAllowance(txParams *models.DepositTXParams) error {
+	tx, err := t.bcs.transact(func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return t.GetContract().Deposit(opts, txParams.TokenAddress, txParams.ParticipantAddress, txParams.PartnerAddress, txParams.Amount, txParams.SettleTimeout)
+	})
+	if err != nil {
+		return rerr.ContractCallError(err)
+	}
+	channelID := utils.CalcChannelID(txParams.TokenAddress, t.bcs.RegistryProxy.Address, txParams.ParticipantAddress, txParams.PartnerAddress)
+	txInfo, err := t.bcs.TXInfoDao.NewPendingTXInfo(tx, models.TXInfoTypeDeposit, channelID, 0, txParams)
+	if err != nil {
+		return rerr.ContractCallError(err)
+	}
+	t.bcs.RegisterPendingTXInfo(txInfo)
+	return nil
 }
 
 //NewChannelAndDeposit create new channel ,block until a new channel create
@@ -186,7 +199,9 @@ func (t *TokenNetworkProxy) newChannelAndDepositOnSMTToken(tokenAddress common.A
 	// 在Auth中设置金额,不用t.bcs.Auth,避免影响其他交易
 	auth := bind.NewKeyedTransactor(t.bcs.PrivKey)
 	auth.Value = amount
-	tx, err := smtTokenProxy.BuyAndTransfer(auth, data)
+	tx, err := t.bcs.nonces.transact(auth, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return smtTokenProxy.BuyAndTransfer(opts, data)
+	})
 	if err != nil {
 		return rerr.ContractCallError(err)
 	}
@@ -235,6 +250,13 @@ func (t *TokenNetworkProxy) NewChannelAndDepositAsync(participantAddress, partne
 	if name == params.SMTTokenName {
 		return t.newChannelAndDepositOnSMTToken(tokenAddr, participantAddress, partnerAddress, settleTimeout, amount)
 	}
+	balance, err := token.BalanceOf(participantAddress)
+	if err != nil {
+		return err
+	}
+	if balance.Cmp(amount) < 0 {
+		return rerr.ErrInsufficientTokenBalance.Printf("balance=%s,amount=%s", balance, amount)
+	}
 	err = t.newChannelAndDepositByFallback(token, participantAddress, partnerAddress, settleTimeout, amount)
 	if err == nil {
 		log.Trace(fmt.Sprintf("%s-%s newChannelAndDepositByFallback success", utils.APex(tokenAddr), utils.APex(participantAddress)))
@@ -273,7 +295,9 @@ func (t *TokenNetworkProxy) GetContract() *contracts.TokensNetwork {
 
 //CloseChannel close channel
 func (t *TokenNetworkProxy) CloseChannel(partnerAddr common.Address, transferAmount *big.Int, locksRoot common.Hash, nonce uint64, extraHash common.Hash, signature []byte) (err error) {
-	tx, err := t.GetContract().PrepareSettle(t.bcs.Auth, t.token, partnerAddr, transferAmount, locksRoot, uint64(nonce), extraHash, signature)
+	tx, err := t.bcs.transact(func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return t.GetContract().PrepareSettle(opts, t.token, partnerAddr, transferAmount, locksRoot, uint64(nonce), extraHash, signature)
+	})
 	if err != nil {
 		return rerr.ContractCallError(err)
 	}
@@ -308,7 +332,9 @@ func (t *TokenNetworkProxy) CloseChannel(partnerAddr common.Address, transferAmo
 
 //CloseChannelAsync close channel async 认为只要交易进入了缓冲池中,肯定会成功.
 func (t *TokenNetworkProxy) CloseChannelAsync(partnerAddr common.Address, transferAmount *big.Int, locksRoot common.Hash, nonce uint64, extraHash common.Hash, signature []byte) (err error) {
-	tx, err := t.GetContract().PrepareSettle(t.bcs.Auth, t.token, partnerAddr, transferAmount, locksRoot, uint64(nonce), extraHash, signature)
+	tx, err := t.bcs.transact(func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return t.GetContract().PrepareSettle(opts, t.token, partnerAddr, transferAmount, locksRoot, uint64(nonce), extraHash, signature)
+	})
 	if err != nil {
 		return rerr.ContractCallError(err)
 	}
@@ -347,7 +373,9 @@ func (t *TokenNetworkProxy) CloseChannelAsync(partnerAddr common.Address, transf
 
 //UpdateBalanceProof update balance proof of partner
 func (t *TokenNetworkProxy) UpdateBalanceProof(partnerAddr common.Address, transferAmount *big.Int, locksRoot common.Hash, nonce uint64, extraHash common.Hash, signature []byte) (err error) {
-	tx, err := t.GetContract().UpdateBalanceProof(t.bcs.Auth, t.token, partnerAddr, transferAmount, locksRoot, nonce, extraHash, signature)
+	tx, err := t.bcs.transact(func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return t.GetContract().UpdateBalanceProof(opts, t.token, partnerAddr, transferAmount, locksRoot, nonce, extraHash, signature)
+	})
 	if err != nil {
 		return rerr.ContractCallError(err)
 	}
@@ -396,7 +424,9 @@ func (t *TokenNetworkProxy) UpdateBalanceProofAsync(partnerAddr common.Address,
 
 //Unlock a partner's lock
 func (t *TokenNetworkProxy) Unlock(partnerAddr common.Address, transferAmount *big.Int, lock *mtree.Lock, proof []byte) (err error) {
-	tx, err := t.GetContract().Unlock(t.bcs.Auth, t.token, partnerAddr, transferAmount, big.NewInt(lock.Expiration), lock.Amount, lock.LockSecretHash, proof)
+	tx, err := t.bcs.unlocks.send(t.bcs.Auth, t.bcs.nonces, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return t.GetContract().Unlock(opts, t.token, partnerAddr, transferAmount, big.NewInt(lock.Expiration), lock.Amount, lock.LockSecretHash, proof)
+	})
 	if err != nil {
 		return rerr.ContractCallError(err)
 	}
@@ -441,7 +471,9 @@ func (t *TokenNetworkProxy) UnlockAsync(partnerAddr common.Address, transferAmou
 
 //SettleChannel settle a channel
 func (t *TokenNetworkProxy) SettleChannel(p1Addr, p2Addr common.Address, p1Amount, p2Amount *big.Int, p1Locksroot, p2Locksroot common.Hash) (err error) {
-	tx, err := t.GetContract().Settle(t.bcs.Auth, t.token, p1Addr, p1Amount, p1Locksroot, p2Addr, p2Amount, p2Locksroot)
+	tx, err := t.bcs.transact(func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return t.GetContract().Settle(opts, t.token, p1Addr, p1Amount, p1Locksroot, p2Addr, p2Amount, p2Locksroot)
+	})
 	if err != nil {
 		return rerr.ContractCallError(err)
 	}
@@ -475,7 +507,9 @@ func (t *TokenNetworkProxy) SettleChannel(p1Addr, p2Addr common.Address, p1Amoun
 
 //SettleChannelAsync settle a channel async 进入缓冲池就认为成功了
 func (t *TokenNetworkProxy) SettleChannelAsync(p1Addr, p2Addr common.Address, p1Amount, p2Amount *big.Int, p1Locksroot, p2Locksroot common.Hash) (err error) {
-	tx, err := t.GetContract().Settle(t.bcs.Auth, t.token, p1Addr, p1Amount, p1Locksroot, p2Addr, p2Amount, p2Locksroot)
+	tx, err := t.bcs.transact(func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return t.GetContract().Settle(opts, t.token, p1Addr, p1Amount, p1Locksroot, p2Addr, p2Amount, p2Locksroot)
+	})
 	if err != nil {
 		return rerr.ContractCallError(err)
 	}
@@ -513,9 +547,11 @@ func (t *TokenNetworkProxy) SettleChannelAsync(p1Addr, p2Addr common.Address, p1
 //Withdraw  to  a channel
 func (t *TokenNetworkProxy) Withdraw(p1Addr, p2Addr common.Address, p1Balance,
 	p1Withdraw *big.Int, p1Signature, p2Signature []byte) (err error) {
-	tx, err := t.GetContract().WithDraw(t.bcs.Auth, t.token, p1Addr, p2Addr, p1Balance, p1Withdraw,
-		p1Signature, p2Signature,
-	)
+	tx, err := t.bcs.transact(func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return t.GetContract().WithDraw(opts, t.token, p1Addr, p2Addr, p1Balance, p1Withdraw,
+			p1Signature, p2Signature,
+		)
+	})
 	if err != nil {
 		return rerr.ContractCallError(err)
 	}
@@ -560,7 +596,9 @@ func (t *TokenNetworkProxy) WithdrawAsync(p1Addr, p2Addr common.Address, p1Balan
 
 //PunishObsoleteUnlock  to  a channel
 func (t *TokenNetworkProxy) PunishObsoleteUnlock(beneficiary, cheater common.Address, lockhash, extraHash common.Hash, cheaterSignature []byte) (err error) {
-	tx, err := t.GetContract().PunishObsoleteUnlock(t.bcs.Auth, t.token, beneficiary, cheater, lockhash, extraHash, cheaterSignature)
+	tx, err := t.bcs.transact(func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return t.GetContract().PunishObsoleteUnlock(opts, t.token, beneficiary, cheater, lockhash, extraHash, cheaterSignature)
+	})
 	if err != nil {
 		return rerr.ContractCallError(err)
 	}
@@ -603,7 +641,9 @@ func (t *TokenNetworkProxy) PunishObsoleteUnlockAsync(beneficiary, cheater commo
 
 //CooperativeSettle  settle  a channel
 func (t *TokenNetworkProxy) CooperativeSettle(p1Addr, p2Addr common.Address, p1Balance, p2Balance *big.Int, p1Signature, p2Signatue []byte) (err error) {
-	tx, err := t.GetContract().CooperativeSettle(t.bcs.Auth, t.token, p1Addr, p1Balance, p2Addr, p2Balance, p1Signature, p2Signatue)
+	tx, err := t.bcs.transact(func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return t.GetContract().CooperativeSettle(opts, t.token, p1Addr, p1Balance, p2Addr, p2Balance, p1Signature, p2Signatue)
+	})
 	if err != nil {
 		return rerr.ContractCallError(err)
 	}
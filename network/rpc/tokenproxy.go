@@ -42,12 +42,12 @@ func (t *TokenProxy) BalanceOf(addr common.Address) (*big.Int, error) {
 // Allowance Amount of remaining tokens allowed to spent
 // @param _owner The address of the account owning tokens
 // @param _spender The address of the account able to transfer the tokens
-func (t *TokenProxy) Allowance(owner, spender common.Address) (int64, error) {
+func (t *TokenProxy) Allowance(owner, spender common.Address) (*big.Int, error) {
 	amount, err := t.Token.Allowance(t.bcs.getQueryOpts(), owner, spender)
 	if err != nil {
-		return 0, rerr.ContractCallError(err)
+		return nil, rerr.ContractCallError(err)
 	}
-	return amount.Int64(), nil //todo if amount larger than max int64?
+	return amount, nil
 }
 
 // Approve Whether the approval was successful or not
@@ -56,7 +56,9 @@ func (t *TokenProxy) Allowance(owner, spender common.Address) (int64, error) {
 // @param _value The amount of wei to be approved for transfer
 //注意此函数并不会等待打包成功才返回,只要交易进入缓冲池就返回
 func (t *TokenProxy) Approve(spender common.Address, value *big.Int) (err error) {
-	tx, err := t.Token.Approve(t.bcs.Auth, spender, value)
+	tx, err := t.bcs.transact(func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return t.Token.Approve(opts, spender, value)
+	})
 	if err != nil {
 		return rerr.ContractCallError(err)
 	}
@@ -83,7 +85,9 @@ func (t *TokenProxy) Transfer(spender common.Address, value *big.Int) (err error
 	if err != nil {
 		return
 	}
-	tx, err := t.Token.TransferFrom(t.bcs.Auth, t.bcs.Auth.From, spender, value)
+	tx, err := t.bcs.transact(func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return t.Token.TransferFrom(opts, t.bcs.Auth.From, spender, value)
+	})
 	if err != nil {
 		return rerr.ContractCallError(err)
 	}
@@ -111,7 +115,9 @@ func (t *TokenProxy) TransferAsync(spender common.Address, value *big.Int) (resu
 
 //TransferWithFallback ERC223 TokenFallback,进入缓冲池以后就认为不可能会失败,不等待打包
 func (t *TokenProxy) TransferWithFallback(to common.Address, value *big.Int, extraData []byte, txParams *models.DepositTXParams) (err error) {
-	tx, err := t.Token.Transfer(t.bcs.Auth, to, value, extraData)
+	tx, err := t.bcs.transact(func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return t.Token.Transfer(opts, to, value, extraData)
+	})
 	if err != nil {
 		return rerr.ContractCallError(err)
 	}
@@ -145,7 +151,9 @@ func (t *TokenProxy) TransferWithFallback(to common.Address, value *big.Int, ext
 
 //ApproveAndCall ERC20 extend,进入缓冲池以后就认为不可能会失败,不等待打包
 func (t *TokenProxy) ApproveAndCall(spender common.Address, value *big.Int, extraData []byte, txParams *models.DepositTXParams) (err error) {
-	tx, err := t.Token.ApproveAndCall(t.bcs.Auth, spender, value, extraData)
+	tx, err := t.bcs.transact(func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return t.Token.ApproveAndCall(opts, spender, value, extraData)
+	})
 	if err != nil {
 		return rerr.ContractCallError(err)
 	}
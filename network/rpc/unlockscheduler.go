@@ -0,0 +1,46 @@
+package rpc
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+/*
+unlockScheduler 协调多个通道的Unlock交易.
+多个通道差不多同时settle时,每个通道都在自己的goroutine中发送Unlock,nonce由nonceManager统一分配,
+同一轮中的Unlock使用相同的gasPrice,超过params.UnlockRoundIdleTime没有新的Unlock则开始新的一轮.
+*/
+type unlockScheduler struct {
+	lock     sync.Mutex
+	gasPrice *big.Int
+	lastSend time.Time
+}
+
+/*
+send 使用本轮的gasPrice,通过nonces分配nonce后调用`transact`发送交易.
+*/
+func (s *unlockScheduler) send(auth *bind.TransactOpts, nonces *nonceManager,
+	transact func(opts *bind.TransactOpts) (*types.Transaction, error)) (tx *types.Transaction, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if time.Since(s.lastSend) > params.UnlockRoundIdleTime {
+		s.gasPrice = auth.GasPrice
+		log.Info(fmt.Sprintf("start new unlock round, gasPrice=%s", s.gasPrice))
+	}
+	opts := *auth
+	opts.GasPrice = s.gasPrice
+	tx, err = nonces.transact(&opts, transact)
+	if err != nil {
+		s.lastSend = time.Time{}
+		return
+	}
+	s.lastSend = time.Now()
+	return
+}
@@ -0,0 +1,60 @@
+package rpc
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnlockScheduler(t *testing.T) {
+	var s unlockScheduler
+	auth := &bind.TransactOpts{GasPrice: big.NewInt(params.DefaultGasPrice)}
+	pending := uint64(5)
+	pendingNonce := func() (uint64, error) {
+		return pending, nil
+	}
+	nonces := newNonceManager(pendingNonce, func(common.Hash) bool {
+		return false
+	})
+	var sent []uint64
+	transact := func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		sent = append(sent, opts.Nonce.Uint64())
+		assert.EqualValues(t, params.DefaultGasPrice, opts.GasPrice.Int64())
+		return types.NewTransaction(opts.Nonce.Uint64(), common.Address{}, nil, 0, opts.GasPrice, nil), nil
+	}
+	//公链节点还没有看到刚发送的交易,nonce依然是连续的
+	for i := 0; i < 3; i++ {
+		_, err := s.send(auth, nonces, transact)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	assert.EqualValues(t, []uint64{5, 6, 7}, sent)
+	//同一轮中修改gasPrice不影响已经开始的这一轮
+	auth.GasPrice = big.NewInt(1)
+	//其他交易占用了nonce
+	pending = 10
+	_, err := s.send(auth, nonces, transact)
+	if err != nil {
+		t.Error(err)
+	}
+	assert.EqualValues(t, 10, sent[3])
+	//发送失败以后重新从公链获取nonce
+	_, err = s.send(auth, nonces, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return nil, errors.New("nonce too low")
+	})
+	assert.NotNil(t, err)
+	pending = 3
+	auth.GasPrice = big.NewInt(params.DefaultGasPrice)
+	_, err = s.send(auth, nonces, transact)
+	if err != nil {
+		t.Error(err)
+	}
+	assert.EqualValues(t, 3, sent[4])
+}
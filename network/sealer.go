@@ -0,0 +1,91 @@
+package network
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+/*
+开启params.TransportEncryption以后,发给其他节点的消息都用对方的公钥加密,路径上的第三方(比如matrix或者xmpp服务器)
+无法看到交易金额,密码和BalanceProof.
+对方的公钥从它签名的消息中恢复,还不知道对方公钥时先发送不加密的Ping,对方收到以后也会用Ping告诉我们它的公钥.
+消息本身的签名保证了发送方的身份,解密以后和普通消息的处理完全一样.
+*/
+
+var errPeerKeyUnknown = errors.New("public key of peer is unknown")
+
+//learnPeerKey 从对方签名的消息中恢复公钥,开启加密时用Ping把自己的公钥告诉对方
+func (p *PhotonProtocol) learnPeerKey(sender common.Address, data []byte) {
+	if p.peerKey(sender) != nil {
+		return
+	}
+	key, err := encoding.RecoverPublicKey(data)
+	if err != nil || crypto.PubkeyToAddress(*key) != sender {
+		return
+	}
+	p.peerKeysLock.Lock()
+	p.peerKeys[sender] = key
+	p.peerKeysLock.Unlock()
+	if params.TransportEncryption {
+		err = p.SendPing(sender)
+		if err != nil {
+			p.log.Info(fmt.Sprintf("send ping to %s for key exchange err %s", utils.APex2(sender), err))
+		}
+	}
+}
+
+func (p *PhotonProtocol) peerKey(addr common.Address) *ecdsa.PublicKey {
+	p.peerKeysLock.RLock()
+	defer p.peerKeysLock.RUnlock()
+	return p.peerKeys[addr]
+}
+
+/*
+sealFrame 开启加密时把消息加密发给`receiver`,Ping不加密,用来交换公钥.
+不知道对方公钥时返回errPeerKeyUnknown,调用者应该稍后重试.
+明文不能超过params.UDPMaxMessageSize,加密以后的帧最多比明文大encoding.SealOverhead,和openFrame接受的大小一致
+*/
+func (p *PhotonProtocol) sealFrame(receiver common.Address, data []byte) ([]byte, error) {
+	if !params.TransportEncryption || data[0] == encoding.PingCmdID {
+		return data, nil
+	}
+	if len(data) > params.UDPMaxMessageSize {
+		return nil, fmt.Errorf("message larger than maximum size %d", len(data))
+	}
+	key := p.peerKey(receiver)
+	if key == nil {
+		return nil, errPeerKeyUnknown
+	}
+	sealed, err := encoding.NewSealed(key, data)
+	if err != nil {
+		return nil, err
+	}
+	return sealed.Pack(), nil
+}
+
+//openFrame 解密发给自己的Sealed,不允许嵌套
+func (p *PhotonProtocol) openFrame(data []byte) ([]byte, error) {
+	if len(data) > params.UDPMaxMessageSize+encoding.SealOverhead {
+		return nil, fmt.Errorf("sealed packet larger than maximum size %d", len(data))
+	}
+	sealed := new(encoding.Sealed)
+	err := sealed.UnPack(data)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := sealed.Open(p.privKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(plain) == 0 || plain[0] == encoding.SealedCmdID {
+		return nil, errors.New("invalid sealed message")
+	}
+	return plain, nil
+}
@@ -0,0 +1,61 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSealFrame(t *testing.T) {
+	params.TransportEncryption = true
+	defer func() {
+		params.TransportEncryption = false
+	}()
+	key1, _ := crypto.GenerateKey()
+	key2, _ := crypto.GenerateKey()
+	p1 := NewPhotonProtocol(MakeTestUDPTransport("p1", randomPort()), key1, &testChannelStatusGetter{})
+	p2 := NewPhotonProtocol(MakeTestUDPTransport("p2", randomPort()), key2, &testChannelStatusGetter{})
+	ping := encoding.NewPing(3)
+	err := ping.Sign(key2, ping)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	//Ping不加密
+	frame, err := p1.sealFrame(p2.nodeAddr, ping.Pack())
+	assert.Nil(t, err)
+	assert.EqualValues(t, ping.Pack(), frame)
+	ack := encoding.NewAck(p1.nodeAddr, utils.Sha3(ping.Pack()))
+	_, err = p1.sealFrame(p2.nodeAddr, ack.Pack())
+	assert.Equal(t, errPeerKeyUnknown, err)
+	p1.learnPeerKey(p2.nodeAddr, ping.Pack())
+	frame, err = p1.sealFrame(p2.nodeAddr, ack.Pack())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.EqualValues(t, encoding.SealedCmdID, frame[0])
+	_, err = p1.openFrame(frame)
+	assert.NotNil(t, err)
+	plain, err := p2.openFrame(frame)
+	assert.Nil(t, err)
+	assert.EqualValues(t, ack.Pack(), plain)
+	//别人签名的消息不能冒充
+	p1.learnPeerKey(p1.nodeAddr, ping.Pack())
+	assert.Nil(t, p1.peerKey(p1.nodeAddr))
+	//最大的明文加密以后对方仍然可以解密,更大的拒绝加密
+	data := make([]byte, params.UDPMaxMessageSize)
+	data[0] = encoding.AckCmdID
+	frame, err = p1.sealFrame(p2.nodeAddr, data)
+	assert.Nil(t, err)
+	assert.True(t, len(frame) <= params.UDPMaxMessageSize+encoding.SealOverhead)
+	plain, err = p2.openFrame(frame)
+	assert.Nil(t, err)
+	assert.EqualValues(t, data, plain)
+	_, err = p1.sealFrame(p2.nodeAddr, append(data, 0))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,177 @@
+package network
+
+import (
+	"sync"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/params"
+)
+
+/*
+同时调用Transport.Send的数目限制为params.SendConcurrency,发送积压时按照优先级决定谁先发送:
+RevealSecret,SecretRequest,Unlock以及Ack这些影响锁能否及时解开的消息最优先,
+其次是其他带balance proof的消息,然后是新的MediatedTransfer,最后是Ping这类探测消息.
+快要过期的MediatedTransfer提升为最高优先级.
+每等待params.SendPriorityAging提升一级,低优先级的消息不会一直等待.
+同一个通道上带balance proof的消息仍然在通道队列中按照nonce的顺序发送,优先级只影响不同通道和不同节点之间的顺序
+*/
+
+//消息发送的优先级,数字越小越优先
+const (
+	SendPriorityCritical = iota
+	SendPriorityBalanceProof
+	SendPriorityNormal
+	SendPriorityLow
+)
+
+//BlockNumberGetter ChannelStatusGetter同时实现这个接口时,快要过期的MediatedTransfer会优先发送
+type BlockNumberGetter interface {
+	GetBlockNumber() int64
+}
+
+//framePriority 根据消息类型决定优先级
+func framePriority(cmd byte) int {
+	switch cmd {
+	case encoding.AckCmdID, encoding.DeliveredCmdID, encoding.RevealSecretCmdID, encoding.SecretRequestCmdID, encoding.UnlockCmdID:
+		return SendPriorityCritical
+	case encoding.DirectTransferCmdID, encoding.AnnounceDisposedTransferCmdID, encoding.AnnounceDisposedTransferResponseCmdID,
+		encoding.RemoveExpiredLockCmdID, encoding.WithdrawRequestCmdID, encoding.WithdrawResponseCmdID,
+		encoding.SettleRequestCmdID, encoding.SettleResponseCmdID:
+		return SendPriorityBalanceProof
+	case encoding.PingCmdID, encoding.UDPEndpointCmdID, encoding.NetworkStatsCmdID, encoding.CapacityUpdateCmdID, encoding.ChannelProbeCmdID:
+		return SendPriorityLow
+	}
+	return SendPriorityNormal
+}
+
+//messagePriority 和framePriority相同,但是离过期不到params.SendUrgentBlocks块的MediatedTransfer最优先
+func (p *PhotonProtocol) messagePriority(msg encoding.Messager, data []byte) int {
+	if mt, ok := msg.(*encoding.MediatedTransfer); ok {
+		if bg, ok := p.ChannelStatusGetter.(BlockNumberGetter); ok && mt.Expiration-bg.GetBlockNumber() <= params.SendUrgentBlocks {
+			return SendPriorityCritical
+		}
+	}
+	return framePriority(data[0])
+}
+
+type sendWaiter struct {
+	priority int
+	since    time.Time
+	seq      uint64
+	ready    chan struct{}
+}
+
+//effective 等待时间越长优先级越高
+func (w *sendWaiter) effective(now time.Time) int {
+	if params.SendPriorityAging <= 0 {
+		return w.priority
+	}
+	return w.priority - int(now.Sub(w.since)/params.SendPriorityAging)
+}
+
+//sendGate 限制同时发送的数目,空闲时按照优先级唤醒等待者
+type sendGate struct {
+	lock    sync.Mutex
+	free    int
+	seq     uint64
+	waiters []*sendWaiter
+	now     timeFunc
+	//每种优先级已经发送的消息个数
+	sent [SendPriorityLow + 1]int64
+}
+
+func newSendGate(concurrency int, now timeFunc) *sendGate {
+	return &sendGate{
+		free: concurrency,
+		now:  now,
+	}
+}
+
+/*
+acquire 获得发送的许可,`quit`关闭时返回false.
+返回true以后必须调用release
+*/
+func (g *sendGate) acquire(priority int, quit <-chan struct{}) bool {
+	g.lock.Lock()
+	g.sent[priority]++
+	if g.free > 0 && len(g.waiters) == 0 {
+		g.free--
+		g.lock.Unlock()
+		return true
+	}
+	g.seq++
+	w := &sendWaiter{
+		priority: priority,
+		since:    g.now(),
+		seq:      g.seq,
+		ready:    make(chan struct{}),
+	}
+	g.waiters = append(g.waiters, w)
+	g.lock.Unlock()
+	select {
+	case <-w.ready:
+		return true
+	case <-quit:
+		g.lock.Lock()
+		defer g.lock.Unlock()
+		for i, w2 := range g.waiters {
+			if w2 == w {
+				g.waiters = append(g.waiters[:i], g.waiters[i+1:]...)
+				return false
+			}
+		}
+		//已经被唤醒,把许可交给下一个
+		g.releaseLocked()
+		return false
+	}
+}
+
+//release 把许可交给优先级最高的等待者,同样优先级先来先得
+func (g *sendGate) release() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.releaseLocked()
+}
+
+func (g *sendGate) releaseLocked() {
+	if len(g.waiters) == 0 {
+		g.free++
+		return
+	}
+	now := g.now()
+	best := 0
+	for i, w := range g.waiters {
+		b := g.waiters[best]
+		if e, be := w.effective(now), b.effective(now); e < be || e == be && w.seq < b.seq {
+			best = i
+		}
+	}
+	w := g.waiters[best]
+	g.waiters = append(g.waiters[:best], g.waiters[best+1:]...)
+	close(w.ready)
+}
+
+//SendQueueStatus 发送积压的情况
+type SendQueueStatus struct {
+	Waiting []int   `json:"waiting"` //每种优先级正在等待发送的消息个数
+	Sent    []int64 `json:"sent"`    //每种优先级已经发送的消息个数,包括重发
+}
+
+func (g *sendGate) status() *SendQueueStatus {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	s := &SendQueueStatus{
+		Waiting: make([]int, len(g.sent)),
+		Sent:    append([]int64{}, g.sent[:]...),
+	}
+	for _, w := range g.waiters {
+		s.Waiting[w.priority]++
+	}
+	return s
+}
+
+//SendQueueStatus 返回按照优先级统计的发送积压,下标是SendPriorityCritical到SendPriorityLow
+func (p *PhotonProtocol) SendQueueStatus() *SendQueueStatus {
+	return p.sendGate.status()
+}
@@ -0,0 +1,69 @@
+package network
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendGate(t *testing.T) {
+	var lock sync.Mutex
+	now := time.Now()
+	g := newSendGate(1, func() time.Time {
+		lock.Lock()
+		defer lock.Unlock()
+		return now
+	})
+	quit := make(chan struct{})
+	assert.True(t, g.acquire(SendPriorityNormal, quit))
+	order := make(chan int, 10)
+	wait := func(priority int) {
+		go func() {
+			if g.acquire(priority, quit) {
+				order <- priority
+				g.release()
+			}
+		}()
+		time.Sleep(20 * time.Millisecond)
+	}
+	wait(SendPriorityLow)
+	wait(SendPriorityNormal)
+	wait(SendPriorityCritical)
+	assert.Equal(t, []int{1, 0, 1, 1}, g.status().Waiting)
+	g.release()
+	assert.Equal(t, SendPriorityCritical, <-order)
+	assert.Equal(t, SendPriorityNormal, <-order)
+	assert.Equal(t, SendPriorityLow, <-order)
+
+	//等待时间长的低优先级消息不会一直等待
+	assert.True(t, g.acquire(SendPriorityNormal, quit))
+	wait(SendPriorityLow)
+	lock.Lock()
+	now = now.Add(params.SendPriorityAging * 3)
+	lock.Unlock()
+	wait(SendPriorityCritical)
+	g.release()
+	assert.Equal(t, SendPriorityLow, <-order)
+	assert.Equal(t, SendPriorityCritical, <-order)
+
+	assert.True(t, g.acquire(SendPriorityNormal, quit))
+	done := make(chan bool)
+	go func() {
+		done <- g.acquire(SendPriorityLow, quit)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(quit)
+	assert.False(t, <-done)
+	assert.Equal(t, 0, g.status().Waiting[SendPriorityLow])
+}
+
+func TestFramePriority(t *testing.T) {
+	assert.Equal(t, SendPriorityCritical, framePriority(encoding.RevealSecretCmdID))
+	assert.Equal(t, SendPriorityBalanceProof, framePriority(encoding.RemoveExpiredLockCmdID))
+	assert.Equal(t, SendPriorityNormal, framePriority(encoding.MediatedTransferCmdID))
+	assert.Equal(t, SendPriorityLow, framePriority(encoding.PingCmdID))
+}
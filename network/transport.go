@@ -57,6 +57,19 @@ type Transporter interface {
 	NodeStatus(addr common.Address) (deviceType string, isOnline bool)
 }
 
+/*
+NodeAddressListener 节点在某个transport上的地址变化或者上线下线时得到通知,
+比如udp通过mdns或者打洞发现了对方的地址.不能阻塞,也不能再调用通知它的transport
+*/
+type NodeAddressListener interface {
+	NodeAddressChanged(addr common.Address, transport string, endpoint string, isOnline bool)
+}
+
+//NodeAddressNotifier 能够发现节点地址变化的Transporter实现这个接口
+type NodeAddressNotifier interface {
+	RegisterNodeAddressListener(l NodeAddressListener)
+}
+
 type dummyPolicy struct {
 }
 
@@ -105,6 +118,19 @@ func (tb *TokenBucket) Consume(tokens float64) time.Duration {
 	}
 	return time.Duration(waitTime * float64(time.Second))
 }
+/*
+TryConsume 令牌足够时扣除`tokens`并返回true,不够时什么也不扣,返回false.
+和Consume不同,调用者不会等待,直接丢弃超出的部分
+*/
+func (tb *TokenBucket) TryConsume(tokens float64) bool {
+	tb.getTokens()
+	if tb.Tokens < tokens {
+		return false
+	}
+	tb.Tokens -= tokens
+	return true
+}
+
 func (tb *TokenBucket) getTokens() {
 	now := tb.timeFunc()
 	fill := float64(now.Sub(tb.Timestamp)) / float64(time.Second)
@@ -141,6 +167,18 @@ type UDPTransport struct {
 	log                    log.Logger
 	msrv                   mdns.Service
 	cf                     context.CancelFunc
+	natQuit                chan struct{}                   //关闭时删除路由器上的端口映射
+	externalAddr           *net.UDPAddr                    //端口映射以后自己在公网上的地址
+	punchCandidates        map[common.Address]*net.UDPAddr //正在打洞的节点和它告诉我们的公网地址
+	endpointAnnounced      map[common.Address]time.Time
+	addressListeners       []NodeAddressListener
+}
+
+//nodeAddressChange 在锁外通知NodeAddressListener
+type nodeAddressChange struct {
+	addr     common.Address
+	endpoint *net.UDPAddr
+	isOnline bool
 }
 
 //NewUDPTransport create UDPTransport,name必须是完整的地址
@@ -156,6 +194,8 @@ func NewUDPTransport(name, host string, port int, protocol ProtocolReceiver, pol
 		log:                    log.New("name", name),
 		intranetNodes:          make(map[common.Address]*net.UDPAddr),
 		intranetNodesTimestamp: make(map[common.Address]time.Time),
+		punchCandidates:        make(map[common.Address]*net.UDPAddr),
+		endpointAnnounced:      make(map[common.Address]time.Time),
 	}
 	//127.0.0.1 作为一个特殊地址来处理,作为不启用mdns的指示,但是127.1.0.1等其他本机ip地址都认为有效
 	if params.EnableMDNS {
@@ -173,6 +213,10 @@ func NewUDPTransport(name, host string, port int, protocol ProtocolReceiver, pol
 
 //Start udp listening
 func (ut *UDPTransport) Start() {
+	err := ut.startPortMapping()
+	if err != nil {
+		ut.log.Error(fmt.Sprintf("udp port mapping err %s", err))
+	}
 	go func() {
 		data := make([]byte, 4096)
 		defer rpanic.PanicRecover("udptransport Start")
@@ -201,6 +245,9 @@ func (ut *UDPTransport) Start() {
 					}
 
 				}
+				if ut.receivePunch(data[:read], remoteAddr) {
+					continue
+				}
 				ut.log.Trace(fmt.Sprintf("receive from %s ,message=%s,hash=%s", remoteAddr,
 					encoding.MessageType(data[0]), utils.HPex(utils.Sha3(data[:read]))))
 				err = ut.Receive(data[:read])
@@ -259,13 +306,35 @@ func (ut *UDPTransport) getHostPort(addr common.Address) (ua *net.UDPAddr, err e
 	return
 }
 func (ut *UDPTransport) setHostPort(nodes map[common.Address]*net.UDPAddr) {
+	var changes []nodeAddressChange
+	defer func() { ut.notifyAddressChanged(changes) }()
 	ut.lock.Lock()
 	defer ut.lock.Unlock()
 	for k, v := range nodes {
+		if old, ok := ut.intranetNodes[k]; !ok || old.String() != v.String() {
+			changes = append(changes, nodeAddressChange{k, v, true})
+		}
 		ut.intranetNodes[k] = v
 	}
 }
 
+//RegisterNodeAddressListener implements NodeAddressNotifier, must be called before Start
+func (ut *UDPTransport) RegisterNodeAddressListener(l NodeAddressListener) {
+	ut.addressListeners = append(ut.addressListeners, l)
+}
+
+func (ut *UDPTransport) notifyAddressChanged(changes []nodeAddressChange) {
+	for _, c := range changes {
+		endpoint := ""
+		if c.endpoint != nil {
+			endpoint = c.endpoint.String()
+		}
+		for _, l := range ut.addressListeners {
+			l.NodeAddressChanged(c.addr, "udp", endpoint, c.isOnline)
+		}
+	}
+}
+
 //RegisterProtocol register receiver
 func (ut *UDPTransport) RegisterProtocol(proto ProtocolReceiver) {
 	ut.protocol = proto
@@ -282,6 +351,10 @@ func (ut *UDPTransport) Stop() {
 			log.Error(fmt.Sprintf("udp transport stop err %s", err))
 		}
 	}
+	if ut.natQuit != nil {
+		close(ut.natQuit)
+		ut.natQuit = nil
+	}
 	ut.stopReceiving = true
 	ut.stopped = true
 	ut.intranetNodes = make(map[common.Address]*net.UDPAddr)
@@ -310,6 +383,8 @@ func (ut *UDPTransport) NodeStatus(addr common.Address) (deviceType string, isOn
 
 //HandlePeerFound notification  from mdns
 func (ut *UDPTransport) HandlePeerFound(id string, addr *net.UDPAddr) {
+	var changes []nodeAddressChange
+	defer func() { ut.notifyAddressChanged(changes) }()
 	ut.lock.Lock()
 	defer ut.lock.Unlock()
 	idFound := common.HexToAddress(id)
@@ -334,12 +409,16 @@ func (ut *UDPTransport) HandlePeerFound(id string, addr *net.UDPAddr) {
 		delete(ut.intranetNodes, idToDelete)
 		delete(ut.intranetNodesTimestamp, idToDelete)
 		log.Info(fmt.Sprintf("peer UDP offline id=%s", idToDelete.String()))
+		changes = append(changes, nodeAddressChange{idToDelete, nil, false})
 	}
 	// 标记发现的除自己以外的节点
 	if id != ut.name {
 		if !alreadyFound {
 			log.Info(fmt.Sprintf("peer UDP found id=%s,addr=%s", id, addr))
 		}
+		if old, ok := ut.intranetNodes[idFound]; !ok || old.String() != addr.String() {
+			changes = append(changes, nodeAddressChange{idFound, addr, true})
+		}
 		ut.intranetNodes[idFound] = addr
 		ut.intranetNodesTimestamp[idFound] = now
 	}
@@ -486,9 +486,9 @@ type XMPPDb interface {
 	XMPPIsAddrSubed(addr common.Address) bool
 	XMPPMarkAddrSubed(addr common.Address)
 	GetChannelList(token, partner common.Address) (cs []*channeltype.Serialization, err error)
-	RegisterNewChannelCallback(f cb.ChannelCb)
-	RegisterChannelStateCallback(f cb.ChannelCb)
-	RegisterChannelSettleCallback(f cb.ChannelCb)
+	RegisterNewChannelCallback(f cb.ChannelCb) (id cb.ID)
+	RegisterChannelStateCallback(f cb.ChannelCb) (id cb.ID)
+	RegisterChannelSettleCallback(f cb.ChannelCb) (id cb.ID)
 	XMPPUnMarkAddr(addr common.Address)
 }
 
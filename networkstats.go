@@ -0,0 +1,189 @@
+package photon
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+//networkStatsReporterID 由私钥推导出匿名的统计ID,重启以后不变,其他节点无法由它得到节点地址
+func (rs *Service) networkStatsReporterID() common.Hash {
+	return utils.Sha3(crypto.FromECDSA(rs.PrivateKey), []byte("photon-network-stats"))
+}
+
+/*
+buildNetworkStatsReport 汇总打开的通道,通道只在自己地址较小时统计,容量是自己在通道中的余额
+*/
+func buildNetworkStatsReport(reporterID common.Hash, self common.Address, blockNumber int64, chs []*channeltype.Serialization) *models.NetworkStatsReport {
+	r := &models.NetworkStatsReport{
+		ReporterID:  reporterID,
+		BlockNumber: blockNumber,
+	}
+	tokens := make(map[common.Address]*models.TokenNetworkStats)
+	for _, ch := range chs {
+		if ch.State != channeltype.StateOpened {
+			continue
+		}
+		ts, ok := tokens[ch.TokenAddress()]
+		if !ok {
+			ts = &models.TokenNetworkStats{
+				Token:    ch.TokenAddress(),
+				Capacity: big.NewInt(0),
+			}
+			tokens[ch.TokenAddress()] = ts
+			r.Tokens = append(r.Tokens, ts)
+		}
+		if bytes.Compare(self[:], ch.PartnerAddressBytes) < 0 {
+			ts.Channels++
+		}
+		ts.Capacity.Add(ts.Capacity, ch.OurBalance())
+	}
+	return r
+}
+
+/*
+packNetworkStatsReports 把统计编码成json,自己的统计放在最前面,其余按照块号从新到旧,
+超过maxSize时丢弃最旧的统计
+*/
+func packNetworkStatsReports(own *models.NetworkStatsReport, others []*models.NetworkStatsReport, maxSize int) (data []byte, n int) {
+	sort.Slice(others, func(i, j int) bool {
+		return others[i].BlockNumber > others[j].BlockNumber
+	})
+	reports := append([]*models.NetworkStatsReport{own}, others...)
+	for n = len(reports); n > 0; n-- {
+		var err error
+		data, err = json.Marshal(reports[:n])
+		if err != nil {
+			log.Error(fmt.Sprintf("packNetworkStatsReports err %s", err))
+			return nil, 0
+		}
+		if len(data) <= maxSize {
+			return
+		}
+	}
+	return nil, 0
+}
+
+/*
+gossipNetworkStats 同意共享统计时,把自己和已知节点的统计发给所有有打开通道的伙伴,
+顺便清理太旧的统计
+*/
+func (rs *Service) gossipNetworkStats(blockNumber int64) {
+	if !rs.Config.ShareNetworkStats {
+		return
+	}
+	chs, err := rs.dao.GetChannelList(utils.EmptyAddress, utils.EmptyAddress)
+	if err != nil {
+		log.Error(fmt.Sprintf("gossipNetworkStats GetChannelList err %s", err))
+		return
+	}
+	own := buildNetworkStatsReport(rs.networkStatsReporterID(), rs.NodeAddress, blockNumber, chs)
+	others := rs.recentNetworkStatsReports(blockNumber)
+	data, n := packNetworkStatsReports(own, others, params.NetworkStatsMaxSize)
+	if n == 0 {
+		log.Warn("own network stats is too large to send")
+		return
+	}
+	partners := make(map[common.Address]bool)
+	for _, ch := range chs {
+		partner := ch.PartnerAddress()
+		if ch.State != channeltype.StateOpened || partners[partner] {
+			continue
+		}
+		partners[partner] = true
+		msg := encoding.NewNetworkStats(data)
+		err = msg.Sign(rs.PrivateKey, msg)
+		if err == nil {
+			err = rs.sendAsync(partner, msg)
+		}
+		if err != nil {
+			log.Warn(fmt.Sprintf("send network stats to %s err %s", utils.APex2(partner), err))
+		}
+	}
+	log.Trace(fmt.Sprintf("gossip %d network stats to %d partners", n, len(partners)))
+}
+
+/*
+recentNetworkStatsReports 返回保存的其他节点的统计,超过params.NetworkStatsMaxAge的统计从数据库中删除
+*/
+func (rs *Service) recentNetworkStatsReports(blockNumber int64) (reports []*models.NetworkStatsReport) {
+	all, err := rs.dao.GetAllNetworkStatsReports()
+	if err != nil {
+		log.Error(fmt.Sprintf("GetAllNetworkStatsReports err %s", err))
+		return
+	}
+	for _, r := range all {
+		if r.BlockNumber < blockNumber-params.NetworkStatsMaxAge {
+			err = rs.dao.RemoveNetworkStatsReport(r.ReporterID)
+			if err != nil {
+				log.Error(fmt.Sprintf("RemoveNetworkStatsReport err %s", err))
+			}
+			continue
+		}
+		reports = append(reports, r)
+	}
+	return
+}
+
+/*
+saveNetworkStats 保存伙伴转发来的统计,只在自己也同意共享统计时接收,每个节点只保留最新的一份
+*/
+func (rs *Service) saveNetworkStats(msg *encoding.NetworkStats) error {
+	if !rs.Config.ShareNetworkStats {
+		return nil
+	}
+	var reports []*models.NetworkStatsReport
+	err := json.Unmarshal(msg.Data, &reports)
+	if err != nil {
+		log.Warn(fmt.Sprintf("ignore invalid network stats from %s : %s", utils.APex2(msg.Sender), err))
+		return nil
+	}
+	blockNumber := rs.GetBlockNumber()
+	ownID := rs.networkStatsReporterID()
+	existing := make(map[common.Hash]int64)
+	all, err := rs.dao.GetAllNetworkStatsReports()
+	if err != nil {
+		return err
+	}
+	for _, r := range all {
+		existing[r.ReporterID] = r.BlockNumber
+	}
+	for _, r := range reports {
+		if r == nil || r.ReporterID == ownID || !validNetworkStatsReport(r, blockNumber) {
+			continue
+		}
+		if b, ok := existing[r.ReporterID]; ok && b >= r.BlockNumber {
+			continue
+		}
+		err = rs.dao.SaveNetworkStatsReport(r)
+		if err != nil {
+			return err
+		}
+		existing[r.ReporterID] = r.BlockNumber
+	}
+	return nil
+}
+
+//validNetworkStatsReport 丢弃太旧的,来自未来的以及数据不合法的统计,各节点看到的块号有先后,允许一个统计周期的误差
+func validNetworkStatsReport(r *models.NetworkStatsReport, blockNumber int64) bool {
+	if r.BlockNumber > blockNumber+params.NetworkStatsInterval || r.BlockNumber < blockNumber-params.NetworkStatsMaxAge {
+		return false
+	}
+	for _, t := range r.Tokens {
+		if t == nil || t.Channels < 0 || t.Capacity == nil || t.Capacity.Sign() < 0 {
+			return false
+		}
+	}
+	return true
+}
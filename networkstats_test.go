@@ -0,0 +1,66 @@
+package photon
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildNetworkStatsReport(t *testing.T) {
+	self := common.HexToAddress("0x5")
+	token := utils.NewRandomAddress()
+	newChannel := func(partner common.Address, balance int64, state channeltype.State) *channeltype.Serialization {
+		return &channeltype.Serialization{
+			TokenAddressBytes:   token[:],
+			PartnerAddressBytes: partner[:],
+			OurAddress:          self,
+			State:               state,
+			OurContractBalance:  big.NewInt(balance),
+		}
+	}
+	chs := []*channeltype.Serialization{
+		newChannel(common.HexToAddress("0x9"), 10, channeltype.StateOpened),
+		//对方地址较小,通道由对方统计
+		newChannel(common.HexToAddress("0x1"), 20, channeltype.StateOpened),
+		newChannel(common.HexToAddress("0x8"), 40, channeltype.StateClosed),
+	}
+	r := buildNetworkStatsReport(utils.NewRandomHash(), self, 100, chs)
+	assert.EqualValues(t, 1, len(r.Tokens))
+	assert.EqualValues(t, 1, r.Tokens[0].Channels)
+	assert.EqualValues(t, 30, r.Tokens[0].Capacity.Int64())
+	assert.True(t, validNetworkStatsReport(r, 100))
+	assert.False(t, validNetworkStatsReport(r, 100+params.NetworkStatsMaxAge+1))
+	r.Tokens[0].Capacity = big.NewInt(-1)
+	assert.False(t, validNetworkStatsReport(r, 100))
+}
+
+func TestPackNetworkStatsReports(t *testing.T) {
+	newReport := func(blockNumber int64) *models.NetworkStatsReport {
+		return &models.NetworkStatsReport{
+			ReporterID:  utils.NewRandomHash(),
+			BlockNumber: blockNumber,
+			Tokens:      []*models.TokenNetworkStats{{Token: utils.NewRandomAddress(), Channels: 1, Capacity: big.NewInt(100)}},
+		}
+	}
+	own := newReport(100)
+	var others []*models.NetworkStatsReport
+	for i := int64(0); i < 20; i++ {
+		others = append(others, newReport(i))
+	}
+	data, n := packNetworkStatsReports(own, others, params.NetworkStatsMaxSize)
+	assert.True(t, n > 1 && n < 21)
+	assert.True(t, len(data) <= params.NetworkStatsMaxSize)
+	var reports []*models.NetworkStatsReport
+	assert.Nil(t, json.Unmarshal(data, &reports))
+	assert.EqualValues(t, n, len(reports))
+	//自己的统计总是发送,其他的优先发送最新的
+	assert.EqualValues(t, own.ReporterID, reports[0].ReporterID)
+	assert.EqualValues(t, 19, reports[1].BlockNumber)
+}
@@ -0,0 +1,175 @@
+package notify
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/params"
+)
+
+//OverflowPolicy 通知缓冲区满时的处理方式
+type OverflowPolicy string
+
+const (
+	//OverflowDropOldest 丢弃最早的一条通知,保留新通知
+	OverflowDropOldest OverflowPolicy = "drop-oldest"
+	//OverflowDropNewest 丢弃新通知
+	OverflowDropNewest OverflowPolicy = "drop-newest"
+	//OverflowBlockWithTimeout 等待上层读取,超过BlockTimeout仍然没有空间则丢弃新通知
+	OverflowBlockWithTimeout OverflowPolicy = "block-with-timeout"
+)
+
+//ParseOverflowPolicy checks `s` is a valid OverflowPolicy
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch p := OverflowPolicy(s); p {
+	case OverflowDropOldest, OverflowDropNewest, OverflowBlockWithTimeout:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown notify overflow policy %s, should be one of %s,%s,%s",
+		s, OverflowDropOldest, OverflowDropNewest, OverflowBlockWithTimeout)
+}
+
+//BufferConfig 一个通知通道的缓冲区配置
+type BufferConfig struct {
+	Size         int
+	Policy       OverflowPolicy
+	BlockTimeout time.Duration //只对OverflowBlockWithTimeout有效
+}
+
+//DefaultBufferConfig 使用params中的配置
+func DefaultBufferConfig() BufferConfig {
+	policy, err := ParseOverflowPolicy(params.NotifyOverflowPolicy)
+	if err != nil {
+		policy = OverflowDropOldest
+	}
+	return BufferConfig{
+		Size:         params.NotifyBufferSize,
+		Policy:       policy,
+		BlockTimeout: params.NotifyBlockTimeout,
+	}
+}
+
+//BufferStats 通知缓冲区的状态
+type BufferStats struct {
+	Size    int            `json:"size"`
+	Policy  OverflowPolicy `json:"policy"`
+	Pending int            `json:"pending"` //还没有被上层读取的通知数
+	Dropped int64          `json:"dropped"` //因为缓冲区满丢弃的通知数
+}
+
+/*
+ringBuffer 生产者和上层之间的环形缓冲区,由forward把缓冲区中的通知依次交给上层,
+这样上层没有及时读取时,通知先保存在缓冲区中,而不是直接丢弃
+*/
+type ringBuffer struct {
+	lock     sync.Mutex
+	cfg      BufferConfig
+	items    []interface{}
+	head     int
+	count    int
+	dropped  int64
+	notEmpty chan struct{}
+	notFull  chan struct{}
+	quit     chan struct{}
+}
+
+func newRingBuffer(cfg BufferConfig) *ringBuffer {
+	if cfg.Size <= 0 {
+		cfg.Size = 1
+	}
+	return &ringBuffer{
+		cfg:      cfg,
+		items:    make([]interface{}, cfg.Size),
+		notEmpty: make(chan struct{}, 1),
+		notFull:  make(chan struct{}, 1),
+		quit:     make(chan struct{}),
+	}
+}
+
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+//push 按照溢出策略把v放入缓冲区
+func (b *ringBuffer) push(v interface{}) {
+	var timeout <-chan time.Time
+	for {
+		b.lock.Lock()
+		if b.count < len(b.items) {
+			b.items[(b.head+b.count)%len(b.items)] = v
+			b.count++
+			b.lock.Unlock()
+			signal(b.notEmpty)
+			return
+		}
+		switch b.cfg.Policy {
+		case OverflowDropNewest:
+			b.dropped++
+			b.lock.Unlock()
+			return
+		case OverflowBlockWithTimeout:
+			b.lock.Unlock()
+			if timeout == nil {
+				timeout = time.After(b.cfg.BlockTimeout)
+			}
+			select {
+			case <-b.notFull:
+				continue
+			case <-timeout:
+			case <-b.quit:
+				return
+			}
+			b.lock.Lock()
+			b.dropped++
+			b.lock.Unlock()
+			return
+		default:
+			b.items[b.head] = v
+			b.head = (b.head + 1) % len(b.items)
+			b.dropped++
+			b.lock.Unlock()
+			return
+		}
+	}
+}
+
+//pop 取出最早的通知,缓冲区为空时等待,关闭以后返回false
+func (b *ringBuffer) pop() (v interface{}, ok bool) {
+	for {
+		b.lock.Lock()
+		if b.count > 0 {
+			v = b.items[b.head]
+			b.items[b.head] = nil
+			b.head = (b.head + 1) % len(b.items)
+			b.count--
+			b.lock.Unlock()
+			signal(b.notFull)
+			return v, true
+		}
+		b.lock.Unlock()
+		select {
+		case <-b.notEmpty:
+		case <-b.quit:
+			return nil, false
+		}
+	}
+}
+
+func (b *ringBuffer) close() {
+	close(b.quit)
+}
+
+func (b *ringBuffer) stats() *BufferStats {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return &BufferStats{
+		Size:    len(b.items),
+		Policy:  b.cfg.Policy,
+		Pending: b.count,
+		Dropped: b.dropped,
+	}
+}
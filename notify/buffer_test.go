@@ -0,0 +1,76 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRingBufferDropOldest(t *testing.T) {
+	b := newRingBuffer(BufferConfig{Size: 3, Policy: OverflowDropOldest})
+	for i := 0; i < 5; i++ {
+		b.push(i)
+	}
+	assert.EqualValues(t, 2, b.stats().Dropped)
+	for i := 2; i < 5; i++ {
+		v, ok := b.pop()
+		assert.True(t, ok)
+		assert.EqualValues(t, i, v)
+	}
+	assert.EqualValues(t, 0, b.stats().Pending)
+}
+
+func TestRingBufferDropNewest(t *testing.T) {
+	b := newRingBuffer(BufferConfig{Size: 3, Policy: OverflowDropNewest})
+	for i := 0; i < 5; i++ {
+		b.push(i)
+	}
+	assert.EqualValues(t, 2, b.stats().Dropped)
+	for i := 0; i < 3; i++ {
+		v, _ := b.pop()
+		assert.EqualValues(t, i, v)
+	}
+}
+
+func TestRingBufferBlockWithTimeout(t *testing.T) {
+	b := newRingBuffer(BufferConfig{Size: 1, Policy: OverflowBlockWithTimeout, BlockTimeout: 50 * time.Millisecond})
+	b.push(0)
+	//没有人读取,超时以后丢弃
+	start := time.Now()
+	b.push(1)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+	assert.EqualValues(t, 1, b.stats().Dropped)
+	//等待期间被读取,不会丢弃
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		b.pop()
+	}()
+	b.push(2)
+	assert.EqualValues(t, 1, b.stats().Dropped)
+	v, _ := b.pop()
+	assert.EqualValues(t, 2, v)
+	b.close()
+	_, ok := b.pop()
+	assert.False(t, ok)
+}
+
+func TestHandlerBuffersNotices(t *testing.T) {
+	h := NewNotifyHandlerWithConfig(BufferConfig{Size: 10, Policy: OverflowDropOldest}, BufferConfig{Size: 10, Policy: OverflowDropOldest})
+	//上层还没有开始读取,通知不会丢失
+	for i := 0; i < 5; i++ {
+		h.NotifyString(LevelInfo, "hello")
+	}
+	for i := 0; i < 5; i++ {
+		select {
+		case n := <-h.GetNoticeChan():
+			assert.NotNil(t, n)
+		case <-time.After(time.Second):
+			t.Fatal("notice lost")
+		}
+	}
+	assert.EqualValues(t, 0, h.BufferStats()["notice"].Dropped)
+	h.Stop()
+	_, ok := <-h.GetNoticeChan()
+	assert.False(t, ok)
+}
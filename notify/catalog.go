@@ -0,0 +1,206 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"sync"
+	"text/template"
+
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//内置的语言
+const (
+	LocaleZH = "zh"
+	LocaleEN = "en"
+)
+
+/*
+Event.Params中用到的参数,值都是字符串,地址和hash使用完整的十六进制
+*/
+const (
+	ParamPartner   = "partner"   //对方的地址
+	ParamInitiator = "initiator" //交易发起方的地址
+	ParamTxHash    = "tx"        //交易池中交易的hash
+	ParamError     = "error"     //对方返回的或者链上交易的错误信息
+	ParamSkew      = "skew"      //本机时钟比块时间戳快多少,比如-10m0s
+	ParamReason    = "reason"    //触发事件的原因
+)
+
+/*
+模板的参数是Event,可以使用下面两个函数缩短地址和hash,参数可以是common.Address,common.Hash或者十六进制字符串,
+空字符串表示缺少参数,结果也为空:
+	addr 地址的前几位
+	hash hash的前几位
+*/
+var catalogFuncs = template.FuncMap{
+	"addr": func(v interface{}) string {
+		switch a := v.(type) {
+		case common.Address:
+			return utils.APex2(a)
+		case string:
+			if a == "" {
+				return ""
+			}
+			return utils.APex2(common.HexToAddress(a))
+		}
+		return fmt.Sprint(v)
+	},
+	"hash": func(v interface{}) string {
+		switch h := v.(type) {
+		case common.Hash:
+			return utils.HPex(h)
+		case string:
+			if h == "" {
+				return ""
+			}
+			return utils.HPex(common.HexToHash(h))
+		}
+		return fmt.Sprint(v)
+	},
+}
+
+var defaultCatalogs = map[string]map[EventCode]string{
+	LocaleZH: {
+		EventChainConnected:           "公链连接已恢复",
+		EventChainDisconnected:        "公链连接失败,正在尝试重连",
+		EventChainFork:                "公链发生分叉,块{{.BlockNumber}}之后的合约事件将重新处理",
+		EventCooperateSettleRefused:   "对方拒绝了通道{{.ChannelIdentifier.Hex}}的合作关闭请求,errorCode={{.ErrorCode}} errorMsg={{.Params.error}}",
+		EventCooperateSettleFailed:    "CooperateSettle通道失败,建议强制close/settle通道,ChannelIdentifier={{.ChannelIdentifier.Hex}}",
+		EventWithdrawRefused:          "对方拒绝了通道{{.ChannelIdentifier.Hex}}的取现请求,errorCode={{.ErrorCode}} errorMsg={{.Params.error}}",
+		EventMediatedTransferReceived: "收到token={{addr .TokenAddress}},amount={{.Amount}},locksecrethash={{hash .LockSecretHash}}的交易",
+		EventTransferReceived:         "收到{{addr .Params.initiator}}发起的token={{addr .TokenAddress}},amount={{.Amount}}的交易",
+		EventChannelClosedByPartner:   "通道{{hash .ChannelIdentifier}}被对方{{addr .Params.partner}}关闭",
+		EventChannelClosePending:      "对方{{addr .Params.partner}}正在关闭通道{{hash .ChannelIdentifier}},tx={{.Params.tx}}",
+		EventChannelSettlePending:     "对方{{addr .Params.partner}}正在settle通道{{hash .ChannelIdentifier}},tx={{.Params.tx}}",
+		EventClockSkew:                "本机时钟和公链时间相差{{.Params.skew}},请校准系统时间",
+		EventClockSynced:              "本机时钟和公链时间已经一致",
+		EventCircuitBreakerTripped:    "token={{addr .TokenAddress}}异常太多({{.Params.reason}}),已暂停发起新交易,确认安全后请手工恢复",
+		EventOutdatedBalanceProof:     "对方{{addr .Params.partner}}关闭通道{{hash .ChannelIdentifier}}时使用了旧的BalanceProof,transferAmount={{.Amount}}",
+		EventUpdateBalanceProofFailed: "通道{{hash .ChannelIdentifier}}提交对方的BalanceProof失败,请在settle之前处理,error={{.Params.error}}",
+	},
+	LocaleEN: {
+		EventChainConnected:           "Connection to the blockchain is restored",
+		EventChainDisconnected:        "Connection to the blockchain is lost, reconnecting",
+		EventChainFork:                "Chain reorganized, contract events after block {{.BlockNumber}} will be processed again",
+		EventCooperateSettleRefused:   "Cooperate settle request on channel {{.ChannelIdentifier.Hex}} has been rejected by partner,errorCode={{.ErrorCode}} errorMsg={{.Params.error}}",
+		EventCooperateSettleFailed:    "Cooperate settle of channel {{.ChannelIdentifier.Hex}} failed, please close and settle it instead",
+		EventWithdrawRefused:          "Withdraw request on channel {{.ChannelIdentifier.Hex}} has been rejected by partner,errorCode={{.ErrorCode}} errorMsg={{.Params.error}}",
+		EventMediatedTransferReceived: "Received a transfer of token={{addr .TokenAddress}},amount={{.Amount}},locksecrethash={{hash .LockSecretHash}}",
+		EventTransferReceived:         "Received token={{addr .TokenAddress}},amount={{.Amount}} from {{addr .Params.initiator}}",
+		EventChannelClosedByPartner:   "Channel {{hash .ChannelIdentifier}} is closed by partner {{addr .Params.partner}}",
+		EventChannelClosePending:      "Partner {{addr .Params.partner}} is closing channel {{hash .ChannelIdentifier}},tx={{.Params.tx}}",
+		EventChannelSettlePending:     "Partner {{addr .Params.partner}} is settling channel {{hash .ChannelIdentifier}},tx={{.Params.tx}}",
+		EventClockSkew:                "Local clock differs from the blockchain by {{.Params.skew}}, please correct the system time",
+		EventClockSynced:              "Local clock is in sync with the blockchain again",
+		EventCircuitBreakerTripped:    "Too many anomalies on token {{addr .TokenAddress}} ({{.Params.reason}}), new transfers are paused until reset",
+		EventOutdatedBalanceProof:     "Partner {{addr .Params.partner}} closed channel {{hash .ChannelIdentifier}} with an outdated balance proof, transferAmount={{.Amount}}",
+		EventUpdateBalanceProofFailed: "Failed to update the balance proof of partner on channel {{hash .ChannelIdentifier}}, handle it before settle, error={{.Params.error}}",
+	},
+}
+
+var (
+	catalogLock sync.RWMutex
+	catalogs    = make(map[string]map[EventCode]*template.Template)
+)
+
+func init() {
+	for locale, messages := range defaultCatalogs {
+		err := RegisterCatalog(locale, messages)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+/*
+RegisterCatalog 增加或者覆盖`locale`中事件的消息模板,没有提供的事件仍然使用原来的模板.
+所有模板都能解析才会生效
+*/
+func RegisterCatalog(locale string, messages map[EventCode]string) error {
+	parsed := make(map[EventCode]*template.Template)
+	for code, text := range messages {
+		t, err := template.New(fmt.Sprintf("%s-%d", locale, code)).Funcs(catalogFuncs).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return fmt.Errorf("invalid message template of event %d in locale %s: %s", code, locale, err)
+		}
+		parsed[code] = t
+	}
+	catalogLock.Lock()
+	defer catalogLock.Unlock()
+	if catalogs[locale] == nil {
+		catalogs[locale] = make(map[EventCode]*template.Template)
+	}
+	for code, t := range parsed {
+		catalogs[locale][code] = t
+	}
+	return nil
+}
+
+/*
+LoadCatalogFile 从json文件加载消息模板,格式为{"locale":{"event code":"template"}}
+*/
+func LoadCatalogFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var all map[string]map[string]string
+	err = json.Unmarshal(data, &all)
+	if err != nil {
+		return err
+	}
+	for locale, messages := range all {
+		m := make(map[EventCode]string)
+		for k, text := range messages {
+			code, err := strconv.Atoi(k)
+			if err != nil {
+				return fmt.Errorf("invalid event code %s in locale %s", k, locale)
+			}
+			m[EventCode(code)] = text
+		}
+		err = RegisterCatalog(locale, m)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//HasLocale returns true if any message template is registered for `locale`
+func HasLocale(locale string) bool {
+	catalogLock.RLock()
+	defer catalogLock.RUnlock()
+	return len(catalogs[locale]) > 0
+}
+
+/*
+Render 用`locale`中的模板生成事件的说明文字,没有对应模板时使用中文模板
+*/
+func Render(locale string, e *Event) string {
+	catalogLock.RLock()
+	t := catalogs[locale][e.Code]
+	if t == nil {
+		t = catalogs[LocaleZH][e.Code]
+	}
+	catalogLock.RUnlock()
+	if t == nil {
+		return fmt.Sprintf("event %d", e.Code)
+	}
+	var buf bytes.Buffer
+	err := t.Execute(&buf, e)
+	if err != nil {
+		return fmt.Sprintf("event %d: %s", e.Code, err)
+	}
+	return buf.String()
+}
+
+//render 使用params.NotifyLocale
+func render(e *Event) string {
+	return Render(params.NotifyLocale, e)
+}
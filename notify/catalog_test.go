@@ -0,0 +1,50 @@
+package notify
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	partner := utils.NewRandomAddress()
+	e := &Event{
+		Code:              EventChannelClosedByPartner,
+		ChannelIdentifier: utils.NewRandomHash(),
+		Params:            map[string]string{ParamPartner: partner.String()},
+	}
+	zh := Render(LocaleZH, e)
+	assert.EqualValues(t, "通道"+utils.HPex(e.ChannelIdentifier)+"被对方"+utils.APex2(partner)+"关闭", zh)
+	assert.EqualValues(t, "Channel "+utils.HPex(e.ChannelIdentifier)+" is closed by partner "+utils.APex2(partner), Render(LocaleEN, e))
+	//没有的语言使用中文
+	assert.EqualValues(t, zh, Render("fr", e))
+	//缺少参数时为空
+	e.Params = nil
+	assert.EqualValues(t, "Channel "+utils.HPex(e.ChannelIdentifier)+" is closed by partner ", Render(LocaleEN, e))
+
+	assert.NotNil(t, RegisterCatalog("fr", map[EventCode]string{EventChainFork: "{{.BlockNumber"}))
+	assert.False(t, HasLocale("fr"))
+	dir, err := ioutil.TempDir("", "catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "catalog.json")
+	err = ioutil.WriteFile(path, []byte(`{"fr":{"8":"Reçu {{.Amount}} de {{addr .Params.initiator}}"}}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, LoadCatalogFile(path))
+	assert.True(t, HasLocale("fr"))
+	initiator := utils.NewRandomAddress()
+	assert.EqualValues(t, "Reçu 10 de "+utils.APex2(initiator), Render("fr", &Event{
+		Code:   EventTransferReceived,
+		Amount: big.NewInt(10),
+		Params: map[string]string{ParamInitiator: initiator.String()},
+	}))
+}
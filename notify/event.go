@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+EventCode 通知事件的类型,上层根据EventCode处理通知,不需要解析Message中的文字
+*/
+type EventCode int
+
+const (
+	//EventChainConnected 1 公链连接已恢复
+	EventChainConnected EventCode = iota + 1
+	//EventChainDisconnected 2 公链连接失败,正在重连
+	EventChainDisconnected
+	//EventChainFork 3 公链发生分叉,BlockNumber之后的合约事件将重新处理
+	EventChainFork
+	//EventCooperateSettleRefused 4 对方拒绝了合作关闭通道的请求
+	EventCooperateSettleRefused
+	//EventCooperateSettleFailed 5 合作关闭通道的交易失败,需要强制close/settle通道
+	EventCooperateSettleFailed
+	//EventWithdrawRefused 6 对方拒绝了取现请求
+	EventWithdrawRefused
+	//EventMediatedTransferReceived 7 收到了一笔MediatedTransfer,并不代表交易成功
+	EventMediatedTransferReceived
+	//EventTransferReceived 8 成功收到一笔交易
+	EventTransferReceived
+	//EventChannelClosedByPartner 9 对方在链上关闭了通道
+	EventChannelClosedByPartner
+	//EventChannelClosePending 10 交易池中发现对方关闭通道的交易,还没有打包
+	EventChannelClosePending
+	//EventChannelSettlePending 11 交易池中发现对方settle通道的交易,还没有打包
+	EventChannelSettlePending
+	//EventClockSkew 12 本机时钟和块时间戳相差太多,Params.skew是本机时钟快了多少
+	EventClockSkew
+	//EventClockSynced 13 本机时钟和块时间戳恢复一致
+	EventClockSynced
+	//EventCircuitBreakerTripped 14 token网络短时间内异常太多,暂停发起新交易,Params.reason是触发原因
+	EventCircuitBreakerTripped
+	//EventOutdatedBalanceProof 15 对方关闭通道时提交的不是我最新的BalanceProof,Amount是对方提交的TransferAmount
+	EventOutdatedBalanceProof
+	//EventUpdateBalanceProofFailed 16 对方关闭通道以后,提交对方最新的BalanceProof失败,需要在settle之前手工处理
+	EventUpdateBalanceProofFailed
+)
+
+/*
+Event 结构化的通知,没有意义的字段为零值,Message是给用户看的说明,格式不固定.
+Params是其他字段表示不了的参数,比如对方的地址,key见ParamPartner等
+*/
+type Event struct {
+	Code              EventCode         `json:"code"`
+	TokenAddress      common.Address    `json:"token_address"`
+	ChannelIdentifier common.Hash       `json:"channel_identifier"`
+	Amount            *big.Int          `json:"amount"`
+	LockSecretHash    common.Hash       `json:"lock_secret_hash"`
+	BlockNumber       int64             `json:"block_number"`
+	ErrorCode         int               `json:"error_code"`
+	Params            map[string]string `json:"params,omitempty"`
+	Message           string            `json:"message"`
+}
+
+//NotifyEvent : 通知上层一个事件,不让阻塞,以免影响正常业务.Message为空时按照params.NotifyLocale生成
+func (h *Handler) NotifyEvent(level Level, e *Event) {
+	if e == nil {
+		return
+	}
+	if e.Message == "" {
+		e.Message = render(e)
+	}
+	h.Notify(level, &InfoStruct{
+		Type:    InfoTypeEvent,
+		Message: e,
+	})
+}
@@ -0,0 +1,40 @@
+package notify
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifyEvent(t *testing.T) {
+	h := NewNotifyHandler()
+	defer h.Stop()
+	channelIdentifier := utils.NewRandomHash()
+	h.NotifyEvent(LevelWarn, &Event{
+		Code:              EventChannelClosedByPartner,
+		TokenAddress:      utils.NewRandomAddress(),
+		ChannelIdentifier: channelIdentifier,
+		Amount:            big.NewInt(10),
+		Message:           "closed",
+	})
+	var n *Notice
+	select {
+	case n = <-h.GetNoticeChan():
+	case <-time.After(time.Second):
+		t.Fatal("notice lost")
+	}
+	assert.EqualValues(t, LevelWarn, n.Level)
+	var info struct {
+		Type    int   `json:"type"`
+		Message Event `json:"message"`
+	}
+	assert.Nil(t, json.Unmarshal([]byte(n.Info), &info))
+	assert.EqualValues(t, InfoTypeEvent, info.Type)
+	assert.EqualValues(t, EventChannelClosedByPartner, info.Message.Code)
+	assert.EqualValues(t, channelIdentifier, info.Message.ChannelIdentifier)
+	assert.EqualValues(t, big.NewInt(10), info.Message.Amount)
+}
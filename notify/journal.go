@@ -0,0 +1,231 @@
+package notify
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/params"
+)
+
+//historyBatchSize 查询历史通知时每次从数据库读取的条数
+const historyBatchSize = 500
+
+/*
+Record 带序号的通知,Notice和ReceivedTransfer只有一个不为nil.
+Seq从1开始严格递增,客户端保存收到的最大Seq作为游标,重连时从游标开始补收
+*/
+type Record struct {
+	Seq              uint64                   `json:"seq"`
+	Notice           *Notice                  `json:"notice,omitempty"`
+	ReceivedTransfer *models.ReceivedTransfer `json:"received_transfer,omitempty"`
+}
+
+func (r *Record) match(f *Filter) bool {
+	if r.Notice != nil {
+		return f.matchNotice(r.Notice.meta)
+	}
+	return f.matchReceivedTransfer(r.ReceivedTransfer)
+}
+
+/*
+journal 最近params.NotifyJournalSize条通知,保存在内存中.
+没有设置store时重启以后Seq重新从1开始,否则从数据库中最后一条通知继续递增
+*/
+type journal struct {
+	records []*Record
+	lastSeq uint64
+}
+
+//append 调用者持有Handler.lock
+func (j *journal) append(n *Notice, rt *models.ReceivedTransfer) *Record {
+	j.lastSeq++
+	r := &Record{
+		Seq:              j.lastSeq,
+		Notice:           n,
+		ReceivedTransfer: rt,
+	}
+	j.records = append(j.records, r)
+	if len(j.records) > params.NotifyJournalSize {
+		j.records = j.records[len(j.records)-params.NotifyJournalSize:]
+	}
+	return r
+}
+
+/*
+since 返回Seq大于cursor的记录,complete为false表示有一部分已经不在journal中了,
+cursor大于lastSeq说明photon重启过并且没有保存通知,返回所有记录
+*/
+func (j *journal) since(cursor uint64) (records []*Record, complete bool) {
+	if cursor > j.lastSeq {
+		return j.records, len(j.records) == 0 || j.records[0].Seq == 1
+	}
+	for i, r := range j.records {
+		if r.Seq > cursor {
+			return j.records[i:], r.Seq == cursor+1
+		}
+	}
+	return nil, true
+}
+
+//newNotification 转换为数据库中保存的格式
+func newNotification(r *Record) *models.Notification {
+	n := &models.Notification{
+		ID:               r.Seq,
+		ReceivedTransfer: r.ReceivedTransfer,
+		Time:             time.Now().Unix(),
+	}
+	if r.Notice != nil {
+		n.Level = int(r.Notice.Level)
+		n.Info = r.Notice.Info
+		if m := r.Notice.meta; m != nil {
+			n.InfoType = m.infoType
+			n.EventCode = int(m.code)
+			n.TokenAddress = m.token
+			n.ChannelIdentifier = m.channel
+		}
+	}
+	return n
+}
+
+//recordFromNotification 从数据库恢复的Record同样可以按照Filter过滤
+func recordFromNotification(n *models.Notification) *Record {
+	r := &Record{
+		Seq:              n.ID,
+		ReceivedTransfer: n.ReceivedTransfer,
+	}
+	if n.ReceivedTransfer == nil {
+		r.Notice = &Notice{
+			Level: Level(n.Level),
+			Info:  n.Info,
+			meta: &noticeMeta{
+				infoType: n.InfoType,
+				code:     EventCode(n.EventCode),
+				token:    n.TokenAddress,
+				channel:  n.ChannelIdentifier,
+			},
+		}
+	}
+	return r
+}
+
+/*
+SetStore 把之后的所有通知保存到store中,Seq从store中最后一条通知继续递增,
+这样离线的客户端可以通过History补收任意时间之后的通知.应该在发布第一条通知之前调用
+*/
+func (h *Handler) SetStore(store models.NotificationDao) error {
+	lastID, err := store.GetLastNotificationID()
+	if err != nil {
+		return err
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.store = store
+	if lastID > h.journal.lastSeq {
+		h.journal.lastSeq = lastID
+	}
+	return nil
+}
+
+/*
+persist 调用者持有h.lock,保证数据库中的ID和Seq顺序一致.
+保存失败不影响推送,只是离线的客户端无法补收这条通知.
+每params.NotifyHistorySize条通知删除一次更早的,数据库中最多保存两倍的params.NotifyHistorySize条
+*/
+func (h *Handler) persist(r *Record) {
+	if h.store == nil {
+		return
+	}
+	err := h.store.SaveNotification(newNotification(r))
+	if err != nil {
+		log.Error(fmt.Sprintf("SaveNotification %d err %s", r.Seq, err))
+		return
+	}
+	size := uint64(params.NotifyHistorySize)
+	if size > 0 && r.Seq > size && r.Seq%size == 0 {
+		err = h.store.RemoveNotificationsBefore(r.Seq - size + 1)
+		if err != nil {
+			log.Error(fmt.Sprintf("RemoveNotificationsBefore %d err %s", r.Seq-size+1, err))
+		}
+	}
+}
+
+/*
+History 按照Seq从小到大返回Seq大于sinceID并且满足filter的最多limit条通知,limit<=0表示不限制.
+没有设置store时只能查到内存中最近的通知
+*/
+func (h *Handler) History(sinceID uint64, filter Filter, limit int) (records []*Record, err error) {
+	h.lock.RLock()
+	store := h.store
+	var recent []*Record
+	if store == nil {
+		recent, _ = h.journal.since(sinceID)
+	}
+	h.lock.RUnlock()
+	if store == nil {
+		for _, r := range recent {
+			if limit > 0 && len(records) >= limit {
+				break
+			}
+			if r.match(&filter) {
+				records = append(records, r)
+			}
+		}
+		return
+	}
+	cursor := sinceID
+	for {
+		var ns []*models.Notification
+		ns, err = store.GetNotifications(cursor, historyBatchSize)
+		if err != nil {
+			return
+		}
+		for _, n := range ns {
+			cursor = n.ID
+			r := recordFromNotification(n)
+			if r.match(&filter) {
+				records = append(records, r)
+				if limit > 0 && len(records) >= limit {
+					return
+				}
+			}
+		}
+		if len(ns) < historyBatchSize {
+			return
+		}
+	}
+}
+
+/*
+SubscribeFrom 增加一个订阅者,先补发Seq大于cursor并且满足filter的通知,再接收新的通知,
+补发和新通知之间不会有遗漏和重复.通过Records接收,而不是Notices和ReceivedTransfers.
+complete为false表示cursor之后的通知有一部分已经丢失了
+*/
+func (h *Handler) SubscribeFrom(filter Filter, cursor uint64) (s *Subscription, complete bool) {
+	cfg := DefaultBufferConfig()
+	cfg.Size += params.NotifyJournalSize
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	s = newRecordSubscription(h.nextID, filter, cfg)
+	h.nextID++
+	if h.stopped {
+		s.close()
+		return s, false
+	}
+	records, complete := h.journal.since(cursor)
+	for _, r := range records {
+		if r.match(&s.filter) {
+			s.records.push(r)
+		}
+	}
+	h.subscriptions[s.ID] = s
+	return s, complete
+}
+
+//LastSeq 最新一条通知的Seq
+func (h *Handler) LastSeq() uint64 {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.journal.lastSeq
+}
@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func receiveRecord(t *testing.T, s *Subscription) *Record {
+	select {
+	case r := <-s.Records():
+		return r
+	case <-time.After(time.Second):
+		t.Fatal("record lost")
+	}
+	return nil
+}
+
+func TestSubscribeFrom(t *testing.T) {
+	old := params.NotifyJournalSize
+	defer func() { params.NotifyJournalSize = old }()
+	params.NotifyJournalSize = 3
+	h := NewNotifyHandler()
+	defer h.Stop()
+	token := utils.NewRandomAddress()
+	for i := 0; i < 4; i++ {
+		h.NotifyEvent(LevelInfo, &Event{Code: EventChainConnected, TokenAddress: token})
+	}
+	h.NotifyReceiveTransfer(&models.ReceivedTransfer{TokenAddress: utils.NewRandomAddress()})
+	assert.EqualValues(t, 5, h.LastSeq())
+
+	//游标之后的通知都还在journal中
+	s, complete := h.SubscribeFrom(Filter{}, 3)
+	assert.True(t, complete)
+	assert.EqualValues(t, 4, receiveRecord(t, s).Seq)
+	r := receiveRecord(t, s)
+	assert.EqualValues(t, 5, r.Seq)
+	assert.NotNil(t, r.ReceivedTransfer)
+	h.NotifyString(LevelInfo, "live")
+	r = receiveRecord(t, s)
+	assert.EqualValues(t, 6, r.Seq)
+	assert.NotNil(t, r.Notice)
+	h.Unsubscribe(s)
+	_, ok := <-s.Records()
+	assert.False(t, ok)
+
+	//游标太旧,一部分通知已经丢失,补发时同样按filter过滤
+	s, complete = h.SubscribeFrom(Filter{Tokens: []common.Address{token}}, 1)
+	defer h.Unsubscribe(s)
+	assert.False(t, complete)
+	assert.EqualValues(t, 4, receiveRecord(t, s).Seq)
+	h.NotifyEvent(LevelInfo, &Event{Code: EventChainConnected, TokenAddress: token})
+	assert.EqualValues(t, 7, receiveRecord(t, s).Seq)
+
+	//photon重启过,游标比最新的Seq还大
+	_, complete = h.SubscribeFrom(Filter{}, 100)
+	assert.False(t, complete)
+}
+
+func TestHistory(t *testing.T) {
+	old, oldHistory := params.NotifyJournalSize, params.NotifyHistorySize
+	defer func() { params.NotifyJournalSize, params.NotifyHistorySize = old, oldHistory }()
+	params.NotifyJournalSize = 2
+	params.NotifyHistorySize = 4
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	token := utils.NewRandomAddress()
+	h := NewNotifyHandler()
+	assert.Nil(t, h.SetStore(dao))
+	for i := 0; i < 3; i++ {
+		h.NotifyEvent(LevelInfo, &Event{Code: EventChainConnected, TokenAddress: token})
+		h.NotifyReceiveTransfer(&models.ReceivedTransfer{TokenAddress: utils.NewRandomAddress()})
+	}
+	h.Stop()
+
+	//重启以后Seq继续递增,已经不在内存中的通知可以从数据库中查到
+	h = NewNotifyHandler()
+	defer h.Stop()
+	assert.Nil(t, h.SetStore(dao))
+	assert.EqualValues(t, 6, h.LastSeq())
+	h.NotifyString(LevelInfo, "after restart")
+	assert.EqualValues(t, 7, h.LastSeq())
+	records, err := h.History(0, Filter{Tokens: []common.Address{token}}, 0)
+	assert.Nil(t, err)
+	if assert.EqualValues(t, 3, len(records)) {
+		assert.EqualValues(t, 1, records[0].Seq)
+		assert.NotNil(t, records[0].Notice)
+	}
+	records, err = h.History(1, Filter{}, 2)
+	assert.Nil(t, err)
+	if assert.EqualValues(t, 2, len(records)) {
+		assert.EqualValues(t, 2, records[0].Seq)
+		assert.NotNil(t, records[0].ReceivedTransfer)
+	}
+
+	//每4条清理一次,只保留最近4条
+	h.NotifyString(LevelInfo, "prune")
+	records, err = h.History(0, Filter{}, 0)
+	assert.Nil(t, err)
+	if assert.EqualValues(t, 4, len(records)) {
+		assert.EqualValues(t, 5, records[0].Seq)
+	}
+}
@@ -22,8 +22,9 @@ const (
 Notice for mobile or app
 */
 type Notice struct {
-	Level Level  `json:"level"`
-	Info  string `json:"info"`
+	Level Level       `json:"level"`
+	Info  string      `json:"info"`
+	meta  *noticeMeta //过滤时用到的属性
 }
 
 const (
@@ -43,6 +44,12 @@ const (
 
 	// InfoTypeContractCallTXInfo 4 自己发起的tx执行完成,通知执行结果,Message类型为models.TXInfo
 	InfoTypeContractCallTXInfo
+
+	// InfoTypeSettleCountdown 12 已关闭通道的结算倒计时,Message类型为SettleCountdownNotice
+	// 5-11 已经在文档中分配给了其他通知,这里不能复用
+	InfoTypeSettleCountdown = 12
+	// InfoTypeEvent 13 结构化的事件通知,Message类型为Event
+	InfoTypeEvent = 13
 )
 
 //InfoStruct for notify to mobile
@@ -57,6 +64,7 @@ newNotice :
 func newNotice(level Level, info *InfoStruct) *Notice {
 	n := &Notice{
 		Level: level,
+		meta:  newNoticeMeta(info),
 	}
 	buf, err := json.Marshal(info)
 	if err != nil {
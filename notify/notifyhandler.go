@@ -2,70 +2,162 @@ package notify
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
 
 	"github.com/SmartMeshFoundation/Photon/encoding"
 	"github.com/SmartMeshFoundation/Photon/models"
-	"github.com/SmartMeshFoundation/Photon/utils"
 	"github.com/ethereum/go-ethereum/common"
 )
 
 /*
 Handler :
 deal notice info for upper app
+Handler是一个发布订阅总线,每个订阅者有自己的环形缓冲区,再由独立的goroutine交给订阅者,
+订阅者没有及时读取时按照溢出策略处理,不会影响其他订阅者.
+GetNoticeChan和GetReceivedTransferChan返回的是默认订阅者,接收所有通知
 */
 type Handler struct {
-
-	//receivedTransferChan  ReceivedTransfer notify, should never close
-	receivedTransferChan chan *models.ReceivedTransfer
-	//noticeChan should never close
-	noticeChan chan *Notice
+	lock          sync.RWMutex
+	defaultSub    *Subscription
+	subscriptions map[int]*Subscription
+	nextID        int
+	journal       journal
+	store         models.NotificationDao //不为nil时所有通知都保存到数据库中
 	// work status
 	stopped bool
 }
 
-// NewNotifyHandler :
+// NewNotifyHandler : 使用params中的缓冲区配置
 func NewNotifyHandler() *Handler {
+	return NewNotifyHandlerWithConfig(DefaultBufferConfig(), DefaultBufferConfig())
+}
+
+// NewNotifyHandlerWithConfig : 分别指定默认订阅者Notice和ReceivedTransfer通知的缓冲区配置
+func NewNotifyHandlerWithConfig(noticeCfg, receivedTransferCfg BufferConfig) *Handler {
 	return &Handler{
-		receivedTransferChan: make(chan *models.ReceivedTransfer, 10),
-		noticeChan:           make(chan *Notice, 10),
-		stopped:              false,
+		defaultSub:    newSubscription(0, Filter{}, noticeCfg, receivedTransferCfg),
+		subscriptions: make(map[int]*Subscription),
+		nextID:        1,
+		stopped:       false,
+	}
+}
+
+// Subscribe : 增加一个订阅者,只接收满足filter的通知,使用params中的缓冲区配置
+func (h *Handler) Subscribe(filter Filter) *Subscription {
+	return h.SubscribeWithConfig(filter, DefaultBufferConfig(), DefaultBufferConfig())
+}
+
+// SubscribeWithConfig : 增加一个订阅者,分别指定Notice和ReceivedTransfer通知的缓冲区配置
+func (h *Handler) SubscribeWithConfig(filter Filter, noticeCfg, receivedTransferCfg BufferConfig) *Subscription {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	s := newSubscription(h.nextID, filter, noticeCfg, receivedTransferCfg)
+	h.nextID++
+	if h.stopped {
+		s.close()
+		return s
+	}
+	h.subscriptions[s.ID] = s
+	return s
+}
+
+// Unsubscribe : 移除订阅者,并关闭它的chan
+func (h *Handler) Unsubscribe(s *Subscription) {
+	if s == nil {
+		return
+	}
+	h.lock.Lock()
+	_, ok := h.subscriptions[s.ID]
+	delete(h.subscriptions, s.ID)
+	h.lock.Unlock()
+	if ok {
+		s.close()
+	}
+}
+
+//allSubscriptions 默认订阅者在最前面,调用者持有h.lock
+func (h *Handler) allSubscriptions() []*Subscription {
+	subs := []*Subscription{h.defaultSub}
+	for _, s := range h.subscriptions {
+		subs = append(subs, s)
+	}
+	return subs
+}
+
+/*
+publish 给通知分配Seq并记录到journal和数据库,再交给所有订阅者.
+分配Seq和取订阅者在同一个锁中,保证和SubscribeFrom的补发之间没有遗漏和重复
+*/
+func (h *Handler) publish(n *Notice, rt *models.ReceivedTransfer) {
+	h.lock.Lock()
+	if h.stopped {
+		h.lock.Unlock()
+		return
+	}
+	r := h.journal.append(n, rt)
+	h.persist(r)
+	subs := h.allSubscriptions()
+	h.lock.Unlock()
+	for _, s := range subs {
+		s.push(r)
 	}
 }
 
 // Stop :
 func (h *Handler) Stop() {
+	h.lock.Lock()
 	h.stopped = true
-	close(h.receivedTransferChan)
-	close(h.noticeChan)
+	subs := h.subscriptions
+	h.subscriptions = make(map[int]*Subscription)
+	h.lock.Unlock()
+	h.defaultSub.close()
+	for _, s := range subs {
+		s.close()
+	}
+}
+
+// BufferStats : 各个订阅者通知缓冲区的积压和丢弃情况,默认订阅者没有前缀
+func (h *Handler) BufferStats() map[string]*BufferStats {
+	stats := make(map[string]*BufferStats)
+	h.lock.RLock()
+	subs := h.allSubscriptions()
+	h.lock.RUnlock()
+	for _, s := range subs {
+		prefix := ""
+		if s != h.defaultSub {
+			prefix = fmt.Sprintf("subscription%d.", s.ID)
+		}
+		for name, st := range s.bufferStats() {
+			stats[prefix+name] = st
+		}
+	}
+	return stats
 }
 
 // GetNoticeChan :
 // return read-only, keep chan private
 func (h *Handler) GetNoticeChan() <-chan *Notice {
-	return h.noticeChan
+	return h.defaultSub.Notices()
 }
 
 // GetReceivedTransferChan :
 // keep chan private
 func (h *Handler) GetReceivedTransferChan() <-chan *models.ReceivedTransfer {
-	return h.receivedTransferChan
+	return h.defaultSub.ReceivedTransfers()
 }
 
-// Notify : 通知上层,不让阻塞,以免影响正常业务
+// Notify : 通知所有满足条件的订阅者,除非溢出策略是block-with-timeout,否则不会阻塞,以免影响正常业务
 func (h *Handler) Notify(level Level, info *InfoStruct) {
 	if h.stopped || info == nil {
 		return
 	}
-	select {
-	case h.noticeChan <- newNotice(level, info):
-	default:
-		// never block
-	}
+	h.publish(newNotice(level, info), nil)
 }
 
 // NotifyString : 通知上层,不让阻塞,以免影响正常业务
+// Deprecated: 上层无法根据文字判断是什么事件,请使用NotifyEvent
 func (h *Handler) NotifyString(level Level, info string) {
 	h.Notify(level, &InfoStruct{
 		Type:    InfoTypeString,
@@ -134,9 +226,13 @@ func (h *Handler) NotifyReceiveMediatedTransfer(msg *encoding.MediatedTransfer,
 	if h.stopped || msg == nil {
 		return
 	}
-	info := fmt.Sprintf("收到token=%s,amount=%d,locksecrethash=%s的交易",
-		utils.APex2(tokenAddress), msg.PaymentAmount, utils.HPex(msg.LockSecretHash))
-	h.NotifyString(LevelInfo, info)
+	h.NotifyEvent(LevelInfo, &Event{
+		Code:              EventMediatedTransferReceived,
+		TokenAddress:      tokenAddress,
+		ChannelIdentifier: msg.ChannelIdentifier,
+		Amount:            msg.PaymentAmount,
+		LockSecretHash:    msg.LockSecretHash,
+	})
 }
 
 // NotifyReceiveTransfer : 通知成功收到一笔token
@@ -145,11 +241,26 @@ func (h *Handler) NotifyReceiveTransfer(rt *models.ReceivedTransfer) {
 	if h.stopped || rt == nil {
 		return
 	}
-	select {
-	case h.receivedTransferChan <- rt:
-	default:
-		// never block
-	}
+	h.publish(nil, rt)
+}
+
+// SettleCountdownNotice 通道结算倒计时通知
+type SettleCountdownNotice struct {
+	ChannelIdentifier common.Hash                  `json:"channel_identifier"`
+	SettleCountdown   *channeltype.SettleCountdown `json:"settle_countdown"`
+}
+
+/*
+NotifySettleCountdown 已关闭的通道到达倒计时的关键点时,通知上层还剩多少块
+*/
+func (h *Handler) NotifySettleCountdown(channelIdentifier common.Hash, sc *channeltype.SettleCountdown) {
+	h.Notify(LevelInfo, &InfoStruct{
+		Type: InfoTypeSettleCountdown,
+		Message: &SettleCountdownNotice{
+			ChannelIdentifier: channelIdentifier,
+			SettleCountdown:   sc,
+		},
+	})
 }
 
 /*
@@ -0,0 +1,250 @@
+package notify
+
+import (
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+Filter 订阅的过滤条件,每个条件为空表示不过滤,多个条件同时满足才会收到.
+Tokens和Channels对Notice和ReceivedTransfer都有效,无法确定token或者通道的Notice不会通过这两个条件;
+InfoTypes和EventCodes只对Notice有效,指定EventCodes时只会收到InfoTypeEvent中对应的事件
+*/
+type Filter struct {
+	Tokens     []common.Address
+	Channels   []common.Hash
+	InfoTypes  []int
+	EventCodes []EventCode
+}
+
+//noticeMeta 过滤时用到的Notice属性
+type noticeMeta struct {
+	infoType int
+	code     EventCode
+	token    common.Address
+	channel  common.Hash
+}
+
+func newNoticeMeta(info *InfoStruct) *noticeMeta {
+	m := &noticeMeta{infoType: info.Type}
+	switch msg := info.Message.(type) {
+	case *Event:
+		m.code = msg.Code
+		m.token = msg.TokenAddress
+		m.channel = msg.ChannelIdentifier
+	case *models.SentTransferDetail:
+		m.token = msg.TokenAddress
+		m.channel = msg.ChannelIdentifier
+	case *models.TXInfo:
+		m.token = msg.TokenAddress
+		m.channel = msg.ChannelIdentifier
+	case *channeltype.ChannelDataDetail:
+		m.token = common.HexToAddress(msg.TokenAddress)
+		m.channel = common.HexToHash(msg.ChannelIdentifier)
+	case *channelCallIDResult:
+		if ch, ok := msg.Channel.(*channeltype.ChannelDataDetail); ok && ch != nil {
+			m.token = common.HexToAddress(ch.TokenAddress)
+			m.channel = common.HexToHash(ch.ChannelIdentifier)
+		}
+	case *SettleCountdownNotice:
+		m.channel = msg.ChannelIdentifier
+	}
+	return m
+}
+
+func (f *Filter) matchTokenAndChannel(token common.Address, channel common.Hash) bool {
+	if len(f.Tokens) > 0 {
+		found := false
+		for _, t := range f.Tokens {
+			if t == token && token != utils.EmptyAddress {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.Channels) > 0 {
+		found := false
+		for _, c := range f.Channels {
+			if c == channel && channel != utils.EmptyHash {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *Filter) matchNotice(m *noticeMeta) bool {
+	if !f.matchTokenAndChannel(m.token, m.channel) {
+		return false
+	}
+	if len(f.InfoTypes) > 0 {
+		found := false
+		for _, t := range f.InfoTypes {
+			if t == m.infoType {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.EventCodes) > 0 {
+		if m.infoType != InfoTypeEvent {
+			return false
+		}
+		for _, c := range f.EventCodes {
+			if c == m.code {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func (f *Filter) matchReceivedTransfer(rt *models.ReceivedTransfer) bool {
+	return f.matchTokenAndChannel(rt.TokenAddress, rt.ChannelIdentifier)
+}
+
+/*
+Subscription 一个订阅者,有自己的缓冲区,不会和其他订阅者争抢通知.
+SubscribeFrom的订阅者只通过Records接收,其他订阅者通过Notices和ReceivedTransfers接收,
+Unsubscribe以后chan都会被关闭
+*/
+type Subscription struct {
+	ID                   int
+	filter               Filter
+	receivedTransferChan chan *models.ReceivedTransfer
+	receivedTransfers    *ringBuffer
+	noticeChan           chan *Notice
+	notices              *ringBuffer
+	recordChan           chan *Record
+	records              *ringBuffer
+}
+
+func newSubscription(id int, filter Filter, noticeCfg, receivedTransferCfg BufferConfig) *Subscription {
+	s := &Subscription{
+		ID:                   id,
+		filter:               filter,
+		receivedTransferChan: make(chan *models.ReceivedTransfer),
+		receivedTransfers:    newRingBuffer(receivedTransferCfg),
+		noticeChan:           make(chan *Notice),
+		notices:              newRingBuffer(noticeCfg),
+	}
+	go func() {
+		defer close(s.noticeChan)
+		for {
+			v, ok := s.notices.pop()
+			if !ok {
+				return
+			}
+			select {
+			case s.noticeChan <- v.(*Notice):
+			case <-s.notices.quit:
+				return
+			}
+		}
+	}()
+	go func() {
+		defer close(s.receivedTransferChan)
+		for {
+			v, ok := s.receivedTransfers.pop()
+			if !ok {
+				return
+			}
+			select {
+			case s.receivedTransferChan <- v.(*models.ReceivedTransfer):
+			case <-s.receivedTransfers.quit:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+func newRecordSubscription(id int, filter Filter, cfg BufferConfig) *Subscription {
+	s := &Subscription{
+		ID:         id,
+		filter:     filter,
+		recordChan: make(chan *Record),
+		records:    newRingBuffer(cfg),
+	}
+	go func() {
+		defer close(s.recordChan)
+		for {
+			v, ok := s.records.pop()
+			if !ok {
+				return
+			}
+			select {
+			case s.recordChan <- v.(*Record):
+			case <-s.records.quit:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// Notices :
+// return read-only, keep chan private
+func (s *Subscription) Notices() <-chan *Notice {
+	return s.noticeChan
+}
+
+// ReceivedTransfers :
+// return read-only, keep chan private
+func (s *Subscription) ReceivedTransfers() <-chan *models.ReceivedTransfer {
+	return s.receivedTransferChan
+}
+
+// Records : SubscribeFrom的订阅者接收带序号的通知
+// return read-only, keep chan private
+func (s *Subscription) Records() <-chan *Record {
+	return s.recordChan
+}
+
+//push 把一条通知交给订阅者,不满足filter的直接忽略
+func (s *Subscription) push(r *Record) {
+	if !r.match(&s.filter) {
+		return
+	}
+	switch {
+	case s.records != nil:
+		s.records.push(r)
+	case r.Notice != nil:
+		s.notices.push(r.Notice)
+	default:
+		s.receivedTransfers.push(r.ReceivedTransfer)
+	}
+}
+
+//bufferStats key为缓冲区的名字
+func (s *Subscription) bufferStats() map[string]*BufferStats {
+	if s.records != nil {
+		return map[string]*BufferStats{"record": s.records.stats()}
+	}
+	return map[string]*BufferStats{
+		"notice":            s.notices.stats(),
+		"received_transfer": s.receivedTransfers.stats(),
+	}
+}
+
+func (s *Subscription) close() {
+	if s.records != nil {
+		s.records.close()
+		return
+	}
+	s.receivedTransfers.close()
+	s.notices.close()
+}
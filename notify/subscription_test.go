@@ -0,0 +1,72 @@
+package notify
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func receiveNotice(t *testing.T, c <-chan *Notice) *Notice {
+	select {
+	case n := <-c:
+		return n
+	case <-time.After(time.Second):
+		t.Fatal("notice lost")
+	}
+	return nil
+}
+
+func assertNoNotice(t *testing.T, c <-chan *Notice) {
+	select {
+	case n := <-c:
+		t.Fatalf("unexpected notice %s", n.Info)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMultipleSubscribers(t *testing.T) {
+	h := NewNotifyHandler()
+	defer h.Stop()
+	token1, token2 := utils.NewRandomAddress(), utils.NewRandomAddress()
+	all := h.Subscribe(Filter{})
+	byToken := h.Subscribe(Filter{Tokens: []common.Address{token1}})
+	byCode := h.Subscribe(Filter{EventCodes: []EventCode{EventChannelClosedByPartner}})
+
+	h.NotifyEvent(LevelInfo, &Event{Code: EventTransferReceived, TokenAddress: token1, Amount: big.NewInt(1)})
+	h.NotifyEvent(LevelWarn, &Event{Code: EventChannelClosedByPartner, TokenAddress: token2})
+	h.NotifyString(LevelInfo, "hello")
+
+	//每个订阅者都有自己的通知,不会互相争抢
+	for i := 0; i < 3; i++ {
+		receiveNotice(t, h.GetNoticeChan())
+		receiveNotice(t, all.Notices())
+	}
+	n := receiveNotice(t, byToken.Notices())
+	assert.Contains(t, n.Info, strings.ToLower(token1.String()))
+	assertNoNotice(t, byToken.Notices())
+	n = receiveNotice(t, byCode.Notices())
+	assert.EqualValues(t, LevelWarn, n.Level)
+	assertNoNotice(t, byCode.Notices())
+
+	rt := &models.ReceivedTransfer{TokenAddress: token2, ChannelIdentifier: utils.NewRandomHash()}
+	h.NotifyReceiveTransfer(rt)
+	select {
+	case r := <-all.ReceivedTransfers():
+		assert.EqualValues(t, rt, r)
+	case <-time.After(time.Second):
+		t.Fatal("received transfer lost")
+	}
+	assert.EqualValues(t, 0, h.BufferStats()["subscription2.received_transfer"].Pending)
+
+	h.Unsubscribe(all)
+	_, ok := <-all.Notices()
+	assert.False(t, ok)
+	_, ok = h.BufferStats()["subscription1.notice"]
+	assert.False(t, ok)
+}
@@ -0,0 +1,223 @@
+package photon
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/network/rpc"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/transfer/mtree"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+/*
+offlineDisputeSnapshot 通道关闭以后,争议期内需要提交的交易所依赖的通道状态,
+在主线程中获取,之后构造交易需要访问链,不能在主线程中进行
+*/
+type offlineDisputeSnapshot struct {
+	token                 common.Address
+	partner               common.Address
+	closedBlock           int64
+	settleBlock           int64
+	needUpdate            bool //合约上保存的对方BalanceProof不是最新的,需要updateBalanceProof
+	partnerBalanceProof   *offlineBalanceProof
+	unlocks               []*channeltype.UnlockProof
+	partnerTransferAmount *big.Int //unlock之前合约上对方的TransferAmount
+	partnerLocksroot      common.Hash
+	myTransferAmount      *big.Int
+	myLocksroot           common.Hash
+}
+
+type offlineBalanceProof struct {
+	transferAmount *big.Int
+	locksroot      common.Hash
+	nonce          uint64
+	messageHash    common.Hash
+	signature      []byte
+}
+
+func (rs *Service) offlineDisputeSnapshot(r *offlineTxBundleReq) (result *utils.AsyncResult) {
+	c := rs.getChannelWithAddr(r.channelIdentifier)
+	if c == nil {
+		return utils.NewAsyncResultWithError(rerr.ErrChannelNotFound.Printf("can not find channel %s", r.channelIdentifier.String()))
+	}
+	if c.State != channeltype.StateClosed {
+		return utils.NewAsyncResultWithError(rerr.ChannelStateError(c.State))
+	}
+	s := &offlineDisputeSnapshot{
+		token:                 c.TokenAddress,
+		partner:               c.PartnerState.Address,
+		closedBlock:           c.ExternState.ClosedBlock,
+		settleBlock:           c.GetSettleExpiration(0),
+		partnerTransferAmount: utils.BigInt0,
+		myTransferAmount:      utils.BigInt0,
+	}
+	if bp := c.OurState.BalanceProofState; bp != nil {
+		s.myTransferAmount = new(big.Int).Set(bp.ContractTransferAmount)
+		s.myLocksroot = bp.ContractLocksRoot
+	}
+	if bp := c.PartnerState.BalanceProofState; bp != nil {
+		s.partnerTransferAmount = new(big.Int).Set(bp.ContractTransferAmount)
+		s.partnerLocksroot = bp.ContractLocksRoot
+		if bp.Nonce > 0 && (bp.TransferAmount.Cmp(bp.ContractTransferAmount) != 0 || bp.LocksRoot != bp.ContractLocksRoot) {
+			s.needUpdate = true
+			s.partnerBalanceProof = &offlineBalanceProof{
+				transferAmount: new(big.Int).Set(bp.TransferAmount),
+				locksroot:      bp.LocksRoot,
+				nonce:          bp.Nonce,
+				messageHash:    bp.MessageHash,
+				signature:      bp.Signature,
+			}
+			s.partnerTransferAmount = new(big.Int).Set(bp.TransferAmount)
+			s.partnerLocksroot = bp.LocksRoot
+		}
+	}
+	for _, proof := range c.PartnerState.GetCanUnlockOnChainLocks() {
+		if rs.dao.IsThisLockHasUnlocked(r.channelIdentifier, proof.Lock.LockSecretHash) ||
+			rs.dao.IsLockSecretHashChannelIdentifierDisposed(proof.Lock.LockSecretHash, r.channelIdentifier) {
+			continue
+		}
+		s.unlocks = append(s.unlocks, proof)
+	}
+	result = utils.NewAsyncResult()
+	result.Tag = s
+	result.Result <- nil
+	return
+}
+
+/*
+buildOfflineTxBundle 按照update,unlock,settle的顺序构造交易,nonce从当前pending nonce开始连续分配.
+settle的参数是假定对方在争议期内不再修改链上状态得出的,如果对方也提交了交易,需要重新生成
+*/
+func (rs *Service) buildOfflineTxBundle(channelIdentifier common.Hash, s *offlineDisputeSnapshot, blockNumber int64) (b *models.OfflineTxBundle, err error) {
+	tokenNetwork, err := rs.Chain.TokenNetwork(s.token)
+	if err != nil {
+		return
+	}
+	nonce, gasPrice, chainID, err := rs.Chain.OfflineTxParams(rs.NodeAddress)
+	if err != nil {
+		return nil, rerr.ErrSpectrumNotConnected.AppendError(err)
+	}
+	b = &models.OfflineTxBundle{
+		ChannelIdentifier: channelIdentifier,
+		Token:             s.token,
+		Partner:           s.partner,
+		Signer:            rs.NodeAddress,
+		CreateBlock:       blockNumber,
+	}
+	add := func(kind string, data []byte, notBefore, deadline int64) {
+		b.Txs = append(b.Txs, &models.OfflineTx{
+			Kind:      kind,
+			To:        rs.Chain.GetRegistryAddress(),
+			Data:      data,
+			Nonce:     nonce,
+			GasPrice:  gasPrice,
+			GasLimit:  params.OfflineTxGasLimit,
+			ChainID:   chainID,
+			NotBefore: notBefore,
+			Deadline:  deadline,
+			Status:    models.OfflineTxStatusUnsigned,
+		})
+		nonce++
+	}
+	var data []byte
+	if s.needUpdate {
+		bp := s.partnerBalanceProof
+		data, err = tokenNetwork.PackUpdateBalanceProof(s.partner, bp.transferAmount, bp.locksroot, bp.nonce, bp.messageHash, bp.signature)
+		if err != nil {
+			return
+		}
+		add(models.OfflineTxKindUpdateBalanceProof, data, blockNumber, s.settleBlock)
+	}
+	transferAmount := new(big.Int).Set(s.partnerTransferAmount)
+	for _, proof := range s.unlocks {
+		data, err = tokenNetwork.PackUnlock(s.partner, transferAmount, proof.Lock, mtree.Proof2Bytes(proof.MerkleProof))
+		if err != nil {
+			return
+		}
+		add(models.OfflineTxKindUnlock, data, blockNumber, s.settleBlock)
+		//每次unlock成功,合约上的TransferAmount都会增加
+		transferAmount = new(big.Int).Add(transferAmount, proof.Lock.Amount)
+	}
+	data, err = tokenNetwork.PackSettle(rs.NodeAddress, s.partner, s.myTransferAmount, transferAmount, s.myLocksroot, s.partnerLocksroot)
+	if err != nil {
+		return
+	}
+	add(models.OfflineTxKindSettle, data, s.settleBlock+1, 0)
+	return
+}
+
+/*
+acceptSignedOfflineTxs 校验签名后的交易,全部校验通过才会保存,之后由submitOfflineTxBundles按时提交
+*/
+func (rs *Service) acceptSignedOfflineTxs(b *models.OfflineTxBundle, signedTxs []hexutil.Bytes) error {
+	if len(signedTxs) != len(b.Txs) {
+		return rerr.ErrArgumentError.Printf("bundle has %d txs, but got %d signed txs", len(b.Txs), len(signedTxs))
+	}
+	for i, raw := range signedTxs {
+		if b.Txs[i].Status != models.OfflineTxStatusUnsigned {
+			return rerr.ErrArgumentError.Printf("tx %d of bundle is already %s", i, b.Txs[i].Status)
+		}
+		tx, err := rpc.DecodeOfflineTx(raw, b.Txs[i], b.Signer)
+		if err != nil {
+			return err
+		}
+		b.Txs[i].SignedTx = raw
+		b.Txs[i].TxHash = tx.Hash()
+	}
+	for _, tx := range b.Txs {
+		tx.Status = models.OfflineTxStatusSigned
+	}
+	return nil
+}
+
+/*
+submitOfflineTxBundles 每个块检查一次已签名的交易,到了时间就提交.
+发送失败的交易下一个块重试,直到错过截止时间
+*/
+func (rs *Service) submitOfflineTxBundles(blockNumber int64) {
+	rs.offlineTxLock.Lock()
+	defer rs.offlineTxLock.Unlock()
+	bs, err := rs.dao.GetAllOfflineTxBundles()
+	if err != nil {
+		log.Error(fmt.Sprintf("GetAllOfflineTxBundles err %s", err))
+		return
+	}
+	for _, b := range bs {
+		if !b.IsSigned() || b.IsFinished() {
+			continue
+		}
+		txs, changed := b.NextToSubmit(blockNumber)
+		for _, otx := range txs {
+			tx := new(types.Transaction)
+			err = rlp.DecodeBytes(otx.SignedTx, tx)
+			if err == nil {
+				err = rs.Chain.SendSignedTransaction(tx)
+			}
+			changed = true
+			if err != nil {
+				log.Warn(fmt.Sprintf("submit offline %s tx of channel %s err %s", otx.Kind, utils.HPex(b.ChannelIdentifier), err))
+				otx.Error = err.Error()
+				//nonce连续,前面的交易没有发出去,后面的也不用再尝试了
+				break
+			}
+			log.Info(fmt.Sprintf("submit offline %s tx of channel %s, txhash=%s", otx.Kind, utils.HPex(b.ChannelIdentifier), otx.TxHash.String()))
+			otx.Status = models.OfflineTxStatusSubmitted
+			otx.Error = ""
+		}
+		if changed {
+			err = rs.dao.SaveOfflineTxBundle(b)
+			if err != nil {
+				log.Error(fmt.Sprintf("SaveOfflineTxBundle err %s", err))
+			}
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package photon
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type trackedOperation struct {
+	op       *models.Operation
+	result   *utils.AsyncResult
+	canceled bool
+	err      error
+	done     chan struct{}
+}
+
+/*
+operationTracker 管理长时间操作,后台等待AsyncResult的结果并保存到数据库,
+调用者立即返回操作ID,之后通过ID查询进度,结果或者撤销操作.
+API线程和photon service主线程都会访问,需要加锁
+*/
+type operationTracker struct {
+	lock                     sync.Mutex
+	dao                      models.OperationDao
+	operations               map[string]*trackedOperation
+	lockSecretHash2Operation map[common.Hash]*trackedOperation
+}
+
+func newOperationTracker(dao models.OperationDao) *operationTracker {
+	return &operationTracker{
+		dao:                      dao,
+		operations:               make(map[string]*trackedOperation),
+		lockSecretHash2Operation: make(map[common.Hash]*trackedOperation),
+	}
+}
+
+/*
+restore 启动时调用,上次没有完成的操作结果已经无法得知,标记为interrupted,同时清理过期的记录
+*/
+func (t *operationTracker) restore() {
+	ops, err := t.dao.GetAllOperations()
+	if err != nil {
+		log.Error(fmt.Sprintf("GetAllOperations err %s", err))
+		return
+	}
+	now := time.Now().Unix()
+	for _, op := range ops {
+		err = nil
+		if !op.IsFinished() {
+			op.Status = models.OperationStatusInterrupted
+			op.EndTime = now
+			err = t.dao.SaveOperation(op)
+		} else if now-op.EndTime > int64(params.OperationKeepTime/time.Second) {
+			err = t.dao.RemoveOperation(op.Key)
+		}
+		if err != nil {
+			log.Error(fmt.Sprintf("restore operation %s err %s", op.Key, err))
+		}
+	}
+}
+
+/*
+start 登记一个长时间操作,之后result.Result只能由operationTracker读取
+*/
+func (t *operationTracker) start(name string, result *utils.AsyncResult, timeout time.Duration) (op *models.Operation, err error) {
+	now := time.Now()
+	result.ID = utils.NewRandomHash().String()
+	result.Deadline = now.Add(timeout)
+	op = &models.Operation{
+		Key:       result.ID,
+		Name:      name,
+		Status:    models.OperationStatusPending,
+		StartTime: now.Unix(),
+		Deadline:  result.Deadline.Unix(),
+	}
+	err = t.dao.SaveOperation(op)
+	if err != nil {
+		return
+	}
+	to := &trackedOperation{
+		op:     op,
+		result: result,
+		done:   make(chan struct{}),
+	}
+	t.lock.Lock()
+	t.operations[op.Key] = to
+	if result.LockSecretHash != utils.EmptyHash {
+		t.lockSecretHash2Operation[result.LockSecretHash] = to
+	}
+	t.lock.Unlock()
+	go t.waitResult(to)
+	return
+}
+
+func (t *operationTracker) waitResult(to *trackedOperation) {
+	var err error
+	status := models.OperationStatusSucceeded
+	select {
+	case err = <-to.result.Result:
+		if err != nil {
+			status = models.OperationStatusFailed
+		}
+	case <-time.After(time.Until(to.result.Deadline)):
+		status = models.OperationStatusTimeout
+		err = rerr.ErrTransferTimeout
+	}
+	t.lock.Lock()
+	if to.canceled {
+		status = models.OperationStatusCanceled
+	}
+	delete(t.operations, to.op.Key)
+	if t.lockSecretHash2Operation[to.result.LockSecretHash] == to {
+		delete(t.lockSecretHash2Operation, to.result.LockSecretHash)
+	}
+	to.op.Status = status
+	to.op.Progress = to.result.Progress()
+	to.op.EndTime = time.Now().Unix()
+	if err != nil {
+		to.op.Error = err.Error()
+	}
+	to.err = err
+	err2 := t.dao.SaveOperation(to.op)
+	t.lock.Unlock()
+	if err2 != nil {
+		log.Error(fmt.Sprintf("save operation %s err %s", to.op.Key, err2))
+	}
+	close(to.done)
+}
+
+/*
+wait 最多等待`timeout`,返回操作是否已经结束以及操作的结果
+*/
+func (t *operationTracker) wait(id string, timeout time.Duration) (finished bool, err error) {
+	t.lock.Lock()
+	to, ok := t.operations[id]
+	t.lock.Unlock()
+	if !ok {
+		op, err2 := t.dao.GetOperation(id)
+		if err2 != nil {
+			return false, err2
+		}
+		if op.Error != "" {
+			err = rerr.ErrUnknown.Append(op.Error)
+		}
+		return op.IsFinished(), err
+	}
+	select {
+	case <-to.done:
+		return true, to.err
+	case <-time.After(timeout):
+		return false, nil
+	}
+}
+
+//addTransferProgress 交易状态发生变化时记录到对应的操作中
+func (t *operationTracker) addTransferProgress(std *models.SentTransferDetail) {
+	if std == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	to, ok := t.lockSecretHash2Operation[std.LockSecretHash]
+	if !ok {
+		return
+	}
+	to.result.AddProgress(fmt.Sprintf("status=%d,%s", std.Status, std.StatusMessage))
+	to.op.Progress = to.result.Progress()
+	err := t.dao.SaveOperation(to.op)
+	if err != nil {
+		log.Error(fmt.Sprintf("save operation %s err %s", to.op.Key, err))
+	}
+}
+
+//get returns operation `id`, pending operations are read from memory to get latest progress
+func (t *operationTracker) get(id string) (op *models.Operation, err error) {
+	t.lock.Lock()
+	to, ok := t.operations[id]
+	if ok {
+		op2 := *to.op
+		op2.Progress = to.result.Progress()
+		op = &op2
+	}
+	t.lock.Unlock()
+	if ok {
+		return
+	}
+	return t.dao.GetOperation(id)
+}
+
+/*
+cancel 撤销一个还没有完成的操作,操作的最终状态在收到结果以后更新
+*/
+func (t *operationTracker) cancel(id string) error {
+	t.lock.Lock()
+	to, ok := t.operations[id]
+	t.lock.Unlock()
+	if !ok {
+		op, err := t.dao.GetOperation(id)
+		if err != nil {
+			return err
+		}
+		return rerr.InvalidState(fmt.Sprintf("operation already %s", op.Status))
+	}
+	//撤销成功以后结果可能立即返回,所以先标记
+	t.lock.Lock()
+	to.canceled = true
+	t.lock.Unlock()
+	err := to.result.Cancel()
+	if err != nil {
+		t.lock.Lock()
+		to.canceled = false
+		t.lock.Unlock()
+		if err == utils.ErrNotCancelable {
+			return rerr.ErrInvalidState.Printf("operation %s can not be canceled", to.op.Name)
+		}
+		return err
+	}
+	to.result.AddProgress("cancel requested")
+	return nil
+}
@@ -0,0 +1,55 @@
+package photon
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOperationTracker(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	ot := newOperationTracker(dao)
+	result := utils.NewAsyncResult()
+	result.LockSecretHash = utils.NewRandomHash()
+	op, err := ot.start("transfer", result, time.Minute)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	finished, err := ot.wait(op.Key, time.Millisecond)
+	assert.False(t, finished)
+	assert.Nil(t, err)
+	ot.addTransferProgress(&models.SentTransferDetail{LockSecretHash: result.LockSecretHash, StatusMessage: "MediatedTransfer send success"})
+	op, err = ot.get(op.Key)
+	assert.Nil(t, err)
+	assert.EqualValues(t, models.OperationStatusPending, op.Status)
+	assert.EqualValues(t, 1, len(op.Progress))
+	//没有设置撤销方法的操作不能撤销
+	assert.NotNil(t, ot.cancel(op.Key))
+	result.SetCancel(func() error {
+		result.Result <- errors.New("canceled")
+		return nil
+	})
+	assert.Nil(t, ot.cancel(op.Key))
+	finished, err = ot.wait(op.Key, time.Second)
+	assert.True(t, finished)
+	assert.NotNil(t, err)
+	op, err = ot.get(op.Key)
+	assert.Nil(t, err)
+	assert.EqualValues(t, models.OperationStatusCanceled, op.Status)
+
+	//重启以后,没有完成的操作标记为interrupted
+	op, err = ot.start("transfer", utils.NewAsyncResult(), time.Minute)
+	assert.Nil(t, err)
+	ot2 := newOperationTracker(dao)
+	ot2.restore()
+	op, err = ot2.get(op.Key)
+	assert.Nil(t, err)
+	assert.EqualValues(t, models.OperationStatusInterrupted, op.Status)
+}
@@ -39,11 +39,20 @@ const (
 	MixUDPXMPP
 	//MixUDPMatrix Matrix and UDP at the same time
 	MixUDPMatrix
+	//CustomTransports 按照Transports中的顺序同时使用多个transport,排在前面的优先
+	CustomTransports
 )
 
 //Config is configuration for Photon,
 type Config struct {
 	EthRPCEndPoint            string
+	EthRPCBackupEndPoints     []string       //EthRPCEndPoint不可用时依次尝试的备用公链节点
+	ForkConfirmBlocks         int64          //EnableForkConfirm时事件经过这么多块确认以后才处理,0表示使用ForkConfirmNumber
+	StateBackupPeer           common.Address //同一运营者的另一个节点,定期把加密的通道状态备份发给它,也只接收它发来的备份
+	SelfTestEchoNode          common.Address //自检时默认使用的回声节点
+	EchoNode                  bool           //作为回声节点,把收到的自检交易退回给发起方
+	ShareNetworkStats         bool           //同意和通道伙伴交换匿名的token网络统计
+	GossipCapacity            bool           //同意和通道伙伴交换通道容量,并且转发其他节点的通道容量
 	Host                      string
 	Port                      int
 	PrivateKey                *ecdsa.PrivateKey
@@ -71,8 +80,26 @@ type Config struct {
 	PfsHost                   string // pathfinder server host
 	HTTPUsername              string
 	HTTPPassword              string
+	HTTPAPIKey                string //调用REST API时需要在X-API-Key头中携带的key,为空时不检查
+	IPCPath                   string //不为空时在这个unix socket上提供JSON-RPC接口
+	StdioRPC                  bool   //通过标准输入输出提供JSON-RPC接口,不启动REST API
+	APIProfile                string //REST API暴露哪些接口,见APIProfileFull,APIProfileMediator
+	MaxRouteRetries           int    //发起的交易在一条路由上失败以后最多再尝试多少条路由,0表示不限制
+	RouteRetryDeadline        int64  //交易发起这么多块以后路由失败不再尝试其他路由,0表示不限制
+	TargetApproval            bool   //收到给自己的交易以后等待应用通过API确认,确认以后才发送SecretRequest
+	MaxMediatedChannelLocks   int    //作为中间节点,每个通道中同时持有对方的锁最多这么多个,0表示使用通道的reveal_timeout
+	MaxMediatedPerInitiator   int    //作为中间节点,同一个发起方同时通过本节点中转的交易最多这么多笔,0表示不限制
+	PfsRouting                bool   //发起交易时没有指定路由则向pfs查询,查询失败时使用本地路由
 }
 
+//REST API的部署模式
+const (
+	//APIProfileFull 暴露全部接口
+	APIProfileFull = "full"
+	//APIProfileMediator 纯中转节点,只暴露查询和收费配置接口,不能发起交易,也不能关闭通道,节点由其他工具管理
+	APIProfileMediator = "mediator"
+)
+
 //DefaultConfig default config
 var DefaultConfig = Config{
 	Port:          InitialPort,
@@ -89,6 +116,8 @@ var DefaultConfig = Config{
 	MsgTimeout:        100 * time.Second,
 	EnableHealthCheck: false,
 	XMPPServer:        DefaultXMPPServer,
+	APIProfile:        APIProfileFull,
+	MaxRouteRetries:   DefaultMaxRouteRetries,
 }
 
 //ConditionQuit is for test
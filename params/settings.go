@@ -47,6 +47,21 @@ const DefaultTxTimeout = 5 * time.Minute //15seconds for one block,it may take s
 //MaxRequestTimeout args
 const MaxRequestTimeout = 20 * time.Minute //longest time for a request ,for example ,settle all channles?
 
+//OperationKeepTime 已经完成的长时间操作记录保留多久
+var OperationKeepTime = 7 * 24 * time.Hour
+
+//DefaultQueryNodeAdvertisementTimeout 查询其他节点公开信息的超时时间
+var DefaultQueryNodeAdvertisementTimeout = 30 * time.Second
+
+//SettleCountdownNotifyInterval 通道关闭以后,每隔多少块通知一次结算倒计时
+var SettleCountdownNotifyInterval int64 = 100
+
+//MaxUserReqQueueDepth 用户请求队列积压超过此值时,拒绝新的交易请求,避免接受必然超时的交易
+var MaxUserReqQueueDepth = 8
+
+//MaxStateChangeQueueDepth 链上事件队列积压超过此值时,拒绝新的交易请求
+var MaxStateChangeQueueDepth = 8
+
 var gasLimitHex string
 
 //ChannelSettleTimeoutMin min settle timeout
@@ -173,9 +188,12 @@ var GenesisBlockHashToPFS = map[common.Address]string{
 // DefaultEthRPCPollPeriodForTest :
 var DefaultEthRPCPollPeriodForTest = 500 * time.Millisecond
 
-// DefaultEthRPCPollPeriod :
+// DefaultEthRPCPollPeriod : 不能订阅新块时,轮询公链新块的间隔
 var DefaultEthRPCPollPeriod = 7500 * time.Millisecond
 
+// EthRPCSubscribeNewHead : 是否尝试订阅新块通知,http rpc不支持订阅,会自动退回到轮询
+var EthRPCSubscribeNewHead = true
+
 // TestPrivateChainID :
 var TestPrivateChainID int64 = 8888
 
@@ -185,6 +203,18 @@ var TestPrivateChainID2 int64 = 7888
 // EthRPCTimeout :
 var EthRPCTimeout = 3 * time.Second
 
+// EthRPCReconnectMinInterval 公链断线后第一次重连的等待时间,之后每次失败加倍
+var EthRPCReconnectMinInterval = 3 * time.Second
+
+// EthRPCReconnectMaxInterval 公链重连等待时间的上限
+var EthRPCReconnectMaxInterval = time.Minute
+
+// EthRPCStallRetryTimes 连续这么多次获取到的块号都没有变化,并且配置了多个公链节点时,切换到下一个节点
+var EthRPCStallRetryTimes = 30
+
+// EthRPCPrimaryRetryInterval 切换到备用公链节点以后,每隔这么长时间检查一次主节点,主节点恢复后切换回去
+var EthRPCPrimaryRetryInterval = 5 * time.Minute
+
 // ContractVersionPrefix :
 var ContractVersionPrefix = "0.6"
 
@@ -208,3 +238,321 @@ var DefaultMDNSQueryInterval = time.Second
 
 //EnableMDNS 是否启用mdns
 var EnableMDNS = true
+
+//DefaultPingTimeout 诊断节点连通性时,等待对方回复ping的时间
+var DefaultPingTimeout = 10 * time.Second
+
+//PeerUnreachableTimeout ping或者发送消息以后超过这么长时间没有收到对方的任何消息,认为对方无法到达,路由时避开它
+var PeerUnreachableTimeout = 30 * time.Second
+
+//PeerUnreachableExpire 超过这么长时间没有再探测无法到达的节点,就不再避开它,让路由重新尝试
+var PeerUnreachableExpire = 5 * time.Minute
+
+//PeerMisbehaviorGreylistThreshold 某个节点的协议违规次数达到这个值以后,路由时不再经过该节点
+var PeerMisbehaviorGreylistThreshold int64 = 10
+
+//PeerMessageRate 每个节点每秒最多发给我们的消息个数,超出的直接丢弃,0表示不限制
+var PeerMessageRate = 50
+
+//PeerMessageBurst 每个节点短时间内最多可以突发的消息个数
+var PeerMessageBurst = 200
+
+//PeerBytesRate 每个节点每秒最多发给我们的字节数
+var PeerBytesRate = 1024 * 1024
+
+//SealedFrameRate 所有节点每秒最多发给我们的Sealed帧个数,Sealed帧解密以后才知道发送方,只能在解密之前统一限制,0表示不限制
+var SealedFrameRate = 200
+
+//SealedFrameBurst 短时间内最多可以突发的Sealed帧个数
+var SealedFrameBurst = 1000
+
+//PeerBanThreshold 一分钟内因为超出限制而丢弃某个节点的消息达到这个数目以后,暂时屏蔽该节点
+var PeerBanThreshold = 500
+
+//PeerBanDuration 屏蔽期间丢弃该节点的所有消息
+var PeerBanDuration = 10 * time.Minute
+
+//RouteStatsHalfLife 经过每个下一跳的交易成功和失败次数的半衰期,很久以前的失败不再影响路由
+var RouteStatsHalfLife = time.Hour
+
+//RouteTimeoutExcludeThreshold 经过某个下一跳的交易连续这么多次锁过期以后,暂时不再经过它,0表示不排除
+var RouteTimeoutExcludeThreshold int64 = 3
+
+//RouteTimeoutExcludeDuration 连续超时的下一跳不参与路由的时间
+var RouteTimeoutExcludeDuration = 30 * time.Minute
+
+//StateBackupInterval 每隔多少块向备份节点发送一次通道状态备份
+var StateBackupInterval int64 = 100
+
+//StateBackupFullInterval 每发送这么多次增量备份以后,发送一次全量备份,这样备份节点可以丢弃之前的备份
+var StateBackupFullInterval int64 = 24
+
+//StateBackupFragmentSize 备份数据分片大小,保证StateBackup消息不超过UDPMaxMessageSize
+const StateBackupFragmentSize = 1000
+
+//NetworkStatsInterval 同意共享统计时,每隔多少块向通道伙伴发送一次网络统计
+var NetworkStatsInterval int64 = 600
+
+//NetworkStatsMaxAge 超过这么多块没有更新的节点统计不再计入全网统计
+var NetworkStatsMaxAge int64 = 5760
+
+//NetworkStatsMaxSize 一次发送的统计数据大小上限,保证NetworkStats消息不超过UDPMaxMessageSize
+const NetworkStatsMaxSize = 1000
+
+//CapacityGossipInterval 同意交换通道容量时,每隔多少块向通道伙伴发送一次自己的和转发的通道容量
+var CapacityGossipInterval int64 = 30
+
+//CapacityMaxAge 超过这么多块没有更新的通道容量不再用于路由
+var CapacityMaxAge int64 = 300
+
+//CapacityRelayMaxEntries 每次发送时最多转发多少条其他节点的通道容量,限制转发占用的带宽
+var CapacityRelayMaxEntries = 50
+
+//CapacityUpdateMaxEntries 一个CapacityUpdate消息中最多包含多少条通道容量,保证消息不超过UDPMaxMessageSize
+const CapacityUpdateMaxEntries = 7
+
+//NotifyBufferSize 每个通知通道的缓冲区大小,上层没有及时读取的通知保存在缓冲区中
+var NotifyBufferSize = 100
+
+//NotifyOverflowPolicy 通知缓冲区满时的处理方式,drop-oldest,drop-newest或者block-with-timeout
+var NotifyOverflowPolicy = "drop-oldest"
+
+//NotifyBlockTimeout 溢出策略为block-with-timeout时,最多等待上层读取的时间
+var NotifyBlockTimeout = time.Second
+
+//NotifyLocale 事件通知中说明文字的语言,内置zh和en,可以通过--notify-catalog增加
+var NotifyLocale = "zh"
+
+//NotifyJournalSize 内存中保留最近多少条通知,断线重连的客户端可以从自己的游标开始补收
+var NotifyJournalSize = 1000
+
+//NotifyHistorySize 数据库中至少保留最近多少条通知,供离线的客户端补收,0表示全部保留
+var NotifyHistorySize = 100000
+
+//DBSyncCritical 通道状态,balance proof,密码等关键数据的fsync策略,always或者periodic
+var DBSyncCritical = "always"
+
+//DBSyncReconstructible 交易历史,收费记录,网络统计等可重建数据的fsync策略,always,periodic或者never
+var DBSyncReconstructible = "always"
+
+//DBSyncInterval fsync策略为periodic时,每隔多长时间fsync一次
+var DBSyncInterval = time.Second
+
+//MaxInFlightTransfersPerToken 每种token同时进行中的自己发起的交易数,达到上限时新的交易按照优先级排队
+var MaxInFlightTransfersPerToken = 16
+
+//TransferSlotsReservedForUser 为用户发起的交易保留的并发数,计划中的交易和平衡交易不能占用
+var TransferSlotsReservedForUser = 4
+
+//InfiniteApprove 授权不够时一次授权最大额度,以后的存款不再需要approve
+var InfiniteApprove = false
+
+//SendConcurrency 同时调用transport发送的消息数目,积压时按照优先级发送
+var SendConcurrency = 16
+
+//SendPriorityAging 等待发送的消息每等待这么长时间提升一级优先级,0表示不提升
+var SendPriorityAging = 2 * time.Second
+
+//SendUrgentBlocks 离过期不到这么多块的MediatedTransfer按照最高优先级发送
+var SendUrgentBlocks int64 = 10
+
+//MailboxURL 信箱服务的地址,为空表示不使用.对方不在线时消息加密以后存放到信箱,自己定期从信箱取回消息
+var MailboxURL = ""
+
+//MailboxPollInterval 从信箱取回消息的间隔
+var MailboxPollInterval = 30 * time.Second
+
+//MailboxTimeout 访问信箱服务的超时时间
+var MailboxTimeout = 10 * time.Second
+
+//Transports --transports指定的transport,按照优先级从高到低排列,可以是udp,xmpp,matrix或者通过network.RegisterTransport注册的其他实现
+var Transports []string
+
+/*
+NAT udp端口映射方式:none不映射,any自动选择,upnp,pmp或者pmp:网关ip,extip:外网ip表示已经手工映射好了.
+映射以后通过中继和对方交换公网地址,打洞以后直接用udp通信
+*/
+var NAT = "none"
+
+//TransportEncryption 是否用对方的公钥加密发出的消息,需要对方的版本能够解密
+var TransportEncryption = false
+
+//WatchMempool 是否监听公链节点的交易池,在对方关闭通道的交易打包之前就做好准备,需要websocket或者ipc连接
+var WatchMempool = false
+
+//PendingCloseExpireBlocks 在交易池中看到的关闭通道的交易超过这么多块还没有打包,认为已经被丢弃,通道恢复正常
+var PendingCloseExpireBlocks int64 = 30
+
+//WebhookURLs 交易和通道状态变化时POST通知的地址,为空时不启用webhook
+var WebhookURLs []string
+
+//WebhookSecret 用来对webhook请求做HMAC-SHA256签名,为空时不签名
+var WebhookSecret = ""
+
+//WebhookMaxRetries 投递失败以后最多重试次数,仍然失败则保存为dead letter
+var WebhookMaxRetries = 5
+
+//WebhookRetryInterval 第一次重试前的等待时间,之后每次翻倍
+var WebhookRetryInterval = 2 * time.Second
+
+//WebhookTimeout 一次webhook请求的超时时间
+var WebhookTimeout = 10 * time.Second
+
+//WebhookQueueSize 每个地址最多排队多少条还没有投递的通知,超过的直接保存为dead letter
+var WebhookQueueSize = 1000
+
+//CaptureFile 不为空时把收发的原始消息记录到这个文件中,用于排查和其他实现之间的兼容问题
+var CaptureFile = ""
+
+//CapturePeers 只记录和这些节点之间的消息,为空时记录所有节点
+var CapturePeers []common.Address
+
+//ReplayCaptureFile 不为空时不连接网络,而是重放这个capture文件中收到的消息
+var ReplayCaptureFile = ""
+
+//ExtensionPlugin 不为空时加载这个Go plugin作为运营方自定义的节点策略
+var ExtensionPlugin = ""
+
+//ExtensionSidecar 不为空时通过http调用这个地址上独立进程实现的节点策略,不能和ExtensionPlugin同时使用
+var ExtensionSidecar = ""
+
+//ExtensionTimeout 一次调用sidecar的超时时间,photon在主线程中同步调用,不能太长
+var ExtensionTimeout = 3 * time.Second
+
+//GraphPruneInterval 每隔多少块检查一次路由图,移除长时间不在线的节点
+var GraphPruneInterval int64 = 100
+
+//GraphPruneOfflineBlocks 节点连续不在线超过这么多块以后,不再参与路由,重新上线后恢复
+var GraphPruneOfflineBlocks int64 = 5760
+
+//UnlockRoundIdleTime 超过这么长时间没有发送新的Unlock,认为本轮结算结束,下一轮重新确定gasPrice
+var UnlockRoundIdleTime = time.Minute
+
+//EnableGasPriceOracle 为true时,合约调用的gasPrice由公链节点的eth_gasPrice按照下面的策略调整得到,否则固定使用DefaultGasPrice.默认关闭,和以前的行为保持一致
+var EnableGasPriceOracle = false
+
+//GasPriceMultiplier 公链节点建议的gasPrice乘以这个百分比后使用,100表示原样使用
+var GasPriceMultiplier int64 = 100
+
+//MinGasPrice gasPrice下限,0表示不限制
+var MinGasPrice = big.NewInt(0)
+
+//MaxGasPrice gasPrice上限,包括替换交易提高后的gasPrice,0表示不限制
+var MaxGasPrice = big.NewInt(0)
+
+//TxStuckTimeout 交易发出后超过这么长时间还没有打包,认为被卡住了,用更高的gasPrice发送替换交易,0表示不替换
+var TxStuckTimeout = 5 * time.Minute
+
+//GasPriceBumpPercent 替换交易比被替换的交易至少提高的gasPrice百分比,公链节点要求至少提高10%才接受替换
+var GasPriceBumpPercent int64 = 20
+
+//NonceReserveTimeout 已经发出的交易超过这么长时间还没有被公链pending nonce覆盖,就检查它是否还在交易池中,被丢弃的交易占用的nonce会重新分配
+var NonceReserveTimeout = time.Minute
+
+//OfflineTxGasLimit 离线签名的争议期交易使用的gasLimit,签名时无法估算,取一个足够unlock使用的值
+var OfflineTxGasLimit uint64 = 500000
+
+//SelfTestAmount 自检时没有指定金额,默认存款并支付的金额
+var SelfTestAmount int64 = 1
+
+//SelfTestTimeout 自检需要等待开通道和合作关闭通道的交易打包,整个过程的最长时间
+var SelfTestTimeout = 30 * time.Minute
+
+//SelfTestPollInterval 自检时检查通道状态的间隔
+var SelfTestPollInterval = time.Second
+
+//SelfTestTransferData 自检交易的附言,回声节点只退回带有这个附言的交易
+const SelfTestTransferData = "photon-selftest"
+
+//SelfTestEchoData 回声节点退回交易的附言
+const SelfTestEchoData = "photon-selftest-echo"
+
+//InboundCapacityReasonMaxLength InboundCapacityRequest中附言的最大长度,保证消息不超过UDPMaxMessageSize
+const InboundCapacityReasonMaxLength = 256
+
+//TransferApprovalReasonMaxLength 接收方拒绝交易的原因的最大长度,原因会放在AnnounceDisposed中发给上家
+const TransferApprovalReasonMaxLength = 256
+
+//PaymentIDMaxLength MediatedTransfer中用户指定的支付ID的最大长度
+const PaymentIDMaxLength = 64
+
+//InvoiceMaxLength MediatedTransfer中发票信息的最大长度,和支付ID一起保证消息不超过UDPMaxMessageSize
+const InvoiceMaxLength = 256
+
+//IdempotencyKeyMaxLength 调用者指定的交易幂等键的最大长度
+const IdempotencyKeyMaxLength = 128
+
+//BlockCallbackQueueSize 异步执行的新块回调最多积压这么多个块,超过以后丢弃最旧的块
+var BlockCallbackQueueSize = 10
+
+//BlockTimeEstimateWindow 根据最近这么多个块的到达时间估计出块间隔
+var BlockTimeEstimateWindow = 20
+
+/*
+ClockSkewThreshold 本机时钟和块时间戳相差超过这个值时警告,并且和其他节点给出的时间戳比较时修正本机时钟.
+没有超过时不修正,因为使用确认块时块时间戳本来就落后几个块
+*/
+var ClockSkewThreshold = 5 * time.Minute
+
+//ForceUnlockWaitBlocks ForceUnlock最多等待这么多个块让关闭通道以及注册密码的交易生效
+var ForceUnlockWaitBlocks int64 = 10
+
+//PendingUnlockRetryBlocks 对方关闭通道以后,注册密码或者unlock的交易提交以后这么多个块还没有结果就重新提交
+var PendingUnlockRetryBlocks int64 = 10
+
+//MaxSplitParts 拆分支付最多拆分成这么多笔交易,每笔交易都要占用一个锁,并且都要支付各自路由的手续费
+var MaxSplitParts = 4
+
+//CircuitBreakerWindow 统计token网络异常的时间窗口
+var CircuitBreakerWindow = 10 * time.Minute
+
+//CircuitBreakerAnnounceDisposedThreshold 时间窗口内收到这么多AnnounceDisposed就暂停这个token的新交易
+var CircuitBreakerAnnounceDisposedThreshold = 20
+
+//CircuitBreakerInvalidSignatureThreshold 时间窗口内收到这么多签名错误的消息就暂停这个token的新交易
+var CircuitBreakerInvalidSignatureThreshold = 10
+
+//CircuitBreakerUnexpectedCloseThreshold 时间窗口内这么多通道被对方关闭就暂停这个token的新交易
+var CircuitBreakerUnexpectedCloseThreshold = 3
+
+//DefaultMaxRouteRetries 发起的交易在一条路由上失败以后默认最多再尝试这么多条路由
+const DefaultMaxRouteRetries = 3
+
+//MediationFee 中转手续费,固定部分Constant加上比例部分 金额/Percent,Percent为0表示没有比例部分
+type MediationFee struct {
+	Constant *big.Int
+	Percent  int64
+}
+
+/*
+MediationFeeSchedule 每个token的默认中转手续费,节点没有单独设置这个token或者通道的手续费时使用.
+发起方也用它估算没有手续费信息的路由上每个中转节点收取的手续费
+*/
+var MediationFeeSchedule = make(map[common.Address]*MediationFee)
+
+//MonitoringServiceURL 第三方监控服务接收委托的地址,为空时不能委托
+var MonitoringServiceURL = ""
+
+//MonitoringServiceAddress 监控服务在链上提交交易的账户,委托的unlock签名中要包含这个地址
+var MonitoringServiceAddress common.Address
+
+//MonitoringReward 每次委托付给监控服务的报酬,固定部分加上比例部分 (对方转给我的金额+未解锁金额)/Percent
+var MonitoringReward = &MediationFee{Constant: big.NewInt(0)}
+
+//MonitoringServiceTimeout 一次委托请求的超时时间
+var MonitoringServiceTimeout = 10 * time.Second
+
+//PfsAddress 接收查询路由费用的pfs账户,为空时不付费
+var PfsAddress common.Address
+
+//PfsQueryFee 每次向pfs查询路由付的费用,为0时不付费
+var PfsQueryFee = big.NewInt(0)
+
+//PfsIOUExpiration 付给pfs的欠条在多少块以后过期,每次查询都会延长
+var PfsIOUExpiration int64 = 50000
+
+//PfsRoutingMaxPaths 发起交易时最多向pfs要这么多条路由
+var PfsRoutingMaxPaths = 3
+
+//MaxBatchChannelOperations 一次批量开通道或者存款最多包含的通道数
+const MaxBatchChannelOperations = 100
@@ -0,0 +1,61 @@
+package photon
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+)
+
+/*
+PaymentMeta 用户给交易指定的支付ID和可选的发票信息,随MediatedTransfer一路传给target,
+发送方和接收方都会保存下来,商户可以用支付ID和订单对账,不必记录LockSecretHash
+*/
+type PaymentMeta struct {
+	PaymentID string `json:"payment_id,omitempty"`
+	Invoice   []byte `json:"invoice,omitempty"`
+}
+
+//IsEmpty 没有指定支付ID和发票
+func (p *PaymentMeta) IsEmpty() bool {
+	return p == nil || (p.PaymentID == "" && len(p.Invoice) == 0)
+}
+
+func (p *PaymentMeta) paymentID() string {
+	if p == nil {
+		return ""
+	}
+	return p.PaymentID
+}
+
+func (p *PaymentMeta) invoice() []byte {
+	if p == nil {
+		return nil
+	}
+	return p.Invoice
+}
+
+//validate 发票必须和支付ID一起使用,长度不能超过消息中的限制
+func (p *PaymentMeta) validate() error {
+	if p.IsEmpty() {
+		return nil
+	}
+	if p.PaymentID == "" {
+		return rerr.ErrArgumentError.Append("invoice must be used with payment_id")
+	}
+	if len(p.PaymentID) > params.PaymentIDMaxLength {
+		return rerr.ErrArgumentError.Append(fmt.Sprintf("payment_id too long, length must <= %d", params.PaymentIDMaxLength))
+	}
+	if len(p.Invoice) > params.InvoiceMaxLength {
+		return rerr.ErrArgumentError.Append(fmt.Sprintf("invoice too large, length must <= %d", params.InvoiceMaxLength))
+	}
+	return nil
+}
+
+//PaymentRecords 同一个支付ID下发出和收到的所有交易
+type PaymentRecords struct {
+	PaymentID string                       `json:"payment_id"`
+	Sent      []*models.SentTransferDetail `json:"sent"`
+	Received  []*models.ReceivedTransfer   `json:"received"`
+}
@@ -0,0 +1,30 @@
+package photon
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaymentMetaValidate(t *testing.T) {
+	var p *PaymentMeta
+	assert.True(t, p.IsEmpty())
+	assert.Nil(t, p.validate())
+	assert.EqualValues(t, "", p.paymentID())
+	assert.Nil(t, p.invoice())
+
+	p = &PaymentMeta{PaymentID: "order-1", Invoice: []byte("invoice")}
+	assert.False(t, p.IsEmpty())
+	assert.Nil(t, p.validate())
+
+	p = &PaymentMeta{Invoice: []byte("invoice")}
+	assert.NotNil(t, p.validate())
+
+	p = &PaymentMeta{PaymentID: strings.Repeat("a", params.PaymentIDMaxLength+1)}
+	assert.NotNil(t, p.validate())
+
+	p = &PaymentMeta{PaymentID: "order-1", Invoice: make([]byte, params.InvoiceMaxLength+1)}
+	assert.NotNil(t, p.validate())
+}
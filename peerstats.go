@@ -0,0 +1,119 @@
+package photon
+
+import (
+	"sync"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//PeerMisbehavior 记录某个节点发来的违反协议的消息个数
+type PeerMisbehavior struct {
+	Address common.Address `json:"address"`
+	//InvalidSignature 签名者不是通道参与方
+	InvalidSignature int64 `json:"invalid_signature"`
+	//InvalidNonce nonce错误
+	InvalidNonce int64 `json:"invalid_nonce"`
+	//StaleBalanceProof 过时的或者金额减少的balance proof
+	StaleBalanceProof int64 `json:"stale_balance_proof"`
+	//OtherError 其他处理失败的消息
+	OtherError    int64  `json:"other_error"`
+	LastError     string `json:"last_error"`
+	LastErrorTime int64  `json:"last_error_time"`
+	Greylisted    bool   `json:"greylisted"`
+}
+
+//misbehaviorCount 计入灰名单判断的违规次数,不包括OtherError,因为正常运行中也会出现
+func (pm *PeerMisbehavior) misbehaviorCount() int64 {
+	return pm.InvalidSignature + pm.InvalidNonce + pm.StaleBalanceProof
+}
+
+//PeerStatistics 所有节点的违规统计,只保存在内存中,重启后清零
+type PeerStatistics struct {
+	//UnparseableMessage 无法解析或者签名无效的消息个数,无法确定发送方
+	UnparseableMessage int64              `json:"unparseable_message"`
+	Peers              []*PeerMisbehavior `json:"peers"`
+}
+
+type peerStats struct {
+	lock  sync.Mutex
+	peers map[common.Address]*PeerMisbehavior
+}
+
+func newPeerStats() *peerStats {
+	return &peerStats{
+		peers: make(map[common.Address]*PeerMisbehavior),
+	}
+}
+
+/*
+recordError 根据onMessage返回的错误类型,记录节点`sender`的违规次数
+*/
+func (ps *peerStats) recordError(sender common.Address, err error) {
+	if err == nil {
+		return
+	}
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	pm, ok := ps.peers[sender]
+	if !ok {
+		pm = &PeerMisbehavior{Address: sender}
+		ps.peers[sender] = pm
+	}
+	se, ok := err.(rerr.StandardError)
+	if !ok {
+		pm.OtherError++
+	} else {
+		switch se.ErrorCode {
+		case rerr.ErrChannelNotParticipant.ErrorCode, rerr.ErrChannelInvalidSender.ErrorCode:
+			pm.InvalidSignature++
+		case rerr.ErrInvalidNonce.ErrorCode:
+			pm.InvalidNonce++
+		case rerr.ErrChannelTransferAmountDecrease.ErrorCode,
+			rerr.ErrChannelBalanceDecrease.ErrorCode,
+			rerr.ErrChannelBalanceProofAlreadyRegisteredOnChain.ErrorCode,
+			rerr.ErrUpdateBalanceProofAfterClosed.ErrorCode,
+			rerr.ErrInvalidLocksRoot.ErrorCode:
+			pm.StaleBalanceProof++
+		default:
+			pm.OtherError++
+		}
+	}
+	pm.LastError = err.Error()
+	pm.LastErrorTime = time.Now().Unix()
+}
+
+//isGreylisted 节点违规次数是否达到了阈值
+func (ps *peerStats) isGreylisted(addr common.Address) bool {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	pm, ok := ps.peers[addr]
+	return ok && pm.misbehaviorCount() >= params.PeerMisbehaviorGreylistThreshold
+}
+
+//greylist 返回所有达到阈值的节点,可以直接作为GetBestRoutes的exclude参数
+func (ps *peerStats) greylist() map[common.Address]bool {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	m := make(map[common.Address]bool)
+	for addr, pm := range ps.peers {
+		if pm.misbehaviorCount() >= params.PeerMisbehaviorGreylistThreshold {
+			m[addr] = true
+		}
+	}
+	return m
+}
+
+//snapshot 返回统计信息的拷贝,避免外部修改
+func (ps *peerStats) snapshot() (peers []*PeerMisbehavior) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	for _, pm := range ps.peers {
+		pm2 := *pm
+		pm2.Greylisted = pm.misbehaviorCount() >= params.PeerMisbehaviorGreylistThreshold
+		peers = append(peers, &pm2)
+	}
+	return
+}
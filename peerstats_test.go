@@ -0,0 +1,36 @@
+package photon
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeerStats(t *testing.T) {
+	ps := newPeerStats()
+	addr := utils.NewRandomAddress()
+	ps.recordError(addr, rerr.InvalidNonce("test"))
+	ps.recordError(addr, rerr.ErrChannelTransferAmountDecrease)
+	ps.recordError(addr, rerr.ErrChannelInvalidSender)
+	ps.recordError(addr, errors.New("unknown channel"))
+	peers := ps.snapshot()
+	assert.EqualValues(t, 1, len(peers))
+	pm := peers[0]
+	assert.EqualValues(t, addr, pm.Address)
+	assert.EqualValues(t, 1, pm.InvalidNonce)
+	assert.EqualValues(t, 1, pm.StaleBalanceProof)
+	assert.EqualValues(t, 1, pm.InvalidSignature)
+	assert.EqualValues(t, 1, pm.OtherError)
+	assert.EqualValues(t, false, pm.Greylisted)
+	assert.EqualValues(t, false, ps.isGreylisted(addr))
+	for i := int64(0); i < params.PeerMisbehaviorGreylistThreshold; i++ {
+		ps.recordError(addr, rerr.ErrInvalidNonce)
+	}
+	assert.EqualValues(t, true, ps.isGreylisted(addr))
+	assert.EqualValues(t, true, ps.greylist()[addr])
+	assert.EqualValues(t, false, ps.isGreylisted(utils.NewRandomAddress()))
+}
@@ -0,0 +1,117 @@
+package photon
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/channel"
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer"
+	"github.com/SmartMeshFoundation/Photon/utils"
+)
+
+/*
+通道被对方关闭以后,对方发给我的锁中我知道密码的,必须在settle之前链上unlock,否则这些钱就归对方了.
+正常情况下相关的StateManager以及HandleBalanceProofUpdated会注册密码和unlock,但是这些交易都是异步提交的,
+失败了或者提交前崩溃了都不会再重试.
+所以关闭时把这些锁记录到数据库,之后每个新块检查一次,直到unlock成功或者已经来不及:
+1. 密码还没有链上注册,在锁过期之前注册密码
+2. 密码已经注册,并且我已经updateBalanceProof,等params.PendingUnlockRetryBlocks个块还没有unlock就自己提交
+*/
+
+//savePendingUnlocks 对方关闭通道时调用,记录需要链上unlock的锁
+func (rs *Service) savePendingUnlocks(ch *channel.Channel) {
+	settleBlock := ch.GetSettleExpiration(0)
+	for lockSecretHash, l := range ch.PartnerState.Lock2UnclaimedLocks {
+		if !l.IsRegisteredOnChain && l.Lock.Expiration < ch.ExternState.ClosedBlock {
+			//已经来不及注册密码了
+			continue
+		}
+		p := models.NewPendingUnlock(ch.ChannelIdentifier.ChannelIdentifier, lockSecretHash, l.Secret, l.Lock.Expiration, settleBlock)
+		err := rs.dao.SavePendingUnlock(p)
+		if err != nil {
+			log.Error(fmt.Sprintf("SavePendingUnlock %s on channel %s err %s", utils.HPex(lockSecretHash), ch.ChannelIdentifier.String(), err))
+		}
+	}
+}
+
+//handlePendingUnlocks 每个新块调用一次
+func (rs *Service) handlePendingUnlocks(blockNumber int64) {
+	ps, err := rs.dao.GetAllPendingUnlocks()
+	if err != nil {
+		log.Error(fmt.Sprintf("GetAllPendingUnlocks err %s", err))
+		return
+	}
+	for _, p := range ps {
+		done, changed := rs.handlePendingUnlock(p, blockNumber)
+		if done {
+			err = rs.dao.RemovePendingUnlock(p.Key)
+		} else if changed {
+			err = rs.dao.SavePendingUnlock(p)
+		}
+		if err != nil {
+			log.Error(fmt.Sprintf("update pending unlock %s err %s", utils.HPex(p.LockSecretHash), err))
+		}
+	}
+}
+
+/*
+handlePendingUnlock done表示已经unlock或者再也不可能unlock,记录可以删除了,
+changed表示p有变化需要保存
+*/
+func (rs *Service) handlePendingUnlock(p *models.PendingUnlock, blockNumber int64) (done, changed bool) {
+	ch, err := rs.findChannelByIdentifier(p.ChannelIdentifier)
+	if err != nil || ch.State != channeltype.StateClosed || blockNumber >= p.SettleBlock {
+		return true, false
+	}
+	if rs.dao.IsThisLockHasUnlocked(p.ChannelIdentifier, p.LockSecretHash) {
+		log.Info(fmt.Sprintf("pending unlock %s on channel %s finished", utils.HPex(p.LockSecretHash), utils.HPex(p.ChannelIdentifier)))
+		return true, false
+	}
+	l, ok := ch.PartnerState.Lock2UnclaimedLocks[p.LockSecretHash]
+	if !ok {
+		return true, false
+	}
+	if !l.IsRegisteredOnChain {
+		if blockNumber > p.Expiration {
+			log.Warn(fmt.Sprintf("secret of pending unlock %s on channel %s not registered before expiration",
+				utils.HPex(p.LockSecretHash), utils.HPex(p.ChannelIdentifier)))
+			return true, false
+		}
+		if p.RegisterSubmitBlock > 0 && blockNumber < p.RegisterSubmitBlock+params.PendingUnlockRetryBlocks {
+			return
+		}
+		err = rs.StateMachineEventHandler.eventContractSendRegisterSecret(&mediatedtransfer.EventContractSendRegisterSecret{Secret: p.Secret})
+		if err != nil {
+			log.Error(fmt.Sprintf("register secret of pending unlock %s err %s", utils.HPex(p.LockSecretHash), err))
+		}
+		p.RegisterSubmitBlock = blockNumber
+		return false, true
+	}
+	bp := ch.PartnerState.BalanceProofState
+	if bp.LocksRoot != bp.ContractLocksRoot {
+		//updateBalanceProof还没有生效,这时候unlock一定会失败
+		return
+	}
+	if p.UnlockWaitBlock == 0 && blockNumber+params.PendingUnlockRetryBlocks < p.SettleBlock {
+		//HandleBalanceProofUpdated或者StateManager应该已经提交了unlock,先等等结果
+		p.UnlockWaitBlock = blockNumber
+		return false, true
+	}
+	if p.UnlockWaitBlock > 0 && blockNumber < p.UnlockWaitBlock+params.PendingUnlockRetryBlocks {
+		return
+	}
+	log.Info(fmt.Sprintf("submit pending unlock %s on channel %s", utils.HPex(p.LockSecretHash), utils.HPex(p.ChannelIdentifier)))
+	proof := channel.ComputeProofForLock(l.Lock, ch.PartnerState.Tree)
+	result := ch.ExternState.Unlock([]*channeltype.UnlockProof{proof}, bp.ContractTransferAmount)
+	go func() {
+		err := <-result.Result
+		if err != nil {
+			log.Error(fmt.Sprintf("pending unlock %s on channel %s failed %s", utils.HPex(p.LockSecretHash), utils.HPex(p.ChannelIdentifier), err))
+		}
+	}()
+	p.UnlockWaitBlock = blockNumber
+	return false, true
+}
@@ -0,0 +1,100 @@
+package photon
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/channel"
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/network/graph"
+	"github.com/SmartMeshFoundation/Photon/network/rpc/contracts"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/transfer"
+	"github.com/SmartMeshFoundation/Photon/transfer/mtree"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPendingUnlock(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	token := utils.NewRandomAddress()
+	secret := utils.NewRandomHash()
+	lockSecretHash := utils.ShaSecret(secret[:])
+	id := contracts.ChannelUniqueID{ChannelIdentifier: utils.NewRandomHash()}
+	ch := &channel.Channel{
+		ChannelIdentifier: id,
+		ExternState:       &channel.ExternalState{ChannelIdentifier: id, ClosedBlock: 50},
+		OurState:          &channel.EndState{Address: utils.NewRandomAddress()},
+		PartnerState: &channel.EndState{
+			Address:           utils.NewRandomAddress(),
+			Lock2PendingLocks: make(map[common.Hash]channeltype.PendingLock),
+			Lock2UnclaimedLocks: map[common.Hash]channeltype.UnlockPartialProof{
+				lockSecretHash: {
+					Lock:                &mtree.Lock{Expiration: 100, Amount: big.NewInt(1), LockSecretHash: lockSecretHash},
+					Secret:              secret,
+					IsRegisteredOnChain: true,
+				},
+				//已经过期并且密码没有注册的锁不用管
+				utils.NewRandomHash(): {
+					Lock:   &mtree.Lock{Expiration: 40, Amount: big.NewInt(1)},
+					Secret: utils.NewRandomHash(),
+				},
+			},
+			BalanceProofState: transfer.NewEmptyBalanceProofState(),
+		},
+		TokenAddress:  token,
+		SettleTimeout: 100,
+		State:         channeltype.StateClosed,
+	}
+	ch.PartnerState.BalanceProofState.LocksRoot = utils.NewRandomHash()
+	rs := &Service{
+		dao: dao,
+		Token2ChannelGraph: map[common.Address]*graph.ChannelGraph{
+			token: {ChannelIdentifier2Channel: map[common.Hash]*channel.Channel{id.ChannelIdentifier: ch}},
+		},
+	}
+	rs.savePendingUnlocks(ch)
+	ps, err := dao.GetAllPendingUnlocks()
+	assert.Nil(t, err)
+	if !assert.Len(t, ps, 1) {
+		return
+	}
+	assert.Equal(t, lockSecretHash, ps[0].LockSecretHash)
+	assert.EqualValues(t, 150, ps[0].SettleBlock)
+
+	//updateBalanceProof还没有生效,不能unlock
+	rs.handlePendingUnlocks(60)
+	ps, _ = dao.GetAllPendingUnlocks()
+	assert.EqualValues(t, 0, ps[0].UnlockWaitBlock)
+	//生效以后先等别人提交的unlock
+	ch.PartnerState.BalanceProofState.ContractLocksRoot = ch.PartnerState.BalanceProofState.LocksRoot
+	rs.handlePendingUnlocks(61)
+	ps, _ = dao.GetAllPendingUnlocks()
+	assert.EqualValues(t, 61, ps[0].UnlockWaitBlock)
+	rs.handlePendingUnlocks(60 + params.PendingUnlockRetryBlocks)
+	ps, _ = dao.GetAllPendingUnlocks()
+	assert.EqualValues(t, 61, ps[0].UnlockWaitBlock)
+	//unlock成功以后删除
+	dao.UnlockThisLock(id.ChannelIdentifier, lockSecretHash)
+	rs.handlePendingUnlocks(62)
+	ps, _ = dao.GetAllPendingUnlocks()
+	assert.Len(t, ps, 0)
+}
+
+func TestPendingUnlockChannelSettled(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	rs := &Service{dao: dao}
+	p := models.NewPendingUnlock(utils.NewRandomHash(), utils.NewRandomHash(), utils.NewRandomHash(), 100, 200)
+	err := dao.SavePendingUnlock(p)
+	assert.Nil(t, err)
+	//通道已经不存在了
+	rs.handlePendingUnlocks(10)
+	ps, err := dao.GetAllPendingUnlocks()
+	assert.Nil(t, err)
+	assert.Len(t, ps, 0)
+}
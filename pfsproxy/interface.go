@@ -22,6 +22,11 @@ type PfsProxy interface {
 	*/
 	FindPath(peerFrom, peerTo, token common.Address, amount *big.Int, isInitiator bool) (resp []FindPathResponse, err error)
 
+	/*
+		find routes for initiator, pay for the query with iou
+	*/
+	FindRoutes(peerFrom, peerTo, token common.Address, amount *big.Int, limitPaths int, iou *IOU) (resp []FindPathResponse, err error)
+
 	/*
 		set fee rate by account
 	*/
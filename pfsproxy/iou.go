@@ -0,0 +1,46 @@
+package pfsproxy
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+IOU 查询路由时付给pfs的欠条.
+Amount是付给Receiver的累计金额,每次查询都在上一张欠条的基础上增加查询费用,
+pfs只需要保留最新的一张,在ExpirationBlock之前凭它向Sender收款
+*/
+type IOU struct {
+	Sender          common.Address `json:"sender"`
+	Receiver        common.Address `json:"receiver"`
+	Amount          *big.Int       `json:"amount"`
+	ExpirationBlock int64          `json:"expiration_block"`
+	Signature       []byte         `json:"signature"`
+}
+
+//Sign 签名内容为sender,receiver,amount,expiration_block和chain_id
+func (iou *IOU) Sign(key *ecdsa.PrivateKey) []byte {
+	var err error
+	buf := new(bytes.Buffer)
+	_, err = buf.Write(iou.Sender[:])
+	_, err = buf.Write(iou.Receiver[:])
+	_, err = buf.Write(utils.BigIntTo32Bytes(iou.Amount))
+	err = binary.Write(buf, binary.BigEndian, iou.ExpirationBlock)
+	_, err = buf.Write(utils.BigIntTo32Bytes(params.ChainID))
+	if err != nil {
+		log.Error(fmt.Sprintf("signData err %s", err))
+	}
+	iou.Signature, err = utils.SignData(key, buf.Bytes())
+	if err != nil {
+		log.Crit(fmt.Sprintf("signDataFor IOU err %s", err))
+	}
+	return iou.Signature
+}
@@ -153,6 +153,7 @@ type findPathPayload struct {
 	SortDemand        string         `json:"sort_demand"`
 	Signature         []byte         `json:"signature"`
 	PeerFromChargeFee bool           `json:"peer_from_charge_fee"`
+	IOU               *IOU           `json:"iou,omitempty"` //查询费用,不参与payload签名
 }
 
 func (p *findPathPayload) sign(key *ecdsa.PrivateKey) []byte {
@@ -182,10 +183,11 @@ func (p *findPathPayload) sign(key *ecdsa.PrivateKey) []byte {
 
 // FindPathResponse :
 type FindPathResponse struct {
-	PathID  int      `json:"path_id"`
-	PathHop int      `json:"path_hop"`
-	Fee     *big.Int `json:"fee"`
-	Result  []string `json:"result"`
+	PathID   int      `json:"path_id"`
+	PathHop  int      `json:"path_hop"`
+	Fee      *big.Int `json:"fee"`
+	Capacity *big.Int `json:"capacity,omitempty"` //pfs估计的路径上可以转账的最大金额,为空表示pfs没有给出
+	Result   []string `json:"result"`
 }
 
 // GetPath get path array
@@ -201,10 +203,6 @@ func (fpr *FindPathResponse) GetPath() []common.Address {
 FindPath : find path
 */
 func (pfg *pfsClient) FindPath(peerFrom, peerTo, token common.Address, amount *big.Int, isInitiator bool) (resp []FindPathResponse, err error) {
-	if pfg.host == "" || pfg.privateKey == nil {
-		err = ErrNotInit
-		return
-	}
 	payload := &findPathPayload{
 		PeerFrom:          peerFrom,
 		PeerTo:            peerTo,
@@ -214,6 +212,30 @@ func (pfg *pfsClient) FindPath(peerFrom, peerTo, token common.Address, amount *b
 		SortDemand:        "",
 		PeerFromChargeFee: !isInitiator,
 	}
+	return pfg.findPath(payload)
+}
+
+/*
+FindRoutes : 发起方查询最多limitPaths条路由,iou不为空时随请求一起付给pfs
+*/
+func (pfg *pfsClient) FindRoutes(peerFrom, peerTo, token common.Address, amount *big.Int, limitPaths int, iou *IOU) (resp []FindPathResponse, err error) {
+	payload := &findPathPayload{
+		PeerFrom:     peerFrom,
+		PeerTo:       peerTo,
+		TokenAddress: token,
+		LimitPaths:   limitPaths,
+		SendAmount:   amount,
+		SortDemand:   "",
+		IOU:          iou,
+	}
+	return pfg.findPath(payload)
+}
+
+func (pfg *pfsClient) findPath(payload *findPathPayload) (resp []FindPathResponse, err error) {
+	if pfg.host == "" || pfg.privateKey == nil {
+		err = ErrNotInit
+		return
+	}
 	payload.sign(pfg.privateKey)
 	req := &req{
 		FullURL: pfg.host + "/pfs/1/paths",
@@ -236,7 +258,8 @@ func (pfg *pfsClient) FindPath(peerFrom, peerTo, token common.Address, amount *b
 	}
 	err = json.Unmarshal(body, &resp)
 	if err != nil {
-		panic(err)
+		err = rerr.ErrPFS.Append(fmt.Sprintf("invalid find path response %s", err))
+		return
 	}
 	log.Trace(fmt.Sprintf("resp=%s", string(body)))
 	return
@@ -0,0 +1,87 @@
+package photon
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/pfsproxy"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+以--pfs-routing启动时,发起交易没有指定路由的话,在交易进入主线程之前向pfs查询路由,
+每次查询附上一张欠条支付params.PfsQueryFee.
+查询失败或者没有可用的路由时返回nil,交易仍然按照原来的方式使用本地路由
+*/
+
+//queryPfsRoutes 在api的goroutine中调用,不能访问只属于主线程的状态
+func (rs *Service) queryPfsRoutes(token, target common.Address, amount *big.Int) []pfsproxy.FindPathResponse {
+	if !rs.Config.PfsRouting || rs.PfsProxy == nil {
+		return nil
+	}
+	iou, err := rs.nextPfsIOU()
+	if err != nil {
+		log.Error(fmt.Sprintf("create iou for pfs err %s, use local routing", err))
+		return nil
+	}
+	routes, err := rs.PfsProxy.FindRoutes(rs.NodeAddress, target, token, amount, params.PfsRoutingMaxPaths, iou)
+	if err != nil {
+		log.Warn(fmt.Sprintf("find routes to %s from pfs err %s, use local routing", utils.APex2(target), err))
+		return nil
+	}
+	var available []pfsproxy.FindPathResponse
+	for _, r := range routes {
+		if len(r.Result) == 0 {
+			continue
+		}
+		if r.Capacity != nil && r.Capacity.Cmp(amount) < 0 {
+			log.Trace(fmt.Sprintf("ignore pfs route %v, capacity %s is less than %s", r.Result, r.Capacity, amount))
+			continue
+		}
+		available = append(available, r)
+	}
+	if len(available) == 0 {
+		log.Warn(fmt.Sprintf("pfs returns no available route to %s, use local routing", utils.APex2(target)))
+	}
+	return available
+}
+
+/*
+nextPfsIOU 在上一张欠条的基础上增加params.PfsQueryFee,没有配置费用时返回nil.
+发送之前先保存,即使pfs没有收到,以后的欠条金额也只会更大,pfs不会因此少收
+*/
+func (rs *Service) nextPfsIOU() (iou *pfsproxy.IOU, err error) {
+	if params.PfsQueryFee == nil || params.PfsQueryFee.Sign() <= 0 || params.PfsAddress == utils.EmptyAddress {
+		return
+	}
+	rs.pfsIOULock.Lock()
+	defer rs.pfsIOULock.Unlock()
+	last, err := rs.dao.GetPfsIOU(params.PfsAddress)
+	if err == rerr.ErrNotFound {
+		last = &models.PfsIOU{
+			Receiver: params.PfsAddress,
+			Amount:   big.NewInt(0),
+		}
+	} else if err != nil {
+		return
+	}
+	last.Amount = new(big.Int).Add(last.Amount, params.PfsQueryFee)
+	last.ExpirationBlock = rs.GetBlockNumber() + params.PfsIOUExpiration
+	err = rs.dao.SavePfsIOU(last)
+	if err != nil {
+		return
+	}
+	iou = &pfsproxy.IOU{
+		Sender:          rs.NodeAddress,
+		Receiver:        last.Receiver,
+		Amount:          last.Amount,
+		ExpirationBlock: last.ExpirationBlock,
+	}
+	iou.Sign(rs.PrivateKey)
+	return
+}
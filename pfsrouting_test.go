@@ -0,0 +1,87 @@
+package photon
+
+import (
+	"errors"
+	"math/big"
+	"sync/atomic"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/pfsproxy"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakePfsRouter struct {
+	pfsproxy.PfsProxy
+	routes []pfsproxy.FindPathResponse
+	err    error
+	ious   []*pfsproxy.IOU
+}
+
+func (f *fakePfsRouter) FindRoutes(peerFrom, peerTo, token common.Address, amount *big.Int, limitPaths int, iou *pfsproxy.IOU) ([]pfsproxy.FindPathResponse, error) {
+	f.ious = append(f.ious, iou)
+	return f.routes, f.err
+}
+
+func TestQueryPfsRoutes(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	key, addr := utils.MakePrivateKeyAddress()
+	pfs := &fakePfsRouter{}
+	rs := &Service{
+		dao:         dao,
+		PrivateKey:  key,
+		NodeAddress: addr,
+		PfsProxy:    pfs,
+		Config:      &params.Config{PfsRouting: true},
+	}
+	rs.BlockNumber = new(atomic.Value)
+	rs.BlockNumber.Store(int64(100))
+	oldAddress, oldFee := params.PfsAddress, params.PfsQueryFee
+	defer func() {
+		params.PfsAddress, params.PfsQueryFee = oldAddress, oldFee
+	}()
+	params.PfsAddress = utils.NewRandomAddress()
+	params.PfsQueryFee = big.NewInt(3)
+
+	token, target := utils.NewRandomAddress(), utils.NewRandomAddress()
+	pfs.routes = []pfsproxy.FindPathResponse{
+		{Fee: big.NewInt(1), Capacity: big.NewInt(5), Result: []string{utils.NewRandomAddress().String(), target.String()}},
+		{Fee: big.NewInt(2), Result: []string{utils.NewRandomAddress().String(), target.String()}},
+		{Fee: big.NewInt(0)},
+	}
+	routes := rs.queryPfsRoutes(token, target, big.NewInt(10))
+	//容量不够的和空路由都要去掉
+	if assert.Len(t, routes, 1) {
+		assert.EqualValues(t, big.NewInt(2), routes[0].Fee)
+	}
+	//欠条金额是累计的
+	pfs.err = errors.New("pfs down")
+	routes = rs.queryPfsRoutes(token, target, big.NewInt(10))
+	assert.Nil(t, routes)
+	if assert.Len(t, pfs.ious, 2) {
+		assert.EqualValues(t, big.NewInt(3), pfs.ious[0].Amount)
+		assert.EqualValues(t, big.NewInt(6), pfs.ious[1].Amount)
+		assert.Equal(t, params.PfsAddress, pfs.ious[1].Receiver)
+		assert.EqualValues(t, 100+params.PfsIOUExpiration, pfs.ious[1].ExpirationBlock)
+		assert.NotEmpty(t, pfs.ious[1].Signature)
+	}
+	iou, err := dao.GetPfsIOU(params.PfsAddress)
+	assert.Nil(t, err)
+	assert.EqualValues(t, big.NewInt(6), iou.Amount)
+
+	//不付费时不附带欠条
+	params.PfsQueryFee = big.NewInt(0)
+	pfs.err = nil
+	rs.queryPfsRoutes(token, target, big.NewInt(1))
+	if assert.Len(t, pfs.ious, 3) {
+		assert.Nil(t, pfs.ious[2])
+	}
+	//没有启用pfs路由时不查询
+	rs.Config.PfsRouting = false
+	assert.Nil(t, rs.queryPfsRoutes(token, target, big.NewInt(1)))
+	assert.Len(t, pfs.ious, 3)
+}
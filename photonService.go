@@ -1,12 +1,15 @@
 package photon
 
 import (
+	"context"
 	"crypto/ecdsa"
 
 	"fmt"
 
 	"time"
 
+	"sync"
+
 	"sync/atomic"
 
 	"math/big"
@@ -21,6 +24,7 @@ import (
 	"github.com/SmartMeshFoundation/Photon/channel"
 	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
 	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/extension"
 	"github.com/SmartMeshFoundation/Photon/internal/rpanic"
 	"github.com/SmartMeshFoundation/Photon/log"
 	"github.com/SmartMeshFoundation/Photon/models"
@@ -139,6 +143,32 @@ type Service struct {
 	ChanHistoryContractEventsDealComplete chan struct{}
 	BuildInfo                             *BuildInfo
 	ChanSubmitBalanceProofToPFS           chan *channel.Channel // 供submitBalanceProofToPfsLoop线程使用
+	NodeAdvertisementQueryMap             map[int64]*nodeAdvertisementQuery // 等待对方返回NodeAdvertisementResponse的查询,key为请求的nonce
+	peerStats                             *peerStats                        // 各个节点的协议违规统计,用于灰名单和路由选择
+	transferQueue                         *transferQueue                    // 自己发起的交易的发送队列,按token限制并发数
+	mempoolWatcher                        *blockchain.MempoolWatcher        // 监听交易池中对方关闭通道的交易,没有启用时为nil
+	webhooks                              *webhookDispatcher                // 把交易和通道状态通知POST到配置的地址,没有启用时为nil
+	extension                             extension.Extension               // 运营方自定义的节点策略,没有配置时为nil
+	extensionSub                          *notify.Subscription              // 把通知交给extension
+	pendingCloses                         map[common.Hash]*pendingClose     // 交易池中看到的还没有打包的对方关闭通道的交易
+	routeAffinity                         *routeAffinity                    // 重复向同一个target付款时优先使用上次成功的通道
+	routeStats                            *routeStats                       // 每个下一跳的交易成功和失败次数,经常失败的排到后面
+	inboundCapacityRequests               *inboundCapacityRequests          // 发出和收到的请求对方存款的记录
+	InboundCapacityPolicy                 InboundCapacityPolicy             // 决定如何处理收到的请求对方存款的请求
+	blockCallbacks                        *blockCallbacks                   // 每个新块都要执行的回调
+	offlineTxLock                         sync.Mutex                        // 保护离线签名交易的读写,避免提交签名和定时发送同时修改
+	nodeLastOnline                        map[common.Address]int64          // 路由图中节点最后一次被观察到在线的块号,用于移除长时间不在线的节点
+	stateBackupHashes                     map[common.Hash]common.Hash       // 上次发送备份时各个通道状态的hash,用于增量备份
+	stateBackupCount                      int64                             // 启动以来发送备份的次数
+	operations                            *operationTracker                 // 长时间操作,比如交易,调用者可以通过操作ID查询进度
+	wal                                   *transfer.WriteAheadLog           // 链上事件处理之前先写入WAL,崩溃以后重放
+	clockDiverged                         bool                              // 已经通知过app本机时钟和块时间戳相差太多
+	splitPayments                         map[common.Hash]*splitPayment     // 正在进行的拆分支付,只在主线程中访问
+	circuitBreakers                       *circuitBreakers                  // 每个token的熔断器,异常太多时暂停发起新交易
+	capacityRelays                        capacityRelayQueue                // 收到的其他节点的通道容量,下次发送时转发,只在主线程中访问
+	pfsIOULock                            sync.Mutex                        // 付给pfs的欠条金额是累计的,并发查询路由时要按顺序增加
+	transferApprover                      TransferApprover                  // 接收方应用注册的确认回调,为nil时按照Config.TargetApproval决定是否等待确认
+	transferApproverLock                  sync.Mutex
 }
 
 //NewPhotonService create photon service
@@ -167,17 +197,47 @@ func NewPhotonService(chain *rpc.BlockChainService, privateKey *ecdsa.PrivateKey
 		SentMediatedTransferListenerMap:       make(map[*SentMediatedTransferListener]bool),
 		HealthCheckMap:                        make(map[common.Address]bool),
 		quitChan:                              make(chan struct{}),
+		transferQueue:                         newTransferQueue(),
+		pendingCloses:                         make(map[common.Hash]*pendingClose),
+		splitPayments:                         make(map[common.Hash]*splitPayment),
+		circuitBreakers:                       newCircuitBreakers(),
+		capacityRelays:                        make(capacityRelayQueue),
 		isStarting:                            true,
 		StopCreateNewTransfers:                false,
 		EthConnectionStatus:                   make(chan netshare.Status, 10),
 		ChanHistoryContractEventsDealComplete: make(chan struct{}),
 		BuildInfo:                             new(BuildInfo),
 		ChanSubmitBalanceProofToPFS:           make(chan *channel.Channel, 100),
+		NodeAdvertisementQueryMap:             make(map[int64]*nodeAdvertisementQuery),
+		peerStats:                             newPeerStats(),
+		routeAffinity:                         newRouteAffinity(),
+		routeStats:                            newRouteStats(),
+		inboundCapacityRequests:               newInboundCapacityRequests(),
+		InboundCapacityPolicy:                 &ManualInboundCapacityPolicy{},
+		blockCallbacks:                        newBlockCallbacks(),
+		nodeLastOnline:                        make(map[common.Address]int64),
+		operations:                            newOperationTracker(dao),
+		wal:                                   transfer.NewWriteAheadLog(dao),
 	}
 	rs.BlockNumber.Store(int64(0))
+	err = rs.NotifyHandler.SetStore(dao)
+	if err != nil {
+		return
+	}
 	rs.MessageHandler = newPhotonMessageHandler(rs)
 	rs.StateMachineEventHandler = newStateMachineEventHandler(rs)
 	rs.Protocol = network.NewPhotonProtocol(transport, privateKey, rs)
+	if params.CaptureFile != "" {
+		var capture *network.CaptureWriter
+		capture, err = network.NewCaptureWriter(params.CaptureFile, params.CapturePeers)
+		if err != nil {
+			return
+		}
+		rs.Protocol.SetCapture(capture)
+	}
+	if params.MailboxURL != "" {
+		rs.Protocol.SetMailbox(network.NewMailboxClient(params.MailboxURL, privateKey))
+	}
 	//todo fixme MatrixTransport should have a better contructor function
 	mtransport, ok := rs.Transport.(*network.MatrixMixTransport)
 	if ok {
@@ -186,6 +246,12 @@ func NewPhotonService(chain *rpc.BlockChainService, privateKey *ecdsa.PrivateKey
 			return
 		}
 	}
+	if ptransport, ok := rs.Transport.(*network.PriorityTransport); ok {
+		err = ptransport.SetMatrixDB(rs.dao)
+		if err != nil {
+			return
+		}
+	}
 	rs.Protocol.SetReceivedMessageSaver(NewAckHelper(rs.dao))
 	/*
 		only one instance for one data directory
@@ -203,6 +269,19 @@ func NewPhotonService(chain *rpc.BlockChainService, privateKey *ecdsa.PrivateKey
 		return
 	}
 	rs.BlockChainEvents = blockchain.NewBlockChainEvents(chain.Client, chain, rs.dao)
+	if config.ForkConfirmBlocks > 0 {
+		rs.BlockChainEvents.SetForkConfirmBlocks(config.ForkConfirmBlocks)
+	}
+	if params.WatchMempool {
+		rs.mempoolWatcher = blockchain.NewMempoolWatcher(chain.Client, chain.GetRegistryAddress(), rs.NodeAddress)
+	}
+	if len(params.WebhookURLs) > 0 {
+		rs.webhooks = newWebhookDispatcher(params.WebhookURLs, params.WebhookSecret, rs.NodeAddress, dao, rs.NotifyHandler)
+	}
+	rs.extension, err = extension.Open(params.ExtensionPlugin, params.ExtensionSidecar)
+	if err != nil {
+		return
+	}
 	// fee module
 	if config.EnableMediationFee {
 		// pathfinder
@@ -216,6 +295,32 @@ func NewPhotonService(chain *rpc.BlockChainService, privateKey *ecdsa.PrivateKey
 	} else {
 		rs.FeePolicy = &NoFeePolicy{}
 	}
+	//这两个回调都要访问路由图或者通道状态,只能在主线程中执行
+	rs.RegisterBlockCallback("pruneChannelGraphs", BlockCallbackPriorityNormal, false, func(blockNumber int64) {
+		if params.GraphPruneInterval > 0 && blockNumber%params.GraphPruneInterval == 0 {
+			rs.pruneChannelGraphs(blockNumber)
+		}
+	})
+	//提交离线签名的交易需要访问链,不能阻塞主线程
+	if rs.mempoolWatcher != nil {
+		rs.RegisterBlockCallback("expirePendingCloses", BlockCallbackPriorityNormal, false, rs.expirePendingCloses)
+	}
+	rs.RegisterBlockCallback("submitOfflineTxBundles", BlockCallbackPriorityNormal, true, rs.submitOfflineTxBundles)
+	rs.RegisterBlockCallback("backupStateToPeer", BlockCallbackPriorityLow, false, func(blockNumber int64) {
+		if params.StateBackupInterval > 0 && blockNumber%params.StateBackupInterval == 0 {
+			rs.backupStateToPeer(blockNumber)
+		}
+	})
+	rs.RegisterBlockCallback("gossipNetworkStats", BlockCallbackPriorityLow, false, func(blockNumber int64) {
+		if params.NetworkStatsInterval > 0 && blockNumber%params.NetworkStatsInterval == 0 {
+			rs.gossipNetworkStats(blockNumber)
+		}
+	})
+	rs.RegisterBlockCallback("gossipCapacity", BlockCallbackPriorityLow, false, func(blockNumber int64) {
+		if params.CapacityGossipInterval > 0 && blockNumber%params.CapacityGossipInterval == 0 {
+			rs.gossipCapacity(blockNumber)
+		}
+	})
 	return rs, nil
 }
 
@@ -234,8 +339,18 @@ func (rs *Service) Start() (err error) {
 	}
 	//在主循环开启之前,protocol层要准备好,可以发送消息,但是不能接收消息
 	rs.Protocol.Start(false)
+	//restore过程中产生的通知也要投递
+	if rs.extension != nil {
+		rs.startExtensionNotifier()
+	}
+	if rs.webhooks != nil {
+		rs.webhooks.start()
+	}
 	//restore 一定要在历史事件处理之前进行,比如链上注册密码事件,需要相应的statemanager发送unlock消息
 	rs.restore()
+	//WAL中的事件可能需要restore恢复的StateManager处理
+	rs.replayWAL()
+	rs.operations.restore()
 	go func() {
 		if rs.Config.ConditionQuit.RandomQuit {
 			go func() {
@@ -297,7 +412,7 @@ func (rs *Service) Start() (err error) {
 	rs.startNeighboursHealthCheck()
 	// 只有在混合模式下启动时,才订阅其他节点的在线状态
 	// Only when starting under MixUDPXMPP, we can subscribe online status of other nodes.
-	if rs.Config.NetworkMode == params.MixUDPXMPP || rs.Config.NetworkMode == params.MixUDPMatrix {
+	if rs.Config.NetworkMode == params.MixUDPXMPP || rs.Config.NetworkMode == params.MixUDPMatrix || rs.Config.NetworkMode == params.CustomTransports {
 		err = rs.startSubscribeNeighborStatus()
 		return
 	}
@@ -310,8 +425,22 @@ func (rs *Service) Stop() {
 	close(rs.quitChan)
 	rs.Protocol.StopAndWait()
 	rs.BlockChainEvents.Stop()
+	if rs.mempoolWatcher != nil {
+		rs.mempoolWatcher.Stop()
+	}
 	rs.Chain.Client.Close()
+	if rs.extension != nil {
+		rs.NotifyHandler.Unsubscribe(rs.extensionSub)
+		err := rs.extension.Close()
+		if err != nil {
+			log.Error(fmt.Sprintf("close extension err %s", err))
+		}
+	}
+	if rs.webhooks != nil {
+		rs.webhooks.stop()
+	}
 	rs.NotifyHandler.Stop()
+	rs.blockCallbacks.stop()
 	time.Sleep(100 * time.Millisecond) // let other goroutines quit
 	rs.dao.CloseDB()
 	//anther instance cann run now
@@ -336,6 +465,11 @@ func (rs *Service) loop() {
 	var st transfer.StateChange
 	var req *apiReq
 	var sentMessage *protocolMessage
+	var reconnecting bool //公链是否处于断线重连中,用于通知连接恢复
+	var pendingTxChan chan *blockchain.PendingChannelTx
+	if rs.mempoolWatcher != nil {
+		pendingTxChan = rs.mempoolWatcher.PendingTxChan
+	}
 
 	defer rpanic.PanicRecover("photon service")
 	for {
@@ -346,6 +480,8 @@ func (rs *Service) loop() {
 				err = rs.MessageHandler.onMessage(m.Msg, m.EchoHash)
 				if err != nil {
 					log.Error(fmt.Sprintf("MessageHandler.onMessage %v", err))
+					rs.peerStats.recordError(m.Msg.GetSender(), err)
+					rs.recordMessageAnomaly(m.Msg, err)
 				}
 				rs.Protocol.ReceivedMessageResultChan <- err
 			} else {
@@ -361,7 +497,10 @@ func (rs *Service) loop() {
 				} else {
 					log.Trace(fmt.Sprintf("statechange received :%s", utils.StringInterface(st, 2)))
 					_, isHistoryComplete := st.(*mediatedtransfer.ContractHistoryEventCompleteStateChange)
-					if isHistoryComplete {
+					reorg, isReorg := st.(*transfer.ChainReorgStateChange)
+					if isReorg {
+						rs.handleChainReorg(reorg)
+					} else if isHistoryComplete {
 						if rs.ChanHistoryContractEventsDealComplete != nil {
 							close(rs.ChanHistoryContractEventsDealComplete)
 							rs.ChanHistoryContractEventsDealComplete = nil
@@ -369,11 +508,7 @@ func (rs *Service) loop() {
 							panic("only can receive ContractHistoryEventCompleteStateChange once")
 						}
 					} else {
-						err = rs.StateMachineEventHandler.OnBlockchainStateChange(st)
-						if err != nil {
-							log.Error(fmt.Sprintf("stateMachineEventHandler.OnBlockchainStateChange %s", err))
-						}
-
+						rs.onBlockchainStateChange(st)
 					}
 				}
 
@@ -381,6 +516,8 @@ func (rs *Service) loop() {
 				log.Info("Events.StateChangeChannel closed")
 				return
 			}
+		case ptx := <-pendingTxChan:
+			rs.handlePendingChannelTx(ptx)
 		//user's request
 		case req, ok = <-rs.UserReqChan:
 			if ok {
@@ -397,6 +534,8 @@ func (rs *Service) loop() {
 				log.Info("ProtocolMessageSendComplete closed")
 				return
 			}
+		case d := <-rs.Protocol.DeliveredMessageChan:
+			rs.handleDeliveredMessage(d)
 		case s := <-rs.Chain.Client.StatusChan:
 			select {
 			case rs.EthConnectionStatus <- s:
@@ -405,8 +544,17 @@ func (rs *Service) loop() {
 			}
 			if s == netshare.Connected {
 				rs.handleEthRPCConnectionOK()
-			} else {
-				rs.NotifyHandler.NotifyString(notify.LevelWarn, "公链连接失败,正在尝试重连")
+				if reconnecting {
+					reconnecting = false
+					rs.NotifyHandler.NotifyEvent(notify.LevelInfo, &notify.Event{
+						Code: notify.EventChainConnected,
+					})
+				}
+			} else if s == netshare.Reconnecting {
+				reconnecting = true
+				rs.NotifyHandler.NotifyEvent(notify.LevelWarn, &notify.Event{
+					Code: notify.EventChainDisconnected,
+				})
 			}
 		case <-rs.quitChan:
 			log.Info(fmt.Sprintf("%s quit now", utils.APex2(rs.NodeAddress)))
@@ -466,6 +614,7 @@ block chain tick,
 it's the core of HTLC
 */
 func (rs *Service) handleBlockNumber(st *transfer.BlockStateChange) {
+	lastBlockNumber := rs.GetBlockNumber()
 	rs.BlockNumber.Store(st.BlockNumber)
 	rs.StateMachineEventHandler.dispatchToAllTasks(st)
 	for _, cg := range rs.Token2ChannelGraph {
@@ -474,12 +623,152 @@ func (rs *Service) handleBlockNumber(st *transfer.BlockStateChange) {
 			if err != nil {
 				log.Error(fmt.Sprintf("ChannelStateTransition err %s", err))
 			}
+			rs.notifySettleCountdown(c, lastBlockNumber, st.BlockNumber)
 		}
 	}
-	rs.dao.SaveLatestBlockNumber(st.BlockNumber)
+	rs.handlePendingUnlocks(st.BlockNumber)
+	rs.blockCallbacks.dispatch(st.BlockNumber)
+	//还在等待确认的事件必须在重启以后重新查询到
+	rs.dao.SaveLatestBlockNumber(rs.BlockChainEvents.CheckpointBlockNumber(st.BlockNumber))
+	//重启以后重新查询的范围之前的链上事件不会再查询到,不需要去重记录
+	if st.BlockNumber > 5*params.ForkConfirmNumber && st.BlockNumber%(5*params.ForkConfirmNumber) == 0 {
+		rs.dao.ClearOldChainEventRecord(uint64(st.BlockNumber - 5*params.ForkConfirmNumber))
+	}
+	rs.notifyClockSkew()
 	return
 }
 
+/*
+notifyClockSkew 本机时钟和块时间戳相差超过params.ClockSkewThreshold以及恢复正常时通知app
+*/
+func (rs *Service) notifyClockSkew() {
+	if rs.BlockChainEvents == nil {
+		return
+	}
+	skew, diverged := rs.BlockChainEvents.ClockSkew()
+	if diverged == rs.clockDiverged {
+		return
+	}
+	rs.clockDiverged = diverged
+	if diverged {
+		rs.NotifyHandler.NotifyEvent(notify.LevelWarn, &notify.Event{
+			Code:   notify.EventClockSkew,
+			Params: map[string]string{notify.ParamSkew: skew.String()},
+		})
+	} else {
+		rs.NotifyHandler.NotifyEvent(notify.LevelInfo, &notify.Event{
+			Code: notify.EventClockSynced,
+		})
+	}
+}
+
+/*
+pruneChannelGraphs 将长时间不在线的节点从路由图中移除,节点重新上线后恢复.
+已经关闭的通道在收到关闭事件时就已经从路由图中移除了.
+*/
+func (rs *Service) pruneChannelGraphs(blockNumber int64) {
+	//无网状态下无法判断其他节点是否在线
+	if rs.Config.IsMeshNetwork {
+		return
+	}
+	for _, cg := range rs.Token2ChannelGraph {
+		for _, node := range cg.AllNodes() {
+			if node == rs.NodeAddress {
+				continue
+			}
+			deviceType, isOnline := rs.Protocol.GetNetworkStatus(node)
+			if deviceType == "" {
+				//没有该节点的在线信息,无法判断
+				continue
+			}
+			if isOnline {
+				rs.nodeLastOnline[node] = blockNumber
+				cg.RestoreNode(node)
+				continue
+			}
+			lastOnline, ok := rs.nodeLastOnline[node]
+			if !ok {
+				rs.nodeLastOnline[node] = blockNumber
+				continue
+			}
+			if blockNumber-lastOnline > params.GraphPruneOfflineBlocks {
+				cg.PruneNode(node)
+			}
+		}
+	}
+}
+
+//notifySentTransferDetail 通知app交易状态发生了变化,同时记录到对应的长时间操作中
+func (rs *Service) notifySentTransferDetail(std *models.SentTransferDetail) {
+	rs.NotifyHandler.NotifySentTransferDetail(std)
+	rs.operations.addTransferProgress(std)
+}
+
+/*
+notifySettleCountdown 已关闭的通道在争议窗口结束,可以settle以及每隔SettleCountdownNotifyInterval块时通知app
+*/
+func (rs *Service) notifySettleCountdown(c *channel.Channel, lastBlockNumber, blockNumber int64) {
+	if c.State != channeltype.StateClosed || c.ExternState.ClosedBlock == 0 || lastBlockNumber <= 0 || lastBlockNumber >= blockNumber {
+		return
+	}
+	sc := channeltype.NewSettleCountdown(c.ExternState.ClosedBlock, c.SettleTimeout, params.PunishBlockNumber, blockNumber)
+	crossed := func(milestone int64) bool {
+		return lastBlockNumber < milestone && milestone <= blockNumber
+	}
+	interval := params.SettleCountdownNotifyInterval
+	periodic := interval > 0 && sc.BlocksUntilSettle > 0 &&
+		(sc.SettleBlock-lastBlockNumber-1)/interval != (sc.SettleBlock-blockNumber-1)/interval
+	if !crossed(sc.DisputeEndBlock) && !crossed(sc.SettleBlock) && !periodic {
+		return
+	}
+	rs.fillSettleCountdownTXStatus(sc, c.ChannelIdentifier.ChannelIdentifier, c.ChannelIdentifier.OpenBlockNumber)
+	rs.NotifyHandler.NotifySettleCountdown(c.ChannelIdentifier.ChannelIdentifier, sc)
+}
+
+/*
+handleChainReorg 公链发生了分叉,被替换的块中的合约事件会由BlockChainEvents重新发送,
+已经处理过的事件重复处理是安全的,这里只需要通知用户,相关的链上操作可能需要更长时间才能确认.
+*/
+func (rs *Service) handleChainReorg(st *transfer.ChainReorgStateChange) {
+	log.Warn(fmt.Sprintf("chain reorg from block %d to %d, contract events in these blocks will be processed again",
+		st.ForkBlockNumber, st.BlockNumber))
+	rs.NotifyHandler.NotifyEvent(notify.LevelWarn, &notify.Event{
+		Code:        notify.EventChainFork,
+		BlockNumber: st.ForkBlockNumber,
+	})
+}
+
+/*
+getSettleCountdown 已关闭通道的结算倒计时,其他状态的通道返回nil
+*/
+func (rs *Service) getSettleCountdown(c *channeltype.Serialization) *channeltype.SettleCountdown {
+	if c.State != channeltype.StateClosed || c.ClosedBlock == 0 {
+		return nil
+	}
+	sc := channeltype.NewSettleCountdown(c.ClosedBlock, c.SettleTimeout, params.PunishBlockNumber, rs.GetBlockNumber())
+	rs.fillSettleCountdownTXStatus(sc, c.ChannelIdentifier.ChannelIdentifier, c.ChannelIdentifier.OpenBlockNumber)
+	return sc
+}
+
+//fillSettleCountdownTXStatus 查询我方是否已经提交了UpdateBalanceProof和unlock,失败的tx不算
+func (rs *Service) fillSettleCountdownTXStatus(sc *channeltype.SettleCountdown, channelIdentifier common.Hash, openBlockNumber int64) {
+	submitted := func(txType models.TXInfoType) bool {
+		list, err := rs.dao.GetTXInfoList(channelIdentifier, openBlockNumber, utils.EmptyAddress, txType, "")
+		if err != nil {
+			log.Error(fmt.Sprintf("GetTXInfoList err %s", err))
+			return false
+		}
+		for _, txInfo := range list {
+			if txInfo.Status != models.TXInfoStatusFailed {
+				return true
+			}
+		}
+		return false
+	}
+	sc.UpdateBalanceProofSubmitted = submitted(models.TXInfoTypeUpdateBalanceProof)
+	sc.UnlockSubmitted = submitted(models.TXInfoTypeUnlock)
+}
+
 //GetBlockNumber return latest blocknumber of ethereum
 func (rs *Service) GetBlockNumber() int64 {
 	return rs.BlockNumber.Load().(int64)
@@ -750,7 +1039,7 @@ Do a direct tranfer with target.
        are required to complete the transfer (from the payer's perspective),
        whereas the mediated transfer requires 6 messages.
 */
-func (rs *Service) directTransferAsync(tokenAddress, target common.Address, amount *big.Int, data string) (result *utils.AsyncResult) {
+func (rs *Service) directTransferAsync(tokenAddress, target common.Address, amount *big.Int, data string, fakeLockSecretHash common.Hash, exclusion *RouteExclusion) (result *utils.AsyncResult) {
 	result = utils.NewAsyncResult()
 	g := rs.getToken2ChannelGraph(tokenAddress)
 	if g == nil {
@@ -762,6 +1051,10 @@ func (rs *Service) directTransferAsync(tokenAddress, target common.Address, amou
 		result.Result <- rerr.ErrChannelNotFound.Append("no available direct channel")
 		return
 	}
+	if exclusion.excludesChannel(directChannel.ChannelIdentifier.ChannelIdentifier) {
+		result.Result <- rerr.ErrNoAvailabeRoute.Append("direct channel is excluded")
+		return
+	}
 	if directChannel.Distributable().Cmp(amount) < 0 {
 		result.Result <- rerr.ErrChannelNoEnoughBalance
 		return
@@ -778,6 +1071,7 @@ func (rs *Service) directTransferAsync(tokenAddress, target common.Address, amou
 		result.Result <- err
 		return
 	}
+	rs.recordChannelMessage(directChannel, tr)
 	//This should be set once the direct transfer is acknowledged
 	transferSuccess := &transfer.EventTransferSentSuccess{
 		LockSecretHash:    utils.EmptyHash,
@@ -786,18 +1080,23 @@ func (rs *Service) directTransferAsync(tokenAddress, target common.Address, amou
 		ChannelIdentifier: directChannel.ChannelIdentifier.ChannelIdentifier,
 		Token:             tokenAddress,
 		Data:              data,
+		Fee:               big.NewInt(0),
+		Path:              []common.Address{target},
 	}
 	/*
-		对于DirectTransfer,生成一个假的LockSecretHash,
+		对于DirectTransfer,使用排队时生成的假LockSecretHash,
 		用于发起方在这里记录发起的交易状态,后续UpdateTransferStatus会更新DB中的值
 	*/
-	tr.FakeLockSecretHash = utils.NewRandomHash()
+	tr.FakeLockSecretHash = fakeLockSecretHash
 	log.Trace(fmt.Sprintf("send direct transfer, use fake lockSecertHash %s to trace transfer status", tr.FakeLockSecretHash.String()))
 	// 构造SentTransferDetail
-	rs.dao.NewSentTransferDetail(tokenAddress, target, amount, data, true, tr.FakeLockSecretHash)
+	rs.dao.NewSentTransferDetail(tokenAddress, target, amount, data, true, tr.FakeLockSecretHash, "", nil)
 	//rs.dao.NewTransferStatus(tokenAddress, tr.FakeLockSecretHash)
+	rs.newTransferLifecycle(tokenAddress, target, amount, true, tr.FakeLockSecretHash)
+	rs.recordTransferStage(tr.FakeLockSecretHash, models.TransferStageRouted, fmt.Sprintf("direct channel %s", directChannel.ChannelIdentifier.ChannelIdentifier.String()))
 	err = rs.sendAsync(directChannel.PartnerState.Address, tr)
 	if err != nil {
+		rs.recordTransferStage(tr.FakeLockSecretHash, models.TransferStageFailed, err.Error())
 		result.Result <- err
 		return
 	}
@@ -845,14 +1144,19 @@ Calls:
  *			2.1 taker should contain lockSecretHash, but no secret.
  *			2.2 maker should contain lockSecretHash and secret.
  */
-func (rs *Service) startMediatedTransferInternal(tokenAddress, target common.Address, amount *big.Int, lockSecretHash common.Hash, expiration int64, secret common.Hash, data string, routeInfo []pfsproxy.FindPathResponse) (result *utils.AsyncResult, stateManager *transfer.StateManager) {
+func (rs *Service) startMediatedTransferInternal(tokenAddress, target common.Address, amount *big.Int, lockSecretHash common.Hash, expiration int64, secret common.Hash, data string, payment *PaymentMeta, routeInfo []pfsproxy.FindPathResponse, exclusion *RouteExclusion, constraints *TransferConstraints) (result *utils.AsyncResult, stateManager *transfer.StateManager) {
 	var availableRoutes []*route.State
 	//var err error
 	//targetAmount := new(big.Int).Sub(amount, fee)
 	result = utils.NewAsyncResult()
+	//没能发起交易时记录失败原因
+	fail := func(err error) {
+		rs.recordTransferStage(lockSecretHash, models.TransferStageFailed, err.Error())
+		result.Result <- err
+	}
 	g := rs.getToken2ChannelGraph(tokenAddress)
 	if g == nil {
-		result.Result <- rerr.ErrTokenNotFound
+		fail(rerr.ErrTokenNotFound)
 		return
 	}
 	// 2019-03消息升级过后,如果参数没有RouteInfo,仅支持与target直接拥有通道的情况下发送交易或是在不收费的网络下使用本地路由
@@ -860,7 +1164,9 @@ func (rs *Service) startMediatedTransferInternal(tokenAddress, target common.Add
 		// 当前为不支持收费的网络下时,使用本地路由
 		if rs.PfsProxy == nil {
 			log.Trace("get available routes without fee from local channel graph")
-			availableRoutes = g.GetBestRoutes(rs.Protocol, rs.NodeAddress, target, amount, amount, graph.EmptyExlude, rs)
+			availableRoutes = g.GetBestRoutes(rs.Protocol, rs.NodeAddress, target, amount, amount, rs.routingExcludeTo(tokenAddress, target), rs)
+			availableRoutes = rs.routeStats.rank(tokenAddress, availableRoutes)
+			availableRoutes = rs.routeAffinity.prefer(tokenAddress, target, availableRoutes)
 		} else {
 			log.Trace("get available routes to partner from local channel graph")
 			ch := rs.getChannel(tokenAddress, target)
@@ -885,16 +1191,43 @@ func (rs *Service) startMediatedTransferInternal(tokenAddress, target common.Add
 			r := route.NewState(ch, path.GetPath())
 			//r.Fee = rs.FeePolicy.GetNodeChargeFee(partnerAddress, tokenAddress, amount) // 发起方不收取手续费
 			r.TotalFee = path.Fee
+			if r.TotalFee == nil {
+				//没有给出手续费时按照params.MediationFeeSchedule估算
+				r.TotalFee = estimatePathFee(tokenAddress, rs.NodeAddress, target, amount, r.Path)
+			}
 			availableRoutes = append(availableRoutes, r)
 		}
+		availableRoutes = rs.routeStats.rank(tokenAddress, availableRoutes)
 	}
 	log.Trace(fmt.Sprintf("availableRoutes=%s", utils.StringInterface(availableRoutes, 3)))
 	if len(availableRoutes) <= 0 {
-		result.Result <- rerr.ErrNoAvailabeRoute
+		fail(rerr.ErrNoAvailabeRoute)
+		return
+	}
+	//锁定金额之前检查每条路由的完整路径,经过被排除的节点或通道的路由都不能用
+	if !exclusion.IsEmpty() {
+		var allowed []*route.State
+		for _, r := range availableRoutes {
+			err := exclusion.checkPath(tokenAddress, rs.Chain.GetRegistryAddress(), rs.NodeAddress, target, r.HopNode(), r.Path)
+			if err != nil {
+				log.Info(fmt.Sprintf("ignore route to %s: %s", utils.APex2(target), err))
+				continue
+			}
+			allowed = append(allowed, r)
+		}
+		if len(allowed) == 0 {
+			fail(rerr.ErrNoAvailabeRoute.Append("all routes go through excluded nodes or channels"))
+			return
+		}
+		availableRoutes = allowed
+	}
+	availableRoutes = rs.extensionFilterRoutes(tokenAddress, target, amount, availableRoutes)
+	if len(availableRoutes) == 0 {
+		fail(rerr.ErrNoAvailabeRoute.Append("all routes are refused by extension"))
 		return
 	}
 	if rs.Config.IsMeshNetwork {
-		result.Result <- rerr.ErrNotAllowMediatedTransfer
+		fail(rerr.ErrNotAllowMediatedTransfer)
 		return
 	}
 	/*
@@ -918,19 +1251,28 @@ func (rs *Service) startMediatedTransferInternal(tokenAddress, target common.Add
 		Secret:         secret,
 		Fee:            utils.BigInt0,
 		Data:           data,
+		PaymentID:      payment.paymentID(),
+		Invoice:        payment.invoice(),
 	}
 	/*
 		发起方每次切换路径不再切换密码,不切换依然可以保证安全
 	*/
 	// Initiator has no need to switch secret, every time he switches the route, and security can be ensured.
 	initInitiator := &mediatedtransfer.ActionInitInitiatorStateChange{
-		OurAddress:     rs.NodeAddress,
-		Tranfer:        transferState,
-		Routes:         routesState,
-		BlockNumber:    rs.GetBlockNumber(),
-		Secret:         secret,
-		LockSecretHash: lockSecretHash,
-		Db:             rs.dao,
+		OurAddress:      rs.NodeAddress,
+		Tranfer:         transferState,
+		Routes:          routesState,
+		BlockNumber:     rs.GetBlockNumber(),
+		Secret:          secret,
+		LockSecretHash:  lockSecretHash,
+		Db:              rs.dao,
+		MaxRouteRetries: rs.Config.MaxRouteRetries,
+		MaxFee:          constraints.maxFee(),
+		MaxHops:         constraints.maxHops(),
+		Deadline:        constraints.deadline(),
+	}
+	if rs.Config.RouteRetryDeadline > 0 {
+		initInitiator.RetryDeadline = initInitiator.BlockNumber + rs.Config.RouteRetryDeadline
 	}
 	//log.Trace(fmt.Sprintf("start mediated transfer availableRoutes=%s", utils.StringInterface(availableRoutes, 2)))
 	stateManager = transfer.NewStateManager(initiator.StateTransition, nil, initiator.NameInitiatorTransition, lockSecretHash, transferState.Token)
@@ -942,6 +1284,7 @@ func (rs *Service) startMediatedTransferInternal(tokenAddress, target common.Add
 	}
 	rs.Transfer2StateManager[smkey] = stateManager
 	rs.Transfer2Result[smkey] = result
+	rs.recordTransferStage(lockSecretHash, models.TransferStageRouted, fmt.Sprintf("%d routes, first hop %s", len(availableRoutes), availableRoutes[0].HopNode().String()))
 	//rs.dao.AddStateManager(stateManager)
 	rs.StateMachineEventHandler.dispatch(stateManager, initInitiator)
 	return
@@ -951,7 +1294,7 @@ func (rs *Service) startMediatedTransferInternal(tokenAddress, target common.Add
 1. user start a mediated transfer
 2. user start a mediated transfer with secret
 */
-func (rs *Service) startMediatedTransfer(tokenAddress, target common.Address, amount *big.Int, secret common.Hash, data string, routeInfo []pfsproxy.FindPathResponse) (result *utils.AsyncResult) {
+func (rs *Service) startMediatedTransfer(tokenAddress, target common.Address, amount *big.Int, secret common.Hash, data string, payment *PaymentMeta, routeInfo []pfsproxy.FindPathResponse, exclusion *RouteExclusion, constraints *TransferConstraints) (result *utils.AsyncResult) {
 	lockSecretHash := utils.EmptyHash
 	if secret != utils.EmptyHash {
 		lockSecretHash = utils.ShaSecret(secret.Bytes())
@@ -975,14 +1318,22 @@ func (rs *Service) startMediatedTransfer(tokenAddress, target common.Address, am
 		*/
 		// Normal transfer, generate random secret.
 		secret = utils.NewRandomHash()
-		lockSecretHash = utils.ShaSecret(secret[:])
 	}
+	return rs.startMediatedTransferWithSecret(tokenAddress, target, amount, secret, data, payment, routeInfo, exclusion, constraints)
+}
+
+/*
+startMediatedTransferWithSecret 使用`secret`发起交易,不会等待用户允许泄露密码
+*/
+func (rs *Service) startMediatedTransferWithSecret(tokenAddress, target common.Address, amount *big.Int, secret common.Hash, data string, payment *PaymentMeta, routeInfo []pfsproxy.FindPathResponse, exclusion *RouteExclusion, constraints *TransferConstraints) (result *utils.AsyncResult) {
+	lockSecretHash := utils.ShaSecret(secret[:])
 	/*
 		发起方在这里记录发起的交易状态,后续UpdateTransferStatus会更新DB中的值
 	*/
-	rs.dao.NewSentTransferDetail(tokenAddress, target, amount, data, false, lockSecretHash)
+	rs.dao.NewSentTransferDetail(tokenAddress, target, amount, data, false, lockSecretHash, payment.paymentID(), payment.invoice())
 	//rs.dao.NewTransferStatus(tokenAddress, lockSecretHash)
-	result, _ = rs.startMediatedTransferInternal(tokenAddress, target, amount, lockSecretHash, 0, secret, data, routeInfo)
+	rs.newTransferLifecycle(tokenAddress, target, amount, false, lockSecretHash)
+	result, _ = rs.startMediatedTransferInternal(tokenAddress, target, amount, lockSecretHash, 0, secret, data, payment, routeInfo, exclusion, constraints)
 	result.LockSecretHash = lockSecretHash
 	return
 }
@@ -1038,9 +1389,10 @@ func (rs *Service) mediateMediatedTransfer(msg *encoding.MediatedTransfer, ch *c
 				log.Error("receive MediatedTransfer without route info,ignore")
 				return
 			}
-			exclude := graph.MakeExclude(msg.Sender, msg.Initiator)
+			exclude := rs.routingExcludeTo(ch.TokenAddress, msg.Target, msg.Sender, msg.Initiator)
 			g := rs.getToken2ChannelGraph(ch.TokenAddress) //must exist
-			avaiableRoutes = g.GetBestRoutes(rs.Protocol, rs.NodeAddress, msg.Target, amount, msg.PaymentAmount, exclude, rs)
+			targetAmount := new(big.Int).Sub(msg.PaymentAmount, msg.Fee)
+			avaiableRoutes = g.GetBestRoutes(rs.Protocol, rs.NodeAddress, msg.Target, amount, targetAmount, exclude, rs)
 		} else {
 			// 获取下一跳的通道
 			myIndexInPath := -1
@@ -1058,7 +1410,7 @@ func (rs *Service) mediateMediatedTransfer(msg *encoding.MediatedTransfer, ch *c
 			// 构造路由,手续费根据TargetAmount在下家通道中的费率计算
 			availableRoute := route.NewState(nextChan, msg.Path)
 			targetAmount := new(big.Int).Sub(msg.PaymentAmount, msg.Fee)
-			availableRoute.Fee = rs.FeePolicy.GetNodeChargeFee(nextChan.PartnerState.Address, nextChan.TokenAddress, targetAmount)
+			availableRoute.Fee = rs.GetNodeChargeFee(nextChan.PartnerState.Address, nextChan.TokenAddress, targetAmount)
 			avaiableRoutes = append(avaiableRoutes, availableRoute)
 		}
 
@@ -1076,16 +1428,19 @@ func (rs *Service) mediateMediatedTransfer(msg *encoding.MediatedTransfer, ch *c
 		//	//log.Trace(fmt.Sprintf("g=%s", utils.StringInterface(g, 7)))
 		//	avaiableRoutes = g.GetBestRoutes(rs.Protocol, rs.NodeAddress, targetAddr, amount, targetAmount, exclude, rs)
 		//}
+		avaiableRoutes = rs.extensionFilterRoutes(ch.TokenAddress, msg.Target, msg.PaymentAmount, avaiableRoutes)
 		routesState := route.NewRoutesState(avaiableRoutes)
 		blockNumber := rs.GetBlockNumber()
 		initMediator := &mediatedtransfer.ActionInitMediatorStateChange{
-			OurAddress:  rs.NodeAddress,
-			FromTranfer: fromTransfer,
-			Routes:      routesState,
-			FromRoute:   fromRoute,
-			BlockNumber: blockNumber,
-			Message:     msg,
-			Db:          rs.dao,
+			OurAddress:         rs.NodeAddress,
+			FromTranfer:        fromTransfer,
+			Routes:             routesState,
+			FromRoute:          fromRoute,
+			BlockNumber:        blockNumber,
+			Message:            msg,
+			Db:                 rs.dao,
+			MaxChannelLocks:    rs.Config.MaxMediatedChannelLocks,
+			InitiatorOverLimit: rs.isMediatedInitiatorOverLimit(msg.Initiator),
 		}
 		stateManager = transfer.NewStateManager(mediator.StateTransition, nil, mediator.NameMediatorTransition, fromTransfer.LockSecretHash, fromTransfer.Token)
 		//rs.dao.AddStateManager(stateManager)
@@ -1132,17 +1487,21 @@ func (rs *Service) targetMediatedTransfer(msg *encoding.MediatedTransfer, ch *ch
 	fromRoute := graph.Channel2RouteState(fromChannel, msg.Sender, msg.PaymentAmount, rs, msg.Path)
 	fromTransfer := mediatedtransfer.LockedTransferFromMessage(msg, ch.TokenAddress)
 	initTarget := &mediatedtransfer.ActionInitTargetStateChange{
-		OurAddress:  rs.NodeAddress,
-		FromRoute:   fromRoute,
-		FromTranfer: fromTransfer,
-		BlockNumber: rs.GetBlockNumber(),
-		Message:     msg,
-		Db:          rs.dao,
+		OurAddress:   rs.NodeAddress,
+		FromRoute:    fromRoute,
+		FromTranfer:  fromTransfer,
+		BlockNumber:  rs.GetBlockNumber(),
+		Message:      msg,
+		Db:           rs.dao,
+		NeedApproval: rs.needTransferApproval(),
 	}
 	stateManager = transfer.NewStateManager(target.StateTransiton, nil, target.NameTargetTransition, fromTransfer.LockSecretHash, fromTransfer.Token)
 	//rs.dao.AddStateManager(stateManager)
 	rs.Transfer2StateManager[smkey] = stateManager
 	rs.StateMachineEventHandler.dispatch(stateManager, initTarget)
+	if initTarget.NeedApproval {
+		rs.waitTransferApproval(stateManager, ch)
+	}
 	// notify upper
 	rs.NotifyHandler.NotifyReceiveMediatedTransfer(msg, ch.TokenAddress)
 }
@@ -1183,6 +1542,8 @@ func (rs *Service) startSubscribeNeighborStatus() error {
 		err = t.SubscribeNeighbor(rs.dao)
 	case *network.MatrixMixTransport:
 		err = t.SetMatrixDB(rs.dao)
+	case *network.PriorityTransport:
+		err = t.SubscribeNeighbor(rs.dao)
 	default:
 		return rerr.ErrTransportTypeUnknown
 	}
@@ -1241,6 +1602,9 @@ func (rs *Service) getChannel(tokenAddr, partnerAddr common.Address) *channel.Ch
 Process user's new channel request
 */
 func (rs *Service) newChannelAndDeposit(token, partner common.Address, settleTimeout int, amount *big.Int, isNewChannel bool) *utils.AsyncResult {
+	if !rs.dao.GetPartnerFilter().IsAllowed(partner) {
+		return utils.NewAsyncResultWithError(rerr.ErrPartnerNotAllowed.Printf("partner %s is blacklisted or not whitelisted", partner.String()))
+	}
 	if isNewChannel {
 		g := rs.Token2ChannelGraph[token]
 		if g != nil {
@@ -1460,7 +1824,7 @@ func (rs *Service) tokenSwapMaker(tokenswap *TokenSwap) (result *utils.AsyncResu
 	}
 	rs.SentMediatedTransferListenerMap[&sentMtrHook] = true
 	rs.ReceivedMediatedTrasnferListenerMap[&receiveMtrHook] = true
-	result, _ = rs.startMediatedTransferInternal(tokenswap.FromToken, tokenswap.ToNodeAddress, tokenswap.FromAmount, tokenswap.LockSecretHash, 0, tokenswap.Secret, "", tokenswap.RouteInfo)
+	result, _ = rs.startMediatedTransferInternal(tokenswap.FromToken, tokenswap.ToNodeAddress, tokenswap.FromAmount, tokenswap.LockSecretHash, 0, tokenswap.Secret, "", nil, tokenswap.RouteInfo, nil, nil)
 	return
 }
 
@@ -1514,13 +1878,14 @@ func (rs *Service) messageTokenSwapTaker(msg *encoding.MediatedTransfer, tokensw
 		taker and maker may have direct channels on these two tokens.
 	*/
 	takerExpiration := msg.Expiration - int64(rs.Config.RevealTimeout)
-	result, stateManager := rs.startMediatedTransferInternal(tokenswap.ToToken, tokenswap.FromNodeAddress, tokenswap.ToAmount, tokenswap.LockSecretHash, takerExpiration, utils.EmptyHash, "", tokenswap.RouteInfo)
+	result, stateManager := rs.startMediatedTransferInternal(tokenswap.ToToken, tokenswap.FromNodeAddress, tokenswap.ToAmount, tokenswap.LockSecretHash, takerExpiration, utils.EmptyHash, "", nil, tokenswap.RouteInfo, nil, nil)
 	if stateManager == nil {
 		log.Error(fmt.Sprintf("taker tokenwap error %s", <-result.Result))
 		return false
 	}
 	rs.SecretRequestPredictorMap[hashlock] = secretRequestHook
 	rs.RevealSecretListenerMap[hashlock] = receiveRevealSecretHook
+	rs.watchSwapOrder(hashlock, result)
 	return true
 }
 
@@ -1546,6 +1911,10 @@ only initiator can call
 */
 func (rs *Service) cancelTransfer(req *cancelTransferReq) (result *utils.AsyncResult) {
 	result = utils.NewAsyncResult()
+	if rs.cancelQueuedTransfer(req.TokenAddress, req.LockSecretHash) {
+		result.Result <- nil
+		return
+	}
 	// get transfer info and check
 	smKey := utils.Sha3(req.LockSecretHash[:], req.TokenAddress[:])
 	manager := rs.Transfer2StateManager[smKey]
@@ -1571,8 +1940,9 @@ func (rs *Service) cancelTransfer(req *cancelTransferReq) (result *utils.AsyncRe
 	}
 	rs.StateMachineEventHandler.dispatch(manager, stateChange)
 	std := rs.dao.UpdateSentTransferDetailStatus(req.TokenAddress, req.LockSecretHash, models.TransferStatusCanceled, "transfer cancel", nil)
+	rs.recordTransferStage(req.LockSecretHash, models.TransferStageCanceled, "canceled by user")
 	//rs.NotifyTransferStatusChange(req.TokenAddress, req.LockSecretHash, models.TransferStatusCanceled, "交易撤销")
-	rs.NotifyHandler.NotifySentTransferDetail(std)
+	rs.notifySentTransferDetail(std)
 	result.Result <- nil
 	return
 }
@@ -1597,8 +1967,9 @@ func (rs *Service) handleSentMessage(sentMessage *protocolMessage) {
 			r.Result <- nil
 		}
 		std := rs.dao.UpdateSentTransferDetailStatus(ch.TokenAddress, msg.FakeLockSecretHash, models.TransferStatusSuccess, "DirectTransfer send success,transfer success", ch.ChannelIdentifier)
+		rs.recordTransferStage(msg.FakeLockSecretHash, models.TransferStageUnlockReceived, fmt.Sprintf("DirectTransfer acked by %s", sentMessage.receiver.String()))
 		//rs.NotifyTransferStatusChange(ch.TokenAddress, msg.FakeLockSecretHash, models.TransferStatusSuccess, "DirectTransfer 发送成功,交易成功")
-		rs.NotifyHandler.NotifySentTransferDetail(std)
+		rs.notifySentTransferDetail(std)
 	case *encoding.MediatedTransfer:
 		ch, err := rs.findChannelByIdentifier(msg.ChannelIdentifier)
 		if err != nil {
@@ -1606,12 +1977,14 @@ func (rs *Service) handleSentMessage(sentMessage *protocolMessage) {
 			return
 		}
 		rs.dao.UpdateSentTransferDetailStatusMessage(ch.TokenAddress, msg.LockSecretHash, "MediatedTransfer send success")
+		rs.recordTransferStage(msg.LockSecretHash, models.TransferStageLockSent, fmt.Sprintf("MediatedTransfer acked by %s", sentMessage.receiver.String()))
 	case *encoding.RevealSecret:
 		// save log to dao
 		channels := rs.findAllChannelsByLockSecretHash(msg.LockSecretHash())
 		for _, c := range channels {
 			rs.dao.UpdateSentTransferDetailStatusMessage(c.TokenAddress, msg.LockSecretHash(), "RevealSecret send success")
 		}
+		rs.recordTransferStage(msg.LockSecretHash(), models.TransferStageSecretRevealed, fmt.Sprintf("RevealSecret acked by %s", sentMessage.receiver.String()))
 	case *encoding.UnLock:
 		ch, err := rs.findChannelByIdentifier(msg.ChannelIdentifier)
 		if err != nil {
@@ -1619,8 +1992,9 @@ func (rs *Service) handleSentMessage(sentMessage *protocolMessage) {
 			return
 		}
 		std := rs.dao.UpdateSentTransferDetailStatus(ch.TokenAddress, msg.LockSecretHash(), models.TransferStatusSuccess, "UnLock send success,transfer success", ch.ChannelIdentifier)
+		rs.recordTransferStage(msg.LockSecretHash(), models.TransferStageUnlockReceived, fmt.Sprintf("UnLock acked by %s", sentMessage.receiver.String()))
 		//rs.NotifyTransferStatusChange(ch.TokenAddress, msg.LockSecretHash(), models.TransferStatusSuccess, "UnLock 发送成功,交易成功.")
-		rs.NotifyHandler.NotifySentTransferDetail(std)
+		rs.notifySentTransferDetail(std)
 	case *encoding.AnnounceDisposedResponse:
 		ch, err := rs.findChannelByIdentifier(msg.ChannelIdentifier)
 		if err != nil {
@@ -1634,9 +2008,32 @@ func (rs *Service) handleSentMessage(sentMessage *protocolMessage) {
 }
 
 /*
-GetNodeChargeFee implement of FeeCharger
+handleDeliveredMessage 交易消息已经送达对方,还在等待对方处理,只记录到交易状态中
+*/
+func (rs *Service) handleDeliveredMessage(d *network.DeliveredMessage) {
+	switch msg := d.Msg.(type) {
+	case *encoding.DirectTransfer:
+		ch, err := rs.findChannelByIdentifier(msg.ChannelIdentifier)
+		if err != nil {
+			return
+		}
+		rs.dao.UpdateSentTransferDetailStatusMessage(ch.TokenAddress, msg.FakeLockSecretHash, fmt.Sprintf("DirectTransfer delivered to %s", d.Receiver.String()))
+	case *encoding.MediatedTransfer:
+		ch, err := rs.findChannelByIdentifier(msg.ChannelIdentifier)
+		if err != nil {
+			return
+		}
+		rs.dao.UpdateSentTransferDetailStatusMessage(ch.TokenAddress, msg.LockSecretHash, fmt.Sprintf("MediatedTransfer delivered to %s", d.Receiver.String()))
+	}
+}
+
+/*
+GetNodeChargeFee implement of FeeCharger,优先使用extension给出的手续费
 */
 func (rs *Service) GetNodeChargeFee(nodeAddress, tokenAddress common.Address, amount *big.Int) *big.Int {
+	if fee := rs.extensionChargeFee(nodeAddress, tokenAddress, amount); fee != nil {
+		return fee
+	}
 	return rs.FeePolicy.GetNodeChargeFee(nodeAddress, tokenAddress, amount)
 }
 
@@ -1657,6 +2054,42 @@ func (rs *Service) conditionQuit(eventName string) {
 	}
 }
 
+// QueueDepth 队列当前积压的数量和容量
+type QueueDepth struct {
+	Depth    int `json:"depth"`
+	Capacity int `json:"capacity"`
+}
+
+// QueueStatus API和状态机之间各个队列的积压情况
+type QueueStatus struct {
+	UserReq                 QueueDepth `json:"user_req"`
+	StateChange             QueueDepth `json:"state_change"`
+	ProtocolMessageComplete QueueDepth `json:"protocol_message_complete"`
+	SubmitBalanceProofToPFS QueueDepth `json:"submit_balance_proof_to_pfs"`
+}
+
+/*
+GetQueueStatus return depth of queues between api and state machines
+*/
+func (rs *Service) GetQueueStatus() *QueueStatus {
+	qs := &QueueStatus{
+		UserReq:                 QueueDepth{len(rs.UserReqChan), cap(rs.UserReqChan)},
+		ProtocolMessageComplete: QueueDepth{len(rs.ProtocolMessageSendComplete), cap(rs.ProtocolMessageSendComplete)},
+		SubmitBalanceProofToPFS: QueueDepth{len(rs.ChanSubmitBalanceProofToPFS), cap(rs.ChanSubmitBalanceProofToPFS)},
+	}
+	if rs.BlockChainEvents != nil {
+		qs.StateChange = QueueDepth{len(rs.BlockChainEvents.StateChangeChannel), cap(rs.BlockChainEvents.StateChangeChannel)}
+	}
+	return qs
+}
+
+/*
+isBusy 队列积压超过阈值时,新的交易请求大概率会超时,应该直接拒绝
+*/
+func (rs *Service) isBusy(qs *QueueStatus) bool {
+	return qs.UserReq.Depth >= params.MaxUserReqQueueDepth || qs.StateChange.Depth >= params.MaxStateChangeQueueDepth
+}
+
 /*
 GetDao return photon's dao
 */
@@ -1672,6 +2105,9 @@ func (rs *Service) handleEthRPCConnectionOK() {
 		events before lastHandledBlockNumber must have been processed, so we start from  lastHandledBlockNumber-1
 	*/
 	rs.BlockChainEvents.Start(rs.dao.GetLatestBlockNumber())
+	if rs.mempoolWatcher != nil {
+		rs.mempoolWatcher.Start()
+	}
 	//启动的时候如果公链 rpc连接有问题,一旦链上,就应该重新初始化 registry, 否则无法进行注册 token 等操作
 	// If rpc connection fails in public chain, once reconnecting, we should reinitialize registry,
 	// otherwise we can do things like token registry.
@@ -1704,11 +2140,7 @@ func (rs *Service) handleReq(req *apiReq) {
 	switch req.Name {
 	case transferReqName: //mediated transfer only
 		r := req.Req.(*transferReq)
-		if r.IsDirectTransfer {
-			result = rs.directTransferAsync(r.TokenAddress, r.Target, r.Amount, r.Data)
-		} else {
-			result = rs.startMediatedTransfer(r.TokenAddress, r.Target, r.Amount, r.Secret, r.Data, r.RouteInfo)
-		}
+		result = rs.submitIdempotentTransfer(r)
 	case newChannelReqName:
 		r := req.Req.(*newChannelReq)
 		if r.amount != nil && r.amount.Cmp(utils.BigInt0) > 0 {
@@ -1764,6 +2196,52 @@ func (rs *Service) handleReq(req *apiReq) {
 	case forceUnlockReqName:
 		r := req.Req.(*forceUnlockReq)
 		result = rs.forceUnlock(r)
+	case queryNodeAdvertisementReqName:
+		r := req.Req.(*queryNodeAdvertisementReq)
+		result = rs.queryNodeAdvertisement(r)
+	case inboundCapacityReqName:
+		r := req.Req.(*inboundCapacityReq)
+		result = rs.requestInboundCapacity(r)
+	case respondInboundCapacityReqName:
+		r := req.Req.(*respondInboundCapacityReq)
+		result = rs.respondInboundCapacity(r)
+	case initiateSwapReqName:
+		r := req.Req.(*initiateSwapReq)
+		result = rs.initiateSwap(r)
+	case respondSwapReqName:
+		r := req.Req.(*respondSwapReq)
+		result = rs.respondSwap(r)
+	case registerTokenReqName:
+		r := req.Req.(*registerTokenReq)
+		result = rs.registerToken(r)
+	case estimateTransferReqName:
+		r := req.Req.(*estimateTransferReq)
+		result = rs.estimateTransfer(r)
+	case offlineTxBundleReqName:
+		r := req.Req.(*offlineTxBundleReq)
+		result = rs.offlineDisputeSnapshot(r)
+	case transferFinishedReqName:
+		r := req.Req.(*transferFinishedReq)
+		result = rs.transferFinished(r)
+	case splitTransferReqName:
+		r := req.Req.(*splitTransferReq)
+		result = rs.startSplitTransfer(r)
+	case splitTransferFinishedReqName:
+		r := req.Req.(*splitTransferFinishedReq)
+		result = rs.splitTransferFinished(r)
+	case pendingApprovalsReqName:
+		result = rs.getPendingApprovals()
+	case approveTransferReqName:
+		r := req.Req.(*approveTransferReq)
+		result = rs.approveTransfer(r)
+	case checkRouteReqName:
+		r := req.Req.(*checkRouteReq)
+		result = rs.checkRoute(r)
+	case exportChannelStateReqName:
+		result = rs.exportChannelState()
+	case importChannelStateReqName:
+		r := req.Req.(*importChannelStateReq)
+		result = rs.importChannelState(r)
 	default:
 		panic("unkown req")
 	}
@@ -1771,6 +2249,43 @@ func (rs *Service) handleReq(req *apiReq) {
 	r.result <- result
 }
 
+type nodeAdvertisementQuery struct {
+	target    common.Address
+	result    *utils.AsyncResult
+	startTime time.Time
+}
+
+/*
+queryNodeAdvertisement 向`target`查询其公开信息,收到NodeAdvertisementResponse之后通过result.Tag返回
+*/
+func (rs *Service) queryNodeAdvertisement(r *queryNodeAdvertisementReq) (result *utils.AsyncResult) {
+	result = utils.NewAsyncResult()
+	//对方一直不响应的查询,调用者早已超时返回,这里顺便清理掉
+	for nonce, q := range rs.NodeAdvertisementQueryMap {
+		if time.Since(q.startTime) > params.MaxRequestTimeout {
+			delete(rs.NodeAdvertisementQueryMap, nonce)
+		}
+	}
+	nonce := time.Now().UnixNano()
+	msg := encoding.NewNodeAdvertisementRequest(nonce)
+	err := msg.Sign(rs.PrivateKey, msg)
+	if err != nil {
+		result.Result <- err
+		return
+	}
+	rs.NodeAdvertisementQueryMap[nonce] = &nodeAdvertisementQuery{
+		target:    r.target,
+		result:    result,
+		startTime: time.Now(),
+	}
+	err = rs.sendAsync(r.target, msg)
+	if err != nil {
+		delete(rs.NodeAdvertisementQueryMap, nonce)
+		result.Result <- err
+	}
+	return
+}
+
 /*
 这一系列update通知没有走callback,而是专门开辟一条道路主要是考虑到这些通知并不是来自用户的请求,
 而是
@@ -1946,12 +2461,16 @@ func (rs *Service) getBestRoutesFromPfs(peerFrom, peerTo, token common.Address,
 			continue
 		}
 		partnerAddress := common.HexToAddress(path.Result[0])
+		if rs.peerStats.isGreylisted(partnerAddress) {
+			log.Info(fmt.Sprintf("ignore route through greylisted node %s", utils.APex2(partnerAddress)))
+			continue
+		}
 		ch := rs.getChannel(token, partnerAddress)
 		if ch == nil {
 			continue
 		}
 		r := route.NewState(ch, path.GetPath())
-		r.Fee = rs.FeePolicy.GetNodeChargeFee(partnerAddress, token, amount)
+		r.Fee = rs.GetNodeChargeFee(partnerAddress, token, amount)
 		r.TotalFee = path.Fee
 		routes = append(routes, r)
 	}
@@ -2003,19 +2522,9 @@ func (rs *Service) forceUnlock(req *forceUnlockReq) (result *utils.AsyncResult)
 				return
 			}
 		}
-		retry := 0
-		for {
-			channel := rs.getChannelWithAddr(channelIdentifier)
-			if channel.State != channeltype.StateClosed {
-				time.Sleep(time.Second)
-				retry++
-				if retry > 10 {
-					break
-				}
-				continue
-			}
-			break
-		}
+		rs.waitBlocksUntil(params.ForceUnlockWaitBlocks, func() bool {
+			return rs.getChannelWithAddr(channelIdentifier).State == channeltype.StateClosed
+		})
 		if !isSecretRegistered {
 			// register
 			err = rs.Chain.SecretRegistryProxy.RegisterSecret(secret)
@@ -2023,23 +2532,14 @@ func (rs *Service) forceUnlock(req *forceUnlockReq) (result *utils.AsyncResult)
 				result.Result <- rerr.ErrRegisterSecret.Errorf("ForceUnlock : register secret fail %s", err.Error())
 				return
 			}
-			retry = 0
-			for {
+			rs.waitBlocksUntil(params.ForceUnlockWaitBlocks, func() bool {
 				isSecretRegistered, err = rs.Chain.SecretRegistryProxy.IsSecretRegistered(secret)
-				if err != nil {
-					result.Result <- rerr.ErrRegisterSecret.Errorf("ForceUnlock : register secret fail %s", err.Error())
-					return
-				}
-				if isSecretRegistered {
-					break
-				}
-				retry++
-				if retry > 10 {
-					break
-				}
-				time.Sleep(time.Second)
+				return err != nil || isSecretRegistered
+			})
+			if err != nil {
+				result.Result <- rerr.ErrRegisterSecret.Errorf("ForceUnlock : register secret fail %s", err.Error())
+				return
 			}
-
 		}
 		// unlock
 		log.Trace(fmt.Sprintf("forceUnlock unlock : partnerAddress=%s, transferAmount=%d, expiration=%d, amount=%d,lockSecretHash=%s,proof=%s lockHash=%s \n",
@@ -2057,6 +2557,36 @@ func (rs *Service) forceUnlock(req *forceUnlockReq) (result *utils.AsyncResult)
 	return
 }
 
+/*
+waitBlocksUntil 每收到一个新块检查一次cond,最多等待`blocks`个块,返回cond是否满足.
+按块计算而不是按时间,出块慢或者本机时钟不准时都不会提前放弃,不能在主线程中调用
+*/
+func (rs *Service) waitBlocksUntil(blocks int64, cond func() bool) bool {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-rs.quitChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	number := rs.GetBlockNumber()
+	end := number + blocks
+	for {
+		if cond() {
+			return true
+		}
+		if number >= end {
+			return false
+		}
+		number++
+		if rs.BlockChainEvents.WaitForBlock(ctx, number) != nil {
+			return false
+		}
+	}
+}
+
 func (rs *Service) getUnfinishedReceivedTransfer(req *getUnfinishedReceivedTransferReq) (result *utils.AsyncResult) {
 	lockSecretHash := req.LockSecretHash
 	tokenAddress := req.TokenAddress
@@ -18,17 +18,21 @@ import (
 	"crypto/ecdsa"
 
 	"sort"
+	"sync"
 
 	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
 	"github.com/SmartMeshFoundation/Photon/log"
 	"github.com/SmartMeshFoundation/Photon/models"
 	"github.com/SmartMeshFoundation/Photon/network"
 	"github.com/SmartMeshFoundation/Photon/network/netshare"
+	"github.com/SmartMeshFoundation/Photon/network/rpc"
+	"github.com/SmartMeshFoundation/Photon/notify"
 	"github.com/SmartMeshFoundation/Photon/pfsproxy"
 	"github.com/SmartMeshFoundation/Photon/rerr"
 	"github.com/SmartMeshFoundation/Photon/transfer"
 	"github.com/SmartMeshFoundation/Photon/utils"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 )
 
 //API photon for user
@@ -78,6 +82,11 @@ func (r *API) GetChannelList(tokenAddress common.Address, partnerAddress common.
 	return r.Photon.dao.GetChannelList(tokenAddress, partnerAddress)
 }
 
+//GetSettleCountdown 已关闭通道的结算倒计时,其他状态的通道返回nil
+func (r *API) GetSettleCountdown(c *channeltype.Serialization) *channeltype.SettleCountdown {
+	return r.Photon.getSettleCountdown(c)
+}
+
 //GetChannel get channel by address
 func (r *API) GetChannel(ChannelIdentifier common.Hash) (c *channeltype.Serialization, err error) {
 	return r.Photon.dao.GetChannelByAddress(ChannelIdentifier)
@@ -99,8 +108,7 @@ func (r *API) DepositAndOpenChannel(tokenAddress, partnerAddress common.Address,
 		if settleTimeout <= 0 {
 			settleTimeout = r.Photon.Config.SettleTimeout
 		}
-		if settleTimeout <= revealTimeout {
-			err = rerr.ErrChannelInvalidSttleTimeout
+		if err = checkSettleTimeout(settleTimeout, revealTimeout); err != nil {
 			return
 		}
 	} else {
@@ -136,11 +144,50 @@ func (r *API) DepositAndOpenChannel(tokenAddress, partnerAddress common.Address,
 			return
 		}
 	}
+	if err = checkDepositLimit(ch, deposit); err != nil {
+		return
+	}
 	result := r.Photon.depositAndOpenChannelClient(tokenAddress, partnerAddress, settleTimeout, deposit, newChannel)
 	err = <-result.Result
 	return
 }
 
+/*
+DepositDryRun simulates DepositAndOpenChannel on chain without sending any transaction,
+it returns whether the deposit would succeed and the amount credited to the channel.
+*/
+func (r *API) DepositDryRun(tokenAddress, partnerAddress common.Address, settleTimeout int, deposit *big.Int, newChannel bool) (result *rpc.DepositDryRunResult, err error) {
+	if newChannel {
+		if settleTimeout <= 0 {
+			settleTimeout = r.Photon.Config.SettleTimeout
+		}
+		if err = checkSettleTimeout(settleTimeout, r.Photon.Config.RevealTimeout); err != nil {
+			return
+		}
+	} else {
+		settleTimeout = 0
+	}
+	if deposit.Cmp(utils.BigInt0) <= 0 {
+		err = rerr.ErrInvalidAmount
+		return
+	}
+	if err = r.checkSmcStatus(); err != nil {
+		return
+	}
+	var ch *channeltype.Serialization
+	if !newChannel {
+		ch, _ = r.Photon.dao.GetChannel(tokenAddress, partnerAddress)
+	}
+	if err = checkDepositLimit(ch, deposit); err != nil {
+		return
+	}
+	tokenNetwork, err := r.Photon.Chain.TokenNetwork(tokenAddress)
+	if err != nil {
+		return
+	}
+	return tokenNetwork.DepositDryRun(r.Photon.NodeAddress, partnerAddress, settleTimeout, deposit)
+}
+
 /*
 TokenSwapAndWait Start an atomic swap operation by sending a MediatedTransfer with
     `maker_amount` of `maker_token` to `taker_address`. Only proceed when a
@@ -182,6 +229,9 @@ func (r *API) tokenSwapAsync(lockSecretHash string, makerToken, takerToken, make
 		ToNodeAddress:   takerAddress,
 		RouteInfo:       routeInfo,
 	}
+	if err = r.checkQueueStatus(); err != nil {
+		return
+	}
 	result = r.Photon.tokenSwapMakerClient(tokenSwap)
 	return
 }
@@ -230,6 +280,141 @@ func (r *API) StartHealthCheckFor(nodeAddress common.Address) (deviceType string
 	return r.GetNodeNetworkState(nodeAddress)
 }
 
+// LayerDiagnostics result of reachability check on one layer
+type LayerDiagnostics struct {
+	OK      bool   `json:"ok"`
+	Detail  string `json:"detail,omitempty"`
+	Latency int64  `json:"latency_ms,omitempty"`
+}
+
+// ChannelDiagnostics can we send or receive a transfer through this channel right now
+type ChannelDiagnostics struct {
+	ChannelIdentifier string            `json:"channel_identifier"`
+	TokenAddress      string            `json:"token_address"`
+	State             channeltype.State `json:"state"`
+	StateString       string            `json:"state_string"`
+	CanSend           bool              `json:"can_send"`
+	CanReceive        bool              `json:"can_receive"`
+	Probe             *LayerDiagnostics `json:"probe,omitempty"` //零金额探测,只有打开的通道才探测
+}
+
+// PeerDiagnostics full stack reachability report of a node
+type PeerDiagnostics struct {
+	NodeAddress string                `json:"node_address"`
+	DeviceType  string                `json:"device_type"`
+	Presence    *LayerDiagnostics     `json:"presence"`
+	Transport   *LayerDiagnostics     `json:"transport"`
+	Protocol    *LayerDiagnostics     `json:"protocol"`
+	Channels    []*ChannelDiagnostics `json:"channels"`
+}
+
+/*
+Ping check the reachability of `nodeAddress` layer by layer,
+1. presence, is the node online from the view of transport
+2. transport, can we hand a ping to transport
+3. protocol, does the node ack the same ping within `timeout`
+4. channels, a zero value ChannelProbe through every opened channel, the partner acks it only when it agrees on the channel state
+so when transfers to a node always fail, we can know where the problem is.
+only one ping is sent, transport and protocol both report that exchange.
+*/
+func (r *API) Ping(nodeAddress common.Address, timeout time.Duration) (result *PeerDiagnostics, err error) {
+	if nodeAddress == r.Photon.NodeAddress {
+		err = rerr.ErrArgumentError.Append("cannot ping myself")
+		return
+	}
+	result = &PeerDiagnostics{
+		NodeAddress: nodeAddress.String(),
+		Presence:    &LayerDiagnostics{},
+		Transport:   &LayerDiagnostics{},
+		Protocol:    &LayerDiagnostics{},
+	}
+	var isOnline bool
+	result.DeviceType, isOnline = r.Photon.Protocol.GetNetworkStatus(nodeAddress)
+	result.Presence.OK = isOnline
+	if !isOnline {
+		result.Presence.Detail = "node is offline"
+	}
+	rtt, sent, err := r.Photon.Protocol.PingAndWait(nodeAddress, timeout)
+	result.Transport.OK = sent
+	if !sent {
+		result.Transport.Detail = err.Error()
+		result.Protocol.Detail = "ping not sent"
+	} else if err != nil {
+		result.Protocol.Detail = err.Error()
+	} else {
+		result.Protocol.OK = true
+		result.Protocol.Latency = int64(rtt / time.Millisecond)
+	}
+	cs, err := r.GetChannelList(utils.EmptyAddress, nodeAddress)
+	if err != nil {
+		return
+	}
+	wg := sync.WaitGroup{}
+	for _, c := range cs {
+		opened := c.State == channeltype.StateOpened
+		cd := &ChannelDiagnostics{
+			ChannelIdentifier: c.ChannelIdentifier.ChannelIdentifier.String(),
+			TokenAddress:      c.TokenAddress().String(),
+			State:             c.State,
+			StateString:       c.State.String(),
+			CanSend:           opened && c.OurBalance().Cmp(utils.BigInt0) > 0,
+			CanReceive:        opened && c.PartnerBalance().Cmp(utils.BigInt0) > 0,
+		}
+		result.Channels = append(result.Channels, cd)
+		if !opened || !sent {
+			continue
+		}
+		wg.Add(1)
+		go func(c *channeltype.Serialization) {
+			defer wg.Done()
+			cd.Probe = r.probeChannel(nodeAddress, c, timeout)
+		}(c)
+	}
+	wg.Wait()
+	return
+}
+
+/*
+GetPeerStatistics returns protocol violations of every peer since startup.
+peers which reach params.PeerMisbehaviorGreylistThreshold are greylisted, photon will not route through them.
+*/
+func (r *API) GetPeerStatistics() *PeerStatistics {
+	return &PeerStatistics{
+		UnparseableMessage: r.Photon.Protocol.InvalidMessageCount(),
+		Peers:              r.Photon.peerStats.snapshot(),
+	}
+}
+
+/*
+GetPeersPresence returns the reachability of every node we have talked to since startup.
+unreachable nodes are avoided as mediators by the router.
+*/
+func (r *API) GetPeersPresence() []*network.PeerPresence {
+	return r.Photon.Protocol.PeersPresence()
+}
+
+//GetPeerPresence returns the reachability of `nodeAddress`
+func (r *API) GetPeerPresence(nodeAddress common.Address) (*network.PeerPresence, error) {
+	pp := r.Photon.Protocol.PeerPresence(nodeAddress)
+	if pp == nil {
+		return nil, rerr.ErrNotFound.Printf("never talked to %s", nodeAddress.String())
+	}
+	return pp, nil
+}
+
+/*
+GetRateLimitStats returns accepted and dropped messages of every node which has sent us messages since startup.
+address 0x0 counts all the unsigned messages such as Ack.
+*/
+func (r *API) GetRateLimitStats() []*network.PeerRateLimit {
+	return r.Photon.Protocol.RateLimitStats()
+}
+
+//GetBlockCallbackStats returns latency statistics of every block callback
+func (r *API) GetBlockCallbackStats() []*BlockCallbackStats {
+	return r.Photon.blockCallbacks.snapshot()
+}
+
 //GetTokenList returns all available tokens
 func (r *API) GetTokenList() (tokens []common.Address) {
 	tokensmap, err := r.Photon.dao.GetAllTokens()
@@ -254,9 +439,9 @@ func (r *API) GetTokenTokenNetorks() (tokens []string) {
 	return
 }
 
-//Transfer transfer and wait
-func (r *API) Transfer(token common.Address, amount *big.Int, target common.Address, secret common.Hash, timeout time.Duration, isDirectTransfer bool, data string, routeInfo []pfsproxy.FindPathResponse) (result *utils.AsyncResult, err error) {
-	result, err = r.TransferInternal(token, amount, target, secret, isDirectTransfer, data, routeInfo)
+//Transfer transfer and wait, opts may be nil
+func (r *API) Transfer(token common.Address, amount *big.Int, target common.Address, secret common.Hash, timeout time.Duration, isDirectTransfer bool, data string, routeInfo []pfsproxy.FindPathResponse, opts *TransferOptions) (result *utils.AsyncResult, err error) {
+	result, err = r.TransferInternal(token, amount, target, secret, isDirectTransfer, data, routeInfo, opts)
 	if err != nil {
 		return
 	}
@@ -273,9 +458,9 @@ func (r *API) Transfer(token common.Address, amount *big.Int, target common.Addr
 	return result, err
 }
 
-// TransferAsync :
-func (r *API) TransferAsync(tokenAddress common.Address, amount *big.Int, target common.Address, secret common.Hash, isDirectTransfer bool, data string, routeInfo []pfsproxy.FindPathResponse) (result *utils.AsyncResult, err error) {
-	result, err = r.TransferInternal(tokenAddress, amount, target, secret, isDirectTransfer, data, routeInfo)
+// TransferAsync : opts may be nil
+func (r *API) TransferAsync(tokenAddress common.Address, amount *big.Int, target common.Address, secret common.Hash, isDirectTransfer bool, data string, routeInfo []pfsproxy.FindPathResponse, opts *TransferOptions) (result *utils.AsyncResult, err error) {
+	result, err = r.TransferInternal(tokenAddress, amount, target, secret, isDirectTransfer, data, routeInfo, opts)
 	if err != nil {
 		return
 	}
@@ -288,14 +473,152 @@ func (r *API) TransferAsync(tokenAddress common.Address, amount *big.Int, target
 	return result, err
 }
 
+/*
+TransferWithRoute 沿着指定的路由发起交易,不使用本地路由或者pfs,这条路由失败时交易失败,不会尝试其他路由.
+`explicitRoute`从第一个中转节点开始,到`target`结束,和target直接有通道时只包含`target`.
+发起之前检查每一跳都有打开的通道,我和第一跳的通道必须能够支付`amount`加上估算的手续费,
+其他通道只有在通道伙伴转告过容量时才能检查余额
+*/
+func (r *API) TransferWithRoute(tokenAddress common.Address, amount *big.Int, target common.Address, explicitRoute []common.Address) (result *utils.AsyncResult, err error) {
+	if amount == nil || amount.Sign() <= 0 {
+		err = rerr.ErrInvalidAmount
+		return
+	}
+	check := r.Photon.checkRouteClient(tokenAddress, amount, target, explicitRoute)
+	err = <-check.Result
+	if err != nil {
+		return
+	}
+	route := check.Tag.(*pfsproxy.FindPathResponse)
+	return r.TransferAsync(tokenAddress, amount, target, utils.EmptyHash, false, "", []pfsproxy.FindPathResponse{*route}, nil)
+}
+
+/*
+TransferOperation 发起交易并登记为长时间操作,不必等待交易完成,调用者通过返回的操作ID查询进度或者撤销交易.
+和TransferAsync一样,300毫秒内就失败的交易直接返回错误
+*/
+func (r *API) TransferOperation(tokenAddress common.Address, amount *big.Int, target common.Address, secret common.Hash, isDirectTransfer bool, data string, routeInfo []pfsproxy.FindPathResponse, opts *TransferOptions) (result *utils.AsyncResult, err error) {
+	result, err = r.TransferInternal(tokenAddress, amount, target, secret, isDirectTransfer, data, routeInfo, opts)
+	if err != nil {
+		return
+	}
+	lockSecretHash := result.LockSecretHash
+	result.SetCancel(func() error {
+		return r.CancelTransfer(lockSecretHash, tokenAddress)
+	})
+	_, err = r.Photon.operations.start("transfer", result, params.MaxRequestTimeout)
+	if err != nil {
+		return
+	}
+	_, err = r.Photon.operations.wait(result.ID, 300*time.Millisecond)
+	return
+}
+
+// GetRouteStatistics 查询经过每个下一跳发出的交易的成功和失败次数
+func (r *API) GetRouteStatistics() []*RouteStat {
+	return r.Photon.routeStats.snapshot()
+}
+
+// ResetRouteStatistics 清除路由统计,被排除的下一跳重新参与路由,token或者hop为空时表示所有的token或者下一跳
+func (r *API) ResetRouteStatistics(token, hop common.Address) {
+	r.Photon.routeStats.reset(token, hop)
+}
+
+// GetCircuitBreakers 查询每个token的熔断状态和最近的异常次数
+func (r *API) GetCircuitBreakers() []*CircuitBreakerStatus {
+	return r.Photon.circuitBreakers.snapshot(time.Now())
+}
+
+// ResetCircuitBreaker 运营方确认安全以后恢复`tokenAddress`的新交易
+func (r *API) ResetCircuitBreaker(tokenAddress common.Address) error {
+	err := r.Photon.circuitBreakers.reset(tokenAddress)
+	if err == nil {
+		log.Info(fmt.Sprintf("circuit breaker of token %s is reset", utils.APex2(tokenAddress)))
+	}
+	return err
+}
+
+// GetOperation 查询长时间操作的进度和结果
+func (r *API) GetOperation(id string) (*models.Operation, error) {
+	return r.Photon.operations.get(id)
+}
+
+// CancelOperation 撤销一个还没有完成的长时间操作
+func (r *API) CancelOperation(id string) error {
+	return r.Photon.operations.cancel(id)
+}
+
+/*
+SplitTransfer 没有一条路由能够容纳`amount`时,把支付拆分成多笔交易分别走`routeInfo`中的路由,
+所有交易都到达target以后才泄露密码,任何一笔交易在此之前失败,其他交易都会被撤销.
+返回拆分结果并登记为长时间操作,撤销操作会撤销整个支付
+*/
+func (r *API) SplitTransfer(tokenAddress common.Address, amount *big.Int, target common.Address, data string, routeInfo []pfsproxy.FindPathResponse, exclusion *RouteExclusion) (info *SplitPaymentInfo, result *utils.AsyncResult, err error) {
+	if err = exclusion.validate(r.Photon.NodeAddress, target); err != nil {
+		return
+	}
+	if err = r.Photon.checkCircuitBreaker(tokenAddress); err != nil {
+		return
+	}
+	if err = r.checkQueueStatus(); err != nil {
+		return
+	}
+	result = r.Photon.splitTransferClient(tokenAddress, amount, target, data, routeInfo, exclusion)
+	info, ok := result.Tag.(*SplitPaymentInfo)
+	if !ok {
+		err = <-result.Result
+		return
+	}
+	result.SetCancel(func() error {
+		//撤销其中任何一笔交易,其他交易都会被撤销
+		var err error
+		for _, part := range info.Parts {
+			err = r.CancelTransfer(part.LockSecretHash, tokenAddress)
+			if err == nil {
+				return nil
+			}
+		}
+		return err
+	})
+	_, err = r.Photon.operations.start("split_transfer", result, params.MaxRequestTimeout)
+	return
+}
+
 //TransferInternal :
-func (r *API) TransferInternal(tokenAddress common.Address, amount *big.Int, target common.Address, secret common.Hash, isDirectTransfer bool, data string, routeInfo []pfsproxy.FindPathResponse) (result *utils.AsyncResult, err error) {
+func (r *API) TransferInternal(tokenAddress common.Address, amount *big.Int, target common.Address, secret common.Hash, isDirectTransfer bool, data string, routeInfo []pfsproxy.FindPathResponse, opts *TransferOptions) (result *utils.AsyncResult, err error) {
 	log.Debug(fmt.Sprintf("initiating transfer initiator=%s target=%s token=%s amount=%d secret=%s,currentblock=%d",
 		r.Photon.NodeAddress.String(), target.String(), tokenAddress.String(), amount, secret.String(), r.Photon.GetBlockNumber()))
-	result = r.Photon.transferAsyncClient(tokenAddress, amount, target, secret, isDirectTransfer, data, routeInfo)
+	if opts == nil {
+		opts = &TransferOptions{}
+	}
+	//调用了prepare-update或者导出了通道状态,jsonrpc和mobile也要拒绝
+	if r.Photon.StopCreateNewTransfers {
+		err = rerr.ErrStopCreateNewTransfer
+		return
+	}
+	if err = opts.validate(r.Photon.NodeAddress, target, r.Photon.GetBlockNumber(), isDirectTransfer); err != nil {
+		return
+	}
+	if err = r.Photon.checkCircuitBreaker(tokenAddress); err != nil {
+		return
+	}
+	if err = r.checkQueueStatus(); err != nil {
+		return
+	}
+	result = r.Photon.transferAsyncClient(tokenAddress, amount, target, secret, isDirectTransfer, data, routeInfo, opts)
 	return
 }
 
+// checkQueueStatus 内部队列积压时返回可重试的ErrServiceBusy,并附带各个队列的积压情况
+func (r *API) checkQueueStatus() error {
+	qs := r.Photon.GetQueueStatus()
+	if r.Photon.isBusy(qs) {
+		log.Warn(fmt.Sprintf("reject new transfer because queues are busy, user_req=%d state_change=%d", qs.UserReq.Depth, qs.StateChange.Depth))
+		return rerr.ErrServiceBusy.WithData(qs)
+	}
+	return nil
+}
+
 // AllowRevealSecret :
 // 1. find state manager by lockSecretHash and tokenAddress
 // 2. check secret matches lockSecretHash or not
@@ -383,6 +706,10 @@ func (r *API) CooperativeSettle(tokenAddress, partnerAddress common.Address) (c
 		return
 	}
 	c, err = r.Photon.dao.GetChannel(tokenAddress, partnerAddress)
+	if err != nil {
+		err = rerr.ErrChannelNotFound
+		return
+	}
 	if c.State != channeltype.StateOpened && c.State != channeltype.StatePrepareForCooperativeSettle {
 		err = rerr.InvalidState("channel must be  open")
 		return
@@ -401,6 +728,10 @@ func (r *API) CooperativeSettle(tokenAddress, partnerAddress common.Address) (c
 //PrepareForCooperativeSettle  mark a channel prepared for settle,  return when state has been updated to database
 func (r *API) PrepareForCooperativeSettle(tokenAddress, partnerAddress common.Address) (c *channeltype.Serialization, err error) {
 	c, err = r.Photon.dao.GetChannel(tokenAddress, partnerAddress)
+	if err != nil {
+		err = rerr.ErrChannelNotFound
+		return
+	}
 	if c.State != channeltype.StateOpened {
 		err = rerr.InvalidState("channel must be  open")
 		return
@@ -419,6 +750,10 @@ func (r *API) PrepareForCooperativeSettle(tokenAddress, partnerAddress common.Ad
 //CancelPrepareForCooperativeSettle  cancel a mark. return when state has been updated to database
 func (r *API) CancelPrepareForCooperativeSettle(tokenAddress, partnerAddress common.Address) (c *channeltype.Serialization, err error) {
 	c, err = r.Photon.dao.GetChannel(tokenAddress, partnerAddress)
+	if err != nil {
+		err = rerr.ErrChannelNotFound
+		return
+	}
 	if c.State != channeltype.StatePrepareForCooperativeSettle {
 		err = rerr.InvalidState("channel must be  open")
 		return
@@ -439,7 +774,15 @@ func (r *API) Withdraw(tokenAddress, partnerAddress common.Address, amount *big.
 	if err = r.checkSmcStatus(); err != nil {
 		return
 	}
+	if amount == nil || amount.Sign() <= 0 {
+		err = rerr.ErrInvalidAmount
+		return
+	}
 	c, err = r.Photon.dao.GetChannel(tokenAddress, partnerAddress)
+	if err != nil {
+		err = rerr.ErrChannelNotFound
+		return
+	}
 	if c.State != channeltype.StateOpened && c.State != channeltype.StatePrepareForWithdraw {
 		err = rerr.InvalidState("channel must be  open")
 		return
@@ -462,6 +805,10 @@ func (r *API) Withdraw(tokenAddress, partnerAddress common.Address, amount *big.
 //PrepareForWithdraw  mark a channel prepared for withdraw,  return when state has been updated to database
 func (r *API) PrepareForWithdraw(tokenAddress, partnerAddress common.Address) (c *channeltype.Serialization, err error) {
 	c, err = r.Photon.dao.GetChannel(tokenAddress, partnerAddress)
+	if err != nil {
+		err = rerr.ErrChannelNotFound
+		return
+	}
 	if c.State != channeltype.StateOpened {
 		err = rerr.InvalidState("channel must be  open")
 		return
@@ -480,6 +827,10 @@ func (r *API) PrepareForWithdraw(tokenAddress, partnerAddress common.Address) (c
 //CancelPrepareForWithdraw  cancel a mark. return when state has been updated to database
 func (r *API) CancelPrepareForWithdraw(tokenAddress, partnerAddress common.Address) (c *channeltype.Serialization, err error) {
 	c, err = r.Photon.dao.GetChannel(tokenAddress, partnerAddress)
+	if err != nil {
+		err = rerr.ErrChannelNotFound
+		return
+	}
 	if c.State != channeltype.StatePrepareForWithdraw {
 		err = rerr.InvalidState("channel must be  open")
 		return
@@ -570,80 +921,6 @@ func (r *API) GetNetworkEvents(fromBlock, toBlock int64) ([]interface{}, error)
 	return nil, nil
 }
 
-//GetChannelEvents events of this channel
-func (r *API) GetChannelEvents(channelIdentifier common.Hash, fromBlock, toBlock int64) (data []transfer.Event, err error) {
-
-	//var events []transfer.Event
-	//events, err = r.Photon.BlockChainEvents.GetAllNettingChannelEvents(channelIdentifier, fromBlock, toBlock)
-	//if err != nil {
-	//	return
-	//}
-	//for _, e := range events {
-	//	m := make(map[string]interface{})
-	//	switch e2 := e.(type) {
-	//	case *blockchain.EventChannelNewBalance:
-	//		m["event_type"] = e2.EventName
-	//		m["participant"] = e2.ParticipantAddress.String()
-	//		m["balance"] = e2.Balance
-	//		m["block_number"] = e2.BlockNumber
-	//		data = append(data, m)
-	//	case *blockchain.EventChannelClosed:
-	//		m["event_type"] = e2.EventName
-	//		m["netting_channel_address"] = e2.ContractAddress.String()
-	//		m["closing_address"] = e2.ClosingAddress.String()
-	//		data = append(data, m)
-	//	case *blockchain.EventChannelSettled:
-	//		m["event_type"] = e2.EventName
-	//		m["netting_channel_address"] = e2.ContractAddress.String()
-	//		m["block_number"] = e2.BlockNumber
-	//		data = append(data, m)
-	//	case *blockchain.EventSecretRevealed:
-	//		m["event_type"] = e2.EventName
-	//		m["netting_channel_address"] = e2.ContractAddress.String()
-	//		m["secret"] = e2.Secret.String()
-	//		data = append(data, m)
-	//		//case *blockchain.EventNonClosingBalanceProofUpdated:
-	//		//	m["event_type"] = e2.EventName
-	//		//	m["token_address"] = t.String()
-	//		//	m["channel_manager_address"] = graph.TokenAddress.String()
-	//	}
-	//
-	//}
-	//
-	//var photonEvents []*models.InternalEvent
-	//photonEvents, err = r.Photon.dao.GetEventsInBlockRange(fromBlock, toBlock)
-	//if err != nil {
-	//	return
-	//}
-	////Here choose which photon internal events we want to expose to the end user
-	//for _, ev := range photonEvents {
-	//	m := make(map[string]interface{})
-	//	switch e2 := ev.EventObject.(type) {
-	//	case *transfer.EventTransferSentSuccess:
-	//		m["event_type"] = "EventTransferSentSuccess"
-	//		m["identifier"] = e2.LockSecretHash
-	//		m["block_number"] = ev.BlockNumber
-	//		m["amount"] = e2.Amount
-	//		m["target"] = e2.Target
-	//		data = append(data, m)
-	//	case *transfer.EventTransferSentFailed:
-	//		m["event_type"] = "EventTransferSentFailed"
-	//		m["identifier"] = e2.LockSecretHash
-	//		m["block_number"] = ev.BlockNumber
-	//		m["reason"] = e2.Reason
-	//		data = append(data, m)
-	//	case *transfer.EventTransferReceivedSuccess:
-	//		m["event_type"] = "EventTransferReceivedSuccess"
-	//		m["identifier"] = e2.LockSecretHash
-	//		m["block_number"] = ev.BlockNumber
-	//		m["amount"] = e2.Amount
-	//		m["initiator"] = e2.Initiator.String()
-	//		data = append(data, m)
-	//	}
-	//}
-	return
-}
-
 /*
 GetSentTransferDetails query sent transfers from dao
 */
@@ -651,6 +928,29 @@ func (r *API) GetSentTransferDetails(tokenAddress common.Address, from, to int64
 	return r.Photon.dao.GetSentTransferDetailList(tokenAddress, -1, -1, from, to)
 }
 
+/*
+GetTransferStatus 查询自己发起的交易经历的每一个阶段,直接交易使用发起时返回的LockSecretHash
+*/
+func (r *API) GetTransferStatus(lockSecretHash common.Hash) (*models.TransferLifecycle, error) {
+	return r.Photon.dao.GetTransferLifecycle(lockSecretHash)
+}
+
+/*
+GetPayment 按照用户指定的支付ID查询发出和收到的交易,方便商户和订单对账
+*/
+func (r *API) GetPayment(paymentID string) (records *PaymentRecords, err error) {
+	if paymentID == "" {
+		return nil, rerr.ErrArgumentError.Append("empty payment_id")
+	}
+	records = &PaymentRecords{PaymentID: paymentID}
+	records.Sent, err = r.Photon.dao.GetSentTransferDetailsByPaymentID(paymentID)
+	if err != nil {
+		return
+	}
+	records.Received, err = r.Photon.dao.GetReceivedTransfersByPaymentID(paymentID)
+	return
+}
+
 /*
 GetReceivedTransfers query received transfers from dao
 */
@@ -976,6 +1276,9 @@ func (r *API) NotifyNetworkDown() error {
 	if t, ok := r.Photon.Protocol.Transport.(*network.MixTransport); ok {
 		t.Reconnect()
 	}
+	if t, ok := r.Photon.Protocol.Transport.(*network.PriorityTransport); ok {
+		t.Reconnect()
+	}
 	return nil
 }
 
@@ -998,6 +1301,437 @@ func (r *API) SetFeePolicy(fp *models.FeePolicy) error {
 	return feeModule.SetFeePolicy(fp)
 }
 
+// SetNodeAdvertisement 发布自己的公开信息,其他节点和PFS可以通过NodeAdvertisementRequest查询
+func (r *API) SetNodeAdvertisement(na *models.NodeAdvertisement) (*models.NodeAdvertisement, error) {
+	na.NodeAddress = r.Photon.NodeAddress
+	na.Timestamp = time.Now().Unix()
+	err := na.Sign(r.Photon.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	err = r.Photon.dao.SaveNodeAdvertisement(na)
+	if err != nil {
+		return nil, err
+	}
+	return na, nil
+}
+
+// GetNodeAdvertisement 查询节点的公开信息,查询自己时直接读取数据库,否则向对方发送查询消息并等待响应
+func (r *API) GetNodeAdvertisement(nodeAddress common.Address, timeout time.Duration) (na *models.NodeAdvertisement, err error) {
+	if nodeAddress == r.Photon.NodeAddress {
+		return r.Photon.dao.GetNodeAdvertisement()
+	}
+	result := r.Photon.queryNodeAdvertisementClient(nodeAddress)
+	select {
+	case err = <-result.Result:
+	case <-time.After(timeout):
+		err = rerr.ErrNodeNotOnline.Printf("query node advertisement of %s timeout", nodeAddress.String())
+	}
+	if err != nil {
+		return
+	}
+	na = result.Tag.(*models.NodeAdvertisement)
+	return
+}
+
+// GetPeerStateBackups 返回为其他节点保存的加密状态备份
+func (r *API) GetPeerStateBackups() ([]*models.PeerStateBackup, error) {
+	return r.Photon.dao.GetAllPeerStateBackup()
+}
+
+// GetPeerStateBackup 返回为节点`owner`保存的加密状态备份,`owner`用自己的私钥通过RestoreStateBackup恢复通道状态
+func (r *API) GetPeerStateBackup(owner common.Address) (*models.PeerStateBackup, error) {
+	return r.Photon.dao.GetPeerStateBackup(owner)
+}
+
+// GetWebhookDeadLetters 列出所有重试多次仍然没有投递成功的webhook通知
+func (r *API) GetWebhookDeadLetters() ([]*models.WebhookDeadLetter, error) {
+	return r.Photon.dao.GetAllWebhookDeadLetters()
+}
+
+// RedeliverWebhookDeadLetter 重新投递一条webhook dead letter,成功以后删除
+func (r *API) RedeliverWebhookDeadLetter(id string) error {
+	if r.Photon.webhooks == nil {
+		return rerr.ErrArgumentError.Append("webhook is not enabled")
+	}
+	return r.Photon.webhooks.redeliver(id)
+}
+
+// RemoveWebhookDeadLetter 放弃投递一条webhook dead letter
+func (r *API) RemoveWebhookDeadLetter(id string) error {
+	_, err := r.Photon.dao.GetWebhookDeadLetter(id)
+	if err != nil {
+		return err
+	}
+	return r.Photon.dao.RemoveWebhookDeadLetter(id)
+}
+
+/*
+DelegateMonitoring 把通道中对方给我的最新BalanceProof委托给第三方监控服务,
+离线期间对方关闭通道时由监控服务代替我updateBalanceProof和unlock
+*/
+func (r *API) DelegateMonitoring(channelIdentifier common.Hash) (d *models.MonitoringDelegation, err error) {
+	if params.MonitoringServiceURL == "" || params.MonitoringServiceAddress == utils.EmptyAddress {
+		err = rerr.ErrMonitoringServiceNotConfigured
+		return
+	}
+	c, err := r.GetChannel(channelIdentifier)
+	if err != nil {
+		return
+	}
+	if c.State != channeltype.StateOpened {
+		err = rerr.ErrChannelState.Printf("channel %s is %s", channelIdentifier.String(), c.State)
+		return
+	}
+	if c.PartnerBalanceProof == nil || c.PartnerBalanceProof.Nonce == 0 {
+		err = rerr.ErrArgumentError.Append("partner has not sent any balance proof on this channel, nothing to delegate")
+		return
+	}
+	c3, err := r.ChannelInformationFor3rdParty(channelIdentifier, params.MonitoringServiceAddress)
+	if err != nil {
+		return
+	}
+	return r.Photon.delegateMonitoring(c3)
+}
+
+/*
+DelegateAllMonitoring 委托所有打开的,并且对方给我转过账的通道,
+某个通道委托失败时继续委托其他通道,返回成功的委托以及最后一个错误
+*/
+func (r *API) DelegateAllMonitoring() (ds []*models.MonitoringDelegation, err error) {
+	cs, err := r.GetChannelList(utils.EmptyAddress, utils.EmptyAddress)
+	if err != nil {
+		return
+	}
+	for _, c := range cs {
+		if c.State != channeltype.StateOpened || c.PartnerBalanceProof == nil || c.PartnerBalanceProof.Nonce == 0 {
+			continue
+		}
+		d, err2 := r.DelegateMonitoring(c.ChannelIdentifier.ChannelIdentifier)
+		if err2 != nil {
+			log.Error(fmt.Sprintf("delegate channel %s to monitoring service err %s", c.ChannelIdentifier.String(), err2))
+			err = err2
+			continue
+		}
+		ds = append(ds, d)
+	}
+	return
+}
+
+/*
+GetMonitoringDelegations 列出还有效的委托,通道已经settle或者重新打开的委托记录会被删除.
+Outdated表示委托以后又收到了对方新的BalanceProof,需要重新委托
+*/
+func (r *API) GetMonitoringDelegations() (ss []*MonitoringDelegationStatus, err error) {
+	ds, err := r.Photon.dao.GetAllMonitoringDelegations()
+	if err != nil {
+		return
+	}
+	for _, d := range ds {
+		c, err2 := r.GetChannel(d.ChannelIdentifier)
+		if err2 != nil || c.ChannelIdentifier.OpenBlockNumber != d.OpenBlockNumber || c.State == channeltype.StateSettled {
+			err2 = r.Photon.dao.RemoveMonitoringDelegation(d.ChannelIdentifier)
+			if err2 != nil {
+				log.Error(fmt.Sprintf("RemoveMonitoringDelegation %s err %s", d.ChannelIdentifier.String(), err2))
+			}
+			continue
+		}
+		ss = append(ss, &MonitoringDelegationStatus{
+			MonitoringDelegation: d,
+			Outdated:             c.PartnerBalanceProof != nil && c.PartnerBalanceProof.Nonce > d.Nonce,
+		})
+	}
+	return
+}
+
+/*
+GetNotifications 按照顺序返回seq大于sinceID并且满足filter的通知,最多limit条,
+离线的应用保存收到的最大seq,上线以后从这里补收错过的交易和通道通知
+*/
+func (r *API) GetNotifications(sinceID uint64, filter notify.Filter, limit int) ([]*notify.Record, error) {
+	return r.Photon.NotifyHandler.History(sinceID, filter, limit)
+}
+
+/*
+GetNetworkStats 汇总自己和其他同意共享统计的节点的匿名统计,得到全网的token网络统计.
+只有以--share-network-stats启动时才会收到其他节点的统计
+*/
+func (r *API) GetNetworkStats() (s *models.NetworkStats, err error) {
+	chs, err := r.Photon.dao.GetChannelList(utils.EmptyAddress, utils.EmptyAddress)
+	if err != nil {
+		return
+	}
+	blockNumber := r.Photon.GetBlockNumber()
+	reports := []*models.NetworkStatsReport{buildNetworkStatsReport(r.Photon.networkStatsReporterID(), r.Photon.NodeAddress, blockNumber, chs)}
+	if r.Photon.Config.ShareNetworkStats {
+		all, err := r.Photon.dao.GetAllNetworkStatsReports()
+		if err != nil {
+			return nil, err
+		}
+		for _, report := range all {
+			if report.BlockNumber >= blockNumber-params.NetworkStatsMaxAge {
+				reports = append(reports, report)
+			}
+		}
+	}
+	return models.AggregateNetworkStats(reports), nil
+}
+
+/*
+RequestInboundCapacity 请求`partner`向我们之间的通道存入`amount`,增加我们可以接收的金额,
+`feeOffer`是愿意为此支付的费用,只是告诉对方,不会自动支付
+*/
+func (r *API) RequestInboundCapacity(token, partner common.Address, amount, feeOffer *big.Int, reason string) (req *InboundCapacityRequest, err error) {
+	if amount == nil || amount.Cmp(utils.BigInt0) <= 0 {
+		err = rerr.ErrInvalidAmount
+		return
+	}
+	if feeOffer == nil {
+		feeOffer = big.NewInt(0)
+	}
+	if feeOffer.Cmp(utils.BigInt0) < 0 {
+		err = rerr.ErrInvalidAmount.Append("fee offer must not be negative")
+		return
+	}
+	if len(reason) > params.InboundCapacityReasonMaxLength {
+		err = rerr.ErrArgumentError.Printf("reason is longer than %d", params.InboundCapacityReasonMaxLength)
+		return
+	}
+	result := r.Photon.inboundCapacityClient(token, partner, amount, feeOffer, reason)
+	err = <-result.Result
+	if err != nil {
+		return
+	}
+	req = result.Tag.(*InboundCapacityRequest)
+	return
+}
+
+// GetInboundCapacityRequests 返回发出和收到的请求存款的记录,requester是自己的为发出的请求
+func (r *API) GetInboundCapacityRequests() []*InboundCapacityRequest {
+	return r.Photon.inboundCapacityRequests.list()
+}
+
+/*
+RespondInboundCapacity 答复收到的请求,`accept`为true时向通道存入对方请求的金额
+*/
+func (r *API) RespondInboundCapacity(id common.Hash, accept bool, reason string) (req *InboundCapacityRequest, err error) {
+	if len(reason) > params.InboundCapacityReasonMaxLength {
+		err = rerr.ErrArgumentError.Printf("reason is longer than %d", params.InboundCapacityReasonMaxLength)
+		return
+	}
+	if accept {
+		if err = r.checkSmcStatus(); err != nil {
+			return
+		}
+	}
+	err = <-r.Photon.respondInboundCapacityClient(id, accept, reason).Result
+	if err != nil {
+		return
+	}
+	req2, _ := r.Photon.inboundCapacityRequests.get(id)
+	req = &req2
+	return
+}
+
+/*
+InitiateSwap 作为maker向`taker`提出用`makerAmount`个`makerToken`交换`takerAmount`个`takerToken`,
+对方接受以后自动发起交易,两笔交易使用同一个密码,要么都成功要么都失败
+*/
+func (r *API) InitiateSwap(taker, makerToken common.Address, makerAmount *big.Int, takerToken common.Address, takerAmount *big.Int) (order *models.SwapOrder, err error) {
+	if makerAmount == nil || makerAmount.Cmp(utils.BigInt0) <= 0 ||
+		takerAmount == nil || takerAmount.Cmp(utils.BigInt0) <= 0 {
+		err = rerr.ErrInvalidAmount
+		return
+	}
+	if makerToken == takerToken {
+		err = rerr.ErrArgumentError.Append("maker token and taker token must be different")
+		return
+	}
+	if err = r.checkQueueStatus(); err != nil {
+		return
+	}
+	result := r.Photon.initiateSwapClient(taker, makerToken, makerAmount, takerToken, takerAmount)
+	err = <-result.Result
+	if err != nil {
+		return
+	}
+	order = result.Tag.(*models.SwapOrder)
+	return
+}
+
+/*
+AcceptSwap 作为taker接受收到的交换,之后等待maker的交易到达再发出自己的交易
+*/
+func (r *API) AcceptSwap(lockSecretHash common.Hash) (order *models.SwapOrder, err error) {
+	if err = r.checkQueueStatus(); err != nil {
+		return
+	}
+	return r.respondSwap(lockSecretHash, true, "")
+}
+
+// RejectSwap 拒绝收到的交换,`reason`会告诉maker
+func (r *API) RejectSwap(lockSecretHash common.Hash, reason string) (order *models.SwapOrder, err error) {
+	if len(reason) > params.InboundCapacityReasonMaxLength {
+		err = rerr.ErrArgumentError.Printf("reason is longer than %d", params.InboundCapacityReasonMaxLength)
+		return
+	}
+	return r.respondSwap(lockSecretHash, false, reason)
+}
+
+func (r *API) respondSwap(lockSecretHash common.Hash, accept bool, reason string) (order *models.SwapOrder, err error) {
+	result := r.Photon.respondSwapClient(lockSecretHash, accept, reason)
+	err = <-result.Result
+	if err != nil {
+		return
+	}
+	order = result.Tag.(*models.SwapOrder)
+	return
+}
+
+// GetSwapOrders 返回发出和收到的所有交换,IsMaker为true的是自己发出的
+func (r *API) GetSwapOrders() ([]*models.SwapOrder, error) {
+	return r.Photon.dao.GetAllSwapOrders()
+}
+
+/*
+GetChannelEvents 返回通道块号在[`fromBlock`,`toBlock`)之间的审计记录,按照块号排序,`toBlock`小于等于0时不限制结束块.
+通道settle以后记录仍然保留,重新打开的通道用OpenBlockNumber区分
+*/
+func (r *API) GetChannelEvents(channelIdentifier common.Hash, fromBlock, toBlock int64) ([]*models.ChannelEvent, error) {
+	return r.Photon.dao.GetChannelEvents(channelIdentifier, fromBlock, toBlock)
+}
+
+/*
+RegisterTransferApprover 注册接收方的确认回调,之后收到的给自己的交易都先由`approver`决定是否接收,
+拒绝的交易通过AnnounceDisposed退回给上家.传入nil取消注册
+*/
+func (r *API) RegisterTransferApprover(approver TransferApprover) {
+	r.Photon.setTransferApprover(approver)
+}
+
+// GetPendingApprovals 返回等待确认的交易,只有启用了--target-approval并且没有注册确认回调时才会有
+func (r *API) GetPendingApprovals() (transfers []*IncomingTransfer, err error) {
+	result := r.Photon.pendingApprovalsClient()
+	err = <-result.Result
+	if err != nil {
+		return
+	}
+	transfers = result.Tag.([]*IncomingTransfer)
+	return
+}
+
+/*
+ApproveTransfer 接收或者拒绝一笔等待确认的交易,接收以后发送SecretRequest,拒绝时`reason`会告诉上家
+*/
+func (r *API) ApproveTransfer(tokenAddress common.Address, lockSecretHash common.Hash, approved bool, reason string) (t *IncomingTransfer, err error) {
+	if len(reason) > params.TransferApprovalReasonMaxLength {
+		err = rerr.ErrArgumentError.Printf("reason is longer than %d", params.TransferApprovalReasonMaxLength)
+		return
+	}
+	result := r.Photon.approveTransferClient(tokenAddress, lockSecretHash, approved, reason)
+	err = <-result.Result
+	if err != nil {
+		return
+	}
+	t = result.Tag.(*IncomingTransfer)
+	return
+}
+
+/*
+PrepareOfflineTxBundle 为已关闭的通道生成争议期内需要提交的全部交易(update,unlock,settle),由离线的签名方签名.
+重新生成会替换之前没有签名的交易,已经开始提交的不能替换
+*/
+func (r *API) PrepareOfflineTxBundle(channelIdentifier common.Hash) (b *models.OfflineTxBundle, err error) {
+	if err = r.checkSmcStatus(); err != nil {
+		return
+	}
+	r.Photon.offlineTxLock.Lock()
+	defer r.Photon.offlineTxLock.Unlock()
+	old, err := r.Photon.dao.GetOfflineTxBundle(channelIdentifier)
+	if err == nil && old.IsSigned() && !old.IsFinished() {
+		err = rerr.ErrServiceBusy.Printf("signed txs of channel %s are waiting for submission", channelIdentifier.String())
+		return
+	}
+	result := r.Photon.offlineTxBundleClient(channelIdentifier)
+	err = <-result.Result
+	if err != nil {
+		return
+	}
+	b, err = r.Photon.buildOfflineTxBundle(channelIdentifier, result.Tag.(*offlineDisputeSnapshot), r.Photon.GetBlockNumber())
+	if err != nil {
+		return
+	}
+	err = r.Photon.dao.SaveOfflineTxBundle(b)
+	return
+}
+
+//GetOfflineTxBundle returns txs prepared for channelIdentifier and their status
+func (r *API) GetOfflineTxBundle(channelIdentifier common.Hash) (*models.OfflineTxBundle, error) {
+	return r.Photon.dao.GetOfflineTxBundle(channelIdentifier)
+}
+
+/*
+SubmitOfflineTxBundle 接收离线签名后的交易,顺序必须与PrepareOfflineTxBundle返回的一致,
+校验通过以后在每笔交易的NotBefore到达时依次提交
+*/
+func (r *API) SubmitOfflineTxBundle(channelIdentifier common.Hash, signedTxs []hexutil.Bytes) (b *models.OfflineTxBundle, err error) {
+	r.Photon.offlineTxLock.Lock()
+	defer r.Photon.offlineTxLock.Unlock()
+	b, err = r.Photon.dao.GetOfflineTxBundle(channelIdentifier)
+	if err != nil {
+		return
+	}
+	err = r.Photon.acceptSignedOfflineTxs(b, signedTxs)
+	if err != nil {
+		return
+	}
+	err = r.Photon.dao.SaveOfflineTxBundle(b)
+	return
+}
+
+/*
+ExportChannelState 导出所有未settle的通道,balance proof,锁和密码以及进行中交易的快照,
+用节点自己的公钥加密,迁移到新机器以后用同一个账户通过ImportChannelState导入
+*/
+func (r *API) ExportChannelState() (data []byte, err error) {
+	result := r.Photon.exportChannelStateClient()
+	err = <-result.Result
+	if err != nil {
+		return
+	}
+	data = result.Tag.([]byte)
+	return
+}
+
+/*
+ImportChannelState 导入ExportChannelState导出的通道状态,本地已经存在的通道不会被覆盖.
+导入了进行中的交易时,需要重启才能继续这些交易
+*/
+func (r *API) ImportChannelState(data []byte) (result *ChannelStateImportResult, err error) {
+	ar := r.Photon.importChannelStateClient(data)
+	err = <-ar.Result
+	if err != nil {
+		return
+	}
+	result = ar.Tag.(*ChannelStateImportResult)
+	return
+}
+
+// GetPartnerFilter 返回通道伙伴黑白名单
+func (r *API) GetPartnerFilter() *models.PartnerFilter {
+	return r.Photon.dao.GetPartnerFilter()
+}
+
+// SetPartnerFilter 更新通道伙伴黑白名单,之后不会再和黑名单中或白名单以外的节点创建通道或者向通道中存款
+func (r *API) SetPartnerFilter(pf *models.PartnerFilter) error {
+	for _, addr := range pf.Blacklist {
+		if addr == r.Photon.NodeAddress {
+			return rerr.ErrArgumentError.Append("cannot blacklist myself")
+		}
+	}
+	return r.Photon.dao.SavePartnerFilter(pf)
+}
+
 // FindPath 向PFS询问路由,要求启用收费
 func (r *API) FindPath(targetAddress, tokenAddress common.Address, amount *big.Int) (routes []pfsproxy.FindPathResponse, err error) {
 	if r.Photon.PfsProxy == nil {
@@ -1055,9 +1789,12 @@ func (r *API) SystemStatus() (resp interface{}, err error) {
 		FeePolicy           *models.FeePolicy                 `json:"fee_policy"`
 		ChannelNum          int                               `json:"channel_num"`
 		Transfers           *transfers                        `json:"transfers,omitempty"`
+		Queues              *QueueStatus                      `json:"queues"`
+		SendQueue           *network.SendQueueStatus          `json:"send_queue"`
+		Notifications       map[string]*notify.BufferStats    `json:"notifications"`
 	}
 	var data systemStatus
-	data.EthRPCEndpoint = r.Photon.Config.EthRPCEndPoint
+	data.EthRPCEndpoint = r.Photon.Chain.Client.URL()
 	// EthRPCStatus
 	switch r.Photon.Chain.Client.Status {
 	case netshare.Disconnected:
@@ -1076,8 +1813,11 @@ func (r *API) SystemStatus() (resp interface{}, err error) {
 	data.LastBlockNumber = r.Photon.dao.GetLatestBlockNumber()
 	data.LastBlockNumberTime = r.Photon.dao.GetLastBlockNumberTime()
 	data.IsMobileMode = params.MobileMode
+	data.Queues = r.Photon.GetQueueStatus()
+	data.SendQueue = r.Photon.Protocol.SendQueueStatus()
+	data.Notifications = r.Photon.NotifyHandler.BufferStats()
 	// network type
-	switch r.Photon.Transport.(type) {
+	switch t := r.Photon.Transport.(type) {
 	case *network.XMPPTransport:
 		data.NetworkType = "xmpp"
 	case *network.MixTransport:
@@ -1088,6 +1828,8 @@ func (r *API) SystemStatus() (resp interface{}, err error) {
 		data.NetworkType = "matrix-udp"
 	case *network.UDPTransport:
 		data.NetworkType = "udp"
+	case *network.PriorityTransport:
+		data.NetworkType = t.String()
 	}
 	// FeePolicy
 	if r.Photon.Config.EnableMediationFee {
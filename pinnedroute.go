@@ -0,0 +1,104 @@
+package photon
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/SmartMeshFoundation/Photon/pfsproxy"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+用户指定的固定路由,不经过本地路由和pfs,路由失败时也不会换其他路由.
+发起之前在主线程中检查路由,之后和route_info一样发起交易
+*/
+
+const checkRouteReqName = "checkRoute"
+
+type checkRouteReq struct {
+	tokenAddress common.Address
+	amount       *big.Int
+	target       common.Address
+	path         []common.Address
+}
+
+func (rs *Service) checkRouteClient(tokenAddress common.Address, amount *big.Int, target common.Address, path []common.Address) *utils.AsyncResult {
+	req := &apiReq{
+		ReqID: utils.RandomString(10),
+		Name:  checkRouteReqName,
+		Req: &checkRouteReq{
+			tokenAddress: tokenAddress,
+			amount:       amount,
+			target:       target,
+			path:         path,
+		},
+	}
+	return rs.sendReqClient(req)
+}
+
+/*
+checkRoute 检查path从第一个中转节点开始,到target结束,没有重复的节点,也不经过我自己.
+我和第一跳的通道必须能够支付amount加上估算的手续费,其余的通道必须存在,并且通道伙伴转告的容量足够.
+成功时result.Tag是可以作为route_info的路由
+*/
+func (rs *Service) checkRoute(r *checkRouteReq) (result *utils.AsyncResult) {
+	result = utils.NewAsyncResult()
+	route, err := rs.validateRoute(r)
+	result.Tag = route
+	result.Result <- err
+	return
+}
+
+func (rs *Service) validateRoute(r *checkRouteReq) (route *pfsproxy.FindPathResponse, err error) {
+	if len(r.path) == 0 || r.path[len(r.path)-1] != r.target {
+		err = rerr.ErrArgumentError.Append("route must end with target")
+		return
+	}
+	seen := make(map[common.Address]bool)
+	for _, addr := range r.path {
+		if addr == rs.NodeAddress {
+			err = rerr.ErrArgumentError.Append("route must not contain myself")
+			return
+		}
+		if seen[addr] {
+			err = rerr.ErrArgumentError.Printf("route contains %s twice", utils.APex2(addr))
+			return
+		}
+		seen[addr] = true
+	}
+	g := rs.Token2ChannelGraph[r.tokenAddress]
+	if g == nil {
+		err = rerr.ErrTokenNotFound
+		return
+	}
+	ch := g.GetPartenerAddress2Channel(r.path[0])
+	if ch == nil {
+		err = rerr.ChannelNotFound(fmt.Sprintf("partner:%s", utils.APex2(r.path[0])))
+		return
+	}
+	if !ch.CanTransfer() {
+		err = rerr.ChannelStateError(ch.State)
+		return
+	}
+	fee := estimatePathFee(r.tokenAddress, rs.NodeAddress, r.target, r.amount, r.path)
+	required := new(big.Int).Add(r.amount, fee)
+	if ch.Distributable().Cmp(required) < 0 {
+		err = rerr.ErrInsufficientBalance.Printf("channel with %s can't afford %s, distributable=%s", utils.APex2(r.path[0]), required, ch.Distributable())
+		return
+	}
+	err = g.CheckPath(r.path, r.amount)
+	if err != nil {
+		err = rerr.ErrNoAvailabeRoute.AppendError(err)
+		return
+	}
+	route = &pfsproxy.FindPathResponse{
+		PathHop: len(r.path) - 1,
+		Fee:     fee,
+	}
+	for _, addr := range r.path {
+		route.Result = append(route.Result, addr.String())
+	}
+	return
+}
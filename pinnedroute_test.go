@@ -0,0 +1,44 @@
+package photon
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/network/graph"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/SmartMeshFoundation/Photon/utils/utest"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRoute(t *testing.T) {
+	hop, target := utils.NewRandomAddress(), utils.NewRandomAddress()
+	ch := utest.MakeRoute(hop, big.NewInt(100), utest.UnitSettleTimeout, utest.UnitRevealTimeout, 0, utils.NewRandomHash()).Channel()
+	me, token := ch.OurState.Address, ch.TokenAddress
+	g := graph.NewChannelGraph(me, token, []common.Address{hop, target})
+	assert.Nil(t, g.AddChannel(ch))
+	rs := &Service{
+		NodeAddress:        me,
+		Token2ChannelGraph: map[common.Address]*graph.ChannelGraph{token: g},
+	}
+	check := func(amount int64, path ...common.Address) error {
+		_, err := rs.validateRoute(&checkRouteReq{tokenAddress: token, amount: big.NewInt(amount), target: target, path: path})
+		return err
+	}
+	route, err := rs.validateRoute(&checkRouteReq{tokenAddress: token, amount: big.NewInt(10), target: target, path: []common.Address{hop, target}})
+	if assert.Nil(t, err) {
+		assert.EqualValues(t, []common.Address{hop, target}, route.GetPath())
+		assert.Equal(t, 1, route.PathHop)
+	}
+	assert.Equal(t, rerr.ErrArgumentError.ErrorCode, check(10, hop).(rerr.StandardError).ErrorCode)
+	assert.Equal(t, rerr.ErrArgumentError.ErrorCode, check(10, hop, me, target).(rerr.StandardError).ErrorCode)
+	assert.Equal(t, rerr.ErrArgumentError.ErrorCode, check(10, hop, hop, target).(rerr.StandardError).ErrorCode)
+	//和target没有直接的通道
+	assert.Equal(t, rerr.ErrChannelNotFound.ErrorCode, check(10, target).(rerr.StandardError).ErrorCode)
+	assert.Equal(t, rerr.ErrInsufficientBalance.ErrorCode, check(101, hop, target).(rerr.StandardError).ErrorCode)
+	//已知hop的容量不够
+	assert.True(t, g.SetEdgeCapacity(hop, target, big.NewInt(5), 1))
+	assert.Equal(t, rerr.ErrNoAvailabeRoute.ErrorCode, check(10, hop, target).(rerr.StandardError).ErrorCode)
+	assert.Nil(t, check(5, hop, target))
+}
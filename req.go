@@ -49,6 +49,11 @@ const registerSecretReqName = "RegisterSecret"
 const getUnfinishedReceviedTransferReqName = "GetUnfinishedReceivedTransfer"
 const forceUnlockReqName = "ForceUnlock"
 const registerSecretOnChainReqName = "registerSecretOnChain"
+const queryNodeAdvertisementReqName = "queryNodeAdvertisement"
+const inboundCapacityReqName = "inboundCapacity"
+const respondInboundCapacityReqName = "respondInboundCapacity"
+const offlineTxBundleReqName = "offlineTxBundle"
+const transferFinishedReqName = "transferFinished"
 
 /*
 transfer api
@@ -61,6 +66,9 @@ type transferReq struct {
 	IsDirectTransfer bool
 	Data             string
 	RouteInfo        []pfsproxy.FindPathResponse
+	TransferOptions
+	secretGenerated    bool        //Secret是发送队列生成的,不是用户指定的
+	fakeLockSecretHash common.Hash //直接交易用来记录状态的假LockSecretHash
 }
 
 /*
@@ -138,7 +146,10 @@ Transfer `amount` between this node and `target`.
            - Network speed, making the transfer sufficiently fast so it doesn't
              expire.
 */
-func (rs *Service) transferAsyncClient(tokenAddress common.Address, amount *big.Int, target common.Address, secret common.Hash, isDirectTransfer bool, data string, routeInfo []pfsproxy.FindPathResponse) *utils.AsyncResult {
+func (rs *Service) transferAsyncClient(tokenAddress common.Address, amount *big.Int, target common.Address, secret common.Hash, isDirectTransfer bool, data string, routeInfo []pfsproxy.FindPathResponse, opts *TransferOptions) *utils.AsyncResult {
+	if !isDirectTransfer && len(routeInfo) == 0 {
+		routeInfo = rs.queryPfsRoutes(tokenAddress, target, amount)
+	}
 	req := &apiReq{
 		ReqID: utils.RandomString(10),
 		Name:  transferReqName,
@@ -150,6 +161,7 @@ func (rs *Service) transferAsyncClient(tokenAddress common.Address, amount *big.
 			IsDirectTransfer: isDirectTransfer,
 			Data:             data,
 			RouteInfo:        routeInfo,
+			TransferOptions:  *opts,
 		},
 	}
 	return rs.sendReqClient(req)
@@ -362,3 +374,178 @@ func (rs *Service) registerSecretOnChainClient(secret common.Hash) *utils.AsyncR
 	}
 	return rs.sendReqClient(req)
 }
+
+type queryNodeAdvertisementReq struct {
+	target common.Address
+}
+
+func (rs *Service) queryNodeAdvertisementClient(target common.Address) *utils.AsyncResult {
+	req := &apiReq{
+		ReqID: utils.RandomString(10),
+		Name:  queryNodeAdvertisementReqName,
+		Req: &queryNodeAdvertisementReq{
+			target: target,
+		},
+	}
+	return rs.sendReqClient(req)
+}
+
+type inboundCapacityReq struct {
+	token    common.Address
+	partner  common.Address
+	amount   *big.Int
+	feeOffer *big.Int
+	reason   string
+}
+
+func (rs *Service) inboundCapacityClient(token, partner common.Address, amount, feeOffer *big.Int, reason string) *utils.AsyncResult {
+	req := &apiReq{
+		ReqID: utils.RandomString(10),
+		Name:  inboundCapacityReqName,
+		Req: &inboundCapacityReq{
+			token:    token,
+			partner:  partner,
+			amount:   amount,
+			feeOffer: feeOffer,
+			reason:   reason,
+		},
+	}
+	return rs.sendReqClient(req)
+}
+
+type respondInboundCapacityReq struct {
+	id     common.Hash
+	accept bool
+	reason string
+}
+
+func (rs *Service) respondInboundCapacityClient(id common.Hash, accept bool, reason string) *utils.AsyncResult {
+	req := &apiReq{
+		ReqID: utils.RandomString(10),
+		Name:  respondInboundCapacityReqName,
+		Req: &respondInboundCapacityReq{
+			id:     id,
+			accept: accept,
+			reason: reason,
+		},
+	}
+	return rs.sendReqClient(req)
+}
+
+type offlineTxBundleReq struct {
+	channelIdentifier common.Hash
+}
+
+func (rs *Service) offlineTxBundleClient(channelIdentifier common.Hash) *utils.AsyncResult {
+	req := &apiReq{
+		ReqID: utils.RandomString(10),
+		Name:  offlineTxBundleReqName,
+		Req: &offlineTxBundleReq{
+			channelIdentifier: channelIdentifier,
+		},
+	}
+	return rs.sendReqClient(req)
+}
+
+type transferFinishedReq struct {
+	token    common.Address
+	priority TransferPriority
+}
+
+//transferFinishedClient 不等待结果,Service退出以后也不会阻塞
+func (rs *Service) transferFinishedClient(token common.Address, priority TransferPriority) {
+	req := &apiReq{
+		ReqID: utils.RandomString(10),
+		Name:  transferFinishedReqName,
+		Req: &transferFinishedReq{
+			token:    token,
+			priority: priority,
+		},
+		result: make(chan *utils.AsyncResult, 1),
+	}
+	select {
+	case rs.UserReqChan <- req:
+	case <-rs.quitChan:
+	}
+}
+
+const splitTransferReqName = "splitTransfer"
+const splitTransferFinishedReqName = "splitTransferFinished"
+
+type splitTransferReq struct {
+	TokenAddress common.Address
+	Amount       *big.Int
+	Target       common.Address
+	Data         string
+	RouteInfo    []pfsproxy.FindPathResponse
+	Exclusion    *RouteExclusion
+}
+
+func (rs *Service) splitTransferClient(tokenAddress common.Address, amount *big.Int, target common.Address, data string, routeInfo []pfsproxy.FindPathResponse, exclusion *RouteExclusion) *utils.AsyncResult {
+	if len(routeInfo) == 0 {
+		routeInfo = rs.queryPfsRoutes(tokenAddress, target, amount)
+	}
+	req := &apiReq{
+		ReqID: utils.RandomString(10),
+		Name:  splitTransferReqName,
+		Req: &splitTransferReq{
+			TokenAddress: tokenAddress,
+			Amount:       amount,
+			Target:       target,
+			Data:         data,
+			RouteInfo:    routeInfo,
+			Exclusion:    exclusion,
+		},
+	}
+	return rs.sendReqClient(req)
+}
+
+type splitTransferFinishedReq struct {
+	id common.Hash
+}
+
+//splitTransferFinishedClient 不等待结果,Service退出以后也不会阻塞
+func (rs *Service) splitTransferFinishedClient(id common.Hash) {
+	req := &apiReq{
+		ReqID:  utils.RandomString(10),
+		Name:   splitTransferFinishedReqName,
+		Req:    &splitTransferFinishedReq{id: id},
+		result: make(chan *utils.AsyncResult, 1),
+	}
+	select {
+	case rs.UserReqChan <- req:
+	case <-rs.quitChan:
+	}
+}
+
+const pendingApprovalsReqName = "pendingApprovals"
+const approveTransferReqName = "approveTransfer"
+
+func (rs *Service) pendingApprovalsClient() *utils.AsyncResult {
+	req := &apiReq{
+		ReqID: utils.RandomString(10),
+		Name:  pendingApprovalsReqName,
+	}
+	return rs.sendReqClient(req)
+}
+
+type approveTransferReq struct {
+	tokenAddress   common.Address
+	lockSecretHash common.Hash
+	approved       bool
+	reason         string
+}
+
+func (rs *Service) approveTransferClient(tokenAddress common.Address, lockSecretHash common.Hash, approved bool, reason string) *utils.AsyncResult {
+	req := &apiReq{
+		ReqID: utils.RandomString(10),
+		Name:  approveTransferReqName,
+		Req: &approveTransferReq{
+			tokenAddress:   tokenAddress,
+			lockSecretHash: lockSecretHash,
+			approved:       approved,
+			reason:         reason,
+		},
+	}
+	return rs.sendReqClient(req)
+}
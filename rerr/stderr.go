@@ -173,6 +173,22 @@ var (
 	ErrUpdateButHaveTransfer = newError(1021, "ErrUpdateButHaveTransfer")
 	//ErrNotChargeFee 进行与收费相关的操作,但是没有启用收费
 	ErrNotChargeFee = newError(1022, "ErrNotChargeFee")
+	//ErrServiceBusy 内部队列积压,暂时不接受新的交易,稍后可以重试
+	ErrServiceBusy = newError(1023, "ServiceBusy")
+	//ErrTransferCanceled 交易还在发送队列中等待时被撤销,没有发出
+	ErrTransferCanceled = newError(1024, "TransferCanceled")
+	//ErrWebhookDelivery 重新投递webhook dead letter失败
+	ErrWebhookDelivery = newError(1025, "WebhookDeliveryFailed")
+	//ErrDuplicateIdempotencyKey 幂等键已经用过,没有再次发起交易,data中是原来那笔交易的状态
+	ErrDuplicateIdempotencyKey = newError(1026, "DuplicateIdempotencyKey")
+	//ErrMonitoringServiceNotConfigured 没有配置第三方监控服务,不能委托
+	ErrMonitoringServiceNotConfigured = newError(1027, "MonitoringServiceNotConfigured")
+	//ErrMonitoringDelegation 监控服务拒绝了委托或者请求失败
+	ErrMonitoringDelegation = newError(1028, "MonitoringDelegationFailed")
+	//ErrInsufficientTokenBalance 账户的代币余额不够存款
+	ErrInsufficientTokenBalance = newError(1029, "InsufficientTokenBalance")
+	//ErrInsufficientAllowance 授权给通道合约的额度不够,并且approve失败
+	ErrInsufficientAllowance = newError(1030, "InsufficientAllowance")
 	/*
 		以太坊报公链节点报的错误
 
@@ -233,6 +249,14 @@ var (
 	ErrRejectTransferBecausePayerChannelClosed = newError(3007, "payer's channel already closed ,reject mediated transfer")
 	// ErrChannelNoEnoughBalance 通道余额不足
 	ErrChannelNoEnoughBalance = newError(3008, "no enough balance")
+	// ErrPartnerNotAllowed 通道伙伴在黑名单中或者不在白名单中
+	ErrPartnerNotAllowed = newError(3009, "partner not allowed")
+	// ErrTokenCircuitBreakerTripped token网络异常太多已经熔断,运营方手工恢复之前不能发起新交易
+	ErrTokenCircuitBreakerTripped = newError(3010, "transfers of token are paused by circuit breaker")
+	// ErrTransferRejectedByTarget 接收方拒绝了这笔交易,换路由也不会成功
+	ErrTransferRejectedByTarget = newError(3011, "transfer rejected by target")
+	// ErrRejectTransferBecauseInitiatorTooManyTransfers 同一个发起方通过本节点中转的交易太多,暂时拒绝交易
+	ErrRejectTransferBecauseInitiatorTooManyTransfers = newError(3012, "initiator has too many mediated transfers, reject mediated transfer for a while")
 	/*ErrPFS PFS Error
 	向PFS发起请求错误
 	*/
@@ -301,6 +325,8 @@ var (
 	  settle timeout
 	*/
 	ErrChannelInvalidSttleTimeout = newError(5026, "ErrInvalidSettleTimeout")
+	//ErrChannelDepositLimit 存款以后通道双方的存款之和超过了合约能够处理的上限,data中是还能存入的最大金额
+	ErrChannelDepositLimit = newError(5027, "ErrChannelDepositLimit")
 	/*
 		Transport error
 	*/
@@ -20,5 +20,6 @@ func Start(API *photon.API, config *params.Config) {
 	v1.Config = config
 	v1.HTTPUsername = config.HTTPUsername
 	v1.HTTPPassword = config.HTTPPassword
+	v1.HTTPAPIKey = config.HTTPAPIKey
 	v1.Start()
 }
@@ -0,0 +1,43 @@
+package v1
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+//apiKeyHeader 调用接口时携带API key的http头,也可以使用`Authorization: Bearer <key>`
+const apiKeyHeader = "X-API-Key"
+
+/*
+apiKeyMiddleware 要求每个请求都携带正确的API key,方便其他语言的程序在不保存用户名密码的情况下调用接口.
+和http-username/http-password同时设置时两种认证都要通过
+*/
+type apiKeyMiddleware struct {
+	key string
+}
+
+func requestAPIKey(r *rest.Request) string {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		return key
+	}
+	auth := r.Header.Get("Authorization")
+	if strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return ""
+}
+
+// MiddlewareFunc makes apiKeyMiddleware implement the Middleware interface.
+func (mw *apiKeyMiddleware) MiddlewareFunc(handler rest.HandlerFunc) rest.HandlerFunc {
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		key := requestAPIKey(r)
+		if subtle.ConstantTimeCompare([]byte(key), []byte(mw.key)) != 1 {
+			rest.Error(w, "invalid api key", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
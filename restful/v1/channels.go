@@ -8,12 +8,15 @@ import (
 	"math/big"
 
 	"fmt"
+	"strconv"
 
+	photon "github.com/SmartMeshFoundation/Photon"
 	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
 	"github.com/SmartMeshFoundation/Photon/log"
 	"github.com/SmartMeshFoundation/Photon/utils"
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 )
 
 /*
@@ -32,6 +35,8 @@ type ChannelData struct {
 	StateString         string            `json:"state_string"`
 	SettleTimeout       int               `json:"settle_timeout"`
 	RevealTimeout       int               `json:"reveal_timeout"`
+	//只有关闭的通道才有
+	SettleCountdown *channeltype.SettleCountdown `json:"settle_countdown,omitempty"`
 }
 
 /*
@@ -62,6 +67,7 @@ func GetChannelList(w rest.ResponseWriter, r *rest.Request) {
 				RevealTimeout:       c.RevealTimeout,
 				LockedAmount:        c.OurAmountLocked(),
 				PartnerLockedAmount: c.PartnerAmountLocked(),
+				SettleCountdown:     API.GetSettleCountdown(c),
 			}
 			datas = append(datas, d)
 		}
@@ -115,11 +121,43 @@ func SpecifiedChannel(w rest.ResponseWriter, r *rest.Request) {
 		resp = dto.NewExceptionAPIResponse(err)
 	} else {
 		d := channeltype.ChannelSerialization2ChannelDataDetail(c)
+		d.SettleCountdown = API.GetSettleCountdown(c)
 		resp = dto.NewSuccessAPIResponse(d)
 	}
 	return
 }
 
+/*
+GetChannelEvents is the api of /api/1/channels/:channel/events?from_block=&to_block=
+returns every balance proof exchange and on-chain event of the channel, ordered by block number
+*/
+func GetChannelEvents(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> GetChannelEvents ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	channelIdentifier := common.HexToHash(r.PathParam("channel"))
+	var fromBlock, toBlock int64
+	var err error
+	if s := r.URL.Query().Get("from_block"); s != "" {
+		fromBlock, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+			return
+		}
+	}
+	if s := r.URL.Query().Get("to_block"); s != "" {
+		toBlock, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+			return
+		}
+	}
+	events, err := API.GetChannelEvents(channelIdentifier, fromBlock, toBlock)
+	resp = dto.NewAPIResponse(err, events)
+}
+
 /*
 depositReq 用户存款请求
 */
@@ -192,6 +230,74 @@ func Deposit(w rest.ResponseWriter, r *rest.Request) {
 	return
 }
 
+//batchDepositReq 批量开通道或者存款,所有通道使用同一种token
+type batchDepositReq struct {
+	TokenAddress  string                     `json:"token_address"`
+	SettleTimeout int                        `json:"settle_timeout"` //只在NewChannel为true时使用
+	NewChannel    bool                       `json:"new_channel"`
+	Channels      []*photon.BatchChannelItem `json:"channels"`
+}
+
+/*
+BatchDeposit open or deposit to many channels in one call,
+it returns the result of every channel.
+*/
+func BatchDeposit(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> BatchDeposit ,resp=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	req := &batchDepositReq{}
+	err := r.DecodeJsonPayload(req)
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	tokenAddr, err := utils.HexToAddress(req.TokenAddress)
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	var results []*photon.BatchChannelResult
+	if req.NewChannel {
+		results, err = API.BatchOpen(tokenAddr, req.SettleTimeout, req.Channels)
+	} else {
+		results, err = API.BatchDeposit(tokenAddr, req.Channels)
+	}
+	resp = dto.NewAPIResponse(err, results)
+}
+
+/*
+DepositDryRun simulates a deposit with the same payload as Deposit, no transaction is sent
+*/
+func DepositDryRun(w rest.ResponseWriter, r *rest.Request) {
+	var err error
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> DepositDryRun ,resp=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	req := &depositReq{}
+	err = r.DecodeJsonPayload(req)
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	partnerAddr, err := utils.HexToAddress(req.PartnerAddrses)
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	tokenAddr, err := utils.HexToAddress(req.TokenAddress)
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	result, err := API.DepositDryRun(tokenAddr, partnerAddr, req.SettleTimeout, req.Balance, req.NewChannel)
+	resp = dto.NewAPIResponse(err, result)
+}
+
 /*
 CloseSettleChannel can do the following jobs:
 close channel
@@ -363,3 +469,89 @@ func BalanceUpdateForPFS(w rest.ResponseWriter, r *rest.Request) {
 	result, err := API.BalanceProofForPFS(channelIdentifier)
 	resp = dto.NewAPIResponse(err, result)
 }
+
+/*
+PrepareOfflineTxBundle 为已关闭的通道生成争议期内需要离线签名的交易
+*/
+func PrepareOfflineTxBundle(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> PrepareOfflineTxBundle ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	channelIdentifier := common.HexToHash(r.PathParam("channel"))
+	if channelIdentifier == utils.EmptyHash {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError)
+		return
+	}
+	b, err := API.PrepareOfflineTxBundle(channelIdentifier)
+	resp = dto.NewAPIResponse(err, b)
+}
+
+//GetOfflineTxBundle query offline txs of a channel and their status
+func GetOfflineTxBundle(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> GetOfflineTxBundle ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	channelIdentifier := common.HexToHash(r.PathParam("channel"))
+	b, err := API.GetOfflineTxBundle(channelIdentifier)
+	resp = dto.NewAPIResponse(err, b)
+}
+
+/*
+ExportChannelState 导出加密的通道状态,用于迁移到新机器
+*/
+func ExportChannelState(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> ExportChannelState ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	data, err := API.ExportChannelState()
+	resp = dto.NewAPIResponse(err, hexutil.Bytes(data))
+}
+
+/*
+ImportChannelState 导入同一个账户在其他机器上导出的通道状态
+*/
+func ImportChannelState(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> ImportChannelState ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	req := &struct {
+		Data hexutil.Bytes `json:"data"`
+	}{}
+	err := r.DecodeJsonPayload(req)
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	result, err := API.ImportChannelState(req.Data)
+	resp = dto.NewAPIResponse(err, result)
+}
+
+/*
+SubmitOfflineTxBundle 提交签名后的交易,顺序与生成时一致
+*/
+func SubmitOfflineTxBundle(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> SubmitOfflineTxBundle ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	channelIdentifier := common.HexToHash(r.PathParam("channel"))
+	req := &struct {
+		SignedTxs []hexutil.Bytes `json:"signed_txs"`
+	}{}
+	err := r.DecodeJsonPayload(req)
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	b, err := API.SubmitOfflineTxBundle(channelIdentifier, req.SignedTxs)
+	resp = dto.NewAPIResponse(err, b)
+}
@@ -0,0 +1,41 @@
+package v1
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/dto"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+/*
+GetCircuitBreakers returns the circuit breaker of every token which has anomalies recently
+*/
+func GetCircuitBreakers(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> GetCircuitBreakers ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	resp = dto.NewSuccessAPIResponse(API.GetCircuitBreakers())
+}
+
+/*
+ResetCircuitBreaker resumes new transfers of a token after the operator has checked the anomalies
+*/
+func ResetCircuitBreaker(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> ResetCircuitBreaker ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	tokenAddr, err := utils.HexToAddress(r.PathParam("token"))
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	err = API.ResetCircuitBreaker(tokenAddr)
+	resp = dto.NewAPIResponse(err, nil)
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/SmartMeshFoundation/Photon/log"
 	"github.com/SmartMeshFoundation/Photon/network/netshare"
+	"github.com/SmartMeshFoundation/Photon/params"
 	"github.com/SmartMeshFoundation/Photon/utils"
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/ethereum/go-ethereum/common"
@@ -165,3 +166,123 @@ func RegisterSecretOnChain(w rest.ResponseWriter, r *rest.Request) {
 	err := API.RegisterSecretOnChain(secret)
 	resp = dto.NewAPIResponse(err, "ok")
 }
+
+/*
+Ping check the reachability of a node layer by layer: presence, transport, protocol and channels.
+*/
+func Ping(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> Ping ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	addrstr := r.PathParam("addr")
+	addr, err := utils.HexToAddress(addrstr)
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	result, err := API.Ping(addr, params.DefaultPingTimeout)
+	resp = dto.NewAPIResponse(err, result)
+}
+
+/*
+GetRouteStatistics returns success and failure counts of transfers sent through every next hop,
+hops that fail often are tried last.
+*/
+func GetRouteStatistics(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> GetRouteStatistics ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	resp = dto.NewSuccessAPIResponse(API.GetRouteStatistics())
+}
+
+/*
+ResetRouteStatistics clears route statistics, hops excluded for repeated timeouts are used again.
+query parameters `token` and `hop` limit which statistics are cleared, all are cleared if both are omitted.
+*/
+func ResetRouteStatistics(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> ResetRouteStatistics ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	var token, hop common.Address
+	var err error
+	if s := r.URL.Query().Get("token"); s != "" {
+		token, err = utils.HexToAddress(s)
+		if err != nil {
+			resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+			return
+		}
+	}
+	if s := r.URL.Query().Get("hop"); s != "" {
+		hop, err = utils.HexToAddress(s)
+		if err != nil {
+			resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+			return
+		}
+	}
+	API.ResetRouteStatistics(token, hop)
+	resp = dto.NewSuccessAPIResponse(nil)
+}
+
+/*
+GetPeerStatistics returns protocol violations of every peer, greylisted peers are excluded from routing.
+*/
+func GetPeerStatistics(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> GetPeerStatistics ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	resp = dto.NewSuccessAPIResponse(API.GetPeerStatistics())
+}
+
+// GetPeersPresence :
+func GetPeersPresence(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> GetPeersPresence ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	resp = dto.NewSuccessAPIResponse(API.GetPeersPresence())
+}
+
+// GetRateLimitStats :
+func GetRateLimitStats(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> GetRateLimitStats ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	resp = dto.NewSuccessAPIResponse(API.GetRateLimitStats())
+}
+
+// GetPeerPresence :
+func GetPeerPresence(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> GetPeerPresence ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	addr, err := utils.HexToAddress(r.PathParam("addr"))
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	pp, err := API.GetPeerPresence(addr)
+	resp = dto.NewAPIResponse(err, pp)
+}
+
+// GetBlockCallbackStats :
+func GetBlockCallbackStats(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> GetBlockCallbackStats ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	resp = dto.NewSuccessAPIResponse(API.GetBlockCallbackStats())
+}
@@ -32,6 +32,9 @@ var HTTPUsername = ""
 // HTTPPassword is password needed when call http api
 var HTTPPassword = ""
 
+// HTTPAPIKey is the api key needed when call http api
+var HTTPAPIKey = ""
+
 //QuitChain stop http server
 var QuitChain chan struct{}
 
@@ -55,7 +58,10 @@ func Start() {
 			},
 		})
 	}
-	router, err := rest.MakeRouter(
+	if HTTPAPIKey != "" {
+		api.Use(&apiKeyMiddleware{key: HTTPAPIKey})
+	}
+	routes := []*rest.Route{
 
 		/*
 			prepare update
@@ -67,8 +73,14 @@ func Start() {
 		rest.Get("/api/1/querysenttransfer", GetSentTransferDetails),
 		rest.Get("/api/1/queryreceivedtransfer", GetReceivedTransfers),
 		rest.Post("/api/1/transfers/:token/:target", Transfers),
+		rest.Post("/api/1/split_transfers/:token/:target", SplitTransfers),
 		rest.Get("/api/1/transferstatus/:token/:locksecrethash", GetSentTransferDetail),
+		rest.Get("/api/1/transferlifecycle/:locksecrethash", GetTransferStatus),
+		rest.Get("/api/1/payments/:payment_id", GetPayment),
+		rest.Get("/api/1/transfer_history", GetTransferHistory),
 		rest.Post("/api/1/transfercancel/:token/:locksecrethash", CancelTransfer),
+		rest.Get("/api/1/circuit_breakers", GetCircuitBreakers),
+		rest.Post("/api/1/circuit_breakers/:token/reset", ResetCircuitBreaker),
 		/*
 			transfer with specified secret
 		*/
@@ -79,6 +91,9 @@ func Start() {
 			token swap
 		*/
 		rest.Put("/api/1/token_swaps/:target/:locksecrethash", TokenSwap),
+		rest.Get("/api/1/swaps", GetSwapOrders),
+		rest.Post("/api/1/swaps/:taker", InitiateSwap),
+		rest.Post("/api/1/swap_response/:locksecrethash", RespondSwap),
 		/*
 			accounts
 		*/
@@ -90,6 +105,7 @@ func Start() {
 			channels
 		*/
 		rest.Get("/api/1/channels/:channel", SpecifiedChannel),
+		rest.Get("/api/1/channels/:channel/events", GetChannelEvents),
 		rest.Get("/api/1/channels", GetChannelList),
 		rest.Patch("/api/1/channels/:channel", CloseSettleChannel),
 		rest.Get("/api/1/thirdparty/:channel/:3rd", ChannelFor3rdParty),
@@ -98,11 +114,15 @@ func Start() {
 			Deposit
 		*/
 		rest.Put("/api/1/deposit", Deposit),
+		rest.Post("/api/1/deposit/dryrun", DepositDryRun),
+		rest.Put("/api/1/deposit/batch", BatchDeposit),
 		/*
 			tokens
 		*/
 		rest.Get("/api/1/tokens", Tokens),
 		rest.Get("/api/1/tokens/:token/partners", TokenPartners),
+		rest.Get("/api/1/tokens/:token", TokenNetwork),
+		rest.Put("/api/1/tokens/:token", RegisterToken),
 		/*
 			contract call tx
 		*/
@@ -111,6 +131,7 @@ func Start() {
 			utils
 		*/
 		rest.Get("/api/1/path/:target_address/:token/:amount", FindPath),
+		rest.Get("/api/1/transfer_estimate/:token/:target/:amount", EstimateTransfer),
 		rest.Get("/api/1/secret", GetRandomSecret), // api to provide random secret and lockSecretHash pair
 		rest.Get("/api/1/version", GetBuildInfo),
 
@@ -121,6 +142,79 @@ func Start() {
 		rest.Post("/api/1/fee_policy", SetFeePolicy),
 		rest.Get("/api/1/fee", GetAllFeeChargeRecord),
 
+		/*
+			partner blacklist and whitelist
+		*/
+		rest.Get("/api/1/partner_filter", GetPartnerFilter),
+		rest.Post("/api/1/partner_filter", SetPartnerFilter),
+
+		/*
+			node advertisement
+		*/
+		rest.Get("/api/1/node_advertisement", GetNodeAdvertisement),
+		rest.Get("/api/1/node_advertisement/:addr", GetNodeAdvertisement),
+		rest.Post("/api/1/node_advertisement", SetNodeAdvertisement),
+
+		/*
+			long operations
+		*/
+		rest.Get("/api/1/operations/:id", GetOperation),
+		rest.Post("/api/1/operations/:id/cancel", CancelOperation),
+		rest.Post("/api/1/selftest/:token", SelfTest),
+
+		/*
+			notifications pushed over websocket
+		*/
+		rest.Get("/api/1/notifications", Notifications),
+		rest.Get("/api/1/notifications/history", NotificationHistory),
+
+		/*
+			delegate balance proofs to monitoring service
+		*/
+		rest.Get("/api/1/monitoring/delegations", GetMonitoringDelegations),
+		rest.Post("/api/1/monitoring/delegations", DelegateMonitoring),
+		rest.Post("/api/1/monitoring/delegations/:channel", DelegateMonitoring),
+
+		/*
+			webhook notifications that failed to deliver
+		*/
+		rest.Get("/api/1/webhook/dead_letters", GetWebhookDeadLetters),
+		rest.Post("/api/1/webhook/dead_letters/:id/redeliver", RedeliverWebhookDeadLetter),
+		rest.Delete("/api/1/webhook/dead_letters/:id", RemoveWebhookDeadLetter),
+
+		/*
+			encrypted state backup of another node
+		*/
+		rest.Get("/api/1/state_backup", GetPeerStateBackups),
+		rest.Get("/api/1/state_backup/:owner", GetPeerStateBackup),
+
+		/*
+			anonymized network statistics
+		*/
+		rest.Get("/api/1/network_stats", GetNetworkStats),
+
+		/*
+			ask partner to deposit
+		*/
+		rest.Get("/api/1/inbound_capacity", GetInboundCapacityRequests),
+		rest.Post("/api/1/inbound_capacity/:token/:partner", RequestInboundCapacity),
+		rest.Post("/api/1/inbound_capacity_response/:id", RespondInboundCapacity),
+
+		/*
+			transfers to this node waiting for approval
+		*/
+		rest.Get("/api/1/approvals", GetPendingApprovals),
+		rest.Post("/api/1/approvals/:token/:locksecrethash", ApproveTransfer),
+
+		/*
+			dispute transactions signed offline
+		*/
+		rest.Get("/api/1/offline_txs/:channel", GetOfflineTxBundle),
+		rest.Post("/api/1/offline_txs/:channel/prepare", PrepareOfflineTxBundle),
+		rest.Post("/api/1/offline_txs/:channel/signed", SubmitOfflineTxBundle),
+		rest.Post("/api/1/channel_state/export", ExportChannelState),
+		rest.Post("/api/1/channel_state/import", ImportChannelState),
+
 		/*
 			income
 		*/
@@ -167,12 +261,21 @@ func Start() {
 		rest.Get("/api/1/debug/force-unlock/:channel/:secret", ForceUnlock),
 		rest.Get("/api/1/debug/register-secret-onchain/:secret", RegisterSecretOnChain),
 		rest.Get("/api/1/debug/pfs/:channel", BalanceUpdateForPFS),
+		rest.Get("/api/1/debug/ping/:addr", Ping),
+		rest.Get("/api/1/debug/peer-statistics", GetPeerStatistics),
+		rest.Get("/api/1/debug/peer-presence", GetPeersPresence),
+		rest.Get("/api/1/debug/peer-presence/:addr", GetPeerPresence),
+		rest.Get("/api/1/debug/rate-limit", GetRateLimitStats),
+		rest.Get("/api/1/debug/route-statistics", GetRouteStatistics),
+		rest.Delete("/api/1/debug/route-statistics", ResetRouteStatistics),
+		rest.Get("/api/1/debug/block-callbacks", GetBlockCallbackStats),
 		rest.Post("/api/1/debug/notify_network_down", NotifyNetworkDown), // notify photon network down
 		rest.Get("/api/1/debug/shutdown", func(writer rest.ResponseWriter, request *rest.Request) {
 			API.Photon.Stop()
 			utils.SystemExit(0)
 		}),
-	)
+	}
+	router, err := rest.MakeRouter(filterRoutes(Config.APIProfile, routes)...)
 	if err != nil {
 		log.Crit(fmt.Sprintf("maker router :%s", err))
 	}
@@ -0,0 +1,152 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/SmartMeshFoundation/Photon/dto"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/notify"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ethereum/go-ethereum/common"
+	"golang.org/x/net/websocket"
+)
+
+//notificationsHello websocket连接建立以后的第一条消息
+type notificationsHello struct {
+	LastSeq  uint64 `json:"last_seq"`
+	Complete bool   `json:"complete"` //false表示cursor之后的通知有一部分已经丢失,需要通过其他接口查询
+}
+
+//splitQuery 逗号分隔的参数,空字符串返回nil
+func splitQuery(r *rest.Request, name string) []string {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
+
+func parseNotificationFilter(r *rest.Request) (filter notify.Filter, cursor uint64, err error) {
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		cursor, err = strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return
+		}
+	}
+	for _, s := range splitQuery(r, "tokens") {
+		var token common.Address
+		token, err = utils.HexToAddress(s)
+		if err != nil {
+			return
+		}
+		filter.Tokens = append(filter.Tokens, token)
+	}
+	for _, s := range splitQuery(r, "channels") {
+		filter.Channels = append(filter.Channels, common.HexToHash(s))
+	}
+	for _, s := range splitQuery(r, "info_types") {
+		var t int
+		t, err = strconv.Atoi(s)
+		if err != nil {
+			return
+		}
+		filter.InfoTypes = append(filter.InfoTypes, t)
+	}
+	for _, s := range splitQuery(r, "event_codes") {
+		var c int
+		c, err = strconv.Atoi(s)
+		if err != nil {
+			return
+		}
+		filter.EventCodes = append(filter.EventCodes, notify.EventCode(c))
+	}
+	return
+}
+
+/*
+Notifications websocket推送SentTransfer,ReceivedTransfer以及其他通知,
+客户端通过cursor指定上次收到的最大seq,重连时补发之后的通知
+*/
+func Notifications(w rest.ResponseWriter, r *rest.Request) {
+	filter, cursor, err := parseNotificationFilter(r)
+	if err != nil {
+		resp := dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		log.Trace(fmt.Sprintf("Restful Api Call ----> Notifications ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+		return
+	}
+	handler := API.Photon.NotifyHandler
+	server := websocket.Server{Handler: func(ws *websocket.Conn) {
+		defer ws.Close()
+		sub, complete := handler.SubscribeFrom(filter, cursor)
+		defer handler.Unsubscribe(sub)
+		log.Trace(fmt.Sprintf("notification subscriber %d connected from %s,cursor=%d", sub.ID, r.RemoteAddr, cursor))
+		err := websocket.JSON.Send(ws, &notificationsHello{
+			LastSeq:  handler.LastSeq(),
+			Complete: complete,
+		})
+		if err != nil {
+			return
+		}
+		//客户端不会发送消息,读取只是为了发现连接已经断开
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			var msg string
+			for websocket.Message.Receive(ws, &msg) == nil {
+			}
+		}()
+		for {
+			select {
+			case record, ok := <-sub.Records():
+				if !ok {
+					return
+				}
+				err = websocket.JSON.Send(ws, record)
+				if err != nil {
+					log.Trace(fmt.Sprintf("notification subscriber %d send err %s", sub.ID, err))
+					return
+				}
+			case <-closed:
+				log.Trace(fmt.Sprintf("notification subscriber %d disconnected", sub.ID))
+				return
+			}
+		}
+	}}
+	server.ServeHTTP(w.(http.ResponseWriter), r.Request)
+}
+
+//defaultNotificationHistoryLimit 没有指定limit时最多返回的通知条数
+const defaultNotificationHistoryLimit = 100
+
+/*
+NotificationHistory 查询保存在数据库中的通知,参数和Notifications相同,
+另外可以通过limit指定最多返回的条数,客户端用返回的最后一条的seq作为下一次的cursor
+*/
+func NotificationHistory(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> NotificationHistory ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	filter, cursor, err := parseNotificationFilter(r)
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	limit := defaultNotificationHistoryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.Append("limit must be a positive integer"))
+			return
+		}
+	}
+	records, err := API.GetNotifications(cursor, filter, limit)
+	resp = dto.NewAPIResponse(err, records)
+}
@@ -2,6 +2,7 @@ package v1
 
 import (
 	"fmt"
+	"math/big"
 
 	"github.com/SmartMeshFoundation/Photon/rerr"
 
@@ -11,6 +12,7 @@ import (
 	"github.com/SmartMeshFoundation/Photon/log"
 	"github.com/SmartMeshFoundation/Photon/models"
 	"github.com/SmartMeshFoundation/Photon/network"
+	"github.com/SmartMeshFoundation/Photon/params"
 	"github.com/SmartMeshFoundation/Photon/utils"
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/ethereum/go-ethereum/common"
@@ -116,6 +118,332 @@ func SetFeePolicy(w rest.ResponseWriter, r *rest.Request) {
 	resp = dto.NewAPIResponse(err, "ok")
 }
 
+// GetNodeAdvertisement :
+func GetNodeAdvertisement(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> GetNodeAdvertisement ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	nodeAddress := API.Photon.NodeAddress
+	if addr := r.PathParam("addr"); addr != "" {
+		var err error
+		nodeAddress, err = utils.HexToAddress(addr)
+		if err != nil {
+			resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+			return
+		}
+	}
+	na, err := API.GetNodeAdvertisement(nodeAddress, params.DefaultQueryNodeAdvertisementTimeout)
+	resp = dto.NewAPIResponse(err, na)
+}
+
+// SetNodeAdvertisement :
+func SetNodeAdvertisement(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> SetNodeAdvertisement ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	req := &models.NodeAdvertisement{}
+	err := r.DecodeJsonPayload(req)
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	na, err := API.SetNodeAdvertisement(req)
+	resp = dto.NewAPIResponse(err, na)
+}
+
+// GetOperation :
+func GetOperation(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> GetOperation ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	op, err := API.GetOperation(r.PathParam("id"))
+	resp = dto.NewAPIResponse(err, op)
+}
+
+// CancelOperation :
+func CancelOperation(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> CancelOperation ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	err := API.CancelOperation(r.PathParam("id"))
+	resp = dto.NewAPIResponse(err, nil)
+}
+
+// GetMonitoringDelegations :
+func GetMonitoringDelegations(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> GetMonitoringDelegations ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	ds, err := API.GetMonitoringDelegations()
+	resp = dto.NewAPIResponse(err, ds)
+}
+
+/*
+DelegateMonitoring 委托通道给监控服务,没有指定通道时委托所有打开的通道
+/api/1/monitoring/delegations
+/api/1/monitoring/delegations/:channel
+*/
+func DelegateMonitoring(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> DelegateMonitoring ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	ch := r.PathParam("channel")
+	if ch == "" {
+		ds, err := API.DelegateAllMonitoring()
+		resp = dto.NewAPIResponse(err, ds)
+		return
+	}
+	channelIdentifier := common.HexToHash(ch)
+	if channelIdentifier == utils.EmptyHash {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError)
+		return
+	}
+	d, err := API.DelegateMonitoring(channelIdentifier)
+	resp = dto.NewAPIResponse(err, d)
+}
+
+// GetWebhookDeadLetters :
+func GetWebhookDeadLetters(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> GetWebhookDeadLetters ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	dls, err := API.GetWebhookDeadLetters()
+	resp = dto.NewAPIResponse(err, dls)
+}
+
+// RedeliverWebhookDeadLetter :
+func RedeliverWebhookDeadLetter(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> RedeliverWebhookDeadLetter ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	err := API.RedeliverWebhookDeadLetter(r.PathParam("id"))
+	resp = dto.NewAPIResponse(err, nil)
+}
+
+// RemoveWebhookDeadLetter :
+func RemoveWebhookDeadLetter(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> RemoveWebhookDeadLetter ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	err := API.RemoveWebhookDeadLetter(r.PathParam("id"))
+	resp = dto.NewAPIResponse(err, nil)
+}
+
+// GetPeerStateBackups :
+func GetPeerStateBackups(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> GetPeerStateBackups ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	bs, err := API.GetPeerStateBackups()
+	resp = dto.NewAPIResponse(err, bs)
+}
+
+// GetNetworkStats :
+func GetNetworkStats(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> GetNetworkStats ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	s, err := API.GetNetworkStats()
+	resp = dto.NewAPIResponse(err, s)
+}
+
+// GetPeerStateBackup :
+func GetPeerStateBackup(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> GetPeerStateBackup ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	owner, err := utils.HexToAddress(r.PathParam("owner"))
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	b, err := API.GetPeerStateBackup(owner)
+	resp = dto.NewAPIResponse(err, b)
+}
+
+// GetInboundCapacityRequests :
+func GetInboundCapacityRequests(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> GetInboundCapacityRequests ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	resp = dto.NewSuccessAPIResponse(API.GetInboundCapacityRequests())
+}
+
+// RequestInboundCapacity :
+func RequestInboundCapacity(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> RequestInboundCapacity ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	token, err := utils.HexToAddress(r.PathParam("token"))
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	partner, err := utils.HexToAddress(r.PathParam("partner"))
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	req := &struct {
+		Amount   *big.Int `json:"amount"`
+		FeeOffer *big.Int `json:"fee_offer"`
+		Reason   string   `json:"reason"`
+	}{}
+	err = r.DecodeJsonPayload(req)
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	icr, err := API.RequestInboundCapacity(token, partner, req.Amount, req.FeeOffer, req.Reason)
+	resp = dto.NewAPIResponse(err, icr)
+}
+
+// RespondInboundCapacity :
+func RespondInboundCapacity(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> RespondInboundCapacity ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	id := common.HexToHash(r.PathParam("id"))
+	req := &struct {
+		Accept bool   `json:"accept"`
+		Reason string `json:"reason"`
+	}{}
+	err := r.DecodeJsonPayload(req)
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	icr, err := API.RespondInboundCapacity(id, req.Accept, req.Reason)
+	resp = dto.NewAPIResponse(err, icr)
+}
+
+// GetPendingApprovals :
+func GetPendingApprovals(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> GetPendingApprovals ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	transfers, err := API.GetPendingApprovals()
+	resp = dto.NewAPIResponse(err, transfers)
+}
+
+// ApproveTransfer :
+func ApproveTransfer(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> ApproveTransfer ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	token, err := utils.HexToAddress(r.PathParam("token"))
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	lockSecretHash := common.HexToHash(r.PathParam("locksecrethash"))
+	req := &struct {
+		Approve bool   `json:"approve"`
+		Reason  string `json:"reason"`
+	}{}
+	err = r.DecodeJsonPayload(req)
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	t, err := API.ApproveTransfer(token, lockSecretHash, req.Approve, req.Reason)
+	resp = dto.NewAPIResponse(err, t)
+}
+
+/*
+SelfTest 和回声节点完成一次开通道,往返支付和合作关闭通道,通过返回的操作ID查询每个阶段的结果
+*/
+func SelfTest(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> SelfTest ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	token, err := utils.HexToAddress(r.PathParam("token"))
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	req := &struct {
+		EchoNode common.Address `json:"echo_node"`
+		Amount   *big.Int       `json:"amount"`
+	}{}
+	if r.ContentLength > 0 {
+		err = r.DecodeJsonPayload(req)
+		if err != nil {
+			resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+			return
+		}
+	}
+	result, err := API.SelfTest(token, req.EchoNode, req.Amount)
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(err)
+		return
+	}
+	resp = dto.NewSuccessAPIResponse(map[string]string{"operation_id": result.ID})
+}
+
+// GetPartnerFilter :
+func GetPartnerFilter(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> GetPartnerFilter ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	resp = dto.NewSuccessAPIResponse(API.GetPartnerFilter())
+}
+
+// SetPartnerFilter :
+func SetPartnerFilter(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> SetPartnerFilter ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	req := &models.PartnerFilter{}
+	err := r.DecodeJsonPayload(req)
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	err = API.SetPartnerFilter(req)
+	resp = dto.NewAPIResponse(err, "ok")
+}
+
 // FindPath :
 func FindPath(w rest.ResponseWriter, r *rest.Request) {
 	var resp *dto.APIResponse
@@ -146,6 +474,35 @@ func FindPath(w rest.ResponseWriter, r *rest.Request) {
 
 }
 
+/*
+EstimateTransfer is api of /api/1/transfer_estimate/:token/:target/:amount
+returns candidate routes with hops and fees, nothing is sent
+*/
+func EstimateTransfer(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> EstimateTransfer ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	tokenAddress, err := utils.HexToAddress(r.PathParam("token"))
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	targetAddress, err := utils.HexToAddress(r.PathParam("target"))
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	amount, ok := math.ParseBig256(r.PathParam("amount"))
+	if !ok {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError)
+		return
+	}
+	result, err := API.EstimateTransfer(tokenAddress, amount, targetAddress)
+	resp = dto.NewAPIResponse(err, result)
+}
+
 // GetAllFeeChargeRecord :
 func GetAllFeeChargeRecord(w rest.ResponseWriter, r *rest.Request) {
 	var resp *dto.APIResponse
@@ -0,0 +1,73 @@
+package v1
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+/*
+mediatorRoutes 中转节点模式下暴露的接口,只有查询和收费配置.
+发起交易,存款,关闭通道,取现以及debug中会修改状态的接口都不暴露
+*/
+var mediatorRoutes = map[string]bool{
+	"GET /api/1/querysenttransfer":                     true,
+	"GET /api/1/queryreceivedtransfer":                 true,
+	"GET /api/1/transferstatus/:token/:locksecrethash": true,
+	"GET /api/1/transferlifecycle/:locksecrethash":     true,
+	"GET /api/1/payments/:payment_id":                  true,
+	"GET /api/1/transfer_history":                      true,
+	"GET /api/1/address":                               true,
+	"GET /api/1/balance":                               true,
+	"GET /api/1/balance/":                              true,
+	"GET /api/1/balance/:tokenaddress":                 true,
+	"GET /api/1/channels/:channel":                     true,
+	"GET /api/1/channels/:channel/events":              true,
+	"GET /api/1/channels":                              true,
+	"GET /api/1/tokens":                                true,
+	"GET /api/1/tokens/:token/partners":                true,
+	"GET /api/1/tokens/:token":                         true,
+	"POST /api/1/tx/query":                             true,
+	"GET /api/1/version":                               true,
+	"GET /api/1/fee_policy":                            true,
+	"POST /api/1/fee_policy":                           true,
+	"GET /api/1/fee":                                   true,
+	"GET /api/1/partner_filter":                        true,
+	"GET /api/1/node_advertisement":                    true,
+	"GET /api/1/node_advertisement/:addr":              true,
+	"GET /api/1/operations/:id":                        true,
+	"GET /api/1/inbound_capacity":                      true,
+	"GET /api/1/notifications":                         true,
+	"GET /api/1/notifications/history":                 true,
+	"GET /api/1/webhook/dead_letters":                  true,
+	"POST /api/1/income/details":                       true,
+	"POST /api/1/income/days":                          true,
+	"GET /api/1/debug/system-status":                   true,
+	"GET /api/1/debug/ethstatus":                       true,
+	"GET /api/1/debug/peer-statistics":                 true,
+	"GET /api/1/debug/peer-presence":                   true,
+	"GET /api/1/debug/peer-presence/:addr":             true,
+	"GET /api/1/debug/rate-limit":                      true,
+	"GET /api/1/debug/route-statistics":                true,
+	"GET /api/1/debug/block-callbacks":                 true,
+}
+
+/*
+filterRoutes 按照部署模式过滤接口,没有暴露的接口不会注册到路由中,访问时返回404
+*/
+func filterRoutes(profile string, routes []*rest.Route) []*rest.Route {
+	if profile != params.APIProfileMediator {
+		return routes
+	}
+	var exposed []*rest.Route
+	for _, r := range routes {
+		if mediatorRoutes[fmt.Sprintf("%s %s", strings.ToUpper(r.HttpMethod), r.PathExp)] {
+			exposed = append(exposed, r)
+		}
+	}
+	log.Info(fmt.Sprintf("api profile %s, %d of %d api exposed", profile, len(exposed), len(routes)))
+	return exposed
+}
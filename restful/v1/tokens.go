@@ -9,6 +9,7 @@ import (
 	"github.com/SmartMeshFoundation/Photon/log"
 	"github.com/SmartMeshFoundation/Photon/utils"
 	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ethereum/go-ethereum/common"
 )
 
 /*
@@ -69,3 +70,47 @@ func TokenPartners(w rest.ResponseWriter, r *rest.Request) {
 	}
 	resp = dto.NewSuccessAPIResponse(datas)
 }
+
+//tokenNetworkResponse token和管理它的通道的合约
+type tokenNetworkResponse struct {
+	TokenAddress        common.Address `json:"token_address"`
+	TokenNetworkAddress common.Address `json:"token_network_address"`
+}
+
+/*
+TokenNetwork is api of /api/1/tokens/:token
+returns the contract of this token's channels
+*/
+func TokenNetwork(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> TokenNetwork ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	tokenAddr, err := utils.HexToAddress(r.PathParam("token"))
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	tokenNetwork, err := API.GetTokenNetworkAddress(tokenAddr)
+	resp = dto.NewAPIResponse(err, &tokenNetworkResponse{tokenAddr, tokenNetwork})
+}
+
+/*
+RegisterToken is api of /api/1/tokens/:token
+start to use a token which is registered on chain
+*/
+func RegisterToken(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> RegisterToken ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	tokenAddr, err := utils.HexToAddress(r.PathParam("token"))
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	tokenNetwork, err := API.RegisterToken(tokenAddr)
+	resp = dto.NewAPIResponse(err, &tokenNetworkResponse{tokenAddr, tokenNetwork})
+}
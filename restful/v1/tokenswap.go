@@ -97,3 +97,70 @@ func TokenSwap(w rest.ResponseWriter, r *rest.Request) {
 	}
 	resp = dto.NewAPIResponse(err, nil)
 }
+
+// GetSwapOrders :
+func GetSwapOrders(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> GetSwapOrders ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	orders, err := API.GetSwapOrders()
+	resp = dto.NewAPIResponse(err, orders)
+}
+
+/*
+InitiateSwap is the api of /api/1/swaps/:taker
+the node acts as maker, the swap starts after taker accepts it.
+*/
+func InitiateSwap(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> InitiateSwap ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	taker, err := utils.HexToAddress(r.PathParam("taker"))
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	req := &struct {
+		MakerToken  common.Address `json:"maker_token"`
+		MakerAmount *big.Int       `json:"maker_amount"`
+		TakerToken  common.Address `json:"taker_token"`
+		TakerAmount *big.Int       `json:"taker_amount"`
+	}{}
+	err = r.DecodeJsonPayload(req)
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	order, err := API.InitiateSwap(taker, req.MakerToken, req.MakerAmount, req.TakerToken, req.TakerAmount)
+	resp = dto.NewAPIResponse(err, order)
+}
+
+// RespondSwap :
+func RespondSwap(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> RespondSwap ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	lockSecretHash := common.HexToHash(r.PathParam("locksecrethash"))
+	req := &struct {
+		Accept bool   `json:"accept"`
+		Reason string `json:"reason"`
+	}{}
+	err := r.DecodeJsonPayload(req)
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	if req.Accept {
+		order, err := API.AcceptSwap(lockSecretHash)
+		resp = dto.NewAPIResponse(err, order)
+		return
+	}
+	order, err := API.RejectSwap(lockSecretHash, req.Reason)
+	resp = dto.NewAPIResponse(err, order)
+}
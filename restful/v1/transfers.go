@@ -3,8 +3,10 @@ package v1
 import (
 	"fmt"
 	"math/big"
+	"strconv"
 	"strings"
 
+	photon "github.com/SmartMeshFoundation/Photon"
 	"github.com/SmartMeshFoundation/Photon/rerr"
 
 	"github.com/SmartMeshFoundation/Photon/dto"
@@ -25,9 +27,16 @@ type TransferData struct {
 	Secret         string                      `json:"secret,omitempty"` // 当用户想使用自己指定的密码,而非随机密码时使用	// client can assign specific secret
 	LockSecretHash string                      `json:"lockSecretHash"`
 	IsDirect       bool                        `json:"is_direct,omitempty"`
-	Sync           bool                        `json:"sync,omitempty"` //是否同步
-	Data           string                      `json:"data"`           // 交易附加信息,长度不超过256
-	RouteInfo      []pfsproxy.FindPathResponse `json:"route_info"`     // 指定的路由信息
+	Sync           bool                        `json:"sync,omitempty"`            //是否同步
+	Data           string                      `json:"data"`                      // 交易附加信息,长度不超过256
+	RouteInfo      []pfsproxy.FindPathResponse `json:"route_info"`                // 指定的路由信息
+	OperationID    string                      `json:"operation_id,omitempty"`    // 非同步交易的操作ID,可以通过/api/1/operations/{id}查询进度
+	Priority       string                      `json:"priority,omitempty"`        // 交易优先级,user/scheduled/rebalancing,默认user
+	Exclude        *photon.RouteExclusion      `json:"exclude,omitempty"`         // 路由中不能出现的节点和通道
+	Constraints    *photon.TransferConstraints `json:"constraints,omitempty"`     // 最高手续费,最大跳数和截止块
+	PaymentID      string                      `json:"payment_id,omitempty"`      // 用户指定的支付ID,用来和订单对账
+	Invoice        []byte                      `json:"invoice,omitempty"`         // 可选的发票信息,base64编码
+	IdempotencyKey string                      `json:"idempotency_key,omitempty"` // 幂等键,超时重试时带上同一个键不会重复发起交易
 }
 
 /*
@@ -60,6 +69,70 @@ func GetReceivedTransfers(w rest.ResponseWriter, r *rest.Request) {
 	resp = dto.NewAPIResponse(err, trs)
 }
 
+/*
+GetTransferHistory returns a page of sent and received transfers matching the query parameters,
+pass `next_cursor` of the response as `cursor` to get the next page
+*/
+func GetTransferHistory(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> GetTransferHistory ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	q, err := parseTransferHistoryQuery(r)
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	page, err := API.GetTransferHistory(q)
+	resp = dto.NewAPIResponse(err, page)
+}
+
+func parseTransferHistoryQuery(r *rest.Request) (q *photon.TransferHistoryQuery, err error) {
+	v := r.URL.Query()
+	q = &photon.TransferHistoryQuery{
+		Direction: v.Get("direction"),
+		Status:    v.Get("status"),
+		Cursor:    v.Get("cursor"),
+	}
+	if s := v.Get("token"); s != "" {
+		q.Token, err = utils.HexToAddress(s)
+		if err != nil {
+			return
+		}
+	}
+	if s := v.Get("partner"); s != "" {
+		q.Partner, err = utils.HexToAddress(s)
+		if err != nil {
+			return
+		}
+	}
+	ints := map[string]*int64{
+		"from_block": &q.FromBlock,
+		"to_block":   &q.ToBlock,
+		"from_time":  &q.FromTime,
+		"to_time":    &q.ToTime,
+	}
+	for name, p := range ints {
+		if s := v.Get(name); s != "" {
+			*p, err = strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return
+			}
+		}
+	}
+	if s := v.Get("limit"); s != "" {
+		q.Limit, err = strconv.Atoi(s)
+		if err != nil {
+			return
+		}
+		if q.Limit <= 0 {
+			err = fmt.Errorf("limit must be a positive integer")
+		}
+	}
+	return
+}
+
 /*
 Transfers is the api of /transfer/:token/:partner
 */
@@ -106,11 +179,30 @@ func Transfers(w rest.ResponseWriter, r *rest.Request) {
 		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.Append("Invalid data, length must < 256"))
 		return
 	}
+	priority, err := photon.ParseTransferPriority(req.Priority)
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(err)
+		return
+	}
+	var payment *photon.PaymentMeta
+	if req.PaymentID != "" || len(req.Invoice) > 0 {
+		payment = &photon.PaymentMeta{
+			PaymentID: req.PaymentID,
+			Invoice:   req.Invoice,
+		}
+	}
+	opts := &photon.TransferOptions{
+		Payment:        payment,
+		IdempotencyKey: req.IdempotencyKey,
+		Priority:       priority,
+		Exclusion:      req.Exclude,
+		Constraints:    req.Constraints,
+	}
 	var result *utils.AsyncResult
 	if req.Sync {
-		result, err = API.Transfer(tokenAddr, req.Amount, targetAddr, common.HexToHash(req.Secret), params.MaxRequestTimeout, req.IsDirect, req.Data, req.RouteInfo)
+		result, err = API.Transfer(tokenAddr, req.Amount, targetAddr, common.HexToHash(req.Secret), params.MaxRequestTimeout, req.IsDirect, req.Data, req.RouteInfo, opts)
 	} else {
-		result, err = API.TransferAsync(tokenAddr, req.Amount, targetAddr, common.HexToHash(req.Secret), req.IsDirect, req.Data, req.RouteInfo)
+		result, err = API.TransferOperation(tokenAddr, req.Amount, targetAddr, common.HexToHash(req.Secret), req.IsDirect, req.Data, req.RouteInfo, opts)
 	}
 	if err != nil {
 		resp = dto.NewExceptionAPIResponse(err)
@@ -120,9 +212,73 @@ func Transfers(w rest.ResponseWriter, r *rest.Request) {
 	req.Target = target
 	req.Token = token
 	req.LockSecretHash = result.LockSecretHash.String()
+	req.OperationID = result.ID
 	resp = dto.NewSuccessAPIResponse(req)
 }
 
+//SplitTransferData post for split_transfers
+type SplitTransferData struct {
+	Amount    *big.Int                    `json:"amount"`
+	Data      string                      `json:"data"`
+	RouteInfo []pfsproxy.FindPathResponse `json:"route_info"`        // 每条路由都要带完整路径,按照顺序分配金额
+	Exclude   *photon.RouteExclusion      `json:"exclude,omitempty"` // 路由中不能出现的节点和通道
+}
+
+//splitTransferResponse 拆分结果以及可以查询和撤销整个支付的操作ID
+type splitTransferResponse struct {
+	*photon.SplitPaymentInfo
+	OperationID string `json:"operation_id"`
+}
+
+/*
+SplitTransfers is the api of /split_transfers/:token/:target
+把一次支付拆分到多条路由上,所有交易都到达target以后才泄露密码
+*/
+func SplitTransfers(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> SplitTransfers ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	if API.Photon.StopCreateNewTransfers {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrStopCreateNewTransfer)
+		return
+	}
+	tokenAddr, err := utils.HexToAddress(r.PathParam("token"))
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	targetAddr, err := utils.HexToAddress(r.PathParam("target"))
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	req := &SplitTransferData{}
+	err = r.DecodeJsonPayload(req)
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.AppendError(err))
+		return
+	}
+	if req.Amount == nil || req.Amount.Cmp(utils.BigInt0) <= 0 {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrInvalidAmount.Append("invalid amount"))
+		return
+	}
+	if len(req.Data) > params.MaxTransferDataLen {
+		resp = dto.NewExceptionAPIResponse(rerr.ErrArgumentError.Append("Invalid data, length must < 256"))
+		return
+	}
+	info, result, err := API.SplitTransfer(tokenAddr, req.Amount, targetAddr, req.Data, req.RouteInfo, req.Exclude)
+	if err != nil {
+		resp = dto.NewExceptionAPIResponse(err)
+		return
+	}
+	resp = dto.NewSuccessAPIResponse(&splitTransferResponse{
+		SplitPaymentInfo: info,
+		OperationID:      result.ID,
+	})
+}
+
 // GetSentTransferDetail : query transfer status by lockSecretHash
 func GetSentTransferDetail(w rest.ResponseWriter, r *rest.Request) {
 	var resp *dto.APIResponse
@@ -142,6 +298,29 @@ func GetSentTransferDetail(w rest.ResponseWriter, r *rest.Request) {
 	resp = dto.NewAPIResponse(err, ts)
 }
 
+// GetPayment : query sent and received transfers by payment id
+func GetPayment(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> GetPayment ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	records, err := API.GetPayment(r.PathParam("payment_id"))
+	resp = dto.NewAPIResponse(err, records)
+}
+
+// GetTransferStatus : query every stage of a transfer started by us
+func GetTransferStatus(w rest.ResponseWriter, r *rest.Request) {
+	var resp *dto.APIResponse
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> GetTransferStatus ,err=%s", resp.ToFormatString()))
+		writejson(w, resp)
+	}()
+	lockSecretHash := common.HexToHash(r.PathParam("locksecrethash"))
+	l, err := API.GetTransferStatus(lockSecretHash)
+	resp = dto.NewAPIResponse(err, l)
+}
+
 // CancelTransfer : cancel a transfer when haven't send secret
 func CancelTransfer(w rest.ResponseWriter, r *rest.Request) {
 	var resp *dto.APIResponse
@@ -2,6 +2,9 @@ package v1
 
 import (
 	"fmt"
+	"net/http"
+
+	"github.com/SmartMeshFoundation/Photon/rerr"
 
 	"github.com/SmartMeshFoundation/Photon/dto"
 
@@ -24,6 +27,10 @@ func GetRandomSecret(w rest.ResponseWriter, r *rest.Request) {
 }
 
 func writejson(w rest.ResponseWriter, result interface{}) {
+	// 队列积压时返回503,告诉调用者可以稍后重试
+	if resp, ok := result.(*dto.APIResponse); ok && resp != nil && resp.ErrorCode == rerr.ErrServiceBusy.ErrorCode {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
 	err := w.WriteJson(result)
 	if err != nil {
 		log.Warn(fmt.Sprintf("writejson err %s", err))
@@ -16,7 +16,7 @@ import (
 /*
 重启完毕以后,根据数据库中保存的数据,恢复操作
 1. 未发送成功的 EnvelopMessage 继续发送
-2. 持有的锁,建立对应的 StateManager, 对这些未完成的交易进行简单维护处理
+2. 持有的锁,有快照的从快照恢复 StateManager,其余的建立 crashnode StateManager, 对这些未完成的交易进行简单维护处理
 */
 /*
  *	restore : function to restore data.
@@ -58,56 +58,48 @@ type lockInfo struct {
 	ch     *channel.Channel
 }
 
-func (rs *Service) restoreLocks() {
-	token2ActionInitCrashRestartStateChange := make(map[common.Hash]*mediatedtransfer.ActionInitCrashRestartStateChange)
-	var locks []*lockInfo
-	//收集所有的锁,
-	// collect all locks.
-	//log.Trace(fmt.Sprintf("Token2TokenNetwork=%s", utils.StringInterface(rs.Token2TokenNetwork, 7)))
-	//log.Trace(fmt.Sprintf("Token2ChannelGraph=%s", utils.StringInterface(rs.Token2ChannelGraph, 7)))
-	for token := range rs.Token2TokenNetwork {
-		g := rs.Token2ChannelGraph[token]
-		//log.Trace(fmt.Sprintf("process token=%s", token.String()))
+/*
+collectLocks 收集所有通道中match的锁,包括我发出的和我收到的
+*/
+func (rs *Service) collectLocks(match func(l *mtree.Lock) bool) (locks []*lockInfo) {
+	add := func(l *mtree.Lock, isSent bool, token common.Address, ch *channel.Channel) {
+		if match != nil && !match(l) {
+			return
+		}
+		locks = append(locks, &lockInfo{
+			l:      l,
+			isSent: isSent,
+			token:  token,
+			ch:     ch,
+		})
+	}
+	for token, g := range rs.Token2ChannelGraph {
 		for _, ch := range g.ChannelIdentifier2Channel {
 			for _, l := range ch.OurState.Lock2PendingLocks {
-				locks = append(locks, &lockInfo{
-					l:      l.Lock,
-					isSent: true,
-					token:  token,
-					ch:     ch,
-				})
+				add(l.Lock, true, token, ch)
 			}
 			for _, l := range ch.OurState.Lock2UnclaimedLocks {
 				//todo 密码已经链上注册的锁,需要跳过
-				locks = append(locks, &lockInfo{
-					l:      l.Lock,
-					isSent: true,
-					token:  token,
-					ch:     ch,
-				})
+				add(l.Lock, true, token, ch)
 			}
 			for _, l := range ch.PartnerState.Lock2PendingLocks {
-				locks = append(locks, &lockInfo{
-					l:      l.Lock,
-					isSent: false,
-					token:  token,
-					ch:     ch,
-				})
+				add(l.Lock, false, token, ch)
 			}
 			for _, l := range ch.PartnerState.Lock2UnclaimedLocks {
 				//todo 密码已经链上注册的锁,需要跳过
-				locks = append(locks, &lockInfo{
-					l:      l.Lock,
-					isSent: false,
-					token:  token,
-					ch:     ch,
-				})
+				add(l.Lock, false, token, ch)
 			}
 		}
 	}
-	//log.Trace(fmt.Sprintf("after restart current locks %s", utils.StringInterface(locks, 4)))
-	//将 lock 转换为ActionInitCrashRestartStateChange
-	// switch lock to ActionInitCrashRestartStateChange
+	return
+}
+
+/*
+newCrashRestartStateChanges 把锁按照LockSecretHash和token分组,转换为ActionInitCrashRestartStateChange,
+key和StateManager在Transfer2StateManager中的key相同
+*/
+func (rs *Service) newCrashRestartStateChanges(locks []*lockInfo) map[common.Hash]*mediatedtransfer.ActionInitCrashRestartStateChange {
+	token2ActionInitCrashRestartStateChange := make(map[common.Hash]*mediatedtransfer.ActionInitCrashRestartStateChange)
 	for _, l := range locks {
 		//要注册密码,否则链上注册密码事件会找不到相关的通道.
 		rs.registerChannelForHashlock(l.ch, l.l.LockSecretHash)
@@ -133,12 +125,39 @@ func (rs *Service) restoreLocks() {
 		}
 		token2ActionInitCrashRestartStateChange[key] = aicr
 	}
+	return token2ActionInitCrashRestartStateChange
+}
+
+func (rs *Service) restoreLocks() {
+	//收集所有的锁,
+	// collect all locks.
+	locks := rs.collectLocks(nil)
+	//log.Trace(fmt.Sprintf("after restart current locks %s", utils.StringInterface(locks, 4)))
+	//将 lock 转换为ActionInitCrashRestartStateChange
+	// switch lock to ActionInitCrashRestartStateChange
+	token2ActionInitCrashRestartStateChange := rs.newCrashRestartStateChanges(locks)
 	//log.Trace(fmt.Sprintf("after restart ActionInitCrashRestartStateChanges=%s", utils.StringInterface(token2ActionInitCrashRestartStateChange, 5)))
+	//有快照的交易直接恢复崩溃前的状态,没有的才根据ActionInitCrashRestartStateChange处理
+	restored := rs.restoreStateManagers()
 	//根据ActionInitCrashRestartStateChange,创建对应的 stateManager
 	// Create corresponding stateManager, according to ActionInitCrashRestartStateChange.
 	for k, st := range token2ActionInitCrashRestartStateChange {
+		if sm := restored[k]; sm != nil {
+			rs.Transfer2StateManager[k] = sm
+			delete(restored, k)
+			//重放完以后保存一次快照,清理日志
+			rs.saveStateManagerSnapshot(k, sm)
+			continue
+		}
 		stateManager := transfer.NewStateManager(crashnode.StateTransition, nil, crashnode.NameCrashNodeTransition, st.LockSecretHash, st.Token)
 		rs.Transfer2StateManager[k] = stateManager
 		rs.StateMachineEventHandler.dispatch(stateManager, st)
 	}
+	//通道中已经没有相关的锁,交易早已结束
+	for k := range restored {
+		err := rs.dao.RemoveStateManagerSnapshot(k)
+		if err != nil {
+			log.Error(fmt.Sprintf("RemoveStateManagerSnapshot %s err %s", utils.HPex(k), err))
+		}
+	}
 }
@@ -0,0 +1,66 @@
+package photon
+
+import (
+	"sync"
+
+	"github.com/SmartMeshFoundation/Photon/transfer/route"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type routeAffinityKey struct {
+	token  common.Address
+	target common.Address
+}
+
+/*
+routeAffinity 记录到每个(token,target)最近一次成功交易使用的通道,
+重复向同一个target付款时优先使用该通道,只保存在内存中,重启后清零
+*/
+type routeAffinity struct {
+	lock     sync.Mutex
+	channels map[routeAffinityKey]common.Hash
+}
+
+func newRouteAffinity() *routeAffinity {
+	return &routeAffinity{
+		channels: make(map[routeAffinityKey]common.Hash),
+	}
+}
+
+//recordSuccess 通过`channelIdentifier`向`target`的交易成功
+func (ra *routeAffinity) recordSuccess(token, target common.Address, channelIdentifier common.Hash) {
+	ra.lock.Lock()
+	defer ra.lock.Unlock()
+	ra.channels[routeAffinityKey{token, target}] = channelIdentifier
+}
+
+//recordFailure 交易失败以后不再优先使用记录的通道,下次重新按照路由算法的顺序选择
+func (ra *routeAffinity) recordFailure(token, target common.Address) {
+	ra.lock.Lock()
+	defer ra.lock.Unlock()
+	delete(ra.channels, routeAffinityKey{token, target})
+}
+
+/*
+prefer 如果上次成功的通道依然在`routes`中,也就是仍然有足够的余额并且对方在线,把它移到第一位,
+其他路由保持原来的顺序;否则原样返回,使用完整的路由搜索结果
+*/
+func (ra *routeAffinity) prefer(token, target common.Address, routes []*route.State) []*route.State {
+	ra.lock.Lock()
+	channelIdentifier, ok := ra.channels[routeAffinityKey{token, target}]
+	ra.lock.Unlock()
+	if !ok {
+		return routes
+	}
+	for i, r := range routes {
+		if r.ChannelIdentifier != channelIdentifier {
+			continue
+		}
+		if i > 0 {
+			copy(routes[1:i+1], routes[:i])
+			routes[0] = r
+		}
+		break
+	}
+	return routes
+}
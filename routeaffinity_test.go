@@ -0,0 +1,32 @@
+package photon
+
+import (
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/transfer/route"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteAffinity(t *testing.T) {
+	ra := newRouteAffinity()
+	token := utils.NewRandomAddress()
+	target := utils.NewRandomAddress()
+	r1 := &route.State{ChannelIdentifier: utils.NewRandomHash()}
+	r2 := &route.State{ChannelIdentifier: utils.NewRandomHash()}
+	r3 := &route.State{ChannelIdentifier: utils.NewRandomHash()}
+	routes := ra.prefer(token, target, []*route.State{r1, r2, r3})
+	assert.EqualValues(t, []*route.State{r1, r2, r3}, routes)
+	ra.recordSuccess(token, target, r3.ChannelIdentifier)
+	routes = ra.prefer(token, target, []*route.State{r1, r2, r3})
+	assert.EqualValues(t, []*route.State{r3, r1, r2}, routes)
+	//其他target不受影响
+	routes = ra.prefer(token, utils.NewRandomAddress(), []*route.State{r1, r2, r3})
+	assert.EqualValues(t, []*route.State{r1, r2, r3}, routes)
+	//上次的通道已经没有足够余额,使用完整的搜索结果
+	routes = ra.prefer(token, target, []*route.State{r1, r2})
+	assert.EqualValues(t, []*route.State{r1, r2}, routes)
+	ra.recordFailure(token, target)
+	routes = ra.prefer(token, target, []*route.State{r1, r2, r3})
+	assert.EqualValues(t, []*route.State{r1, r2, r3}, routes)
+}
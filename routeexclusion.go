@@ -0,0 +1,88 @@
+package photon
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+RouteExclusion 一次交易的路由中不能出现的节点和通道,比如出于合规要求避开某个中转节点.
+只有知道完整路径时才能保证不经过这些节点,所以没有完整路径的路由只能直接发给target
+*/
+type RouteExclusion struct {
+	Addresses []common.Address `json:"addresses"`
+	Channels  []common.Hash    `json:"channels"`
+}
+
+//IsEmpty returns true if nothing is excluded
+func (e *RouteExclusion) IsEmpty() bool {
+	return e == nil || (len(e.Addresses) == 0 && len(e.Channels) == 0)
+}
+
+func (e *RouteExclusion) excludesAddress(addr common.Address) bool {
+	for _, a := range e.Addresses {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *RouteExclusion) excludesChannel(channelIdentifier common.Hash) bool {
+	for _, c := range e.Channels {
+		if c == channelIdentifier {
+			return true
+		}
+	}
+	return false
+}
+
+//validate 自己和target被排除时任何路由都不可用,直接报错
+func (e *RouteExclusion) validate(ourAddress, target common.Address) error {
+	if e.IsEmpty() {
+		return nil
+	}
+	if e.excludesAddress(ourAddress) || e.excludesAddress(target) {
+		return rerr.ErrArgumentError.Append("exclusion list cannot contain the initiator or the target")
+	}
+	return nil
+}
+
+/*
+checkPath 检查从ourAddress经过path到达target的所有节点和通道.
+path中可以不包含ourAddress和target,为空时说明只知道下一跳firstHop,只有firstHop就是target才能通过检查
+*/
+func (e *RouteExclusion) checkPath(token, tokensNetwork, ourAddress, target, firstHop common.Address, path []common.Address) error {
+	if e.IsEmpty() {
+		return nil
+	}
+	hops := []common.Address{ourAddress}
+	if len(path) == 0 {
+		if firstHop != target {
+			return fmt.Errorf("route through %s has no full path, cannot check exclusion list", utils.APex2(firstHop))
+		}
+		hops = append(hops, firstHop)
+	} else {
+		for _, addr := range path {
+			if addr != hops[len(hops)-1] {
+				hops = append(hops, addr)
+			}
+		}
+		if hops[len(hops)-1] != target {
+			hops = append(hops, target)
+		}
+	}
+	for i := 1; i < len(hops); i++ {
+		if e.excludesAddress(hops[i]) {
+			return fmt.Errorf("route goes through excluded node %s", utils.APex2(hops[i]))
+		}
+		channelIdentifier := utils.CalcChannelID(token, tokensNetwork, hops[i-1], hops[i])
+		if e.excludesChannel(channelIdentifier) {
+			return fmt.Errorf("route goes through excluded channel %s", utils.HPex(channelIdentifier))
+		}
+	}
+	return nil
+}
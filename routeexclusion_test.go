@@ -0,0 +1,32 @@
+package photon
+
+import (
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteExclusion(t *testing.T) {
+	token, tokensNetwork := utils.NewRandomAddress(), utils.NewRandomAddress()
+	me, hub, other, target := utils.NewRandomAddress(), utils.NewRandomAddress(), utils.NewRandomAddress(), utils.NewRandomAddress()
+	var e *RouteExclusion
+	assert.True(t, e.IsEmpty())
+	assert.Nil(t, e.checkPath(token, tokensNetwork, me, target, hub, nil))
+
+	e = &RouteExclusion{Addresses: []common.Address{hub}}
+	assert.NotNil(t, e.validate(me, hub))
+	assert.Nil(t, e.validate(me, target))
+	assert.NotNil(t, e.checkPath(token, tokensNetwork, me, target, other, []common.Address{other, hub, target}))
+	assert.Nil(t, e.checkPath(token, tokensNetwork, me, target, other, []common.Address{other, target}))
+	//path可以包含自己,也可以不包含target
+	assert.Nil(t, e.checkPath(token, tokensNetwork, me, target, other, []common.Address{me, other}))
+	//只知道下一跳时,必须直接发给target
+	assert.NotNil(t, e.checkPath(token, tokensNetwork, me, target, other, nil))
+	assert.Nil(t, e.checkPath(token, tokensNetwork, me, target, target, nil))
+
+	e = &RouteExclusion{Channels: []common.Hash{utils.CalcChannelID(token, tokensNetwork, target, other)}}
+	assert.NotNil(t, e.checkPath(token, tokensNetwork, me, target, other, []common.Address{other, target}))
+	assert.Nil(t, e.checkPath(token, tokensNetwork, me, target, hub, []common.Address{hub, target}))
+}
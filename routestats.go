@@ -0,0 +1,246 @@
+package photon
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/transfer/route"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//RouteStat 经过某个下一跳发出的交易的成功和失败次数
+type RouteStat struct {
+	TokenAddress       common.Address `json:"token_address"`
+	HopAddress         common.Address `json:"hop_address"`
+	Success            int64          `json:"success"`
+	Failure            int64          `json:"failure"`
+	Timeout            int64          `json:"timeout"`             //失败中锁过期的次数
+	ConsecutiveTimeout int64          `json:"consecutive_timeout"` //最近一次成功以后连续锁过期的次数
+	AverageLatency     int64          `json:"average_latency"`     //从发出MediatedTransfer到交易成功的平均毫秒数,越近的交易权重越大
+	Score              float64        `json:"score"`               //按照params.RouteStatsHalfLife衰减以后的成功率,1表示最近没有失败过
+	ExcludedUntil      int64          `json:"excluded_until,omitempty"`
+	LastFailure        string         `json:"last_failure,omitempty"`
+	LastFailureTime    int64          `json:"last_failure_time,omitempty"`
+	decayedSuccess     float64
+	decayedFailure     float64
+	decayedAt          time.Time
+}
+
+//decay 成功和失败次数按照params.RouteStatsHalfLife指数衰减到now
+func (s *RouteStat) decay(now time.Time) {
+	if !s.decayedAt.IsZero() && params.RouteStatsHalfLife > 0 {
+		f := math.Pow(0.5, float64(now.Sub(s.decayedAt))/float64(params.RouteStatsHalfLife))
+		s.decayedSuccess *= f
+		s.decayedFailure *= f
+	}
+	s.decayedAt = now
+}
+
+//failureRate 衰减并且加一平滑以后的失败率,没有失败过或者失败已经衰减得差不多了的下一跳为0
+func (s *RouteStat) failureRate(now time.Time) float64 {
+	s.decay(now)
+	if s.decayedFailure < 0.01 {
+		return 0
+	}
+	return (s.decayedFailure + 1) / (s.decayedSuccess + s.decayedFailure + 2)
+}
+
+//isExcluded 连续超时的下一跳在ExcludedUntil之前不参与路由
+func (s *RouteStat) isExcluded(now time.Time) bool {
+	return s.ExcludedUntil > now.Unix()
+}
+
+type routeStatKey struct {
+	token common.Address
+	hop   common.Address
+}
+
+//sentHop 发出的MediatedTransfer,用于计算延迟
+type sentHop struct {
+	hop    common.Address
+	sentAt time.Time
+}
+
+/*
+routeStats 记录每个(token,下一跳)上交易的成功和失败,发起交易时把经常失败的下一跳排到后面,
+连续超时的下一跳一段时间内不参与路由.
+次数随时间衰减,很久以前的失败不再影响路由.只保存在内存中,重启后清零
+*/
+type routeStats struct {
+	lock  sync.Mutex
+	stats map[routeStatKey]*RouteStat
+	sent  map[common.Hash]*sentHop
+}
+
+func newRouteStats() *routeStats {
+	return &routeStats{
+		stats: make(map[routeStatKey]*RouteStat),
+		sent:  make(map[common.Hash]*sentHop),
+	}
+}
+
+func (rs *routeStats) get(token, hop common.Address) *RouteStat {
+	key := routeStatKey{token, hop}
+	s, ok := rs.stats[key]
+	if !ok {
+		s = &RouteStat{TokenAddress: token, HopAddress: hop}
+		rs.stats[key] = s
+	}
+	return s
+}
+
+/*
+recordSent 自己发起的交易经过`hop`发出,交易结束时计算延迟.
+交易没有结果就重启或者一直没有结果的记录在一个半衰期以后丢弃
+*/
+func (rs *routeStats) recordSent(lockSecretHash common.Hash, hop common.Address) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	now := time.Now()
+	for h, sh := range rs.sent {
+		if now.Sub(sh.sentAt) > params.RouteStatsHalfLife {
+			delete(rs.sent, h)
+		}
+	}
+	rs.sent[lockSecretHash] = &sentHop{hop, now}
+}
+
+//recordSuccess 经过`hop`的交易成功
+func (rs *routeStats) recordSuccess(token, hop common.Address, lockSecretHash common.Hash) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	now := time.Now()
+	s := rs.get(token, hop)
+	s.decay(now)
+	s.Success++
+	s.decayedSuccess++
+	s.ConsecutiveTimeout = 0
+	s.ExcludedUntil = 0
+	if sh, ok := rs.sent[lockSecretHash]; ok {
+		delete(rs.sent, lockSecretHash)
+		if sh.hop == hop {
+			latency := int64(now.Sub(sh.sentAt) / time.Millisecond)
+			if s.AverageLatency == 0 {
+				s.AverageLatency = latency
+			} else {
+				s.AverageLatency += (latency - s.AverageLatency) / 4
+			}
+		}
+	}
+}
+
+/*
+recordFailure 经过`hop`的交易失败,比如`hop`退回了锁,`timeout`表示锁过期了.
+连续超时params.RouteTimeoutExcludeThreshold次以后,params.RouteTimeoutExcludeDuration内不再经过`hop`
+*/
+func (rs *routeStats) recordFailure(token, hop common.Address, lockSecretHash common.Hash, reason string, timeout bool) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	now := time.Now()
+	delete(rs.sent, lockSecretHash)
+	s := rs.get(token, hop)
+	s.decay(now)
+	s.Failure++
+	s.decayedFailure++
+	s.LastFailure = reason
+	s.LastFailureTime = now.Unix()
+	if !timeout {
+		return
+	}
+	s.Timeout++
+	s.ConsecutiveTimeout++
+	if params.RouteTimeoutExcludeThreshold > 0 && s.ConsecutiveTimeout >= params.RouteTimeoutExcludeThreshold {
+		s.ExcludedUntil = now.Add(params.RouteTimeoutExcludeDuration).Unix()
+	}
+}
+
+//excluded 返回`token`上暂时不参与路由的下一跳
+func (rs *routeStats) excluded(token common.Address) map[common.Address]bool {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	now := time.Now()
+	m := make(map[common.Address]bool)
+	for key, s := range rs.stats {
+		if key.token == token && s.isExcluded(now) {
+			m[key.hop] = true
+		}
+	}
+	return m
+}
+
+//reset 清除统计,`token`或者`hop`为空时表示所有的token或者下一跳
+func (rs *routeStats) reset(token, hop common.Address) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	for key := range rs.stats {
+		if (token == utils.EmptyAddress || key.token == token) && (hop == utils.EmptyAddress || key.hop == hop) {
+			delete(rs.stats, key)
+		}
+	}
+}
+
+/*
+rank 按照下一跳的失败率把`routes`稳定排序,没有失败过的下一跳保持原来的顺序排在前面,
+失败过的按照失败率从低到高排在后面
+*/
+func (rs *routeStats) rank(token common.Address, routes []*route.State) []*route.State {
+	rs.lock.Lock()
+	now := time.Now()
+	rates := make(map[common.Address]float64)
+	for _, r := range routes {
+		if s, ok := rs.stats[routeStatKey{token, r.HopNode()}]; ok {
+			rates[r.HopNode()] = s.failureRate(now)
+			//不能完全排除的时候,比如用户指定的路由,排在最后
+			if s.isExcluded(now) {
+				rates[r.HopNode()] = 2
+			}
+		}
+	}
+	rs.lock.Unlock()
+	sort.SliceStable(routes, func(i, j int) bool {
+		return rates[routes[i].HopNode()] < rates[routes[j].HopNode()]
+	})
+	return routes
+}
+
+/*
+routingExclude 路由时不经过的节点:协议违规达到阈值的节点,`token`上连续超时的下一跳,以及`addrs`
+*/
+func (rs *Service) routingExclude(token common.Address, addrs ...common.Address) map[common.Address]bool {
+	exclude := rs.peerStats.greylist()
+	for addr := range rs.routeStats.excluded(token) {
+		exclude[addr] = true
+	}
+	for _, addr := range addrs {
+		exclude[addr] = true
+	}
+	return exclude
+}
+
+//routingExcludeTo 在routingExclude的基础上避开已知无法到达的节点,避免交易卡在离线的中间节点上,`target`本身除外
+func (rs *Service) routingExcludeTo(token, target common.Address, addrs ...common.Address) map[common.Address]bool {
+	exclude := rs.routingExclude(token, addrs...)
+	for addr := range rs.Protocol.UnreachablePeers() {
+		if addr != target {
+			exclude[addr] = true
+		}
+	}
+	return exclude
+}
+
+//snapshot 返回统计信息的拷贝,避免外部修改
+func (rs *routeStats) snapshot() (stats []*RouteStat) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	now := time.Now()
+	for _, s := range rs.stats {
+		s.Score = 1 - s.failureRate(now)
+		s2 := *s
+		stats = append(stats, &s2)
+	}
+	return
+}
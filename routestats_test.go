@@ -0,0 +1,92 @@
+package photon
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/transfer/route"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/SmartMeshFoundation/Photon/utils/utest"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteStatsRank(t *testing.T) {
+	rs := newRouteStats()
+	token := utils.NewRandomAddress()
+	hop1, hop2, hop3 := utils.NewRandomAddress(), utils.NewRandomAddress(), utils.NewRandomAddress()
+	makeRoute := func(hop common.Address) *route.State {
+		return utest.MakeRoute(hop, big.NewInt(10), utest.UnitSettleTimeout, utest.UnitRevealTimeout, 0, utils.NewRandomHash())
+	}
+	r1, r2, r3 := makeRoute(hop1), makeRoute(hop2), makeRoute(hop3)
+	routes := rs.rank(token, []*route.State{r1, r2, r3})
+	assert.EqualValues(t, []*route.State{r1, r2, r3}, routes)
+
+	//成功过的下一跳不会排到没有记录的前面
+	rs.recordSuccess(token, hop3, utils.NewRandomHash())
+	rs.recordFailure(token, hop1, utils.NewRandomHash(), "no enough balance", false)
+	rs.recordFailure(token, hop2, utils.NewRandomHash(), "no enough balance", false)
+	rs.recordSuccess(token, hop2, utils.NewRandomHash())
+	routes = rs.rank(token, []*route.State{r1, r2, r3})
+	assert.EqualValues(t, []*route.State{r3, r2, r1}, routes)
+	//其他token不受影响
+	routes = rs.rank(utils.NewRandomAddress(), []*route.State{r1, r2, r3})
+	assert.EqualValues(t, []*route.State{r1, r2, r3}, routes)
+
+	stats := rs.snapshot()
+	assert.Len(t, stats, 3)
+}
+
+func TestRouteStatsTimeout(t *testing.T) {
+	rs := newRouteStats()
+	token := utils.NewRandomAddress()
+	hop1, hop2 := utils.NewRandomAddress(), utils.NewRandomAddress()
+	r1, r2 := utest.MakeRoute(hop1, big.NewInt(10), utest.UnitSettleTimeout, utest.UnitRevealTimeout, 0, utils.NewRandomHash()),
+		utest.MakeRoute(hop2, big.NewInt(10), utest.UnitSettleTimeout, utest.UnitRevealTimeout, 0, utils.NewRandomHash())
+	//拒绝交易不算超时,不会被排除
+	for i := int64(0); i < params.RouteTimeoutExcludeThreshold; i++ {
+		rs.recordFailure(token, hop2, utils.NewRandomHash(), "no enough balance", false)
+	}
+	assert.Len(t, rs.excluded(token), 0)
+	for i := int64(0); i < params.RouteTimeoutExcludeThreshold; i++ {
+		assert.Len(t, rs.excluded(token), 0)
+		rs.recordFailure(token, hop1, utils.NewRandomHash(), "lock expired", true)
+	}
+	assert.True(t, rs.excluded(token)[hop1])
+	assert.Len(t, rs.excluded(utils.NewRandomAddress()), 0)
+	//被排除的下一跳即使失败率更低也排在最后
+	routes := rs.rank(token, []*route.State{r1, r2})
+	assert.EqualValues(t, []*route.State{r2, r1}, routes)
+	//成功一次以后恢复
+	lockSecretHash := utils.NewRandomHash()
+	rs.recordSent(lockSecretHash, hop1)
+	rs.recordSuccess(token, hop1, lockSecretHash)
+	assert.Len(t, rs.excluded(token), 0)
+	assert.Len(t, rs.sent, 0)
+	//重置以后清除统计
+	rs.recordFailure(token, hop1, utils.NewRandomHash(), "lock expired", true)
+	rs.reset(utils.EmptyAddress, hop1)
+	stats := rs.snapshot()
+	if assert.Len(t, stats, 1) {
+		assert.Equal(t, hop2, stats[0].HopAddress)
+	}
+	rs.reset(token, utils.EmptyAddress)
+	assert.Len(t, rs.snapshot(), 0)
+}
+
+func TestRouteStatDecay(t *testing.T) {
+	s := &RouteStat{}
+	now := time.Now()
+	s.decay(now)
+	s.decayedFailure = 4
+	s.decayedSuccess = 2
+	assert.InDelta(t, 5.0/8, s.failureRate(now), 1e-9)
+	//两个半衰期以后只剩四分之一
+	s.failureRate(now.Add(2 * params.RouteStatsHalfLife))
+	assert.InDelta(t, 1, s.decayedFailure, 1e-9)
+	assert.InDelta(t, 0.5, s.decayedSuccess, 1e-9)
+	//很久以前的失败不再影响路由
+	assert.EqualValues(t, 0, s.failureRate(now.Add(20*params.RouteStatsHalfLife)))
+}
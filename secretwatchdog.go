@@ -0,0 +1,48 @@
+package photon
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/transfer"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer/crashnode"
+	"github.com/SmartMeshFoundation/Photon/transfer/mtree"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+密码在链上注册以后,正常情况下由相关交易的StateManager处理.
+但是有些锁已经没有StateManager负责了,比如交易失败以后StateManager已经删除,锁还在通道中,
+如果不处理,发出的锁对方可以链上解锁,我却没有发送unlock,收到的锁在通道关闭后也不会链上解锁.
+所以收到密码注册事件时扫描所有通道,找出这些锁,和重启时一样交给crashnode StateManager:
+1. 我发出的锁,没有过期的,发送unlock消息
+2. 我收到的锁,通道已经关闭的,链上unlock,否则等对方发送unlock
+*/
+
+//orphanLocksForSecret 通道中有这个LockSecretHash的锁,但是没有StateManager负责的,按照token分组
+func (rs *Service) orphanLocksForSecret(lockSecretHash common.Hash) map[common.Hash]*mediatedtransfer.ActionInitCrashRestartStateChange {
+	locks := rs.collectLocks(func(l *mtree.Lock) bool {
+		return l.LockSecretHash == lockSecretHash
+	})
+	orphans := rs.newCrashRestartStateChanges(locks)
+	for key := range orphans {
+		if rs.Transfer2StateManager[key] != nil {
+			delete(orphans, key)
+		}
+	}
+	return orphans
+}
+
+//watchRegisteredSecret 为orphans创建crashnode StateManager,并处理链上注册的密码,必须在密码注册到通道以后调用
+func (eh *stateMachineEventHandler) watchRegisteredSecret(orphans map[common.Hash]*mediatedtransfer.ActionInitCrashRestartStateChange, st *mediatedtransfer.ContractSecretRevealOnChainStateChange) {
+	for key, aicr := range orphans {
+		log.Info(fmt.Sprintf("secret %s registered on chain, handle %d sent locks and %d received locks without transfer",
+			utils.HPex(st.LockSecretHash), len(aicr.SentLocks), len(aicr.ReceivedLocks)))
+		stateManager := transfer.NewStateManager(crashnode.StateTransition, nil, crashnode.NameCrashNodeTransition, aicr.LockSecretHash, aicr.Token)
+		eh.photon.Transfer2StateManager[key] = stateManager
+		eh.dispatch(stateManager, aicr)
+		eh.dispatch(stateManager, st)
+	}
+}
@@ -0,0 +1,85 @@
+package photon
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/channel"
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/network/graph"
+	"github.com/SmartMeshFoundation/Photon/network/rpc/contracts"
+	"github.com/SmartMeshFoundation/Photon/transfer"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer/crashnode"
+	"github.com/SmartMeshFoundation/Photon/transfer/mtree"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrphanLocksForSecret(t *testing.T) {
+	token1 := utils.NewRandomAddress()
+	token2 := utils.NewRandomAddress()
+	lockSecretHash := utils.NewRandomHash()
+	newChannel := func(token common.Address) *channel.Channel {
+		newEndState := func() *channel.EndState {
+			return &channel.EndState{
+				Address:             utils.NewRandomAddress(),
+				Lock2PendingLocks:   make(map[common.Hash]channeltype.PendingLock),
+				Lock2UnclaimedLocks: make(map[common.Hash]channeltype.UnlockPartialProof),
+			}
+		}
+		id := contracts.ChannelUniqueID{ChannelIdentifier: utils.NewRandomHash()}
+		return &channel.Channel{
+			ChannelIdentifier: id,
+			ExternState:       &channel.ExternalState{ChannelIdentifier: id},
+			OurState:          newEndState(),
+			PartnerState:      newEndState(),
+			TokenAddress:      token,
+		}
+	}
+	newLock := func(lockSecretHash common.Hash) *mtree.Lock {
+		return &mtree.Lock{Expiration: 100, Amount: big.NewInt(1), LockSecretHash: lockSecretHash}
+	}
+	//token1上一个通道发出了锁,另一个通道收到了锁,都没有StateManager
+	ch1 := newChannel(token1)
+	ch1.OurState.Lock2PendingLocks[lockSecretHash] = channeltype.PendingLock{Lock: newLock(lockSecretHash)}
+	ch1.OurState.Lock2PendingLocks[utils.NewRandomHash()] = channeltype.PendingLock{Lock: newLock(utils.NewRandomHash())}
+	ch2 := newChannel(token1)
+	ch2.PartnerState.Lock2UnclaimedLocks[lockSecretHash] = channeltype.UnlockPartialProof{Lock: newLock(lockSecretHash)}
+	//token2上的锁有StateManager负责
+	ch3 := newChannel(token2)
+	ch3.PartnerState.Lock2PendingLocks[lockSecretHash] = channeltype.PendingLock{Lock: newLock(lockSecretHash)}
+	newGraph := func(chs ...*channel.Channel) *graph.ChannelGraph {
+		g := &graph.ChannelGraph{ChannelIdentifier2Channel: make(map[common.Hash]*channel.Channel)}
+		for _, ch := range chs {
+			g.ChannelIdentifier2Channel[ch.ChannelIdentifier.ChannelIdentifier] = ch
+		}
+		return g
+	}
+	rs := &Service{
+		Token2ChannelGraph: map[common.Address]*graph.ChannelGraph{
+			token1: newGraph(ch1, ch2),
+			token2: newGraph(ch3),
+		},
+		Token2LockSecretHash2Channels: make(map[common.Address]map[common.Hash][]*channel.Channel),
+		Transfer2StateManager:         make(map[common.Hash]*transfer.StateManager),
+	}
+	key2 := utils.Sha3(lockSecretHash[:], token2[:])
+	rs.Transfer2StateManager[key2] = transfer.NewStateManager(crashnode.StateTransition, nil, crashnode.NameCrashNodeTransition, lockSecretHash, token2)
+
+	orphans := rs.orphanLocksForSecret(lockSecretHash)
+	if !assert.Len(t, orphans, 1) {
+		return
+	}
+	aicr := orphans[utils.Sha3(lockSecretHash[:], token1[:])]
+	if !assert.NotNil(t, aicr) {
+		return
+	}
+	assert.Equal(t, lockSecretHash, aicr.LockSecretHash)
+	assert.Len(t, aicr.SentLocks, 1)
+	assert.Equal(t, ch1, aicr.SentLocks[0].Channel)
+	assert.Len(t, aicr.ReceivedLocks, 1)
+	assert.Equal(t, ch2, aicr.ReceivedLocks[0].Channel)
+	//通道要注册到LockSecretHash上,否则不会记录链上注册的密码
+	assert.Len(t, rs.Token2LockSecretHash2Channels[token1][lockSecretHash], 2)
+}
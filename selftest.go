@@ -0,0 +1,158 @@
+package photon
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//自检的各个阶段
+const (
+	SelfTestStageChain             = "chain"
+	SelfTestStageOpenChannel       = "open_channel"
+	SelfTestStagePayment           = "payment"
+	SelfTestStageEcho              = "echo"
+	SelfTestStageCooperativeSettle = "cooperative_settle"
+)
+
+type selfTestStage struct {
+	name string
+	run  func() error
+}
+
+/*
+runSelfTestStages 依次执行各个阶段,每个阶段的结果记录到result的进度中,任何一个阶段失败就停止.
+quit关闭表示用户撤销了自检
+*/
+func runSelfTestStages(result *utils.AsyncResult, stages []selfTestStage, quit <-chan struct{}) error {
+	for _, s := range stages {
+		select {
+		case <-quit:
+			result.AddProgress(fmt.Sprintf("stage=%s,result=canceled", s.name))
+			return rerr.ErrInvalidState.Printf("self test canceled before stage %s", s.name)
+		default:
+		}
+		start := time.Now()
+		err := s.run()
+		if err != nil {
+			result.AddProgress(fmt.Sprintf("stage=%s,result=fail,time=%s,err=%s", s.name, time.Since(start), err))
+			return fmt.Errorf("self test stage %s failed: %s", s.name, err)
+		}
+		result.AddProgress(fmt.Sprintf("stage=%s,result=pass,time=%s", s.name, time.Since(start)))
+	}
+	return nil
+}
+
+/*
+waitSelfTestChannel 每隔params.SelfTestPollInterval检查一次通道,直到done返回true
+*/
+func (r *API) waitSelfTestChannel(channelIdentifier common.Hash, quit <-chan struct{}, done func(c *channeltype.Serialization, err error) bool) error {
+	for {
+		c, err := r.Photon.dao.GetChannelByAddress(channelIdentifier)
+		if done(c, err) {
+			return nil
+		}
+		select {
+		case <-quit:
+			return rerr.ErrInvalidState.Printf("self test canceled")
+		case <-time.After(params.SelfTestPollInterval):
+		}
+	}
+}
+
+/*
+SelfTest 检查节点是否真正可用:和回声节点创建一个临时通道,付一笔小额交易,等回声节点原样退回,
+然后合作关闭通道.自检作为长时间操作执行,通过返回的操作ID查询每个阶段的结果.
+echoNode为空时使用启动参数--selftest-echo-node指定的节点,回声节点需要以--echo启动
+*/
+func (r *API) SelfTest(tokenAddress, echoNode common.Address, amount *big.Int) (result *utils.AsyncResult, err error) {
+	if echoNode == utils.EmptyAddress {
+		echoNode = r.Photon.Config.SelfTestEchoNode
+	}
+	if echoNode == utils.EmptyAddress {
+		err = rerr.ErrArgumentError.Printf("no echo node given and --selftest-echo-node is not set")
+		return
+	}
+	if amount == nil || amount.Cmp(utils.BigInt0) <= 0 {
+		amount = big.NewInt(params.SelfTestAmount)
+	}
+	_, err = r.Photon.dao.GetChannel(tokenAddress, echoNode)
+	if err == nil {
+		err = rerr.ErrChannelAlreadExist.Printf("self test needs a new channel with %s", echoNode.String())
+		return
+	}
+	err = nil
+	channelIdentifier := utils.CalcChannelID(tokenAddress, r.Photon.Chain.GetRegistryAddress(), echoNode, r.Photon.NodeAddress)
+	quit := make(chan struct{})
+	var quitOnce sync.Once
+	stages := []selfTestStage{
+		{SelfTestStageChain, r.checkSmcStatus},
+		{SelfTestStageOpenChannel, func() error {
+			_, err := r.DepositAndOpenChannel(tokenAddress, echoNode, 0, 0, amount, true)
+			if err != nil {
+				return err
+			}
+			return r.waitSelfTestChannel(channelIdentifier, quit, func(c *channeltype.Serialization, err error) bool {
+				return err == nil && c.State == channeltype.StateOpened
+			})
+		}},
+		{SelfTestStagePayment, func() error {
+			_, err := r.Transfer(tokenAddress, amount, echoNode, utils.EmptyHash, params.MaxRequestTimeout, false, params.SelfTestTransferData, nil, nil)
+			return err
+		}},
+		{SelfTestStageEcho, func() error {
+			//回声节点退回以后,余额恢复到存款金额,并且双方都没有未完成的锁
+			return r.waitSelfTestChannel(channelIdentifier, quit, func(c *channeltype.Serialization, err error) bool {
+				return err == nil && c.OurBalance().Cmp(amount) == 0 &&
+					c.OurAmountLocked().Sign() == 0 && c.PartnerAmountLocked().Sign() == 0
+			})
+		}},
+		{SelfTestStageCooperativeSettle, func() error {
+			_, err := r.CooperativeSettle(tokenAddress, echoNode)
+			if err != nil {
+				return err
+			}
+			return r.waitSelfTestChannel(channelIdentifier, quit, func(c *channeltype.Serialization, err error) bool {
+				return err != nil || c.State == channeltype.StateSettled
+			})
+		}},
+	}
+	result = utils.NewAsyncResult()
+	result.SetCancel(func() error {
+		quitOnce.Do(func() {
+			close(quit)
+		})
+		return nil
+	})
+	_, err = r.Photon.operations.start("selftest", result, params.SelfTestTimeout)
+	if err != nil {
+		return
+	}
+	go func() {
+		err := runSelfTestStages(result, stages, quit)
+		if err != nil {
+			log.Warn(fmt.Sprintf("self test with %s err %s", echoNode.String(), err))
+		}
+		result.Result <- err
+	}()
+	return
+}
+
+/*
+echoTransfer 回声节点把收到的自检交易原样退回给发起方,退回的交易使用不同的附言,避免两个回声节点互相退回
+*/
+func (rs *Service) echoTransfer(tokenAddress, initiator common.Address, amount *big.Int) {
+	result := rs.transferAsyncClient(tokenAddress, amount, initiator, utils.EmptyHash, false, params.SelfTestEchoData, nil, &TransferOptions{})
+	err := <-result.Result
+	if err != nil {
+		log.Warn(fmt.Sprintf("echo self test transfer to %s err %s", utils.APex2(initiator), err))
+	}
+}
@@ -0,0 +1,49 @@
+package photon
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunSelfTestStages(t *testing.T) {
+	var ran []string
+	stage := func(name string, err error) selfTestStage {
+		return selfTestStage{name, func() error {
+			ran = append(ran, name)
+			return err
+		}}
+	}
+	result := utils.NewAsyncResult()
+	err := runSelfTestStages(result, []selfTestStage{
+		stage(SelfTestStageChain, nil),
+		stage(SelfTestStageOpenChannel, nil),
+	}, make(chan struct{}))
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, len(result.Progress()))
+
+	//失败的阶段之后的阶段不再执行
+	ran = nil
+	result = utils.NewAsyncResult()
+	err = runSelfTestStages(result, []selfTestStage{
+		stage(SelfTestStageChain, nil),
+		stage(SelfTestStagePayment, errors.New("no route")),
+		stage(SelfTestStageEcho, nil),
+	}, make(chan struct{}))
+	assert.NotNil(t, err)
+	assert.EqualValues(t, []string{SelfTestStageChain, SelfTestStagePayment}, ran)
+	progress := result.Progress()
+	assert.EqualValues(t, 2, len(progress))
+	assert.True(t, strings.Contains(progress[1], "result=fail"))
+
+	quit := make(chan struct{})
+	close(quit)
+	ran = nil
+	result = utils.NewAsyncResult()
+	err = runSelfTestStages(result, []selfTestStage{stage(SelfTestStageChain, nil)}, quit)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, 0, len(ran))
+}
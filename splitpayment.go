@@ -0,0 +1,303 @@
+package photon
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/pfsproxy"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//SplitPartInfo 拆分支付中的一笔交易,可以通过LockSecretHash查询这笔交易的进展
+type SplitPartInfo struct {
+	LockSecretHash common.Hash      `json:"lock_secret_hash"`
+	Amount         *big.Int         `json:"amount"`
+	Fee            *big.Int         `json:"fee"`
+	Path           []common.Address `json:"path"`
+}
+
+//SplitPaymentInfo 一次拆分支付以及拆分出来的所有交易
+type SplitPaymentInfo struct {
+	ID     common.Hash      `json:"payment_id"`
+	Token  common.Address   `json:"token_address"`
+	Target common.Address   `json:"target_address"`
+	Amount *big.Int         `json:"amount"`
+	Parts  []*SplitPartInfo `json:"parts"`
+}
+
+type splitPart struct {
+	*SplitPartInfo
+	secret          common.Hash
+	routeInfo       pfsproxy.FindPathResponse
+	secretRequested bool //收到了target的SecretRequest,说明这笔交易已经到达target,只在主线程中访问
+}
+
+/*
+splitPayment 正在进行的拆分支付.
+target的SecretRequest说明对应的交易已经到达,只有所有交易都到达以后才泄露密码,
+在此之前任何一笔交易失败,其他交易都会被撤销,target拿不到任何一笔钱.
+released和failed互斥,由lock保护,决定到底是泄露密码还是撤销
+*/
+type splitPayment struct {
+	info     *SplitPaymentInfo
+	parts    []*splitPart
+	lock     sync.Mutex
+	released bool
+	failed   bool
+}
+
+//allRequested 是否所有交易都已经到达target
+func (p *splitPayment) allRequested() bool {
+	for _, part := range p.parts {
+		if !part.secretRequested {
+			return false
+		}
+	}
+	return true
+}
+
+//release 所有交易都已到达,如果支付还没有失败,允许泄露密码
+func (p *splitPayment) release() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.failed {
+		return false
+	}
+	p.released = true
+	return true
+}
+
+//fail 有交易失败,如果还没有泄露密码,撤销其他交易
+func (p *splitPayment) fail() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.released {
+		return false
+	}
+	p.failed = true
+	return true
+}
+
+type splitCandidate struct {
+	channel  common.Hash
+	capacity *big.Int //第一跳通道可以发送的金额
+	fee      *big.Int //这条路由的总手续费
+}
+
+/*
+splitAmount 按照candidates的顺序把`amount`分配给各条路由,每条路由尽量多分,
+共用第一跳通道的路由共享这个通道的余额,每条路由还要扣掉自己的手续费.
+返回值和candidates一一对应,没有用到的路由为nil.
+最多拆分成maxParts笔,所有路由加起来也不够时返回ErrInsufficientBalance
+*/
+func splitAmount(amount *big.Int, candidates []*splitCandidate, maxParts int) (amounts []*big.Int, err error) {
+	if amount == nil || amount.Cmp(utils.BigInt0) <= 0 {
+		return nil, rerr.ErrInvalidAmount
+	}
+	amounts = make([]*big.Int, len(candidates))
+	remain := new(big.Int).Set(amount)
+	capacities := make(map[common.Hash]*big.Int)
+	parts := 0
+	for i, c := range candidates {
+		if remain.Cmp(utils.BigInt0) == 0 || parts >= maxParts {
+			break
+		}
+		capacity, ok := capacities[c.channel]
+		if !ok {
+			capacity = new(big.Int).Set(c.capacity)
+			capacities[c.channel] = capacity
+		}
+		fee := c.fee
+		if fee == nil {
+			fee = utils.BigInt0
+		}
+		available := new(big.Int).Sub(capacity, fee)
+		if available.Cmp(utils.BigInt0) <= 0 {
+			continue
+		}
+		part := available
+		if part.Cmp(remain) > 0 {
+			part = new(big.Int).Set(remain)
+		}
+		amounts[i] = part
+		capacity.Sub(capacity, new(big.Int).Add(part, fee))
+		remain.Sub(remain, part)
+		parts++
+	}
+	if remain.Cmp(utils.BigInt0) > 0 {
+		return nil, rerr.ErrInsufficientBalance.Append(fmt.Sprintf("not enough capacity on given routes to split %s into at most %d parts", amount, maxParts))
+	}
+	return amounts, nil
+}
+
+/*
+startSplitTransfer 把一次支付拆分成多笔交易,每笔交易走用户指定的一条路由,使用各自的密码.
+必须在主线程中调用
+*/
+func (rs *Service) startSplitTransfer(r *splitTransferReq) (result *utils.AsyncResult) {
+	if rs.getToken2ChannelGraph(r.TokenAddress) == nil {
+		return utils.NewAsyncResultWithError(rerr.ErrTokenNotFound)
+	}
+	if len(r.RouteInfo) == 0 {
+		return utils.NewAsyncResultWithError(rerr.ErrArgumentError.Append("route_info with full paths is required to split a payment"))
+	}
+	var candidates []*splitCandidate
+	var paths []pfsproxy.FindPathResponse
+	for _, path := range r.RouteInfo {
+		if len(path.Result) == 0 {
+			continue
+		}
+		hop := common.HexToAddress(path.Result[0])
+		ch := rs.getChannel(r.TokenAddress, hop)
+		if ch == nil || !ch.CanTransfer() {
+			continue
+		}
+		err := r.Exclusion.checkPath(r.TokenAddress, rs.Chain.GetRegistryAddress(), rs.NodeAddress, r.Target, hop, path.GetPath())
+		if err != nil {
+			log.Info(fmt.Sprintf("ignore split route to %s: %s", utils.APex2(r.Target), err))
+			continue
+		}
+		candidates = append(candidates, &splitCandidate{
+			channel:  ch.ChannelIdentifier.ChannelIdentifier,
+			capacity: ch.Distributable(),
+			fee:      path.Fee,
+		})
+		paths = append(paths, path)
+	}
+	if len(candidates) == 0 {
+		return utils.NewAsyncResultWithError(rerr.ErrNoAvailabeRoute)
+	}
+	amounts, err := splitAmount(r.Amount, candidates, params.MaxSplitParts)
+	if err != nil {
+		return utils.NewAsyncResultWithError(err)
+	}
+	p := &splitPayment{
+		info: &SplitPaymentInfo{
+			ID:     utils.NewRandomHash(),
+			Token:  r.TokenAddress,
+			Target: r.Target,
+			Amount: r.Amount,
+		},
+	}
+	for i, amount := range amounts {
+		if amount == nil {
+			continue
+		}
+		secret := utils.NewRandomHash()
+		fee := paths[i].Fee
+		if fee == nil {
+			fee = utils.BigInt0
+		}
+		part := &splitPart{
+			SplitPartInfo: &SplitPartInfo{
+				LockSecretHash: utils.ShaSecret(secret[:]),
+				Amount:         amount,
+				Fee:            fee,
+				Path:           paths[i].GetPath(),
+			},
+			secret:    secret,
+			routeInfo: paths[i],
+		}
+		p.parts = append(p.parts, part)
+		p.info.Parts = append(p.info.Parts, part.SplitPartInfo)
+	}
+	//先注册,保证任何一笔交易的SecretRequest都不会在其他交易到达之前被处理
+	for _, part := range p.parts {
+		rs.SecretRequestPredictorMap[part.LockSecretHash] = rs.splitSecretRequestPredictor(p, part)
+	}
+	rs.splitPayments[p.info.ID] = p
+	log.Info(fmt.Sprintf("split payment %s of %s to %s into %d parts", utils.HPex(p.info.ID), r.Amount, utils.APex2(r.Target), len(p.parts)))
+	var partResults []*utils.AsyncResult
+	for _, part := range p.parts {
+		partResults = append(partResults, rs.startMediatedTransferWithSecret(r.TokenAddress, r.Target, part.Amount, part.secret, r.Data, nil, []pfsproxy.FindPathResponse{part.routeInfo}, r.Exclusion, nil))
+	}
+	result = utils.NewAsyncResult()
+	result.Tag = p.info
+	go rs.waitSplitPayment(p, partResults, result)
+	return result
+}
+
+/*
+splitSecretRequestPredictor 在所有交易都到达target之前忽略合法的SecretRequest,
+不回复ack,target会一直重发,直到最后一笔交易到达以后再一起处理.
+金额或者发送方不对的SecretRequest交给状态机,按照异常的SecretRequest处理
+*/
+func (rs *Service) splitSecretRequestPredictor(p *splitPayment, part *splitPart) SecretRequestPredictor {
+	return func(msg *encoding.SecretRequest) (ignore bool) {
+		if msg.Sender != p.info.Target || msg.PaymentAmount.Cmp(part.Amount) != 0 {
+			return false
+		}
+		part.secretRequested = true
+		if !p.allRequested() {
+			log.Info(fmt.Sprintf("split payment %s part %s reached target, waiting for other parts", utils.HPex(p.info.ID), utils.HPex(part.LockSecretHash)))
+			return true
+		}
+		if !p.release() {
+			//支付已经失败,正在撤销,不能泄露密码
+			return true
+		}
+		log.Info(fmt.Sprintf("all parts of split payment %s reached target, reveal secrets", utils.HPex(p.info.ID)))
+		for _, other := range p.parts {
+			delete(rs.SecretRequestPredictorMap, other.LockSecretHash)
+		}
+		return false
+	}
+}
+
+/*
+waitSplitPayment 等待所有交易的结果,泄露密码之前任何一笔交易失败都撤销其他交易.
+结果为第一个错误,所有交易都成功时为nil
+*/
+func (rs *Service) waitSplitPayment(p *splitPayment, partResults []*utils.AsyncResult, result *utils.AsyncResult) {
+	errs := make(chan error, len(partResults))
+	for _, pr := range partResults {
+		go func(pr *utils.AsyncResult) {
+			select {
+			case err := <-pr.Result:
+				errs <- err
+			case <-rs.quitChan:
+			}
+		}(pr)
+	}
+	var firstErr error
+	for range partResults {
+		select {
+		case err := <-errs:
+			if err == nil || firstErr != nil {
+				continue
+			}
+			firstErr = err
+			if p.fail() {
+				log.Warn(fmt.Sprintf("split payment %s failed before secret revealed, cancel all parts: %s", utils.HPex(p.info.ID), err))
+				for _, part := range p.parts {
+					//已经失败的交易撤销时会报错,忽略
+					<-rs.cancelTransferClient(part.LockSecretHash, p.info.Token).Result
+				}
+			} else {
+				log.Error(fmt.Sprintf("split payment %s part failed after secret revealed: %s", utils.HPex(p.info.ID), err))
+			}
+		case <-rs.quitChan:
+			return
+		}
+	}
+	rs.splitTransferFinishedClient(p.info.ID)
+	result.Result <- firstErr
+}
+
+//splitTransferFinished 拆分支付结束,清理残留的SecretRequestPredictor
+func (rs *Service) splitTransferFinished(r *splitTransferFinishedReq) *utils.AsyncResult {
+	p, ok := rs.splitPayments[r.id]
+	if ok {
+		for _, part := range p.parts {
+			delete(rs.SecretRequestPredictorMap, part.LockSecretHash)
+		}
+		delete(rs.splitPayments, r.id)
+	}
+	return utils.NewAsyncResultWithError(nil)
+}
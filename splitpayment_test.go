@@ -0,0 +1,38 @@
+package photon
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitAmount(t *testing.T) {
+	ch1, ch2 := utils.NewRandomHash(), utils.NewRandomHash()
+	candidates := []*splitCandidate{
+		{channel: ch1, capacity: big.NewInt(60), fee: big.NewInt(5)},
+		//和第一条路由共用通道,余额已经被第一条路由用完
+		{channel: ch1, capacity: big.NewInt(60), fee: nil},
+		{channel: ch2, capacity: big.NewInt(50), fee: big.NewInt(1)},
+	}
+	amounts, err := splitAmount(big.NewInt(100), candidates, 4)
+	assert.Nil(t, err)
+	assert.EqualValues(t, big.NewInt(55), amounts[0])
+	assert.Nil(t, amounts[1])
+	assert.EqualValues(t, big.NewInt(45), amounts[2])
+
+	//第一条路由足够时不拆分
+	amounts, err = splitAmount(big.NewInt(30), candidates, 4)
+	assert.Nil(t, err)
+	assert.EqualValues(t, big.NewInt(30), amounts[0])
+	assert.Nil(t, amounts[1])
+	assert.Nil(t, amounts[2])
+
+	_, err = splitAmount(big.NewInt(200), candidates, 4)
+	assert.NotNil(t, err)
+	_, err = splitAmount(big.NewInt(100), candidates, 1)
+	assert.NotNil(t, err)
+	_, err = splitAmount(big.NewInt(0), candidates, 4)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,177 @@
+package photon
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/gob"
+	"fmt"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
+)
+
+/*
+StateBackupPayload 发送给备份节点的通道状态,用自己的公钥加密,只有自己的私钥才能解密
+*/
+type StateBackupPayload struct {
+	Owner    common.Address
+	Sequence int64
+	Full     bool
+	Channels []*channeltype.Serialization
+	Removed  []common.Hash //上次备份以后已经不存在的通道
+}
+
+func encryptStateBackup(key *ecdsa.PrivateKey, p *StateBackupPayload) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	err := gob.NewEncoder(buf).Encode(p)
+	if err != nil {
+		return nil, rerr.ErrUnknown.AppendError(err)
+	}
+	return ecies.Encrypt(rand.Reader, ecies.ImportECDSAPublic(&key.PublicKey), buf.Bytes(), nil, nil)
+}
+
+//DecryptStateBackup 用备份所有者的私钥解密一次备份
+func DecryptStateBackup(key *ecdsa.PrivateKey, data []byte) (p *StateBackupPayload, err error) {
+	plain, err := ecies.ImportECDSA(key).Decrypt(rand.Reader, data, nil, nil)
+	if err != nil {
+		return nil, rerr.ErrArgumentError.Printf("decrypt state backup err %s", err)
+	}
+	p = new(StateBackupPayload)
+	err = gob.NewDecoder(bytes.NewReader(plain)).Decode(p)
+	if err != nil {
+		return nil, rerr.ErrArgumentError.Printf("decode state backup err %s", err)
+	}
+	return
+}
+
+/*
+RestoreStateBackup 从备份节点取回的`chunks`中恢复所有通道的最新状态,
+chunks必须从一次全量备份开始,按照顺序依次应用
+*/
+func RestoreStateBackup(key *ecdsa.PrivateKey, chunks []*models.StateBackupChunk) (channels map[common.Hash]*channeltype.Serialization, err error) {
+	channels = make(map[common.Hash]*channeltype.Serialization)
+	for i, c := range chunks {
+		if i == 0 && !c.Full {
+			return nil, rerr.ErrArgumentError.Printf("state backup %d is not a full backup", c.Sequence)
+		}
+		p, err := DecryptStateBackup(key, c.Data())
+		if err != nil {
+			return nil, err
+		}
+		if p.Full {
+			channels = make(map[common.Hash]*channeltype.Serialization)
+		}
+		for _, ch := range p.Channels {
+			channels[ch.ChannelIdentifier.ChannelIdentifier] = ch
+		}
+		for _, id := range p.Removed {
+			delete(channels, id)
+		}
+	}
+	return
+}
+
+/*
+backupStateToPeer 将上次备份以后发生变化的通道加密以后发送给备份节点,
+启动后的第一次以及每隔StateBackupFullInterval次发送全量备份
+*/
+func (rs *Service) backupStateToPeer(blockNumber int64) {
+	peer := rs.Config.StateBackupPeer
+	if peer == utils.EmptyAddress || peer == rs.NodeAddress {
+		return
+	}
+	chs, err := rs.dao.GetChannelList(utils.EmptyAddress, utils.EmptyAddress)
+	if err != nil {
+		log.Error(fmt.Sprintf("backupStateToPeer GetChannelList err %s", err))
+		return
+	}
+	full := rs.stateBackupHashes == nil || rs.stateBackupCount%params.StateBackupFullInterval == 0
+	p := &StateBackupPayload{
+		Owner:    rs.NodeAddress,
+		Sequence: blockNumber,
+		Full:     full,
+	}
+	hashes := make(map[common.Hash]common.Hash)
+	for _, ch := range chs {
+		buf := new(bytes.Buffer)
+		err = gob.NewEncoder(buf).Encode(ch)
+		if err != nil {
+			log.Error(fmt.Sprintf("backupStateToPeer encode channel err %s", err))
+			return
+		}
+		id := ch.ChannelIdentifier.ChannelIdentifier
+		hashes[id] = utils.Sha3(buf.Bytes())
+		if full || rs.stateBackupHashes[id] != hashes[id] {
+			p.Channels = append(p.Channels, ch)
+		}
+	}
+	if !full {
+		for id := range rs.stateBackupHashes {
+			if _, ok := hashes[id]; !ok {
+				p.Removed = append(p.Removed, id)
+			}
+		}
+		if len(p.Channels) == 0 && len(p.Removed) == 0 {
+			return
+		}
+	}
+	data, err := encryptStateBackup(rs.PrivateKey, p)
+	if err != nil {
+		log.Error(fmt.Sprintf("backupStateToPeer encrypt err %s", err))
+		return
+	}
+	total := (len(data) + params.StateBackupFragmentSize - 1) / params.StateBackupFragmentSize
+	for i := 0; i < total; i++ {
+		end := (i + 1) * params.StateBackupFragmentSize
+		if end > len(data) {
+			end = len(data)
+		}
+		msg := encoding.NewStateBackup(p.Sequence, full, uint16(i), uint16(total), data[i*params.StateBackupFragmentSize:end])
+		err = msg.Sign(rs.PrivateKey, msg)
+		if err == nil {
+			err = rs.sendAsync(peer, msg)
+		}
+		if err != nil {
+			log.Error(fmt.Sprintf("backupStateToPeer send to %s err %s", utils.APex2(peer), err))
+			return
+		}
+	}
+	log.Info(fmt.Sprintf("send state backup %d to %s,full=%v,channels=%d,removed=%d,fragments=%d",
+		p.Sequence, utils.APex2(peer), full, len(p.Channels), len(p.Removed), total))
+	rs.stateBackupHashes = hashes
+	rs.stateBackupCount++
+}
+
+/*
+savePeerStateBackup 保存备份节点发来的备份分片,只接受配置的备份节点发来的备份
+*/
+func (rs *Service) savePeerStateBackup(msg *encoding.StateBackup) error {
+	if msg.Sender != rs.Config.StateBackupPeer {
+		return rerr.ErrPartnerNotAllowed.Printf("%s is not my state backup peer", msg.Sender.String())
+	}
+	b, err := rs.dao.GetPeerStateBackup(msg.Sender)
+	if err == rerr.ErrNotFound {
+		b, err = models.NewPeerStateBackup(msg.Sender), nil
+	}
+	if err != nil {
+		return err
+	}
+	complete, err := b.AddFragment(msg.Sequence, msg.Full, int(msg.Index), int(msg.Total), msg.Data, time.Now().Unix())
+	if err != nil {
+		log.Warn(fmt.Sprintf("ignore state backup %s : %s", msg, err))
+		return nil
+	}
+	if complete {
+		log.Info(fmt.Sprintf("receive state backup %d from %s,full=%v", msg.Sequence, utils.APex2(msg.Sender), msg.Full))
+	}
+	return rs.dao.SavePeerStateBackup(b)
+}
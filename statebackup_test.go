@@ -0,0 +1,49 @@
+package photon
+
+import (
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/network/rpc/contracts"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestoreStateBackup(t *testing.T) {
+	key, addr := utils.MakePrivateKeyAddress()
+	newChannel := func() *channeltype.Serialization {
+		return &channeltype.Serialization{
+			ChannelIdentifier: &contracts.ChannelUniqueID{ChannelIdentifier: utils.NewRandomHash()},
+			OurAddress:        addr,
+		}
+	}
+	ch1, ch2 := newChannel(), newChannel()
+	var chunks []*models.StateBackupChunk
+	for _, p := range []*StateBackupPayload{
+		{Owner: addr, Sequence: 1, Full: true, Channels: []*channeltype.Serialization{ch1}},
+		{Owner: addr, Sequence: 2, Channels: []*channeltype.Serialization{ch2}, Removed: []common.Hash{ch1.ChannelIdentifier.ChannelIdentifier}},
+	} {
+		data, err := encryptStateBackup(key, p)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		chunks = append(chunks, &models.StateBackupChunk{Sequence: p.Sequence, Full: p.Full, Total: 1, Fragments: [][]byte{data}})
+	}
+	channels, err := RestoreStateBackup(key, chunks)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.EqualValues(t, 1, len(channels))
+	assert.EqualValues(t, addr, channels[ch2.ChannelIdentifier.ChannelIdentifier].OurAddress)
+	//其他节点的私钥无法解密
+	otherKey, _ := utils.MakePrivateKeyAddress()
+	_, err = RestoreStateBackup(otherKey, chunks)
+	assert.NotNil(t, err)
+	//必须从全量备份开始恢复
+	_, err = RestoreStateBackup(key, chunks[1:])
+	assert.NotNil(t, err)
+}
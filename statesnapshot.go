@@ -0,0 +1,264 @@
+package photon
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/transfer"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer/initiator"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer/mediator"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer/target"
+	"github.com/SmartMeshFoundation/Photon/transfer/route"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+发起方,中间节点,接收方的StateManager每处理完一个StateChange,并且事件也处理完毕以后,保存一次完整的快照.
+重启以后直接从快照恢复,进行中的交易可以继续完成.
+不保存StateChange重放:重放时通道已经扣过钱,比如发起方的tryNewRoute按照AvailableBalance选择路由,
+重放的结果可能和通道中实际的BalanceProof不一致.
+没有产生事件的BlockStateChange不保存快照,否则每个块都要为每一笔进行中的交易写一次数据库,
+重启以后收到新块会重新处理.
+route.State不保存通道指针,Db也不保存,恢复的时候重新关联.
+crashnode的StateManager重启以后会根据通道中的锁重建,不需要保存.
+*/
+
+func stateManagerKey(sm *transfer.StateManager) common.Hash {
+	return utils.Sha3(sm.Identifier[:], sm.TokenAddress[:])
+}
+
+func stateTransitionByName(name string) transfer.FuncStateTransition {
+	switch name {
+	case initiator.NameInitiatorTransition:
+		return initiator.StateTransition
+	case mediator.NameMediatorTransition:
+		return mediator.StateTransition
+	case target.NameTargetTransition:
+		return target.StateTransiton
+	}
+	return nil
+}
+
+//swapDb 替换state或者StateChange中的Db,返回原来的Db
+func swapDb(v interface{}, db channeltype.Db) (old channeltype.Db) {
+	switch s := v.(type) {
+	case *mediatedtransfer.InitiatorState:
+		old, s.Db = s.Db, db
+	case *mediatedtransfer.MediatorState:
+		old, s.Db = s.Db, db
+	case *mediatedtransfer.TargetState:
+		old, s.Db = s.Db, db
+	case *mediatedtransfer.ActionInitInitiatorStateChange:
+		old, s.Db = s.Db, db
+	case *mediatedtransfer.ActionInitMediatorStateChange:
+		old, s.Db = s.Db, db
+	case *mediatedtransfer.ActionInitTargetStateChange:
+		old, s.Db = s.Db, db
+	}
+	return
+}
+
+//gobEncodeWithoutDb 编码v,holder中的Db不参与编码,编码完成以后恢复
+func gobEncodeWithoutDb(v interface{}, holder interface{}) ([]byte, error) {
+	old := swapDb(holder, nil)
+	defer swapDb(holder, old)
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+func encodeStateManager(sm *transfer.StateManager) ([]byte, error) {
+	//重启以后不会再用这个消息回复ack,没必要保存
+	msg := sm.LastReceivedMessage
+	sm.LastReceivedMessage = nil
+	defer func() {
+		sm.LastReceivedMessage = msg
+	}()
+	return gobEncodeWithoutDb(sm, sm.CurrentState)
+}
+
+func decodeStateManager(data []byte) (sm *transfer.StateManager, err error) {
+	sm = new(transfer.StateManager)
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(sm)
+	if err != nil {
+		return
+	}
+	sm.FuncStateTransition = stateTransitionByName(sm.Name)
+	if sm.FuncStateTransition == nil {
+		err = fmt.Errorf("unknown state manager %s", sm.Name)
+	}
+	return
+}
+
+/*
+snapshotStateManager StateManager处理完`st`,并且事件`events`也处理完毕以后调用.
+交易结束,StateManager被删除时,快照也一起删除
+*/
+func (rs *Service) snapshotStateManager(sm *transfer.StateManager, st transfer.StateChange, events []transfer.Event) {
+	if stateTransitionByName(sm.Name) == nil {
+		return
+	}
+	key := stateManagerKey(sm)
+	if rs.Transfer2StateManager[key] != sm {
+		err := rs.dao.RemoveStateManagerSnapshot(key)
+		if err != nil {
+			log.Warn(fmt.Sprintf("RemoveStateManagerSnapshot %s err %s", utils.HPex(key), err))
+		}
+		return
+	}
+	if _, ok := st.(*transfer.BlockStateChange); ok && len(events) == 0 {
+		return
+	}
+	sm.StateChangeSeq++
+	rs.saveStateManagerSnapshot(key, sm)
+}
+
+func (rs *Service) saveStateManagerSnapshot(key common.Hash, sm *transfer.StateManager) {
+	data, err := encodeStateManager(sm)
+	if err != nil {
+		//保存不了就删掉旧的快照,重启以后按照crashnode处理,而不是恢复到一个错误的状态
+		log.Error(fmt.Sprintf("encode state manager %s err %s", utils.HPex(key), err))
+		err = rs.dao.RemoveStateManagerSnapshot(key)
+		if err != nil {
+			log.Error(fmt.Sprintf("RemoveStateManagerSnapshot %s err %s", utils.HPex(key), err))
+		}
+		return
+	}
+	err = rs.dao.SaveStateManagerSnapshot(&models.StateManagerSnapshot{
+		Key:  key,
+		Seq:  sm.StateChangeSeq,
+		Data: data,
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("SaveStateManagerSnapshot %s err %s", utils.HPex(key), err))
+	}
+}
+
+//rebindRoute 通道必须存在
+func (rs *Service) rebindRoute(r *route.State) error {
+	if r == nil {
+		return nil
+	}
+	ch, err := rs.findChannelByIdentifier(r.ChannelIdentifier)
+	if err != nil {
+		return err
+	}
+	r.SetChannel(ch)
+	return nil
+}
+
+//rebindRoutesState 通道已经不存在的路由不可能再使用,直接去掉
+func (rs *Service) rebindRoutesState(routes *route.RoutesState) {
+	if routes == nil {
+		return
+	}
+	filter := func(rss []*route.State) (result []*route.State) {
+		for _, r := range rss {
+			if rs.rebindRoute(r) == nil {
+				result = append(result, r)
+			}
+		}
+		return
+	}
+	routes.AvailableRoutes = filter(routes.AvailableRoutes)
+	routes.IgnoredRoutes = filter(routes.IgnoredRoutes)
+	routes.RefundedRoutes = filter(routes.RefundedRoutes)
+	var canceled []*route.CanceledRoute
+	for _, c := range routes.CanceledRoutes {
+		if rs.rebindRoute(c.Route) == nil {
+			canceled = append(canceled, c)
+		}
+	}
+	routes.CanceledRoutes = canceled
+}
+
+//rebind 重新关联从快照或者日志中恢复的state或者StateChange中的通道和Db
+func (rs *Service) rebind(v interface{}) (err error) {
+	swapDb(v, rs.dao)
+	switch s := v.(type) {
+	case *mediatedtransfer.InitiatorState:
+		rs.rebindRoutesState(s.Routes)
+		err = rs.rebindRoute(s.Route)
+	case *mediatedtransfer.MediatorState:
+		rs.rebindRoutesState(s.Routes)
+		for _, p := range s.TransfersPair {
+			err = rs.rebindRoute(p.PayeeRoute)
+			if err != nil {
+				return
+			}
+			err = rs.rebindRoute(p.PayerRoute)
+			if err != nil {
+				return
+			}
+		}
+	case *mediatedtransfer.TargetState:
+		err = rs.rebindRoute(s.FromRoute)
+	case *mediatedtransfer.ActionInitInitiatorStateChange:
+		rs.rebindRoutesState(s.Routes)
+	case *mediatedtransfer.ActionInitMediatorStateChange:
+		rs.rebindRoutesState(s.Routes)
+		err = rs.rebindRoute(s.FromRoute)
+	case *mediatedtransfer.MediatorReReceiveStateChange:
+		err = rs.rebindRoute(s.FromRoute)
+	case *mediatedtransfer.ActionInitTargetStateChange:
+		err = rs.rebindRoute(s.FromRoute)
+	}
+	return
+}
+
+/*
+restoreStateManager 从快照恢复,旧版本保存的快照后面还有StateChange日志,
+不重放就会落后于通道的状态,这种快照不能使用
+*/
+func (rs *Service) restoreStateManager(s *models.StateManagerSnapshot) (sm *transfer.StateManager, err error) {
+	logs, err := rs.dao.GetStateChangeLogs(s.Key)
+	if err != nil {
+		return
+	}
+	if len(logs) > 0 {
+		err = fmt.Errorf("snapshot is followed by %d state changes of an older version", len(logs))
+		return
+	}
+	sm, err = decodeStateManager(s.Data)
+	if err != nil {
+		return
+	}
+	err = rs.rebind(sm.CurrentState)
+	return
+}
+
+/*
+restoreStateManagers 恢复所有保存了快照的StateManager,
+恢复失败的删除快照,这笔交易会和以前一样按照crashnode处理
+*/
+func (rs *Service) restoreStateManagers() map[common.Hash]*transfer.StateManager {
+	managers := make(map[common.Hash]*transfer.StateManager)
+	ss, err := rs.dao.GetAllStateManagerSnapshots()
+	if err != nil {
+		log.Error(fmt.Sprintf("GetAllStateManagerSnapshots err %s", err))
+		return managers
+	}
+	for _, s := range ss {
+		sm, err := rs.restoreStateManager(s)
+		if err == nil && sm.CurrentState == nil {
+			err = fmt.Errorf("transfer already finished")
+		}
+		if err != nil {
+			log.Warn(fmt.Sprintf("restore state manager %s err %s, fall back to crash restore", utils.HPex(s.Key), err))
+			err = rs.dao.RemoveStateManagerSnapshot(s.Key)
+			if err != nil {
+				log.Error(fmt.Sprintf("RemoveStateManagerSnapshot %s err %s", utils.HPex(s.Key), err))
+			}
+			continue
+		}
+		log.Info(fmt.Sprintf("restore state manager %s %s from snapshot %d", sm.Name, utils.HPex(sm.Identifier), sm.StateChangeSeq))
+		managers[s.Key] = sm
+	}
+	return managers
+}
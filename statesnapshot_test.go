@@ -0,0 +1,135 @@
+package photon
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/channel"
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/network/graph"
+	"github.com/SmartMeshFoundation/Photon/network/rpc/contracts"
+	"github.com/SmartMeshFoundation/Photon/transfer"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer/target"
+	"github.com/SmartMeshFoundation/Photon/transfer/route"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateManagerSnapshot(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	token := utils.NewRandomAddress()
+	ch := &channel.Channel{
+		ChannelIdentifier: contracts.ChannelUniqueID{ChannelIdentifier: utils.NewRandomHash()},
+		PartnerState:      &channel.EndState{Address: utils.NewRandomAddress()},
+		TokenAddress:      token,
+		RevealTimeout:     5,
+		State:             channeltype.StateOpened,
+	}
+	rs := &Service{
+		dao:                   dao,
+		Transfer2StateManager: make(map[common.Hash]*transfer.StateManager),
+		Token2ChannelGraph: map[common.Address]*graph.ChannelGraph{
+			token: {ChannelIdentifier2Channel: map[common.Hash]*channel.Channel{ch.ChannelIdentifier.ChannelIdentifier: ch}},
+		},
+	}
+	secret := utils.NewRandomHash()
+	state := &mediatedtransfer.TargetState{
+		OurAddress: utils.NewRandomAddress(),
+		FromRoute:  route.NewState(ch, nil),
+		FromTransfer: &mediatedtransfer.LockedTransferState{
+			TargetAmount:   big.NewInt(10),
+			Amount:         big.NewInt(10),
+			Token:          token,
+			Expiration:     100,
+			LockSecretHash: utils.ShaSecret(secret[:]),
+			Fee:            big.NewInt(0),
+		},
+		BlockNumber: 1,
+		State:       mediatedtransfer.StateSecretRequest,
+		Db:          dao,
+	}
+	sm := transfer.NewStateManager(target.StateTransiton, state, target.NameTargetTransition, state.FromTransfer.LockSecretHash, token)
+	key := stateManagerKey(sm)
+	rs.Transfer2StateManager[key] = sm
+	stateChanges := []transfer.StateChange{
+		&transfer.BlockStateChange{BlockNumber: 2},
+		&transfer.BlockStateChange{BlockNumber: 3},
+		&mediatedtransfer.ReceiveSecretRevealStateChange{Secret: secret, Message: encoding.NewRevealSecret(secret)},
+		&transfer.BlockStateChange{BlockNumber: 4},
+		&transfer.BlockStateChange{BlockNumber: 5},
+	}
+	for _, st := range stateChanges {
+		events := sm.Dispatch(st)
+		rs.snapshotStateManager(sm, st, events)
+	}
+	//编码时去掉的Db要还回去
+	assert.Equal(t, dao, state.Db)
+	//没有事件的新块不保存快照,收到密码以后保存,不记录任何日志
+	ss, err := dao.GetAllStateManagerSnapshots()
+	assert.Nil(t, err)
+	assert.Len(t, ss, 1)
+	assert.EqualValues(t, 1, ss[0].Seq)
+	logs, err := dao.GetStateChangeLogs(key)
+	assert.Nil(t, err)
+	assert.Len(t, logs, 0)
+
+	sm2, err := rs.restoreStateManager(ss[0])
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.EqualValues(t, 1, sm2.StateChangeSeq)
+	state2 := sm2.CurrentState.(*mediatedtransfer.TargetState)
+	//快照之后的新块重启以后会重新收到
+	assert.EqualValues(t, 3, state2.BlockNumber)
+	assert.Equal(t, mediatedtransfer.StateRevealSecret, state2.State)
+	assert.Equal(t, secret, state2.FromTransfer.Secret)
+	assert.Equal(t, ch, state2.FromRoute.Channel())
+	assert.Equal(t, dao, state2.Db)
+
+	//旧版本的快照后面还有日志,不能使用
+	err = dao.NewStateChangeLog(models.NewStateChangeLog(key, 2, []byte{1}))
+	assert.Nil(t, err)
+	_, err = rs.restoreStateManager(ss[0])
+	assert.NotNil(t, err)
+
+	//交易结束以后快照和日志都删除
+	delete(rs.Transfer2StateManager, key)
+	rs.snapshotStateManager(sm, &transfer.BlockStateChange{BlockNumber: 6}, nil)
+	ss, err = dao.GetAllStateManagerSnapshots()
+	assert.Nil(t, err)
+	assert.Len(t, ss, 0)
+	logs, err = dao.GetStateChangeLogs(key)
+	assert.Nil(t, err)
+	assert.Len(t, logs, 0)
+}
+
+func TestRestoreStateManagerChannelGone(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	rs := &Service{
+		dao:                   dao,
+		Transfer2StateManager: make(map[common.Hash]*transfer.StateManager),
+	}
+	state := &mediatedtransfer.TargetState{
+		FromRoute: &route.State{ChannelIdentifier: utils.NewRandomHash()},
+		FromTransfer: &mediatedtransfer.LockedTransferState{
+			LockSecretHash: utils.NewRandomHash(),
+		},
+	}
+	sm := transfer.NewStateManager(target.StateTransiton, state, target.NameTargetTransition, state.FromTransfer.LockSecretHash, utils.NewRandomAddress())
+	key := stateManagerKey(sm)
+	rs.Transfer2StateManager[key] = sm
+	rs.snapshotStateManager(sm, &mediatedtransfer.ReceiveSecretRevealStateChange{}, nil)
+	//通道已经不存在,只能按照crashnode处理
+	managers := rs.restoreStateManagers()
+	assert.Len(t, managers, 0)
+	ss, err := dao.GetAllStateManagerSnapshots()
+	assert.Nil(t, err)
+	assert.Len(t, ss, 0)
+}
@@ -0,0 +1,251 @@
+package photon
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+两个节点协商代币交换:maker生成密码并把SwapOffer发给taker,taker接受以后登记等待maker的交易,并用SwapResponse答复,
+maker收到同意以后用这个密码发出自己的交易,之后的过程和token_swaps接口完全一样,两笔交易要么都成功要么都失败.
+双方都在数据库中记录交换的状态,发起交易以后的监听只保存在内存中,重启以后状态不再更新
+*/
+
+const initiateSwapReqName = "initiateSwap"
+const respondSwapReqName = "respondSwap"
+
+type initiateSwapReq struct {
+	taker       common.Address
+	makerToken  common.Address
+	makerAmount *big.Int
+	takerToken  common.Address
+	takerAmount *big.Int
+}
+
+type respondSwapReq struct {
+	lockSecretHash common.Hash
+	accept         bool
+	reason         string
+}
+
+func (rs *Service) initiateSwapClient(taker, makerToken common.Address, makerAmount *big.Int, takerToken common.Address, takerAmount *big.Int) *utils.AsyncResult {
+	req := &apiReq{
+		ReqID: utils.RandomString(10),
+		Name:  initiateSwapReqName,
+		Req: &initiateSwapReq{
+			taker:       taker,
+			makerToken:  makerToken,
+			makerAmount: makerAmount,
+			takerToken:  takerToken,
+			takerAmount: takerAmount,
+		},
+	}
+	return rs.sendReqClient(req)
+}
+
+func (rs *Service) respondSwapClient(lockSecretHash common.Hash, accept bool, reason string) *utils.AsyncResult {
+	req := &apiReq{
+		ReqID: utils.RandomString(10),
+		Name:  respondSwapReqName,
+		Req: &respondSwapReq{
+			lockSecretHash: lockSecretHash,
+			accept:         accept,
+			reason:         reason,
+		},
+	}
+	return rs.sendReqClient(req)
+}
+
+//checkSwapTokens 交换的两种token我都必须有通道
+func (rs *Service) checkSwapTokens(tokens ...common.Address) error {
+	for _, token := range tokens {
+		g := rs.getToken2ChannelGraph(token)
+		if g == nil || len(g.ChannelIdentifier2Channel) == 0 {
+			return rerr.ErrTokenNotFound.Printf("no channel on token %s", token.String())
+		}
+	}
+	return nil
+}
+
+func (rs *Service) saveSwapOrder(o *models.SwapOrder, status, errMsg string) {
+	o.Status = status
+	o.Error = errMsg
+	o.UpdateTime = time.Now().Unix()
+	err := rs.dao.SaveSwapOrder(o)
+	if err != nil {
+		log.Error(fmt.Sprintf("save swap order %s err %s", utils.HPex(o.LockSecretHash), err))
+	}
+}
+
+//swapOrderToTokenSwap 双方使用同样的参数,From是maker的一方
+func swapOrderToTokenSwap(o *models.SwapOrder) *TokenSwap {
+	return &TokenSwap{
+		LockSecretHash:  o.LockSecretHash,
+		Secret:          o.Secret,
+		FromToken:       o.MakerToken,
+		FromAmount:      new(big.Int).Set(o.MakerAmount),
+		FromNodeAddress: o.Maker,
+		ToToken:         o.TakerToken,
+		ToAmount:        new(big.Int).Set(o.TakerAmount),
+		ToNodeAddress:   o.Taker,
+	}
+}
+
+/*
+initiateSwap 作为maker生成密码,保存交换并把SwapOffer发给taker
+*/
+func (rs *Service) initiateSwap(r *initiateSwapReq) (result *utils.AsyncResult) {
+	result = utils.NewAsyncResult()
+	if r.taker == rs.NodeAddress {
+		result.Result <- rerr.ErrArgumentError.Append("cannot swap with myself")
+		return
+	}
+	err := rs.checkSwapTokens(r.makerToken, r.takerToken)
+	if err != nil {
+		result.Result <- err
+		return
+	}
+	secret := utils.NewRandomHash()
+	now := time.Now().Unix()
+	o := &models.SwapOrder{
+		LockSecretHash: utils.ShaSecret(secret[:]),
+		Secret:         secret,
+		Maker:          rs.NodeAddress,
+		Taker:          r.taker,
+		MakerToken:     r.makerToken,
+		MakerAmount:    r.makerAmount,
+		TakerToken:     r.takerToken,
+		TakerAmount:    r.takerAmount,
+		IsMaker:        true,
+		Status:         models.SwapStatusOffered,
+		CreateTime:     now,
+		UpdateTime:     now,
+	}
+	msg := encoding.NewSwapOffer(o.LockSecretHash, o.MakerToken, o.MakerAmount, o.TakerToken, o.TakerAmount)
+	err = msg.Sign(rs.PrivateKey, msg)
+	if err == nil {
+		err = rs.dao.SaveSwapOrder(o)
+	}
+	if err == nil {
+		err = rs.sendAsync(o.Taker, msg)
+	}
+	if err != nil {
+		result.Result <- err
+		return
+	}
+	result.Tag = o
+	result.Result <- nil
+	return
+}
+
+/*
+respondSwap 作为taker答复收到的交换,接受时先登记等待maker的交易,再通知maker
+*/
+func (rs *Service) respondSwap(r *respondSwapReq) (result *utils.AsyncResult) {
+	o, err := rs.dao.GetSwapOrder(r.lockSecretHash)
+	if err != nil || o.IsMaker {
+		return utils.NewAsyncResultWithError(rerr.ErrNotFound.Printf("swap %s", r.lockSecretHash.String()))
+	}
+	if o.Status != models.SwapStatusOffered {
+		return utils.NewAsyncResultWithError(rerr.InvalidState(fmt.Sprintf("swap already %s", o.Status)))
+	}
+	if r.accept {
+		err = rs.checkSwapTokens(o.MakerToken, o.TakerToken)
+		if err != nil {
+			return utils.NewAsyncResultWithError(err)
+		}
+		rs.tokenSwapTaker(swapOrderToTokenSwap(o))
+		rs.saveSwapOrder(o, models.SwapStatusAccepted, "")
+	} else {
+		rs.saveSwapOrder(o, models.SwapStatusRejected, r.reason)
+	}
+	msg := encoding.NewSwapResponse(o.LockSecretHash, r.accept, r.reason)
+	err = msg.Sign(rs.PrivateKey, msg)
+	if err == nil {
+		err = rs.sendAsync(o.Maker, msg)
+	}
+	result = utils.NewAsyncResultWithError(err)
+	result.Tag = o
+	return
+}
+
+/*
+onSwapOffer 记录maker发来的交换,等待用户接受或者拒绝,重复的消息直接忽略
+*/
+func (rs *Service) onSwapOffer(msg *encoding.SwapOffer) error {
+	if msg.MakerAmount.Sign() <= 0 || msg.TakerAmount.Sign() <= 0 {
+		return rerr.ErrArgumentError.Printf("invalid SwapOffer %s", msg)
+	}
+	if _, err := rs.dao.GetSwapOrder(msg.LockSecretHash); err == nil {
+		return nil
+	}
+	err := rs.checkSwapTokens(msg.MakerToken, msg.TakerToken)
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	o := &models.SwapOrder{
+		LockSecretHash: msg.LockSecretHash,
+		Maker:          msg.Sender,
+		Taker:          rs.NodeAddress,
+		MakerToken:     msg.MakerToken,
+		MakerAmount:    msg.MakerAmount,
+		TakerToken:     msg.TakerToken,
+		TakerAmount:    msg.TakerAmount,
+		Status:         models.SwapStatusOffered,
+		CreateTime:     now,
+		UpdateTime:     now,
+	}
+	log.Info(fmt.Sprintf("receive swap offer %s", msg))
+	return rs.dao.SaveSwapOrder(o)
+}
+
+/*
+onSwapResponse taker接受以后maker发出自己的交易,收到taker的交易之前不会泄露密码
+*/
+func (rs *Service) onSwapResponse(msg *encoding.SwapResponse) error {
+	o, err := rs.dao.GetSwapOrder(msg.LockSecretHash)
+	if err != nil || !o.IsMaker || o.Taker != msg.Sender || o.Status != models.SwapStatusOffered {
+		log.Warn(fmt.Sprintf("receive unexpected SwapResponse %s", msg))
+		return nil
+	}
+	log.Info(fmt.Sprintf("receive swap response %s", msg))
+	if !msg.Accepted {
+		rs.saveSwapOrder(o, models.SwapStatusRejected, msg.Reason)
+		return nil
+	}
+	rs.saveSwapOrder(o, models.SwapStatusAccepted, "")
+	rs.watchSwapOrder(o.LockSecretHash, rs.tokenSwapMaker(swapOrderToTokenSwap(o)))
+	return nil
+}
+
+/*
+watchSwapOrder 自己这一方的交易结束以后更新交换的状态,不是通过SwapOffer协商的交换没有记录,直接忽略
+*/
+func (rs *Service) watchSwapOrder(lockSecretHash common.Hash, result *utils.AsyncResult) {
+	o, err := rs.dao.GetSwapOrder(lockSecretHash)
+	if err != nil {
+		return
+	}
+	go func() {
+		var err error
+		select {
+		case err = <-result.Result:
+		case <-rs.quitChan:
+			return
+		}
+		if err != nil {
+			rs.saveSwapOrder(o, models.SwapStatusFailed, err.Error())
+			return
+		}
+		rs.saveSwapOrder(o, models.SwapStatusCompleted, "")
+	}()
+}
@@ -0,0 +1,88 @@
+package photon
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+合约在第一次向某种token的通道存款时登记这种token,并发出TokenNetworkCreated事件,没有单独登记token的交易.
+所有token共用一个TokensNetwork合约,也就是registry合约
+*/
+
+const registerTokenReqName = "registerToken"
+
+type registerTokenReq struct {
+	token common.Address
+}
+
+func (rs *Service) registerTokenClient(token common.Address) *utils.AsyncResult {
+	req := &apiReq{
+		ReqID: utils.RandomString(10),
+		Name:  registerTokenReqName,
+		Req:   &registerTokenReq{token: token},
+	}
+	return rs.sendReqClient(req)
+}
+
+/*
+registerToken 合约中已经登记而本地还没有的token(比如启动前错过了事件),按照收到ContractTokenAddedStateChange处理,
+重复登记会被忽略
+*/
+func (rs *Service) registerToken(r *registerTokenReq) *utils.AsyncResult {
+	if rs.Token2ChannelGraph[r.token] != nil {
+		return utils.NewAsyncResultWithError(nil)
+	}
+	log.Info(fmt.Sprintf("token %s registered on chain, add it", r.token.String()))
+	err := rs.StateMachineEventHandler.OnBlockchainStateChange(&mediatedtransfer.ContractTokenAddedStateChange{
+		TokenAddress: r.token,
+		BlockNumber:  rs.GetBlockNumber(),
+	})
+	return utils.NewAsyncResultWithError(err)
+}
+
+/*
+RegisterToken 让节点开始使用合约中已经登记的token,成功以后可以在这种token上开通道.
+合约中还没有登记的token返回ErrTokenNotFound,直接开通道存款即可完成登记
+*/
+func (r *API) RegisterToken(tokenAddress common.Address) (tokenNetwork common.Address, err error) {
+	tokenNetwork, err = r.GetTokenNetworkAddress(tokenAddress)
+	if err == nil {
+		return
+	}
+	if err = r.checkSmcStatus(); err != nil {
+		return
+	}
+	registered, err := r.Photon.Chain.RegistryProxy.TokenNetworkByToken(tokenAddress)
+	if err != nil {
+		err = rerr.ErrSpectrumNotConnected.AppendError(err)
+		return
+	}
+	if !registered {
+		err = rerr.ErrTokenNotFound.Printf("token %s is not registered yet, the first deposit to one of its channels registers it", tokenAddress.String())
+		return
+	}
+	err = <-r.Photon.registerTokenClient(tokenAddress).Result
+	if err != nil {
+		return
+	}
+	return r.GetTokenNetworkAddress(tokenAddress)
+}
+
+//GetTokenNetworkAddress 返回管理这种token的通道的合约地址,节点不知道的token返回ErrTokenNotFound
+func (r *API) GetTokenNetworkAddress(tokenAddress common.Address) (tokenNetwork common.Address, err error) {
+	tokens, err := r.Photon.dao.GetAllTokens()
+	if err != nil {
+		return
+	}
+	if _, ok := tokens[tokenAddress]; !ok {
+		err = rerr.ErrTokenNotFound
+		return
+	}
+	return r.Photon.Chain.GetRegistryAddress(), nil
+}
@@ -103,8 +103,10 @@ type StateManager struct {
 	FuncStateTransition FuncStateTransition
 	CurrentState        State
 	Identifier          common.Hash //transfer identifier
+	TokenAddress        common.Address
 	Name                string
 	LastReceivedMessage encoding.SignedMessager
+	StateChangeSeq      int64 //保存过的快照个数,作为快照的版本
 }
 
 //MessageTag for save and restore
@@ -119,6 +121,7 @@ func NewStateManager(stateTransition FuncStateTransition, currentState State, na
 		CurrentState:        currentState,
 		Name:                name,
 		Identifier:          identifier,
+		TokenAddress:        tokenAddress,
 	}
 }
 
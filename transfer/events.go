@@ -36,6 +36,8 @@ type EventTransferSentSuccess struct {
 	ChannelIdentifier common.Hash
 	Token             common.Address
 	Data              string
+	Fee               *big.Int         //发起方付出的总手续费
+	Path              []common.Address //实际使用的路由,从第一跳到接收方
 }
 
 /*
@@ -66,6 +68,8 @@ type EventTransferReceivedSuccess struct {
 	Initiator         common.Address
 	ChannelIdentifier common.Hash
 	Data              string
+	PaymentID         string
+	Invoice           []byte
 }
 
 func init() {
@@ -29,6 +29,8 @@ type EventSendMediatedTransfer struct {
 	// If I am the transfer initiator, then FromChannel should be null.
 	FromChannel common.Hash
 	Path        []common.Address //2019-03 消息升级后,带全路径path
+	PaymentID   string
+	Invoice     []byte
 }
 
 //NewEventSendMediatedTransfer create EventSendMediatedTransfer
@@ -43,6 +45,8 @@ func NewEventSendMediatedTransfer(transfer *LockedTransferState, receiver common
 		Receiver:       receiver,
 		Fee:            transfer.Fee,
 		Path:           path,
+		PaymentID:      transfer.PaymentID,
+		Invoice:        transfer.Invoice,
 	}
 }
 
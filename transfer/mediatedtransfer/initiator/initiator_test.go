@@ -8,6 +8,7 @@ import (
 	"math/big"
 
 	"os"
+	"strings"
 
 	"encoding/json"
 
@@ -393,6 +394,170 @@ func TestCancelTransfer(t *testing.T) {
 	assert(t, true, ok)
 }
 
+func TestCancelTransferThenRefund(t *testing.T) {
+	amount := utest.UnitTransferAmount
+	blockNumber := utest.UnitBlockNumber
+	mediatorAddress := utest.HOP1
+	targetAddress := utest.HOP2
+	ourAddress := utest.ADDR
+	token := utest.UnitTokenAddress
+
+	routes := []*route.State{
+		utest.MakeRoute(mediatorAddress, amount, utest.UnitSettleTimeout, utest.UnitRevealTimeout, 0, utils.NewRandomHash()),
+		utest.MakeRoute(utest.HOP2, amount, utest.UnitSettleTimeout, utest.UnitRevealTimeout, 0, utils.NewRandomHash()),
+	}
+	currentState := makeInitiatorState(routes, targetAddress, utest.UnitTransferAmount, blockNumber, ourAddress, token)
+	sm := transfer.NewStateManager(StateTransition, currentState, NameInitiatorTransition, utils.ShaSecret([]byte("3")), utils.NewRandomAddress())
+	events := sm.Dispatch(&transfer.ActionCancelTransferStateChange{
+		LockSecretHash: currentState.LockSecretHash,
+	})
+	assert(t, len(events), 1)
+	assert(t, len(currentState.Routes.AvailableRoutes), 0)
+	//重复撤销不再通知
+	events = sm.Dispatch(&transfer.ActionCancelTransferStateChange{
+		LockSecretHash: currentState.LockSecretHash,
+	})
+	assert(t, len(events), 0)
+	//撤销以后收到SecretRequest也不能泄露密码
+	events = sm.Dispatch(&mediatedtransfer.ReceiveSecretRequestStateChange{
+		Amount:         amount,
+		LockSecretHash: currentState.LockSecretHash,
+		Sender:         targetAddress,
+	})
+	assert(t, len(events), 0)
+	assert(t, currentState.RevealSecret == nil, true)
+	//下一跳退回锁以后不会尝试其他路由
+	events = sm.Dispatch(&mediatedtransfer.ReceiveAnnounceDisposedStateChange{
+		Sender: mediatorAddress,
+		Token:  token,
+		Message: &encoding.AnnounceDisposed{
+			ErrorCode: 1,
+			ErrorMsg:  "test error",
+		},
+		Lock: &mtree.Lock{
+			Expiration:     currentState.Transfer.Expiration,
+			LockSecretHash: currentState.LockSecretHash,
+			Amount:         amount,
+		},
+	})
+	assert(t, len(events), 2)
+	_, ok := events[0].(*mediatedtransfer.EventRemoveStateManager)
+	assert(t, ok, true)
+	_, ok = events[1].(*mediatedtransfer.EventSendAnnounceDisposedResponse)
+	assert(t, ok, true)
+	assert(t, sm.CurrentState == nil, true)
+}
+
+func TestRefundTransferRetryLimit(t *testing.T) {
+	amount := utest.UnitTransferAmount
+	blockNumber := utest.UnitBlockNumber
+	targetAddress := utest.HOP4
+	ourAddress := utest.ADDR
+	token := utest.UnitTokenAddress
+
+	routes := []*route.State{
+		utest.MakeRoute(utest.HOP1, amount, utest.UnitSettleTimeout, utest.UnitRevealTimeout, 0, utils.NewRandomHash()),
+		utest.MakeRoute(utest.HOP2, amount, utest.UnitSettleTimeout, utest.UnitRevealTimeout, 0, utils.NewRandomHash()),
+		utest.MakeRoute(utest.HOP3, amount, utest.UnitSettleTimeout, utest.UnitRevealTimeout, 0, utils.NewRandomHash()),
+	}
+	initStateChange := makeInitStateChange(routes, targetAddress, amount, blockNumber, ourAddress, token)
+	initStateChange.MaxRouteRetries = 1
+	currentState := StateTransition(nil, initStateChange).NewState.(*mediatedtransfer.InitiatorState)
+	sm := transfer.NewStateManager(StateTransition, currentState, NameInitiatorTransition, utils.ShaSecret([]byte("3")), utils.NewRandomAddress())
+	refund := func(sender common.Address) []transfer.Event {
+		return sm.Dispatch(&mediatedtransfer.ReceiveAnnounceDisposedStateChange{
+			Sender: sender,
+			Token:  token,
+			Message: &encoding.AnnounceDisposed{
+				ErrorCode: 1,
+				ErrorMsg:  "test error",
+			},
+			Lock: &mtree.Lock{
+				Expiration:     currentState.Transfer.Expiration,
+				LockSecretHash: currentState.LockSecretHash,
+				Amount:         amount,
+			},
+		})
+	}
+	//第一条路由失败以后还可以再试一条
+	events := refund(utest.HOP1)
+	_, ok := events[0].(*mediatedtransfer.EventSendMediatedTransfer)
+	assert(t, ok, true)
+	assert(t, currentState.Route.HopNode(), utest.HOP2)
+	//达到重试次数,剩下的路由不再尝试
+	events = refund(utest.HOP2)
+	assert(t, len(events), 3)
+	failed, ok := events[0].(*transfer.EventTransferSentFailed)
+	assert(t, ok, true)
+	assert(t, strings.Contains(failed.Reason, "route retry limit 1 reached"), true)
+	assert(t, sm.CurrentState == nil, true)
+	assert(t, len(currentState.Routes.IgnoredRoutes), 1)
+}
+
+func TestInitWithConstraints(t *testing.T) {
+	amount := utest.UnitTransferAmount
+	blockNumber := utest.UnitBlockNumber
+	targetAddress := utest.HOP5
+	makeRoutes := func() []*route.State {
+		routes := []*route.State{
+			utest.MakeRoute(utest.HOP1, amount, utest.UnitSettleTimeout, utest.UnitRevealTimeout, 0, utils.NewRandomHash()),
+			utest.MakeRoute(utest.HOP2, amount, utest.UnitSettleTimeout, utest.UnitRevealTimeout, 0, utils.NewRandomHash()),
+			utest.MakeRoute(utest.HOP3, amount, utest.UnitSettleTimeout, utest.UnitRevealTimeout, 0, utils.NewRandomHash()),
+		}
+		routes[0].TotalFee = big.NewInt(5)
+		routes[0].Path = []common.Address{utest.HOP1, targetAddress}
+		routes[1].TotalFee = big.NewInt(1)
+		routes[1].Path = []common.Address{utest.HOP2, utest.HOP4, targetAddress}
+		routes[2].TotalFee = big.NewInt(1)
+		routes[2].Path = []common.Address{utest.ADDR, utest.HOP3, targetAddress}
+		return routes
+	}
+	initStateChange := makeInitStateChange(makeRoutes(), targetAddress, amount, blockNumber, utest.ADDR, utest.UnitTokenAddress)
+	initStateChange.MaxFee = big.NewInt(2)
+	initStateChange.MaxHops = 2
+	state := StateTransition(nil, initStateChange).NewState.(*mediatedtransfer.InitiatorState)
+	//第一条路由手续费太高,第二条跳数太多,路径中的自己不算一跳
+	assert(t, state.Route.HopNode(), utest.HOP3)
+	assert(t, len(state.Routes.IgnoredRoutes), 2)
+
+	initStateChange = makeInitStateChange(makeRoutes()[:2], targetAddress, amount, blockNumber, utest.ADDR, utest.UnitTokenAddress)
+	initStateChange.MaxFee = big.NewInt(2)
+	initStateChange.MaxHops = 2
+	it := StateTransition(nil, initStateChange)
+	assert(t, it.NewState == nil, true)
+	failed, ok := it.Events[0].(*transfer.EventTransferSentFailed)
+	assert(t, ok, true)
+	assert(t, strings.Contains(failed.Reason, "violates max_fee"), true)
+	assert(t, strings.Contains(failed.Reason, "violates max_hops"), true)
+}
+
+func TestDeadlinePassed(t *testing.T) {
+	amount := utest.UnitTransferAmount
+	blockNumber := utest.UnitBlockNumber
+	routes := []*route.State{
+		utest.MakeRoute(utest.HOP1, amount, utest.UnitSettleTimeout, utest.UnitRevealTimeout, 0, utils.NewRandomHash()),
+	}
+	initStateChange := makeInitStateChange(routes, utest.HOP2, amount, blockNumber, utest.ADDR, utest.UnitTokenAddress)
+	initStateChange.Deadline = blockNumber + 1
+	state := StateTransition(nil, initStateChange).NewState.(*mediatedtransfer.InitiatorState)
+	sm := transfer.NewStateManager(StateTransition, state, NameInitiatorTransition, state.LockSecretHash, utest.UnitTokenAddress)
+	events := sm.Dispatch(&transfer.BlockStateChange{BlockNumber: blockNumber + 1})
+	assert(t, len(events), 0)
+	events = sm.Dispatch(&transfer.BlockStateChange{BlockNumber: blockNumber + 2})
+	assert(t, len(events), 1)
+	failed, ok := events[0].(*transfer.EventTransferSentFailed)
+	assert(t, ok, true)
+	assert(t, strings.Contains(failed.Reason, "deadline"), true)
+	assert(t, state.CanceledByUser, true)
+	//超过截止块以后不再泄露密码
+	events = sm.Dispatch(&mediatedtransfer.ReceiveSecretRequestStateChange{
+		Amount:         amount,
+		LockSecretHash: state.LockSecretHash,
+		Sender:         utest.HOP2,
+	})
+	assert(t, len(events), 0)
+}
+
 func assertStateEqual(t *testing.T, currentState, beforeState *mediatedtransfer.InitiatorState) {
 	//assert(t, reflect.DeepEqual(currentState, beforeState), true)
 	assert(t, currentState.Transfer, beforeState.Transfer)
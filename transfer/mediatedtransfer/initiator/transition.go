@@ -40,11 +40,36 @@ func cancelCurrentRoute(state *mt.InitiatorState, reason string) *transfer.Trans
 	return tryNewRoute(state)
 }
 
-//Cancel the current in-transit message
+/*
+Cancel the current in-transit message
+撤销以后剩下的路由都不再使用,当前路由上的锁等到过期以后remove,或者下一跳主动AnnounceDisposed
+*/
 func userCancelTransfer(state *mt.InitiatorState) *transfer.TransitionResult {
+	return abortTransfer(state, "user canceled transfer")
+}
+
+/*
+abortTransfer 放弃还没有泄露密码的交易,用户撤销和超过截止块都走这里,
+之后不再尝试其他路由,也不会再泄露密码
+*/
+func abortTransfer(state *mt.InitiatorState, reason string) *transfer.TransitionResult {
 	if state.RevealSecret != nil {
 		panic("cannot cancel a transfer with a RevealSecret in flight")
 	}
+	if state.CanceledByUser {
+		return &transfer.TransitionResult{
+			NewState: state,
+			Events:   nil,
+		}
+	}
+	state.CanceledByUser = true
+	for _, r := range state.Routes.AvailableRoutes {
+		state.Routes.CanceledRoutes = append(state.Routes.CanceledRoutes, &route.CanceledRoute{
+			Route:  r,
+			Reason: reason,
+		})
+	}
+	state.Routes.AvailableRoutes = nil
 	state.Transfer.Secret = utils.EmptyHash
 	//state.Transfer.LockSecretHash = utils.EmptyHash // need by remove
 	state.Message = nil
@@ -53,7 +78,7 @@ func userCancelTransfer(state *mt.InitiatorState) *transfer.TransitionResult {
 	state.RevealSecret = nil
 	cancel := &transfer.EventTransferSentFailed{
 		LockSecretHash: state.Transfer.LockSecretHash,
-		Reason:         "user canceled transfer",
+		Reason:         reason,
 		Target:         state.Transfer.Target,
 		Token:          state.Transfer.Token,
 	}
@@ -66,14 +91,80 @@ func userCancelTransfer(state *mt.InitiatorState) *transfer.TransitionResult {
 	}
 }
 
+/*
+retryStopReason 已经有路由失败时,超过重试次数或者截止块就不再尝试剩下的路由,返回原因.
+第一条路由不受限制
+*/
+func retryStopReason(state *mt.InitiatorState) string {
+	failed := len(state.Routes.CanceledRoutes)
+	if failed == 0 || len(state.Routes.AvailableRoutes) == 0 {
+		return ""
+	}
+	if state.MaxRouteRetries > 0 && failed > state.MaxRouteRetries {
+		return fmt.Sprintf("route retry limit %d reached", state.MaxRouteRetries)
+	}
+	if state.RetryDeadline > 0 && state.BlockNumber > state.RetryDeadline {
+		return fmt.Sprintf("route retry deadline block %d passed", state.RetryDeadline)
+	}
+	return ""
+}
+
+//deadlinePassed 用户指定的截止块已经过去,不能再发起新的路由
+func deadlinePassed(state *mt.InitiatorState) bool {
+	return state.Deadline > 0 && state.BlockNumber > state.Deadline
+}
+
+/*
+constraintViolation 检查路由是否满足用户指定的最高手续费和最大跳数,返回违反的约束.
+路径中可能包含自己,不算一跳;没有完整路径的路由只有下一跳就是target时才知道跳数
+*/
+func constraintViolation(state *mt.InitiatorState, r *route.State) string {
+	if state.MaxFee != nil && r.TotalFee != nil && r.TotalFee.Cmp(state.MaxFee) > 0 {
+		return fmt.Sprintf("route through %s violates max_fee: fee %s exceeds %s", utils.APex2(r.HopNode()), r.TotalFee, state.MaxFee)
+	}
+	if state.MaxHops > 0 {
+		hops := 0
+		for _, addr := range r.Path {
+			if addr != state.OurAddress {
+				hops++
+			}
+		}
+		if hops == 0 {
+			if r.HopNode() != state.Transfer.Target {
+				return fmt.Sprintf("route through %s violates max_hops: no full path", utils.APex2(r.HopNode()))
+			}
+			hops = 1
+		}
+		if hops > state.MaxHops {
+			return fmt.Sprintf("route through %s violates max_hops: %d hops exceeds %d", utils.APex2(r.HopNode()), hops, state.MaxHops)
+		}
+	}
+	return ""
+}
+
 func tryNewRoute(state *mt.InitiatorState) *transfer.TransitionResult {
 	if state.Route != nil {
 		panic("cannot try a new route while one is being used")
 	}
 	var tryRoute *route.State
+	var violations []string
+	stopReason := retryStopReason(state)
+	if deadlinePassed(state) {
+		stopReason = fmt.Sprintf("deadline block %d passed", state.Deadline)
+	}
+	if stopReason != "" {
+		state.Routes.IgnoredRoutes = append(state.Routes.IgnoredRoutes, state.Routes.AvailableRoutes...)
+		state.Routes.AvailableRoutes = nil
+	}
 	for len(state.Routes.AvailableRoutes) > 0 {
 		r := state.Routes.AvailableRoutes[0]
 		state.Routes.AvailableRoutes = state.Routes.AvailableRoutes[1:]
+		if violation := constraintViolation(state, r); violation != "" {
+			log.Info(violation)
+			violations = append(violations, violation)
+			state.Routes.IgnoredRoutes = append(state.Routes.IgnoredRoutes, r)
+			continue
+		}
 		//if !r.CanTransfer() /*交易发起方不应该考虑收费*/ || r.AvailableBalance().Cmp(new(big.Int).Add(state.Transfer.TargetAmount, r.Fee)) < 0 {
 		if !r.CanTransfer() || r.AvailableBalance().Cmp(state.Transfer.TargetAmount) < 0 {
 			state.Routes.IgnoredRoutes = append(state.Routes.IgnoredRoutes, r)
@@ -100,10 +191,20 @@ func tryNewRoute(state *mt.InitiatorState) *transfer.TransitionResult {
 		for _, canceledRoute := range state.Routes.CanceledRoutes {
 			transferFailed.Reason = fmt.Sprintf("%s,%s", transferFailed.Reason, canceledRoute.Reason)
 		}
+		for _, violation := range violations {
+			transferFailed.Reason = fmt.Sprintf("%s,%s", transferFailed.Reason, violation)
+		}
+		if stopReason != "" {
+			transferFailed.Reason = fmt.Sprintf("%s,%s", transferFailed.Reason, stopReason)
+		}
 		if transferFailed.Reason == "" {
 			transferFailed.Reason = "no route available"
 		}
 		events := []transfer.Event{transferFailed}
+		//用户撤销时已经通知过交易失败
+		if state.CanceledByUser {
+			events = nil
+		}
 		removeManager := &mt.EventRemoveStateManager{
 			Key: utils.Sha3(state.LockSecretHash[:], state.Transfer.Token[:]),
 		}
@@ -139,6 +240,8 @@ func tryNewRoute(state *mt.InitiatorState) *transfer.TransitionResult {
 		Secret:         state.Secret,
 		Fee:            tryRoute.TotalFee,
 		Data:           state.Transfer.Data,
+		PaymentID:      state.Transfer.PaymentID,
+		Invoice:        state.Transfer.Invoice,
 	}
 	msg := mt.NewEventSendMediatedTransfer(tr, tryRoute.HopNode(), tryRoute.Path)
 	if len(state.Routes.CanceledRoutes) > 0 {
@@ -198,6 +301,9 @@ func handleBlock(state *mt.InitiatorState, stateChange *transfer.BlockStateChang
 		events = append(events, &mt.EventRemoveStateManager{
 			Key: utils.Sha3(state.LockSecretHash[:], state.Transfer.Token[:]),
 		})
+	} else if deadlinePassed(state) && state.RevealSecret == nil && !state.CanceledByUser {
+		//超过截止块还没有泄露密码,放弃交易,当前路由上的锁等到过期以后remove
+		return abortTransfer(state, fmt.Sprintf("deadline block %d passed", state.Deadline))
 	}
 	return &transfer.TransitionResult{
 		NewState: state,
@@ -207,6 +313,11 @@ func handleBlock(state *mt.InitiatorState, stateChange *transfer.BlockStateChang
 
 func handleRefund(state *mt.InitiatorState, stateChange *mt.ReceiveAnnounceDisposedStateChange) *transfer.TransitionResult {
 	if mediator.IsValidRefund(state.Transfer, state.Route, stateChange) {
+		if stateChange.Message.ErrorCode == rerr.ErrTransferRejectedByTarget.ErrorCode {
+			//接收方拒绝了这笔交易,其他路由也会被拒绝
+			state.Routes.IgnoredRoutes = append(state.Routes.IgnoredRoutes, state.Routes.AvailableRoutes...)
+			state.Routes.AvailableRoutes = nil
+		}
 		it := cancelCurrentRoute(state, rerr.StandardError{
 			ErrorCode: stateChange.Message.ErrorCode,
 			ErrorMsg:  stateChange.Message.ErrorMsg,
@@ -336,6 +447,8 @@ func transferSuccessEvents(state *mt.InitiatorState) (events []transfer.Event) {
 		ChannelIdentifier: state.Route.ChannelIdentifier,
 		Token:             tr.Token,
 		Data:              tr.Data,
+		Fee:               state.Route.TotalFee,
+		Path:              state.Route.Path,
 	}
 	unlockSuccess := &mt.EventUnlockSuccess{
 		LockSecretHash: tr.LockSecretHash,
@@ -414,6 +527,11 @@ func StateTransition(originalState transfer.State, st transfer.StateChange) *tra
 				Secret:                         staii.Secret,
 				Db:                             staii.Db,
 				CancelByExceptionSecretRequest: false,
+				MaxRouteRetries:                staii.MaxRouteRetries,
+				RetryDeadline:                  staii.RetryDeadline,
+				MaxFee:                         staii.MaxFee,
+				MaxHops:                        staii.MaxHops,
+				Deadline:                       staii.Deadline,
 			}
 			return tryNewRoute(state)
 		}
@@ -452,7 +570,9 @@ func StateTransition(originalState transfer.State, st transfer.StateChange) *tra
 		case *mt.ContractSecretRevealOnChainStateChange:
 			it = handleSecretRevealOnChain(state, st2)
 		case *mt.ReceiveSecretRequestStateChange:
-			if state.RevealSecret == nil {
+			if state.CanceledByUser {
+				log.Warn(fmt.Sprintf("recevie secret request but transfer %s is canceled by user", utils.HPex(state.LockSecretHash)))
+			} else if state.RevealSecret == nil {
 				it = handleSecretRequest(state, st2)
 			} else {
 				log.Warn(fmt.Sprintf("recevie secret request but initiator have already sent reveal secret"))
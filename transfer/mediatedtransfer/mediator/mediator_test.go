@@ -785,3 +785,39 @@ func TestNoValidRoutes(t *testing.T) {
 	_, ok := events[0].(*mediatedtransfer.EventSendAnnounceDisposed)
 	assert(t, ok, true)
 }
+
+func TestInitiatorOverLimit(t *testing.T) {
+	fromRoute, FromTransfer := utest.MakeFrom(utest.UnitTransferAmount, utest.HOP2, int64(utest.Hop1Timeout), utils.NewRandomAddress(), utils.EmptyHash)
+	var routes = []*route.State{utest.MakeRoute(utest.HOP2, utest.UnitTransferAmount, utest.UnitSettleTimeout, utest.UnitRevealTimeout, 0, utils.NewRandomHash())}
+	initStateChange := makeInitStateChange(FromTransfer, fromRoute, routes, utest.ADDR)
+	initStateChange.InitiatorOverLimit = true
+	sm := transfer.NewStateManager(StateTransition, nil, "mediator", utils.ShaSecret([]byte("3")), utils.NewRandomAddress())
+	events := sm.Dispatch(initStateChange)
+	assert(t, len(events) > 0, true)
+	disposed, ok := events[0].(*mediatedtransfer.EventSendAnnounceDisposed)
+	assert(t, ok, true)
+	assert(t, disposed.Reason.ErrorCode, rerr.ErrRejectTransferBecauseInitiatorTooManyTransfers.ErrorCode)
+}
+
+func TestMaxChannelLocks(t *testing.T) {
+	fromRoute, FromTransfer := utest.MakeFrom(utest.UnitTransferAmount, utest.HOP2, int64(utest.Hop1Timeout), utils.NewRandomAddress(), utils.EmptyHash)
+	var routes = []*route.State{utest.MakeRoute(utest.HOP2, utest.UnitTransferAmount, utest.UnitSettleTimeout, utest.UnitRevealTimeout, 0, utils.NewRandomHash())}
+	payerChannel := fromRoute.Channel()
+	for i := 0; i < 2; i++ {
+		payerChannel.PartnerState.Lock2PendingLocks[utils.NewRandomHash()] = channeltype.PendingLock{}
+	}
+	//默认使用reveal_timeout作为阈值,可以正常中转
+	initStateChange := makeInitStateChange(FromTransfer, fromRoute, routes, utest.ADDR)
+	sm := transfer.NewStateManager(StateTransition, nil, "mediator", utils.ShaSecret([]byte("3")), utils.NewRandomAddress())
+	events := sm.Dispatch(initStateChange)
+	_, ok := events[0].(*mediatedtransfer.EventSendMediatedTransfer)
+	assert(t, ok, true)
+
+	initStateChange = makeInitStateChange(FromTransfer, fromRoute, routes, utest.ADDR)
+	initStateChange.MaxChannelLocks = 1
+	sm = transfer.NewStateManager(StateTransition, nil, "mediator", utils.ShaSecret([]byte("3")), utils.NewRandomAddress())
+	events = sm.Dispatch(initStateChange)
+	disposed, ok := events[0].(*mediatedtransfer.EventSendAnnounceDisposed)
+	assert(t, ok, true)
+	assert(t, disposed.Reason.ErrorCode, rerr.ErrRejectTransferBecauseChannelHoldingTooMuchLock.ErrorCode)
+}
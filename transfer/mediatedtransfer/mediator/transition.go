@@ -378,6 +378,8 @@ func nextTransferPair(payerRoute *route.State, payerTransfer *mediatedtransfer.L
 		LockSecretHash: payerTransfer.LockSecretHash,
 		Secret:         payerTransfer.Secret,
 		Fee:            big.NewInt(0).Sub(payerTransfer.Fee, payeeRoute.Fee),
+		PaymentID:      payerTransfer.PaymentID,
+		Invoice:        payerTransfer.Invoice,
 	}
 	if payeeRoute.HopNode() == payeeTransfer.Target {
 		//i'm the last hop,so take the rest of the fee
@@ -777,7 +779,7 @@ func mediateTransfer(state *mediatedtransfer.MediatorState, payerRoute *route.St
 		这里根据reveal_timeout限制持有锁的数量,如果同时持有对方的锁大于某个值,说明对方很有可能不是诚信节点,此时不再接收对方发来的交易,
 		这是为了避免上下家合作利用时间差来攻击我,造成我损失钱的情况
 		在这里做可以直接通过announce disposed拒绝该笔交易,既达到拒绝的目的,也不至于让交易卡住
-		暂时直接使用通道的reveal_timeout作为阈值
+		阈值可以通过MaxChannelLocks配置,没有配置时使用通道的reveal_timeout
 	*/
 	/*
 		Here, the number of locks held is limited according to reveal_timeout. If the locks held at the same time are more than a certain value,
@@ -785,10 +787,14 @@ func mediateTransfer(state *mediatedtransfer.MediatorState, payerRoute *route.St
 		This is to avoid the cooperation between the payer and payee in using time difference to attack me, causing me to lose money.
 
 		It is possible to reject the transaction directly through announcement disposed, so that the purpose of rejection is achieved and the transaction is not stuck.
-		Reveal_timeout is used directly as a threshold value temporarily.
+		The threshold is MaxChannelLocks if configured, otherwise reveal_timeout of the channel.
 	*/
 	payerChannel := transferPair.PayerRoute.Channel()
-	if len(payerChannel.PartnerState.Lock2PendingLocks)+len(payerChannel.PartnerState.Lock2UnclaimedLocks) > payerChannel.RevealTimeout {
+	maxLocks := payerChannel.RevealTimeout
+	if state.MaxChannelLocks > 0 {
+		maxLocks = state.MaxChannelLocks
+	}
+	if len(payerChannel.PartnerState.Lock2PendingLocks)+len(payerChannel.PartnerState.Lock2UnclaimedLocks) > maxLocks {
 		log.Warn(fmt.Sprintf("holding too much lock of %s, reject new mediated transfer from him", utils.APex2(payerChannel.PartnerState.Address)))
 		return &transfer.TransitionResult{
 			NewState: state,
@@ -848,6 +854,26 @@ func cancelCurrentRoute(state *mediatedtransfer.MediatorState, refundChannelIden
 	return it
 }
 
+/*
+refundRejectedByTarget 接收方拒绝了这笔交易,换路由也没有用,不再尝试剩下的路由,
+把接收方拒绝的原因原样退回给上家
+*/
+func refundRejectedByTarget(state *mediatedtransfer.MediatorState, st *mediatedtransfer.ReceiveAnnounceDisposedStateChange) *transfer.TransitionResult {
+	l := len(state.TransfersPair)
+	transferPair := state.TransfersPair[l-1]
+	state.TransfersPair = state.TransfersPair[:l-1]
+	state.Routes.IgnoredRoutes = append(state.Routes.IgnoredRoutes, state.Routes.AvailableRoutes...)
+	state.Routes.AvailableRoutes = nil
+	reason := rerr.StandardError{
+		ErrorCode: st.Message.ErrorCode,
+		ErrorMsg:  st.Message.ErrorMsg,
+	}
+	return &transfer.TransitionResult{
+		NewState: state,
+		Events:   eventsForRefund(transferPair.PayerRoute, transferPair.PayerTransfer, reason),
+	}
+}
+
 /*
 又收到了一个 mediatedtransfer
 */
@@ -957,7 +983,11 @@ func handleAnnouceDisposed(state *mediatedtransfer.MediatorState, st *mediatedtr
 			 *	which means we receive refund of F, then we should assume that payeeTransfer invalid,
 			 *  which acts like receiving transfer of E, then begin to find a route again.
 			 */
-			it = cancelCurrentRoute(state, st.Message.ChannelIdentifier)
+			if st.Message.ErrorCode == rerr.ErrTransferRejectedByTarget.ErrorCode {
+				it = refundRejectedByTarget(state, st)
+			} else {
+				it = cancelCurrentRoute(state, st.Message.ChannelIdentifier)
+			}
 			ev := &mediatedtransfer.EventSendAnnounceDisposedResponse{
 				Token:          state.Token,
 				LockSecretHash: st.Lock.LockSecretHash,
@@ -1132,15 +1162,24 @@ func StateTransition(originalState transfer.State, stateChange transfer.StateCha
 	if state == nil {
 		if aim, ok := stateChange.(*mediatedtransfer.ActionInitMediatorStateChange); ok {
 			state = &mediatedtransfer.MediatorState{
-				OurAddress:     aim.OurAddress,
-				Routes:         aim.Routes,
-				BlockNumber:    aim.BlockNumber,
-				Hashlock:       aim.FromTranfer.LockSecretHash,
-				Db:             aim.Db,
-				Token:          aim.FromTranfer.Token,
-				LockSecretHash: aim.FromTranfer.LockSecretHash,
+				OurAddress:      aim.OurAddress,
+				Routes:          aim.Routes,
+				BlockNumber:     aim.BlockNumber,
+				Hashlock:        aim.FromTranfer.LockSecretHash,
+				Db:              aim.Db,
+				Token:           aim.FromTranfer.Token,
+				LockSecretHash:  aim.FromTranfer.LockSecretHash,
+				MaxChannelLocks: aim.MaxChannelLocks,
+			}
+			if aim.InitiatorOverLimit {
+				log.Warn(fmt.Sprintf("too many mediated transfers from initiator %s, reject new mediated transfer", utils.APex2(aim.FromTranfer.Initiator)))
+				it = &transfer.TransitionResult{
+					NewState: state,
+					Events:   eventsForRefund(aim.FromRoute, aim.FromTranfer, rerr.ErrRejectTransferBecauseInitiatorTooManyTransfers),
+				}
+			} else {
+				it = mediateTransfer(state, aim.FromRoute, aim.FromTranfer)
 			}
-			it = mediateTransfer(state, aim.FromRoute, aim.FromTranfer)
 		}
 	} else {
 		switch st2 := stateChange.(type) {
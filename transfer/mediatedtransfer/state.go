@@ -27,6 +27,8 @@ type LockedTransferState struct {
 	Secret         common.Hash    //The secret that unlocks the lock, may be None.
 	Fee            *big.Int       // how much fee left for other hop node.
 	Data           string
+	PaymentID      string //用户指定的支付ID,随MediatedTransfer一路传给target
+	Invoice        []byte //可选的发票信息,和PaymentID一起传递
 }
 
 //AlmostEqual if two state equals?
@@ -50,6 +52,8 @@ func LockedTransferFromMessage(msg *encoding.MediatedTransfer, tokenAddress comm
 		LockSecretHash: msg.LockSecretHash,
 		Fee:            msg.Fee,
 		Token:          tokenAddress,
+		PaymentID:      msg.PaymentID,
+		Invoice:        msg.Invoice,
 	}
 }
 
@@ -88,7 +92,13 @@ type InitiatorState struct {
 	RevealSecret                   *EventSendRevealSecret
 	CanceledTransfers              []*EventSendMediatedTransfer
 	Db                             channeltype.Db
-	CancelByExceptionSecretRequest bool // set true when receive exception SecretRequest
+	CancelByExceptionSecretRequest bool  // set true when receive exception SecretRequest
+	CanceledByUser                 bool  // 用户已经撤销了交易,不再尝试其他路由,也不再泄露密码
+	MaxRouteRetries                int      // 第一条路由失败以后最多再尝试多少条路由,0表示不限制
+	RetryDeadline                  int64    // 超过这个块以后路由失败不再尝试其他路由,0表示不限制
+	MaxFee                         *big.Int // 用户能接受的最高总手续费,nil表示不限制
+	MaxHops                        int      // 路由最多经过多少跳,0表示不限制
+	Deadline                       int64    // 超过这个块还没有泄露密码时放弃交易,0表示不限制
 }
 
 /*
@@ -104,10 +114,11 @@ type MediatorState struct {
 			keeping all transfers in a single list byzantine behavior for secret
 		        reveal and simplifies secret setting
 	*/
-	TransfersPair  []*MediationPairState
-	LockSecretHash common.Hash
-	Token          common.Address
-	Db             channeltype.Db
+	TransfersPair   []*MediationPairState
+	LockSecretHash  common.Hash
+	Token           common.Address
+	Db              channeltype.Db
+	MaxChannelLocks int //上家通道中同时持有对方的锁最多这么多个,超过以后拒绝新的交易,0表示使用通道的reveal_timeout
 }
 
 /*
@@ -148,6 +159,12 @@ StateSecretRegistered 密码已经在链上披露了
 // And they should immediately send unlock to their partner once they have received SecretRegistered.
 const StateSecretRegistered = "secret_registered"
 
+//StateWaitingApproval 接收方应用还没有决定是否接收这笔交易,在此之前不发送SecretRequest
+const StateWaitingApproval = "waiting_approval"
+
+//StateRejected 接收方应用拒绝了这笔交易,已经通过AnnounceDisposed把锁退回给上家
+const StateRejected = "rejected"
+
 //TargetState State of mediated transfer target.
 type TargetState struct {
 	OurAddress   common.Address
@@ -31,24 +31,31 @@ ActionInitInitiatorStateChange start a mediated transfer
  useful work, ie. there must /not/ be an event for requesting new data.
 */
 type ActionInitInitiatorStateChange struct {
-	OurAddress     common.Address       //This node address.
-	Tranfer        *LockedTransferState //A state object containing the transfer details.
-	Routes         *route.RoutesState   //The current available routes.
-	BlockNumber    int64                //The current block number.
-	Db             channeltype.Db       //get the latest channel state
-	LockSecretHash common.Hash
-	Secret         common.Hash
+	OurAddress      common.Address       //This node address.
+	Tranfer         *LockedTransferState //A state object containing the transfer details.
+	Routes          *route.RoutesState   //The current available routes.
+	BlockNumber     int64                //The current block number.
+	Db              channeltype.Db       //get the latest channel state
+	LockSecretHash  common.Hash
+	Secret          common.Hash
+	MaxRouteRetries int      //第一条路由失败以后最多再尝试多少条路由,0表示不限制
+	RetryDeadline   int64    //超过这个块以后路由失败不再尝试其他路由,0表示不限制
+	MaxFee          *big.Int //用户能接受的最高总手续费,nil表示不限制
+	MaxHops         int      //路由最多经过多少跳,0表示不限制
+	Deadline        int64    //超过这个块还没有泄露密码时放弃交易,0表示不限制
 }
 
 //ActionInitMediatorStateChange  Initial state for a new mediator.
 type ActionInitMediatorStateChange struct {
-	OurAddress  common.Address             //This node address.
-	FromTranfer *LockedTransferState       //The received MediatedTransfer.
-	Routes      *route.RoutesState         //The current available routes.
-	FromRoute   *route.State               //The route from which the MediatedTransfer was received.
-	BlockNumber int64                      //The current block number.
-	Message     *encoding.MediatedTransfer //the message trigger this statechange
-	Db          channeltype.Db             //get the latest channel state
+	OurAddress         common.Address             //This node address.
+	FromTranfer        *LockedTransferState       //The received MediatedTransfer.
+	Routes             *route.RoutesState         //The current available routes.
+	FromRoute          *route.State               //The route from which the MediatedTransfer was received.
+	BlockNumber        int64                      //The current block number.
+	Message            *encoding.MediatedTransfer //the message trigger this statechange
+	Db                 channeltype.Db             //get the latest channel state
+	MaxChannelLocks    int                        //上家通道中同时持有对方的锁最多这么多个,0表示使用通道的reveal_timeout
+	InitiatorOverLimit bool                       //同一个发起方通过本节点中转的交易太多,拒绝这笔交易
 }
 
 //MediatorReReceiveStateChange 中间节点再次收到 MediatedTransfer
@@ -61,12 +68,20 @@ type MediatorReReceiveStateChange struct {
 
 //ActionInitTargetStateChange Initial state for a new target.
 type ActionInitTargetStateChange struct {
-	OurAddress  common.Address       //This node address.
-	FromTranfer *LockedTransferState //The received MediatedTransfer.
-	FromRoute   *route.State         //The route from which the MediatedTransfer was received.
-	BlockNumber int64
-	Message     *encoding.MediatedTransfer //the message trigger this statechange
-	Db          channeltype.Db             //get the latest channel state
+	OurAddress   common.Address       //This node address.
+	FromTranfer  *LockedTransferState //The received MediatedTransfer.
+	FromRoute    *route.State         //The route from which the MediatedTransfer was received.
+	BlockNumber  int64
+	Message      *encoding.MediatedTransfer //the message trigger this statechange
+	Db           channeltype.Db             //get the latest channel state
+	NeedApproval bool                       //接收方应用确认以后才能发送SecretRequest
+}
+
+//ActionApproveTransferStateChange 接收方应用接收或者拒绝一笔等待确认的交易
+type ActionApproveTransferStateChange struct {
+	LockSecretHash common.Hash
+	Approved       bool
+	Reason         string //拒绝的原因,通过AnnounceDisposed告诉上家
 }
 
 /*
@@ -290,14 +305,20 @@ func init() {
 	gob.Register(&ActionInitInitiatorStateChange{})
 	gob.Register(&ActionInitMediatorStateChange{})
 	gob.Register(&ActionInitTargetStateChange{})
+	gob.Register(&MediatorReReceiveStateChange{})
+	gob.Register(&ActionApproveTransferStateChange{})
 	gob.Register(&ActionCancelRouteStateChange{})
 	gob.Register(&ReceiveSecretRequestStateChange{})
 	gob.Register(&ReceiveSecretRevealStateChange{})
 	gob.Register(&ReceiveAnnounceDisposedStateChange{})
 	gob.Register(&ReceiveUnlockStateChange{})
 	gob.Register(&ContractSecretRevealOnChainStateChange{})
+	gob.Register(&ContractUnlockStateChange{})
+	gob.Register(&ContractChannelWithdrawStateChange{})
 	gob.Register(&ContractClosedStateChange{})
 	gob.Register(&ContractSettledStateChange{})
+	gob.Register(&ContractCooperativeSettledStateChange{})
+	gob.Register(&ContractPunishedStateChange{})
 	gob.Register(&ContractBalanceStateChange{})
 	gob.Register(&ContractNewChannelStateChange{})
 	gob.Register(&ContractTokenAddedStateChange{})
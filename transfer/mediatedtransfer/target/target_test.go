@@ -9,6 +9,7 @@ import (
 
 	"github.com/SmartMeshFoundation/Photon/encoding"
 	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/rerr"
 	"github.com/SmartMeshFoundation/Photon/transfer"
 	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer"
 	"github.com/SmartMeshFoundation/Photon/utils"
@@ -138,6 +139,98 @@ func TestHandleInitTargetBadExpiration(t *testing.T) {
 	assert(t, len(it.Events), 0)
 }
 
+// Init transfer must wait for approval before sending a secret request.
+func TestHandleInitTargetNeedApproval(t *testing.T) {
+	var blockNumber int64 = 1
+	var amount int64 = 1
+	var expire = int64(utest.UnitRevealTimeout) + blockNumber + 2
+	initiator := utest.HOP1
+
+	st := makeInitStateChange(utest.ADDR, amount, blockNumber, initiator, expire)
+	st.NeedApproval = true
+	it := handleInitTraget(st)
+	assert(t, len(it.Events), 0)
+	state := it.NewState.(*mediatedtransfer.TargetState)
+	assert(t, state.State, mediatedtransfer.StateWaitingApproval)
+
+	//lock secret hash does not match
+	it = handleApproveTransfer(state, &mediatedtransfer.ActionApproveTransferStateChange{
+		LockSecretHash: utils.NewRandomHash(),
+		Approved:       true,
+	})
+	assert(t, len(it.Events), 0)
+	assert(t, state.State, mediatedtransfer.StateWaitingApproval)
+
+	it = handleApproveTransfer(state, &mediatedtransfer.ActionApproveTransferStateChange{
+		LockSecretHash: st.FromTranfer.LockSecretHash,
+		Approved:       true,
+	})
+	assert(t, len(it.Events), 1)
+	ev := it.Events[0].(*mediatedtransfer.EventSendSecretRequest)
+	assert(t, ev.LockSecretHash, st.FromTranfer.LockSecretHash)
+	assert(t, ev.Receiver, initiator)
+	assert(t, state.State, mediatedtransfer.StateSecretRequest)
+
+	//only answered once
+	it = handleApproveTransfer(state, &mediatedtransfer.ActionApproveTransferStateChange{
+		LockSecretHash: st.FromTranfer.LockSecretHash,
+		Approved:       false,
+	})
+	assert(t, len(it.Events), 0)
+}
+
+// A rejected transfer is given back to the payer and its secret is never revealed.
+func TestHandleApproveTransferRejected(t *testing.T) {
+	var blockNumber int64 = 1
+	var amount int64 = 1
+	var expire = int64(utest.UnitRevealTimeout) + blockNumber + 2
+	initiator := utest.HOP1
+
+	st := makeInitStateChange(utest.ADDR, amount, blockNumber, initiator, expire)
+	st.NeedApproval = true
+	it := handleInitTraget(st)
+	state := it.NewState.(*mediatedtransfer.TargetState)
+	it = StateTransiton(state, &mediatedtransfer.ActionApproveTransferStateChange{
+		LockSecretHash: st.FromTranfer.LockSecretHash,
+		Approved:       false,
+		Reason:         "unknown invoice",
+	})
+	assert(t, len(it.Events), 1)
+	ev := it.Events[0].(*mediatedtransfer.EventSendAnnounceDisposed)
+	assert(t, ev.LockSecretHash, st.FromTranfer.LockSecretHash)
+	assert(t, ev.Receiver, st.FromRoute.HopNode())
+	assert(t, ev.Reason.ErrorCode, rerr.ErrTransferRejectedByTarget.ErrorCode)
+	assert(t, state.State, mediatedtransfer.StateRejected)
+
+	it = StateTransiton(state, &mediatedtransfer.ReceiveSecretRevealStateChange{
+		Secret:  utest.UnitSecret,
+		Sender:  initiator,
+		Message: &encoding.RevealSecret{},
+	})
+	assert(t, len(it.Events), 0)
+}
+
+// A transfer still waiting for approval is rejected before it is unsafe to receive.
+func TestHandleBlockApprovalTimeout(t *testing.T) {
+	var blockNumber int64 = 1
+	var amount int64 = 1
+	var expire = int64(utest.UnitRevealTimeout) + blockNumber + 2
+	initiator := utest.HOP1
+
+	st := makeInitStateChange(utest.ADDR, amount, blockNumber, initiator, expire)
+	st.NeedApproval = true
+	it := handleInitTraget(st)
+	state := it.NewState.(*mediatedtransfer.TargetState)
+	it = handleBlock(state, &transfer.BlockStateChange{BlockNumber: blockNumber + 1})
+	assert(t, len(it.Events), 0)
+	assert(t, state.State, mediatedtransfer.StateWaitingApproval)
+	it = handleBlock(state, &transfer.BlockStateChange{BlockNumber: blockNumber + 2})
+	assert(t, len(it.Events), 1)
+	_, ok := it.Events[0].(*mediatedtransfer.EventSendAnnounceDisposed)
+	assert(t, ok, true)
+	assert(t, state.State, mediatedtransfer.StateRejected)
+}
+
 /*
 The target node needs to inform the secret to the previous node to
     receive an updated balance proof.
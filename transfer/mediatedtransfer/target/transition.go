@@ -2,10 +2,12 @@ package target
 
 import (
 	"fmt"
+	"math/big"
 
 	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
 
 	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/rerr"
 	"github.com/SmartMeshFoundation/Photon/transfer"
 	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer"
 	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer/mediator"
@@ -58,6 +60,14 @@ func handleInitTraget(st *mediatedtransfer.ActionInitTargetStateChange) *transfe
 			  if there is not enough time to safely withdraw the token on-chain
 		     silently let the transfer expire.
 	*/
+	if safeToWait && st.NeedApproval {
+		//等待接收方应用确认,确认以后再发送SecretRequest
+		state.State = mediatedtransfer.StateWaitingApproval
+		return &transfer.TransitionResult{
+			NewState: state,
+			Events:   nil,
+		}
+	}
 	if safeToWait {
 		secretRequest := &mediatedtransfer.EventSendSecretRequest{
 			ChannelIdentifier: route.ChannelIdentifier,
@@ -78,6 +88,57 @@ func handleInitTraget(st *mediatedtransfer.ActionInitTargetStateChange) *transfe
 	}
 }
 
+/*
+rejectTransfer 拒绝这笔交易,通过AnnounceDisposed把锁退回给上家,上家不会再尝试其他路由
+*/
+func rejectTransfer(state *mediatedtransfer.TargetState, reason string) *transfer.TransitionResult {
+	tr := state.FromTransfer
+	state.State = mediatedtransfer.StateRejected
+	disposed := &mediatedtransfer.EventSendAnnounceDisposed{
+		Token:          tr.Token,
+		Amount:         new(big.Int).Set(tr.Amount),
+		LockSecretHash: tr.LockSecretHash,
+		Expiration:     tr.Expiration,
+		Receiver:       state.FromRoute.HopNode(),
+		Reason:         rerr.ErrTransferRejectedByTarget.Append(reason),
+	}
+	return &transfer.TransitionResult{
+		NewState: state,
+		Events:   []transfer.Event{disposed},
+	}
+}
+
+/*
+handleApproveTransfer 接收方应用确认以后发送SecretRequest,
+如果确认得太晚,已经来不及安全地在链上取回token,同样拒绝
+*/
+func handleApproveTransfer(state *mediatedtransfer.TargetState, st *mediatedtransfer.ActionApproveTransferStateChange) *transfer.TransitionResult {
+	tr := state.FromTransfer
+	if state.State != mediatedtransfer.StateWaitingApproval || st.LockSecretHash != tr.LockSecretHash {
+		return &transfer.TransitionResult{
+			NewState: state,
+			Events:   nil,
+		}
+	}
+	if !st.Approved {
+		return rejectTransfer(state, st.Reason)
+	}
+	if !mediator.IsSafeToWait(tr, state.FromRoute.RevealTimeout(), state.BlockNumber) {
+		return rejectTransfer(state, "approved too late")
+	}
+	state.State = mediatedtransfer.StateSecretRequest
+	secretRequest := &mediatedtransfer.EventSendSecretRequest{
+		ChannelIdentifier: state.FromRoute.ChannelIdentifier,
+		LockSecretHash:    tr.LockSecretHash,
+		Amount:            tr.Amount,
+		Receiver:          tr.Initiator,
+	}
+	return &transfer.TransitionResult{
+		NewState: state,
+		Events:   []transfer.Event{secretRequest},
+	}
+}
+
 //handleSecretRegisteredOnChain this state manager has finished
 func handleSecretRegisteredOnChain(state *mediatedtransfer.TargetState, st *mediatedtransfer.ContractSecretRevealOnChainStateChange) (it *transfer.TransitionResult) {
 	var events []transfer.Event
@@ -186,6 +247,10 @@ func handleBlock(state *mediatedtransfer.TargetState, st *transfer.BlockStateCha
 	   only emit the close event once
 
 	*/
+	if state.State == mediatedtransfer.StateWaitingApproval && !mediator.IsSafeToWait(state.FromTransfer, state.FromRoute.RevealTimeout(), state.BlockNumber) {
+		//一直没有确认,在锁过期之前退回给上家
+		return rejectTransfer(state, "approval timeout")
+	}
 	var events []transfer.Event
 	if state.State != mediatedtransfer.StateWaitingRegisterSecret && state.State != mediatedtransfer.StateSecretRegistered {
 		events = eventsForRegisterSecret(state)
@@ -226,6 +291,8 @@ func clearIfFinalized(previt *transfer.TransitionResult) (it *transfer.Transitio
 			Initiator:         state.FromTransfer.Initiator,
 			ChannelIdentifier: state.FromRoute.ChannelIdentifier,
 			Data:              state.FromTransfer.Data,
+			PaymentID:         state.FromTransfer.PaymentID,
+			Invoice:           state.FromTransfer.Invoice,
 		}
 		unlockSuccess := &mediatedtransfer.EventWithdrawSuccess{
 			LockSecretHash: state.FromTransfer.LockSecretHash,
@@ -266,8 +333,11 @@ func StateTransiton(originalState transfer.State, stateChange transfer.StateChan
 			it = handleBlock(state, st2)
 		case *mediatedtransfer.ContractSecretRevealOnChainStateChange:
 			it = handleSecretRegisteredOnChain(state, st2)
+		case *mediatedtransfer.ActionApproveTransferStateChange:
+			it = handleApproveTransfer(state, st2)
 		case *mediatedtransfer.ReceiveSecretRevealStateChange:
-			if state.FromTransfer.Secret == utils.EmptyHash {
+			//已经拒绝的交易,锁已经退回给上家,不能再泄露密码
+			if state.FromTransfer.Secret == utils.EmptyHash && state.State != mediatedtransfer.StateRejected {
 				//可能会反复收到 reveal secret, 比如 token swap的时候,再比如存在环路的时候
 				// Maybe we can receive reveal secret over and over again,
 				// such as when using token swap, or circuit exist.
@@ -81,6 +81,11 @@ func (rs *State) Channel() *channel.Channel {
 	return rs.ch
 }
 
+//SetChannel 从快照恢复以后,根据ChannelIdentifier重新关联通道
+func (rs *State) SetChannel(ch *channel.Channel) {
+	rs.ch = ch
+}
+
 //State of route channel
 func (rs *State) State() channeltype.State {
 	return rs.ch.State
@@ -14,6 +14,17 @@ type BlockStateChange struct {
 	BlockNumber int64
 }
 
+/*
+ChainReorgStateChange 检测到公链发生了分叉,ForkBlockNumber以及之后的块已经被替换,
+这些块中的合约事件会被重新查询并再次发送.
+*/
+type ChainReorgStateChange struct {
+	BlockNumber     int64 //新的最新块
+	ForkBlockNumber int64 //第一个被替换的块
+	OldHash         common.Hash
+	NewHash         common.Hash
+}
+
 /*
 ActionCancelTransferStateChange The user requests the transfer to be cancelled.
 
@@ -59,7 +70,11 @@ type StopTransferRightNowStateChange struct {
 
 func init() {
 	gob.Register(&BlockStateChange{})
+	gob.Register(&ChainReorgStateChange{})
 	gob.Register(&ActionCancelTransferStateChange{})
 	gob.Register(&ActionTransferDirectStateChange{})
 	gob.Register(&ReceiveTransferDirectStateChange{})
+	gob.Register(&CooperativeSettleStateChange{})
+	gob.Register(&WithdrawRequestStateChange{})
+	gob.Register(&StopTransferRightNowStateChange{})
 }
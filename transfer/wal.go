@@ -0,0 +1,73 @@
+package transfer
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+//WALStore 保存WAL的数据库,Append必须fsync以后才能返回
+type WALStore interface {
+	AppendStateChangeWAL(data []byte) (id uint64, err error)
+	RemoveStateChangeWAL(id uint64) error
+}
+
+/*
+WriteAheadLog 链上事件在交给StateManager处理之前先写入WAL,处理完以后再删除,
+崩溃重启以后重放WAL中剩下的StateChange,保证收到了的链上事件不会因为崩溃而丢失.
+重启以后链上事件还会从保存的块号之前重新查询一次,调用者需要用StateChangeKey去重.
+收到的消息不写入WAL,没有回复ack的消息对方会重发
+*/
+type WriteAheadLog struct {
+	store WALStore
+}
+
+//walRecord gob不能直接编码interface
+type walRecord struct {
+	StateChange StateChange
+}
+
+//NewWriteAheadLog create WriteAheadLog
+func NewWriteAheadLog(store WALStore) *WriteAheadLog {
+	return &WriteAheadLog{store: store}
+}
+
+func encodeWALStateChange(st StateChange) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(&walRecord{st})
+	return buf.Bytes(), err
+}
+
+//Append 返回的id在处理完以后传给Done
+func (w *WriteAheadLog) Append(st StateChange) (id uint64, err error) {
+	data, err := encodeWALStateChange(st)
+	if err != nil {
+		return
+	}
+	return w.store.AppendStateChangeWAL(data)
+}
+
+//Done StateChange已经处理完毕
+func (w *WriteAheadLog) Done(id uint64) error {
+	return w.store.RemoveStateChangeWAL(id)
+}
+
+//DecodeWALStateChange 解码WAL中保存的StateChange
+func DecodeWALStateChange(data []byte) (StateChange, error) {
+	r := new(walRecord)
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(r)
+	return r.StateChange, err
+}
+
+/*
+StateChangeKey 由StateChange的类型和内容决定,重新查询到的同一个链上事件key相同.
+内容完全相同的两个链上事件处理的结果也相同,只处理一次没有问题
+*/
+func StateChangeKey(st StateChange) (string, error) {
+	data, err := encodeWALStateChange(st)
+	if err != nil {
+		return "", err
+	}
+	return crypto.Keccak256Hash(data).Hex(), nil
+}
@@ -0,0 +1,75 @@
+package transfer
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/utils"
+)
+
+type memoryWALStore struct {
+	nextID  uint64
+	entries map[uint64][]byte
+}
+
+func (s *memoryWALStore) AppendStateChangeWAL(data []byte) (id uint64, err error) {
+	s.nextID++
+	s.entries[s.nextID] = data
+	return s.nextID, nil
+}
+
+func (s *memoryWALStore) RemoveStateChangeWAL(id uint64) error {
+	delete(s.entries, id)
+	return nil
+}
+
+func TestWriteAheadLog(t *testing.T) {
+	store := &memoryWALStore{entries: make(map[uint64][]byte)}
+	w := NewWriteAheadLog(store)
+	sts := []StateChange{
+		&BlockStateChange{BlockNumber: 3},
+		&StopTransferRightNowStateChange{TokenAddress: utils.NewRandomAddress(), ChannelIdentifier: utils.NewRandomHash()},
+	}
+	var ids []uint64
+	for _, st := range sts {
+		id, err := w.Append(st)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	for i, id := range ids {
+		st, err := DecodeWALStateChange(store.entries[id])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(st, sts[i]) {
+			t.Errorf("expect %s,got %s", utils.StringInterface(sts[i], 2), utils.StringInterface(st, 2))
+		}
+	}
+	err := w.Done(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store.entries) != 1 || store.entries[ids[1]] == nil {
+		t.Error("only the first state change should be removed")
+	}
+}
+
+func TestStateChangeKey(t *testing.T) {
+	st := &StopTransferRightNowStateChange{TokenAddress: utils.NewRandomAddress(), ChannelIdentifier: utils.NewRandomHash()}
+	st2 := *st
+	k1, err := StateChangeKey(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2, _ := StateChangeKey(&st2)
+	if k1 != k2 {
+		t.Error("same state change should have the same key")
+	}
+	st2.ChannelIdentifier = utils.NewRandomHash()
+	k2, _ = StateChangeKey(&st2)
+	if k1 == k2 {
+		t.Error("different state changes should have different keys")
+	}
+}
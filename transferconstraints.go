@@ -0,0 +1,62 @@
+package photon
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/SmartMeshFoundation/Photon/rerr"
+)
+
+/*
+TransferConstraints 用户对一次交易的限制,总手续费超过MaxFee或者跳数超过MaxHops的路由都不会使用,
+超过Deadline块还没有泄露密码时放弃交易.交易失败时原因中会说明违反了哪个约束.
+直接交易没有手续费,也只有一跳,不受这些限制
+*/
+type TransferConstraints struct {
+	MaxFee   *big.Int `json:"max_fee,omitempty"`
+	MaxHops  int      `json:"max_hops,omitempty"`
+	Deadline int64    `json:"deadline,omitempty"` //块号
+}
+
+//IsEmpty returns true if nothing is constrained
+func (c *TransferConstraints) IsEmpty() bool {
+	return c == nil || (c.MaxFee == nil && c.MaxHops == 0 && c.Deadline == 0)
+}
+
+//validate 截止块必须在当前块之后
+func (c *TransferConstraints) validate(blockNumber int64) error {
+	if c.IsEmpty() {
+		return nil
+	}
+	if c.MaxFee != nil && c.MaxFee.Sign() < 0 {
+		return rerr.ErrArgumentError.Append("max_fee must not be negative")
+	}
+	if c.MaxHops < 0 {
+		return rerr.ErrArgumentError.Append("max_hops must not be negative")
+	}
+	if c.Deadline < 0 || (c.Deadline > 0 && c.Deadline <= blockNumber) {
+		return rerr.ErrArgumentError.Append(fmt.Sprintf("deadline must be after current block %d", blockNumber))
+	}
+	return nil
+}
+
+func (c *TransferConstraints) maxFee() *big.Int {
+	if c == nil {
+		return nil
+	}
+	return c.MaxFee
+}
+
+func (c *TransferConstraints) maxHops() int {
+	if c == nil {
+		return 0
+	}
+	return c.MaxHops
+}
+
+func (c *TransferConstraints) deadline() int64 {
+	if c == nil {
+		return 0
+	}
+	return c.Deadline
+}
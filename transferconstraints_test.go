@@ -0,0 +1,23 @@
+package photon
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransferConstraints(t *testing.T) {
+	var c *TransferConstraints
+	assert.True(t, c.IsEmpty())
+	assert.Nil(t, c.validate(100))
+	assert.Nil(t, c.maxFee())
+	assert.EqualValues(t, 0, c.deadline())
+
+	c = &TransferConstraints{MaxFee: big.NewInt(3), MaxHops: 2, Deadline: 101}
+	assert.False(t, c.IsEmpty())
+	assert.Nil(t, c.validate(100))
+	assert.NotNil(t, c.validate(101))
+	assert.NotNil(t, (&TransferConstraints{MaxFee: big.NewInt(-1)}).validate(100))
+	assert.NotNil(t, (&TransferConstraints{MaxHops: -1}).validate(100))
+}
@@ -0,0 +1,146 @@
+package photon
+
+import (
+	"math/big"
+	"sort"
+
+	"github.com/SmartMeshFoundation/Photon/network/graph"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+估算交易:和发起交易一样查找路由和计算手续费,但是不锁定任何金额也不发送消息,
+钱包可以在用户确认之前显示需要的手续费以及通道余额是否足够
+*/
+
+const estimateTransferReqName = "estimateTransfer"
+
+type estimateTransferReq struct {
+	token  common.Address
+	target common.Address
+	amount *big.Int
+}
+
+//TransferEstimate 估算交易的结果,Routes中能用的路由排在前面
+type TransferEstimate struct {
+	Token  common.Address `json:"token_address"`
+	Target common.Address `json:"target_address"`
+	Amount *big.Int       `json:"amount"`
+	//Sufficient 至少有一条路由能够完成交易
+	Sufficient bool                   `json:"sufficient"`
+	Routes     []*graph.RouteEstimate `json:"routes"`
+}
+
+func (rs *Service) estimateTransferClient(token, target common.Address, amount *big.Int) *utils.AsyncResult {
+	req := &apiReq{
+		ReqID: utils.RandomString(10),
+		Name:  estimateTransferReqName,
+		Req: &estimateTransferReq{
+			token:  token,
+			target: target,
+			amount: amount,
+		},
+	}
+	return rs.sendReqClient(req)
+}
+
+/*
+estimateTransfer 启用了PFS时向PFS查询路由,和startMediatedTransferInternal一样不经过PFS也能直接给通道伙伴转账,
+否则使用本地路由.ChannelGraph不是线程安全的,必须在主线程中调用
+*/
+func (rs *Service) estimateTransfer(r *estimateTransferReq) (result *utils.AsyncResult) {
+	g := rs.getToken2ChannelGraph(r.token)
+	if g == nil {
+		return utils.NewAsyncResultWithError(rerr.ErrTokenNotFound)
+	}
+	e := &TransferEstimate{
+		Token:  r.token,
+		Target: r.target,
+		Amount: r.amount,
+	}
+	if rs.PfsProxy == nil {
+		e.Routes = g.EstimateRoutes(rs.Protocol, rs.NodeAddress, r.target, r.amount, rs.routingExcludeTo(r.token, r.target), rs)
+	} else {
+		e.Routes = rs.estimateRoutesFromPfs(r.token, r.target, r.amount)
+	}
+	for _, route := range e.Routes {
+		if route.Sufficient {
+			e.Sufficient = true
+			break
+		}
+	}
+	result = utils.NewAsyncResult()
+	result.Tag = e
+	result.Result <- nil
+	return
+}
+
+//estimateRoutesFromPfs PFS只返回余额足够的路径,查询失败时仍然可以直接给通道伙伴转账
+func (rs *Service) estimateRoutesFromPfs(token, target common.Address, amount *big.Int) (routes []*graph.RouteEstimate) {
+	newEstimate := func(partner common.Address, path []common.Address, fee *big.Int) *graph.RouteEstimate {
+		ch := rs.getChannel(token, partner)
+		if ch == nil {
+			return nil
+		}
+		if fee == nil {
+			fee = big.NewInt(0)
+		}
+		r := &graph.RouteEstimate{
+			Partner:    partner,
+			Path:       path,
+			Hops:       len(path),
+			Fee:        fee,
+			Capacity:   ch.Distributable(),
+			Sufficient: ch.CanTransfer(),
+		}
+		if !r.Sufficient {
+			r.Reason = "channel can not transfer"
+		} else if new(big.Int).Add(amount, fee).Cmp(r.Capacity) > 0 {
+			r.Sufficient = false
+			r.Reason = "channel doesn't have enough balance"
+		}
+		return r
+	}
+	if r := newEstimate(target, []common.Address{target}, nil); r != nil {
+		routes = append(routes, r)
+	}
+	paths, err := rs.getBestRoutesFromPfs(rs.NodeAddress, target, token, amount, true)
+	if err != nil {
+		return
+	}
+	for _, p := range paths {
+		if p.HopNode() == target {
+			continue
+		}
+		if r := newEstimate(p.HopNode(), p.Path, p.TotalFee); r != nil {
+			routes = append(routes, r)
+		}
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		return routes[i].Sufficient && !routes[j].Sufficient
+	})
+	return
+}
+
+/*
+EstimateTransfer 查找到target的候选路由,返回每条路由的跳数,手续费以及通道余额是否足够,不发送任何消息
+*/
+func (r *API) EstimateTransfer(tokenAddress common.Address, amount *big.Int, target common.Address) (estimate *TransferEstimate, err error) {
+	if amount == nil || amount.Sign() <= 0 {
+		err = rerr.ErrInvalidAmount.Append("amount must be positive")
+		return
+	}
+	if target == r.Photon.NodeAddress {
+		err = rerr.ErrArgumentError.Append("cannot transfer to myself")
+		return
+	}
+	result := r.Photon.estimateTransferClient(tokenAddress, target, amount)
+	err = <-result.Result
+	if err != nil {
+		return
+	}
+	estimate = result.Tag.(*TransferEstimate)
+	return
+}
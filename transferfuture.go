@@ -0,0 +1,141 @@
+package photon
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+TransferOutcome 交易结束以后的结果.
+成功时Fee是付出的总手续费,Path是使用的路由,从第一跳到接收方,
+失败时Stage说明交易停在了哪个阶段(failed,expired或者canceled),Reason是失败原因
+*/
+type TransferOutcome struct {
+	LockSecretHash common.Hash          `json:"lock_secret_hash"`
+	Success        bool                 `json:"success"`
+	Fee            *big.Int             `json:"fee,omitempty"`
+	Path           []common.Address     `json:"path,omitempty"`
+	Stage          models.TransferStage `json:"stage"`
+	Reason         string               `json:"reason,omitempty"`
+	Err            error                `json:"-"`
+}
+
+/*
+TransferFuture 发起交易以后立即返回,交易结束时Done关闭,之后Outcome返回结果,
+调用者不必阻塞等待或者轮询交易状态
+*/
+type TransferFuture struct {
+	LockSecretHash common.Hash
+	result         *utils.AsyncResult
+	done           chan struct{}
+	outcome        *TransferOutcome
+}
+
+//Done 交易结束时关闭
+func (f *TransferFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+//Outcome 交易结束以前返回nil
+func (f *TransferFuture) Outcome() *TransferOutcome {
+	select {
+	case <-f.done:
+		return f.outcome
+	default:
+		return nil
+	}
+}
+
+//Wait 等待交易结束,`ctx`先结束时返回ctx.Err(),交易不受影响
+func (f *TransferFuture) Wait(ctx context.Context) (*TransferOutcome, error) {
+	select {
+	case <-f.done:
+		return f.outcome, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+//Cancel 撤销交易,只有还没有泄露密码的交易才能撤销,撤销以后Done仍然会关闭
+func (f *TransferFuture) Cancel() error {
+	return f.result.Cancel()
+}
+
+/*
+TransferWithContext 发起交易并返回TransferFuture,`ctx`结束时交易还没有结果就撤销交易,
+交易已经泄露密码时无法撤销,只能等待交易结束
+*/
+func (r *API) TransferWithContext(ctx context.Context, tokenAddress common.Address, amount *big.Int, target common.Address, secret common.Hash, isDirectTransfer bool, data string, constraints *TransferConstraints) (f *TransferFuture, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	result, err := r.TransferInternal(tokenAddress, amount, target, secret, isDirectTransfer, data, nil, &TransferOptions{Constraints: constraints})
+	if err != nil {
+		return
+	}
+	lockSecretHash := result.LockSecretHash
+	result.SetCancel(func() error {
+		return r.CancelTransfer(lockSecretHash, tokenAddress)
+	})
+	f = &TransferFuture{
+		LockSecretHash: lockSecretHash,
+		result:         result,
+		done:           make(chan struct{}),
+	}
+	go func() {
+		var err error
+		select {
+		case err = <-result.Result:
+		case <-ctx.Done():
+			log.Info(fmt.Sprintf("transfer %s %s, cancel it", utils.HPex(lockSecretHash), ctx.Err()))
+			if err2 := result.Cancel(); err2 != nil {
+				log.Warn(fmt.Sprintf("cancel transfer %s err %s", utils.HPex(lockSecretHash), err2))
+			}
+			err = <-result.Result
+		}
+		f.outcome = r.transferOutcome(lockSecretHash, target, err)
+		close(f.done)
+	}()
+	return
+}
+
+//transferOutcome 根据交易的生命周期记录整理结果
+func (r *API) transferOutcome(lockSecretHash common.Hash, target common.Address, err error) *TransferOutcome {
+	o := &TransferOutcome{
+		LockSecretHash: lockSecretHash,
+		Success:        err == nil,
+		Err:            err,
+	}
+	l, err2 := r.Photon.dao.GetTransferLifecycle(lockSecretHash)
+	if err2 != nil {
+		//没有记录说明还没有开始就失败了,比如排队时被撤销
+		o.Stage = models.TransferStageFailed
+		if err != nil {
+			o.Reason = err.Error()
+		}
+		return o
+	}
+	o.Stage = l.Stage
+	if o.Success {
+		o.Stage = models.TransferStageUnlockReceived
+		o.Fee, o.Path = l.Fee, l.Path
+		if l.IsDirect {
+			o.Fee, o.Path = big.NewInt(0), []common.Address{target}
+		}
+		return o
+	}
+	if !o.Stage.IsFinal() {
+		o.Stage = models.TransferStageFailed
+	}
+	o.Reason = err.Error()
+	if n := len(l.Transitions); n > 0 && l.Transitions[n-1].Reason != "" {
+		o.Reason = l.Transitions[n-1].Reason
+	}
+	return o
+}
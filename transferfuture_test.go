@@ -0,0 +1,75 @@
+package photon
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransferOutcome(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	r := &API{Photon: &Service{dao: dao}}
+	target := utils.NewRandomAddress()
+	//排队时就被撤销,没有记录
+	o := r.transferOutcome(utils.NewRandomHash(), target, errors.New("canceled"))
+	assert.False(t, o.Success)
+	assert.Equal(t, models.TransferStageFailed, o.Stage)
+	assert.Equal(t, "canceled", o.Reason)
+
+	newLifecycle := func(isDirect bool) common.Hash {
+		l := &models.TransferLifecycle{
+			LockSecretHash: utils.NewRandomHash(),
+			TargetAddress:  target,
+			Amount:         big.NewInt(10),
+			IsDirect:       isDirect,
+		}
+		l.AddTransition(models.TransferStageInitiated, "")
+		assert.Nil(t, dao.NewTransferLifecycle(l))
+		return l.LockSecretHash
+	}
+	lockSecretHash := newLifecycle(false)
+	path := []common.Address{utils.NewRandomAddress(), target}
+	assert.Nil(t, dao.SetTransferRoute(lockSecretHash, big.NewInt(2), path))
+	o = r.transferOutcome(lockSecretHash, target, nil)
+	assert.True(t, o.Success)
+	assert.Equal(t, models.TransferStageUnlockReceived, o.Stage)
+	assert.EqualValues(t, 2, o.Fee.Int64())
+	assert.Equal(t, path, o.Path)
+
+	lockSecretHash = newLifecycle(true)
+	o = r.transferOutcome(lockSecretHash, target, nil)
+	assert.EqualValues(t, 0, o.Fee.Int64())
+	assert.Equal(t, []common.Address{target}, o.Path)
+
+	lockSecretHash = newLifecycle(false)
+	_, err := dao.AddTransferTransition(lockSecretHash, models.TransferStageExpired, "lock expired")
+	assert.Nil(t, err)
+	o = r.transferOutcome(lockSecretHash, target, errors.New("transfer fail"))
+	assert.False(t, o.Success)
+	assert.Equal(t, models.TransferStageExpired, o.Stage)
+	assert.Equal(t, "lock expired", o.Reason)
+}
+
+func TestTransferFuture(t *testing.T) {
+	f := &TransferFuture{done: make(chan struct{})}
+	assert.Nil(t, f.Outcome())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	_, err := f.Wait(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	f.outcome = &TransferOutcome{Success: true}
+	close(f.done)
+	o, err := f.Wait(context.Background())
+	assert.Nil(t, err)
+	assert.True(t, o.Success)
+	assert.Equal(t, o, f.Outcome())
+}
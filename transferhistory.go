@@ -0,0 +1,243 @@
+package photon
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+交易历史:把发出的SentTransferDetail和收到的ReceivedTransfer合在一起,按照时间排序分页返回,方便交易所对账.
+token和块号的过滤使用数据库的索引,其他条件在内存中过滤.
+cursor是上一页最后一条记录的位置,记录只会增加,所以用cursor翻页不会遗漏也不会重复
+*/
+
+//交易方向
+const (
+	TransferDirectionSent     = "sent"
+	TransferDirectionReceived = "received"
+)
+
+//交易状态,收到的交易都是成功的
+const (
+	TransferHistoryStatusPending = "pending"
+	TransferHistoryStatusSuccess = "success"
+	TransferHistoryStatusFailed  = "failed"
+)
+
+//分页大小
+const (
+	defaultTransferHistoryLimit = 100
+	maxTransferHistoryLimit     = 1000
+)
+
+//TransferHistoryQuery 查询条件,零值表示不过滤,块号和时间都是左闭右开
+type TransferHistoryQuery struct {
+	Token common.Address
+	//Partner 发出交易的接收方或者收到交易的发起方
+	Partner   common.Address
+	Direction string
+	Status    string
+	FromBlock int64
+	ToBlock   int64
+	FromTime  int64
+	ToTime    int64
+	Cursor    string
+	Limit     int
+}
+
+//TransferHistoryRecord 一笔发出或者收到的交易
+type TransferHistoryRecord struct {
+	Key               string         `json:"key"`
+	Direction         string         `json:"direction"`
+	Status            string         `json:"status"`
+	StatusMessage     string         `json:"status_message,omitempty"`
+	TokenAddress      common.Address `json:"token_address"`
+	PartnerAddress    common.Address `json:"partner_address"`
+	Amount            *big.Int       `json:"amount"`
+	Data              string         `json:"data"`
+	BlockNumber       int64          `json:"block_number"`
+	TimeStamp         int64          `json:"time_stamp"`
+	PaymentID         string         `json:"payment_id,omitempty"`
+	LockSecretHash    common.Hash    `json:"lock_secret_hash,omitempty"`
+	ChannelIdentifier common.Hash    `json:"channel_identifier"`
+}
+
+//TransferHistoryPage 一页交易历史,NextCursor为空表示没有更多了
+type TransferHistoryPage struct {
+	Records    []*TransferHistoryRecord `json:"records"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+}
+
+func sentTransferStatus(status models.TransferStatusCode) string {
+	switch status {
+	case models.TransferStatusSuccess:
+		return TransferHistoryStatusSuccess
+	case models.TransferStatusCanceled, models.TransferStatusFailed:
+		return TransferHistoryStatusFailed
+	}
+	return TransferHistoryStatusPending
+}
+
+func (r *TransferHistoryRecord) cursor() string {
+	return fmt.Sprintf("%d:%s:%s", r.TimeStamp, r.Direction, r.Key)
+}
+
+func (r *TransferHistoryRecord) less(o *TransferHistoryRecord) bool {
+	if r.TimeStamp != o.TimeStamp {
+		return r.TimeStamp < o.TimeStamp
+	}
+	if r.Direction != o.Direction {
+		return r.Direction < o.Direction
+	}
+	return r.Key < o.Key
+}
+
+//parseTransferHistoryCursor cursor还原成它指向的记录,只有排序用到的字段
+func parseTransferHistoryCursor(cursor string) (*TransferHistoryRecord, error) {
+	ss := strings.SplitN(cursor, ":", 3)
+	if len(ss) != 3 {
+		return nil, rerr.ErrArgumentError.Printf("invalid cursor %s", cursor)
+	}
+	t, err := strconv.ParseInt(ss[0], 10, 64)
+	if err != nil {
+		return nil, rerr.ErrArgumentError.Printf("invalid cursor %s", cursor)
+	}
+	return &TransferHistoryRecord{TimeStamp: t, Direction: ss[1], Key: ss[2]}, nil
+}
+
+func (q *TransferHistoryQuery) validate() error {
+	switch q.Direction {
+	case "", TransferDirectionSent, TransferDirectionReceived:
+	default:
+		return rerr.ErrArgumentError.Printf("unknown direction %s", q.Direction)
+	}
+	switch q.Status {
+	case "", TransferHistoryStatusPending, TransferHistoryStatusSuccess, TransferHistoryStatusFailed:
+	default:
+		return rerr.ErrArgumentError.Printf("unknown status %s", q.Status)
+	}
+	if q.Limit < 0 || q.Limit > maxTransferHistoryLimit {
+		return rerr.ErrArgumentError.Printf("limit must be between 1 and %d", maxTransferHistoryLimit)
+	}
+	return nil
+}
+
+func (q *TransferHistoryQuery) match(r *TransferHistoryRecord) bool {
+	if q.Partner != utils.EmptyAddress && r.PartnerAddress != q.Partner {
+		return false
+	}
+	if q.Status != "" && r.Status != q.Status {
+		return false
+	}
+	if q.FromTime > 0 && r.TimeStamp < q.FromTime {
+		return false
+	}
+	if q.ToTime > 0 && r.TimeStamp >= q.ToTime {
+		return false
+	}
+	return true
+}
+
+/*
+pageTransferHistory 合并发出和收到的交易,过滤以后返回cursor之后的一页
+*/
+func pageTransferHistory(q *TransferHistoryQuery, sent []*models.SentTransferDetail, received []*models.ReceivedTransfer) (page *TransferHistoryPage, err error) {
+	var after *TransferHistoryRecord
+	if q.Cursor != "" {
+		after, err = parseTransferHistoryCursor(q.Cursor)
+		if err != nil {
+			return
+		}
+	}
+	limit := q.Limit
+	if limit == 0 {
+		limit = defaultTransferHistoryLimit
+	}
+	var records []*TransferHistoryRecord
+	add := func(r *TransferHistoryRecord) {
+		if q.match(r) && (after == nil || after.less(r)) {
+			records = append(records, r)
+		}
+	}
+	for _, s := range sent {
+		add(&TransferHistoryRecord{
+			Key:               s.Key,
+			Direction:         TransferDirectionSent,
+			Status:            sentTransferStatus(s.Status),
+			StatusMessage:     s.StatusMessage,
+			TokenAddress:      s.TokenAddress,
+			PartnerAddress:    s.TargetAddress,
+			Amount:            s.Amount,
+			Data:              s.Data,
+			BlockNumber:       s.BlockNumber,
+			TimeStamp:         s.SendingTime,
+			PaymentID:         s.PaymentID,
+			LockSecretHash:    s.LockSecretHash,
+			ChannelIdentifier: s.ChannelIdentifier,
+		})
+	}
+	for _, rt := range received {
+		add(&TransferHistoryRecord{
+			Key:               rt.Key,
+			Direction:         TransferDirectionReceived,
+			Status:            TransferHistoryStatusSuccess,
+			TokenAddress:      rt.TokenAddress,
+			PartnerAddress:    rt.FromAddress,
+			Amount:            rt.Amount,
+			Data:              rt.Data,
+			BlockNumber:       rt.BlockNumber,
+			TimeStamp:         rt.TimeStamp,
+			PaymentID:         rt.PaymentID,
+			ChannelIdentifier: rt.ChannelIdentifier,
+		})
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].less(records[j])
+	})
+	page = &TransferHistoryPage{Records: records}
+	if len(records) > limit {
+		page.Records = records[:limit]
+		page.NextCursor = page.Records[limit-1].cursor()
+	}
+	return
+}
+
+/*
+GetTransferHistory 按照条件分页查询发出和收到的交易,按照时间从早到晚排序,
+把返回的NextCursor放到下一次查询的Cursor中就能取到下一页
+*/
+func (r *API) GetTransferHistory(q *TransferHistoryQuery) (page *TransferHistoryPage, err error) {
+	if err = q.validate(); err != nil {
+		return
+	}
+	fromBlock, toBlock := q.FromBlock, q.ToBlock
+	if fromBlock <= 0 {
+		fromBlock = -1
+	}
+	if toBlock <= 0 {
+		toBlock = -1
+	}
+	var sent []*models.SentTransferDetail
+	var received []*models.ReceivedTransfer
+	if q.Direction != TransferDirectionReceived {
+		sent, err = r.Photon.dao.GetSentTransferDetailList(q.Token, -1, -1, fromBlock, toBlock)
+		if err != nil {
+			return
+		}
+	}
+	if q.Direction != TransferDirectionSent && (q.Status == "" || q.Status == TransferHistoryStatusSuccess) {
+		received, err = r.Photon.dao.GetReceivedTransferList(q.Token, fromBlock, toBlock, -1, -1)
+		if err != nil {
+			return
+		}
+	}
+	return pageTransferHistory(q, sent, received)
+}
@@ -0,0 +1,64 @@
+package photon
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPageTransferHistory(t *testing.T) {
+	token := utils.NewRandomAddress()
+	alice, bob := utils.NewRandomAddress(), utils.NewRandomAddress()
+	sent := []*models.SentTransferDetail{
+		{Key: "s1", TokenAddress: token, TargetAddress: alice, Amount: big.NewInt(1), SendingTime: 10, Status: models.TransferStatusSuccess},
+		{Key: "s2", TokenAddress: token, TargetAddress: bob, Amount: big.NewInt(2), SendingTime: 30, Status: models.TransferStatusFailed},
+		{Key: "s3", TokenAddress: token, TargetAddress: alice, Amount: big.NewInt(3), SendingTime: 50, Status: models.TransferStatusCanCancel},
+	}
+	received := []*models.ReceivedTransfer{
+		{Key: "r1", TokenAddress: token, FromAddress: bob, Amount: big.NewInt(4), TimeStamp: 20},
+		{Key: "r2", TokenAddress: token, FromAddress: alice, Amount: big.NewInt(5), TimeStamp: 30},
+	}
+	keys := func(page *TransferHistoryPage) (ks []string) {
+		for _, r := range page.Records {
+			ks = append(ks, r.Key)
+		}
+		return
+	}
+	page, err := pageTransferHistory(&TransferHistoryQuery{}, sent, received)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"s1", "r1", "r2", "s2", "s3"}, keys(page))
+	assert.Empty(t, page.NextCursor)
+	assert.Equal(t, TransferHistoryStatusPending, page.Records[4].Status)
+
+	//翻页不重复也不遗漏
+	var all []string
+	q := &TransferHistoryQuery{Limit: 2}
+	for {
+		page, err = pageTransferHistory(q, sent, received)
+		assert.Nil(t, err)
+		all = append(all, keys(page)...)
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	assert.Equal(t, []string{"s1", "r1", "r2", "s2", "s3"}, all)
+
+	page, err = pageTransferHistory(&TransferHistoryQuery{Partner: alice}, sent, received)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"s1", "r2", "s3"}, keys(page))
+	page, err = pageTransferHistory(&TransferHistoryQuery{Status: TransferHistoryStatusFailed}, sent, received)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"s2"}, keys(page))
+	page, err = pageTransferHistory(&TransferHistoryQuery{FromTime: 20, ToTime: 50}, sent, received)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"r1", "r2", "s2"}, keys(page))
+
+	_, err = pageTransferHistory(&TransferHistoryQuery{Cursor: "bad"}, sent, received)
+	assert.NotNil(t, err)
+	assert.NotNil(t, (&TransferHistoryQuery{Direction: "both"}).validate())
+	assert.NotNil(t, (&TransferHistoryQuery{Limit: maxTransferHistoryLimit + 1}).validate())
+}
@@ -0,0 +1,53 @@
+package photon
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+newTransferLifecycle 发起交易时开始记录交易经历的阶段,用于发起方查询交易进展和失败原因
+*/
+func (rs *Service) newTransferLifecycle(tokenAddress, target common.Address, amount *big.Int, isDirect bool, lockSecretHash common.Hash) {
+	l := &models.TransferLifecycle{
+		LockSecretHash: lockSecretHash,
+		TokenAddress:   tokenAddress,
+		TargetAddress:  target,
+		Amount:         amount,
+		IsDirect:       isDirect,
+	}
+	l.AddTransition(models.TransferStageInitiated, "")
+	err := rs.dao.NewTransferLifecycle(l)
+	if err != nil {
+		log.Error(fmt.Sprintf("NewTransferLifecycle %s err %s", utils.HPex(lockSecretHash), err))
+	}
+}
+
+/*
+recordTransferStage 只有自己发起的交易才有记录,作为中间节点或者接收方时直接忽略
+*/
+func (rs *Service) recordTransferStage(lockSecretHash common.Hash, stage models.TransferStage, reason string) {
+	_, err := rs.dao.AddTransferTransition(lockSecretHash, stage, reason)
+	if err == rerr.ErrNotFound {
+		return
+	}
+	if err != nil {
+		log.Error(fmt.Sprintf("AddTransferTransition %s %s err %s", utils.HPex(lockSecretHash), stage, err))
+		return
+	}
+	log.Trace(fmt.Sprintf("transfer %s enter stage %s %s", utils.HPex(lockSecretHash), stage, reason))
+}
+
+//recordTransferRoute 交易成功时记录付出的手续费和使用的路由,不是自己发起的交易直接忽略
+func (rs *Service) recordTransferRoute(lockSecretHash common.Hash, fee *big.Int, path []common.Address) {
+	err := rs.dao.SetTransferRoute(lockSecretHash, fee, path)
+	if err != nil && err != rerr.ErrNotFound {
+		log.Error(fmt.Sprintf("SetTransferRoute %s err %s", utils.HPex(lockSecretHash), err))
+	}
+}
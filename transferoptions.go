@@ -0,0 +1,40 @@
+package photon
+
+import (
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+TransferOptions 发起交易时可选的参数,零值表示普通的用户交易,没有任何附加要求.
+API.Transfer,TransferAsync,TransferOperation和TransferInternal都原样传给交易请求
+*/
+type TransferOptions struct {
+	Payment        *PaymentMeta         //用户指定的支付ID和发票,直接交易不支持
+	IdempotencyKey string               //调用者指定的幂等键,同一个键只会发起一笔交易
+	Priority       TransferPriority     //发送队列中的优先级
+	Exclusion      *RouteExclusion      //路由中不能出现的节点和通道
+	Constraints    *TransferConstraints //最高手续费,最大跳数和截止块
+}
+
+//validate 检查每一个选项,直接交易不能携带支付ID
+func (o *TransferOptions) validate(ourAddress, target common.Address, blockNumber int64, isDirectTransfer bool) (err error) {
+	if err = o.Exclusion.validate(ourAddress, target); err != nil {
+		return
+	}
+	if err = o.Payment.validate(); err != nil {
+		return
+	}
+	if err = o.Constraints.validate(blockNumber); err != nil {
+		return
+	}
+	if err = validateIdempotencyKey(o.IdempotencyKey); err != nil {
+		return
+	}
+	if isDirectTransfer && !o.Payment.IsEmpty() {
+		//DirectTransfer消息中没有地方携带支付ID
+		err = rerr.ErrArgumentError.Append("payment_id is not supported by direct transfer")
+		return
+	}
+	return
+}
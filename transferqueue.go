@@ -0,0 +1,273 @@
+package photon
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//TransferPriority 自己发起的交易的优先级,并发交易数达到上限时,优先级高的交易先开始
+type TransferPriority int
+
+const (
+	//TransferPriorityUser 用户发起的交易
+	TransferPriorityUser TransferPriority = iota
+	//TransferPriorityScheduled 定时支付,流式支付等计划中的交易
+	TransferPriorityScheduled
+	//TransferPriorityRebalancing 自动平衡通道余额的交易
+	TransferPriorityRebalancing
+	numTransferPriority
+)
+
+var transferPriorityNames = [numTransferPriority]string{"user", "scheduled", "rebalancing"}
+
+func (p TransferPriority) String() string {
+	if p < 0 || p >= numTransferPriority {
+		return fmt.Sprintf("unknown priority %d", p)
+	}
+	return transferPriorityNames[p]
+}
+
+//ParseTransferPriority 空字符串表示用户发起的交易
+func ParseTransferPriority(s string) (TransferPriority, error) {
+	if s == "" {
+		return TransferPriorityUser, nil
+	}
+	for i, name := range transferPriorityNames {
+		if name == s {
+			return TransferPriority(i), nil
+		}
+	}
+	return 0, rerr.ErrArgumentError.Printf("unknown transfer priority %s, should be one of %v", s, transferPriorityNames)
+}
+
+//backgroundWeights 后台交易之间按照权重轮流开始,计划中的交易多,平衡交易也不会一直等待
+var backgroundWeights = [numTransferPriority]int{TransferPriorityScheduled: 2, TransferPriorityRebalancing: 1}
+
+type queuedTransfer struct {
+	req      *transferReq
+	priority TransferPriority
+	//result 返回给调用者,交易结束以后转发实际的结果
+	result *utils.AsyncResult
+}
+
+/*
+tokenTransferQueue 一种token的发送队列.
+同一种token的交易共用自己在各个通道中的余额,所以按照token而不是按照路由选出来的通道排队
+*/
+type tokenTransferQueue struct {
+	inFlight           int
+	inFlightBackground int
+	pending            [numTransferPriority][]*queuedTransfer
+	credits            [numTransferPriority]int //后台交易这一轮还可以开始的数量
+}
+
+/*
+next 取出下一个可以开始的交易.
+用户发起的交易总是先开始,并且后台交易不能占用为用户保留的并发数,后台交易之间按权重轮流
+*/
+func (q *tokenTransferQueue) next() *queuedTransfer {
+	if q.inFlight >= params.MaxInFlightTransfersPerToken {
+		return nil
+	}
+	if len(q.pending[TransferPriorityUser]) > 0 {
+		return q.pop(TransferPriorityUser)
+	}
+	if q.inFlightBackground >= params.MaxInFlightTransfersPerToken-params.TransferSlotsReservedForUser {
+		return nil
+	}
+	for round := 0; round < 2; round++ {
+		for p := TransferPriorityScheduled; p < numTransferPriority; p++ {
+			if len(q.pending[p]) > 0 && q.credits[p] > 0 {
+				q.credits[p]--
+				return q.pop(p)
+			}
+		}
+		//有交易的优先级都已经用完了这一轮的权重,开始新的一轮
+		q.credits = backgroundWeights
+	}
+	return nil
+}
+
+func (q *tokenTransferQueue) pop(p TransferPriority) *queuedTransfer {
+	qt := q.pending[p][0]
+	q.pending[p] = q.pending[p][1:]
+	q.inFlight++
+	if p != TransferPriorityUser {
+		q.inFlightBackground++
+	}
+	return qt
+}
+
+func (q *tokenTransferQueue) finish(p TransferPriority) {
+	q.inFlight--
+	if p != TransferPriorityUser {
+		q.inFlightBackground--
+	}
+}
+
+func (q *tokenTransferQueue) remove(lockSecretHash common.Hash) *queuedTransfer {
+	for p := range q.pending {
+		for i, qt := range q.pending[p] {
+			if !qt.req.IsDirectTransfer && qt.result.LockSecretHash == lockSecretHash {
+				q.pending[p] = append(q.pending[p][:i], q.pending[p][i+1:]...)
+				return qt
+			}
+		}
+	}
+	return nil
+}
+
+func (q *tokenTransferQueue) idle() bool {
+	if q.inFlight > 0 {
+		return false
+	}
+	for _, pending := range q.pending {
+		if len(pending) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+//TransferQueueStatus 一种token的发送队列状态
+type TransferQueueStatus struct {
+	InFlight int            `json:"in_flight"`
+	Pending  map[string]int `json:"pending"`
+}
+
+/*
+transferQueue 自己发起的交易的发送队列,只在Service的主循环中访问,不需要加锁
+*/
+type transferQueue struct {
+	tokens map[common.Address]*tokenTransferQueue
+}
+
+func newTransferQueue() *transferQueue {
+	return &transferQueue{
+		tokens: make(map[common.Address]*tokenTransferQueue),
+	}
+}
+
+func (tq *transferQueue) get(token common.Address) *tokenTransferQueue {
+	q, ok := tq.tokens[token]
+	if !ok {
+		q = &tokenTransferQueue{credits: backgroundWeights}
+		tq.tokens[token] = q
+	}
+	return q
+}
+
+func (tq *transferQueue) status() map[common.Address]*TransferQueueStatus {
+	m := make(map[common.Address]*TransferQueueStatus)
+	for token, q := range tq.tokens {
+		s := &TransferQueueStatus{
+			InFlight: q.inFlight,
+			Pending:  make(map[string]int),
+		}
+		for p, pending := range q.pending {
+			s.Pending[TransferPriority(p).String()] = len(pending)
+		}
+		m[token] = s
+	}
+	return m
+}
+
+/*
+prepareLockSecretHash 在排队之前确定交易的LockSecretHash,这样排队的交易也可以立即返回LockSecretHash.
+没有指定密码的交易在这里生成密码,直接交易生成假的LockSecretHash
+*/
+func (r *transferReq) prepareLockSecretHash() common.Hash {
+	if r.IsDirectTransfer {
+		if r.fakeLockSecretHash == utils.EmptyHash {
+			r.fakeLockSecretHash = utils.NewRandomHash()
+		}
+		return r.fakeLockSecretHash
+	}
+	if r.Secret == utils.EmptyHash {
+		r.Secret = utils.NewRandomHash()
+		r.secretGenerated = true
+	}
+	return utils.ShaSecret(r.Secret[:])
+}
+
+//submitTransfer 把交易放入发送队列,并发数没有达到上限时立即开始
+func (rs *Service) submitTransfer(r *transferReq) *utils.AsyncResult {
+	qt := &queuedTransfer{
+		req:      r,
+		priority: r.Priority,
+		result:   utils.NewAsyncResult(),
+	}
+	qt.result.LockSecretHash = r.prepareLockSecretHash()
+	q := rs.transferQueue.get(r.TokenAddress)
+	q.pending[qt.priority] = append(q.pending[qt.priority], qt)
+	rs.dispatchTransfers(r.TokenAddress)
+	return qt.result
+}
+
+//dispatchTransfers 开始这种token所有可以开始的交易
+func (rs *Service) dispatchTransfers(token common.Address) {
+	q := rs.transferQueue.get(token)
+	for {
+		qt := q.next()
+		if qt == nil {
+			break
+		}
+		rs.startQueuedTransfer(qt)
+	}
+	if q.idle() {
+		delete(rs.transferQueue.tokens, token)
+	}
+}
+
+func (rs *Service) startQueuedTransfer(qt *queuedTransfer) {
+	r := qt.req
+	var result *utils.AsyncResult
+	if r.IsDirectTransfer {
+		result = rs.directTransferAsync(r.TokenAddress, r.Target, r.Amount, r.Data, r.fakeLockSecretHash, r.Exclusion)
+	} else if r.secretGenerated {
+		result = rs.startMediatedTransferWithSecret(r.TokenAddress, r.Target, r.Amount, r.Secret, r.Data, r.Payment, r.RouteInfo, r.Exclusion, r.Constraints)
+	} else {
+		result = rs.startMediatedTransfer(r.TokenAddress, r.Target, r.Amount, r.Secret, r.Data, r.Payment, r.RouteInfo, r.Exclusion, r.Constraints)
+	}
+	log.Trace(fmt.Sprintf("start %s transfer token=%s target=%s amount=%s lockSecretHash=%s",
+		qt.priority, utils.APex2(r.TokenAddress), utils.APex2(r.Target), r.Amount, utils.HPex(qt.result.LockSecretHash)))
+	go func() {
+		var err error
+		select {
+		case err = <-result.Result:
+		case <-rs.quitChan:
+			return
+		}
+		qt.result.Result <- err
+		rs.transferFinishedClient(r.TokenAddress, qt.priority)
+	}()
+}
+
+/*
+cancelQueuedTransfer 撤销还在队列中等待的交易,交易已经开始时返回false
+*/
+func (rs *Service) cancelQueuedTransfer(token common.Address, lockSecretHash common.Hash) bool {
+	q, ok := rs.transferQueue.tokens[token]
+	if !ok {
+		return false
+	}
+	qt := q.remove(lockSecretHash)
+	if qt == nil {
+		return false
+	}
+	qt.result.Result <- rerr.ErrTransferCanceled
+	return true
+}
+
+//transferFinished 一个交易结束,释放并发数,开始排队的交易
+func (rs *Service) transferFinished(r *transferFinishedReq) *utils.AsyncResult {
+	q := rs.transferQueue.get(r.token)
+	q.finish(r.priority)
+	rs.dispatchTransfers(r.token)
+	return utils.NewAsyncResultWithError(nil)
+}
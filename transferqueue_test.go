@@ -0,0 +1,69 @@
+package photon
+
+import (
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTransferPriority(t *testing.T) {
+	p, err := ParseTransferPriority("")
+	assert.Nil(t, err)
+	assert.EqualValues(t, TransferPriorityUser, p)
+	p, err = ParseTransferPriority("rebalancing")
+	assert.Nil(t, err)
+	assert.EqualValues(t, TransferPriorityRebalancing, p)
+	_, err = ParseTransferPriority("urgent")
+	assert.NotNil(t, err)
+}
+
+func TestTokenTransferQueue(t *testing.T) {
+	oldMax, oldReserved := params.MaxInFlightTransfersPerToken, params.TransferSlotsReservedForUser
+	defer func() {
+		params.MaxInFlightTransfersPerToken, params.TransferSlotsReservedForUser = oldMax, oldReserved
+	}()
+	params.MaxInFlightTransfersPerToken = 4
+	params.TransferSlotsReservedForUser = 1
+	tq := newTransferQueue()
+	token := utils.NewRandomAddress()
+	q := tq.get(token)
+	push := func(p TransferPriority) *queuedTransfer {
+		qt := &queuedTransfer{req: &transferReq{TokenAddress: token, TransferOptions: TransferOptions{Priority: p}}, priority: p, result: utils.NewAsyncResult()}
+		qt.result.LockSecretHash = utils.NewRandomHash()
+		q.pending[p] = append(q.pending[p], qt)
+		return qt
+	}
+	for i := 0; i < 6; i++ {
+		push(TransferPriorityRebalancing)
+		push(TransferPriorityScheduled)
+	}
+	//后台交易按权重轮流,并且不能占用为用户保留的并发数
+	var started []TransferPriority
+	for qt := q.next(); qt != nil; qt = q.next() {
+		started = append(started, qt.priority)
+	}
+	assert.EqualValues(t, []TransferPriority{TransferPriorityScheduled, TransferPriorityScheduled, TransferPriorityRebalancing}, started)
+	//用户交易使用保留的并发数,排在所有后台交易之前
+	user := push(TransferPriorityUser)
+	assert.EqualValues(t, user, q.next())
+	push(TransferPriorityUser)
+	assert.Nil(t, q.next())
+	q.finish(TransferPriorityScheduled)
+	assert.EqualValues(t, TransferPriorityUser, q.next().priority)
+	q.finish(TransferPriorityUser)
+	q.finish(TransferPriorityUser)
+	//新的一轮
+	assert.EqualValues(t, TransferPriorityScheduled, q.next().priority)
+	assert.Nil(t, q.next())
+
+	cancel := push(TransferPriorityScheduled)
+	assert.EqualValues(t, cancel, q.remove(cancel.result.LockSecretHash))
+	assert.Nil(t, q.remove(cancel.result.LockSecretHash))
+	s := tq.status()[token]
+	assert.EqualValues(t, 3, s.InFlight)
+	assert.EqualValues(t, 3, s.Pending["scheduled"])
+	assert.EqualValues(t, 5, s.Pending["rebalancing"])
+	assert.False(t, q.idle())
+}
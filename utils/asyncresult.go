@@ -1,15 +1,30 @@
 package utils
 
-import "github.com/ethereum/go-ethereum/common"
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//ErrNotCancelable 操作不支持撤销
+var ErrNotCancelable = errors.New("operation can not be canceled")
 
 /*
 AsyncResult is designed for async notify
 and Tag can be save anything by user.
+长时间的操作可以设置ID和Deadline,调用者不必阻塞等待,而是通过ID查询进度或者撤销.
 */
 type AsyncResult struct {
 	Result         chan error
 	Tag            interface{}
 	LockSecretHash common.Hash // only for /api/1/transfer use, return LockSecretHash to caller
+	ID             string      // 操作ID,可以通过/api/1/operations/{id}查询
+	Deadline       time.Time   // 超过这个时间还没有结果,认为操作超时,零值表示没有限制
+	lock           sync.Mutex
+	progress       []string
+	cancel         func() error
 }
 
 //NewAsyncResult create a AsyncResult
@@ -25,3 +40,35 @@ func NewAsyncResultWithError(err error) *AsyncResult {
 	r.Result <- err
 	return r
 }
+
+//AddProgress 记录操作的一个进度
+func (r *AsyncResult) AddProgress(progress string) {
+	r.lock.Lock()
+	r.progress = append(r.progress, progress)
+	r.lock.Unlock()
+}
+
+//Progress returns all progress of this operation
+func (r *AsyncResult) Progress() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string{}, r.progress...)
+}
+
+//SetCancel 设置撤销操作的方法,没有设置的操作不能撤销
+func (r *AsyncResult) SetCancel(cancel func() error) {
+	r.lock.Lock()
+	r.cancel = cancel
+	r.lock.Unlock()
+}
+
+//Cancel 撤销操作,撤销成功以后Result仍然会收到操作的结果
+func (r *AsyncResult) Cancel() error {
+	r.lock.Lock()
+	cancel := r.cancel
+	r.lock.Unlock()
+	if cancel == nil {
+		return ErrNotCancelable
+	}
+	return cancel()
+}
@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+var clockSkew int64
+
+//SetClockSkew 设置本机时钟比可信时间快多少,负数表示慢
+func SetClockSkew(skew time.Duration) {
+	atomic.StoreInt64(&clockSkew, int64(skew))
+}
+
+//ClockSkew 本机时钟比可信时间快多少
+func ClockSkew() time.Duration {
+	return time.Duration(atomic.LoadInt64(&clockSkew))
+}
+
+/*
+TrustedNow 修正了本机时钟偏差的当前时间,只用于和其他节点或服务器给出的时间戳比较.
+计算超时应该使用time.Since这样的单调时钟或者块号,不受本机时钟调整的影响
+*/
+func TrustedNow() time.Time {
+	return time.Now().Add(-ClockSkew())
+}
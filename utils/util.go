@@ -7,6 +7,7 @@ import (
 	"os"
 	"reflect"
 	"runtime"
+	"sync"
 	"time"
 	"unsafe"
 
@@ -67,6 +68,21 @@ func StringToBytes(s string) []byte {
 //RandSrc random source from math
 var RandSrc = rand.NewSource(time.Now().UnixNano())
 
+//randReader 随机数来源,默认是crypto/rand,确定性模式下是固定种子的math/rand
+var randReader io.Reader = rand2.Reader
+var randLock sync.Mutex
+
+/*
+SetRandomSeed 进入确定性模式,之后生成的密码,ReqID,随机地址等都由`seed`决定,方便复现集成测试中的问题.
+只能用于测试,正式环境中使用会导致密码可以被预测.
+*/
+func SetRandomSeed(seed int64) {
+	randLock.Lock()
+	defer randLock.Unlock()
+	randReader = rand.New(rand.NewSource(seed))
+	RandSrc = rand.NewSource(seed)
+}
+
 func readFullOrPanic(r io.Reader, v []byte) int {
 	n, err := io.ReadFull(r, v)
 	if err != nil {
@@ -79,7 +95,9 @@ func readFullOrPanic(r io.Reader, v []byte) int {
 // ex: var randomstrbytes []byte; randomstrbytes = utils.Random(32)
 func Random(n int) []byte {
 	v := make([]byte, n)
-	readFullOrPanic(rand2.Reader, v)
+	randLock.Lock()
+	defer randLock.Unlock()
+	readFullOrPanic(randReader, v)
 	return v
 }
 
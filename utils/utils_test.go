@@ -6,6 +6,7 @@ import (
 	"math/big"
 	"testing"
 
+	rand2 "crypto/rand"
 	"crypto/sha256"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -61,3 +62,20 @@ func TestWriteVarInt(t *testing.T) {
 		return
 	}
 }
+
+func TestSetRandomSeed(t *testing.T) {
+	defer func() {
+		randReader = rand2.Reader
+	}()
+	SetRandomSeed(7)
+	h1, s1 := NewRandomHash(), RandomString(10)
+	SetRandomSeed(7)
+	h2, s2 := NewRandomHash(), RandomString(10)
+	if h1 != h2 || s1 != s2 {
+		t.Error("same seed should generate same random values")
+	}
+	SetRandomSeed(8)
+	if NewRandomHash() == h1 {
+		t.Error("different seed should generate different random values")
+	}
+}
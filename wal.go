@@ -0,0 +1,91 @@
+package photon
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/transfer"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer"
+	"github.com/SmartMeshFoundation/Photon/utils"
+)
+
+/*
+onBlockchainStateChange 链上事件写入WAL以后再处理.
+重启以后会从保存的块号之前重新查询链上事件,写入过WAL的事件记录在ChainEventRecord中,
+重新查询到的直接丢弃,否则WAL重放一次,重新查询到又处理一次.
+链上事件没法拒绝,写入失败也要处理
+*/
+func (rs *Service) onBlockchainStateChange(st transfer.StateChange) {
+	key, err := transfer.StateChangeKey(st)
+	if err != nil {
+		log.Error(fmt.Sprintf("state change %s has no key, handle it without wal err %s", utils.StringInterface(st, 2), err))
+		rs.handleBlockchainStateChange(st)
+		return
+	}
+	if _, delivered := rs.dao.CheckChainEventDelivered(models.ChainEventID(key)); delivered {
+		log.Trace(fmt.Sprintf("chain event %s already handled, ignore", utils.StringInterface(st, 2)))
+		return
+	}
+	id, err := rs.wal.Append(st)
+	if err != nil {
+		log.Error(fmt.Sprintf("append state change %s to wal err %s", utils.StringInterface(st, 2), err))
+	}
+	//写入WAL以后,崩溃了也由WAL重放,重新查询到的不再处理
+	rs.markChainEventDelivered(key, st)
+	rs.handleBlockchainStateChange(st)
+	rs.walDone(id)
+}
+
+func (rs *Service) handleBlockchainStateChange(st transfer.StateChange) {
+	err := rs.StateMachineEventHandler.OnBlockchainStateChange(st)
+	if err != nil {
+		log.Error(fmt.Sprintf("stateMachineEventHandler.OnBlockchainStateChange %s", err))
+	}
+}
+
+func (rs *Service) markChainEventDelivered(key string, st transfer.StateChange) {
+	var blockNumber int64
+	if st2, ok := st.(mediatedtransfer.ContractStateChange); ok {
+		blockNumber = st2.GetBlockNumber()
+	}
+	rs.dao.NewDeliveredChainEvent(models.ChainEventID(key), uint64(blockNumber))
+}
+
+func (rs *Service) walDone(id uint64) {
+	if id == 0 {
+		return
+	}
+	err := rs.wal.Done(id)
+	if err != nil {
+		log.Error(fmt.Sprintf("remove state change %d from wal err %s", id, err))
+	}
+}
+
+/*
+replayWAL 重放崩溃前收到了但是没有处理完的链上事件,必须在restore之后,AlarmTask启动之前进行.
+重放之前先记录下来,AlarmTask重新查询到的时候不再处理.
+旧版本写入的收到的消息无法解码,直接丢弃,对方会重发
+*/
+func (rs *Service) replayWAL() {
+	es, err := rs.dao.GetAllStateChangeWAL()
+	if err != nil {
+		log.Error(fmt.Sprintf("GetAllStateChangeWAL err %s", err))
+		return
+	}
+	for _, e := range es {
+		st, err := transfer.DecodeWALStateChange(e.StateChange)
+		if err != nil {
+			log.Error(fmt.Sprintf("decode wal %d err %s", e.ID, err))
+			rs.walDone(e.ID)
+			continue
+		}
+		log.Info(fmt.Sprintf("replay wal %d %s", e.ID, utils.StringInterface(st, 2)))
+		key, err := transfer.StateChangeKey(st)
+		if err == nil {
+			rs.markChainEventDelivered(key, st)
+		}
+		rs.handleBlockchainStateChange(st)
+		rs.walDone(e.ID)
+	}
+}
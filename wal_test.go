@@ -0,0 +1,57 @@
+package photon
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/network/graph"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/transfer"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWALChainEventsHandledOnce(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	rs := &Service{
+		dao:                dao,
+		wal:                transfer.NewWriteAheadLog(dao),
+		Config:             &params.Config{},
+		Token2ChannelGraph: make(map[common.Address]*graph.ChannelGraph),
+	}
+	rs.StateMachineEventHandler = newStateMachineEventHandler(rs)
+	newStateChange := func() *mediatedtransfer.ContractBalanceStateChange {
+		return &mediatedtransfer.ContractBalanceStateChange{
+			ChannelIdentifier:  utils.NewRandomHash(),
+			ParticipantAddress: utils.NewRandomAddress(),
+			Balance:            big.NewInt(10),
+			BlockNumber:        3,
+		}
+	}
+	handler := rs.StateMachineEventHandler
+	st := newStateChange()
+	rs.onBlockchainStateChange(st)
+	es, err := dao.GetAllStateChangeWAL()
+	assert.Nil(t, err)
+	assert.Len(t, es, 0)
+	//重启以后重新查询到的同一个事件不再处理,处理的话nil handler会panic
+	rs.StateMachineEventHandler = nil
+	st2 := *st
+	rs.onBlockchainStateChange(&st2)
+
+	//崩溃前写入了WAL但是没有处理完,重放一次,AlarmTask重新查询到的不再处理
+	st = newStateChange()
+	_, err = rs.wal.Append(st)
+	assert.Nil(t, err)
+	rs.StateMachineEventHandler = handler
+	rs.replayWAL()
+	es, err = dao.GetAllStateChangeWAL()
+	assert.Nil(t, err)
+	assert.Len(t, es, 0)
+	rs.StateMachineEventHandler = nil
+	rs.onBlockchainStateChange(st)
+}
@@ -0,0 +1,287 @@
+package photon
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/notify"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//webhook通知的类型,同时放在X-Photon-Event头中
+const (
+	WebhookTypeSentTransfer     = "sent_transfer"
+	WebhookTypeReceivedTransfer = "received_transfer"
+	WebhookTypeChannelStatus    = "channel_status"
+)
+
+//webhookPayload POST给webhook的内容,Data和notify中对应通知的Message相同
+type webhookPayload struct {
+	Seq  uint64          `json:"seq"`
+	Type string          `json:"type"`
+	Node common.Address  `json:"node"`
+	Time int64           `json:"time"`
+	Data json.RawMessage `json:"data"`
+}
+
+type webhookDelivery struct {
+	seq  uint64
+	typ  string
+	body []byte
+}
+
+/*
+webhookDispatcher 订阅SentTransfer,ReceivedTransfer以及通道状态的通知,POST到配置的地址.
+每个地址一个goroutine按照顺序投递,失败时按照指数退避重试,
+超过params.WebhookMaxRetries次仍然失败,或者photon退出时还没有投递的,保存为dead letter
+*/
+type webhookDispatcher struct {
+	urls    []string
+	secret  []byte
+	node    common.Address
+	dao     models.WebhookDeadLetterDao
+	handler *notify.Handler
+	client  *http.Client
+	sub     *notify.Subscription
+	queues  map[string]chan *webhookDelivery
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func newWebhookDispatcher(urls []string, secret string, node common.Address, dao models.WebhookDeadLetterDao, handler *notify.Handler) *webhookDispatcher {
+	d := &webhookDispatcher{
+		urls:    urls,
+		secret:  []byte(secret),
+		node:    node,
+		dao:     dao,
+		handler: handler,
+		client:  &http.Client{Timeout: params.WebhookTimeout},
+		queues:  make(map[string]chan *webhookDelivery),
+	}
+	for _, u := range urls {
+		d.queues[u] = make(chan *webhookDelivery, params.WebhookQueueSize)
+	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	return d
+}
+
+func (d *webhookDispatcher) start() {
+	//只投递订阅以后的通知
+	d.sub, _ = d.handler.SubscribeFrom(notify.Filter{
+		InfoTypes: []int{notify.InfoTypeSentTransferDetail, notify.InfoTypeChannelStatus},
+	}, d.handler.LastSeq())
+	for u, q := range d.queues {
+		d.wg.Add(1)
+		go d.worker(u, q)
+	}
+	d.wg.Add(1)
+	go d.dispatchLoop()
+}
+
+//stop 必须在NotifyHandler.Stop和关闭数据库之前调用,等待所有未投递的通知保存为dead letter
+func (d *webhookDispatcher) stop() {
+	d.cancel()
+	d.handler.Unsubscribe(d.sub)
+	d.wg.Wait()
+}
+
+func (d *webhookDispatcher) dispatchLoop() {
+	defer d.wg.Done()
+	for {
+		select {
+		case r, ok := <-d.sub.Records():
+			if !ok {
+				return
+			}
+			dv, err := d.newDelivery(r)
+			if err != nil {
+				log.Error(fmt.Sprintf("webhook cannot serialize notification %d, err %s", r.Seq, err))
+				continue
+			}
+			if dv == nil {
+				continue
+			}
+			for u, q := range d.queues {
+				select {
+				case q <- dv:
+				default:
+					d.saveDeadLetter(u, dv, "webhook queue is full", 0)
+				}
+			}
+		case <-d.ctx.Done():
+			return
+		}
+	}
+}
+
+//newDelivery 不需要投递的通知返回nil
+func (d *webhookDispatcher) newDelivery(r *notify.Record) (dv *webhookDelivery, err error) {
+	p := &webhookPayload{
+		Seq:  r.Seq,
+		Node: d.node,
+		Time: time.Now().Unix(),
+	}
+	if r.ReceivedTransfer != nil {
+		p.Type = WebhookTypeReceivedTransfer
+		p.Data, err = json.Marshal(r.ReceivedTransfer)
+		if err != nil {
+			return
+		}
+	} else {
+		var info struct {
+			Type    int             `json:"type"`
+			Message json.RawMessage `json:"message"`
+		}
+		err = json.Unmarshal([]byte(r.Notice.Info), &info)
+		if err != nil {
+			return
+		}
+		switch info.Type {
+		case notify.InfoTypeSentTransferDetail:
+			p.Type = WebhookTypeSentTransfer
+		case notify.InfoTypeChannelStatus:
+			p.Type = WebhookTypeChannelStatus
+		default:
+			return nil, nil
+		}
+		p.Data = info.Message
+	}
+	body, err := json.Marshal(p)
+	if err != nil {
+		return
+	}
+	return &webhookDelivery{seq: r.Seq, typ: p.Type, body: body}, nil
+}
+
+func (d *webhookDispatcher) worker(url string, q chan *webhookDelivery) {
+	defer d.wg.Done()
+	for {
+		select {
+		case dv := <-q:
+			d.deliverWithRetry(url, dv)
+		case <-d.ctx.Done():
+			for {
+				select {
+				case dv := <-q:
+					d.saveDeadLetter(url, dv, "photon stopped before delivery", 0)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (d *webhookDispatcher) deliverWithRetry(url string, dv *webhookDelivery) {
+	interval := params.WebhookRetryInterval
+	for attempt := 1; ; attempt++ {
+		err := d.post(url, dv)
+		if err == nil {
+			return
+		}
+		if attempt > params.WebhookMaxRetries {
+			d.saveDeadLetter(url, dv, err.Error(), attempt)
+			return
+		}
+		log.Warn(fmt.Sprintf("webhook %s deliver %d err %s, retry after %s", url, dv.seq, err, interval))
+		select {
+		case <-time.After(interval):
+		case <-d.ctx.Done():
+			d.saveDeadLetter(url, dv, err.Error(), attempt)
+			return
+		}
+		interval *= 2
+	}
+}
+
+//sign HMAC-SHA256签名,接收方用同样的secret对请求body计算后比较
+func (d *webhookDispatcher) sign(body []byte) string {
+	mac := hmac.New(sha256.New, d.secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+//post 返回2xx认为投递成功
+func (d *webhookDispatcher) post(url string, dv *webhookDelivery) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(dv.body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(d.ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Photon-Event", dv.typ)
+	req.Header.Set("X-Photon-Delivery", strconv.FormatUint(dv.seq, 10))
+	if len(d.secret) > 0 {
+		req.Header.Set("X-Photon-Signature", d.sign(dv.body))
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+func (d *webhookDispatcher) saveDeadLetter(url string, dv *webhookDelivery, errMsg string, attempts int) {
+	dl := &models.WebhookDeadLetter{
+		Key:      utils.NewRandomHash().String(),
+		URL:      url,
+		Seq:      dv.seq,
+		Type:     dv.typ,
+		Payload:  string(dv.body),
+		Error:    errMsg,
+		Attempts: attempts,
+		Time:     time.Now().Unix(),
+	}
+	log.Error(fmt.Sprintf("webhook %s give up notification %d, err %s", url, dv.seq, errMsg))
+	err := d.dao.SaveWebhookDeadLetter(dl)
+	if err != nil {
+		log.Error(fmt.Sprintf("SaveWebhookDeadLetter err %s", err))
+	}
+}
+
+/*
+redeliver 重新投递一条dead letter,只尝试一次,成功以后删除,失败时更新错误信息
+*/
+func (d *webhookDispatcher) redeliver(id string) error {
+	dl, err := d.dao.GetWebhookDeadLetter(id)
+	if err != nil {
+		return err
+	}
+	err = d.post(dl.URL, &webhookDelivery{seq: dl.Seq, typ: dl.Type, body: []byte(dl.Payload)})
+	if err != nil {
+		dl.Attempts++
+		dl.Error = err.Error()
+		dl.Time = time.Now().Unix()
+		err2 := d.dao.SaveWebhookDeadLetter(dl)
+		if err2 != nil {
+			log.Error(fmt.Sprintf("SaveWebhookDeadLetter err %s", err2))
+		}
+		return rerr.ErrWebhookDelivery.AppendError(err)
+	}
+	return d.dao.RemoveWebhookDeadLetter(id)
+}
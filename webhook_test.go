@@ -0,0 +1,90 @@
+package photon
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/notify"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookDispatcher(t *testing.T) {
+	oldRetries, oldInterval := params.WebhookMaxRetries, params.WebhookRetryInterval
+	defer func() {
+		params.WebhookMaxRetries, params.WebhookRetryInterval = oldRetries, oldInterval
+	}()
+	params.WebhookMaxRetries = 2
+	params.WebhookRetryInterval = 10 * time.Millisecond
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+
+	var lock sync.Mutex
+	fail := true
+	received := make(chan *http.Request, 10)
+	bodies := make(chan []byte, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer server.Close()
+
+	h := notify.NewNotifyHandler()
+	defer h.Stop()
+	d := newWebhookDispatcher([]string{server.URL}, "secret", utils.NewRandomAddress(), dao, h)
+	d.start()
+
+	//重试两次仍然失败,保存为dead letter
+	h.NotifyString(notify.LevelInfo, "not delivered")
+	h.NotifySentTransferDetail(&models.SentTransferDetail{Key: "1"})
+	var dls []*models.WebhookDeadLetter
+	for i := 0; i < 100 && len(dls) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		dls, _ = dao.GetAllWebhookDeadLetters()
+	}
+	if !assert.EqualValues(t, 1, len(dls)) {
+		return
+	}
+	assert.EqualValues(t, WebhookTypeSentTransfer, dls[0].Type)
+	assert.EqualValues(t, params.WebhookMaxRetries+1, dls[0].Attempts)
+
+	lock.Lock()
+	fail = false
+	lock.Unlock()
+	assert.Nil(t, d.redeliver(dls[0].Key))
+	r := <-received
+	body := <-bodies
+	assert.EqualValues(t, d.sign(body), r.Header.Get("X-Photon-Signature"))
+	assert.EqualValues(t, WebhookTypeSentTransfer, r.Header.Get("X-Photon-Event"))
+	dls, _ = dao.GetAllWebhookDeadLetters()
+	assert.EqualValues(t, 0, len(dls))
+
+	h.NotifyReceiveTransfer(&models.ReceivedTransfer{Key: "2"})
+	select {
+	case r = <-received:
+		body = <-bodies
+	case <-time.After(time.Second):
+		t.Error("webhook not delivered")
+		return
+	}
+	var p webhookPayload
+	assert.Nil(t, json.Unmarshal(body, &p))
+	assert.EqualValues(t, WebhookTypeReceivedTransfer, p.Type)
+	assert.EqualValues(t, d.node, p.Node)
+	d.stop()
+}